@@ -0,0 +1,66 @@
+package uma
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+var errAudienceMismatch = errors.New("token audience does not match the resource server")
+
+// Audiences returns the aud claim of the token, which can be a string or an array of strings
+func (t *RPT) Audiences() []string {
+	switch v := t.Raw["aud"].(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		auds := make([]string, 0, len(v))
+		for _, s := range v {
+			if s, ok := s.(string); ok {
+				auds = append(auds, s)
+			}
+		}
+		return auds
+	}
+	return nil
+}
+
+// audienceMatches reports whether the token was minted for one of expected. Keycloak only adds clients to
+// aud with an audience mapper, so azp, the client the token was issued to, is accepted as well.
+func audienceMatches(rpt *RPT, expected []string) bool {
+	set := stringSet(expected)
+	for _, aud := range rpt.Audiences() {
+		if _, ok := set[aud]; ok {
+			return true
+		}
+	}
+	_, ok := set[rpt.Azp]
+	return ok && rpt.Azp != ""
+}
+
+// audienceClaim is an aud claim, which can be a string or an array of strings
+type audienceClaim []string
+
+func (a *audienceClaim) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*a = audienceClaim{s}
+		return nil
+	}
+	var arr []string
+	if err := json.Unmarshal(b, &arr); err != nil {
+		return err
+	}
+	*a = arr
+	return nil
+}
+
+// contains reports whether one of expected is in a
+func (a audienceClaim) contains(expected []string) bool {
+	set := stringSet(expected)
+	for _, aud := range a {
+		if _, ok := set[aud]; ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,55 @@
+package uma_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/pckhoi/uma"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// audPayload grants read on User 1 with the given aud and azp claims
+func audPayload(aud, azp string) string {
+	return fmt.Sprintf(
+		`{"sub":"user-1",%s"azp":%q,"authorization":{"permissions":[{"rsid":"rsc-User 1","rsname":"User 1","scopes":["read"]}]}}`,
+		aud, azp,
+	)
+}
+
+func TestExpectedAudiences(t *testing.T) {
+	p := newMockProvider(map[string]string{
+		"aud":       audPayload(`"aud":"api",`, "web"),
+		"aud-array": audPayload(`"aud":["account","api"],`, "web"),
+		"azp":       audPayload(`"aud":"account",`, "api"),
+		"other":     audPayload(`"aud":"account",`, "web"),
+		"none":      audPayload("", ""),
+	})
+	h := newMockManager(t, p, uma.ManagerOptions{ExpectedAudiences: []string{"api"}}).
+		Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for token, status := range map[string]int{
+		"aud":       http.StatusOK,
+		"aud-array": http.StatusOK,
+		"azp":       http.StatusOK,
+		"other":     http.StatusUnauthorized,
+		"none":      http.StatusUnauthorized,
+	} {
+		rec := serve(h, http.MethodGet, "https://api.example.com/users/1", token)
+		assert.Equal(t, status, rec.Code, token)
+	}
+}
+
+func TestParseRPTAudiences(t *testing.T) {
+	rpt, err := uma.ParseRPT([]byte(`{"sub":"user-1","aud":["api","account"]}`))
+	require.NoError(t, err)
+	assert.Equal(t, "api", rpt.Aud)
+	assert.Equal(t, []string{"api", "account"}, rpt.Audiences())
+	assert.Equal(t, "user-1", rpt.Sub)
+
+	rpt, err = uma.ParseRPT([]byte(`{"aud":"api"}`))
+	require.NoError(t, err)
+	assert.Equal(t, "api", rpt.Aud)
+	assert.Equal(t, []string{"api"}, rpt.Audiences())
+}
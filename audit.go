@@ -0,0 +1,67 @@
+package uma
+
+import (
+	"net/http"
+	"time"
+)
+
+// AuditEventType is the type of an AuditEvent
+type AuditEventType string
+
+const (
+	// AuditResourceRegistered means a resource was created on the authorization server
+	AuditResourceRegistered AuditEventType = "resource.registered"
+
+	// AuditAccessDenied means a request was denied
+	AuditAccessDenied AuditEventType = "access.denied"
+
+	// AuditTicketIssued means a permission ticket was issued for a denied request
+	AuditTicketIssued AuditEventType = "ticket.issued"
+)
+
+// AuditEvent is a security relevant event of the Manager
+type AuditEvent struct {
+	Type   AuditEventType `json:"type"`
+	Time   time.Time      `json:"time"`
+	Method string         `json:"method"`
+	Path   string         `json:"path"`
+
+	// Issuer is the issuer of the authorization server
+	Issuer       string   `json:"issuer,omitempty"`
+	ResourceID   string   `json:"resourceId,omitempty"`
+	ResourceName string   `json:"resourceName,omitempty"`
+	Scopes       []string `json:"scopes,omitempty"`
+
+	// Reason and Error are set for AuditAccessDenied events
+	Reason DenialReason `json:"reason,omitempty"`
+	Error  string       `json:"error,omitempty"`
+}
+
+// AuditSink receives audit events. Audit is called while the request is being served, so implementations
+// should not block, see WebhookSink.
+type AuditSink interface {
+	Audit(e AuditEvent)
+}
+
+// audit sends an event about r and rsc to the AuditSink, if there is one
+func (m *Manager) audit(r *http.Request, p Provider, typ AuditEventType, rsc *Resource, scopes []string, edit func(e *AuditEvent)) {
+	if m.auditSink == nil {
+		return
+	}
+	e := AuditEvent{
+		Type:   typ,
+		Time:   m.clock.Now().UTC(),
+		Method: r.Method,
+		Path:   r.URL.Path,
+		Issuer: p.WWWAuthenticateDirectives().AsUri,
+		Scopes: scopes,
+	}
+	if rsc != nil {
+		e.ResourceID = rsc.ID
+		e.ResourceName = rsc.Name
+	}
+	if edit != nil {
+		edit(&e)
+	}
+	m.auditSink.Audit(e)
+}
@@ -5,61 +5,301 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/coreos/go-oidc/v3/oidc"
 	"github.com/go-logr/logr"
+	"github.com/pckhoi/uma/pkg/clock"
 	"github.com/pckhoi/uma/pkg/httputil"
 )
 
-type baseProvider struct {
+// BaseProvider implements Provider with the standard UMA endpoints found in the discovery document.
+// It can be embedded by providers of specific authorization servers, like KeycloakProvider does,
+// which then only override methods that behave differently.
+//
+// BaseProvider is safe for concurrent use. Options are only applied by the constructor, after which the
+// only mutable state is the discovery document, the keys and the protection API token, each of which is
+// guarded by its own lock.
+type BaseProvider struct {
 	issuer       string
 	clientID     string
 	clientSecret string
 	keySet       KeySet
-	discovery    DiscoveryDoc
+	signingAlgs  []string
+	discoveryMu  sync.RWMutex
+	discovery    UMADiscovery
 	client       *httputil.Client
 	logger       logr.Logger
+
+	metadataStore MetadataStore
 }
 
-func newBaseProvider(issuer, clientID, clientSecret string, keySet KeySet, client *httputil.Client, logger logr.Logger) *baseProvider {
-	p := &baseProvider{
+func newBaseProvider(issuer, clientID, clientSecret string, keySet KeySet, client *httputil.Client, logger logr.Logger) *BaseProvider {
+	p := &BaseProvider{
 		issuer:       issuer,
 		clientID:     clientID,
 		clientSecret: clientSecret,
 		keySet:       keySet,
+		signingAlgs:  DefaultSigningAlgorithms,
 		client:       client,
 		logger:       logger,
 	}
 	return p
 }
 
-type DiscoveryDoc struct {
-	TokenEndpoint                string `json:"token_endpoint,omitempty"`
-	TokenIntrospectionEndpoint   string `json:"token_introspection_endpoint,omitempty"`
-	ResourceRegistrationEndpoint string `json:"resource_registration_endpoint,omitempty"`
-	PermissionEndpoint           string `json:"permission_endpoint,omitempty"`
-	PolicyEndpoint               string `json:"policy_endpoint,omitempty"`
+type BaseProviderOption func(p *BaseProvider)
+
+// WithSigningAlgorithms sets the JOSE algorithms that tokens can be signed with, e.g. ES256 or EdDSA.
+// Tokens signed with other algorithms are rejected with ErrDisallowedAlgorithm before their signature
+// is verified. Defaults to DefaultSigningAlgorithms.
+func WithSigningAlgorithms(algs ...string) BaseProviderOption {
+	return func(p *BaseProvider) {
+		p.signingAlgs = algs
+	}
 }
 
-func (p *baseProvider) discover() error {
-	resp, err := p.client.Get(p.issuer + "/.well-known/uma2-configuration")
-	if err != nil {
-		return err
+// WithUserAgent identifies the app in the User-Agent header of requests to the authorization server,
+// e.g. "billing-api/1.4.2", along with this library. comments such as build metadata e.g.
+// "commit=abc123" are added in parentheses. Without this option, only this library is identified.
+func WithUserAgent(app string, comments ...string) BaseProviderOption {
+	return func(p *BaseProvider) {
+		p.client.UserAgent = httputil.UserAgent(app, comments...)
+	}
+}
+
+// WithRequestEditor adds a function that modifies every request sent to the authorization server, e.g.
+// to add tracing headers. It can be given multiple times, editors run in order after the User-Agent
+// header is set. Requests sent by the KeySet are not affected.
+func WithRequestEditor(editor func(req *http.Request)) BaseProviderOption {
+	return func(p *BaseProvider) {
+		p.client.RequestEditors = append(p.client.RequestEditors, editor)
+	}
+}
+
+// WithClock sets the clock that tells when the protection API token expires. Defaults to the system
+// clock.
+func WithClock(c clock.Clock) BaseProviderOption {
+	return func(p *BaseProvider) {
+		p.client.Clock = c
+	}
+}
+
+// WithRetryOptions retries requests to the authorization server that fail with network errors or
+// retryable statuses, see httputil.RetryableStatus. Requests are not retried by default.
+func WithRetryOptions(opts httputil.RetryOptions) BaseProviderOption {
+	return func(p *BaseProvider) {
+		p.client.Retry = opts
+	}
+}
+
+// WithPayloadCodec adapts payloads of the protection API to authorization servers that deviate from the
+// UMA spec, e.g. to rename fields:
+//
+//	uma.WithPayloadCodec(httputil.RenameFields{"_id": "id", "resource_scopes": "scopes"})
+func WithPayloadCodec(codec httputil.Codec) BaseProviderOption {
+	return func(p *BaseProvider) {
+		p.client.Codec = codec
+	}
+}
+
+// NewBaseProvider creates a provider for any authorization server that supports UMA discovery. The
+// client is used for requests to the authorization server, http.DefaultClient is used if it is nil. Give
+// each provider its own client to reach issuers through different proxies or with different TLS client
+// certificates. If keySet is nil, keys are fetched with client from the jwks_uri of the discovery document.
+func NewBaseProvider(issuer, clientID, clientSecret string, keySet KeySet, client *http.Client, logger logr.Logger, opts ...BaseProviderOption) (*BaseProvider, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	logger = logger.WithValues(
+		"issuer", issuer,
+		"client_id", clientID,
+	)
+	hc := &httputil.Client{
+		Client:    client,
+		Logger:    logger,
+		UserAgent: httputil.UserAgent(""),
+	}
+	p := newBaseProvider(issuer, clientID, clientSecret, keySet, hc, logger)
+	for _, opt := range opts {
+		opt(p)
+	}
+	hc.Authenticator = p
+	if err := p.discover(); err != nil {
+		return nil, err
 	}
-	doc := &DiscoveryDoc{}
-	if err = httputil.DecodeJSONResponse(resp, doc); err != nil {
-		return err
+	if p.keySet == nil {
+		p.keySet = p.remoteKeySet(client)
 	}
+	return p, nil
+}
+
+// remoteKeySet returns a KeySet that fetches keys from the jwks_uri of the discovery document with client,
+// so that keys go through the same proxy and TLS settings as other requests. Keys are saved to the metadata
+// store, if any. It returns nil if the discovery document has no jwks_uri.
+func (p *BaseProvider) remoteKeySet(client *http.Client) KeySet {
+	uri := p.Discovery().JwksURI
+	if uri == "" {
+		return nil
+	}
+	if p.metadataStore != nil {
+		return p.newSnapshotKeySet()
+	}
+	return oidc.NewRemoteKeySet(oidc.ClientContext(context.Background(), client), uri)
+}
+
+// UMADiscovery is the authorization server metadata found at /.well-known/uma2-configuration. Learn more at
+// https://docs.kantarainitiative.org/uma/wg/rec-oauth-uma-grant-2.0.html#as-config
+type UMADiscovery struct {
+	Issuer                                    string   `json:"issuer,omitempty"`
+	AuthorizationEndpoint                     string   `json:"authorization_endpoint,omitempty"`
+	TokenEndpoint                             string   `json:"token_endpoint,omitempty"`
+	TokenIntrospectionEndpoint                string   `json:"token_introspection_endpoint,omitempty"`
+	IntrospectionEndpoint                     string   `json:"introspection_endpoint,omitempty"`
+	UserinfoEndpoint                          string   `json:"userinfo_endpoint,omitempty"`
+	EndSessionEndpoint                        string   `json:"end_session_endpoint,omitempty"`
+	JwksURI                                   string   `json:"jwks_uri,omitempty"`
+	RegistrationEndpoint                      string   `json:"registration_endpoint,omitempty"`
+	ClaimsInteractionEndpoint                 string   `json:"claims_interaction_endpoint,omitempty"`
+	ResourceRegistrationEndpoint              string   `json:"resource_registration_endpoint,omitempty"`
+	PermissionEndpoint                        string   `json:"permission_endpoint,omitempty"`
+	PolicyEndpoint                            string   `json:"policy_endpoint,omitempty"`
+	GrantTypesSupported                       []string `json:"grant_types_supported,omitempty"`
+	ResponseTypesSupported                    []string `json:"response_types_supported,omitempty"`
+	ResponseModesSupported                    []string `json:"response_modes_supported,omitempty"`
+	ScopesSupported                           []string `json:"scopes_supported,omitempty"`
+	TokenEndpointAuthMethodsSupported         []string `json:"token_endpoint_auth_methods_supported,omitempty"`
+	TokenEndpointAuthSigningAlgsSupported     []string `json:"token_endpoint_auth_signing_alg_values_supported,omitempty"`
+	UMAProfilesSupported                      []string `json:"uma_profiles_supported,omitempty"`
+	IntrospectionEndpointAuthMethodsSupported []string `json:"introspection_endpoint_auth_methods_supported,omitempty"`
+}
+
+// DiscoveryDoc is the former name of UMADiscovery.
+//
+// Deprecated: use UMADiscovery instead.
+type DiscoveryDoc = UMADiscovery
+
+// discover fetches the discovery document. If it can't be fetched, the last good document is loaded from
+// the metadata store, if any.
+func (p *BaseProvider) discover() error {
+	doc, err := p.fetchDiscovery()
+	if err != nil {
+		if p.metadataStore == nil {
+			return err
+		}
+		doc = &UMADiscovery{}
+		if !p.loadSnapshot(discoverySnapshotKey(p.issuer), doc) {
+			return err
+		}
+		p.logger.Error(err, "error discovering endpoints, using snapshot")
+	} else if p.metadataStore != nil {
+		p.saveSnapshot(discoverySnapshotKey(p.issuer), doc)
+	}
+	p.discoveryMu.Lock()
 	p.discovery = *doc
+	p.discoveryMu.Unlock()
 	return nil
 }
 
-func (p *baseProvider) VerifySignature(ctx context.Context, jwt string) (payload []byte, err error) {
+func (p *BaseProvider) fetchDiscovery() (*UMADiscovery, error) {
+	resp, err := p.client.Get(p.issuer + "/.well-known/uma2-configuration")
+	if err != nil {
+		return nil, ErrDiscoveryFailed{Issuer: p.issuer, Err: err}
+	}
+	doc := &UMADiscovery{}
+	if err = p.client.DecodeJSONResponse(resp, doc); err != nil {
+		return nil, ErrDiscoveryFailed{Issuer: p.issuer, Err: err}
+	}
+	return doc, nil
+}
+
+// refreshDiscovery re-discovers endpoints, and refreshes keys saved to the metadata store, at the given
+// interval until stop is closed
+func (p *BaseProvider) refreshDiscovery(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := p.discover(); err != nil {
+				p.logger.Error(err, "error refreshing discovery document")
+			}
+			// refresh keys ahead of their rotation rather than when a token is signed with a new key
+			if ks, ok := p.keySet.(*snapshotKeySet); ok {
+				if err := ks.refresh(); err != nil {
+					p.logger.Error(err, "error refreshing jwks")
+				}
+			}
+		}
+	}
+}
+
+// Discovery returns the UMA discovery document of the authorization server
+func (p *BaseProvider) Discovery() UMADiscovery {
+	p.discoveryMu.RLock()
+	defer p.discoveryMu.RUnlock()
+	return p.discovery
+}
+
+// WWWAuthenticateDirectives uses the last path segment of the issuer as realm
+func (p *BaseProvider) WWWAuthenticateDirectives() WWWAuthenticateDirectives {
+	path := strings.Split(p.issuer, "/")
+	return WWWAuthenticateDirectives{
+		Realm: path[len(path)-1],
+		AsUri: p.issuer,
+	}
+}
+
+// SigningAlgorithms returns the JOSE algorithms that tokens can be signed with
+func (p *BaseProvider) SigningAlgorithms() []string {
+	return p.signingAlgs
+}
+
+func (p *BaseProvider) VerifySignature(ctx context.Context, jwt string) (payload []byte, err error) {
+	if err := checkSigningAlgorithm(jwt, p.signingAlgs); err != nil {
+		return nil, err
+	}
 	return p.keySet.VerifySignature(ctx, jwt)
 }
 
-func (p *baseProvider) Authenticate(client *http.Client) (*httputil.ClientCreds, error) {
+// ProtectionAPIToken returns the PAT sent with requests to the protection API, obtaining a new one with
+// client credentials if there is none yet or if it has expired
+func (p *BaseProvider) ProtectionAPIToken(ctx context.Context) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	return p.client.AccessToken()
+}
+
+// ProtectionRequest sends a request to an endpoint of the authorization server that is not wrapped by
+// this package, with the same PAT, User-Agent and request editors as other requests of the provider
+func (p *BaseProvider) ProtectionRequest(ctx context.Context, method, endpointSuffix string, body interface{}) (*http.Response, error) {
+	if !strings.HasPrefix(endpointSuffix, "/") {
+		endpointSuffix = "/" + endpointSuffix
+	}
+	endpoint := p.issuer + endpointSuffix
+	var (
+		req *http.Request
+		err error
+	)
+	if body != nil {
+		req, err = httputil.JSONRequest(method, endpoint, body)
+	} else {
+		req, err = http.NewRequest(method, endpoint, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	return p.client.DoRequest(req.WithContext(ctx))
+}
+
+func (p *BaseProvider) Authenticate(client *http.Client) (*httputil.ClientCreds, error) {
 	p.logger.Info("authenticating client")
-	resp, err := p.client.PostFormUrlencoded(p.discovery.TokenEndpoint, nil, map[string][]string{
+	resp, err := p.client.PostFormUrlencoded(p.Discovery().TokenEndpoint, nil, map[string][]string{
 		"grant_type":    {"client_credentials"},
 		"client_id":     {p.clientID},
 		"client_secret": {p.clientSecret},
@@ -68,70 +308,69 @@ func (p *baseProvider) Authenticate(client *http.Client) (*httputil.ClientCreds,
 		return nil, err
 	}
 	creds := &httputil.ClientCreds{}
-	if err = httputil.DecodeJSONResponse(resp, creds); err != nil {
+	if err = p.client.DecodeJSONResponse(resp, creds); err != nil {
 		return nil, err
 	}
 	return creds, nil
 }
 
-func (p *baseProvider) CreateResource(request *Resource) (response *ExpandedResource, err error) {
+func (p *BaseProvider) CreateResource(request *Resource) (response *ExpandedResource, err error) {
 	response = &ExpandedResource{}
-	if err = p.client.CreateObject(p.discovery.ResourceRegistrationEndpoint, request, response); err != nil {
+	if err = p.client.CreateObject(p.Discovery().ResourceRegistrationEndpoint, request, response); err != nil {
+		if isConflict(err) {
+			return nil, ErrResourceConflict{Name: request.Name, Err: err}
+		}
 		return nil, err
 	}
 	return response, nil
 }
 
-func (p *baseProvider) GetResource(id string) (resource *ExpandedResource, err error) {
-	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/%s", p.discovery.ResourceRegistrationEndpoint, id), nil)
-	if err != nil {
-		return nil, err
-	}
-	resp, err := p.client.DoRequest(req)
-	if err != nil {
-		return nil, err
-	}
-	if err = httputil.Ensure2XX(resp); err != nil {
-		return nil, err
-	}
+func (p *BaseProvider) GetResource(id string) (resource *ExpandedResource, err error) {
 	resource = &ExpandedResource{}
-	if err = httputil.DecodeJSONResponse(resp, resource); err != nil {
+	if err = p.client.GetObject(fmt.Sprintf("%s/%s", p.Discovery().ResourceRegistrationEndpoint, id), resource); err != nil {
 		return nil, err
 	}
 	return resource, nil
 }
 
-func (p *baseProvider) UpdateResource(id string, resource *Resource) (err error) {
-	return p.client.UpdateObject(fmt.Sprintf("%s/%s", p.discovery.ResourceRegistrationEndpoint, id), resource)
+func (p *BaseProvider) UpdateResource(id string, resource *Resource) (err error) {
+	return p.client.UpdateObject(fmt.Sprintf("%s/%s", p.Discovery().ResourceRegistrationEndpoint, id), resource)
 }
 
-func (p *baseProvider) DeleteResource(id string) (err error) {
-	return p.client.DeleteObject(fmt.Sprintf("%s/%s", p.discovery.ResourceRegistrationEndpoint, id))
+func (p *BaseProvider) DeleteResource(id string) (err error) {
+	return p.client.DeleteObject(fmt.Sprintf("%s/%s", p.Discovery().ResourceRegistrationEndpoint, id))
 }
 
-func (p *baseProvider) ListResources(urlQuery url.Values) (ids []string, err error) {
+func (p *BaseProvider) ListResources(urlQuery url.Values) (ids []string, err error) {
 	ids = []string{}
-	if err = p.client.ListObjects(p.discovery.ResourceRegistrationEndpoint, urlQuery, &ids); err != nil {
+	if err = p.client.ListObjects(p.Discovery().ResourceRegistrationEndpoint, urlQuery, &ids); err != nil {
 		return
 	}
 	return ids, nil
 }
 
 type permissionRequest struct {
-	ResourceID     string   `json:"resource_id,omitempty"`
-	ResourceScopes []string `json:"resource_scopes,omitempty"`
+	ResourceID     string              `json:"resource_id,omitempty"`
+	ResourceScopes []string            `json:"resource_scopes,omitempty"`
+	Claims         map[string][]string `json:"claims,omitempty"`
 }
 
 type permissionResponse struct {
 	Ticket string `json:"ticket"`
 }
 
-func (p *baseProvider) CreatePermissionTicket(resourceID string, scopes ...string) (string, error) {
+func (p *BaseProvider) CreatePermissionTicket(resourceID string, scopes ...string) (string, error) {
+	return p.CreatePermissionTicketWithClaims(resourceID, nil, scopes...)
+}
+
+// CreatePermissionTicketWithClaims creates a permission ticket and pushes claims along with the permission
+// request. Authorization servers that support pushed claims, such as Keycloak, attach them to the ticket.
+func (p *BaseProvider) CreatePermissionTicketWithClaims(resourceID string, claims map[string][]string, scopes ...string) (string, error) {
 	respObj := &permissionResponse{}
-	if err := p.client.CreateObject(p.discovery.PermissionEndpoint, []permissionRequest{
-		{ResourceID: resourceID, ResourceScopes: scopes},
+	if err := p.client.CreateObject(p.Discovery().PermissionEndpoint, []permissionRequest{
+		{ResourceID: resourceID, ResourceScopes: scopes, Claims: claims},
 	}, respObj); err != nil {
-		return "", err
+		return "", newErrTicketRequestFailed(resourceID, err)
 	}
 	return respObj.Ticket, nil
 }
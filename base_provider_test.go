@@ -0,0 +1,270 @@
+package uma_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/pckhoi/uma"
+	"github.com/pckhoi/uma/pkg/httputil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProtectionAPIToken(t *testing.T) {
+	var issuer string
+	tokens := 0
+	mux := http.NewServeMux()
+	writeJSON := func(w http.ResponseWriter, obj any) {
+		w.Header().Set("Content-Type", "application/json")
+		require.NoError(t, json.NewEncoder(w).Encode(obj))
+	}
+	mux.HandleFunc("/.well-known/uma2-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]string{
+			"issuer":                         issuer,
+			"token_endpoint":                 issuer + "/token",
+			"resource_registration_endpoint": issuer + "/resource_set",
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, "client_credentials", r.PostForm.Get("grant_type"))
+		tokens++
+		writeJSON(w, map[string]any{"access_token": "pat", "expires_in": 300})
+	})
+	mux.HandleFunc("/resource_set", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer pat", r.Header.Get("Authorization"))
+		writeJSON(w, []string{"rsc-1"})
+	})
+	s := httptest.NewServer(mux)
+	defer s.Close()
+	issuer = s.URL
+
+	p, err := uma.NewBaseProvider(issuer, "client", "secret", nil, s.Client(), testr.New(t))
+	require.NoError(t, err)
+	pat, err := p.ProtectionAPIToken(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "pat", pat)
+
+	// the token is shared with requests of the provider
+	ids, err := p.ListResources(nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"rsc-1"}, ids)
+	assert.Equal(t, 1, tokens)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = p.ProtectionAPIToken(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	_, err = uma.NewOfflineProvider(&uma.VerificationBundle{Issuer: issuer}).ProtectionAPIToken(context.Background())
+	assert.ErrorAs(t, err, &uma.ErrOffline{})
+}
+
+func TestProtectionRequest(t *testing.T) {
+	var issuer string
+	mux := http.NewServeMux()
+	writeJSON := func(w http.ResponseWriter, obj any) {
+		w.Header().Set("Content-Type", "application/json")
+		require.NoError(t, json.NewEncoder(w).Encode(obj))
+	}
+	mux.HandleFunc("/.well-known/uma2-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]string{"issuer": issuer, "token_endpoint": issuer + "/token"})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]any{"access_token": "pat", "expires_in": 300})
+	})
+	mux.HandleFunc("/authz/protection/uma-policy/rsc-1", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer pat", r.Header.Get("Authorization"))
+		assert.Equal(t, "application/json", r.Header.Get("Accept"))
+		assert.Contains(t, r.Header.Get("User-Agent"), "billing-api/1.4.2")
+		if r.Method == http.MethodGet {
+			assert.Empty(t, r.Header.Get("Content-Type"))
+			writeJSON(w, map[string]string{"name": "Any owner"})
+			return
+		}
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		obj := map[string]any{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&obj))
+		assert.Equal(t, map[string]any{"name": "Any owner", "scopes": []any{"read"}}, obj)
+		w.WriteHeader(http.StatusCreated)
+	})
+	s := httptest.NewServer(mux)
+	defer s.Close()
+	issuer = s.URL
+
+	p, err := uma.NewBaseProvider(issuer, "client", "secret", nil, s.Client(), testr.New(t), uma.WithUserAgent("billing-api/1.4.2"))
+	require.NoError(t, err)
+
+	resp, err := p.ProtectionRequest(context.Background(), http.MethodPost, "/authz/protection/uma-policy/rsc-1", map[string]any{
+		"name":   "Any owner",
+		"scopes": []string{"read"},
+	})
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	resp, err = p.ProtectionRequest(context.Background(), http.MethodGet, "authz/protection/uma-policy/rsc-1", nil)
+	require.NoError(t, err)
+	policy := map[string]string{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&policy))
+	resp.Body.Close()
+	assert.Equal(t, "Any owner", policy["name"])
+
+	// unsuccessful responses are returned as is
+	resp, err = p.ProtectionRequest(context.Background(), http.MethodGet, "/authz/protection/unknown", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestProviderRetryOptions(t *testing.T) {
+	var issuer string
+	failures := map[string]int{"/.well-known/uma2-configuration": 1, "/token": 2}
+	mux := http.NewServeMux()
+	writeJSON := func(w http.ResponseWriter, obj any) {
+		w.Header().Set("Content-Type", "application/json")
+		require.NoError(t, json.NewEncoder(w).Encode(obj))
+	}
+	flaky := func(h http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if failures[r.URL.Path] > 0 {
+				failures[r.URL.Path]--
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			h(w, r)
+		}
+	}
+	mux.HandleFunc("/.well-known/uma2-configuration", flaky(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]string{"issuer": issuer, "token_endpoint": issuer + "/token"})
+	}))
+	mux.HandleFunc("/token", flaky(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, "client_credentials", r.PostForm.Get("grant_type"))
+		writeJSON(w, map[string]any{"access_token": "pat", "expires_in": 300})
+	}))
+	s := httptest.NewServer(mux)
+	defer s.Close()
+	issuer = s.URL
+
+	_, err := uma.NewBaseProvider(issuer, "client", "secret", nil, s.Client(), testr.New(t))
+	require.Error(t, err)
+
+	p, err := uma.NewBaseProvider(issuer, "client", "secret", nil, s.Client(), testr.New(t),
+		uma.WithRetryOptions(httputil.RetryOptions{MaxAttempts: 3, Backoff: time.Millisecond}))
+	require.NoError(t, err)
+	pat, err := p.ProtectionAPIToken(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "pat", pat)
+	assert.Equal(t, 0, failures["/token"])
+}
+
+func TestPayloadCodec(t *testing.T) {
+	var issuer string
+	var created map[string]any
+	mux := http.NewServeMux()
+	writeJSON := func(w http.ResponseWriter, obj any) {
+		w.Header().Set("Content-Type", "application/json")
+		require.NoError(t, json.NewEncoder(w).Encode(obj))
+	}
+	mux.HandleFunc("/.well-known/uma2-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]string{
+			"issuer":                         issuer,
+			"token_endpoint":                 issuer + "/token",
+			"resource_registration_endpoint": issuer + "/resource_set",
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]any{"access_token": "pat", "expires_in": 300})
+	})
+	mux.HandleFunc("/resource_set", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&created))
+		writeJSON(w, map[string]any{"id": "rsc-1", "name": created["name"], "scopes": []map[string]string{{"name": "read"}}})
+	})
+	mux.HandleFunc("/resource_set/rsc-1", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]any{"id": "rsc-1", "name": "User 1", "scopes": []map[string]string{{"name": "read"}}})
+	})
+	s := httptest.NewServer(mux)
+	defer s.Close()
+	issuer = s.URL
+
+	p, err := uma.NewBaseProvider(issuer, "client", "secret", nil, s.Client(), testr.New(t),
+		uma.WithPayloadCodec(httputil.RenameFields{"_id": "id", "resource_scopes": "scopes"}))
+	require.NoError(t, err)
+	res, err := p.CreateResource(&uma.Resource{
+		ResourceType: uma.ResourceType{Type: "user", ResourceScopes: []string{"read"}},
+		Name:         "User 1",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []any{"read"}, created["scopes"])
+	assert.NotContains(t, created, "resource_scopes")
+	assert.Equal(t, "rsc-1", res.ID)
+	assert.Equal(t, []uma.Scope{{Name: "read"}}, res.ResourceScopes)
+
+	res, err = p.GetResource("rsc-1")
+	require.NoError(t, err)
+	assert.Equal(t, "rsc-1", res.ID)
+	assert.Equal(t, []uma.Scope{{Name: "read"}}, res.ResourceScopes)
+}
+
+func TestRequestEditor(t *testing.T) {
+	var issuer string
+	var mu sync.Mutex
+	traces := map[string]string{}
+	mux := http.NewServeMux()
+	writeJSON := func(w http.ResponseWriter, obj any) {
+		w.Header().Set("Content-Type", "application/json")
+		require.NoError(t, json.NewEncoder(w).Encode(obj))
+	}
+	record := func(r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		traces[r.Method+" "+r.URL.Path] = r.Header.Get("X-Trace")
+	}
+	mux.HandleFunc("/.well-known/uma2-configuration", func(w http.ResponseWriter, r *http.Request) {
+		record(r)
+		writeJSON(w, map[string]string{
+			"issuer":                         issuer,
+			"token_endpoint":                 issuer + "/token",
+			"resource_registration_endpoint": issuer + "/resource_set",
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		record(r)
+		writeJSON(w, map[string]any{"access_token": "pat", "expires_in": 300})
+	})
+	mux.HandleFunc("/resource_set", func(w http.ResponseWriter, r *http.Request) {
+		record(r)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		writeJSON(w, map[string]string{"_id": "rsc-1"})
+	})
+	s := httptest.NewServer(mux)
+	defer s.Close()
+	issuer = s.URL
+
+	p, err := uma.NewBaseProvider(issuer, "client", "secret", nil, s.Client(), testr.New(t),
+		uma.WithUserAgent("billing-api/1.4.2"),
+		uma.WithRequestEditor(func(req *http.Request) {
+			// editors run after the User-Agent is set
+			req.Header.Set("X-Trace", req.Header.Get("User-Agent")[:len("billing-api")])
+		}),
+		uma.WithRequestEditor(func(req *http.Request) {
+			req.Header.Set("X-Trace", req.Header.Get("X-Trace")+"/trace-1")
+		}),
+	)
+	require.NoError(t, err)
+	_, err = p.CreateResource(&uma.Resource{Name: "User 1"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"GET /.well-known/uma2-configuration": "billing-api/trace-1",
+		"POST /token":                         "billing-api/trace-1",
+		"POST /resource_set":                  "billing-api/trace-1",
+	}, traces)
+}
@@ -0,0 +1,73 @@
+package uma_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/pckhoi/uma"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetBaseURLs(t *testing.T) {
+	var rsc *uma.Resource
+	man := uma.New(
+		uma.ManagerOptions{
+			GetBaseURL: func(r *http.Request) url.URL {
+				panic("GetBaseURL should not be called when GetBaseURLs is defined")
+			},
+			GetBaseURLs: func(r *http.Request) []url.URL {
+				return []url.URL{
+					{Scheme: "https", Host: "api.example.com", Path: "/v1"},
+					{Scheme: "https", Host: "api.example.com", Path: "/v2/"},
+					{Scheme: "https", Host: "api.example.com"},
+				}
+			},
+			CustomEnforce: func(r *http.Request, resource uma.Resource, scopes []string) bool {
+				rsc = &resource
+				return true
+			},
+		},
+		map[string]uma.ResourceType{
+			"user": {Type: "user", ResourceScopes: []string{"read"}},
+		},
+		[]string{"oidc"},
+		nil,
+		[]map[string][]string{{"oidc": {"read"}}},
+		[]uma.Path{
+			uma.NewPath("/users/{id}", uma.NewResourceTemplate("user", "User {id}"), map[string]uma.Operation{
+				http.MethodGet: {},
+			}),
+			uma.NewPath("/v1/legacy", uma.NewResourceTemplate("user", "Legacy"), map[string]uma.Operation{
+				http.MethodGet: {},
+			}),
+		},
+		testr.New(t),
+	)
+	h := man.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for _, c := range []struct {
+		path string
+		uri  string
+	}{
+		{"/v1/users/1", "https://api.example.com/v1/users/1"},
+		{"/v2/users/1", "https://api.example.com/v2/users/1"},
+		{"/users/1", "https://api.example.com/users/1"},
+		// falls through to the next base url when the remaining path doesn't match
+		{"/v1/legacy", "https://api.example.com/v1/legacy"},
+		{"/v10/users/1", ""},
+		{"/v3/users/1", ""},
+	} {
+		rsc = nil
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "https://api.example.com"+c.path, nil))
+		assert.Equal(t, http.StatusOK, rec.Code, c.path)
+		if c.uri == "" {
+			assert.Nil(t, rsc, c.path)
+		} else if assert.NotNil(t, rsc, c.path) {
+			assert.Equal(t, c.uri, rsc.URI, c.path)
+		}
+	}
+}
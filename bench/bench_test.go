@@ -0,0 +1,196 @@
+package bench
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/go-logr/logr"
+	"github.com/pckhoi/uma"
+)
+
+const numTemplates = 500
+
+type memStore struct {
+	mu sync.RWMutex
+	m  map[string]string
+}
+
+func (s *memStore) Set(name, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.m[name] = id
+	return nil
+}
+
+func (s *memStore) Get(name string) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.m[name], nil
+}
+
+// templatePaths returns n paths shaped like a large REST api, each with a resource template
+func templatePaths(n int) []uma.Path {
+	paths := make([]uma.Path, 0, n)
+	for i := 0; len(paths) < n; i++ {
+		paths = append(paths,
+			uma.NewPath(
+				fmt.Sprintf("/svc%d/items/{id}", i),
+				uma.NewResourceTemplate("item", fmt.Sprintf("Service %d item {id}", i)),
+				map[string]uma.Operation{
+					http.MethodGet: {},
+					http.MethodPut: {Security: []map[string][]string{{"oidc": {"write"}}}},
+				},
+			),
+			uma.NewPath(
+				fmt.Sprintf("/svc%d/items/{id}/parts/{part}", i),
+				uma.NewResourceTemplate("item", fmt.Sprintf("Service %d item {id} part {part}", i)),
+				map[string]uma.Operation{
+					http.MethodGet: {},
+				},
+			),
+		)
+	}
+	return paths[:n]
+}
+
+func newManager(opts uma.ManagerOptions, p uma.Provider) *uma.Manager {
+	opts.GetBaseURL = func(r *http.Request) url.URL {
+		return url.URL{Scheme: "https", Host: "api.example.com", Path: "/api"}
+	}
+	opts.GetProvider = func(r *http.Request) uma.Provider {
+		return p
+	}
+	rs := &memStore{m: map[string]string{}}
+	opts.GetResourceStore = func(r *http.Request) uma.ResourceStore {
+		return rs
+	}
+	return uma.New(
+		opts,
+		map[string]uma.ResourceType{
+			"item": {Type: "item", ResourceScopes: []string{"read", "write"}},
+		},
+		[]string{"oidc"},
+		nil,
+		[]map[string][]string{{"oidc": {"read"}}},
+		templatePaths(numTemplates),
+		logr.Discard(),
+	)
+}
+
+func newProvider(b *testing.B, as *mockAS) *uma.KeycloakProvider {
+	b.Helper()
+	kp, err := uma.NewKeycloakProvider(
+		as.URL, "bench", "secret",
+		oidc.NewRemoteKeySet(context.Background(), as.URL+"/certs"),
+		logr.Discard(),
+	)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return kp
+}
+
+func serve(b *testing.B, h http.Handler, method, uri, token string, status int) {
+	r := httptest.NewRequest(method, uri, nil)
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	if rec.Code != status {
+		b.Fatalf("%s %s: expected status %d, got %d", method, uri, status, rec.Code)
+	}
+}
+
+var allow = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+func BenchmarkMatcher(b *testing.B) {
+	m := newManager(uma.ManagerOptions{
+		CustomEnforce: func(r *http.Request, resource uma.Resource, scopes []string) bool {
+			return true
+		},
+	}, nil)
+	h := m.Middleware(allow)
+	for _, c := range []struct {
+		name string
+		path string
+	}{
+		{"first", "/api/svc0/items/1"},
+		{"middle", fmt.Sprintf("/api/svc%d/items/1/parts/2", numTemplates/4)},
+		{"last", fmt.Sprintf("/api/svc%d/items/1/parts/2", numTemplates/2-1)},
+		{"miss", "/api/unknown/path"},
+	} {
+		uri := "https://api.example.com" + c.path
+		b.Run(c.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				serve(b, h, http.MethodGet, uri, "", http.StatusOK)
+			}
+		})
+	}
+}
+
+func BenchmarkTokenVerification(b *testing.B) {
+	as := newMockAS(b)
+	kp := newProvider(b, as)
+	token := as.rpt(b, "Service 1 item 1", "read")
+	uri := "https://api.example.com/api/svc1/items/1"
+
+	b.Run("signature", func(b *testing.B) {
+		b.ReportAllocs()
+		ctx := context.Background()
+		for i := 0; i < b.N; i++ {
+			if _, err := kp.VerifySignature(ctx, token); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	for _, c := range []struct {
+		name string
+		opts uma.ManagerOptions
+	}{
+		{"middleware", uma.ManagerOptions{}},
+		{"middleware_token_cache", uma.ManagerOptions{TokenCacheSize: 100}},
+	} {
+		h := newManager(c.opts, kp).Middleware(allow)
+		// registers the resource
+		serve(b, h, http.MethodGet, uri, token, http.StatusOK)
+		b.Run(c.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				serve(b, h, http.MethodGet, uri, token, http.StatusOK)
+			}
+		})
+	}
+}
+
+func BenchmarkTicketIssuance(b *testing.B) {
+	as := newMockAS(b)
+	kp := newProvider(b, as)
+	rscID := resourceID("Service 1 item 1")
+
+	b.Run("provider", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := kp.CreatePermissionTicket(rscID, "read"); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	h := newManager(uma.ManagerOptions{IncludeScopesInPermissionTicket: true}, kp).Middleware(allow)
+	uri := "https://api.example.com/api/svc1/items/1"
+	b.Run("middleware", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			serve(b, h, http.MethodGet, uri, "", http.StatusUnauthorized)
+		}
+	})
+}
@@ -0,0 +1,12 @@
+/*
+Package bench holds benchmarks of the middleware hot paths: resource matching, token verification
+and permission ticket issuance. Provider calls are served by an in-process mock authorization
+server, so the benchmarks need no network access and can run in CI:
+
+	go test -run '^$' -bench . -benchmem -count 10 ./bench > new.txt
+
+Compare the results against a previous run with benchstat to catch regressions:
+
+	benchstat old.txt new.txt
+*/
+package bench
@@ -0,0 +1,121 @@
+package bench
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gopkg.in/square/go-jose.v2"
+)
+
+// mockAS is a minimal UMA authorization server that answers discovery, token, resource
+// registration and permission requests, and signs tokens with its own key. Resource registration
+// always succeeds so that several managers can share one server.
+type mockAS struct {
+	*httptest.Server
+	key     *rsa.PrivateKey
+	signer  jose.Signer
+	counter uint64
+}
+
+func newMockAS(b testing.TB) *mockAS {
+	b.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		b.Fatal(err)
+	}
+	signer, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: jose.RS256, Key: key},
+		(&jose.SignerOptions{}).WithType("JWT").WithHeader("kid", "bench"),
+	)
+	if err != nil {
+		b.Fatal(err)
+	}
+	as := &mockAS{key: key, signer: signer}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/uma2-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{
+			"issuer":                         as.URL,
+			"jwks_uri":                       as.URL + "/certs",
+			"token_endpoint":                 as.URL + "/token",
+			"resource_registration_endpoint": as.URL + "/resource_set",
+			"permission_endpoint":            as.URL + "/permission",
+			"policy_endpoint":                as.URL + "/policy",
+		})
+	})
+	mux.HandleFunc("/certs", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+			{Key: &key.PublicKey, KeyID: "bench", Algorithm: string(jose.RS256), Use: "sig"},
+		}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]any{
+			"access_token": "pat",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+		})
+	})
+	mux.HandleFunc("/resource_set", func(w http.ResponseWriter, r *http.Request) {
+		obj := map[string]any{}
+		if err := json.NewDecoder(r.Body).Decode(&obj); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		name, _ := obj["name"].(string)
+		writeJSON(w, http.StatusCreated, map[string]string{"_id": resourceID(name), "name": name})
+	})
+	mux.HandleFunc("/permission", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusCreated, map[string]string{
+			"ticket": fmt.Sprintf("ticket-%d", atomic.AddUint64(&as.counter, 1)),
+		})
+	})
+	as.Server = httptest.NewServer(mux)
+	b.Cleanup(as.Close)
+	return as
+}
+
+// resourceID returns the id that mockAS assigns to resource with the given name
+func resourceID(name string) string {
+	return "rsc-" + strings.ReplaceAll(name, " ", "-")
+}
+
+// rpt returns a signed token that grants scopes on the resource with the given name
+func (as *mockAS) rpt(b testing.TB, name string, scopes ...string) string {
+	b.Helper()
+	payload, err := json.Marshal(map[string]any{
+		"iss": as.URL,
+		"sub": "bench-user",
+		"exp": time.Now().Add(time.Hour).Unix(),
+		"iat": time.Now().Unix(),
+		"authorization": map[string]any{
+			"permissions": []map[string]any{
+				{"rsid": resourceID(name), "rsname": name, "scopes": scopes},
+			},
+		},
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+	obj, err := as.signer.Sign(payload)
+	if err != nil {
+		b.Fatal(err)
+	}
+	token, err := obj.CompactSerialize()
+	if err != nil {
+		b.Fatal(err)
+	}
+	return token
+}
+
+func writeJSON(w http.ResponseWriter, status int, obj any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(obj)
+}
@@ -0,0 +1,271 @@
+package uma
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pckhoi/uma/pkg/httputil"
+	"gopkg.in/square/go-jose.v2"
+)
+
+// VerificationBundle is a snapshot of everything needed to verify RPTs and enforce scopes without
+// connectivity to the authorization server: the signing keys, the discovery document and the registered
+// resources with their scopes. Export it with ExportVerificationBundle or `uma-codegen bundle`, then load
+// it with LoadVerificationBundle on edge services or air-gapped components.
+//
+// The bundle has to be exported again when keys are rotated or resources are added.
+type VerificationBundle struct {
+	Issuer            string             `json:"issuer"`
+	Discovery         UMADiscovery       `json:"discovery"`
+	JWKS              jose.JSONWebKeySet `json:"jwks"`
+	SigningAlgorithms []string           `json:"signing_algorithms,omitempty"`
+	Resources         []ExpandedResource `json:"resources,omitempty"`
+	ExportedAt        time.Time          `json:"exported_at"`
+}
+
+// ExportVerificationBundle fetches the signing keys and registered resources of p. client is used to fetch
+// the keys, http.DefaultClient is used if it is nil.
+func ExportVerificationBundle(p Provider, client *http.Client) (*VerificationBundle, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	b := &VerificationBundle{
+		Issuer:            p.WWWAuthenticateDirectives().AsUri,
+		Discovery:         p.Discovery(),
+		SigningAlgorithms: DefaultSigningAlgorithms,
+		ExportedAt:        time.Now().UTC(),
+	}
+	if sa, ok := p.(interface{ SigningAlgorithms() []string }); ok {
+		b.SigningAlgorithms = sa.SigningAlgorithms()
+	}
+	jwksURI, err := b.jwksURI(client)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Get(jwksURI)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching jwks: %w", err)
+	}
+	if err := httputil.Ensure2XX(resp); err != nil {
+		return nil, fmt.Errorf("error fetching jwks: %w", err)
+	}
+	if err := httputil.DecodeJSONResponse(resp, &b.JWKS); err != nil {
+		return nil, fmt.Errorf("error decoding jwks: %w", err)
+	}
+	ids, err := p.ListResources(nil)
+	if err != nil {
+		return nil, fmt.Errorf("error listing resources: %w", err)
+	}
+	for _, id := range ids {
+		rsc, err := p.GetResource(id)
+		if err != nil {
+			return nil, fmt.Errorf("error getting resource %q: %w", id, err)
+		}
+		if rsc.ID == "" {
+			rsc.ID = id
+		}
+		b.Resources = append(b.Resources, *rsc)
+	}
+	return b, nil
+}
+
+// jwksURI returns the jwks_uri of the discovery document, falling back to the OpenID configuration of the
+// issuer, since not every authorization server advertises keys in its UMA discovery document
+func (b *VerificationBundle) jwksURI(client *http.Client) (string, error) {
+	if b.Discovery.JwksURI != "" {
+		return b.Discovery.JwksURI, nil
+	}
+	resp, err := client.Get(b.Issuer + "/.well-known/openid-configuration")
+	if err != nil {
+		return "", ErrDiscoveryFailed{Issuer: b.Issuer, Err: err}
+	}
+	if err := httputil.Ensure2XX(resp); err != nil {
+		return "", ErrDiscoveryFailed{Issuer: b.Issuer, Err: err}
+	}
+	doc := &UMADiscovery{}
+	if err := httputil.DecodeJSONResponse(resp, doc); err != nil {
+		return "", ErrDiscoveryFailed{Issuer: b.Issuer, Err: err}
+	}
+	if doc.JwksURI == "" {
+		return "", ErrDiscoveryFailed{Issuer: b.Issuer, Err: errors.New("jwks_uri not found")}
+	}
+	return doc.JwksURI, nil
+}
+
+// LoadVerificationBundle decodes a bundle written as JSON, e.g. by `uma-codegen bundle`
+func LoadVerificationBundle(r io.Reader) (*VerificationBundle, error) {
+	b := &VerificationBundle{}
+	if err := json.NewDecoder(r).Decode(b); err != nil {
+		return nil, fmt.Errorf("error decoding verification bundle: %w", err)
+	}
+	if b.Issuer == "" {
+		return nil, fmt.Errorf("error decoding verification bundle: missing issuer")
+	}
+	if len(b.JWKS.Keys) == 0 {
+		return nil, fmt.Errorf("error decoding verification bundle: no keys")
+	}
+	return b, nil
+}
+
+// VerifySignature verifies jwt with the keys of the bundle. It makes VerificationBundle a KeySet.
+func (b *VerificationBundle) VerifySignature(ctx context.Context, jwt string) ([]byte, error) {
+	algs := b.SigningAlgorithms
+	if len(algs) == 0 {
+		algs = DefaultSigningAlgorithms
+	}
+	if err := checkSigningAlgorithm(jwt, algs); err != nil {
+		return nil, err
+	}
+	jws, err := jose.ParseSigned(jwt)
+	if err != nil {
+		return nil, fmt.Errorf("malformed jwt: %w", err)
+	}
+	if payload, ok := verifyWithKeySet(jws, &b.JWKS); ok {
+		return payload, nil
+	}
+	return nil, errors.New("failed to verify signature: no matching key in verification bundle")
+}
+
+// verifyWithKeySet verifies jws with the key of set that has the key id of the signature, or with any key
+// of set if the signature has no key id
+func verifyWithKeySet(jws *jose.JSONWebSignature, set *jose.JSONWebKeySet) ([]byte, bool) {
+	keys := set.Keys
+	if len(jws.Signatures) > 0 && jws.Signatures[0].Header.KeyID != "" {
+		keys = set.Key(jws.Signatures[0].Header.KeyID)
+	}
+	for _, key := range keys {
+		if payload, err := jws.Verify(key); err == nil {
+			return payload, true
+		}
+	}
+	return nil, false
+}
+
+// ResourceStore returns a read-only store of the resources in the bundle. Since resources can't be
+// registered offline, every resource the Manager protects must be in the bundle. Resources can be found
+// whether or not ManagerOptions.ResourceStoreKeyByIssuer is set.
+func (b *VerificationBundle) ResourceStore() ResourceStore {
+	s := bundleResourceStore{}
+	for _, rsc := range b.Resources {
+		s[rsc.Name] = rsc.ID
+		s[b.Issuer+" "+rsc.Name] = rsc.ID
+	}
+	return s
+}
+
+type bundleResourceStore map[string]string
+
+func (s bundleResourceStore) Get(name string) (string, error) {
+	return s[name], nil
+}
+
+func (s bundleResourceStore) Set(name, id string) error {
+	return ErrOffline{Op: "registering resource " + name}
+}
+
+// OfflineProvider implements Provider with a VerificationBundle. It verifies tokens and looks up resources
+// in the bundle, and returns ErrOffline from every call that needs the authorization server. Denied
+// requests get an UMA challenge without ticket.
+type OfflineProvider struct {
+	bundle    *VerificationBundle
+	resources map[string]ExpandedResource
+}
+
+func NewOfflineProvider(b *VerificationBundle) *OfflineProvider {
+	p := &OfflineProvider{bundle: b, resources: map[string]ExpandedResource{}}
+	for _, rsc := range b.Resources {
+		p.resources[rsc.ID] = rsc
+	}
+	return p
+}
+
+// VerifySignature verifies jwt with the keys of the bundle and checks that it is issued by the bundle
+// issuer
+func (p *OfflineProvider) VerifySignature(ctx context.Context, jwt string) ([]byte, error) {
+	payload, err := p.bundle.VerifySignature(ctx, jwt)
+	if err != nil {
+		return nil, err
+	}
+	claims := struct {
+		Iss string `json:"iss"`
+	}{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("error parsing jwt payload: %w", err)
+	}
+	if claims.Iss != p.bundle.Issuer {
+		return nil, fmt.Errorf("token issued by %q, expected %q", claims.Iss, p.bundle.Issuer)
+	}
+	return payload, nil
+}
+
+func (p *OfflineProvider) Authenticate(client *http.Client) (*httputil.ClientCreds, error) {
+	return nil, ErrOffline{Op: "authenticating client"}
+}
+
+func (p *OfflineProvider) ProtectionAPIToken(ctx context.Context) (string, error) {
+	return "", ErrOffline{Op: "obtaining protection API token"}
+}
+
+func (p *OfflineProvider) ProtectionRequest(ctx context.Context, method, endpointSuffix string, body interface{}) (*http.Response, error) {
+	return nil, ErrOffline{Op: "sending protection API request"}
+}
+
+func (p *OfflineProvider) CreateResource(request *Resource) (*ExpandedResource, error) {
+	return nil, ErrOffline{Op: "registering resource " + request.Name}
+}
+
+func (p *OfflineProvider) GetResource(id string) (*ExpandedResource, error) {
+	rsc, ok := p.resources[id]
+	if !ok {
+		return nil, fmt.Errorf("resource %q not found in verification bundle", id)
+	}
+	return &rsc, nil
+}
+
+func (p *OfflineProvider) UpdateResource(id string, resource *Resource) error {
+	return ErrOffline{Op: "updating resource " + id}
+}
+
+func (p *OfflineProvider) DeleteResource(id string) error {
+	return ErrOffline{Op: "deleting resource " + id}
+}
+
+// ListResources lists resources of the bundle. Like Keycloak, it filters resources by the name query
+// parameter, which matches exactly if exactName is true.
+func (p *OfflineProvider) ListResources(urlQuery url.Values) ([]string, error) {
+	name := urlQuery.Get("name")
+	exact := urlQuery.Get("exactName") == "true"
+	ids := []string{}
+	for _, rsc := range p.bundle.Resources {
+		if name != "" && !(exact && rsc.Name == name || !exact && strings.Contains(rsc.Name, name)) {
+			continue
+		}
+		ids = append(ids, rsc.ID)
+	}
+	return ids, nil
+}
+
+func (p *OfflineProvider) CreatePermissionTicket(resourceID string, scopes ...string) (string, error) {
+	return "", ErrOffline{Op: "requesting permission ticket for resource " + resourceID}
+}
+
+// WWWAuthenticateDirectives uses the last path segment of the issuer as realm
+func (p *OfflineProvider) WWWAuthenticateDirectives() WWWAuthenticateDirectives {
+	path := strings.Split(p.bundle.Issuer, "/")
+	return WWWAuthenticateDirectives{
+		Realm: path[len(path)-1],
+		AsUri: p.bundle.Issuer,
+	}
+}
+
+// Discovery returns the discovery document of the bundle
+func (p *OfflineProvider) Discovery() UMADiscovery {
+	return p.bundle.Discovery
+}
@@ -0,0 +1,156 @@
+package uma_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/go-logr/logr/testr"
+	"github.com/pckhoi/uma"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/square/go-jose.v2"
+)
+
+func signJWT(t *testing.T, key *rsa.PrivateKey, kid string, claims map[string]interface{}) string {
+	t.Helper()
+	signer, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: jose.RS256, Key: jose.JSONWebKey{Key: key, KeyID: kid}},
+		(&jose.SignerOptions{}).WithType("JWT"),
+	)
+	require.NoError(t, err)
+	b, err := json.Marshal(claims)
+	require.NoError(t, err)
+	jws, err := signer.Sign(b)
+	require.NoError(t, err)
+	s, err := jws.CompactSerialize()
+	require.NoError(t, err)
+	return s
+}
+
+func newBundleServer(t *testing.T, key *rsa.PrivateKey) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	s := httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	writeJSON := func(w http.ResponseWriter, obj any) {
+		w.Header().Set("Content-Type", "application/json")
+		require.NoError(t, json.NewEncoder(w).Encode(obj))
+	}
+	mux.HandleFunc("/realms/test/.well-known/uma2-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, uma.UMADiscovery{
+			Issuer:                       s.URL + "/realms/test",
+			TokenEndpoint:                s.URL + "/realms/test/token",
+			JwksURI:                      s.URL + "/realms/test/certs",
+			ResourceRegistrationEndpoint: s.URL + "/realms/test/resource_set",
+		})
+	})
+	mux.HandleFunc("/realms/test/token", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]interface{}{"access_token": "pat", "token_type": "Bearer", "expires_in": 300})
+	})
+	mux.HandleFunc("/realms/test/certs", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+			{Key: &key.PublicKey, KeyID: "key-1", Algorithm: "RS256", Use: "sig"},
+		}})
+	})
+	mux.HandleFunc("/realms/test/resource_set", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, []string{"rsc-1"})
+	})
+	mux.HandleFunc("/realms/test/resource_set/rsc-1", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, uma.ExpandedResource{
+			ID:             "rsc-1",
+			Name:           "User 1",
+			Type:           "user",
+			ResourceScopes: []uma.Scope{{Name: "read"}, {Name: "write"}},
+			URIs:           []string{"https://api.example.com/users/1"},
+		})
+	})
+	return s
+}
+
+func TestVerificationBundle(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	s := newBundleServer(t, key)
+	issuer := s.URL + "/realms/test"
+	live, err := uma.NewBaseProvider(issuer, "api", "secret", nil, nil, logr.Discard())
+	require.NoError(t, err)
+
+	exported, err := uma.ExportVerificationBundle(live, nil)
+	require.NoError(t, err)
+	b, err := json.Marshal(exported)
+	require.NoError(t, err)
+
+	// the authorization server is no longer reachable
+	s.Close()
+	bundle, err := uma.LoadVerificationBundle(bytes.NewReader(b))
+	require.NoError(t, err)
+	assert.Equal(t, issuer, bundle.Issuer)
+	assert.Equal(t, []string{uma.RS256}, bundle.SigningAlgorithms)
+	require.Len(t, bundle.Resources, 1)
+	assert.Equal(t, "User 1", bundle.Resources[0].Name)
+
+	p := uma.NewOfflineProvider(bundle)
+	ids, err := p.ListResources(url.Values{"name": {"User 1"}, "exactName": {"true"}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"rsc-1"}, ids)
+	_, err = p.CreatePermissionTicket("rsc-1")
+	assert.ErrorAs(t, err, &uma.ErrOffline{})
+
+	h := uma.New(
+		uma.ManagerOptions{
+			GetBaseURL: func(r *http.Request) url.URL {
+				return url.URL{Scheme: "https", Host: "api.example.com", Path: "/users"}
+			},
+			GetProvider: func(r *http.Request) uma.Provider {
+				return p
+			},
+			GetResourceStore: func(r *http.Request) uma.ResourceStore {
+				return bundle.ResourceStore()
+			},
+			DisableTokenExpirationCheck: true,
+		},
+		map[string]uma.ResourceType{
+			"user": {Type: "user", ResourceScopes: []string{"read", "write"}},
+		},
+		[]string{"oidc"},
+		nil,
+		[]map[string][]string{{"oidc": {"read"}}},
+		[]uma.Path{
+			uma.NewPath("/{id}", uma.NewResourceTemplate("user", "User {id}"), map[string]uma.Operation{
+				http.MethodGet: {},
+			}),
+		},
+		testr.New(t),
+	).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	claims := func(iss string) map[string]interface{} {
+		return map[string]interface{}{
+			"iss": iss,
+			"sub": "user-1",
+			"authorization": map[string]interface{}{
+				"permissions": []map[string]interface{}{{"rsid": "rsc-1", "scopes": []string{"read"}}},
+			},
+		}
+	}
+	assert.Equal(t, http.StatusOK, serve(h, http.MethodGet, "https://api.example.com/users/1", signJWT(t, key, "key-1", claims(issuer))).Code)
+
+	rec := serve(h, http.MethodGet, "https://api.example.com/users/1", "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, `UMA realm="test", as_uri="`+issuer+`"`, rec.Header().Get("WWW-Authenticate"))
+
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, serve(h, http.MethodGet, "https://api.example.com/users/1", signJWT(t, other, "key-1", claims(issuer))).Code)
+	assert.Equal(t, http.StatusUnauthorized, serve(h, http.MethodGet, "https://api.example.com/users/1", signJWT(t, key, "key-1", claims("https://evil.example.com"))).Code)
+
+	// resources missing from the bundle can't be registered
+	assert.Equal(t, http.StatusServiceUnavailable, serve(h, http.MethodGet, "https://api.example.com/users/2", "").Code)
+	assert.Equal(t, http.StatusServiceUnavailable, serve(h, http.MethodGet, "https://api.example.com/users/2", signJWT(t, key, "key-1", claims(issuer))).Code)
+}
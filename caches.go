@@ -0,0 +1,52 @@
+package uma
+
+// CacheStats are the counters of an in-memory cache since it was created
+type CacheStats struct {
+	// Entries is the number of cached entries, including expired entries that were not removed yet
+	Entries int
+
+	Hits uint64
+
+	// Misses include lookups of expired entries
+	Misses uint64
+
+	// Evictions counts entries removed to keep the cache within its size
+	Evictions uint64
+
+	// Purged counts entries removed by Purge
+	Purged uint64
+}
+
+// CacheControl lets operators watch a cache and invalidate it, e.g. after a security incident
+type CacheControl interface {
+	Stats() CacheStats
+
+	// Purge removes entries whose key starts with prefix, or all entries if prefix is empty, and returns
+	// how many entries were removed
+	Purge(prefix string) int
+}
+
+// Names of the caches returned by Manager.Caches
+const (
+	// CacheTokens memoizes token verification results. Keys start with the issuer followed by a space.
+	CacheTokens = "tokens"
+
+	// CacheResources is ManagerOptions.ResourceCache. Keys are described in ResourceCache.
+	CacheResources = "resources"
+)
+
+// Caches returns the in-memory caches of the manager by name: CacheTokens if ManagerOptions.TokenCacheSize
+// is set, and CacheResources if ManagerOptions.ResourceCache implements CacheControl, like
+// MemoryResourceCache does. For example, to forget all verified tokens of an issuer:
+//
+//	m.Caches()[uma.CacheTokens].Purge(issuer + " ")
+func (m *Manager) Caches() map[string]CacheControl {
+	caches := map[string]CacheControl{}
+	if m.tokenCache != nil {
+		caches[CacheTokens] = m.tokenCache.lru
+	}
+	if c, ok := m.resourceCache.(CacheControl); ok {
+		caches[CacheResources] = c
+	}
+	return caches
+}
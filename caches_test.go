@@ -0,0 +1,56 @@
+package uma_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/pckhoi/uma"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestManagerCaches(t *testing.T) {
+	p := newMockProvider(map[string]string{
+		"token-1": rptPayload("user-1", "User 1", "read"),
+	})
+	assert.Empty(t, newMockManager(t, p, uma.ManagerOptions{}).Caches())
+
+	rc := uma.NewMemoryResourceCache(10)
+	man := newMockManager(t, p, uma.ManagerOptions{TokenCacheSize: 10, ResourceCache: rc})
+	h := man.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusOK, serve(h, http.MethodGet, "https://api.example.com/users/1", "token-1").Code)
+	}
+	caches := man.Caches()
+	require.Len(t, caches, 2)
+	assert.Equal(t, uma.CacheStats{Entries: 1, Hits: 2, Misses: 1}, caches[uma.CacheTokens].Stats())
+	assert.Equal(t, uma.CacheStats{Entries: 1, Hits: 2, Misses: 1}, caches[uma.CacheResources].Stats())
+
+	issuer := p.WWWAuthenticateDirectives().AsUri
+	assert.Equal(t, 0, caches[uma.CacheTokens].Purge("https://other.example.com "))
+	assert.Equal(t, 1, caches[uma.CacheTokens].Purge(issuer+" "))
+	assert.Equal(t, 1, caches[uma.CacheResources].Purge(""))
+	assert.Equal(t, uma.CacheStats{Hits: 2, Misses: 1, Purged: 1}, caches[uma.CacheTokens].Stats())
+
+	// purged tokens are verified again
+	assert.Equal(t, http.StatusOK, serve(h, http.MethodGet, "https://api.example.com/users/1", "token-1").Code)
+	assert.Equal(t, 2, p.verified)
+}
+
+func TestMemoryResourceCache(t *testing.T) {
+	c := uma.NewMemoryResourceCache(2)
+	require.NoError(t, c.Set("a", "1", time.Hour))
+	require.NoError(t, c.Set("b", "", time.Hour))
+	id, ok, err := c.Get("b")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Empty(t, id)
+	require.NoError(t, c.Set("c", "3", time.Hour))
+	_, ok, _ = c.Get("a")
+	assert.False(t, ok)
+	require.NoError(t, c.Delete("c"))
+	_, ok, _ = c.Get("c")
+	assert.False(t, ok)
+	assert.Equal(t, uma.CacheStats{Entries: 1, Hits: 1, Misses: 2, Evictions: 1}, c.Stats())
+}
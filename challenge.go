@@ -0,0 +1,56 @@
+package uma
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Error codes of UMA challenges, as defined by RFC 6750
+const (
+	challengeInvalidToken      = "invalid_token"
+	challengeInsufficientScope = "insufficient_scope"
+)
+
+// challengeError tells the client why a request is denied. It is added to UMA challenges if
+// ManagerOptions.ChallengeErrors is true. The zero value adds nothing, which is the case for requests
+// without token.
+type challengeError struct {
+	code        string
+	description string
+}
+
+// newChallengeError returns the challenge error of a denied request
+func newChallengeError(d Denial) challengeError {
+	err := d.Err
+	var rptErr ErrInvalidRPT
+	switch {
+	case d.Reason == DenialNoToken:
+		return challengeError{}
+	case err == nil:
+		return challengeError{challengeInsufficientScope, "The access token lacks scopes required by the operation"}
+	case errors.As(err, &rptErr):
+		switch rptErr.Reason {
+		case RPTExpired:
+			return challengeError{challengeInvalidToken, "The access token expired"}
+		case RPTMissingScope:
+			return challengeError{challengeInsufficientScope, "The access token lacks scope " + rptErr.Scope}
+		}
+		return challengeError{challengeInsufficientScope, "The access token has no permission for the resource"}
+	case errors.Is(err, ErrLoggedOut):
+		return challengeError{challengeInvalidToken, "The access token was revoked by logout"}
+	case errors.Is(err, errTokenNotBound):
+		return challengeError{challengeInvalidToken, "The access token is not bound to this client"}
+	}
+	return challengeError{challengeInvalidToken, "The access token is invalid"}
+}
+
+// params returns the error parameters of the WWW-Authenticate header, starting with a comma
+func (e challengeError) params() string {
+	if e.code == "" {
+		return ""
+	}
+	// error_description may not contain double quotes and backslashes
+	desc := strings.NewReplacer(`"`, "'", `\`, "/").Replace(e.description)
+	return fmt.Sprintf(`, error=%q, error_description=%q`, e.code, desc)
+}
@@ -0,0 +1,47 @@
+package uma_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/pckhoi/uma"
+	"github.com/pckhoi/uma/pkg/clock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChallengeErrors(t *testing.T) {
+	c := clock.NewFake(time.Now())
+	p := newMockProvider(map[string]string{
+		"token-1": fmt.Sprintf(
+			`{"sub":"user-1","iat":%d,"exp":%d,"authorization":{"permissions":[{"rsid":"rsc-User 1","scopes":["read"]}]}}`,
+			c.Now().Add(-time.Minute).Unix(), c.Now().Add(time.Minute).Unix(),
+		),
+		"token-2": fmt.Sprintf(`{"sub":"user-1","iat":%d,"exp":%d}`,
+			c.Now().Add(-time.Minute).Unix(), c.Now().Add(time.Minute).Unix(),
+		),
+	})
+	h := newMockManager(t, p, uma.ManagerOptions{ChallengeErrors: true, Clock: c}).
+		Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	challenge := func(method, token string) string {
+		rec := serve(h, method, "https://api.example.com/users/1", token)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		return rec.Header().Get("WWW-Authenticate")
+	}
+
+	assert.Equal(t, `UMA realm="test", as_uri="https://as.example.com", ticket="ticket-1"`, challenge(http.MethodGet, ""))
+	assert.Equal(t,
+		`UMA realm="test", as_uri="https://as.example.com", ticket="ticket-2", error="invalid_token", error_description="The access token is invalid"`,
+		challenge(http.MethodGet, "forged"),
+	)
+	assert.Contains(t, challenge(http.MethodPut, "token-1"), `error="insufficient_scope", error_description="The access token lacks scope write"`)
+	assert.Contains(t, challenge(http.MethodGet, "token-2"), `error="insufficient_scope", error_description="The access token has no permission for the resource"`)
+
+	c.Advance(2 * time.Minute)
+	assert.Contains(t, challenge(http.MethodGet, "token-1"), `error="invalid_token", error_description="The access token expired"`)
+
+	// errors are not added unless enabled
+	h = newMockManager(t, p, uma.ManagerOptions{}).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	assert.NotContains(t, serve(h, http.MethodGet, "https://api.example.com/users/1", "forged").Header().Get("WWW-Authenticate"), "error")
+}
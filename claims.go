@@ -2,6 +2,7 @@ package uma
 
 import (
 	"context"
+	"encoding/json"
 	"net/http"
 	"time"
 
@@ -14,6 +15,27 @@ type Permission struct {
 	Scopes []string `json:"scopes,omitempty"`
 }
 
+// UnmarshalJSON also accepts the resource_id and resource_scopes members of token introspection
+// responses, which some authorization servers, e.g. ForgeRock AM, use in RPTs as well
+func (p *Permission) UnmarshalJSON(b []byte) error {
+	type permission Permission
+	obj := struct {
+		*permission
+		ResourceID     string   `json:"resource_id"`
+		ResourceScopes []string `json:"resource_scopes"`
+	}{permission: (*permission)(p)}
+	if err := json.Unmarshal(b, &obj); err != nil {
+		return err
+	}
+	if p.Rsid == "" {
+		p.Rsid = obj.ResourceID
+	}
+	if p.Scopes == nil {
+		p.Scopes = obj.ResourceScopes
+	}
+	return nil
+}
+
 type Authorization struct {
 	Permissions []Permission `json:"permissions,omitempty"`
 }
@@ -45,36 +67,99 @@ func stringSet(sl []string) map[string]struct{} {
 	return m
 }
 
-func scopesAreSufficient(existingScopes, requiredScopes []string, logger logr.Logger) bool {
+// missingScope returns the first required scope that does not exist
+func missingScope(existingScopes, requiredScopes []string) string {
 	m := stringSet(existingScopes)
 	for _, s := range requiredScopes {
 		if _, ok := m[s]; !ok {
-			logger.Info("missing scope", "scope", s)
-			return false
+			return s
 		}
 	}
+	return ""
+}
+
+func scopesAreSufficient(existingScopes, requiredScopes []string, logger logr.Logger) bool {
+	if s := missingScope(existingScopes, requiredScopes); s != "" {
+		logger.Info("missing scope", "scope", s)
+		return false
+	}
 	return true
 }
 
-func (tok *Claims) IsValid(resourceID string, disableTokenExpirationCheck bool, scopes []string, logger logr.Logger) bool {
+// Validate returns ErrInvalidRPT if the token is expired or does not grant the given scopes on the
+// resource. Otherwise it returns nil.
+func (tok *Claims) Validate(resourceID string, disableTokenExpirationCheck bool, scopes []string) error {
+	return tok.validate(time.Now(), disableTokenExpirationCheck, resourceID, scopes)
+}
+
+// ValidateAt is like Validate but checks expiration against the given time instead of the current time
+func (tok *Claims) ValidateAt(now time.Time, resourceID string, scopes []string) error {
+	return tok.validate(now, false, resourceID, scopes)
+}
+
+// validateExpiry returns ErrInvalidRPT if the token is not valid at now
+func (tok *Claims) validateExpiry(now time.Time, resourceID string) error {
+	if !now.After(time.Unix(int64(tok.Iat), 0)) || !now.Before(time.Unix(int64(tok.Exp), 0)) ||
+		(tok.Nbf != 0 && now.Before(time.Unix(int64(tok.Nbf), 0))) {
+		return ErrInvalidRPT{Reason: RPTExpired, ResourceID: resourceID}
+	}
+	return nil
+}
+
+func (tok *Claims) validate(now time.Time, disableTokenExpirationCheck bool, resourceID string, scopes []string) error {
 	if !disableTokenExpirationCheck {
-		iat := time.Unix(int64(tok.Iat), 0)
-		exp := time.Unix(int64(tok.Exp), 0)
-		now := time.Now()
-		if !now.After(iat) || !now.Before(exp) {
-			logger.Info("token expired", "iat", iat, "exp", exp, "now", now)
-			return false
+		if err := tok.validateExpiry(now, resourceID); err != nil {
+			return err
 		}
 	}
 	if tok.Authorization != nil {
 		for _, p := range tok.Authorization.Permissions {
 			if p.Rsid == resourceID {
-				return scopesAreSufficient(p.Scopes, scopes, logger)
+				if s := missingScope(p.Scopes, scopes); s != "" {
+					return ErrInvalidRPT{Reason: RPTMissingScope, ResourceID: resourceID, Scope: s}
+				}
+				return nil
 			}
 		}
 	}
-	logger.Info("resource not found in claims", "resource_id", resourceID, "claims", tok)
-	return false
+	return ErrInvalidRPT{Reason: RPTNoPermission, ResourceID: resourceID}
+}
+
+func (tok *Claims) IsValid(resourceID string, disableTokenExpirationCheck bool, scopes []string, logger logr.Logger) bool {
+	return tok.isValid(time.Now(), resourceID, disableTokenExpirationCheck, scopes, logger)
+}
+
+func (tok *Claims) isValid(now time.Time, resourceID string, disableTokenExpirationCheck bool, scopes []string, logger logr.Logger) bool {
+	return tok.check(now, resourceID, disableTokenExpirationCheck, scopes, logger) == nil
+}
+
+// check is like validate but also logs why the token is invalid
+func (tok *Claims) check(now time.Time, resourceID string, disableTokenExpirationCheck bool, scopes []string, logger logr.Logger) error {
+	return tok.logInvalid(now, resourceID, tok.validate(now, disableTokenExpirationCheck, resourceID, scopes), logger)
+}
+
+// logInvalid logs why the token is invalid if err is ErrInvalidRPT, and returns err
+func (tok *Claims) logInvalid(now time.Time, resourceID string, err error, logger logr.Logger) error {
+	if err == nil {
+		return nil
+	}
+	e, ok := err.(ErrInvalidRPT)
+	if !ok {
+		return err
+	}
+	switch e.Reason {
+	case RPTExpired:
+		logger.Info("token expired",
+			"iat", time.Unix(int64(tok.Iat), 0),
+			"exp", time.Unix(int64(tok.Exp), 0),
+			"now", now,
+		)
+	case RPTMissingScope:
+		logger.Info("missing scope", "scope", e.Scope)
+	default:
+		logger.Info("resource not found in claims", "resource_id", resourceID, "claims", tok)
+	}
+	return err
 }
 
 type claimsKey struct{}
@@ -91,6 +176,15 @@ func GetClaims(r *http.Request) *Claims {
 	return nil
 }
 
+// OwnerFromClaims returns the subject of the requesting party token. It can be used as
+// ManagerOptions.OwnerFromRequest.
+func OwnerFromClaims(r *http.Request) string {
+	if c := GetClaims(r); c != nil {
+		return c.Sub
+	}
+	return ""
+}
+
 // GetClaimsScopes check whether current RPT claims has specified scopes
 // for the current resource
 func GetClaimsScopes(r *http.Request) (scopes map[string]struct{}) {
@@ -0,0 +1,66 @@
+package uma
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/pckhoi/uma/pkg/httputil"
+)
+
+// ClientMetadata describes a client to register dynamically. Learn more at
+// https://www.rfc-editor.org/rfc/rfc7591#section-2
+type ClientMetadata struct {
+	ClientName              string   `json:"client_name,omitempty"`
+	RedirectURIs            []string `json:"redirect_uris,omitempty"`
+	GrantTypes              []string `json:"grant_types,omitempty"`
+	ResponseTypes           []string `json:"response_types,omitempty"`
+	Scope                   string   `json:"scope,omitempty"`
+	TokenEndpointAuthMethod string   `json:"token_endpoint_auth_method,omitempty"`
+
+	// SoftwareStatement is a signed JWT, e.g. a software statement assertion (SSA) issued by the
+	// authorization server, that vouches for the metadata of the client
+	SoftwareStatement string `json:"software_statement,omitempty"`
+}
+
+// ClientRegistration is the response to a dynamic client registration. Learn more at
+// https://www.rfc-editor.org/rfc/rfc7591#section-3.2.1
+type ClientRegistration struct {
+	ClientID                string `json:"client_id"`
+	ClientSecret            string `json:"client_secret,omitempty"`
+	ClientIDIssuedAt        int64  `json:"client_id_issued_at,omitempty"`
+	ClientSecretExpiresAt   int64  `json:"client_secret_expires_at,omitempty"`
+	RegistrationAccessToken string `json:"registration_access_token,omitempty"`
+	RegistrationClientURI   string `json:"registration_client_uri,omitempty"`
+}
+
+// registerClient registers a client at endpoint. The request is authenticated by the software statement
+// of metadata, if any, rather than by a PAT, which the client doesn't have yet.
+func registerClient(ctx context.Context, client *httputil.Client, endpoint string, metadata ClientMetadata) (*ClientRegistration, error) {
+	if endpoint == "" {
+		return nil, errors.New("registration_endpoint not found in discovery document")
+	}
+	req, err := httputil.JSONRequest(http.MethodPost, endpoint, metadata)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if client.UserAgent != "" {
+		req.Header.Set("User-Agent", client.UserAgent)
+	}
+	for _, edit := range client.RequestEditors {
+		edit(req)
+	}
+	resp, err := httputil.Do(ctx, client.Client, req.WithContext(ctx), client.Retry)
+	if err != nil {
+		return nil, err
+	}
+	reg := &ClientRegistration{}
+	if err := client.DecodeJSONResponse(resp, reg); err != nil {
+		return nil, err
+	}
+	if reg.ClientID == "" {
+		return nil, errors.New("client registration response has no client_id")
+	}
+	return reg, nil
+}
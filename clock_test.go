@@ -0,0 +1,48 @@
+package uma_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/pckhoi/uma"
+	"github.com/pckhoi/uma/pkg/clock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClock(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := clock.NewFake(start)
+	p := newMockProvider(map[string]string{
+		"token-1": fmt.Sprintf(
+			`{"sub":"user-1","iat":%d,"exp":%d,"authorization":{"permissions":[{"rsid":"rsc-User 1","scopes":["read"]}]}}`,
+			start.Unix(), start.Add(time.Hour).Unix(),
+		),
+	})
+	man := newMockManager(t, p, uma.ManagerOptions{
+		Clock:          c,
+		TokenCacheSize: 10,
+		TokenCacheTTL:  10 * time.Minute,
+	})
+	h := man.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	get := func() int {
+		return serve(h, http.MethodGet, "https://api.example.com/users/1", "token-1").Code
+	}
+
+	// not valid at the instant it is issued
+	assert.Equal(t, http.StatusUnauthorized, get())
+	assert.Equal(t, 1, p.verified)
+
+	c.Advance(time.Second)
+	assert.Equal(t, http.StatusOK, get())
+	assert.Equal(t, 1, p.verified)
+
+	// token cache entries expire according to the clock
+	c.Advance(10 * time.Minute)
+	assert.Equal(t, http.StatusOK, get())
+	assert.Equal(t, 2, p.verified)
+
+	c.Set(start.Add(time.Hour))
+	assert.Equal(t, http.StatusUnauthorized, get())
+}
@@ -0,0 +1,288 @@
+package uma
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/pckhoi/uma/pkg/httputil"
+)
+
+// CompositeOptions configures NewCompositeProvider
+type CompositeOptions struct {
+	// FailureThreshold is the number of consecutive failed requests or health checks of the primary after
+	// which the composite fails over to the standby. Requests fail if httputil.IsRetryable says so, e.g.
+	// with network errors or 5xx statuses. Defaults to 3.
+	FailureThreshold int
+
+	// RecoveryThreshold is the number of consecutive successful health checks of the primary after which
+	// the composite fails back to it. Defaults to 3.
+	RecoveryThreshold int
+
+	// HealthCheckInterval is how often the primary is checked. Defaults to 10 seconds. If negative, the
+	// primary is only checked when CheckHealth is called.
+	HealthCheckInterval time.Duration
+
+	// HealthCheck returns nil if p is healthy. Defaults to requesting the UMA discovery document of p with
+	// ProtectionRequest, which also obtains a PAT if p has none.
+	HealthCheck func(ctx context.Context, p Provider) error
+
+	// DualVerification if true, verifies tokens that the active provider rejects with the other provider,
+	// so that tokens issued by either authorization server are accepted across failover and failback.
+	// Leave it false if both servers share their signing keys.
+	DualVerification bool
+}
+
+// CompositeProvider sends every call to a primary provider and fails over to a standby one, e.g. the
+// authorization server of another region, when the primary fails. It fails back once the primary is
+// healthy again. The call that makes the composite fail over is sent to the standby as well, unless it
+// refers to a resource by id, in which case it fails and the Manager registers the resource with the
+// standby on the next request.
+//
+// Resource ids usually differ between authorization servers. Set ManagerOptions.ResourceStoreKeyByIssuer
+// so that ids registered with each server are kept apart, since the issuer of the composite is that of
+// the active provider.
+type CompositeProvider struct {
+	primary    Provider
+	standby    Provider
+	opts       CompositeOptions
+	logger     logr.Logger
+	stop       chan struct{}
+	closeOnce  sync.Once
+	mu         sync.Mutex
+	onStandby  bool
+	failures   int
+	recoveries int
+}
+
+// NewCompositeProvider returns a provider that fails over from primary to standby. Health checks run in
+// the background until Close is called.
+func NewCompositeProvider(primary, standby Provider, opts CompositeOptions, logger logr.Logger) *CompositeProvider {
+	if opts.FailureThreshold <= 0 {
+		opts.FailureThreshold = 3
+	}
+	if opts.RecoveryThreshold <= 0 {
+		opts.RecoveryThreshold = 3
+	}
+	if opts.HealthCheckInterval == 0 {
+		opts.HealthCheckInterval = 10 * time.Second
+	}
+	if opts.HealthCheck == nil {
+		opts.HealthCheck = checkDiscovery
+	}
+	c := &CompositeProvider{
+		primary: primary,
+		standby: standby,
+		opts:    opts,
+		logger:  logger,
+	}
+	if opts.HealthCheckInterval > 0 {
+		c.stop = make(chan struct{})
+		go c.checkHealthEvery(opts.HealthCheckInterval, c.stop)
+	}
+	return c
+}
+
+// checkDiscovery is the default CompositeOptions.HealthCheck
+func checkDiscovery(ctx context.Context, p Provider) error {
+	resp, err := p.ProtectionRequest(ctx, http.MethodGet, "/.well-known/uma2-configuration", nil)
+	if err != nil {
+		return err
+	}
+	return httputil.Ensure2XX(resp)
+}
+
+// Close stops health checks. It is safe to call Close more than once.
+func (c *CompositeProvider) Close() error {
+	c.closeOnce.Do(func() {
+		if c.stop != nil {
+			close(c.stop)
+		}
+	})
+	return nil
+}
+
+func (c *CompositeProvider) checkHealthEvery(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			c.CheckHealth(context.Background())
+		}
+	}
+}
+
+// CheckHealth checks the primary once, failing over or back if a threshold is reached
+func (c *CompositeProvider) CheckHealth(ctx context.Context) {
+	err := c.opts.HealthCheck(ctx, c.primary)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.onStandby {
+		c.recordLocked(err != nil, err)
+		return
+	}
+	if err != nil {
+		c.recoveries = 0
+		return
+	}
+	c.recoveries++
+	if c.recoveries >= c.opts.RecoveryThreshold {
+		c.onStandby, c.failures, c.recoveries = false, 0, 0
+		c.logger.Info("failing back to primary authorization server")
+	}
+}
+
+// recordLocked records a success or failure of the primary, failing over if there are too many failures
+// in a row
+func (c *CompositeProvider) recordLocked(failed bool, err error) {
+	if !failed {
+		c.failures = 0
+		return
+	}
+	c.failures++
+	if c.failures >= c.opts.FailureThreshold {
+		c.onStandby, c.failures, c.recoveries = true, 0, 0
+		c.logger.Error(err, "failing over to standby authorization server")
+	}
+}
+
+// Active returns the provider that calls are sent to
+func (c *CompositeProvider) Active() Provider {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.onStandby {
+		return c.standby
+	}
+	return c.primary
+}
+
+// OnStandby reports whether the composite has failed over to the standby
+func (c *CompositeProvider) OnStandby() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.onStandby
+}
+
+// report records the outcome of a call to p, and reports whether the call should be sent again because
+// the composite has failed over since
+func (c *CompositeProvider) report(p Provider, err error) bool {
+	if p != c.primary {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.onStandby {
+		return httputil.IsRetryable(err)
+	}
+	c.recordLocked(httputil.IsRetryable(err), err)
+	return c.onStandby
+}
+
+// compositeCall sends call to the active provider of c. If resend is true, the call is sent to the
+// standby as well when the composite fails over because of it. Calls that refer to resources by id are
+// not sent again, since ids of one authorization server are unknown to the other.
+func compositeCall[T any](c *CompositeProvider, resend bool, call func(p Provider) (T, error)) (T, error) {
+	p := c.Active()
+	v, err := call(p)
+	if c.report(p, err) && resend {
+		return call(c.standby)
+	}
+	return v, err
+}
+
+func (c *CompositeProvider) VerifySignature(ctx context.Context, jwt string) ([]byte, error) {
+	p := c.Active()
+	payload, err := p.VerifySignature(ctx, jwt)
+	if err == nil || !c.opts.DualVerification {
+		return payload, err
+	}
+	other := c.standby
+	if p == c.standby {
+		other = c.primary
+	}
+	if payload, otherErr := other.VerifySignature(ctx, jwt); otherErr == nil {
+		return payload, nil
+	}
+	return nil, err
+}
+
+func (c *CompositeProvider) Authenticate(client *http.Client) (*httputil.ClientCreds, error) {
+	return compositeCall(c, true, func(p Provider) (*httputil.ClientCreds, error) {
+		return p.Authenticate(client)
+	})
+}
+
+func (c *CompositeProvider) ProtectionAPIToken(ctx context.Context) (string, error) {
+	return compositeCall(c, true, func(p Provider) (string, error) {
+		return p.ProtectionAPIToken(ctx)
+	})
+}
+
+func (c *CompositeProvider) ProtectionRequest(ctx context.Context, method, endpointSuffix string, body interface{}) (*http.Response, error) {
+	return compositeCall(c, false, func(p Provider) (*http.Response, error) {
+		return p.ProtectionRequest(ctx, method, endpointSuffix, body)
+	})
+}
+
+func (c *CompositeProvider) CreateResource(request *Resource) (*ExpandedResource, error) {
+	return compositeCall(c, false, func(p Provider) (*ExpandedResource, error) {
+		return p.CreateResource(request)
+	})
+}
+
+func (c *CompositeProvider) GetResource(id string) (*ExpandedResource, error) {
+	return compositeCall(c, false, func(p Provider) (*ExpandedResource, error) {
+		return p.GetResource(id)
+	})
+}
+
+func (c *CompositeProvider) UpdateResource(id string, resource *Resource) error {
+	_, err := compositeCall(c, false, func(p Provider) (struct{}, error) {
+		return struct{}{}, p.UpdateResource(id, resource)
+	})
+	return err
+}
+
+func (c *CompositeProvider) DeleteResource(id string) error {
+	_, err := compositeCall(c, false, func(p Provider) (struct{}, error) {
+		return struct{}{}, p.DeleteResource(id)
+	})
+	return err
+}
+
+func (c *CompositeProvider) ListResources(urlQuery url.Values) ([]string, error) {
+	return compositeCall(c, true, func(p Provider) ([]string, error) {
+		return p.ListResources(urlQuery)
+	})
+}
+
+func (c *CompositeProvider) CreatePermissionTicket(resourceID string, scopes ...string) (string, error) {
+	return compositeCall(c, false, func(p Provider) (string, error) {
+		return p.CreatePermissionTicket(resourceID, scopes...)
+	})
+}
+
+// CreatePermissionTicketWithClaims pushes claims if the active provider is a ClaimPushingProvider, and
+// drops them otherwise
+func (c *CompositeProvider) CreatePermissionTicketWithClaims(resourceID string, claims map[string][]string, scopes ...string) (string, error) {
+	return compositeCall(c, false, func(p Provider) (string, error) {
+		if cp, ok := p.(ClaimPushingProvider); ok {
+			return cp.CreatePermissionTicketWithClaims(resourceID, claims, scopes...)
+		}
+		return p.CreatePermissionTicket(resourceID, scopes...)
+	})
+}
+
+func (c *CompositeProvider) WWWAuthenticateDirectives() WWWAuthenticateDirectives {
+	return c.Active().WWWAuthenticateDirectives()
+}
+
+func (c *CompositeProvider) Discovery() UMADiscovery {
+	return c.Active().Discovery()
+}
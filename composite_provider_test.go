@@ -0,0 +1,168 @@
+package uma_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/pckhoi/uma"
+	"github.com/pckhoi/uma/pkg/httputil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// regionProvider is a mockProvider of its own issuer that fails with err while it is set
+type regionProvider struct {
+	uma.Provider
+	issuer string
+	mu     sync.Mutex
+	err    error
+}
+
+func newRegionProvider(issuer string, tokens map[string]string) *regionProvider {
+	return &regionProvider{Provider: newMockProvider(tokens), issuer: issuer}
+}
+
+func (p *regionProvider) setErr(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.err = err
+}
+
+func (p *regionProvider) getErr() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
+
+func (p *regionProvider) ProtectionAPIToken(ctx context.Context) (string, error) {
+	if err := p.getErr(); err != nil {
+		return "", err
+	}
+	return "pat of " + p.issuer, nil
+}
+
+func (p *regionProvider) GetResource(id string) (*uma.ExpandedResource, error) {
+	if err := p.getErr(); err != nil {
+		return nil, err
+	}
+	return &uma.ExpandedResource{ID: id, Name: p.issuer}, nil
+}
+
+func (p *regionProvider) WWWAuthenticateDirectives() uma.WWWAuthenticateDirectives {
+	return uma.WWWAuthenticateDirectives{Realm: "test", AsUri: p.issuer}
+}
+
+func TestCompositeProviderFailover(t *testing.T) {
+	primary := newRegionProvider("https://eu.example.com", nil)
+	standby := newRegionProvider("https://us.example.com", nil)
+	c := uma.NewCompositeProvider(primary, standby, uma.CompositeOptions{
+		FailureThreshold:    2,
+		RecoveryThreshold:   2,
+		HealthCheckInterval: -1,
+		HealthCheck: func(ctx context.Context, p uma.Provider) error {
+			return p.(*regionProvider).getErr()
+		},
+	}, testr.New(t))
+	defer c.Close()
+
+	pat, err := c.ProtectionAPIToken(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "pat of https://eu.example.com", pat)
+
+	// errors that are not retryable don't count
+	primary.setErr(&httputil.ErrUnanticipatedResponse{Status: http.StatusNotFound})
+	for i := 0; i < 3; i++ {
+		_, err = c.ProtectionAPIToken(context.Background())
+		assert.Error(t, err)
+	}
+	assert.False(t, c.OnStandby())
+
+	primary.setErr(&httputil.ErrUnanticipatedResponse{Status: http.StatusServiceUnavailable})
+	_, err = c.ProtectionAPIToken(context.Background())
+	assert.Error(t, err)
+	assert.False(t, c.OnStandby())
+
+	// the call that fails over is sent to the standby
+	pat, err = c.ProtectionAPIToken(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "pat of https://us.example.com", pat)
+	assert.True(t, c.OnStandby())
+	assert.Equal(t, "https://us.example.com", c.WWWAuthenticateDirectives().AsUri)
+
+	rsc, err := c.GetResource("rsc-1")
+	require.NoError(t, err)
+	assert.Equal(t, "https://us.example.com", rsc.Name)
+
+	// the primary must be healthy several times in a row
+	primary.setErr(nil)
+	c.CheckHealth(context.Background())
+	primary.setErr(errors.New("connection refused"))
+	c.CheckHealth(context.Background())
+	primary.setErr(nil)
+	c.CheckHealth(context.Background())
+	assert.True(t, c.OnStandby())
+	c.CheckHealth(context.Background())
+	assert.False(t, c.OnStandby())
+	assert.Equal(t, primary, c.Active())
+}
+
+func TestCompositeProviderResourceCallsAreNotResent(t *testing.T) {
+	primary := newRegionProvider("https://eu.example.com", nil)
+	standby := newRegionProvider("https://us.example.com", nil)
+	c := uma.NewCompositeProvider(primary, standby, uma.CompositeOptions{
+		FailureThreshold:    1,
+		HealthCheckInterval: -1,
+	}, testr.New(t))
+	defer c.Close()
+
+	primary.setErr(&httputil.ErrUnanticipatedResponse{Status: http.StatusBadGateway})
+	_, err := c.GetResource("rsc-1")
+	assert.Error(t, err)
+	assert.True(t, c.OnStandby())
+}
+
+func TestCompositeProviderHealthCheck(t *testing.T) {
+	primary := newRegionProvider("https://eu.example.com", nil)
+	standby := newRegionProvider("https://us.example.com", nil)
+	c := uma.NewCompositeProvider(primary, standby, uma.CompositeOptions{
+		FailureThreshold:    2,
+		HealthCheckInterval: -1,
+		HealthCheck: func(ctx context.Context, p uma.Provider) error {
+			return p.(*regionProvider).getErr()
+		},
+	}, testr.New(t))
+	defer c.Close()
+
+	primary.setErr(errors.New("connection refused"))
+	c.CheckHealth(context.Background())
+	assert.False(t, c.OnStandby())
+	c.CheckHealth(context.Background())
+	assert.True(t, c.OnStandby())
+}
+
+func TestCompositeProviderDualVerification(t *testing.T) {
+	primary := newRegionProvider("https://eu.example.com", map[string]string{"eu": `{"sub":"user-1"}`})
+	standby := newRegionProvider("https://us.example.com", map[string]string{"us": `{"sub":"user-2"}`})
+
+	c := uma.NewCompositeProvider(primary, standby, uma.CompositeOptions{HealthCheckInterval: -1}, testr.New(t))
+	defer c.Close()
+	_, err := c.VerifySignature(context.Background(), "eu")
+	assert.NoError(t, err)
+	_, err = c.VerifySignature(context.Background(), "us")
+	assert.Error(t, err)
+
+	c = uma.NewCompositeProvider(primary, standby, uma.CompositeOptions{
+		HealthCheckInterval: -1,
+		DualVerification:    true,
+	}, testr.New(t))
+	defer c.Close()
+	payload, err := c.VerifySignature(context.Background(), "us")
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"sub":"user-2"}`, string(payload))
+	_, err = c.VerifySignature(context.Background(), "unknown")
+	assert.Error(t, err)
+}
@@ -0,0 +1,34 @@
+package uma
+
+import (
+	"net/http"
+)
+
+// isPreflight reports whether r is a CORS preflight request
+func isPreflight(r *http.Request) bool {
+	return r.Method == http.MethodOptions &&
+		r.Header.Get("Origin") != "" &&
+		r.Header.Get("Access-Control-Request-Method") != ""
+}
+
+// setCORSHeaders lets browsers read the UMA challenge of cross-origin requests. Without
+// Access-Control-Expose-Headers, scripts can't see the WWW-Authenticate header, and without a
+// matching Access-Control-Allow-Origin, they can't see the response at all.
+func (m *Manager) setCORSHeaders(w http.ResponseWriter, r *http.Request) {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return
+	}
+	w.Header().Add("Vary", "Origin")
+	if _, ok := m.corsAllowedOrigins["*"]; !ok {
+		if _, ok := m.corsAllowedOrigins[origin]; !ok {
+			return
+		}
+	}
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+	if m.rptRefresh != nil {
+		w.Header().Set("Access-Control-Expose-Headers", "WWW-Authenticate, "+RefreshedRPTHeader)
+		return
+	}
+	w.Header().Set("Access-Control-Expose-Headers", "WWW-Authenticate")
+}
@@ -0,0 +1,122 @@
+package uma_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/pckhoi/uma"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCORS(t *testing.T) {
+	p := newMockProvider(map[string]string{
+		"token-1": rptPayload("user-1", "User 1", "read"),
+	})
+	man := uma.New(
+		uma.ManagerOptions{
+			GetBaseURL: func(r *http.Request) url.URL {
+				return url.URL{Scheme: "https", Host: "api.example.com", Path: "/users"}
+			},
+			GetProvider: func(r *http.Request) uma.Provider {
+				return p
+			},
+			GetResourceStore: func(r *http.Request) uma.ResourceStore {
+				return &syncResourceStore{m: map[string]string{}}
+			},
+			DisableTokenExpirationCheck: true,
+			CORSAllowedOrigins:          []string{"https://app.example.com"},
+		},
+		map[string]uma.ResourceType{
+			"user": {Type: "user", ResourceScopes: []string{"read"}},
+		},
+		[]string{"oidc"},
+		nil,
+		[]map[string][]string{{"oidc": {"read"}}},
+		[]uma.Path{
+			uma.NewPath("/{id}", uma.NewResourceTemplate("user", "User {id}"), map[string]uma.Operation{
+				http.MethodGet:     {},
+				http.MethodOptions: {},
+			}),
+		},
+		testr.New(t),
+	)
+	h := man.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+
+	request := func(method, origin, token string, headers map[string]string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "https://api.example.com/users/1", nil)
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		for k, v := range headers {
+			r.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		return rec
+	}
+
+	// challenge is readable from allowed origin
+	rec := request(http.MethodGet, "https://app.example.com", "", nil)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Contains(t, rec.Header().Get("WWW-Authenticate"), `ticket="ticket-1"`)
+	assert.Equal(t, "https://app.example.com", rec.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "WWW-Authenticate", rec.Header().Get("Access-Control-Expose-Headers"))
+	assert.Equal(t, "Origin", rec.Header().Get("Vary"))
+
+	// granted responses carry the same headers
+	rec = request(http.MethodGet, "https://app.example.com", "token-1", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "https://app.example.com", rec.Header().Get("Access-Control-Allow-Origin"))
+
+	// other origins are not allowed
+	rec = request(http.MethodGet, "https://evil.example.com", "", nil)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, rec.Header().Get("Access-Control-Expose-Headers"))
+
+	// same-origin requests are left alone
+	rec = request(http.MethodGet, "", "", nil)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Empty(t, rec.Header().Get("Vary"))
+
+	// preflight requests bypass enforcement
+	rec = request(http.MethodOptions, "https://app.example.com", "", map[string]string{
+		"Access-Control-Request-Method":  "GET",
+		"Access-Control-Request-Headers": "authorization",
+	})
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Empty(t, rec.Header().Get("WWW-Authenticate"))
+
+	// plain OPTIONS requests are still enforced
+	rec = request(http.MethodOptions, "https://app.example.com", "", nil)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	// forward-auth handler grants forwarded preflight requests
+	fr := httptest.NewRequest(http.MethodGet, "http://auth.local/", nil)
+	fr.Header.Set("X-Forwarded-Method", "OPTIONS")
+	fr.Header.Set("X-Forwarded-Proto", "https")
+	fr.Header.Set("X-Forwarded-Host", "api.example.com")
+	fr.Header.Set("X-Forwarded-Uri", "/users/1")
+	fr.Header.Set("Origin", "https://app.example.com")
+	fr.Header.Set("Access-Control-Request-Method", "GET")
+	rec = httptest.NewRecorder()
+	man.ForwardAuthHandler().ServeHTTP(rec, fr)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	fr.Header.Set("X-Forwarded-Method", "GET")
+	rec = httptest.NewRecorder()
+	man.ForwardAuthHandler().ServeHTTP(rec, fr)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, "https://app.example.com", rec.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "WWW-Authenticate", rec.Header().Get("Access-Control-Expose-Headers"))
+}
@@ -0,0 +1,115 @@
+package uma
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// DecisionSource tells how the Manager reached a decision
+type DecisionSource string
+
+const (
+	// DecisionSkipped means the operation is not protected, i.e. no resource or scopes were found
+	DecisionSkipped DecisionSource = "skipped"
+
+	// DecisionDisabled means the path template is disabled with Templates.Override
+	DecisionDisabled DecisionSource = "disabled"
+
+	// DecisionCustom means the decision was made by ManagerOptions.CustomEnforce
+	DecisionCustom DecisionSource = "custom"
+
+	// DecisionAnonymous means the request has no token and was checked against ManagerOptions.AnonymousScopes
+	DecisionAnonymous DecisionSource = "anonymous"
+
+	// DecisionLocal means the token signature was verified and its permissions checked locally
+	DecisionLocal DecisionSource = "local"
+
+	// DecisionCached means the token was found in the token cache and its permissions checked locally
+	DecisionCached DecisionSource = "cached"
+)
+
+// DecisionDurations breaks down the time spent on each step of a decision
+type DecisionDurations struct {
+	// Match is the time spent matching the request against path templates and ResourceFromBody
+	Match time.Duration
+
+	// Registration is the time spent looking up or registering the resource
+	Registration time.Duration
+
+	// Verification is the time spent verifying the token and checking its permissions, including
+	// permission ticket requests
+	Verification time.Duration
+
+	// Total is the time spent on the whole decision
+	Total time.Duration
+}
+
+// Decision records how the Manager decided whether a request is allowed. It can be retrieved with
+// GetDecision by handlers behind Manager.Middleware. Logging middlewares in front of Manager.Middleware
+// can call WithDecision first, and read the record once the request is served, whether it is allowed
+// or not.
+type Decision struct {
+	// Template is the matched path template e.g. "/users/{id}". It is empty if no template matches.
+	Template string
+
+	// PathParams are the variables of Template, e.g. {"id": "1"} for "/users/1"
+	PathParams map[string]string
+
+	Resource *Resource
+	Scopes   []string
+
+	// Subject is the subject of the requesting party token, if a valid one is given
+	Subject string
+
+	// Permissions are the permissions of the requesting party token, if a valid one is given
+	Permissions []Permission
+
+	// rpt is the verified token, kept for ShadowProvider
+	rpt *RPT
+
+	Source  DecisionSource
+	Granted bool
+
+	// Reason tells why the request is denied, if it is denied because of its token or lack thereof
+	Reason DenialReason
+
+	Timings DecisionDurations
+}
+
+type decisionKey struct{}
+
+func setDecision(r *http.Request, d *Decision) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), decisionKey{}, d))
+}
+
+// WithDecision returns a request that carries an empty Decision, which is filled in by
+// Manager.Middleware down the chain. It is meant for middlewares in front of Manager.Middleware.
+func WithDecision(r *http.Request) (*http.Request, *Decision) {
+	d := &Decision{}
+	return setDecision(r, d), d
+}
+
+// GetDecision returns the Decision recorded by Manager.Middleware
+func GetDecision(r *http.Request) *Decision {
+	if v := r.Context().Value(decisionKey{}); v != nil {
+		return v.(*Decision)
+	}
+	return nil
+}
+
+// PathParams returns the variables of the path template matched by Manager.Middleware, e.g. {"id": "1"}
+// for "/users/{id}", so that handlers don't parse the path again. It returns nil if no template matched.
+func PathParams(r *http.Request) map[string]string {
+	if d := GetDecision(r); d != nil {
+		return d.PathParams
+	}
+	return nil
+}
+
+// recordDecision updates the Decision of the request, if there is one
+func recordDecision(r *http.Request, update func(d *Decision)) {
+	if d := GetDecision(r); d != nil {
+		update(d)
+	}
+}
@@ -0,0 +1,160 @@
+package uma
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// DecisionTiming describes how long it took the Manager to decide whether a request is allowed,
+// including resource matching, token verification and round trips to the authorization server
+type DecisionTiming struct {
+	Method string
+	Path   string
+
+	// Scopes required by the operation. It is nil if the decision did not finish within budget.
+	Scopes []string
+
+	Latency time.Duration
+
+	// BudgetExceeded is true if Latency is greater than ManagerOptions.MaxDecisionLatency
+	BudgetExceeded bool
+}
+
+// bufferedResponse keeps the response written during a decision, so that it can be discarded
+// if the decision exceeds its latency budget
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header {
+	return b.header
+}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	if b.status == 0 {
+		b.status = http.StatusOK
+	}
+	return b.body.Write(p)
+}
+
+func (b *bufferedResponse) WriteHeader(statusCode int) {
+	if b.status == 0 {
+		b.status = statusCode
+	}
+}
+
+func (b *bufferedResponse) flush(w http.ResponseWriter) {
+	for k, v := range b.header {
+		w.Header()[k] = v
+	}
+	if b.status != 0 {
+		w.WriteHeader(b.status)
+	}
+	if b.body.Len() > 0 {
+		w.Write(b.body.Bytes())
+	}
+}
+
+type decision struct {
+	rsc      *Resource
+	scopes   []string
+	claims   *Claims
+	ok       bool
+	resp     *bufferedResponse
+	panicVal any
+}
+
+func (m *Manager) writeLatencyExceededResponse(w http.ResponseWriter) {
+	if m.editLatencyExceededResponse != nil {
+		m.editLatencyExceededResponse(w)
+		return
+	}
+	w.Header().Set("Retry-After", "1")
+	w.WriteHeader(http.StatusServiceUnavailable)
+}
+
+func (m *Manager) observeDecision(r *http.Request, scopes []string, latency time.Duration) {
+	exceeded := m.maxDecisionLatency > 0 && latency > m.maxDecisionLatency
+	if exceeded {
+		m.logger.Info("decision latency budget exceeded",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"latency", latency.String(),
+			"budget", m.maxDecisionLatency.String(),
+		)
+	}
+	if m.observeDecisionLatency != nil {
+		m.observeDecisionLatency(r, DecisionTiming{
+			Method:         r.Method,
+			Path:           r.URL.Path,
+			Scopes:         scopes,
+			Latency:        latency,
+			BudgetExceeded: exceeded,
+		})
+	}
+}
+
+// decide runs enforce within the latency budget. When the budget is enforced, the decision runs in
+// a separate goroutine and its response is buffered. If the budget runs out first, the decision is
+// abandoned and the latency exceeded response is written instead.
+func (m *Manager) decide(w http.ResponseWriter, r *http.Request) (rsc *Resource, scopes []string, claims *Claims, ok bool) {
+	if m.maxDecisionLatency <= 0 && m.observeDecisionLatency == nil {
+		return m.enforce(w, r)
+	}
+	start := time.Now()
+	if m.maxDecisionLatency <= 0 || m.decisionLatencyReportOnly {
+		rsc, scopes, claims, ok = m.enforce(w, r)
+		m.observeDecision(r, scopes, time.Since(start))
+		return
+	}
+	done := make(chan decision, 1)
+	// the abandoned decision must not write to the record of this request
+	record, br := GetDecision(r), r
+	if record != nil {
+		br = setDecision(r, &Decision{})
+	}
+	if !m.goBackground(func() {
+		d := decision{resp: &bufferedResponse{header: http.Header{}}}
+		defer func() {
+			if v := recover(); v != nil {
+				d.panicVal = v
+			}
+			done <- d
+		}()
+		d.rsc, d.scopes, d.claims, d.ok = m.enforce(d.resp, br)
+	}) {
+		// shutting down, no new background work is allowed
+		return m.enforce(w, r)
+	}
+	timer := time.NewTimer(m.maxDecisionLatency)
+	defer timer.Stop()
+	select {
+	case d := <-done:
+		m.observeDecision(r, d.scopes, time.Since(start))
+		if d.panicVal != nil {
+			panic(d.panicVal)
+		}
+		if record != nil {
+			*record = *GetDecision(br)
+		}
+		d.resp.flush(w)
+		return d.rsc, d.scopes, d.claims, d.ok
+	case <-timer.C:
+		m.observeDecision(r, nil, time.Since(start))
+		m.goBackground(func() {
+			// the abandoned decision may still fail, which must not crash the server
+			if d := <-done; d.panicVal != nil {
+				m.logger.Error(fmt.Errorf("%v", d.panicVal), "abandoned decision failed",
+					"method", r.Method,
+					"path", r.URL.Path,
+				)
+			}
+		})
+		m.writeLatencyExceededResponse(w)
+		return nil, nil, nil, false
+	}
+}
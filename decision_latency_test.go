@@ -0,0 +1,73 @@
+package uma_test
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pckhoi/uma"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaxDecisionLatency(t *testing.T) {
+	var mu sync.Mutex
+	var timings []uma.DecisionTiming
+	observe := func(r *http.Request, timing uma.DecisionTiming) {
+		mu.Lock()
+		defer mu.Unlock()
+		timings = append(timings, timing)
+	}
+	lastTiming := func() uma.DecisionTiming {
+		mu.Lock()
+		defer mu.Unlock()
+		require.NotEmpty(t, timings)
+		return timings[len(timings)-1]
+	}
+	p := newMockProvider(map[string]string{
+		"token-1": rptPayload("user-1", "User 1", "read"),
+	})
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	enforced := newMockManager(t, p, uma.ManagerOptions{
+		MaxDecisionLatency:     50 * time.Millisecond,
+		ObserveDecisionLatency: observe,
+	}).Middleware(next)
+	reportOnly := newMockManager(t, p, uma.ManagerOptions{
+		MaxDecisionLatency:        50 * time.Millisecond,
+		DecisionLatencyReportOnly: true,
+		ObserveDecisionLatency:    observe,
+	}).Middleware(next)
+
+	rec := serve(enforced, http.MethodGet, "https://api.example.com/users/1", "token-1")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, uma.DecisionTiming{
+		Method:  http.MethodGet,
+		Path:    "/users/1",
+		Scopes:  []string{"read"},
+		Latency: lastTiming().Latency,
+	}, lastTiming())
+
+	rec = serve(enforced, http.MethodGet, "https://api.example.com/users/1", "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Contains(t, rec.Header().Get("WWW-Authenticate"), `ticket="ticket-1"`)
+
+	p.mu.Lock()
+	p.delay = 200 * time.Millisecond
+	p.mu.Unlock()
+
+	rec = serve(enforced, http.MethodGet, "https://api.example.com/users/1", "token-1")
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, "1", rec.Header().Get("Retry-After"))
+	timing := lastTiming()
+	assert.True(t, timing.BudgetExceeded)
+	assert.Nil(t, timing.Scopes)
+	assert.Less(t, timing.Latency, 200*time.Millisecond)
+
+	rec = serve(reportOnly, http.MethodGet, "https://api.example.com/users/1", "token-1")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	timing = lastTiming()
+	assert.True(t, timing.BudgetExceeded)
+	assert.Equal(t, []string{"read"}, timing.Scopes)
+	assert.GreaterOrEqual(t, timing.Latency, 200*time.Millisecond)
+}
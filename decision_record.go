@@ -0,0 +1,260 @@
+package uma
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// DecisionRecord is what DecisionRecorder receives about a decided request. It holds enough to
+// re-evaluate the request with Manager.Replay, but not the token itself.
+type DecisionRecord struct {
+	Time time.Time `json:"time"`
+
+	// Fingerprint identifies requests with the same method and URL
+	Fingerprint string `json:"fingerprint"`
+	Method      string `json:"method"`
+
+	// URL is the absolute URL of the request, with the Host header as host. Values of credentials in
+	// the query, see DefaultRedactedParams, are replaced with RedactedValue.
+	URL string `json:"url"`
+
+	Template     string   `json:"template,omitempty"`
+	ResourceID   string   `json:"resourceId,omitempty"`
+	ResourceName string   `json:"resourceName,omitempty"`
+	Scopes       []string `json:"scopes,omitempty"`
+
+	// Token is true if the request has a bearer token
+	Token       bool         `json:"token,omitempty"`
+	Subject     string       `json:"subject,omitempty"`
+	Permissions []Permission `json:"permissions,omitempty"`
+
+	Source  DecisionSource `json:"source,omitempty"`
+	Granted bool           `json:"granted"`
+	Reason  DenialReason   `json:"reason,omitempty"`
+}
+
+// DefaultRedactedParams are query parameters that commonly carry credentials. Parameter names are
+// compared case-insensitively.
+var DefaultRedactedParams = []string{
+	"access_token", "id_token", "refresh_token", "token", "rpt", "ticket", "code",
+	"client_secret", "password", "api_key", "apikey",
+}
+
+// RedactedValue replaces values of redacted query parameters
+const RedactedValue = "REDACTED"
+
+// redactQuery replaces values of parameters in m.redactParams, keeping the order and encoding of the
+// other parameters
+func (m *Manager) redactQuery(query string) string {
+	if query == "" {
+		return ""
+	}
+	parts := strings.Split(query, "&")
+	for i, part := range parts {
+		k, _, _ := strings.Cut(part, "=")
+		if name, err := url.QueryUnescape(k); err == nil && m.redactParams[strings.ToLower(name)] {
+			parts[i] = k + "=" + RedactedValue
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// DecisionRecorder receives a record of every decision. RecordDecision is called while the request is
+// being served, so implementations should not block.
+type DecisionRecorder interface {
+	RecordDecision(rec DecisionRecord)
+}
+
+func (m *Manager) newDecisionRecord(r *http.Request, d *Decision) DecisionRecord {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	u := *r.URL
+	u.RawQuery = m.redactQuery(u.RawQuery)
+	uri := scheme + "://" + r.Host + u.RequestURI()
+	sum := sha256.Sum256([]byte(r.Method + " " + uri))
+	rec := DecisionRecord{
+		Time:        m.clock.Now().UTC(),
+		Fingerprint: hex.EncodeToString(sum[:8]),
+		Method:      r.Method,
+		URL:         uri,
+		Template:    d.Template,
+		Scopes:      d.Scopes,
+		Token:       getBearerToken(r) != "",
+		Subject:     d.Subject,
+		Permissions: d.Permissions,
+		Source:      d.Source,
+		Granted:     d.Granted,
+		Reason:      d.Reason,
+	}
+	if d.Resource != nil {
+		rec.ResourceID = d.Resource.ID
+		rec.ResourceName = d.Resource.Name
+	}
+	return rec
+}
+
+// DecisionRing keeps the latest records in memory
+type DecisionRing struct {
+	mu      sync.Mutex
+	records []DecisionRecord
+	next    int
+	full    bool
+}
+
+// NewDecisionRing returns a ring that keeps the latest size records
+func NewDecisionRing(size int) *DecisionRing {
+	return &DecisionRing{records: make([]DecisionRecord, size)}
+}
+
+func (ring *DecisionRing) RecordDecision(rec DecisionRecord) {
+	ring.mu.Lock()
+	defer ring.mu.Unlock()
+	if len(ring.records) == 0 {
+		return
+	}
+	ring.records[ring.next] = rec
+	ring.next = (ring.next + 1) % len(ring.records)
+	if ring.next == 0 {
+		ring.full = true
+	}
+}
+
+// Records returns the kept records, oldest first
+func (ring *DecisionRing) Records() []DecisionRecord {
+	ring.mu.Lock()
+	defer ring.mu.Unlock()
+	if !ring.full {
+		return append([]DecisionRecord(nil), ring.records[:ring.next]...)
+	}
+	return append(append([]DecisionRecord(nil), ring.records[ring.next:]...), ring.records[:ring.next]...)
+}
+
+// DecisionLog writes records to a writer as JSON lines, e.g. to a file. Read them back with
+// ReadDecisionLog.
+type DecisionLog struct {
+	mu     sync.Mutex
+	enc    *json.Encoder
+	logger logr.Logger
+}
+
+// NewDecisionLog returns a log that writes to w. Write errors are logged with logger.
+func NewDecisionLog(w io.Writer, logger logr.Logger) *DecisionLog {
+	return &DecisionLog{enc: json.NewEncoder(w), logger: logger}
+}
+
+func (l *DecisionLog) RecordDecision(rec DecisionRecord) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.enc.Encode(rec); err != nil {
+		l.logger.Error(err, "error writing decision record", "method", rec.Method, "url", rec.URL)
+	}
+}
+
+// ReadDecisionLog reads the records written by DecisionLog
+func ReadDecisionLog(r io.Reader) ([]DecisionRecord, error) {
+	dec := json.NewDecoder(r)
+	records := []DecisionRecord{}
+	for {
+		rec := DecisionRecord{}
+		if err := dec.Decode(&rec); err != nil {
+			if errors.Is(err, io.EOF) {
+				return records, nil
+			}
+			return nil, fmt.Errorf("error reading decision record %d: %w", len(records)+1, err)
+		}
+		records = append(records, rec)
+	}
+}
+
+// ReplayResult is the decision that the Manager would make on a recorded request
+type ReplayResult struct {
+	Record DecisionRecord
+
+	Template string
+	Resource *Resource
+	Scopes   []string
+	Source   DecisionSource
+	Granted  bool
+	Reason   DenialReason
+
+	// Err is set if the request can't be re-evaluated, e.g. because its token was not checked when it
+	// was recorded and is now required. Granted is false then.
+	Err error
+}
+
+// Changed reports whether the request would be granted now but was denied then, or vice versa
+func (res ReplayResult) Changed() bool {
+	return res.Err == nil && res.Granted != res.Record.Granted
+}
+
+// Replay re-evaluates recorded requests against the current path templates, template overrides and
+// anonymous scopes of this Manager, e.g. one created with the templates of the next release or after
+// Reload, so that the impact of policy changes can be previewed before rollout. Nothing is sent to the
+// authorization server: resources are not registered and permissions of the recorded token are matched
+// by resource name, so tokens need permissions with rsname. Tokens rejected as invalid when recorded stay
+// invalid. GetBaseURL, AnonymousScopes and CustomEnforce only see the method and URL of the request.
+func (m *Manager) Replay(records []DecisionRecord) []ReplayResult {
+	results := make([]ReplayResult, len(records))
+	for i, rec := range records {
+		results[i] = m.replay(rec)
+	}
+	return results
+}
+
+func (m *Manager) replay(rec DecisionRecord) ReplayResult {
+	res := ReplayResult{Record: rec}
+	r, err := http.NewRequest(rec.Method, rec.URL, nil)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	r, d := WithDecision(r)
+	rsc, scopes, disabled, err := m.matchOperation(r)
+	res.Template, res.Resource, res.Scopes = d.Template, rsc, scopes
+	switch {
+	case disabled:
+		res.Source = DecisionDisabled
+	case err != nil:
+		res.Err = err
+	case rsc == nil || len(scopes) == 0:
+		res.Source, res.Granted = DecisionSkipped, true
+	case m.customEnforce != nil:
+		res.Source, res.Granted = DecisionCustom, m.customEnforce(r, *rsc, scopes)
+	case !rec.Token:
+		res.Source, res.Reason = DecisionAnonymous, DenialNoToken
+		if m.anonymousScopes != nil && missingScope(m.anonymousScopes(r, *rsc), scopes) == "" {
+			res.Granted, res.Reason = true, ""
+		}
+	case rec.Reason == DenialInvalidToken:
+		res.Reason = DenialInvalidToken
+	case rec.Source != DecisionLocal && rec.Source != DecisionCached:
+		res.Err = errors.New("token was not checked when the request was recorded")
+	default:
+		res.Source, res.Reason = DecisionLocal, DenialNoPermission
+		for _, p := range rec.Permissions {
+			if p.Rsname != rsc.Name {
+				continue
+			}
+			if missingScope(p.Scopes, scopes) == "" {
+				res.Granted, res.Reason = true, ""
+			} else {
+				res.Reason = DenialScopeMismatch
+			}
+			break
+		}
+	}
+	return res
+}
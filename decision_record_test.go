@@ -0,0 +1,132 @@
+package uma_test
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/pckhoi/uma"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecisionReplay(t *testing.T) {
+	p := newMockProvider(map[string]string{
+		"token-1": rptPayload("user-1", "User 1", "read"),
+	})
+	ring := uma.NewDecisionRing(10)
+	buf := &bytes.Buffer{}
+	log := uma.NewDecisionLog(buf, testr.New(t))
+	man := newMockManager(t, p, uma.ManagerOptions{DecisionRecorder: ring})
+	h := man.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	assert.Equal(t, http.StatusOK, serve(h, http.MethodGet, "https://api.example.com/users/1", "token-1").Code)
+	assert.Equal(t, http.StatusUnauthorized, serve(h, http.MethodPut, "https://api.example.com/users/1", "token-1").Code)
+	assert.Equal(t, http.StatusUnauthorized, serve(h, http.MethodGet, "https://api.example.com/users/1", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, serve(h, http.MethodGet, "https://api.example.com/users/1", "bad").Code)
+
+	records := ring.Records()
+	require.Len(t, records, 4)
+	assert.Equal(t, uma.DecisionRecord{
+		Time:         records[0].Time,
+		Fingerprint:  records[0].Fingerprint,
+		Method:       http.MethodGet,
+		URL:          "https://api.example.com/users/1",
+		Template:     "/{id}",
+		ResourceID:   "rsc-User 1",
+		ResourceName: "User 1",
+		Scopes:       []string{"read"},
+		Token:        true,
+		Subject:      "user-1",
+		Permissions:  []uma.Permission{{Rsid: "rsc-User 1", Rsname: "User 1", Scopes: []string{"read"}}},
+		Source:       uma.DecisionLocal,
+		Granted:      true,
+	}, records[0])
+	assert.Equal(t, records[0].Fingerprint, records[2].Fingerprint)
+	assert.NotEqual(t, records[0].Fingerprint, records[1].Fingerprint)
+	assert.Equal(t, uma.DenialScopeMismatch, records[1].Reason)
+	assert.Equal(t, uma.DenialNoToken, records[2].Reason)
+	assert.Equal(t, uma.DenialInvalidToken, records[3].Reason)
+
+	for _, rec := range records {
+		log.RecordDecision(rec)
+	}
+	read, err := uma.ReadDecisionLog(buf)
+	require.NoError(t, err)
+	assert.Equal(t, len(records), len(read))
+	assert.Equal(t, records[1].Permissions, read[1].Permissions)
+
+	tmpls := uma.NewTemplates()
+	tmpls.Override("/{id}", func(o *uma.TemplateOptions) {
+		o.Scopes = map[string][]string{http.MethodGet: {"write"}, http.MethodPut: {"read"}}
+	})
+	preview := newMockManager(t, newMockProvider(nil), uma.ManagerOptions{Templates: tmpls})
+	results := preview.Replay(read)
+	require.Len(t, results, 4)
+
+	assert.False(t, results[0].Granted)
+	assert.Equal(t, uma.DenialScopeMismatch, results[0].Reason)
+	assert.True(t, results[0].Changed())
+
+	assert.True(t, results[1].Granted)
+	assert.Equal(t, []string{"read"}, results[1].Scopes)
+	assert.True(t, results[1].Changed())
+
+	assert.False(t, results[2].Granted)
+	assert.Equal(t, uma.DenialNoToken, results[2].Reason)
+	assert.False(t, results[2].Changed())
+
+	assert.False(t, results[3].Granted)
+	assert.Equal(t, uma.DenialInvalidToken, results[3].Reason)
+	assert.False(t, results[3].Changed())
+
+	tmpls.Override("/{id}", func(o *uma.TemplateOptions) {
+		o.Public = true
+	})
+	for _, res := range preview.Replay(read) {
+		assert.True(t, res.Granted)
+		assert.Equal(t, uma.DecisionSkipped, res.Source)
+	}
+}
+
+func TestDecisionRing(t *testing.T) {
+	ring := uma.NewDecisionRing(2)
+	assert.Empty(t, ring.Records())
+	for _, m := range []string{"GET", "PUT", "DELETE"} {
+		ring.RecordDecision(uma.DecisionRecord{Method: m})
+	}
+	records := ring.Records()
+	require.Len(t, records, 2)
+	assert.Equal(t, "PUT", records[0].Method)
+	assert.Equal(t, "DELETE", records[1].Method)
+}
+
+func TestDecisionRecordRedactsQuery(t *testing.T) {
+	p := newMockProvider(map[string]string{
+		"token-1": rptPayload("user-1", "User 1", "read"),
+	})
+	ring := uma.NewDecisionRing(10)
+	man := newMockManager(t, p, uma.ManagerOptions{
+		DecisionRecorder:           ring,
+		DecisionRecordRedactParams: []string{"X-Signature"},
+	})
+	h := man.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	serve(h, http.MethodGet, "https://api.example.com/users/1?fields=name&access_token=secret&Access_Token=secret2&x-signature=abc&q=a%20b", "token-1")
+	serve(h, http.MethodGet, "https://api.example.com/users/1?fields=name&access_token=other&Access_Token=other&x-signature=def&q=a%20b", "token-1")
+	records := ring.Records()
+	require.Len(t, records, 2)
+	assert.Equal(t,
+		"https://api.example.com/users/1?fields=name&access_token=REDACTED&Access_Token=REDACTED&x-signature=REDACTED&q=a%20b",
+		records[0].URL,
+	)
+	// credentials don't tell requests apart
+	assert.Equal(t, records[0].URL, records[1].URL)
+	assert.Equal(t, records[0].Fingerprint, records[1].Fingerprint)
+
+	// redacted records can still be replayed
+	results := man.Replay(records)
+	require.Len(t, results, 2)
+	assert.Equal(t, "/{id}", results[0].Template)
+}
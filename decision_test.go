@@ -0,0 +1,132 @@
+package uma_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pckhoi/uma"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecision(t *testing.T) {
+	p := newMockProvider(map[string]string{
+		"token-1": rptPayload("user-1", "User 1", "read"),
+	})
+	man := newMockManager(t, p, uma.ManagerOptions{
+		TokenCacheSize: 10,
+		AnonymousScopes: func(r *http.Request, resource uma.Resource) (scopes []string) {
+			return []string{"read"}
+		},
+	})
+	var inner *uma.Decision
+	h := man.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inner = uma.GetDecision(r)
+	}))
+	var outer *uma.Decision
+	logged := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r, outer = uma.WithDecision(r)
+		h.ServeHTTP(w, r)
+	})
+
+	rec := serve(logged, http.MethodGet, "https://api.example.com/users/1", "token-1")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	require.NotNil(t, outer)
+	assert.Same(t, outer, inner)
+	assert.Equal(t, "/{id}", outer.Template)
+	require.NotNil(t, outer.Resource)
+	assert.Equal(t, "rsc-User 1", outer.Resource.ID)
+	assert.Equal(t, []string{"read"}, outer.Scopes)
+	assert.Equal(t, "user-1", outer.Subject)
+	assert.Equal(t, uma.DecisionLocal, outer.Source)
+	assert.True(t, outer.Granted)
+	assert.Greater(t, outer.Timings.Total, outer.Timings.Verification)
+
+	rec = serve(logged, http.MethodGet, "https://api.example.com/users/1", "token-1")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, uma.DecisionCached, outer.Source)
+
+	rec = serve(logged, http.MethodPut, "https://api.example.com/users/1", "token-1")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, []string{"write"}, outer.Scopes)
+	assert.Equal(t, uma.DecisionCached, outer.Source)
+	assert.Empty(t, outer.Subject)
+	assert.False(t, outer.Granted)
+
+	rec = serve(logged, http.MethodGet, "https://api.example.com/users/1", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, uma.DecisionAnonymous, outer.Source)
+	assert.True(t, outer.Granted)
+
+	rec = serve(logged, http.MethodGet, "https://api.example.com/users", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, outer.Template)
+	assert.Equal(t, uma.DecisionSkipped, outer.Source)
+
+	// the middleware attaches a record when there is none
+	inner = nil
+	rec = serve(h, http.MethodGet, "https://api.example.com/users/1", "token-1")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	require.NotNil(t, inner)
+	assert.Equal(t, "user-1", inner.Subject)
+}
+
+func TestPathParams(t *testing.T) {
+	p := newMockProvider(map[string]string{
+		"token-1": rptPayload("user-1", "User 1", "read"),
+	})
+	man := newMockManager(t, p, uma.ManagerOptions{})
+	var params map[string]string
+	h := man.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		params = uma.PathParams(r)
+	}))
+
+	rec := serve(h, http.MethodGet, "https://api.example.com/users/1", "token-1")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, map[string]string{"id": "1"}, params)
+
+	rec = serve(h, http.MethodGet, "https://api.example.com/users", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Nil(t, params)
+
+	assert.Nil(t, uma.PathParams(httptest.NewRequest(http.MethodGet, "/users/1", nil)))
+}
+
+func TestDecisionCustomEnforce(t *testing.T) {
+	man := newMockManager(t, newMockProvider(nil), uma.ManagerOptions{
+		CustomEnforce: func(r *http.Request, resource uma.Resource, scopes []string) bool {
+			return true
+		},
+	})
+	var d *uma.Decision
+	h := man.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		d = uma.GetDecision(r)
+	}))
+	rec := serve(h, http.MethodGet, "https://api.example.com/users/1", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	require.NotNil(t, d)
+	assert.Equal(t, uma.DecisionCustom, d.Source)
+	assert.True(t, d.Granted)
+}
+
+func TestDecisionWithLatencyBudget(t *testing.T) {
+	p := newMockProvider(map[string]string{
+		"token-1": rptPayload("user-1", "User 1", "read"),
+	})
+	man := newMockManager(t, p, uma.ManagerOptions{
+		MaxDecisionLatency: time.Second,
+	})
+	var d *uma.Decision
+	h := man.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		d = uma.GetDecision(r)
+	}))
+	rec := serve(h, http.MethodGet, "https://api.example.com/users/1", "token-1")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	require.NotNil(t, d)
+	assert.Equal(t, "/{id}", d.Template)
+	assert.Equal(t, "user-1", d.Subject)
+	assert.Equal(t, uma.DecisionLocal, d.Source)
+	assert.True(t, d.Granted)
+}
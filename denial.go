@@ -0,0 +1,113 @@
+package uma
+
+import (
+	"errors"
+	"net/http"
+)
+
+// DenialReason tells why a request is denied
+type DenialReason string
+
+const (
+	// DenialNoToken means the request has no bearer token
+	DenialNoToken DenialReason = "no_token"
+
+	// DenialInvalidToken means the token is expired, has an invalid signature, was revoked by logout, is
+	// not bound to the client or was minted for another audience
+	DenialInvalidToken DenialReason = "invalid_token"
+
+	// DenialNoPermission means the token has no permission for the resource
+	DenialNoPermission DenialReason = "no_permission"
+
+	// DenialScopeMismatch means the token has permission for the resource but not all required scopes
+	DenialScopeMismatch DenialReason = "scope_mismatch"
+)
+
+// Denial describes a denied request
+type Denial struct {
+	Reason   DenialReason
+	Resource *Resource
+	Scopes   []string
+
+	// Err is the error the token is rejected with. It is nil if Reason is DenialNoToken.
+	Err error
+}
+
+// DenialResponse is the response to a denied request
+type DenialResponse struct {
+	Status int
+
+	// Challenge if true, requests a permission ticket and sends it in the WWW-Authenticate header, so
+	// that the client can exchange it for a new RPT
+	Challenge bool
+
+	// ContentType and Body are written as is if Body is not empty
+	ContentType string
+	Body        []byte
+
+	// Header is added to the response headers, e.g. Location for redirects
+	Header http.Header
+}
+
+// DenialMapper maps a denied request to its response. See DefaultDenialMapper.
+type DenialMapper func(r *http.Request, d Denial) DenialResponse
+
+// DefaultDenialMapper responds to all denials with 401 and a permission ticket, as UMA 2.0 prescribes.
+// Deployments that don't exchange tickets for more scopes can map DenialScopeMismatch and
+// DenialNoPermission to 403 without challenge instead, as RFC 6750 does for insufficient scope.
+func DefaultDenialMapper(r *http.Request, d Denial) DenialResponse {
+	return DenialResponse{Status: http.StatusUnauthorized, Challenge: true}
+}
+
+// newDenial returns the denial of a token that is rejected with err, or of a request without token if
+// err is nil
+func newDenial(rsc *Resource, scopes []string, err error) Denial {
+	d := Denial{Reason: DenialNoToken, Resource: rsc, Scopes: scopes, Err: err}
+	var rptErr ErrInvalidRPT
+	switch {
+	case err == nil:
+	case errors.As(err, &rptErr) && (rptErr.Reason == RPTNoPermission ||
+		rptErr.Reason == RPTResourceMismatch || rptErr.Reason == RPTUnnamedPermission):
+		d.Reason = DenialNoPermission
+	case errors.As(err, &rptErr) && rptErr.Reason == RPTMissingScope:
+		d.Reason = DenialScopeMismatch
+	default:
+		d.Reason = DenialInvalidToken
+	}
+	return d
+}
+
+// writeDenial writes the response to a denied request, requesting a permission ticket if the response
+// is a challenge
+func (m *Manager) writeDenial(w http.ResponseWriter, r *http.Request, p Provider, d Denial) {
+	recordDecision(r, func(dec *Decision) {
+		dec.Reason = d.Reason
+	})
+	m.audit(r, p, AuditAccessDenied, d.Resource, d.Scopes, func(e *AuditEvent) {
+		e.Reason = d.Reason
+		if d.Err != nil {
+			e.Error = d.Err.Error()
+		}
+	})
+	if m.denialMapper == nil {
+		m.askForTicket(w, r, p, d)
+		m.writeUnauthorizedResponse(w)
+		return
+	}
+	resp := m.denialMapper(r, d)
+	if resp.Challenge {
+		m.askForTicket(w, r, p, d)
+	}
+	for k, vals := range resp.Header {
+		for _, v := range vals {
+			w.Header().Add(k, v)
+		}
+	}
+	if len(resp.Body) > 0 && resp.ContentType != "" {
+		w.Header().Set("Content-Type", resp.ContentType)
+	}
+	w.WriteHeader(resp.Status)
+	if len(resp.Body) > 0 {
+		w.Write(resp.Body)
+	}
+}
@@ -0,0 +1,218 @@
+package uma
+
+import (
+	"bytes"
+	"encoding/json"
+	htmltemplate "html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// Media types negotiated by NewDenialContentMapper, the first one is used if the client accepts anything
+const (
+	mediaTypeProblemJSON = "application/problem+json"
+	mediaTypeHTML        = "text/html"
+	mediaTypeText        = "text/plain"
+)
+
+// DenialPage is the data that denial templates are executed with
+type DenialPage struct {
+	Status   int
+	Title    string
+	Detail   string
+	Reason   DenialReason
+	Resource *Resource
+	Scopes   []string
+
+	// LoginURL is DenialContentOptions.LoginURL with the return_to parameter set, or empty
+	LoginURL string
+}
+
+// DefaultDenialHTMLTemplate is the page shown to browsers that are denied access
+var DefaultDenialHTMLTemplate = htmltemplate.Must(htmltemplate.New("denial").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>{{.Title}}</title></head>
+<body>
+<h1>{{.Title}}</h1>
+<p>{{.Detail}}</p>
+{{- if .LoginURL}}
+<p><a href="{{.LoginURL}}">Log in</a></p>
+{{- end}}
+</body>
+</html>
+`))
+
+// DefaultDenialTextTemplate is the plain text body of denied responses
+var DefaultDenialTextTemplate = template.Must(template.New("denial").Parse("{{.Title}}: {{.Detail}}\n"))
+
+// DenialContentOptions configures NewDenialContentMapper
+type DenialContentOptions struct {
+	// Mapper picks the status and challenge of denied responses. Defaults to DefaultDenialMapper.
+	Mapper DenialMapper
+
+	// LoginURL if set, redirects browsers that navigate to a protected resource without a valid token.
+	// The URL of the request is added as the return_to query parameter.
+	LoginURL string
+
+	// ConsentURL if set, redirects browsers whose token has no permission for the resource or lacks
+	// scopes, e.g. to the UI that requests them from the resource owner. The URL of the request is added
+	// as the return_to query parameter.
+	ConsentURL string
+
+	// HTMLTemplate renders pages for browsers that are not redirected. Defaults to
+	// DefaultDenialHTMLTemplate.
+	HTMLTemplate *htmltemplate.Template
+
+	// TextTemplate renders plain text bodies. Defaults to DefaultDenialTextTemplate.
+	TextTemplate *template.Template
+}
+
+// NewDenialContentMapper returns a DenialMapper that writes a body in the format that the Accept header
+// of the request prefers: an RFC 7807 problem detail as application/problem+json, which is also the
+// default, an HTML page or plain text. The problem detail has a "reason" member with the DenialReason.
+// Browsers are redirected to the login or consent UI if one is configured. Use it as
+// ManagerOptions.DenialMapper.
+func NewDenialContentMapper(opts DenialContentOptions) DenialMapper {
+	if opts.Mapper == nil {
+		opts.Mapper = DefaultDenialMapper
+	}
+	if opts.HTMLTemplate == nil {
+		opts.HTMLTemplate = DefaultDenialHTMLTemplate
+	}
+	if opts.TextTemplate == nil {
+		opts.TextTemplate = DefaultDenialTextTemplate
+	}
+	return func(r *http.Request, d Denial) DenialResponse {
+		resp := opts.Mapper(r, d)
+		page := DenialPage{
+			Status:   resp.Status,
+			Title:    http.StatusText(resp.Status),
+			Detail:   denialDetail(d),
+			Reason:   d.Reason,
+			Resource: d.Resource,
+			Scopes:   d.Scopes,
+		}
+		if opts.LoginURL != "" {
+			page.LoginURL = withReturnTo(opts.LoginURL, r)
+		}
+		buf := &bytes.Buffer{}
+		switch negotiateMediaType(r.Header.Get("Accept"), mediaTypeProblemJSON, mediaTypeHTML, mediaTypeText) {
+		case mediaTypeHTML:
+			redirect := ""
+			switch d.Reason {
+			case DenialNoToken, DenialInvalidToken:
+				redirect = page.LoginURL
+			case DenialNoPermission, DenialScopeMismatch:
+				if opts.ConsentURL != "" {
+					redirect = withReturnTo(opts.ConsentURL, r)
+				}
+			}
+			if redirect != "" {
+				return DenialResponse{Status: http.StatusFound, Header: http.Header{"Location": {redirect}}}
+			}
+			if err := opts.HTMLTemplate.Execute(buf, page); err != nil {
+				return resp
+			}
+			resp.ContentType = "text/html; charset=utf-8"
+		case mediaTypeText:
+			if err := opts.TextTemplate.Execute(buf, page); err != nil {
+				return resp
+			}
+			resp.ContentType = "text/plain; charset=utf-8"
+		default:
+			if err := json.NewEncoder(buf).Encode(map[string]interface{}{
+				"type":   "about:blank",
+				"title":  page.Title,
+				"status": page.Status,
+				"detail": page.Detail,
+				"reason": page.Reason,
+			}); err != nil {
+				return resp
+			}
+			resp.ContentType = mediaTypeProblemJSON
+		}
+		resp.Body = buf.Bytes()
+		return resp
+	}
+}
+
+// denialDetail explains a denial to the client
+func denialDetail(d Denial) string {
+	if d.Reason == DenialNoToken {
+		return "The request has no access token"
+	}
+	return newChallengeError(d).description
+}
+
+// withReturnTo adds the URL of r as the return_to parameter of uri
+func withReturnTo(uri string, r *http.Request) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return uri
+	}
+	q := u.Query()
+	q.Set("return_to", r.URL.RequestURI())
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// negotiateMediaType returns the offer that the Accept header prefers. A more specific media range
+// decides the quality of an offer over a wildcard one. Ties go to the earlier offer, so the first offer
+// is returned if header is empty.
+func negotiateMediaType(header string, offers ...string) string {
+	type mediaRange struct {
+		typ, subtype string
+		q            float64
+	}
+	ranges := []mediaRange{}
+	for _, part := range strings.Split(header, ",") {
+		mt, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		typ, subtype, ok := strings.Cut(strings.ToLower(strings.TrimSpace(mt)), "/")
+		if !ok {
+			continue
+		}
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			k, v, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if strings.TrimSpace(k) == "q" {
+				if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+					q = f
+				}
+			}
+		}
+		ranges = append(ranges, mediaRange{typ, subtype, q})
+	}
+	if len(ranges) == 0 {
+		return offers[0]
+	}
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		typ, subtype, _ := strings.Cut(offer, "/")
+		q, specificity := 0.0, -1
+		for _, mr := range ranges {
+			s := -1
+			switch {
+			case mr.typ == typ && (mr.subtype == subtype || strings.HasSuffix(subtype, "+"+mr.subtype)):
+				// application/json accepts application/problem+json
+				s = 2
+			case mr.typ == typ && mr.subtype == "*":
+				s = 1
+			case mr.typ == "*" && mr.subtype == "*":
+				s = 0
+			}
+			if s > specificity {
+				q, specificity = mr.q, s
+			}
+		}
+		if q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	if best == "" {
+		return offers[0]
+	}
+	return best
+}
@@ -0,0 +1,95 @@
+package uma_test
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pckhoi/uma"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDenialContentMapper(t *testing.T) {
+	p := newMockProvider(map[string]string{
+		"token-1": rptPayload("user-1", "User 1", "read"),
+	})
+	newHandler := func(opts uma.DenialContentOptions) http.Handler {
+		return newMockManager(t, p, uma.ManagerOptions{
+			DenialMapper: uma.NewDenialContentMapper(opts),
+		}).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	}
+	request := func(h http.Handler, method, accept, token string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "https://api.example.com/users/1?a=b", nil)
+		if accept != "" {
+			r.Header.Set("Accept", accept)
+		}
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		return rec
+	}
+
+	h := newHandler(uma.DenialContentOptions{})
+	for _, accept := range []string{"", "*/*", "application/json", "application/problem+json, text/html;q=0.5"} {
+		rec := request(h, http.MethodPut, accept, "token-1")
+		assert.Equal(t, http.StatusUnauthorized, rec.Code, accept)
+		assert.Contains(t, rec.Header().Get("WWW-Authenticate"), "ticket=")
+		assert.Equal(t, "application/problem+json", rec.Header().Get("Content-Type"))
+		obj := map[string]interface{}{}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &obj))
+		assert.Equal(t, map[string]interface{}{
+			"type":   "about:blank",
+			"title":  "Unauthorized",
+			"status": float64(401),
+			"detail": "The access token lacks scope write",
+			"reason": "scope_mismatch",
+		}, obj)
+	}
+
+	rec := request(h, http.MethodGet, "text/plain", "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, "text/plain; charset=utf-8", rec.Header().Get("Content-Type"))
+	assert.Equal(t, "Unauthorized: The request has no access token\n", rec.Body.String())
+
+	browser := "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"
+	rec = request(h, http.MethodGet, browser, "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, "text/html; charset=utf-8", rec.Header().Get("Content-Type"))
+	assert.Contains(t, rec.Body.String(), "<p>The request has no access token</p>")
+
+	h = newHandler(uma.DenialContentOptions{
+		LoginURL:   "https://app.example.com/login",
+		ConsentURL: "https://app.example.com/consent?lang=en",
+		Mapper: func(r *http.Request, d uma.Denial) uma.DenialResponse {
+			if d.Reason == uma.DenialScopeMismatch {
+				return uma.DenialResponse{Status: http.StatusForbidden}
+			}
+			return uma.DefaultDenialMapper(r, d)
+		},
+		HTMLTemplate: template.Must(template.New("").Parse(`{{.Status}} {{.LoginURL}}`)),
+	})
+	rec = request(h, http.MethodGet, browser, "")
+	assert.Equal(t, http.StatusFound, rec.Code)
+	assert.Equal(t, "https://app.example.com/login?return_to=%2Fusers%2F1%3Fa%3Db", rec.Header().Get("Location"))
+	assert.Empty(t, rec.Header().Get("WWW-Authenticate"))
+	rec = request(h, http.MethodPut, browser, "token-1")
+	assert.Equal(t, http.StatusFound, rec.Code)
+	assert.Equal(t, "https://app.example.com/consent?lang=en&return_to=%2Fusers%2F1%3Fa%3Db", rec.Header().Get("Location"))
+	rec = request(h, http.MethodPut, "application/json", "token-1")
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Empty(t, rec.Header().Get("WWW-Authenticate"))
+	assert.Contains(t, rec.Body.String(), `"status":403`)
+
+	h = newHandler(uma.DenialContentOptions{
+		LoginURL:     "https://app.example.com/login",
+		HTMLTemplate: template.Must(template.New("").Parse(`{{.Status}} {{.LoginURL}}`)),
+	})
+	rec = request(h, http.MethodPut, browser, "token-1")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, "401 https://app.example.com/login?return_to=%2Fusers%2F1%3Fa%3Db", rec.Body.String())
+}
@@ -0,0 +1,61 @@
+package uma_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/pckhoi/uma"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDenialMapper(t *testing.T) {
+	p := newMockProvider(map[string]string{
+		"token-1": rptPayload("user-1", "User 1", "read"),
+		"token-2": rptPayload("user-1", "User 2", "read"),
+	})
+	var denials []uma.Denial
+	h := newMockManager(t, p, uma.ManagerOptions{
+		DenialMapper: func(r *http.Request, d uma.Denial) uma.DenialResponse {
+			denials = append(denials, d)
+			switch d.Reason {
+			case uma.DenialScopeMismatch, uma.DenialNoPermission:
+				return uma.DenialResponse{
+					Status:      http.StatusForbidden,
+					ContentType: "application/json",
+					Body:        []byte(`{"error":"forbidden"}`),
+				}
+			}
+			return uma.DefaultDenialMapper(r, d)
+		},
+	}).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	rec := serve(h, http.MethodGet, "https://api.example.com/users/1", "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Contains(t, rec.Header().Get("WWW-Authenticate"), `ticket="ticket-1"`)
+
+	rec = serve(h, http.MethodGet, "https://api.example.com/users/1", "forged")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Contains(t, rec.Header().Get("WWW-Authenticate"), `ticket="ticket-2"`)
+
+	rec = serve(h, http.MethodPut, "https://api.example.com/users/1", "token-1")
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Empty(t, rec.Header().Get("WWW-Authenticate"))
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	assert.Equal(t, `{"error":"forbidden"}`, rec.Body.String())
+
+	rec = serve(h, http.MethodGet, "https://api.example.com/users/1", "token-2")
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Equal(t, 2, p.tickets)
+
+	require.Len(t, denials, 4)
+	assert.Equal(t, uma.DenialNoToken, denials[0].Reason)
+	assert.Nil(t, denials[0].Err)
+	assert.Equal(t, uma.DenialInvalidToken, denials[1].Reason)
+	assert.Error(t, denials[1].Err)
+	assert.Equal(t, uma.DenialScopeMismatch, denials[2].Reason)
+	assert.Equal(t, []string{"write"}, denials[2].Scopes)
+	assert.Equal(t, "rsc-User 1", denials[2].Resource.ID)
+	assert.ErrorAs(t, denials[2].Err, &uma.ErrInvalidRPT{})
+	assert.Equal(t, uma.DenialNoPermission, denials[3].Reason)
+}
@@ -0,0 +1,375 @@
+package uma
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pckhoi/uma/pkg/clock"
+	"github.com/pckhoi/uma/pkg/httputil"
+	"gopkg.in/square/go-jose.v2"
+)
+
+// DefaultDevIssuer is the issuer of tokens signed by DevProvider if DevOptions.Issuer is empty
+const DefaultDevIssuer = "http://localhost:8080/dev"
+
+// devKeyID is the key id of the signing key of DevProvider
+const devKeyID = "dev"
+
+// DevUser is a user of DevProvider and the scopes granted to them
+type DevUser struct {
+	// Scopes are granted on every resource
+	Scopes []string
+
+	// Resources maps a resource name or resource type to the scopes granted on matching resources, in
+	// addition to Scopes
+	Resources map[string][]string
+}
+
+// DevOptions configures NewDevProvider
+type DevOptions struct {
+	// Issuer is the iss claim of tokens and the address of the token endpoint served by the provider.
+	// Defaults to DefaultDevIssuer.
+	Issuer string
+
+	// Key signs tokens with RS256. If nil, a key is generated, so tokens are no longer valid once the
+	// process restarts.
+	Key *rsa.PrivateKey
+
+	// Users maps usernames to their grants. Users not listed are denied everything.
+	Users map[string]DevUser
+
+	// TokenTTL is the lifetime of issued RPTs. Defaults to 1 hour.
+	TokenTTL time.Duration
+
+	// Clock if defined, is used in place of the system clock to set token expiration
+	Clock clock.Clock
+}
+
+// DevProvider implements Provider without an authorization server, so that the API can be developed
+// against, e.g. by frontend teams, without running Keycloak. It keeps registered resources in memory,
+// issues permission tickets that encode the requested permission, and signs RPTs locally with the scopes
+// granted by DevOptions.Users. RPTs are obtained with IssueRPT or from the token endpoint that
+// DevProvider serves as an http.Handler.
+//
+// DevProvider does no authentication whatsoever. Never use it in production.
+type DevProvider struct {
+	opts      DevOptions
+	signer    jose.Signer
+	jwks      jose.JSONWebKeySet
+	mu        sync.RWMutex
+	resources map[string]ExpandedResource
+}
+
+func NewDevProvider(opts DevOptions) (*DevProvider, error) {
+	if opts.Issuer == "" {
+		opts.Issuer = DefaultDevIssuer
+	}
+	opts.Issuer = strings.TrimSuffix(opts.Issuer, "/")
+	if opts.TokenTTL <= 0 {
+		opts.TokenTTL = time.Hour
+	}
+	opts.Clock = clock.OrReal(opts.Clock)
+	if opts.Key == nil {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, fmt.Errorf("error generating dev key: %w", err)
+		}
+		opts.Key = key
+	}
+	signer, err := jose.NewSigner(jose.SigningKey{
+		Algorithm: jose.RS256,
+		Key:       jose.JSONWebKey{Key: opts.Key, KeyID: devKeyID},
+	}, (&jose.SignerOptions{}).WithType("JWT"))
+	if err != nil {
+		return nil, fmt.Errorf("error creating dev signer: %w", err)
+	}
+	return &DevProvider{
+		opts:   opts,
+		signer: signer,
+		jwks: jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{
+			Key:       &opts.Key.PublicKey,
+			KeyID:     devKeyID,
+			Algorithm: string(jose.RS256),
+			Use:       "sig",
+		}}},
+		resources: map[string]ExpandedResource{},
+	}, nil
+}
+
+// devTicket is the content of permission tickets issued by DevProvider
+type devTicket struct {
+	ResourceID string   `json:"rsid"`
+	Scopes     []string `json:"scopes,omitempty"`
+}
+
+// IssueRPT signs an RPT for username with the permission requested by ticket. The RPT grants the scopes
+// of the ticket that are granted to the user, or every granted scope if the ticket has no scopes. It
+// returns ErrDevAccessDenied if no requested scope is granted.
+func (p *DevProvider) IssueRPT(username, ticket string) (string, error) {
+	b, err := base64.RawURLEncoding.DecodeString(ticket)
+	if err != nil {
+		return "", fmt.Errorf("invalid ticket: %w", err)
+	}
+	t := devTicket{}
+	if err := json.Unmarshal(b, &t); err != nil {
+		return "", fmt.Errorf("invalid ticket: %w", err)
+	}
+	rsc, err := p.GetResource(t.ResourceID)
+	if err != nil {
+		return "", err
+	}
+	scopes := p.grantedScopes(username, rsc)
+	if len(t.Scopes) > 0 {
+		granted := stringSet(scopes)
+		scopes = nil
+		for _, s := range t.Scopes {
+			if _, ok := granted[s]; ok {
+				scopes = append(scopes, s)
+			}
+		}
+	}
+	if len(scopes) == 0 {
+		return "", ErrDevAccessDenied{Username: username, ResourceID: t.ResourceID}
+	}
+	now := p.opts.Clock.Now()
+	claims := Claims{
+		Authorization: &Authorization{Permissions: []Permission{{
+			Rsid:   rsc.ID,
+			Rsname: rsc.Name,
+			Scopes: scopes,
+		}}},
+		PreferredUsername: username,
+		Sub:               username,
+		Typ:               "Bearer",
+		Iat:               int(now.Unix()),
+		Exp:               int(now.Add(p.opts.TokenTTL).Unix()),
+	}
+	payload, err := json.Marshal(struct {
+		Claims
+		Iss string `json:"iss"`
+	}{claims, p.opts.Issuer})
+	if err != nil {
+		return "", err
+	}
+	jws, err := p.signer.Sign(payload)
+	if err != nil {
+		return "", fmt.Errorf("error signing rpt: %w", err)
+	}
+	return jws.CompactSerialize()
+}
+
+// grantedScopes returns the scopes of rsc that are granted to username
+func (p *DevProvider) grantedScopes(username string, rsc *ExpandedResource) []string {
+	user, ok := p.opts.Users[username]
+	if !ok {
+		return nil
+	}
+	granted := stringSet(user.Scopes)
+	for _, key := range []string{rsc.Name, rsc.Type} {
+		if key == "" {
+			continue
+		}
+		for _, s := range user.Resources[key] {
+			granted[s] = struct{}{}
+		}
+	}
+	scopes := []string{}
+	for _, s := range rsc.ResourceScopes {
+		if _, ok := granted[s.Name]; ok {
+			scopes = append(scopes, s.Name)
+		}
+	}
+	return scopes
+}
+
+// ServeHTTP serves the token endpoint, the UMA discovery document and the JWKS of the provider under the
+// path of the issuer. The token endpoint accepts the UMA grant with the ticket form parameter, and takes
+// the requesting party from the username form parameter rather than from a claim token.
+func (p *DevProvider) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/.well-known/uma2-configuration"):
+		writeDevJSON(w, http.StatusOK, p.Discovery())
+	case strings.HasSuffix(r.URL.Path, "/jwks"):
+		writeDevJSON(w, http.StatusOK, p.jwks)
+	case strings.HasSuffix(r.URL.Path, "/token") && r.Method == http.MethodPost:
+		p.serveToken(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (p *DevProvider) serveToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeDevJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+	if r.PostForm.Get("grant_type") != "urn:ietf:params:oauth:grant-type:uma-ticket" {
+		writeDevJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported_grant_type"})
+		return
+	}
+	rpt, err := p.IssueRPT(r.PostForm.Get("username"), r.PostForm.Get("ticket"))
+	if err != nil {
+		if errors.As(err, &ErrDevAccessDenied{}) {
+			writeDevJSON(w, http.StatusForbidden, map[string]string{"error": "access_denied"})
+			return
+		}
+		writeDevJSON(w, http.StatusBadRequest, map[string]string{
+			"error":             "invalid_grant",
+			"error_description": err.Error(),
+		})
+		return
+	}
+	writeDevJSON(w, http.StatusOK, httputil.ClientCreds{
+		AccessToken: rpt,
+		ExpiresIn:   int(p.opts.TokenTTL / time.Second),
+		TokenType:   "Bearer",
+	})
+}
+
+func writeDevJSON(w http.ResponseWriter, status int, obj interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(obj)
+}
+
+// VerifySignature verifies jwt with the dev key and checks that it is issued by the dev issuer
+func (p *DevProvider) VerifySignature(ctx context.Context, jwt string) ([]byte, error) {
+	jws, err := jose.ParseSigned(jwt)
+	if err != nil {
+		return nil, fmt.Errorf("malformed jwt: %w", err)
+	}
+	payload, ok := verifyWithKeySet(jws, &p.jwks)
+	if !ok {
+		return nil, errors.New("failed to verify signature: not signed with the dev key")
+	}
+	claims := struct {
+		Iss string `json:"iss"`
+	}{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("error parsing jwt payload: %w", err)
+	}
+	if claims.Iss != p.opts.Issuer {
+		return nil, fmt.Errorf("token issued by %q, expected %q", claims.Iss, p.opts.Issuer)
+	}
+	return payload, nil
+}
+
+// Authenticate returns a placeholder token since there is no protection API to call
+func (p *DevProvider) Authenticate(client *http.Client) (*httputil.ClientCreds, error) {
+	return &httputil.ClientCreds{AccessToken: "dev", TokenType: "Bearer"}, nil
+}
+
+func (p *DevProvider) ProtectionAPIToken(ctx context.Context) (string, error) {
+	return "dev", nil
+}
+
+func (p *DevProvider) ProtectionRequest(ctx context.Context, method, endpointSuffix string, body interface{}) (*http.Response, error) {
+	return nil, fmt.Errorf("DevProvider has no protection API: %s %s", method, endpointSuffix)
+}
+
+// CreateResource stores the resource in memory, using its name as id
+func (p *DevProvider) CreateResource(request *Resource) (*ExpandedResource, error) {
+	rsc := expandDevResource(request.Name, request)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.resources[rsc.ID] = rsc
+	return &rsc, nil
+}
+
+func expandDevResource(id string, request *Resource) ExpandedResource {
+	rsc := ExpandedResource{
+		ID:          id,
+		Name:        request.Name,
+		DisplayName: request.DisplayName,
+		Type:        request.Type,
+		Description: request.Description,
+		IconUri:     request.IconUri,
+	}
+	for _, s := range request.ResourceScopes {
+		rsc.ResourceScopes = append(rsc.ResourceScopes, Scope{Name: s})
+	}
+	return rsc
+}
+
+func (p *DevProvider) GetResource(id string) (*ExpandedResource, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	rsc, ok := p.resources[id]
+	if !ok {
+		return nil, fmt.Errorf("resource %q not found", id)
+	}
+	return &rsc, nil
+}
+
+func (p *DevProvider) UpdateResource(id string, resource *Resource) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.resources[id]; !ok {
+		return fmt.Errorf("resource %q not found", id)
+	}
+	p.resources[id] = expandDevResource(id, resource)
+	return nil
+}
+
+func (p *DevProvider) DeleteResource(id string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.resources, id)
+	return nil
+}
+
+// ListResources lists registered resources. Like Keycloak, it filters resources by the name query
+// parameter, which matches exactly if exactName is true.
+func (p *DevProvider) ListResources(urlQuery url.Values) ([]string, error) {
+	name := urlQuery.Get("name")
+	exact := urlQuery.Get("exactName") == "true"
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	ids := []string{}
+	for id, rsc := range p.resources {
+		if name != "" && !(exact && rsc.Name == name || !exact && strings.Contains(rsc.Name, name)) {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// CreatePermissionTicket returns a ticket that encodes the resource id and scopes, to be exchanged with
+// IssueRPT or at the token endpoint
+func (p *DevProvider) CreatePermissionTicket(resourceID string, scopes ...string) (string, error) {
+	b, err := json.Marshal(devTicket{ResourceID: resourceID, Scopes: scopes})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// WWWAuthenticateDirectives uses the last path segment of the issuer as realm
+func (p *DevProvider) WWWAuthenticateDirectives() WWWAuthenticateDirectives {
+	path := strings.Split(p.opts.Issuer, "/")
+	return WWWAuthenticateDirectives{
+		Realm: path[len(path)-1],
+		AsUri: p.opts.Issuer,
+	}
+}
+
+// Discovery returns the endpoints served by ServeHTTP
+func (p *DevProvider) Discovery() UMADiscovery {
+	return UMADiscovery{
+		Issuer:              p.opts.Issuer,
+		TokenEndpoint:       p.opts.Issuer + "/token",
+		JwksURI:             p.opts.Issuer + "/jwks",
+		GrantTypesSupported: []string{"urn:ietf:params:oauth:grant-type:uma-ticket"},
+	}
+}
@@ -0,0 +1,111 @@
+package uma_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"testing"
+
+	"github.com/pckhoi/uma"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var ticketRe = regexp.MustCompile(`ticket="([^"]+)"`)
+
+func TestDevProvider(t *testing.T) {
+	p, err := uma.NewDevProvider(uma.DevOptions{
+		Users: map[string]uma.DevUser{
+			"alice": {Scopes: []string{"read"}, Resources: map[string][]string{"User 1": {"write"}}},
+			"bob":   {Resources: map[string][]string{"user": {"read", "write"}}},
+		},
+	})
+	require.NoError(t, err)
+	man := newMockManager(t, p, uma.ManagerOptions{})
+	h := man.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	rptFor := func(method, uri, username string) (string, error) {
+		rec := serve(h, method, uri, "")
+		require.Equal(t, http.StatusUnauthorized, rec.Code)
+		m := ticketRe.FindStringSubmatch(rec.Header().Get("WWW-Authenticate"))
+		require.Len(t, m, 2)
+		return p.IssueRPT(username, m[1])
+	}
+
+	rpt, err := rptFor(http.MethodGet, "/users/1", "alice")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, serve(h, http.MethodGet, "/users/1", rpt).Code)
+	assert.Equal(t, http.StatusUnauthorized, serve(h, http.MethodGet, "/users/2", rpt).Code)
+
+	rpt, err = rptFor(http.MethodPut, "/users/1", "alice")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, serve(h, http.MethodPut, "/users/1", rpt).Code)
+
+	rpt, err = rptFor(http.MethodPut, "/users/2", "alice")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, serve(h, http.MethodPut, "/users/2", rpt).Code)
+
+	rpt, err = rptFor(http.MethodPut, "/users/2", "bob")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, serve(h, http.MethodPut, "/users/2", rpt).Code)
+
+	_, err = rptFor(http.MethodGet, "/users/1", "mallory")
+	assert.Equal(t, uma.ErrDevAccessDenied{Username: "mallory", ResourceID: "User 1"}, err)
+}
+
+func TestDevProviderTokenEndpoint(t *testing.T) {
+	p, err := uma.NewDevProvider(uma.DevOptions{
+		Users: map[string]uma.DevUser{"alice": {Scopes: []string{"read"}}},
+	})
+	require.NoError(t, err)
+	_, err = p.CreateResource(&uma.Resource{
+		Name:         "User 1",
+		ResourceType: uma.ResourceType{Type: "user", ResourceScopes: []string{"read", "write"}},
+	})
+	require.NoError(t, err)
+	srv := httptest.NewServer(http.StripPrefix("/dev", p))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/dev/.well-known/uma2-configuration")
+	require.NoError(t, err)
+	doc := uma.UMADiscovery{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&doc))
+	resp.Body.Close()
+	assert.Equal(t, uma.DefaultDevIssuer+"/token", doc.TokenEndpoint)
+
+	requestRPT := func(username string, scopes ...string) (*http.Response, map[string]interface{}) {
+		ticket, err := p.CreatePermissionTicket("User 1", scopes...)
+		require.NoError(t, err)
+		resp, err := http.PostForm(srv.URL+"/dev/token", url.Values{
+			"grant_type": {"urn:ietf:params:oauth:grant-type:uma-ticket"},
+			"ticket":     {ticket},
+			"username":   {username},
+		})
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body := map[string]interface{}{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		return resp, body
+	}
+
+	resp, body := requestRPT("alice")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	payload, err := p.VerifySignature(context.Background(), body["access_token"].(string))
+	require.NoError(t, err)
+	rpt, err := uma.ParseRPT(payload)
+	require.NoError(t, err)
+	assert.Equal(t, "alice", rpt.Sub)
+	assert.Equal(t, []uma.Permission{{Rsid: "User 1", Rsname: "User 1", Scopes: []string{"read"}}}, rpt.Authorization.Permissions)
+
+	resp, denied := requestRPT("alice", "write")
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	assert.Equal(t, "access_denied", denied["error"])
+
+	other, err := uma.NewDevProvider(uma.DevOptions{Issuer: "http://localhost:9090/dev"})
+	require.NoError(t, err)
+	_, err = other.VerifySignature(context.Background(), body["access_token"].(string))
+	assert.Error(t, err)
+}
@@ -23,6 +23,15 @@ Define resource types by adding `x-uma-resource-types` section to the root level
 	      - read
 	      - write
 
+A scope can also be described with an object, which is registered as an UMA scope description:
+
+	resourceScopes:
+	  - read
+	  - name: write
+	    displayName: Update
+	    description: update a user
+	    iconUri: https://www.example.com/scopes/write.png
+
 2. Enable UMA in security schemes
 
 UMA access control only work with oauth2 or openIdConnect security scheme. To enable, add the key
@@ -49,8 +58,33 @@ represents the default resource at all paths. Path level resource overrides root
 	      type: https://www.example.com/rsrcs/user
 	      name: User {id}
 
-Each resource object has 2 keys: type and name. Type must be one of the types defined earlier. Name
-is the name template string that can be rendered using path parameters.
+Each resource object has 2 required keys: type and name. Type must be one of the types defined
+earlier. Name is the name template string that can be rendered using path parameters. Optional keys
+displayName and description are also templates, they are shown to resource owners by the
+authorization server. So is iconUri, which overrides the icon of the resource type. Set
+ownerManagedAccess to true to let resource owners share their resources.
+
+Placeholders can pipe parameters through functions: upper, lower, trim, slug, and pad:N which zero
+pads to N characters (pad:N:C pads with C). Functions are chained from left to right e.g.
+
+	name: User {id|trim|pad:6|upper}
+
+The generator rejects unknown functions. Go code can add its own with WithTemplateFuncs, or compute
+names entirely with WithTemplateNameFunc.
+
+Display names and icons can be localized with localizedDisplayNames and localizedIconUris, which map
+locales to templates. The locale is negotiated with the Accept-Language header of the request:
+
+	/{id}:
+	  x-uma-resource:
+	    type: https://www.example.com/rsrcs/user
+	    name: User {id}
+	    displayName: User {id}
+	    localizedDisplayNames:
+	      fr: Utilisateur {id}
+	      pt-BR: Usuário {id}
+
+A resource is registered with the display name negotiated for the request that first reaches it.
 
 4. Define scopes
 
@@ -65,6 +99,18 @@ security scheme is uma-enabled:
 	      security:
 	        - oidc: [write]
 
+Unless ManagerOptions.IncludeScopesInPermissionTicket is set, permission tickets don't include required
+scopes. It can be overridden for a resource with the includeScopes key of x-uma-resource, and for an
+operation with x-uma-include-scopes, e.g. when policies of some resources are resource-scoped:
+
+	/{id}:
+	  x-uma-resource:
+	    type: https://www.example.com/rsrcs/user
+	    name: User {id}
+	    includeScopes: false
+	  put:
+	    x-uma-include-scopes: true
+
 5. Generate code
 
 This package can generate relevant go code from the OpenAPI spec:
@@ -75,6 +121,54 @@ This package can generate relevant go code from the OpenAPI spec:
 The generated code will work with any server compatible with the net/http package. It can works by
 itself or works along side other generated codes such as those generated by github.com/deepmap/oapi-codegen
 
+A monorepo can generate code for many specs in one invocation. Each spec, given as a file or found in a
+directory, gets its own package named after the file, and --import-path adds a registry package that
+maps package names to their UMAMatcher and UMATemplates:
+
+	uma-codegen batch ./specs --out-dir ./gen --import-path example.com/app/gen
+
+With --watch, both commands keep running and regenerate code whenever specs or templates change. Files
+are only rewritten if their content changes:
+
+	uma-codegen openapi.yaml mypackage -o uma.gen.go --watch
+
+Each resource type gets a ResourceType constant named after the last segment of its type, and each of
+its scopes a Scope constant e.g. ResourceUser and ScopeUserRead for the scope "read" of type
+"https://www.example.com/rsrcs/user". ResourceType.Scopes returns all scopes of a type. Generation fails
+if two constants end up with the same name.
+
+Path templates in the generated code are compiled once into UMAMatcher, which is shared by every manager
+returned from UMAManager. A Matcher can also be serialized with json.Marshal, embedded, restored with
+json.Unmarshal and given to uma.NewFromMatcher. With --json, the generator also writes the matcher as a
+JSON file, so that components built without the generated code, such as plugins loaded at runtime, share
+the same resource model:
+
+	uma-codegen openapi.yaml mypackage -o uma.gen.go --json uma.json
+
+	//go:embed uma.json
+	var umaFS embed.FS
+	matcher, err := uma.LoadTemplatesJSON(umaFS, "uma.json")
+
+Teams that manage Keycloak as code can derive authorization scopes, resources and permissions from the
+spec instead of duplicating them. The manifest command writes them for the Keycloak Terraform provider,
+or as plain JSON with --format json:
+
+	uma-codegen manifest openapi.yaml --base-url https://api.example.com -o uma.tf.json
+
+In clusters with many services, uma-syncd reconciles the resources of JSON manifests found in a
+directory, such as a mounted ConfigMap, and serves the status of the last sync for readiness probes:
+
+	uma-syncd --issuer $ISSUER --client-id $CLIENT_ID --client-secret $CLIENT_SECRET \
+	    --dir /etc/uma/manifests --listen :8080
+
+The emitted code can be customized without forking the generator. Templates defined in *.tmpl files of
+the directory given with --templates take precedence over the built-in ones: a file can replace
+middleware.go.tmpl entirely, or only redefine named templates. "resourceTemplate" renders each
+uma.NewResourceTemplate call and "extra", empty by default, is appended to the generated file, which is
+the place for company-specific wrappers. Values given with --set are available to templates as .Values:
+
+	uma-codegen openapi.yaml mypackage -o uma.gen.go --templates ./uma-templates --set prefix=Acme
+
 6. Use the generated code
 
 	// create a new UMA provider
@@ -103,5 +197,250 @@ itself or works along side other generated codes such as those generated by gith
 	sm := http.NewServeMux()
 	// apply the middleware, which enforces UMA permissions according to spec
 	s.Handler = umaManager.Middleware(sm)
+
+When GetProvider picks one of several providers e.g. by tenant, each provider can have its own http client,
+so issuers are reached through different proxies or with different TLS client certificates. Without a
+KeySet, keys are fetched with the same client:
+
+	provider, _ := uma.NewKeycloakProvider(issuer, clientID, clientSecret, nil, logger,
+		uma.WithKeycloakClientOptions(uma.ProviderClientOptions{
+			TLSClientConfig: &tls.Config{Certificates: []tls.Certificate{tenantCert}},
+			Proxy:           http.ProxyURL(tenantProxy),
+		}),
+	)
+
+Tenants that share an authorization server also share its capacity. ManagerOptions.ProviderLimit caps the
+resource registrations and permission ticket requests in flight and per interval for each issuer, so that
+a tenant that registers resources excessively can't starve the others. Requests over the limit get 503
+with Retry-After, or a challenge without ticket:
+
+	ProviderLimit:         uma.ProviderLimit{MaxConcurrent: 10, Quota: 600, QuotaInterval: time.Minute},
+	ProviderLimitByIssuer: map[string]uma.ProviderLimit{bigTenantIssuer: {MaxConcurrent: 50}},
+
+A fleet that runs several Keycloak releases can share one version of this package. Give the release with
+uma.WithKeycloakVersion, or let KeycloakProvider.Version read it from the server info endpoint. Admin
+credentials of releases before 17 get the "/auth" context path:
+
+	provider, _ := uma.NewKeycloakProvider(issuer, clientID, clientSecret, nil, logger,
+		uma.WithKeycloakVersion("16.1.1"),
+		uma.WithKeycloakAdminCredentials(keycloak.AdminCredentials{ServerURL: "https://kc.example.com"}),
+	)
+
+Requests to the authorization server are sent once by default. To ride out restarts of Keycloak, network
+errors, 408, 429 and most 5xx responses can be retried with exponential backoff, honoring Retry-After:
+
+	uma.WithKeycloakRetryOptions(httputil.RetryOptions{MaxAttempts: 3, Backoff: 200 * time.Millisecond})
+
+rp.WithRetryOptions does the same for token requests of rp.KeycloakClient. Failed responses are returned
+as *httputil.ErrUnanticipatedResponse, which tells the status, the OAuth error if any, and whether the
+request is retryable. httputil.IsRetryable classifies any error the same way.
+
+uma.NewBaseProvider works with authorization servers that name protection API fields differently, given a
+payload codec:
+
+	uma.WithPayloadCodec(httputil.RenameFields{"_id": "id", "resource_scopes": "scopes"})
+
+ForgeRock Access Management realms have their own provider, which requests protection API tokens with the
+uma_protection scope and registers resources the way AM expects. AM puts permissions in another claim of
+the RPT:
+
+	provider, _ := uma.NewForgeRockProvider(issuer, clientID, clientSecret, nil, logger)
+	opts.PermissionClaimPath = uma.ForgeRockPermissionClaimPath
+
+Janssen and Gluu servers can provision the client of the resource server at startup. Given a software
+statement assertion (SSA) issued by the server, uma.NewJanssenProvider registers a new client and uses
+its credentials:
+
+	provider, _ := uma.NewJanssenProvider(issuer, "", "", nil, logger,
+		uma.WithJanssenSoftwareStatement(ssa, uma.ClientMetadata{ClientName: "billing-api"}),
+	)
+
+Decisions can come from OpenFGA or Auth0 FGA instead of the permissions of RPTs. uma.FGAProvider verifies
+ordinary access tokens of an issuer and asks the FGA Check API whether the subject has the relation mapped
+from each required scope on the object of the resource:
+
+	provider, _ := uma.NewFGAProvider(uma.FGAOptions{
+		APIURL:    "https://fga.example.com",
+		StoreID:   storeID,
+		APIToken:  presharedKey,
+		Issuer:    "https://kc.example.com/realms/demo",
+		Relations: map[string]string{"read": "viewer", "write": "editor"},
+	}, logger)
+
+Other providers can make decisions the same way by implementing uma.PermissionCheckingProvider.
+
+For disaster recovery, uma.NewCompositeProvider sends calls to a primary authorization server and fails
+over to a standby one after repeated failures, failing back once health checks of the primary pass again.
+Key the resource store by issuer, since each server assigns its own resource ids:
+
+	provider := uma.NewCompositeProvider(primary, standby, uma.CompositeOptions{DualVerification: true}, logger)
+	defer provider.Close()
+	opts.ResourceStoreKeyByIssuer = true
+
+During development, uma.NewDevProvider stands in for the authorization server. It signs RPTs with a local
+key and grants each user the scopes listed in DevOptions.Users. Mount it to serve the token endpoint, where
+clients exchange tickets for RPTs by passing a username:
+
+	provider, err := uma.NewDevProvider(uma.DevOptions{
+		Issuer: "http://localhost:8080/dev",
+		Users:  map[string]uma.DevUser{"alice": {Scopes: []string{"read", "write"}}},
+	})
+	mux.Handle("/dev/", http.StripPrefix("/dev", provider))
+
+To validate a migration to another authorization server, e.g. from Keycloak to ForgeRock AM, set
+ManagerOptions.ShadowProvider. Every decision made with a valid token is evaluated again against the shadow
+provider in the background, and divergences are logged without affecting responses. At most
+ShadowConcurrency evaluations run at once, further decisions are dropped and counted by
+umaManager.ShadowDropped(). Unless the shadow is a PermissionCheckingProvider, it has to accept the tokens
+of the current server:
+
+	opts.ShadowProvider = func(r *http.Request) uma.Provider { return forgeRock }
+	opts.OnShadowDivergence = func(div uma.ShadowDivergence) { divergences.Inc() }
+
+Endpoints of the protection API that this package doesn't wrap can be called with the PAT of a provider,
+which is renewed when it expires:
+
+	pat, err := provider.ProtectionAPIToken(ctx)
+	req.Header.Set("Authorization", "Bearer "+pat)
+
+Or with ProtectionRequest, which also sends the User-Agent and request editors of the provider:
+
+	resp, err := provider.ProtectionRequest(ctx, http.MethodPost, "/authz/protection/uma-policy/"+id, policy)
+
+Enforcement of a path template can be changed at runtime through UMATemplates, e.g. from a feature flag
+or as an emergency kill switch:
+
+	// reject all requests to /users/{id} with 503
+	mypackage.UMATemplates.Override("/users/{id}", func(o *uma.TemplateOptions) {
+		o.Disabled = true
+	})
+	// undo all overrides of /users/{id}
+	mypackage.UMATemplates.Reset("/users/{id}")
+
+Path templates and overrides can also be reloaded without a redeploy. Manager.WatchConfig reloads a JSON
+encoded uma.ReloadConfig, e.g. one produced with json.Marshal from a newer UMAMatcher, on SIGHUP and at
+the given interval, then atomically swaps the matcher:
+
+	go umaManager.WatchConfig(ctx, uma.FileConfigSource("/etc/myapp/uma.json"), time.Minute)
+
+When resources or policies are changed in Keycloak, uma.KcEventListener drops stale resource ids and
+cached tokens. It polls the admin events API, which needs admin events enabled in the realm, or serves
+as a webhook for an event listener extension, which must sign its requests like uma.WebhookSink:
+
+	l := &uma.KcEventListener{Manager: umaManager, Provider: provider, ResourceStore: rs}
+	go l.Poll(ctx)
+	// or
+	l.Secret = []byte(os.Getenv("KC_EVENTS_SECRET"))
+	sm.Handle("/kc-events", l)
+
+Tokens of users who log out are rejected right away, rather than when they expire, if
+umaManager.BackChannelLogout() is served at the backchannel logout URL of the client:
+
+	sm.Handle("/backchannel-logout", umaManager.BackChannelLogout())
+
+With ManagerOptions.RPTRefresh, the middleware mints new RPTs for tokens that are about to expire, or
+that lack permission for the requested resource, and returns them in the X-Refreshed-RPT response
+header. Clients replace their token with it instead of going through the ticket flow again:
+
+	RPTRefresh: &uma.RPTRefresh{
+		Refresh: func(r *http.Request, rpt, resourceID string, scopes []string) (string, error) {
+			return kc.UpgradeRPT(rpt, "my-resource-server", resourceID, scopes...)
+		},
+		Before:  time.Minute,
+		Upgrade: true,
+	},
+
+When a ticket needs claims that only the user can give, the backend of a SPA can mount the handlers of
+rp.ClaimsRedirect. The SPA sends the user to /uma/claims?ticket=TICKET&return_to=/users/1, the user
+logs in with the authorization code flow protected by state and PKCE, and the RPT request is resumed
+with the ID token as claim_token:
+
+	cr := &rp.ClaimsRedirect{Client: kc, RedirectURI: "https://app.example.com/uma/callback"}
+	sm.Handle("/uma/claims", cr.RedirectHandler())
+	sm.Handle("/uma/callback", cr.CallbackHandler())
+
+Web apps that call UMA protected APIs on behalf of their users can log them in with
+rp.SessionMiddleware. It serves /login, /callback and /logout, keeps the tokens on the server, refreshes
+them before they expire, and gives them to handlers with rp.GetCredentials:
+
+	m := &rp.SessionMiddleware{Client: kc, RedirectURI: "https://app.example.com/callback", LoginRequired: true}
+	http.ListenAndServe(":8080", m.Handler(appMux))
+
+Services that can't reach the authorization server, e.g. at the edge or in air-gapped networks, can
+verify RPTs with a verification bundle. It holds the signing keys, the discovery document and the
+registered resources, and is exported with:
+
+	uma-codegen bundle --issuer $ISSUER --client-id $CLIENT_ID --client-secret $CLIENT_SECRET -o bundle.json
+
+Then loaded with:
+
+	bundle, err := uma.LoadVerificationBundle(f)
+	// in ManagerOptions
+	GetProvider: func(r *http.Request) uma.Provider { return uma.NewOfflineProvider(bundle) },
+	GetResourceStore: func(r *http.Request) uma.ResourceStore { return bundle.ResourceStore() },
+
+Offline, denied requests get an UMA challenge without ticket, and requests for resources missing from the
+bundle get 503.
+
+Services that normally reach the authorization server can survive its outages across restarts by saving
+the last good discovery document and keys to a MetadataStore, e.g. a directory on a persistent volume:
+
+	p, err := uma.NewKeycloakProvider(issuer, clientID, clientSecret, nil, logger,
+		uma.WithKeycloakMetadataStore(uma.FileMetadataStore{Dir: "/var/lib/uma"}),
+		uma.WithKeycloakDiscoveryRefresh(time.Hour),
+	)
+
+Several resource servers can share one client of the authorization server by setting
+ManagerOptions.Namespace, which prefixes the names of their resources with "<namespace>/". uma-syncd
+takes the same --namespace flag, and with --prune deletes resources of the namespace that are no longer
+in the manifest without touching the resources of other servers. Resources deleted on purpose, with
+Manager.DeleteResource or by pruning, can be tombstoned in a ResourceStore that implements
+ResourceTombstoneStore, so that replicas don't register them again until the tombstone expires.
+
+Replicas that share a ResourceStore may register the same resource at the same time. The stores of
+pkg/store/etcdstore and pkg/store/dynamostore write ids conditionally and return
+ErrStoredResourceConflict to the replica that loses, which then uses the stored id and deletes its own
+registration. Single-node deployments can use pkg/store/filestore, which keeps resources in a JSON
+file and behaves the same way. Entries are copied between stores, e.g. when moving from the file store
+to Redis, with:
+
+	uma-codegen store migrate --from file:///var/lib/uma/resources.json --to redis://redis:6379/0
+
+ManagerOptions.AuditSink receives an event whenever a resource is registered, a request is denied or a
+permission ticket is issued. uma.WebhookSink POSTs them as JSON to a SIEM or any other endpoint,
+retrying with backoff, and signs them with HMAC-SHA256 in the X-UMA-Signature header:
+
+	sink := uma.NewWebhookSink(uma.WebhookSinkOptions{URL: "https://siem.example.com/uma", Secret: secret})
+	defer sink.Close()
+	// in ManagerOptions
+	AuditSink: sink,
+
+ManagerOptions.DecisionRecorder receives a record of every decision: the request, the matched resource,
+the permissions of the token and the outcome. Keep the latest records in memory with uma.DecisionRing, or
+write them to a file with uma.DecisionLog. Replay them with a Manager that has the new templates or
+overrides to preview which requests a policy change would grant or deny:
+
+	records, err := uma.ReadDecisionLog(f)
+	for _, res := range preview.Replay(records) {
+		if res.Changed() {
+			fmt.Println(res.Record.Method, res.Record.URL, res.Granted)
+		}
+	}
+
+7. Troubleshoot
+
+uma-codegen also has commands to debug a running setup. whoami checks client credentials, prints the
+discovery document, decodes an RPT read from stdin and checks it against a resource:
+
+	echo $RPT | uma-codegen whoami --issuer $ISSUER --client-id $CLIENT_ID --client-secret $CLIENT_SECRET \
+	    --resource "User 1" --scope read
+
+ticket requests a permission ticket for a resource, and rpt exchanges a ticket for an RPT:
+
+	TICKET=$(uma-codegen ticket --issuer $ISSUER --client-id $CLIENT_ID --client-secret $CLIENT_SECRET \
+	    --resource "User 1" --scope read)
+	RPT=$(uma-codegen rpt --issuer $ISSUER --client-id $RP_CLIENT_ID --client-secret $RP_CLIENT_SECRET \
+	    --ticket $TICKET --username johnd --password $PASSWORD --raw)
+	curl -H "Authorization: Bearer $RPT" https://api.example.com/users/1
 */
 package uma
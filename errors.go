@@ -0,0 +1,158 @@
+package uma
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/pckhoi/uma/pkg/httputil"
+)
+
+// ErrDiscoveryFailed is returned when the UMA discovery document of an authorization server cannot be
+// retrieved. It wraps the underlying error.
+type ErrDiscoveryFailed struct {
+	Issuer string
+	Err    error
+}
+
+func (err ErrDiscoveryFailed) Error() string {
+	return fmt.Sprintf("discovery of %q failed: %v", err.Issuer, err.Err)
+}
+
+func (err ErrDiscoveryFailed) Unwrap() error {
+	return err.Err
+}
+
+// ErrResourceConflict is returned by CreateResource when a resource with the same name is already
+// registered. It wraps the underlying error.
+type ErrResourceConflict struct {
+	Name string
+	Err  error
+}
+
+func (err ErrResourceConflict) Error() string {
+	return fmt.Sprintf("resource %q already exists: %v", err.Name, err.Err)
+}
+
+func (err ErrResourceConflict) Unwrap() error {
+	return err.Err
+}
+
+// ErrStoredResourceConflict is returned by ResourceStore.Set of stores with conditional writes when
+// another id is already stored under the name, e.g. because another replica registered the same resource
+// concurrently. ID is the stored id, which the Manager uses instead of its own.
+type ErrStoredResourceConflict struct {
+	Name string
+	ID   string
+}
+
+func (err ErrStoredResourceConflict) Error() string {
+	return fmt.Sprintf("resource %q is already stored with id %q", err.Name, err.ID)
+}
+
+// ErrTicketRequestFailed is returned when the authorization server does not issue a permission
+// ticket. Status and Body are set if the authorization server responded with an error.
+type ErrTicketRequestFailed struct {
+	ResourceID string
+	Status     int
+	Body       string
+	Err        error
+}
+
+func (err ErrTicketRequestFailed) Error() string {
+	return fmt.Sprintf("permission ticket request for resource %q failed: %v", err.ResourceID, err.Err)
+}
+
+func (err ErrTicketRequestFailed) Unwrap() error {
+	return err.Err
+}
+
+func newErrTicketRequestFailed(resourceID string, err error) ErrTicketRequestFailed {
+	e := ErrTicketRequestFailed{ResourceID: resourceID, Err: err}
+	var respErr *httputil.ErrUnanticipatedResponse
+	if errors.As(err, &respErr) {
+		e.Status = respErr.Status
+		e.Body = respErr.Body
+	}
+	return e
+}
+
+// InvalidRPTReason tells why a requesting party token does not grant access
+type InvalidRPTReason string
+
+const (
+	// RPTExpired means the token is expired or not valid yet
+	RPTExpired InvalidRPTReason = "expired"
+
+	// RPTNoPermission means the token has no permission for the resource
+	RPTNoPermission InvalidRPTReason = "no permission"
+
+	// RPTMissingScope means the token has permission for the resource but not all required scopes
+	RPTMissingScope InvalidRPTReason = "missing scope"
+
+	// RPTResourceMismatch means the permission for the resource id names another resource, see
+	// ManagerOptions.VerifyPermissionNames
+	RPTResourceMismatch InvalidRPTReason = "resource mismatch"
+
+	// RPTUnnamedPermission means the permission for the resource has no name, see
+	// ManagerOptions.RequirePermissionNames
+	RPTUnnamedPermission InvalidRPTReason = "unnamed permission"
+)
+
+// ErrInvalidRPT is returned when a requesting party token does not grant access to a resource
+type ErrInvalidRPT struct {
+	Reason     InvalidRPTReason
+	ResourceID string
+
+	// Scope is the first missing scope if Reason is RPTMissingScope
+	Scope string
+
+	// Name is the resource named by the permission if Reason is RPTResourceMismatch
+	Name string
+}
+
+func (err ErrInvalidRPT) Error() string {
+	switch err.Reason {
+	case RPTNoPermission:
+		return fmt.Sprintf("invalid rpt: no permission for resource %q", err.ResourceID)
+	case RPTMissingScope:
+		return fmt.Sprintf("invalid rpt: missing scope %q for resource %q", err.Scope, err.ResourceID)
+	case RPTResourceMismatch:
+		return fmt.Sprintf("invalid rpt: permission for resource %q names resource %q", err.ResourceID, err.Name)
+	case RPTUnnamedPermission:
+		return fmt.Sprintf("invalid rpt: permission for resource %q has no name", err.ResourceID)
+	}
+	return fmt.Sprintf("invalid rpt: %s", err.Reason)
+}
+
+// ErrDisallowedAlgorithm is returned by VerifySignature when a token is signed with an algorithm that
+// the provider does not accept. The signature is not verified.
+type ErrDisallowedAlgorithm struct {
+	Alg     string
+	Allowed []string
+}
+
+func (err ErrDisallowedAlgorithm) Error() string {
+	return fmt.Sprintf("token signed with disallowed algorithm %q, allowed algorithms: %s", err.Alg, strings.Join(err.Allowed, ", "))
+}
+
+// ErrOffline is returned by OfflineProvider for operations that need the authorization server. Requests
+// whose resource can't be registered because of it get 503.
+type ErrOffline struct {
+	Op string
+}
+
+func (err ErrOffline) Error() string {
+	return fmt.Sprintf("%s is not possible offline", err.Op)
+}
+
+// ErrDevAccessDenied is returned by DevProvider.IssueRPT when the user is granted none of the requested
+// scopes
+type ErrDevAccessDenied struct {
+	Username   string
+	ResourceID string
+}
+
+func (err ErrDevAccessDenied) Error() string {
+	return fmt.Sprintf("user %q is granted no requested scope on resource %q", err.Username, err.ResourceID)
+}
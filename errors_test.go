@@ -0,0 +1,100 @@
+package uma_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/pckhoi/uma"
+	"github.com/pckhoi/uma/pkg/httputil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProviderErrors(t *testing.T) {
+	var issuer string
+	discoveryStatus := http.StatusInternalServerError
+	mux := http.NewServeMux()
+	writeJSON := func(w http.ResponseWriter, status int, obj any) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		require.NoError(t, json.NewEncoder(w).Encode(obj))
+	}
+	mux.HandleFunc("/.well-known/uma2-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, discoveryStatus, map[string]string{
+			"issuer":                         issuer,
+			"token_endpoint":                 issuer + "/token",
+			"resource_registration_endpoint": issuer + "/resource_set",
+			"permission_endpoint":            issuer + "/permission",
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]any{"access_token": "pat", "expires_in": 300})
+	})
+	mux.HandleFunc("/resource_set", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "conflict"})
+	})
+	mux.HandleFunc("/permission", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_resource_id"})
+	})
+	s := httptest.NewServer(mux)
+	defer s.Close()
+	issuer = s.URL
+
+	_, err := uma.NewBaseProvider(issuer, "client", "secret", nil, s.Client(), testr.New(t))
+	var discoveryErr uma.ErrDiscoveryFailed
+	require.ErrorAs(t, err, &discoveryErr)
+	assert.Equal(t, issuer, discoveryErr.Issuer)
+	var respErr *httputil.ErrUnanticipatedResponse
+	require.ErrorAs(t, err, &respErr)
+	assert.Equal(t, http.StatusInternalServerError, respErr.Status)
+
+	discoveryStatus = http.StatusOK
+	p, err := uma.NewBaseProvider(issuer, "client", "secret", nil, s.Client(), testr.New(t))
+	require.NoError(t, err)
+
+	_, err = p.CreateResource(&uma.Resource{Name: "User 1"})
+	var conflictErr uma.ErrResourceConflict
+	require.ErrorAs(t, err, &conflictErr)
+	assert.Equal(t, "User 1", conflictErr.Name)
+	require.ErrorAs(t, err, &respErr)
+	assert.Equal(t, http.StatusConflict, respErr.Status)
+
+	_, err = p.CreatePermissionTicket("rsc-1", "read")
+	var ticketErr uma.ErrTicketRequestFailed
+	require.ErrorAs(t, err, &ticketErr)
+	assert.Equal(t, "rsc-1", ticketErr.ResourceID)
+	assert.Equal(t, http.StatusBadRequest, ticketErr.Status)
+	assert.JSONEq(t, `{"error":"invalid_resource_id"}`, ticketErr.Body)
+}
+
+func TestClaimsValidate(t *testing.T) {
+	now := time.Now()
+	claims := &uma.Claims{
+		Iat: int(now.Add(-time.Minute).Unix()),
+		Exp: int(now.Add(time.Minute).Unix()),
+		Authorization: &uma.Authorization{Permissions: []uma.Permission{
+			{Rsid: "rsc-1", Scopes: []string{"read"}},
+		}},
+	}
+	assert.NoError(t, claims.Validate("rsc-1", false, []string{"read"}))
+	assert.Equal(t,
+		uma.ErrInvalidRPT{Reason: uma.RPTMissingScope, ResourceID: "rsc-1", Scope: "write"},
+		claims.Validate("rsc-1", false, []string{"read", "write"}),
+	)
+	assert.Equal(t,
+		uma.ErrInvalidRPT{Reason: uma.RPTNoPermission, ResourceID: "rsc-2"},
+		claims.Validate("rsc-2", false, []string{"read"}),
+	)
+
+	claims.Exp = int(now.Add(-time.Second).Unix())
+	err := claims.Validate("rsc-1", false, []string{"read"})
+	var rptErr uma.ErrInvalidRPT
+	require.True(t, errors.As(err, &rptErr))
+	assert.Equal(t, uma.RPTExpired, rptErr.Reason)
+	assert.NoError(t, claims.Validate("rsc-1", true, []string{"read"}))
+}
@@ -0,0 +1,11 @@
+package uma
+
+import "net/http"
+
+// DefaultProviderClient exposes defaultProviderClient to tests
+var DefaultProviderClient = defaultProviderClient
+
+// HTTPClient returns the http client of p
+func (p *KeycloakProvider) HTTPClient() *http.Client {
+	return p._client
+}
@@ -0,0 +1,455 @@
+package uma
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/go-logr/logr"
+	"github.com/pckhoi/uma/pkg/httputil"
+)
+
+// DefaultFGAObjectType is the type of the FGA objects that resources are registered as, unless
+// FGAOptions.ObjectTypes maps their resource type to another
+const DefaultFGAObjectType = "resource"
+
+// FGAOptions configures NewFGAProvider
+type FGAOptions struct {
+	// APIURL is the URL of the OpenFGA server, e.g. "https://api.us1.fga.dev" for Auth0 FGA. It is required.
+	APIURL string
+
+	// StoreID is the id of the FGA store. It is required.
+	StoreID string
+
+	// AuthorizationModelID pins checks and writes to a model. Defaults to the latest model of the store.
+	AuthorizationModelID string
+
+	// APIToken is the preshared key sent to OpenFGA. Leave it empty to obtain tokens with client
+	// credentials instead, as Auth0 FGA requires.
+	APIToken string
+
+	// TokenURL, ClientID, ClientSecret and Audience obtain tokens for the FGA API with client
+	// credentials, e.g. "https://fga.us.auth0.com/oauth/token" and "https://api.us1.fga.dev/" for Auth0 FGA.
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	Audience     string
+
+	// Issuer is the issuer of the access tokens sent by clients, whose keys are discovered from its
+	// OpenID configuration unless KeySet is given. It is also the as_uri of challenges. It is required.
+	Issuer string
+
+	// KeySet verifies access tokens. Defaults to the keys of Issuer.
+	KeySet KeySet
+
+	// Realm is the realm of challenges. Defaults to the last path segment of Issuer.
+	Realm string
+
+	// ObjectTypes maps resource types to FGA object types, e.g. "https://www.example.com/rsrcs/users" to
+	// "user_profile". Resources of other types are registered as DefaultFGAObjectType.
+	ObjectTypes map[string]string
+
+	// Relations maps scopes to the FGA relations that are checked for them, e.g. "read" to "viewer".
+	// Scopes that are not mapped are checked as relations of the same name.
+	Relations map[string]string
+
+	// User returns the FGA user of a token. Defaults to "user:" followed by the sub claim.
+	User func(rpt *RPT) string
+
+	// OwnerRelation is the relation written between the owner and a resource that is registered with an
+	// owner, see ManagerOptions.OwnerFromRequest. Defaults to "owner".
+	OwnerRelation string
+
+	// Client sends requests to the FGA API, the token endpoint and the issuer. Defaults to the client shared
+	// by all providers.
+	Client *http.Client
+
+	// RequestEditors modify every request sent by Client, e.g. to add tracing headers, see
+	// WithRequestEditor
+	RequestEditors []httputil.RequestEditor
+}
+
+// FGAProvider bridges the Manager to OpenFGA or Auth0 FGA, so that paths are enforced like with an UMA
+// authorization server while decisions come from the FGA Check API. Clients send ordinary access tokens
+// of FGAOptions.Issuer instead of RPTs. A request is granted if the FGA user of the token has, for each
+// required scope, the relation mapped from the scope on the FGA object of the resource.
+//
+// Resources are registered as FGA objects whose id is the type followed by the escaped resource name,
+// e.g. "resource:User%201". Objects exist in FGA once tuples refer to them, so registration only writes
+// the owner tuple of resources with an owner, and resource ids can be computed without FGA.
+//
+// Denied requests get an UMA challenge whose ticket is not redeemable, since there is no UMA
+// authorization server, but tells the client as base64url encoded JSON which object and relations the
+// request needs, e.g. to ask the owner for access.
+type FGAProvider struct {
+	opts      FGAOptions
+	client    *httputil.Client
+	keySet    KeySet
+	discovery UMADiscovery
+	logger    logr.Logger
+}
+
+// NewFGAProvider creates a provider that answers permission checks with FGA. Unless opts.KeySet is given,
+// the keys of opts.Issuer are discovered.
+func NewFGAProvider(opts FGAOptions, logger logr.Logger) (*FGAProvider, error) {
+	if opts.APIURL == "" || opts.StoreID == "" || opts.Issuer == "" {
+		return nil, errors.New("fga api url, store id and issuer are required")
+	}
+	if opts.Client == nil {
+		opts.Client = defaultProviderClient()
+	}
+	if opts.OwnerRelation == "" {
+		opts.OwnerRelation = "owner"
+	}
+	if opts.Realm == "" {
+		path := strings.Split(opts.Issuer, "/")
+		opts.Realm = path[len(path)-1]
+	}
+	opts.APIURL = strings.TrimSuffix(opts.APIURL, "/")
+	logger = logger.WithValues(
+		"issuer", opts.Issuer,
+		"fga_store_id", opts.StoreID,
+	)
+	p := &FGAProvider{
+		opts:      opts,
+		keySet:    opts.KeySet,
+		discovery: UMADiscovery{Issuer: opts.Issuer},
+		logger:    logger,
+	}
+	p.client = &httputil.Client{
+		Client:         opts.Client,
+		Authenticator:  p,
+		Logger:         logger,
+		UserAgent:      httputil.UserAgent(""),
+		RequestEditors: opts.RequestEditors,
+	}
+	if p.keySet == nil {
+		resp, err := p.client.Get(strings.TrimSuffix(opts.Issuer, "/") + "/.well-known/openid-configuration")
+		if err != nil {
+			return nil, ErrDiscoveryFailed{Issuer: opts.Issuer, Err: err}
+		}
+		if err := p.client.DecodeJSONResponse(resp, &p.discovery); err != nil {
+			return nil, ErrDiscoveryFailed{Issuer: opts.Issuer, Err: err}
+		}
+		if p.discovery.JwksURI == "" {
+			return nil, ErrDiscoveryFailed{Issuer: opts.Issuer, Err: errors.New("jwks_uri not found in discovery document")}
+		}
+		p.keySet = oidc.NewRemoteKeySet(oidc.ClientContext(context.Background(), opts.Client), p.discovery.JwksURI)
+	}
+	return p, nil
+}
+
+// fgaTupleKey is a relationship tuple of FGA
+type fgaTupleKey struct {
+	User     string `json:"user,omitempty"`
+	Relation string `json:"relation,omitempty"`
+	Object   string `json:"object"`
+}
+
+func (p *FGAProvider) storeURL(suffix string) string {
+	return p.opts.APIURL + "/stores/" + url.PathEscape(p.opts.StoreID) + suffix
+}
+
+// ObjectID returns the id of the FGA object that rsc is registered as, which is also its resource id
+func (p *FGAProvider) ObjectID(rsc *Resource) string {
+	typ := p.opts.ObjectTypes[rsc.Type]
+	if typ == "" {
+		typ = DefaultFGAObjectType
+	}
+	return typ + ":" + url.PathEscape(rsc.Name)
+}
+
+// relation returns the relation that is checked for scope
+func (p *FGAProvider) relation(scope string) string {
+	if rel, ok := p.opts.Relations[scope]; ok {
+		return rel
+	}
+	return scope
+}
+
+func (p *FGAProvider) user(rpt *RPT) string {
+	if p.opts.User != nil {
+		return p.opts.User(rpt)
+	}
+	return "user:" + rpt.Sub
+}
+
+func (p *FGAProvider) VerifySignature(ctx context.Context, jwt string) ([]byte, error) {
+	return p.keySet.VerifySignature(ctx, jwt)
+}
+
+// Authenticate returns the preshared key, or obtains a token for the FGA API with client credentials
+func (p *FGAProvider) Authenticate(client *http.Client) (*httputil.ClientCreds, error) {
+	if p.opts.APIToken != "" || p.opts.TokenURL == "" {
+		return &httputil.ClientCreds{AccessToken: p.opts.APIToken, TokenType: "Bearer"}, nil
+	}
+	p.logger.Info("authenticating client")
+	form := map[string][]string{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {p.opts.ClientID},
+		"client_secret": {p.opts.ClientSecret},
+	}
+	if p.opts.Audience != "" {
+		form["audience"] = []string{p.opts.Audience}
+	}
+	resp, err := p.client.PostFormUrlencoded(p.opts.TokenURL, nil, form)
+	if err != nil {
+		return nil, err
+	}
+	creds := &httputil.ClientCreds{}
+	if err = p.client.DecodeJSONResponse(resp, creds); err != nil {
+		return nil, err
+	}
+	return creds, nil
+}
+
+// ProtectionAPIToken returns the token sent to the FGA API
+func (p *FGAProvider) ProtectionAPIToken(ctx context.Context) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	return p.client.AccessToken()
+}
+
+// ProtectionRequest sends a request to the FGA API URL followed by endpointSuffix, e.g.
+// "/stores/{id}/expand"
+func (p *FGAProvider) ProtectionRequest(ctx context.Context, method, endpointSuffix string, body interface{}) (*http.Response, error) {
+	if !strings.HasPrefix(endpointSuffix, "/") {
+		endpointSuffix = "/" + endpointSuffix
+	}
+	var (
+		req *http.Request
+		err error
+	)
+	if body != nil {
+		req, err = httputil.JSONRequest(method, p.opts.APIURL+endpointSuffix, body)
+	} else {
+		req, err = http.NewRequest(method, p.opts.APIURL+endpointSuffix, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	return p.client.DoRequest(req.WithContext(ctx))
+}
+
+// write writes and deletes tuples. Writing a tuple that already exists is not an error.
+func (p *FGAProvider) write(writes, deletes []fgaTupleKey) error {
+	payload := map[string]interface{}{}
+	if len(writes) > 0 {
+		payload["writes"] = map[string]interface{}{"tuple_keys": writes}
+	}
+	if len(deletes) > 0 {
+		payload["deletes"] = map[string]interface{}{"tuple_keys": deletes}
+	}
+	if len(payload) == 0 {
+		return nil
+	}
+	if p.opts.AuthorizationModelID != "" {
+		payload["authorization_model_id"] = p.opts.AuthorizationModelID
+	}
+	err := p.client.CreateObject(p.storeURL("/write"), payload, &map[string]interface{}{})
+	var respErr *httputil.ErrUnanticipatedResponse
+	if errors.As(err, &respErr) && respErr.Status == http.StatusBadRequest &&
+		len(deletes) == 0 && strings.Contains(respErr.Body, "already exist") {
+		return nil
+	}
+	return err
+}
+
+// read returns all tuples that match key
+func (p *FGAProvider) read(key fgaTupleKey) ([]fgaTupleKey, error) {
+	tuples := []fgaTupleKey{}
+	token := ""
+	for {
+		payload := map[string]interface{}{"tuple_key": key}
+		if token != "" {
+			payload["continuation_token"] = token
+		}
+		resp := struct {
+			Tuples []struct {
+				Key fgaTupleKey `json:"key"`
+			} `json:"tuples"`
+			ContinuationToken string `json:"continuation_token"`
+		}{}
+		if err := p.client.CreateObject(p.storeURL("/read"), payload, &resp); err != nil {
+			return nil, err
+		}
+		for _, t := range resp.Tuples {
+			tuples = append(tuples, t.Key)
+		}
+		if resp.ContinuationToken == "" {
+			return tuples, nil
+		}
+		token = resp.ContinuationToken
+	}
+}
+
+// CreateResource registers the resource as an FGA object, writing the owner tuple if the resource has an
+// owner
+func (p *FGAProvider) CreateResource(request *Resource) (*ExpandedResource, error) {
+	id := p.ObjectID(request)
+	if request.Owner != "" {
+		if err := p.write([]fgaTupleKey{{User: "user:" + request.Owner, Relation: p.opts.OwnerRelation, Object: id}}, nil); err != nil {
+			return nil, err
+		}
+	}
+	return &ExpandedResource{
+		ID:   id,
+		Name: request.Name,
+		Type: request.Type,
+	}, nil
+}
+
+// GetResource returns the resource with the name found in the object id
+func (p *FGAProvider) GetResource(id string) (*ExpandedResource, error) {
+	_, escaped, ok := strings.Cut(id, ":")
+	if !ok {
+		return nil, fmt.Errorf("invalid fga object %q", id)
+	}
+	name, err := url.PathUnescape(escaped)
+	if err != nil {
+		return nil, fmt.Errorf("invalid fga object %q: %w", id, err)
+	}
+	return &ExpandedResource{ID: id, Name: name}, nil
+}
+
+// UpdateResource does nothing since FGA objects only have an id
+func (p *FGAProvider) UpdateResource(id string, resource *Resource) error {
+	return nil
+}
+
+// DeleteResource deletes all tuples of the object
+func (p *FGAProvider) DeleteResource(id string) error {
+	tuples, err := p.read(fgaTupleKey{Object: id})
+	if err != nil {
+		return err
+	}
+	for len(tuples) > 0 {
+		// FGA limits the number of tuples per write
+		n := len(tuples)
+		if n > 100 {
+			n = 100
+		}
+		if err := p.write(nil, tuples[:n]); err != nil {
+			return err
+		}
+		tuples = tuples[n:]
+	}
+	return nil
+}
+
+// ListResources lists the objects of the object types of the provider that tuples refer to. Like
+// Keycloak, it filters resources by the name query parameter, which matches exactly if exactName is true.
+func (p *FGAProvider) ListResources(urlQuery url.Values) ([]string, error) {
+	name := urlQuery.Get("name")
+	exact := urlQuery.Get("exactName") == "true"
+	types := map[string]struct{}{DefaultFGAObjectType: {}}
+	for _, typ := range p.opts.ObjectTypes {
+		types[typ] = struct{}{}
+	}
+	ids := []string{}
+	seen := map[string]struct{}{}
+	for typ := range types {
+		tuples, err := p.read(fgaTupleKey{Object: typ + ":"})
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range tuples {
+			if _, ok := seen[t.Object]; ok {
+				continue
+			}
+			seen[t.Object] = struct{}{}
+			rsc, err := p.GetResource(t.Object)
+			if err != nil {
+				continue
+			}
+			if name != "" && !(exact && rsc.Name == name || !exact && strings.Contains(rsc.Name, name)) {
+				continue
+			}
+			ids = append(ids, t.Object)
+		}
+	}
+	return ids, nil
+}
+
+// fgaTicket is the content of the tickets of FGAProvider
+type fgaTicket struct {
+	Object    string   `json:"object"`
+	Relations []string `json:"relations,omitempty"`
+}
+
+// CreatePermissionTicket returns a ticket that tells which object and relations the request needs
+func (p *FGAProvider) CreatePermissionTicket(resourceID string, scopes ...string) (string, error) {
+	t := fgaTicket{Object: resourceID}
+	for _, s := range scopes {
+		t.Relations = append(t.Relations, p.relation(s))
+	}
+	b, err := json.Marshal(t)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func (p *FGAProvider) WWWAuthenticateDirectives() WWWAuthenticateDirectives {
+	return WWWAuthenticateDirectives{
+		Realm: p.opts.Realm,
+		AsUri: p.opts.Issuer,
+	}
+}
+
+// Discovery returns the OpenID configuration of the issuer, or only the issuer if FGAOptions.KeySet is
+// given
+func (p *FGAProvider) Discovery() UMADiscovery {
+	return p.discovery
+}
+
+// CheckPermission asks the FGA Check API whether the user of rpt has the relation of each scope on the
+// object of rsc
+func (p *FGAProvider) CheckPermission(ctx context.Context, rpt *RPT, rsc Resource, scopes []string) error {
+	user := p.user(rpt)
+	missing, granted := "", false
+	for _, s := range scopes {
+		payload := map[string]interface{}{
+			"tuple_key": fgaTupleKey{User: user, Relation: p.relation(s), Object: rsc.ID},
+		}
+		if p.opts.AuthorizationModelID != "" {
+			payload["authorization_model_id"] = p.opts.AuthorizationModelID
+		}
+		req, err := httputil.JSONRequest(http.MethodPost, p.storeURL("/check"), payload)
+		if err != nil {
+			return err
+		}
+		resp, err := p.client.DoRequest(req.WithContext(ctx))
+		if err != nil {
+			return err
+		}
+		result := struct {
+			Allowed bool `json:"allowed"`
+		}{}
+		if err := p.client.DecodeJSONResponse(resp, &result); err != nil {
+			return fmt.Errorf("error checking fga relation %q: %w", p.relation(s), err)
+		}
+		if !result.Allowed {
+			if missing == "" {
+				missing = s
+			}
+			continue
+		}
+		granted = true
+	}
+	switch {
+	case missing == "":
+		return nil
+	case !granted:
+		return ErrInvalidRPT{Reason: RPTNoPermission, ResourceID: rsc.ID}
+	}
+	return ErrInvalidRPT{Reason: RPTMissingScope, ResourceID: rsc.ID, Scope: missing}
+}
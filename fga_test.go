@@ -0,0 +1,192 @@
+package uma_test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/pckhoi/uma"
+	"github.com/pckhoi/uma/pkg/httputil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type tupleKey struct {
+	User     string `json:"user,omitempty"`
+	Relation string `json:"relation,omitempty"`
+	Object   string `json:"object"`
+}
+
+// fakeFGA serves the check, read and write endpoints of store-1 from a set of tuples
+type fakeFGA struct {
+	mu     sync.Mutex
+	tuples map[tupleKey]bool
+	down   bool
+	// traces are the X-Trace headers of requests, set by FGAOptions.RequestEditors
+	traces []string
+}
+
+func (f *fakeFGA) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.traces = append(f.traces, r.Header.Get("X-Trace"))
+	if f.down || r.Header.Get("Authorization") != "Bearer preshared" {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	var req struct {
+		TupleKey tupleKey `json:"tuple_key"`
+		Writes   struct {
+			TupleKeys []tupleKey `json:"tuple_keys"`
+		} `json:"writes"`
+		Deletes struct {
+			TupleKeys []tupleKey `json:"tuple_keys"`
+		} `json:"deletes"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	switch r.URL.Path {
+	case "/stores/store-1/check":
+		json.NewEncoder(w).Encode(map[string]bool{"allowed": f.tuples[req.TupleKey]})
+	case "/stores/store-1/write":
+		for _, t := range req.Writes.TupleKeys {
+			if f.tuples[t] {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"code":"write_failed_due_to_invalid_input","message":"cannot write a tuple which already exists"}`))
+				return
+			}
+			f.tuples[t] = true
+		}
+		for _, t := range req.Deletes.TupleKeys {
+			delete(f.tuples, t)
+		}
+		w.Write([]byte(`{}`))
+	case "/stores/store-1/read":
+		tuples := []map[string]tupleKey{}
+		for t := range f.tuples {
+			if req.TupleKey.Object == t.Object || strings.HasSuffix(req.TupleKey.Object, ":") && strings.HasPrefix(t.Object, req.TupleKey.Object) {
+				tuples = append(tuples, map[string]tupleKey{"key": t})
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"tuples": tuples})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newFGAProvider(t *testing.T, fga *fakeFGA) *uma.FGAProvider {
+	t.Helper()
+	s := httptest.NewServer(fga)
+	t.Cleanup(s.Close)
+	p, err := uma.NewFGAProvider(uma.FGAOptions{
+		APIURL:    s.URL,
+		StoreID:   "store-1",
+		APIToken:  "preshared",
+		Issuer:    "https://idp.example.com/realms/demo",
+		KeySet:    newMockProvider(map[string]string{"alice": `{"sub":"alice"}`, "bob": `{"sub":"bob"}`}),
+		Relations: map[string]string{"read": "viewer", "write": "editor"},
+		Client:    s.Client(),
+		RequestEditors: []httputil.RequestEditor{func(req *http.Request) {
+			req.Header.Set("X-Trace", "trace-1")
+		}},
+	}, testr.New(t))
+	require.NoError(t, err)
+	return p
+}
+
+func TestFGAProvider(t *testing.T) {
+	fga := &fakeFGA{tuples: map[tupleKey]bool{
+		{User: "user:alice", Relation: "viewer", Object: "resource:User%201"}: true,
+	}}
+	p := newFGAProvider(t, fga)
+	h := newMockManager(t, p, uma.ManagerOptions{}).
+		Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "resource:User%201", uma.GetResource(r).ID)
+		}))
+
+	rec := serve(h, http.MethodGet, "https://api.example.com/users/1", "alice")
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = serve(h, http.MethodGet, "https://api.example.com/users/1", "bob")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = serve(h, http.MethodPut, "https://api.example.com/users/1", "alice")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	challenge := rec.Header().Get("WWW-Authenticate")
+	assert.Contains(t, challenge, `UMA realm="demo", as_uri="https://idp.example.com/realms/demo", ticket="`)
+	ticket := strings.TrimSuffix(strings.SplitN(challenge, `ticket="`, 2)[1], `"`)
+	b, err := base64.RawURLEncoding.DecodeString(ticket)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"object":"resource:User%201"}`, string(b))
+
+	rec = serve(h, http.MethodGet, "https://api.example.com/users/1", "unknown")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	fga.mu.Lock()
+	fga.down = true
+	assert.NotEmpty(t, fga.traces)
+	for _, trace := range fga.traces {
+		assert.Equal(t, "trace-1", trace)
+	}
+	fga.mu.Unlock()
+	rec = serve(h, http.MethodGet, "https://api.example.com/users/1", "alice")
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+}
+
+func TestFGAProviderResources(t *testing.T) {
+	fga := &fakeFGA{tuples: map[tupleKey]bool{}}
+	p := newFGAProvider(t, fga)
+
+	rsc, err := p.CreateResource(&uma.Resource{Name: "User 1", Owner: "alice"})
+	require.NoError(t, err)
+	assert.Equal(t, "resource:User%201", rsc.ID)
+	assert.True(t, fga.tuples[tupleKey{User: "user:alice", Relation: "owner", Object: "resource:User%201"}])
+
+	// registering again is not an error
+	_, err = p.CreateResource(&uma.Resource{Name: "User 1", Owner: "alice"})
+	require.NoError(t, err)
+	_, err = p.CreateResource(&uma.Resource{Name: "User 2", Owner: "bob"})
+	require.NoError(t, err)
+
+	got, err := p.GetResource("resource:User%201")
+	require.NoError(t, err)
+	assert.Equal(t, "User 1", got.Name)
+
+	ids, err := p.ListResources(map[string][]string{"name": {"User 1"}, "exactName": {"true"}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"resource:User%201"}, ids)
+	ids, err = p.ListResources(nil)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"resource:User%201", "resource:User%202"}, ids)
+
+	require.NoError(t, p.DeleteResource("resource:User%201"))
+	assert.Len(t, fga.tuples, 1)
+}
+
+func TestFGACheckPermission(t *testing.T) {
+	fga := &fakeFGA{tuples: map[tupleKey]bool{
+		{User: "user:alice", Relation: "viewer", Object: "resource:User%201"}: true,
+	}}
+	p := newFGAProvider(t, fga)
+	rpt := &uma.RPT{Claims: uma.Claims{Sub: "alice"}}
+	rsc := uma.Resource{ID: "resource:User%201", Name: "User 1"}
+
+	assert.NoError(t, p.CheckPermission(context.Background(), rpt, rsc, []string{"read"}))
+	assert.Equal(t,
+		uma.ErrInvalidRPT{Reason: uma.RPTMissingScope, ResourceID: rsc.ID, Scope: "write"},
+		p.CheckPermission(context.Background(), rpt, rsc, []string{"read", "write"}),
+	)
+	assert.Equal(t,
+		uma.ErrInvalidRPT{Reason: uma.RPTNoPermission, ResourceID: rsc.ID},
+		p.CheckPermission(context.Background(), &uma.RPT{Claims: uma.Claims{Sub: "bob"}}, rsc, []string{"read"}),
+	)
+}
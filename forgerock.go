@@ -0,0 +1,148 @@
+package uma
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/go-logr/logr"
+	"github.com/pckhoi/uma/pkg/httputil"
+)
+
+// ForgeRockProtectionScope is the scope that AM requires protection API tokens to have
+const ForgeRockProtectionScope = "uma_protection"
+
+// ForgeRockProvider is a Provider for ForgeRock Access Management (AM) realms, e.g. with issuer
+// "https://am.example.com/am/oauth2/realms/root/realms/alpha". AM implements the standard UMA 2.0
+// endpoints that BaseProvider handles, with these differences:
+//
+//   - protection API tokens are requested with the uma_protection scope, and resources belong to the user
+//     the token is issued to, see WithForgeRockResourceOwner
+//   - resources are registered with plain scope names and without Keycloak only fields such as owner,
+//     ownerManagedAccess, uri and displayName
+//   - the resource registration endpoint has no name filter, which the Manager copes with by fetching
+//     candidates
+//   - permission requests can't push claims, so claims given to CreatePermissionTicketWithClaims are
+//     dropped
+//
+// AM puts permissions in the permissions claim of RPTs, with resource_id and resource_scopes members
+// that Permission understands, so Managers need ManagerOptions.PermissionClaimPath set to
+// ForgeRockPermissionClaimPath.
+type ForgeRockProvider struct {
+	*BaseProvider
+	_client      *http.Client
+	username     string
+	password     string
+	providerOpts []BaseProviderOption
+}
+
+// ForgeRockPermissionClaimPath is the ManagerOptions.PermissionClaimPath of RPTs issued by AM
+var ForgeRockPermissionClaimPath = []string{"permissions"}
+
+type ForgeRockOption func(p *ForgeRockProvider)
+
+// WithForgeRockClient directs ForgeRockProvider to use a custom http client. By default, all providers
+// share one client created with default ProviderClientOptions.
+func WithForgeRockClient(client *http.Client) ForgeRockOption {
+	return func(p *ForgeRockProvider) {
+		p._client = client
+	}
+}
+
+// WithForgeRockResourceOwner obtains protection API tokens with the resource owner password credentials
+// grant, so that resources are registered on behalf of that user, who can then share them in the AM user
+// interface. Without this option, tokens are obtained with client credentials and resources belong to the
+// client.
+func WithForgeRockResourceOwner(username, password string) ForgeRockOption {
+	return func(p *ForgeRockProvider) {
+		p.username = username
+		p.password = password
+	}
+}
+
+// WithForgeRockProviderOptions applies options of BaseProvider, e.g. WithSigningAlgorithms,
+// WithUserAgent, WithRequestEditor, WithRetryOptions or WithMetadataStore
+func WithForgeRockProviderOptions(opts ...BaseProviderOption) ForgeRockOption {
+	return func(p *ForgeRockProvider) {
+		p.providerOpts = append(p.providerOpts, opts...)
+	}
+}
+
+// NewForgeRockProvider discovers the UMA endpoints of the AM realm with the given issuer. If keySet is
+// nil, keys are fetched from the jwks_uri of the discovery document.
+func NewForgeRockProvider(issuer, clientID, clientSecret string, keySet KeySet, logger logr.Logger, opts ...ForgeRockOption) (*ForgeRockProvider, error) {
+	p := &ForgeRockProvider{
+		_client: defaultProviderClient(),
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	logger = logger.WithValues(
+		"issuer", issuer,
+		"client_id", clientID,
+	)
+	p.BaseProvider = newBaseProvider(issuer, clientID, clientSecret, keySet, &httputil.Client{
+		Client:        p._client,
+		Authenticator: p,
+		Logger:        logger,
+		UserAgent:     httputil.UserAgent(""),
+	}, logger)
+	for _, opt := range p.providerOpts {
+		opt(p.BaseProvider)
+	}
+	if err := p.discover(); err != nil {
+		return nil, err
+	}
+	if keySet == nil {
+		p.BaseProvider.keySet = p.remoteKeySet(p._client)
+	}
+	return p, nil
+}
+
+// Authenticate obtains a protection API token with the uma_protection scope
+func (p *ForgeRockProvider) Authenticate(client *http.Client) (*httputil.ClientCreds, error) {
+	p.logger.Info("authenticating client")
+	form := map[string][]string{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {p.clientID},
+		"client_secret": {p.clientSecret},
+		"scope":         {ForgeRockProtectionScope},
+	}
+	if p.username != "" {
+		form["grant_type"] = []string{"password"}
+		form["username"] = []string{p.username}
+		form["password"] = []string{p.password}
+	}
+	resp, err := p.client.PostFormUrlencoded(p.Discovery().TokenEndpoint, nil, form)
+	if err != nil {
+		return nil, err
+	}
+	creds := &httputil.ClientCreds{}
+	if err = p.client.DecodeJSONResponse(resp, creds); err != nil {
+		return nil, err
+	}
+	return creds, nil
+}
+
+func (p *ForgeRockProvider) CreateResource(request *Resource) (response *ExpandedResource, err error) {
+	response = &ExpandedResource{}
+	if err = p.client.CreateObject(p.Discovery().ResourceRegistrationEndpoint, newSpecResource(request), response); err != nil {
+		if isConflict(err) {
+			return nil, ErrResourceConflict{Name: request.Name, Err: err}
+		}
+		return nil, err
+	}
+	return response, nil
+}
+
+func (p *ForgeRockProvider) UpdateResource(id string, resource *Resource) (err error) {
+	return p.client.UpdateObject(fmt.Sprintf("%s/%s", p.Discovery().ResourceRegistrationEndpoint, id), newSpecResource(resource))
+}
+
+// CreatePermissionTicketWithClaims creates a permission ticket without claims, since AM doesn't accept
+// pushed claims
+func (p *ForgeRockProvider) CreatePermissionTicketWithClaims(resourceID string, claims map[string][]string, scopes ...string) (string, error) {
+	if len(claims) > 0 {
+		p.logger.Info("dropping claims pushed to ForgeRock AM", "resource_id", resourceID)
+	}
+	return p.BaseProvider.CreatePermissionTicketWithClaims(resourceID, nil, scopes...)
+}
@@ -0,0 +1,143 @@
+package uma_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/pckhoi/uma"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newFakeForgeRock(t *testing.T, grantType string) *httptest.Server {
+	t.Helper()
+	var issuer string
+	mux := http.NewServeMux()
+	writeJSON := func(w http.ResponseWriter, status int, obj any) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		require.NoError(t, json.NewEncoder(w).Encode(obj))
+	}
+	mux.HandleFunc("/.well-known/uma2-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{
+			"issuer":                         issuer,
+			"token_endpoint":                 issuer + "/access_token",
+			"resource_registration_endpoint": issuer + "/resource_set",
+			"permission_endpoint":            issuer + "/uma/permission_request",
+		})
+	})
+	mux.HandleFunc("/access_token", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, grantType, r.PostForm.Get("grant_type"))
+		assert.Equal(t, "uma_protection", r.PostForm.Get("scope"))
+		if grantType == "password" {
+			assert.Equal(t, "alice", r.PostForm.Get("username"))
+			assert.Equal(t, "changeit", r.PostForm.Get("password"))
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"access_token": "pat", "expires_in": 300})
+	})
+	mux.HandleFunc("/resource_set", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer pat", r.Header.Get("Authorization"))
+		obj := map[string]any{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&obj))
+		assert.Equal(t, map[string]any{
+			"name":            "User 1",
+			"type":            "https://www.example.com/rsrcs/users",
+			"resource_scopes": []any{"read", "write"},
+		}, obj)
+		if r.Method == http.MethodPost {
+			writeJSON(w, http.StatusCreated, map[string]any{
+				"_id":                    "rsc-1",
+				"user_access_policy_uri": issuer + "/XUI/?realm=/alpha#uma/share/rsc-1",
+			})
+		}
+	})
+	mux.HandleFunc("/resource_set/rsc-1", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut {
+			obj := map[string]any{}
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&obj))
+			assert.Equal(t, []any{"read"}, obj["resource_scopes"])
+			assert.NotContains(t, obj, "uri")
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"_id":             "rsc-1",
+			"name":            "User 1",
+			"resource_scopes": []string{"read", "write"},
+		})
+	})
+	mux.HandleFunc("/uma/permission_request", func(w http.ResponseWriter, r *http.Request) {
+		obj := []map[string]any{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&obj))
+		assert.Equal(t, []map[string]any{{"resource_id": "rsc-1", "resource_scopes": []any{"read"}}}, obj)
+		writeJSON(w, http.StatusCreated, map[string]string{"ticket": "ticket-1"})
+	})
+	s := httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	issuer = s.URL
+	return s
+}
+
+func TestForgeRockProvider(t *testing.T) {
+	s := newFakeForgeRock(t, "client_credentials")
+	p, err := uma.NewForgeRockProvider(s.URL, "api", "secret", nil, testr.New(t), uma.WithForgeRockClient(s.Client()))
+	require.NoError(t, err)
+
+	resp, err := p.CreateResource(&uma.Resource{
+		ResourceType: uma.ResourceType{
+			Type:           "https://www.example.com/rsrcs/users",
+			ResourceScopes: []string{"read", "write"},
+			DisplayName:    "Users",
+			ScopeDescriptions: map[string]uma.ScopeDescription{
+				"read": {DisplayName: "Read"},
+			},
+		},
+		Name:               "User 1",
+		URI:                "https://api.example.com/users/1",
+		OwnerManagedAccess: true,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "rsc-1", resp.ID)
+
+	rsc, err := p.GetResource("rsc-1")
+	require.NoError(t, err)
+	assert.Equal(t, "User 1", rsc.Name)
+	assert.Equal(t, []uma.Scope{{Name: "read"}, {Name: "write"}}, rsc.ResourceScopes)
+
+	require.NoError(t, p.UpdateResource("rsc-1", &uma.Resource{
+		ResourceType: uma.ResourceType{ResourceScopes: []string{"read"}},
+		Name:         "User 1",
+		URI:          "https://api.example.com/users/1",
+	}))
+
+	ticket, err := p.CreatePermissionTicketWithClaims("rsc-1", map[string][]string{"ip": {"10.0.0.1"}}, "read")
+	require.NoError(t, err)
+	assert.Equal(t, "ticket-1", ticket)
+}
+
+func TestForgeRockResourceOwner(t *testing.T) {
+	s := newFakeForgeRock(t, "password")
+	p, err := uma.NewForgeRockProvider(s.URL, "api", "secret", nil, testr.New(t),
+		uma.WithForgeRockClient(s.Client()),
+		uma.WithForgeRockResourceOwner("alice", "changeit"),
+	)
+	require.NoError(t, err)
+	creds, err := p.Authenticate(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "pat", creds.AccessToken)
+}
+
+func TestForgeRockPermissions(t *testing.T) {
+	rpt, err := uma.ParseRPT([]byte(`{
+		"sub": "bob",
+		"permissions": [{"resource_id": "rsc-1", "resource_scopes": ["read"], "exp": 1700000000}]
+	}`))
+	require.NoError(t, err)
+	require.NoError(t, rpt.ReadPermissions(uma.ForgeRockPermissionClaimPath...))
+	assert.Equal(t, []uma.Permission{{Rsid: "rsc-1", Scopes: []string{"read"}}}, rpt.Permissions())
+	assert.True(t, rpt.HasScopes("rsc-1", "read"))
+}
@@ -0,0 +1,74 @@
+package uma
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// forwardedRequest reconstructs the original request from headers set by reverse proxies that
+// implement the forward-auth contract (Traefik ForwardAuth, Caddy forward_auth, nginx auth_request).
+func forwardedRequest(r *http.Request) (*http.Request, bool) {
+	method := r.Header.Get("X-Forwarded-Method")
+	uri := r.Header.Get("X-Forwarded-Uri")
+	if method == "" || uri == "" {
+		return nil, false
+	}
+	u, err := url.ParseRequestURI(uri)
+	if err != nil {
+		return nil, false
+	}
+	u.Scheme = r.Header.Get("X-Forwarded-Proto")
+	if u.Scheme == "" {
+		u.Scheme = "http"
+	}
+	u.Host = r.Header.Get("X-Forwarded-Host")
+	if u.Host == "" {
+		u.Host = r.Host
+	}
+	fr := r.Clone(r.Context())
+	fr.Method = strings.ToUpper(method)
+	fr.URL = u
+	fr.Host = u.Host
+	fr.RequestURI = u.RequestURI()
+	fr.Body = http.NoBody
+	fr.ContentLength = 0
+	return fr, true
+}
+
+// ForwardAuthHandler returns an http handler implementing the forward-auth contract, so reverse
+// proxies can delegate UMA decisions to it. The original request is read from X-Forwarded-Method,
+// X-Forwarded-Proto, X-Forwarded-Host and X-Forwarded-Uri headers. If access is granted, it
+// responds with 200 and the following headers, which can be copied to the upstream request:
+//   - X-Uma-Resource-Id: id of the matched resource
+//   - X-Uma-Scopes: space separated list of required scopes
+//   - X-Uma-Subject: subject of the requesting party token
+//
+// Otherwise it responds with the usual 401 response and UMA ticket. If CORSAllowedOrigins is set,
+// forwarded preflight requests are granted, and responses carry CORS headers for the original
+// request's origin.
+func (m *Manager) ForwardAuthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fr, ok := forwardedRequest(r)
+		if !ok {
+			m.logger.Info("forward-auth request is missing forwarded headers",
+				"method", r.Method,
+				"path", r.URL.Path,
+			)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if rsc := GetResource(r); rsc != nil {
+				w.Header().Set("X-Uma-Resource-Id", rsc.ID)
+			}
+			if scopes := GetScopes(r); len(scopes) > 0 {
+				w.Header().Set("X-Uma-Scopes", strings.Join(scopes, " "))
+			}
+			if claims := GetClaims(r); claims != nil {
+				w.Header().Set("X-Uma-Subject", claims.Sub)
+			}
+			w.WriteHeader(http.StatusOK)
+		})).ServeHTTP(w, fr)
+	})
+}
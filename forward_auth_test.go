@@ -0,0 +1,74 @@
+package uma_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/pckhoi/uma"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestForwardAuthHandler(t *testing.T) {
+	man := uma.New(
+		uma.ManagerOptions{
+			GetBaseURL: func(r *http.Request) url.URL {
+				return url.URL{Scheme: "https", Host: "api.example.com", Path: "/users"}
+			},
+			CustomEnforce: func(r *http.Request, resource uma.Resource, scopes []string) bool {
+				return r.Header.Get("Authorization") == "Bearer good"
+			},
+		},
+		map[string]uma.ResourceType{
+			"user": {Type: "user", ResourceScopes: []string{"read"}},
+		},
+		[]string{"oidc"},
+		nil,
+		[]map[string][]string{{"oidc": {"read"}}},
+		[]uma.Path{
+			uma.NewPath("/{id}", uma.NewResourceTemplate("user", "User {id}"), map[string]uma.Operation{
+				http.MethodGet: {},
+			}),
+		},
+		testr.New(t),
+	)
+	h := man.ForwardAuthHandler()
+
+	for _, c := range []struct {
+		headers map[string]string
+		status  int
+	}{
+		{map[string]string{}, http.StatusBadRequest},
+		{map[string]string{
+			"X-Forwarded-Method": "GET",
+			"X-Forwarded-Proto":  "https",
+			"X-Forwarded-Host":   "api.example.com",
+			"X-Forwarded-Uri":    "/users/1",
+			"Authorization":      "Bearer good",
+		}, http.StatusOK},
+		{map[string]string{
+			"X-Forwarded-Method": "GET",
+			"X-Forwarded-Proto":  "https",
+			"X-Forwarded-Host":   "api.example.com",
+			"X-Forwarded-Uri":    "/users/1",
+		}, http.StatusUnauthorized},
+		{map[string]string{
+			"X-Forwarded-Method": "GET",
+			"X-Forwarded-Host":   "api.example.com",
+			"X-Forwarded-Uri":    "/other",
+		}, http.StatusOK},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "http://sidecar/auth", nil)
+		for k, v := range c.headers {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		assert.Equal(t, c.status, rec.Code, "headers: %v", c.headers)
+		if c.status == http.StatusOK && c.headers["X-Forwarded-Uri"] == "/users/1" {
+			assert.Equal(t, "read", rec.Header().Get("X-Uma-Scopes"))
+		}
+	}
+}
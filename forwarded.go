@@ -0,0 +1,146 @@
+package uma
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// BaseURLFromForwardedHeaders returns a function that can be used as ManagerOptions.GetBaseURL. It
+// derives the scheme and host of the base url from the Forwarded header (RFC 7239), or from
+// X-Forwarded-Proto and X-Forwarded-Host headers if Forwarded is absent. Headers are only trusted if
+// the request comes directly from one of trustedProxies, which are IP addresses or CIDR ranges e.g.
+// "10.0.0.0/8", and only the values added by the trusted proxy closest to the client are used, since
+// clients can send these headers too. Otherwise, the scheme depends on whether the connection uses TLS and the host is
+// r.Host. The returned url has an empty path. It panics if a trusted proxy can't be parsed.
+func BaseURLFromForwardedHeaders(trustedProxies []string) func(r *http.Request) url.URL {
+	nets := make([]*net.IPNet, 0, len(trustedProxies))
+	for _, s := range trustedProxies {
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				panic(fmt.Sprintf("uma: invalid trusted proxy %q", s))
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 8 * net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			panic(fmt.Sprintf("uma: invalid trusted proxy %q: %v", s, err))
+		}
+		nets = append(nets, n)
+	}
+	trustedIP := func(ip net.IP) bool {
+		for _, n := range nets {
+			if n.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+	return func(r *http.Request) url.URL {
+		u := url.URL{Scheme: "http", Host: r.Host}
+		if r.TLS != nil {
+			u.Scheme = "https"
+		}
+		if !trustedIP(parseForwardedIP(r.RemoteAddr)) {
+			return u
+		}
+		proto, host := forwardedProtoHost(r.Header, trustedIP)
+		if proto == "http" || proto == "https" {
+			u.Scheme = proto
+		}
+		if validForwardedHost(host) {
+			u.Host = host
+		}
+		return u
+	}
+}
+
+// parseForwardedIP parses the address of a Forwarded "for" parameter or of X-Forwarded-For, with or
+// without port. It returns nil for obfuscated identifiers such as "unknown" or "_hidden".
+func parseForwardedIP(s string) net.IP {
+	s = strings.Trim(strings.TrimSpace(s), `"`)
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	return net.ParseIP(strings.TrimSuffix(strings.TrimPrefix(s, "["), "]"))
+}
+
+// splitForwardedList splits the comma separated values of all occurrences of a header
+func splitForwardedList(h http.Header, key string) []string {
+	var vals []string
+	for _, line := range h.Values(key) {
+		for _, v := range strings.Split(line, ",") {
+			vals = append(vals, strings.TrimSpace(v))
+		}
+	}
+	return vals
+}
+
+// forwardedHop returns the index of the hop added by the first trusted proxy, i.e. the one closest to
+// the client. Each proxy appends a hop recording the address of its peer, so hops are walked from the
+// right for as long as the peer is itself a trusted proxy. Hops further left are controlled by the
+// client.
+func forwardedHop(peers []string, trusted func(net.IP) bool) int {
+	i := len(peers) - 1
+	for i > 0 {
+		ip := parseForwardedIP(peers[i])
+		if ip == nil || !trusted(ip) {
+			break
+		}
+		i--
+	}
+	return i
+}
+
+// forwardedProtoHost returns proto and host added by the trusted proxy closest to the client
+func forwardedProtoHost(h http.Header, trusted func(net.IP) bool) (proto, host string) {
+	if elems := splitForwardedList(h, "Forwarded"); len(elems) > 0 {
+		params := make([]map[string]string, len(elems))
+		peers := make([]string, len(elems))
+		for i, elem := range elems {
+			params[i] = map[string]string{}
+			for _, pair := range strings.Split(elem, ";") {
+				k, v, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if !ok {
+					continue
+				}
+				params[i][strings.ToLower(k)] = strings.Trim(v, `"`)
+			}
+			peers[i] = params[i]["for"]
+		}
+		p := params[forwardedHop(peers, trusted)]
+		return strings.ToLower(p["proto"]), p["host"]
+	}
+	protos := splitForwardedList(h, "X-Forwarded-Proto")
+	hosts := splitForwardedList(h, "X-Forwarded-Host")
+	// X-Forwarded-Proto and X-Forwarded-Host line up with X-Forwarded-For if every proxy appends to
+	// them, otherwise only the last values, set by the closest proxy, can be trusted
+	peers := splitForwardedList(h, "X-Forwarded-For")
+	at := func(vals []string) string {
+		if len(vals) == 0 {
+			return ""
+		}
+		if len(vals) == len(peers) {
+			return vals[forwardedHop(peers, trusted)]
+		}
+		return vals[len(vals)-1]
+	}
+	return strings.ToLower(at(protos)), at(hosts)
+}
+
+func validForwardedHost(host string) bool {
+	if host == "" {
+		return false
+	}
+	u, err := url.Parse("http://" + host)
+	return err == nil && u.Host == host && u.User == nil
+}
@@ -0,0 +1,83 @@
+package uma_test
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pckhoi/uma"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBaseURLFromForwardedHeaders(t *testing.T) {
+	getBaseURL := uma.BaseURLFromForwardedHeaders([]string{"10.0.0.0/8", "192.168.1.1", "::1"})
+
+	for _, c := range []struct {
+		name       string
+		remoteAddr string
+		tls        bool
+		headers    map[string]string
+		url        string
+	}{
+		{"direct request", "203.0.113.1:1234", false, nil, "http://internal:8080"},
+		{"direct tls request", "203.0.113.1:1234", true, nil, "https://internal:8080"},
+		{"untrusted proxy", "203.0.113.1:1234", false, map[string]string{
+			"X-Forwarded-Proto": "https",
+			"X-Forwarded-Host":  "api.example.com",
+		}, "http://internal:8080"},
+		{"x-forwarded headers", "10.1.2.3:1234", false, map[string]string{
+			"X-Forwarded-Proto": "https",
+			"X-Forwarded-Host":  "api.example.com",
+		}, "https://api.example.com"},
+		{"x-forwarded headers with several proxies", "192.168.1.1:1234", false, map[string]string{
+			"X-Forwarded-For":   "198.51.100.1, 10.0.0.1",
+			"X-Forwarded-Proto": "HTTPS, http",
+			"X-Forwarded-Host":  "api.example.com, lb.internal",
+		}, "https://api.example.com"},
+		{"x-forwarded headers sent by the client", "10.1.2.3:1234", false, map[string]string{
+			"X-Forwarded-For":   "10.0.0.1, 198.51.100.1",
+			"X-Forwarded-Proto": "http, https",
+			"X-Forwarded-Host":  "evil.example.com, api.example.com",
+		}, "https://api.example.com"},
+		{"x-forwarded headers without x-forwarded-for", "10.1.2.3:1234", false, map[string]string{
+			"X-Forwarded-Proto": "http, https",
+			"X-Forwarded-Host":  "evil.example.com, api.example.com",
+		}, "https://api.example.com"},
+		{"forwarded header sent by the client", "10.1.2.3:1234", false, map[string]string{
+			"Forwarded": `for=10.0.0.9;proto=http;host=evil.example.com, for="198.51.100.1:4711";proto=https;host=api.example.com`,
+		}, "https://api.example.com"},
+		{"forwarded header without for", "10.1.2.3:1234", false, map[string]string{
+			"Forwarded": `proto=http;host=evil.example.com, proto=https;host=api.example.com`,
+		}, "https://api.example.com"},
+		{"forwarded header with obfuscated for", "10.1.2.3:1234", false, map[string]string{
+			"Forwarded": `for=10.0.0.9;host=evil.example.com, for=_hidden;proto=https;host=api.example.com, for="[::1]";host=lb.internal`,
+		}, "https://api.example.com"},
+		{"forwarded header takes precedence", "[::1]:1234", false, map[string]string{
+			"Forwarded":         `for=198.51.100.1;proto=https;host="api.example.com:8443", for=10.0.0.1;proto=http`,
+			"X-Forwarded-Proto": "http",
+			"X-Forwarded-Host":  "other.example.com",
+		}, "https://api.example.com:8443"},
+		{"invalid values are ignored", "10.1.2.3:1234", false, map[string]string{
+			"X-Forwarded-Proto": "javascript",
+			"X-Forwarded-Host":  "evil.com/path",
+		}, "http://internal:8080"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "http://internal:8080/users/1", nil)
+			r.RemoteAddr = c.remoteAddr
+			if c.tls {
+				r.TLS = &tls.ConnectionState{}
+			}
+			for k, v := range c.headers {
+				r.Header.Set(k, v)
+			}
+			u := getBaseURL(r)
+			assert.Equal(t, c.url, u.String())
+		})
+	}
+
+	assert.Panics(t, func() {
+		uma.BaseURLFromForwardedHeaders([]string{"not-an-ip"})
+	})
+}
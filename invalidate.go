@@ -0,0 +1,46 @@
+package uma
+
+// ResourceCacheDeleter is implemented by ResourceCache implementations that can delete entries, which
+// lets Manager.InvalidateResource remove stale resource ids
+type ResourceCacheDeleter interface {
+	Delete(key string) error
+}
+
+// ResourceStoreDeleter is implemented by ResourceStore implementations that can delete resource ids,
+// which lets Manager.InvalidateResource remove stale resource ids
+type ResourceStoreDeleter interface {
+	Delete(name string) error
+}
+
+// resourceCacheKey returns the ResourceCache key of resource name registered with p
+func resourceCacheKey(p Provider, name string) string {
+	// providers may share resource names, hence the issuer is part of the key
+	return p.WWWAuthenticateDirectives().AsUri + " " + name
+}
+
+// InvalidateResource forgets the id of the resource registered with p under name, e.g. after the resource
+// is deleted from the authorization server, so that it is looked up or registered again on the next
+// request. The id is deleted from the ResourceCache and from rs if they implement ResourceCacheDeleter
+// and ResourceStoreDeleter respectively. rs can be nil.
+func (m *Manager) InvalidateResource(p Provider, rs ResourceStore, name string) error {
+	if d, ok := m.resourceCache.(ResourceCacheDeleter); ok {
+		if err := d.Delete(resourceCacheKey(p, name)); err != nil {
+			return err
+		}
+	}
+	if d, ok := rs.(ResourceStoreDeleter); ok {
+		if err := d.Delete(m.storeKey(p, name)); err != nil {
+			return err
+		}
+	}
+	m.logger.Info("invalidated resource", "name", name)
+	return nil
+}
+
+// PurgeTokenCache removes all memoized token verification results, so that tokens are verified again
+// by their provider
+func (m *Manager) PurgeTokenCache() {
+	if m.tokenCache != nil {
+		m.tokenCache.lru.Purge("")
+	}
+}
@@ -0,0 +1,188 @@
+package uma
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/go-logr/logr"
+	"github.com/pckhoi/uma/pkg/httputil"
+)
+
+// JanssenProtectionScope is the scope that Janssen and Gluu require protection API tokens to have
+const JanssenProtectionScope = "uma_protection"
+
+// JanssenProvider is a Provider for Janssen and Gluu servers. It requests protection API tokens with the
+// uma_protection scope and client_secret_basic authentication, and registers resources with plain scope
+// names. Clients can be provisioned on the fly with a software statement assertion (SSA), see
+// WithJanssenSoftwareStatement.
+//
+// Janssen RPTs are opaque unless the server is configured to issue them as JWT, in which case the
+// permissions are in the permissions claim, so Managers need ManagerOptions.PermissionClaimPath set to
+// []string{"permissions"}.
+type JanssenProvider struct {
+	*BaseProvider
+	_client      *http.Client
+	ssa          string
+	metadata     ClientMetadata
+	registration *ClientRegistration
+	providerOpts []BaseProviderOption
+}
+
+type JanssenOption func(p *JanssenProvider)
+
+// WithJanssenClient directs JanssenProvider to use a custom http client. By default, all providers share
+// one client created with default ProviderClientOptions.
+func WithJanssenClient(client *http.Client) JanssenOption {
+	return func(p *JanssenProvider) {
+		p._client = client
+	}
+}
+
+// WithJanssenSoftwareStatement registers a new client with ssa, a software statement assertion issued by
+// the server, when the provider is created. The client id and secret given to NewJanssenProvider are
+// ignored, those of the new client are used instead, see JanssenProvider.Registration. metadata describes
+// the client. Its grant types default to client_credentials, its scope to uma_protection and its token
+// endpoint auth method to client_secret_basic.
+func WithJanssenSoftwareStatement(ssa string, metadata ClientMetadata) JanssenOption {
+	return func(p *JanssenProvider) {
+		p.ssa = ssa
+		p.metadata = metadata
+	}
+}
+
+// WithJanssenProviderOptions applies options of BaseProvider, e.g. WithSigningAlgorithms,
+// WithUserAgent, WithRequestEditor, WithRetryOptions or WithMetadataStore
+func WithJanssenProviderOptions(opts ...BaseProviderOption) JanssenOption {
+	return func(p *JanssenProvider) {
+		p.providerOpts = append(p.providerOpts, opts...)
+	}
+}
+
+// NewJanssenProvider discovers the UMA endpoints of the server with the given issuer, and registers a
+// client if WithJanssenSoftwareStatement is given. If keySet is nil, keys are fetched from the jwks_uri of
+// the discovery document.
+func NewJanssenProvider(issuer, clientID, clientSecret string, keySet KeySet, logger logr.Logger, opts ...JanssenOption) (*JanssenProvider, error) {
+	p := &JanssenProvider{
+		_client: defaultProviderClient(),
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	logger = logger.WithValues("issuer", issuer)
+	if p.ssa == "" {
+		logger = logger.WithValues("client_id", clientID)
+	}
+	p.BaseProvider = newBaseProvider(issuer, clientID, clientSecret, keySet, &httputil.Client{
+		Client:        p._client,
+		Authenticator: p,
+		Logger:        logger,
+		UserAgent:     httputil.UserAgent(""),
+	}, logger)
+	for _, opt := range p.providerOpts {
+		opt(p.BaseProvider)
+	}
+	if err := p.discover(); err != nil {
+		return nil, err
+	}
+	if p.ssa != "" {
+		if err := p.register(); err != nil {
+			return nil, err
+		}
+	}
+	if keySet == nil {
+		p.BaseProvider.keySet = p.remoteKeySet(p._client)
+	}
+	return p, nil
+}
+
+// registrationEndpoint returns the registration endpoint of the UMA discovery document, or that of the
+// OpenID discovery document since Janssen only lists it there
+func (p *JanssenProvider) registrationEndpoint() (string, error) {
+	if uri := p.Discovery().RegistrationEndpoint; uri != "" {
+		return uri, nil
+	}
+	resp, err := p.client.Get(p.issuer + "/.well-known/openid-configuration")
+	if err != nil {
+		return "", ErrDiscoveryFailed{Issuer: p.issuer, Err: err}
+	}
+	doc := &UMADiscovery{}
+	if err := p.client.DecodeJSONResponse(resp, doc); err != nil {
+		return "", ErrDiscoveryFailed{Issuer: p.issuer, Err: err}
+	}
+	return doc.RegistrationEndpoint, nil
+}
+
+// register registers a client with the software statement and uses its credentials from then on
+func (p *JanssenProvider) register() error {
+	endpoint, err := p.registrationEndpoint()
+	if err != nil {
+		return err
+	}
+	metadata := p.metadata
+	metadata.SoftwareStatement = p.ssa
+	if metadata.GrantTypes == nil {
+		metadata.GrantTypes = []string{"client_credentials"}
+	}
+	if metadata.Scope == "" {
+		metadata.Scope = JanssenProtectionScope
+	}
+	if metadata.TokenEndpointAuthMethod == "" {
+		metadata.TokenEndpointAuthMethod = "client_secret_basic"
+	}
+	reg, err := registerClient(context.Background(), p.client, endpoint, metadata)
+	if err != nil {
+		return err
+	}
+	p.registration = reg
+	p.clientID = reg.ClientID
+	p.clientSecret = reg.ClientSecret
+	p.logger = p.logger.WithValues("client_id", reg.ClientID)
+	p.client.Logger = p.logger
+	p.logger.Info("registered client with software statement")
+	return nil
+}
+
+// Registration returns the client registered with WithJanssenSoftwareStatement, or nil. Applications
+// that restart often can save it and give its credentials to NewJanssenProvider instead of registering a
+// new client each time.
+func (p *JanssenProvider) Registration() *ClientRegistration {
+	return p.registration
+}
+
+func (p *JanssenProvider) Credentials() (issuer, clientID, clientSecret string) {
+	return p.issuer, p.clientID, p.clientSecret
+}
+
+// Authenticate obtains a protection API token with the uma_protection scope
+func (p *JanssenProvider) Authenticate(client *http.Client) (*httputil.ClientCreds, error) {
+	p.logger.Info("authenticating client")
+	resp, err := p.client.PostFormUrlencoded(p.Discovery().TokenEndpoint, func(r *http.Request) {
+		r.SetBasicAuth(p.clientID, p.clientSecret)
+	}, map[string][]string{
+		"grant_type": {"client_credentials"},
+		"scope":      {JanssenProtectionScope},
+	})
+	if err != nil {
+		return nil, err
+	}
+	creds := &httputil.ClientCreds{}
+	if err = p.client.DecodeJSONResponse(resp, creds); err != nil {
+		return nil, err
+	}
+	return creds, nil
+}
+
+func (p *JanssenProvider) CreateResource(request *Resource) (response *ExpandedResource, err error) {
+	response = &ExpandedResource{}
+	if err = p.client.CreateObject(p.Discovery().ResourceRegistrationEndpoint, newSpecResource(request), response); err != nil {
+		if isConflict(err) {
+			return nil, ErrResourceConflict{Name: request.Name, Err: err}
+		}
+		return nil, err
+	}
+	return response, nil
+}
+
+func (p *JanssenProvider) UpdateResource(id string, resource *Resource) (err error) {
+	return p.client.UpdateObject(p.Discovery().ResourceRegistrationEndpoint+"/"+id, newSpecResource(resource))
+}
@@ -0,0 +1,107 @@
+package uma_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/pckhoi/uma"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newFakeJanssen(t *testing.T, clientID, clientSecret string) *httptest.Server {
+	t.Helper()
+	var issuer string
+	mux := http.NewServeMux()
+	writeJSON := func(w http.ResponseWriter, status int, obj any) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		require.NoError(t, json.NewEncoder(w).Encode(obj))
+	}
+	mux.HandleFunc("/.well-known/uma2-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{
+			"issuer":                         issuer,
+			"token_endpoint":                 issuer + "/jans-auth/restv1/token",
+			"resource_registration_endpoint": issuer + "/jans-auth/restv1/host/rsrc/resource_set",
+		})
+	})
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{
+			"issuer":                issuer,
+			"registration_endpoint": issuer + "/jans-auth/restv1/register",
+		})
+	})
+	mux.HandleFunc("/jans-auth/restv1/register", func(w http.ResponseWriter, r *http.Request) {
+		assert.Empty(t, r.Header.Get("Authorization"))
+		obj := map[string]any{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&obj))
+		assert.Equal(t, map[string]any{
+			"client_name":                "billing-api",
+			"grant_types":                []any{"client_credentials"},
+			"scope":                      "uma_protection",
+			"token_endpoint_auth_method": "client_secret_basic",
+			"software_statement":         "ssa-jwt",
+		}, obj)
+		writeJSON(w, http.StatusCreated, map[string]any{
+			"client_id":                clientID,
+			"client_secret":            clientSecret,
+			"client_secret_expires_at": 0,
+		})
+	})
+	mux.HandleFunc("/jans-auth/restv1/token", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		id, secret, ok := r.BasicAuth()
+		assert.True(t, ok)
+		assert.Equal(t, clientID, id)
+		assert.Equal(t, clientSecret, secret)
+		assert.Equal(t, "client_credentials", r.PostForm.Get("grant_type"))
+		assert.Equal(t, "uma_protection", r.PostForm.Get("scope"))
+		writeJSON(w, http.StatusOK, map[string]any{"access_token": "pat", "expires_in": 300})
+	})
+	mux.HandleFunc("/jans-auth/restv1/host/rsrc/resource_set", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer pat", r.Header.Get("Authorization"))
+		obj := map[string]any{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&obj))
+		assert.Equal(t, map[string]any{"name": "User 1", "resource_scopes": []any{"read"}}, obj)
+		writeJSON(w, http.StatusCreated, map[string]string{"_id": "rsc-1"})
+	})
+	s := httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	issuer = s.URL
+	return s
+}
+
+func TestJanssenSoftwareStatement(t *testing.T) {
+	s := newFakeJanssen(t, "registered", "registered-secret")
+	p, err := uma.NewJanssenProvider(s.URL, "", "", nil, testr.New(t),
+		uma.WithJanssenClient(s.Client()),
+		uma.WithJanssenSoftwareStatement("ssa-jwt", uma.ClientMetadata{ClientName: "billing-api"}),
+	)
+	require.NoError(t, err)
+	require.NotNil(t, p.Registration())
+	assert.Equal(t, "registered", p.Registration().ClientID)
+	_, clientID, clientSecret := p.Credentials()
+	assert.Equal(t, "registered", clientID)
+	assert.Equal(t, "registered-secret", clientSecret)
+
+	rsc, err := p.CreateResource(&uma.Resource{
+		ResourceType: uma.ResourceType{ResourceScopes: []string{"read"}, DisplayName: "User"},
+		Name:         "User 1",
+		URI:          "https://api.example.com/users/1",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "rsc-1", rsc.ID)
+}
+
+func TestJanssenProvider(t *testing.T) {
+	s := newFakeJanssen(t, "api", "secret")
+	p, err := uma.NewJanssenProvider(s.URL, "api", "secret", nil, testr.New(t), uma.WithJanssenClient(s.Client()))
+	require.NoError(t, err)
+	assert.Nil(t, p.Registration())
+	creds, err := p.Authenticate(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "pat", creds.AccessToken)
+}
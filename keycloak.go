@@ -4,28 +4,66 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/go-logr/logr"
+	"github.com/pckhoi/uma/pkg/clock"
 	"github.com/pckhoi/uma/pkg/httputil"
+	"github.com/pckhoi/uma/pkg/keycloak"
 )
 
+// KeycloakProvider is a Provider for Keycloak realms, which adds Keycloak specific APIs such as policies,
+// permissions and resource server settings to BaseProvider.
+//
+// Its methods are safe for concurrent use, as are those of BaseProvider. The protection API token is
+// shared by all methods and renewed by one goroutine at a time, the admin token likewise. The discovery
+// document is replaced as a whole by discovery refresh, so readers of Discovery always see a consistent
+// document. The Keycloak version is looked up once. Other state is set by NewKeycloakProvider and not
+// modified afterwards, except ClientID, which should not be changed once the provider is in use.
 type KeycloakProvider struct {
-	*baseProvider
-	ownerManagedAccess bool
-	ClientID           string
-	_client            *http.Client
+	*BaseProvider
+	ownerManagedAccess       bool
+	ClientID                 string
+	_client                  *http.Client
+	discoveryRefreshInterval time.Duration
+	stopRefresh              chan struct{}
+	closeOnce                sync.Once
+	requestEditors           []httputil.RequestEditor
+	userAgent                string
+	decodeOptions            httputil.DecodeOptions
+	retry                    httputil.RetryOptions
+	signingAlgs              []string
+	clock                    clock.Clock
+	metadataStore            MetadataStore
+	adminCreds               *keycloak.AdminCredentials
+	adminClient              *httputil.Client
+	versionStr               string
+	versionMu                sync.Mutex
+	version                  *KcVersion
 }
 
 type KeycloakOption func(kp *KeycloakProvider)
 
-// WithKeycloakClient directs KeycloakProvider to use a custom http client
+// WithKeycloakClient directs KeycloakProvider to use a custom http client. By default, all providers
+// share one client created with default ProviderClientOptions. Give each provider its own client to reach
+// realms through different proxies or with different TLS client certificates. If NewKeycloakProvider is
+// given no KeySet, keys are fetched with this client too.
 func WithKeycloakClient(client *http.Client) KeycloakOption {
 	return func(kp *KeycloakProvider) {
 		kp._client = client
 	}
 }
 
+// WithKeycloakClientOptions directs KeycloakProvider to use a new http client tuned with opts
+func WithKeycloakClientOptions(opts ProviderClientOptions) KeycloakOption {
+	return func(kp *KeycloakProvider) {
+		kp._client = NewProviderClient(opts)
+	}
+}
+
 // WithKeycloakOwnerManagedAccess sets ownerManagedAccess for each resource to true
 // during resource creation
 func WithKeycloakOwnerManagedAccess() KeycloakOption {
@@ -34,47 +72,200 @@ func WithKeycloakOwnerManagedAccess() KeycloakOption {
 	}
 }
 
+// WithKeycloakDiscoveryRefresh directs KeycloakProvider to re-discover endpoints at the given
+// interval, so long-running servers pick up endpoint changes
+func WithKeycloakDiscoveryRefresh(interval time.Duration) KeycloakOption {
+	return func(kp *KeycloakProvider) {
+		kp.discoveryRefreshInterval = interval
+	}
+}
+
+// WithKeycloakRequestEditor adds a function that modifies every request sent to Keycloak, e.g.
+// to add X-Forwarded-Host or tracing headers. It can be given multiple times. Requests sent by
+// the KeySet are not affected.
+func WithKeycloakRequestEditor(editor func(req *http.Request)) KeycloakOption {
+	return func(kp *KeycloakProvider) {
+		kp.requestEditors = append(kp.requestEditors, editor)
+	}
+}
+
+// WithKeycloakUserAgent identifies the app in the User-Agent header of requests to Keycloak, e.g.
+// "billing-api/1.4.2", along with this library. comments such as build metadata e.g. "commit=abc123"
+// are added in parentheses. Without this option, only this library is identified.
+func WithKeycloakUserAgent(app string, comments ...string) KeycloakOption {
+	return func(kp *KeycloakProvider) {
+		kp.userAgent = httputil.UserAgent(app, comments...)
+	}
+}
+
+// WithKeycloakDecodeOptions controls how responses from Keycloak are decoded, e.g. to lower the
+// maximum body size or reject unknown fields. By default, bodies larger than httputil.DefaultMaxBodySize
+// are rejected.
+func WithKeycloakDecodeOptions(opts httputil.DecodeOptions) KeycloakOption {
+	return func(kp *KeycloakProvider) {
+		kp.decodeOptions = opts
+	}
+}
+
+// WithKeycloakRetryOptions retries requests to Keycloak, including admin API requests, that fail with
+// network errors or retryable statuses. Requests are not retried by default.
+func WithKeycloakRetryOptions(opts httputil.RetryOptions) KeycloakOption {
+	return func(kp *KeycloakProvider) {
+		kp.retry = opts
+	}
+}
+
+// WithKeycloakSigningAlgorithms sets the JOSE algorithms that tokens can be signed with. It should
+// match the signature algorithm of the realm keys, e.g. ES256 or EdDSA. Defaults to
+// DefaultSigningAlgorithms.
+func WithKeycloakSigningAlgorithms(algs ...string) KeycloakOption {
+	return func(kp *KeycloakProvider) {
+		kp.signingAlgs = algs
+	}
+}
+
+// WithKeycloakClock sets the clock that tells when the protection API token expires. Defaults to the
+// system clock.
+func WithKeycloakClock(c clock.Clock) KeycloakOption {
+	return func(kp *KeycloakProvider) {
+		kp.clock = c
+	}
+}
+
+// WithKeycloakMetadataStore saves the discovery document and the JWKS of the realm to store, so that the
+// provider can start and verify tokens while Keycloak is down. See WithMetadataStore. Together with
+// WithKeycloakDiscoveryRefresh, keys are also refreshed at the discovery refresh interval.
+func WithKeycloakMetadataStore(store MetadataStore) KeycloakOption {
+	return func(kp *KeycloakProvider) {
+		kp.metadataStore = store
+	}
+}
+
+// WithKeycloakAdminCredentials makes KeycloakProvider call the admin API, e.g. in
+// GetResourceServerSettings, with admin tokens obtained with creds instead of the protection API
+// token. Admin tokens are obtained and renewed independently of the protection API token. If
+// creds.ServerURL is empty, it is derived from the issuer.
+func WithKeycloakAdminCredentials(creds keycloak.AdminCredentials) KeycloakOption {
+	return func(kp *KeycloakProvider) {
+		kp.adminCreds = &creds
+	}
+}
+
+// WithKeycloakVersion tells which release of Keycloak the provider talks to, e.g. "24", "21.1.2" or
+// "17.0.1-legacy", so that endpoints that differ between releases are selected without asking the
+// server, see KeycloakProvider.Version. Admin credentials without ContextPath get the context path of
+// the release, e.g. "/auth" before Keycloak 17.
+func WithKeycloakVersion(version string) KeycloakOption {
+	return func(kp *KeycloakProvider) {
+		kp.versionStr = version
+	}
+}
+
 func NewKeycloakProvider(issuer, clientID, clientSecret string, keySet KeySet, logger logr.Logger, opts ...KeycloakOption) (p *KeycloakProvider, err error) {
 	p = &KeycloakProvider{
-		_client:  http.DefaultClient,
-		ClientID: clientID,
+		_client:   defaultProviderClient(),
+		ClientID:  clientID,
+		userAgent: httputil.UserAgent(""),
 	}
 	for _, opt := range opts {
 		opt(p)
 	}
+	if p.versionStr != "" {
+		v, err := ParseKcVersion(p.versionStr)
+		if err != nil {
+			return nil, err
+		}
+		p.version = &v
+	}
 	logger = logger.WithValues(
 		"issuer", issuer,
 		"client_id", clientID,
 	)
-	p.baseProvider = newBaseProvider(issuer, clientID, clientSecret, keySet, &httputil.Client{
-		Client:        p._client,
-		Authenticator: p,
-		Logger:        logger,
+	p.BaseProvider = newBaseProvider(issuer, clientID, clientSecret, keySet, &httputil.Client{
+		Client:         p._client,
+		Authenticator:  p,
+		Logger:         logger,
+		UserAgent:      p.userAgent,
+		RequestEditors: p.requestEditors,
+		DecodeOptions:  p.decodeOptions,
+		Clock:          p.clock,
+		Retry:          p.retry,
 	}, logger)
+	if p.signingAlgs != nil {
+		p.BaseProvider.signingAlgs = p.signingAlgs
+	}
+	p.BaseProvider.metadataStore = p.metadataStore
+	if p.adminCreds != nil {
+		if p.adminCreds.ServerURL == "" {
+			// the context path, if any, is part of the issuer
+			if i := strings.LastIndex(issuer, "/realms/"); i >= 0 {
+				p.adminCreds.ServerURL = issuer[:i]
+			}
+		} else if p.adminCreds.ContextPath == "" && p.version != nil {
+			p.adminCreds.ContextPath = p.version.ContextPath()
+		}
+		if p.adminCreds.UserAgent == "" {
+			p.adminCreds.UserAgent = p.userAgent
+		}
+		p.adminClient = &httputil.Client{
+			Client:         p._client,
+			Authenticator:  *p.adminCreds,
+			Logger:         logger.WithValues("admin", true),
+			UserAgent:      p.userAgent,
+			RequestEditors: p.requestEditors,
+			DecodeOptions:  p.decodeOptions,
+			Clock:          p.clock,
+			Retry:          p.retry,
+		}
+	}
 	if err := p.discover(); err != nil {
 		return nil, err
 	}
+	if keySet == nil {
+		p.BaseProvider.keySet = p.remoteKeySet(p._client)
+	}
+	if p.discoveryRefreshInterval > 0 {
+		p.stopRefresh = make(chan struct{})
+		go p.refreshDiscovery(p.discoveryRefreshInterval, p.stopRefresh)
+	}
 	return p, nil
 }
 
+// Close stops background work of the provider such as discovery refresh. It is safe to call Close
+// more than once.
+func (p *KeycloakProvider) Close() error {
+	p.closeOnce.Do(func() {
+		if p.stopRefresh != nil {
+			close(p.stopRefresh)
+		}
+	})
+	return nil
+}
+
 func (p *KeycloakProvider) Credentials() (issuer, clientID, clientSecret string) {
 	return p.issuer, p.clientID, p.clientSecret
 }
 
-func (p *KeycloakProvider) CreateResource(request *Resource) (response *ExpandedResource, err error) {
-	request.Description = ""
+// kcResource returns a copy of rsc as Keycloak registers it, without description since Keycloak
+// resources have none. rsc itself is left untouched, since the Manager hashes it to detect changed
+// definitions.
+func (p *KeycloakProvider) kcResource(rsc *Resource) *Resource {
+	kc := *rsc
+	kc.Description = ""
 	if p.ownerManagedAccess {
-		request.OwnerManagedAccess = true
+		kc.OwnerManagedAccess = true
 	}
-	return p.baseProvider.CreateResource(request)
+	return &kc
 }
 
-func (p *KeycloakProvider) WWWAuthenticateDirectives() WWWAuthenticateDirectives {
-	path := strings.Split(p.issuer, "/")
-	return WWWAuthenticateDirectives{
-		Realm: path[len(path)-1],
-		AsUri: p.issuer,
-	}
+func (p *KeycloakProvider) CreateResource(request *Resource) (response *ExpandedResource, err error) {
+	return p.BaseProvider.CreateResource(p.kcResource(request))
+}
+
+// UpdateResource replaces the registration of resource id, keeping ownerManagedAccess if the provider
+// was created with WithKeycloakOwnerManagedAccess
+func (p *KeycloakProvider) UpdateResource(id string, resource *Resource) error {
+	return p.BaseProvider.UpdateResource(id, p.kcResource(resource))
 }
 
 type KcPermissionLogic string
@@ -87,7 +278,9 @@ const (
 type KcPolicyDecisionStrategy string
 
 const (
-	KcUnanimous KcPolicyDecisionStrategy = "UNANIMOUS"
+	KcUnanimous   KcPolicyDecisionStrategy = "UNANIMOUS"
+	KcAffirmative KcPolicyDecisionStrategy = "AFFIRMATIVE"
+	KcConsensus   KcPolicyDecisionStrategy = "CONSENSUS"
 )
 
 type KcPermission struct {
@@ -109,7 +302,7 @@ type kcCreatePermissionResponse struct {
 }
 
 func (p *KeycloakProvider) CreatePermissionForResource(resourceID string, perm *KcPermission) (permissionID string, err error) {
-	path := fmt.Sprintf("%s/%s", p.discovery.PolicyEndpoint, resourceID)
+	path := fmt.Sprintf("%s/%s", p.Discovery().PolicyEndpoint, resourceID)
 	respObj := &kcCreatePermissionResponse{}
 	if err = p.client.CreateObject(path, perm, respObj); err != nil {
 		return "", err
@@ -119,17 +312,85 @@ func (p *KeycloakProvider) CreatePermissionForResource(resourceID string, perm *
 }
 
 func (p *KeycloakProvider) UpdatePermission(id string, perm *KcPermission) (err error) {
-	return p.client.UpdateObject(fmt.Sprintf("%s/%s", p.discovery.PolicyEndpoint, id), perm)
+	return p.client.UpdateObject(fmt.Sprintf("%s/%s", p.Discovery().PolicyEndpoint, id), perm)
 }
 
 func (p *KeycloakProvider) DeletePermission(id string) (err error) {
-	return p.client.DeleteObject(fmt.Sprintf("%s/%s", p.discovery.PolicyEndpoint, id))
+	return p.client.DeleteObject(fmt.Sprintf("%s/%s", p.Discovery().PolicyEndpoint, id))
 }
 
 func (p *KeycloakProvider) ListPermissions(urlQuery url.Values) (perms []KcPermission, err error) {
 	perms = []KcPermission{}
-	if err = p.client.ListObjects(p.discovery.PolicyEndpoint, urlQuery, &perms); err != nil {
+	if err = p.client.ListObjects(p.Discovery().PolicyEndpoint, urlQuery, &perms); err != nil {
 		return
 	}
 	return perms, nil
 }
+
+// KcPermissionQuery filters and paginates permissions. Zero fields are not sent.
+type KcPermissionQuery struct {
+	// Resource is the id of the resource that permissions apply to
+	Resource string
+
+	// Name matches permission names
+	Name string
+
+	// Scope is the name of a scope that permissions apply to
+	Scope string
+
+	// First is the index of the first permission to return
+	First int
+
+	// Max is the maximum number of permissions to return
+	Max int
+}
+
+// Values returns q as url query parameters
+func (q KcPermissionQuery) Values() url.Values {
+	v := url.Values{}
+	if q.Resource != "" {
+		v.Set("resource", q.Resource)
+	}
+	if q.Name != "" {
+		v.Set("name", q.Name)
+	}
+	if q.Scope != "" {
+		v.Set("scope", q.Scope)
+	}
+	if q.First > 0 {
+		v.Set("first", strconv.Itoa(q.First))
+	}
+	if q.Max > 0 {
+		v.Set("max", strconv.Itoa(q.Max))
+	}
+	return v
+}
+
+// QueryPermissions returns one page of permissions that match q
+func (p *KeycloakProvider) QueryPermissions(q KcPermissionQuery) ([]KcPermission, error) {
+	return p.ListPermissions(q.Values())
+}
+
+// kcPermissionPageSize is the number of permissions fetched per request by ForEachPermission
+const kcPermissionPageSize = 100
+
+// ForEachPermission calls fn with each permission of the resource, fetching them page by page. It stops
+// at the first error returned by fn and returns that error.
+func (p *KeycloakProvider) ForEachPermission(resourceID string, fn func(perm KcPermission) error) error {
+	q := KcPermissionQuery{Resource: resourceID, Max: kcPermissionPageSize}
+	for {
+		perms, err := p.QueryPermissions(q)
+		if err != nil {
+			return err
+		}
+		for _, perm := range perms {
+			if err := fn(perm); err != nil {
+				return err
+			}
+		}
+		if len(perms) < q.Max {
+			return nil
+		}
+		q.First += len(perms)
+	}
+}
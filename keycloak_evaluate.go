@@ -0,0 +1,105 @@
+package uma
+
+type KcDecision string
+
+const (
+	KcPermit KcDecision = "PERMIT"
+	KcDeny   KcDecision = "DENY"
+)
+
+// KcEvaluationResult is the outcome of evaluating the policies of one resource
+type KcEvaluationResult struct {
+	ResourceID    string
+	ResourceName  string
+	Status        KcDecision
+	AllowedScopes []string
+}
+
+// KcEvaluation is the outcome of KeycloakProvider.EvaluatePermissions
+type KcEvaluation struct {
+	Status  KcDecision
+	Results []KcEvaluationResult
+}
+
+// Allowed reports whether scope is granted on the resource
+func (e *KcEvaluation) Allowed(resourceID, scope string) bool {
+	for _, res := range e.Results {
+		if res.ResourceID != resourceID || res.Status != KcPermit {
+			continue
+		}
+		for _, s := range res.AllowedScopes {
+			if s == scope {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type kcScopeRep struct {
+	Name string `json:"name"`
+}
+
+type kcEvaluationResourceRep struct {
+	ID     string       `json:"_id"`
+	Name   string       `json:"name,omitempty"`
+	Scopes []kcScopeRep `json:"scopes,omitempty"`
+}
+
+type kcEvaluationRequest struct {
+	ClientID     string                    `json:"clientId"`
+	UserID       string                    `json:"userId"`
+	Resources    []kcEvaluationResourceRep `json:"resources"`
+	Entitlements bool                      `json:"entitlements"`
+	Context      map[string]interface{}    `json:"context"`
+}
+
+type kcEvaluationResponse struct {
+	Status  KcDecision `json:"status"`
+	Results []struct {
+		Resource      kcEvaluationResourceRep `json:"resource"`
+		Status        KcDecision              `json:"status"`
+		AllowedScopes []kcScopeRep            `json:"allowedScopes"`
+	} `json:"results"`
+}
+
+// EvaluatePermissions asks Keycloak whether the user, given by id or username, would be granted scopes
+// on resources, without issuing any token. It uses the policy evaluation endpoint of the admin API, which
+// is meant for admin tools and tests. Unless WithKeycloakAdminCredentials is given, the service account
+// of the client needs the "view-authorization" or "manage-authorization" role of the realm-management
+// client.
+func (p *KeycloakProvider) EvaluatePermissions(user string, resourceIDs []string, scopes []string) (*KcEvaluation, error) {
+	endpoint, clientUUID, err := p.resourceServerEndpoint()
+	if err != nil {
+		return nil, err
+	}
+	req := kcEvaluationRequest{
+		ClientID:  clientUUID,
+		UserID:    user,
+		Resources: make([]kcEvaluationResourceRep, len(resourceIDs)),
+		Context:   map[string]interface{}{"attributes": map[string]interface{}{}},
+	}
+	for i, id := range resourceIDs {
+		req.Resources[i].ID = id
+		for _, s := range scopes {
+			req.Resources[i].Scopes = append(req.Resources[i].Scopes, kcScopeRep{Name: s})
+		}
+	}
+	resp := &kcEvaluationResponse{}
+	if err := p.admin().CreateObject(endpoint+"/policy/evaluate", req, resp); err != nil {
+		return nil, err
+	}
+	eval := &KcEvaluation{Status: resp.Status}
+	for _, res := range resp.Results {
+		r := KcEvaluationResult{
+			ResourceID:   res.Resource.ID,
+			ResourceName: res.Resource.Name,
+			Status:       res.Status,
+		}
+		for _, s := range res.AllowedScopes {
+			r.AllowedScopes = append(r.AllowedScopes, s.Name)
+		}
+		eval.Results = append(eval.Results, r)
+	}
+	return eval, nil
+}
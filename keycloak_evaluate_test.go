@@ -0,0 +1,78 @@
+package uma_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/pckhoi/uma"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeycloakEvaluatePermissions(t *testing.T) {
+	var issuer string
+	mux := http.NewServeMux()
+	writeJSON := func(w http.ResponseWriter, obj any) {
+		w.Header().Set("Content-Type", "application/json")
+		require.NoError(t, json.NewEncoder(w).Encode(obj))
+	}
+	mux.HandleFunc("/realms/test/.well-known/uma2-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]string{"issuer": issuer, "token_endpoint": issuer + "/token"})
+	})
+	mux.HandleFunc("/realms/test/token", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]any{"access_token": "pat", "expires_in": 300})
+	})
+	mux.HandleFunc("/admin/realms/test/clients", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, []map[string]string{{"id": "client-uuid", "clientId": "api"}})
+	})
+	mux.HandleFunc("/admin/realms/test/clients/client-uuid/authz/resource-server/policy/evaluate", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		body := map[string]any{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, map[string]any{
+			"clientId":     "client-uuid",
+			"userId":       "johnd",
+			"entitlements": false,
+			"context":      map[string]any{"attributes": map[string]any{}},
+			"resources": []any{
+				map[string]any{"_id": "rsc-1", "scopes": []any{map[string]any{"name": "read"}, map[string]any{"name": "write"}}},
+				map[string]any{"_id": "rsc-2", "scopes": []any{map[string]any{"name": "read"}, map[string]any{"name": "write"}}},
+			},
+		}, body)
+		writeJSON(w, map[string]any{
+			"status": "PERMIT",
+			"results": []any{
+				map[string]any{
+					"resource":      map[string]any{"_id": "rsc-1", "name": "User 1"},
+					"status":        "PERMIT",
+					"allowedScopes": []any{map[string]any{"name": "read"}},
+				},
+				map[string]any{
+					"resource": map[string]any{"_id": "rsc-2", "name": "User 2"},
+					"status":   "DENY",
+				},
+			},
+		})
+	})
+	s := httptest.NewServer(mux)
+	defer s.Close()
+	issuer = s.URL + "/realms/test"
+
+	kp, err := uma.NewKeycloakProvider(issuer, "api", "secret", nil, testr.New(t), uma.WithKeycloakClient(s.Client()))
+	require.NoError(t, err)
+	eval, err := kp.EvaluatePermissions("johnd", []string{"rsc-1", "rsc-2"}, []string{"read", "write"})
+	require.NoError(t, err)
+	assert.Equal(t, &uma.KcEvaluation{
+		Status: uma.KcPermit,
+		Results: []uma.KcEvaluationResult{
+			{ResourceID: "rsc-1", ResourceName: "User 1", Status: uma.KcPermit, AllowedScopes: []string{"read"}},
+			{ResourceID: "rsc-2", ResourceName: "User 2", Status: uma.KcDeny},
+		},
+	}, eval)
+	assert.True(t, eval.Allowed("rsc-1", "read"))
+	assert.False(t, eval.Allowed("rsc-1", "write"))
+	assert.False(t, eval.Allowed("rsc-2", "read"))
+}
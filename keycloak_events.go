@@ -0,0 +1,290 @@
+package uma
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// KcAdminEvent is an event recorded by Keycloak when an object is changed through the admin API. Admin
+// events need to be enabled in the realm settings, with "Include representation" if resources are to be
+// invalidated by name.
+type KcAdminEvent struct {
+	// Time is the unix time in milliseconds
+	Time          int64  `json:"time"`
+	RealmID       string `json:"realmId"`
+	OperationType string `json:"operationType"`
+	ResourceType  string `json:"resourceType"`
+	ResourcePath  string `json:"resourcePath"`
+
+	// Representation is the JSON representation of the object, if enabled in the realm settings
+	Representation string `json:"representation,omitempty"`
+}
+
+// KcAdminEventQuery filters admin events
+type KcAdminEventQuery struct {
+	// ResourceTypes e.g. "AUTHORIZATION_RESOURCE", "AUTHORIZATION_POLICY"
+	ResourceTypes []string
+
+	// DateFrom is a date formatted as "2006-01-02"
+	DateFrom string
+
+	First int
+	Max   int
+}
+
+// Values encodes q as query parameters
+func (q KcAdminEventQuery) Values() url.Values {
+	v := url.Values{}
+	for _, t := range q.ResourceTypes {
+		v.Add("resourceTypes", t)
+	}
+	if q.DateFrom != "" {
+		v.Set("dateFrom", q.DateFrom)
+	}
+	if q.First > 0 {
+		v.Set("first", strconv.Itoa(q.First))
+	}
+	if q.Max > 0 {
+		v.Set("max", strconv.Itoa(q.Max))
+	}
+	return v
+}
+
+// AdminEvents lists admin events of the realm, latest first. Unless WithKeycloakAdminCredentials is
+// given, the service account of the client needs the "view-events" role of the realm-management client.
+func (p *KeycloakProvider) AdminEvents(q KcAdminEventQuery) ([]KcAdminEvent, error) {
+	admin, err := p.adminEndpoint()
+	if err != nil {
+		return nil, err
+	}
+	events := []KcAdminEvent{}
+	if err := p.admin().ListObjects(admin+"/admin-events", q.Values(), &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+const (
+	defaultKcEventPollInterval    = 30 * time.Second
+	defaultKcEventMaxSignatureAge = 5 * time.Minute
+	defaultKcEventMaxBodySize     = 1 << 20
+)
+
+// KcEventListener invalidates the caches of a Manager when authorization settings change in Keycloak.
+// Events are either polled from the admin events API with Poll, or pushed to the listener, which is an
+// http.Handler, by an event listener SPI of Keycloak. Pushed events must be signed with Secret the same
+// way WebhookSink signs its requests, see WebhookSignatureHeader, since forged events could delete any
+// resource. Each signature is accepted once, replayed deliveries are rejected.
+//
+// Deleted or updated resources are removed from ManagerOptions.ResourceCache and ResourceStore if they
+// implement ResourceCacheDeleter and ResourceStoreDeleter respectively. If TombstoneTTL is set, deleted
+// resources are also tombstoned in ResourceStore if it implements ResourceTombstoneStore, so that they
+// are not registered again. Any change to authorization settings purges the token cache.
+type KcEventListener struct {
+	Manager  *Manager
+	Provider *KeycloakProvider
+
+	// ResourceStore is the store given to Manager.Middleware, if any
+	ResourceStore ResourceStore
+
+	// TombstoneTTL is how long deleted resources are kept from being registered again
+	TombstoneTTL time.Duration
+
+	// Interval between polls. Defaults to 30 seconds.
+	Interval time.Duration
+
+	// Secret verifies the signature of pushed events. All pushed events are rejected if it is empty.
+	Secret []byte
+
+	// MaxSignatureAge is how far the timestamp of pushed events may be from the current time. Defaults
+	// to 5 minutes.
+	MaxSignatureAge time.Duration
+
+	// MaxBodySize is the largest pushed body in bytes. Defaults to 1 MiB.
+	MaxBodySize int64
+
+	mu sync.Mutex
+	// seen holds the signatures of accepted deliveries until their timestamp is too old to be accepted
+	seen map[string]time.Time
+}
+
+// HandleEvents invalidates caches affected by events
+func (l *KcEventListener) HandleEvents(events []KcAdminEvent) error {
+	purge := false
+	for _, e := range events {
+		if !strings.HasPrefix(e.ResourceType, "AUTHORIZATION_") {
+			continue
+		}
+		purge = true
+		if e.ResourceType != "AUTHORIZATION_RESOURCE" || e.OperationType == "CREATE" || e.Representation == "" {
+			continue
+		}
+		rsc := struct {
+			Name string `json:"name"`
+		}{}
+		if err := json.Unmarshal([]byte(e.Representation), &rsc); err != nil || rsc.Name == "" {
+			l.Manager.logger.Info("cannot read resource name from admin event", "path", e.ResourcePath)
+			continue
+		}
+		if e.OperationType == "DELETE" && l.TombstoneTTL > 0 {
+			if ts, ok := l.ResourceStore.(ResourceTombstoneStore); ok {
+				if err := ts.Tombstone(l.Manager.storeKey(l.Provider, rsc.Name), l.TombstoneTTL); err != nil {
+					return err
+				}
+			}
+		}
+		if err := l.Manager.InvalidateResource(l.Provider, l.ResourceStore, rsc.Name); err != nil {
+			return err
+		}
+	}
+	if purge {
+		l.Manager.PurgeTokenCache()
+	}
+	return nil
+}
+
+// Poll polls admin events until ctx is done. Events recorded before the first poll are skipped. Errors
+// are logged and the next poll goes on.
+func (l *KcEventListener) Poll(ctx context.Context) {
+	interval := l.Interval
+	if interval == 0 {
+		interval = defaultKcEventPollInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var last int64
+	first := true
+	for {
+		events, err := l.Provider.AdminEvents(KcAdminEventQuery{
+			DateFrom: l.Manager.clock.Now().Add(-interval).UTC().Format("2006-01-02"),
+		})
+		if err != nil {
+			l.Manager.logger.Error(err, "error polling admin events")
+		} else {
+			var fresh []KcAdminEvent
+			latest := last
+			for _, e := range events {
+				if e.Time > latest {
+					latest = e.Time
+				}
+				if !first && e.Time > last {
+					fresh = append(fresh, e)
+				}
+			}
+			if err := l.HandleEvents(fresh); err != nil {
+				l.Manager.logger.Error(err, "error handling admin events")
+			} else {
+				last = latest
+				first = false
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ServeHTTP accepts an admin event or an array of admin events as JSON, signed with Secret
+func (l *KcEventListener) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	if len(l.Secret) == 0 {
+		l.Manager.logger.Info("rejected pushed admin events, KcEventListener.Secret is not set")
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+	maxBodySize := l.MaxBodySize
+	if maxBodySize <= 0 {
+		maxBodySize = defaultKcEventMaxBodySize
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+	if err != nil {
+		if errors.As(err, new(*http.MaxBytesError)) {
+			http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	maxAge := l.MaxSignatureAge
+	if maxAge <= 0 {
+		maxAge = defaultKcEventMaxSignatureAge
+	}
+	now := l.Manager.clock.Now()
+	if err := verifyWebhookSignature(l.Secret, r.Header, body, now, maxAge); err != nil {
+		l.Manager.logger.Info("rejected pushed admin events", "err", err.Error())
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+	sig := r.Header.Get(WebhookSignatureHeader)
+	if !l.markSeen(sig, now, maxAge) {
+		l.Manager.logger.Info("rejected replayed admin events")
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+	var raw json.RawMessage
+	if err := json.Unmarshal(body, &raw); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	events := []KcAdminEvent{}
+	if strings.HasPrefix(strings.TrimSpace(string(raw)), "[") {
+		if err := json.Unmarshal(raw, &events); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	} else {
+		e := KcAdminEvent{}
+		if err := json.Unmarshal(raw, &e); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		events = append(events, e)
+	}
+	if err := l.HandleEvents(events); err != nil {
+		// the sender may retry the same delivery
+		l.forget(sig)
+		l.Manager.logger.Error(err, "error handling admin events")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// markSeen records an accepted signature. It reports false if the signature was seen already. The
+// signature is valid for maxAge after now at most, so it is forgotten afterward.
+func (l *KcEventListener) markSeen(sig string, now time.Time, maxAge time.Duration) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.seen == nil {
+		l.seen = map[string]time.Time{}
+	}
+	for k, exp := range l.seen {
+		if now.After(exp) {
+			delete(l.seen, k)
+		}
+	}
+	if _, ok := l.seen[sig]; ok {
+		return false
+	}
+	l.seen[sig] = now.Add(maxAge)
+	return true
+}
+
+func (l *KcEventListener) forget(sig string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.seen, sig)
+}
@@ -0,0 +1,231 @@
+package uma_test
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/pckhoi/uma"
+	"github.com/pckhoi/uma/pkg/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newKcEventsServer(t *testing.T, events func() []uma.KcAdminEvent) (*httptest.Server, *uma.KeycloakProvider) {
+	var issuer string
+	mux := http.NewServeMux()
+	writeJSON := func(w http.ResponseWriter, obj any) {
+		w.Header().Set("Content-Type", "application/json")
+		require.NoError(t, json.NewEncoder(w).Encode(obj))
+	}
+	mux.HandleFunc("/realms/test/.well-known/uma2-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]string{"issuer": issuer, "token_endpoint": issuer + "/token"})
+	})
+	mux.HandleFunc("/realms/test/token", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]any{"access_token": "pat", "expires_in": 300})
+	})
+	mux.HandleFunc("/admin/realms/test/admin-events", func(w http.ResponseWriter, r *http.Request) {
+		assert.NotEmpty(t, r.URL.Query().Get("dateFrom"))
+		writeJSON(w, events())
+	})
+	s := httptest.NewServer(mux)
+	issuer = s.URL + "/realms/test"
+	kp, err := uma.NewKeycloakProvider(issuer, "api", "secret", nil, testr.New(t), uma.WithKeycloakClient(s.Client()))
+	require.NoError(t, err)
+	return s, kp
+}
+
+func resourceDeleted(name string) uma.KcAdminEvent {
+	return uma.KcAdminEvent{
+		OperationType:  "DELETE",
+		ResourceType:   "AUTHORIZATION_RESOURCE",
+		ResourcePath:   "clients/client-uuid/authz/resource-server/resource/id-" + name,
+		Representation: `{"name":"` + name + `"}`,
+	}
+}
+
+// signedEventsRequest returns a request pushing body, signed with secret at time ts
+func signedEventsRequest(secret []byte, ts time.Time, body string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/events", strings.NewReader(body))
+	unix := strconv.FormatInt(ts.Unix(), 10)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(unix + "." + body))
+	r.Header.Set(uma.WebhookTimestampHeader, unix)
+	r.Header.Set(uma.WebhookSignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	return r
+}
+
+func TestKcEventListenerWebhook(t *testing.T) {
+	s, kp := newKcEventsServer(t, nil)
+	defer s.Close()
+	cache := &memResourceCache{m: map[string]string{}}
+	rs := &syncResourceStore{m: map[string]string{"User 1": "id-User 1", "User 2": "id-User 2"}}
+	issuer := kp.WWWAuthenticateDirectives().AsUri
+	require.NoError(t, cache.Set(issuer+" User 1", "id-User 1", time.Minute))
+	require.NoError(t, cache.Set(issuer+" User 2", "id-User 2", time.Minute))
+	l := &uma.KcEventListener{
+		Manager:       newCachingManager(t, cache),
+		Provider:      kp,
+		ResourceStore: rs,
+		Secret:        []byte("secret"),
+	}
+
+	b, err := json.Marshal(resourceDeleted("User 1"))
+	require.NoError(t, err)
+	rec := httptest.NewRecorder()
+	l.ServeHTTP(rec, signedEventsRequest(l.Secret, time.Now(), string(b)))
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, map[string]string{issuer + " User 2": "id-User 2"}, cache.m)
+	assert.Equal(t, map[string]string{"User 2": "id-User 2"}, rs.m)
+
+	// unrelated events are ignored
+	b, err = json.Marshal([]uma.KcAdminEvent{
+		{OperationType: "DELETE", ResourceType: "USER", Representation: `{"name":"User 2"}`},
+	})
+	require.NoError(t, err)
+	rec = httptest.NewRecorder()
+	l.ServeHTTP(rec, signedEventsRequest(l.Secret, time.Now(), string(b)))
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Len(t, rs.m, 1)
+
+	rec = httptest.NewRecorder()
+	l.ServeHTTP(rec, signedEventsRequest(l.Secret, time.Now(), "{"))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestKcEventListenerWebhookRejectsUnsigned(t *testing.T) {
+	s, kp := newKcEventsServer(t, nil)
+	defer s.Close()
+	rs := &syncResourceStore{m: map[string]string{"User 1": "id-User 1"}}
+	l := &uma.KcEventListener{
+		Manager:       newCachingManager(t, &memResourceCache{m: map[string]string{}}),
+		Provider:      kp,
+		ResourceStore: rs,
+		Secret:        []byte("secret"),
+	}
+	b, err := json.Marshal(resourceDeleted("User 1"))
+	require.NoError(t, err)
+	body := string(b)
+
+	tampered := signedEventsRequest(l.Secret, time.Now(), body)
+	tampered.Body = io.NopCloser(strings.NewReader(strings.Replace(body, "User 1", "User 2", 1)))
+	for name, r := range map[string]*http.Request{
+		"unsigned":     httptest.NewRequest(http.MethodPost, "/events", strings.NewReader(body)),
+		"wrong secret": signedEventsRequest([]byte("other"), time.Now(), body),
+		"tampered":     tampered,
+		"stale":        signedEventsRequest(l.Secret, time.Now().Add(-10*time.Minute), body),
+	} {
+		rec := httptest.NewRecorder()
+		l.ServeHTTP(rec, r)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code, name)
+	}
+
+	// nothing is accepted without a secret
+	l.Secret = nil
+	rec := httptest.NewRecorder()
+	l.ServeHTTP(rec, signedEventsRequest(nil, time.Now(), body))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	assert.Equal(t, map[string]string{"User 1": "id-User 1"}, rs.m)
+}
+
+func TestKcEventListenerWebhookReplay(t *testing.T) {
+	s, kp := newKcEventsServer(t, nil)
+	defer s.Close()
+	c := clock.NewFake(time.Now())
+	rs := &syncResourceStore{m: map[string]string{}}
+	l := &uma.KcEventListener{
+		Manager:       newMockManager(t, newMockProvider(nil), uma.ManagerOptions{Clock: c}),
+		Provider:      kp,
+		ResourceStore: rs,
+		Secret:        []byte("secret"),
+		MaxBodySize:   1024,
+	}
+	b, err := json.Marshal(resourceDeleted("User 1"))
+	require.NoError(t, err)
+	ts := c.Now()
+
+	rec := httptest.NewRecorder()
+	l.ServeHTTP(rec, signedEventsRequest(l.Secret, ts, string(b)))
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+
+	// the same delivery is rejected as long as its signature could be accepted
+	rs.m["User 1"] = "id-User 1"
+	c.Advance(time.Minute)
+	rec = httptest.NewRecorder()
+	l.ServeHTTP(rec, signedEventsRequest(l.Secret, ts, string(b)))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, map[string]string{"User 1": "id-User 1"}, rs.m)
+
+	// a new delivery of the same event is signed anew
+	rec = httptest.NewRecorder()
+	l.ServeHTTP(rec, signedEventsRequest(l.Secret, c.Now(), string(b)))
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Empty(t, rs.m)
+
+	events := make([]uma.KcAdminEvent, 20)
+	for i := range events {
+		events[i] = resourceDeleted("User 1")
+	}
+	b, err = json.Marshal(events)
+	require.NoError(t, err)
+	rec = httptest.NewRecorder()
+	l.ServeHTTP(rec, signedEventsRequest(l.Secret, c.Now(), string(b)))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+}
+
+func TestKcEventListenerPoll(t *testing.T) {
+	var mu sync.Mutex
+	events := []uma.KcAdminEvent{resourceDeleted("User 1")}
+	events[0].Time = 1
+	s, kp := newKcEventsServer(t, func() []uma.KcAdminEvent {
+		mu.Lock()
+		defer mu.Unlock()
+		return events
+	})
+	defer s.Close()
+	rs := &syncResourceStore{m: map[string]string{"User 1": "id-User 1", "User 2": "id-User 2"}}
+	l := &uma.KcEventListener{
+		Manager:       newCachingManager(t, nil),
+		Provider:      kp,
+		ResourceStore: rs,
+		Interval:      10 * time.Millisecond,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		l.Poll(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	stored := func(name string) bool {
+		id, _ := rs.Get(name)
+		return id != ""
+	}
+	time.Sleep(50 * time.Millisecond)
+	// events recorded before the first poll are skipped
+	assert.True(t, stored("User 1"))
+
+	mu.Lock()
+	e := resourceDeleted("User 2")
+	e.Time = 2
+	events = append([]uma.KcAdminEvent{e}, events...)
+	mu.Unlock()
+	assert.Eventually(t, func() bool { return !stored("User 2") }, time.Second, 10*time.Millisecond)
+	assert.True(t, stored("User 1"))
+}
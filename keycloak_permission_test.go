@@ -0,0 +1,93 @@
+package uma_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/pckhoi/uma"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeycloakForEachPermission(t *testing.T) {
+	var issuer string
+	perms := make([]uma.KcPermission, 250)
+	for i := range perms {
+		perms[i] = uma.KcPermission{ID: fmt.Sprintf("perm-%d", i), Name: fmt.Sprintf("perm %d", i)}
+	}
+	var queries []string
+	mux := http.NewServeMux()
+	writeJSON := func(w http.ResponseWriter, obj any) {
+		w.Header().Set("Content-Type", "application/json")
+		require.NoError(t, json.NewEncoder(w).Encode(obj))
+	}
+	mux.HandleFunc("/realms/test/.well-known/uma2-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]string{
+			"issuer":          issuer,
+			"token_endpoint":  issuer + "/token",
+			"policy_endpoint": issuer + "/uma-policy",
+		})
+	})
+	mux.HandleFunc("/realms/test/token", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]any{"access_token": "pat", "expires_in": 300})
+	})
+	mux.HandleFunc("/realms/test/uma-policy", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		queries = append(queries, q.Encode())
+		if q.Get("resource") != "rsc-1" {
+			writeJSON(w, []uma.KcPermission{})
+			return
+		}
+		first, _ := strconv.Atoi(q.Get("first"))
+		max, _ := strconv.Atoi(q.Get("max"))
+		end := first + max
+		if end > len(perms) {
+			end = len(perms)
+		}
+		writeJSON(w, perms[first:end])
+	})
+	s := httptest.NewServer(mux)
+	defer s.Close()
+	issuer = s.URL + "/realms/test"
+
+	kp, err := uma.NewKeycloakProvider(issuer, "api", "secret", nil, testr.New(t), uma.WithKeycloakClient(s.Client()))
+	require.NoError(t, err)
+
+	ids := []string{}
+	require.NoError(t, kp.ForEachPermission("rsc-1", func(perm uma.KcPermission) error {
+		ids = append(ids, perm.ID)
+		return nil
+	}))
+	assert.Len(t, ids, 250)
+	assert.Equal(t, "perm-249", ids[249])
+	assert.Equal(t, []string{
+		"max=100&resource=rsc-1",
+		"first=100&max=100&resource=rsc-1",
+		"first=200&max=100&resource=rsc-1",
+	}, queries)
+
+	// iteration stops at the first error
+	queries = nil
+	stop := errors.New("stop")
+	n := 0
+	assert.Equal(t, stop, kp.ForEachPermission("rsc-1", func(perm uma.KcPermission) error {
+		n++
+		if n == 5 {
+			return stop
+		}
+		return nil
+	}))
+	assert.Equal(t, 5, n)
+	assert.Len(t, queries, 1)
+
+	page, err := kp.QueryPermissions(uma.KcPermissionQuery{Resource: "rsc-1", Name: "perm", First: 10, Max: 2})
+	require.NoError(t, err)
+	assert.Equal(t, []uma.KcPermission{perms[10], perms[11]}, page)
+	assert.Equal(t, "first=10&max=2&name=perm&resource=rsc-1", queries[len(queries)-1])
+}
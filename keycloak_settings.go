@@ -0,0 +1,130 @@
+package uma
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/pckhoi/uma/pkg/httputil"
+)
+
+type KcPolicyEnforcementMode string
+
+const (
+	KcEnforcing  KcPolicyEnforcementMode = "ENFORCING"
+	KcPermissive KcPolicyEnforcementMode = "PERMISSIVE"
+	KcDisabled   KcPolicyEnforcementMode = "DISABLED"
+)
+
+// KcResourceServerSettings are the authorization settings of the client of a KeycloakProvider
+type KcResourceServerSettings struct {
+	PolicyEnforcementMode         KcPolicyEnforcementMode  `json:"policyEnforcementMode,omitempty"`
+	DecisionStrategy              KcPolicyDecisionStrategy `json:"decisionStrategy,omitempty"`
+	AllowRemoteResourceManagement bool                     `json:"allowRemoteResourceManagement"`
+}
+
+// adminEndpoint returns the admin API endpoint of the realm, which is derived from the issuer
+// e.g. "https://kc.example.com/realms/demo" becomes "https://kc.example.com/admin/realms/demo". If
+// admin credentials are given, their server url is used instead.
+func (p *KeycloakProvider) adminEndpoint() (string, error) {
+	i := strings.LastIndex(p.issuer, "/realms/")
+	if i < 0 {
+		return "", fmt.Errorf("cannot derive admin endpoint from issuer %q", p.issuer)
+	}
+	if p.adminCreds != nil {
+		return p.adminCreds.AdminEndpoint(p.issuer[i+len("/realms/"):]), nil
+	}
+	return p.issuer[:i] + "/admin" + p.issuer[i:], nil
+}
+
+// admin returns the client that calls the admin API. Unless admin credentials are given, it is the
+// client that uses the protection API token.
+func (p *KeycloakProvider) admin() *httputil.Client {
+	if p.adminClient != nil {
+		return p.adminClient
+	}
+	return p.client
+}
+
+// clientUUID looks up the id of the client, which the admin API uses instead of the client id
+func (p *KeycloakProvider) clientUUID(admin string) (string, error) {
+	clients := []struct {
+		ID       string `json:"id"`
+		ClientID string `json:"clientId"`
+	}{}
+	if err := p.admin().ListObjects(admin+"/clients", url.Values{"clientId": {p.clientID}}, &clients); err != nil {
+		return "", err
+	}
+	for _, c := range clients {
+		if c.ClientID == p.clientID {
+			return c.ID, nil
+		}
+	}
+	return "", fmt.Errorf("client %q not found", p.clientID)
+}
+
+// resourceServerEndpoint returns the admin API endpoint of the resource server settings of the client,
+// along with the id of the client
+func (p *KeycloakProvider) resourceServerEndpoint() (endpoint, clientUUID string, err error) {
+	admin, err := p.adminEndpoint()
+	if err != nil {
+		return "", "", err
+	}
+	clientUUID, err = p.clientUUID(admin)
+	if err != nil {
+		return "", "", err
+	}
+	return fmt.Sprintf("%s/clients/%s/authz/resource-server", admin, clientUUID), clientUUID, nil
+}
+
+// GetResourceServerSettings reads the authorization settings of the client via the admin API. Unless
+// WithKeycloakAdminCredentials is given, the service account of the client needs the
+// "view-authorization" or "manage-authorization" role of the realm-management client.
+func (p *KeycloakProvider) GetResourceServerSettings() (*KcResourceServerSettings, error) {
+	endpoint, _, err := p.resourceServerEndpoint()
+	if err != nil {
+		return nil, err
+	}
+	settings := &KcResourceServerSettings{}
+	if err := p.admin().GetObject(endpoint, settings); err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+// UpdateResourceServerSettings reads the authorization settings of the client, lets update modify them,
+// then writes them back via the admin API. Other attributes of the resource server are preserved. Unless
+// WithKeycloakAdminCredentials is given, the service account of the client needs the
+// "manage-authorization" role of the realm-management client.
+func (p *KeycloakProvider) UpdateResourceServerSettings(update func(s *KcResourceServerSettings)) error {
+	endpoint, _, err := p.resourceServerEndpoint()
+	if err != nil {
+		return err
+	}
+	raw := map[string]json.RawMessage{}
+	if err := p.admin().GetObject(endpoint, &raw); err != nil {
+		return err
+	}
+	b, err := json.Marshal(raw)
+	if err != nil {
+		return err
+	}
+	settings := &KcResourceServerSettings{}
+	if err := json.Unmarshal(b, settings); err != nil {
+		return err
+	}
+	update(settings)
+	b, err = json.Marshal(settings)
+	if err != nil {
+		return err
+	}
+	changes := map[string]json.RawMessage{}
+	if err := json.Unmarshal(b, &changes); err != nil {
+		return err
+	}
+	for k, v := range changes {
+		raw[k] = v
+	}
+	return p.admin().UpdateObject(endpoint, raw)
+}
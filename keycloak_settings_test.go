@@ -0,0 +1,105 @@
+package uma_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/pckhoi/uma"
+	"github.com/pckhoi/uma/pkg/keycloak"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeycloakResourceServerSettings(t *testing.T) {
+	var issuer string
+	settings := map[string]any{
+		"id":                            "rs-uuid",
+		"clientId":                      "api",
+		"policyEnforcementMode":         "ENFORCING",
+		"decisionStrategy":              "UNANIMOUS",
+		"allowRemoteResourceManagement": false,
+	}
+	var adminAuth []string
+	mux := http.NewServeMux()
+	writeJSON := func(w http.ResponseWriter, status int, obj any) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		require.NoError(t, json.NewEncoder(w).Encode(obj))
+	}
+	mux.HandleFunc("/realms/test/.well-known/uma2-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{
+			"issuer":         issuer,
+			"token_endpoint": issuer + "/token",
+		})
+	})
+	mux.HandleFunc("/realms/test/token", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]any{"access_token": "pat", "expires_in": 300})
+	})
+	mux.HandleFunc("/realms/master/protocol/openid-connect/token", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, "admin", r.PostForm.Get("username"))
+		writeJSON(w, http.StatusOK, map[string]any{"access_token": "admin-token", "expires_in": 60})
+	})
+	mux.HandleFunc("/admin/realms/test/clients", func(w http.ResponseWriter, r *http.Request) {
+		adminAuth = append(adminAuth, r.Header.Get("Authorization"))
+		// the client id of results is checked by the provider
+		writeJSON(w, http.StatusOK, []map[string]string{{"id": "client-uuid", "clientId": "api"}})
+	})
+	mux.HandleFunc("/admin/realms/test/clients/client-uuid/authz/resource-server", func(w http.ResponseWriter, r *http.Request) {
+		adminAuth = append(adminAuth, r.Header.Get("Authorization"))
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, settings)
+		case http.MethodPut:
+			settings = map[string]any{}
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&settings))
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+	s := httptest.NewServer(mux)
+	defer s.Close()
+	issuer = s.URL + "/realms/test"
+
+	kp, err := uma.NewKeycloakProvider(issuer, "api", "secret", nil, testr.New(t), uma.WithKeycloakClient(s.Client()))
+	require.NoError(t, err)
+
+	rs, err := kp.GetResourceServerSettings()
+	require.NoError(t, err)
+	assert.Equal(t, &uma.KcResourceServerSettings{
+		PolicyEnforcementMode: uma.KcEnforcing,
+		DecisionStrategy:      uma.KcUnanimous,
+	}, rs)
+
+	require.NoError(t, kp.UpdateResourceServerSettings(func(s *uma.KcResourceServerSettings) {
+		s.PolicyEnforcementMode = uma.KcPermissive
+		s.AllowRemoteResourceManagement = true
+	}))
+	assert.Equal(t, map[string]any{
+		"id":                            "rs-uuid",
+		"clientId":                      "api",
+		"policyEnforcementMode":         "PERMISSIVE",
+		"decisionStrategy":              "UNANIMOUS",
+		"allowRemoteResourceManagement": true,
+	}, settings)
+	assert.Equal(t, []string{"Bearer pat", "Bearer pat", "Bearer pat", "Bearer pat", "Bearer pat"}, adminAuth)
+
+	// admin credentials have their own token
+	adminAuth = nil
+	kp, err = uma.NewKeycloakProvider(issuer, "api", "secret", nil, testr.New(t),
+		uma.WithKeycloakClient(s.Client()),
+		uma.WithKeycloakAdminCredentials(keycloak.AdminCredentials{Username: "admin", Password: "admin"}),
+	)
+	require.NoError(t, err)
+	rs, err = kp.GetResourceServerSettings()
+	require.NoError(t, err)
+	assert.Equal(t, uma.KcPermissive, rs.PolicyEnforcementMode)
+	assert.Equal(t, []string{"Bearer admin-token", "Bearer admin-token"}, adminAuth)
+
+	kp, err = uma.NewKeycloakProvider(issuer, "unknown", "secret", nil, testr.New(t), uma.WithKeycloakClient(s.Client()))
+	require.NoError(t, err)
+	_, err = kp.GetResourceServerSettings()
+	assert.EqualError(t, err, `client "unknown" not found`)
+}
@@ -4,7 +4,10 @@ import (
 	"context"
 	"encoding/json"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"sort"
+	"sync"
 	"testing"
 
 	"github.com/coreos/go-oidc/v3/oidc"
@@ -62,6 +65,11 @@ func TestKeycloakProvider(t *testing.T) {
 	kc := testutil.CreateKeycloakRPClient(t, client)
 	baseURL := "https://example.com"
 
+	discovery := kp.Discovery()
+	assert.Equal(t, "http://localhost:8080/realms/test-realm", discovery.Issuer)
+	assert.Equal(t, "http://localhost:8080/realms/test-realm/protocol/openid-connect/certs", discovery.JwksURI)
+	assert.Contains(t, discovery.GrantTypesSupported, "client_credentials")
+
 	rscReq1 := &uma.Resource{
 		ResourceType: uma.ResourceType{
 			Type:           baseURL + "/rsrcs/user",
@@ -167,3 +175,150 @@ func TestKeycloakProvider(t *testing.T) {
 	require.NoError(t, err)
 	assert.Len(t, perms, 0)
 }
+
+func TestKeycloakUserAgent(t *testing.T) {
+	var issuer string
+	var mu sync.Mutex
+	agents := map[string]string{}
+	forwarded := map[string]string{}
+	mux := http.NewServeMux()
+	writeJSON := func(w http.ResponseWriter, obj any) {
+		w.Header().Set("Content-Type", "application/json")
+		require.NoError(t, json.NewEncoder(w).Encode(obj))
+	}
+	record := func(r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		agents[r.URL.Path] = r.Header.Get("User-Agent")
+		forwarded[r.URL.Path] = r.Header.Get("X-Forwarded-Host")
+	}
+	mux.HandleFunc("/realms/test/.well-known/uma2-configuration", func(w http.ResponseWriter, r *http.Request) {
+		record(r)
+		writeJSON(w, map[string]string{
+			"issuer":          issuer,
+			"token_endpoint":  issuer + "/token",
+			"policy_endpoint": issuer + "/uma-policy",
+		})
+	})
+	mux.HandleFunc("/realms/test/token", func(w http.ResponseWriter, r *http.Request) {
+		record(r)
+		writeJSON(w, map[string]any{"access_token": "pat", "expires_in": 300})
+	})
+	mux.HandleFunc("/realms/test/uma-policy", func(w http.ResponseWriter, r *http.Request) {
+		record(r)
+		writeJSON(w, []uma.KcPermission{})
+	})
+	s := httptest.NewServer(mux)
+	defer s.Close()
+	issuer = s.URL + "/realms/test"
+
+	kp, err := uma.NewKeycloakProvider(issuer, "api", "secret", nil, testr.New(t),
+		uma.WithKeycloakClient(s.Client()),
+		uma.WithKeycloakUserAgent("billing-api/1.4.2", "commit=abc123"),
+		uma.WithKeycloakRequestEditor(func(req *http.Request) {
+			req.Header.Set("X-Forwarded-Host", "auth.example.com")
+		}),
+	)
+	require.NoError(t, err)
+	_, err = kp.QueryPermissions(uma.KcPermissionQuery{})
+	require.NoError(t, err)
+	assert.Len(t, agents, 3)
+	for path, agent := range agents {
+		assert.Regexp(t, `^billing-api/1\.4\.2 pckhoi-uma/\S+ \(go[^;]+; commit=abc123\)$`, agent, path)
+		assert.Equal(t, "auth.example.com", forwarded[path], path)
+	}
+}
+
+func TestKeycloakRegisteredResourceHash(t *testing.T) {
+	var issuer string
+	var mu sync.Mutex
+	var created, updated []map[string]interface{}
+	mux := http.NewServeMux()
+	writeJSON := func(w http.ResponseWriter, obj any) {
+		w.Header().Set("Content-Type", "application/json")
+		require.NoError(t, json.NewEncoder(w).Encode(obj))
+	}
+	mux.HandleFunc("/realms/test/.well-known/uma2-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]string{
+			"issuer":                         issuer,
+			"token_endpoint":                 issuer + "/token",
+			"resource_registration_endpoint": issuer + "/resource_set",
+		})
+	})
+	mux.HandleFunc("/realms/test/token", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]any{"access_token": "pat", "expires_in": 300})
+	})
+	mux.HandleFunc("/realms/test/resource_set", func(w http.ResponseWriter, r *http.Request) {
+		obj := map[string]interface{}{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&obj))
+		mu.Lock()
+		created = append(created, obj)
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		writeJSON(w, map[string]string{"_id": "rsc-1", "name": obj["name"].(string)})
+	})
+	mux.HandleFunc("/realms/test/resource_set/rsc-1", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, map[string]interface{}{"_id": "rsc-1", "name": "User 1", "owner": map[string]string{"id": "owner-1"}})
+		case http.MethodPut:
+			obj := map[string]interface{}{}
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&obj))
+			mu.Lock()
+			updated = append(updated, obj)
+			mu.Unlock()
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+	s := httptest.NewServer(mux)
+	defer s.Close()
+	issuer = s.URL + "/realms/test"
+	kp, err := uma.NewKeycloakProvider(issuer, "api", "secret", nil, testr.New(t),
+		uma.WithKeycloakClient(s.Client()),
+		uma.WithKeycloakOwnerManagedAccess(),
+	)
+	require.NoError(t, err)
+
+	rs := &hashResourceStore{syncResourceStore{m: map[string]string{}}, map[string]string{}}
+	newManager := func(scopes ...string) *uma.Manager {
+		return uma.New(
+			uma.ManagerOptions{},
+			map[string]uma.ResourceType{"user": {Type: "user", Description: "A user", ResourceScopes: scopes}},
+			[]string{"oidc"},
+			nil,
+			nil,
+			[]uma.Path{
+				uma.NewPath("/{id}", uma.NewResourceTemplate("user", "User {id}"), map[string]uma.Operation{}),
+			},
+			testr.New(t),
+		)
+	}
+	baseURL := url.URL{Scheme: "https", Host: "api.example.com", Path: "/users"}
+	r := httptest.NewRequest(http.MethodGet, "https://api.example.com/users/1", nil)
+
+	// the resource as registered with Keycloak differs from the rendered one, which is what is hashed
+	man := newManager("read")
+	rsc, err := man.RegisterResourceAt(r, rs, kp, baseURL, "/users/1")
+	require.NoError(t, err)
+	assert.Equal(t, "A user", rsc.Description)
+	require.Len(t, created, 1)
+	assert.Nil(t, created[0]["description"])
+	assert.Equal(t, true, created[0]["ownerManagedAccess"])
+	for i := 0; i < 2; i++ {
+		_, err = newManager("read").RegisterResourceAt(r, rs, kp, baseURL, "/users/1")
+		require.NoError(t, err)
+	}
+	assert.Empty(t, updated)
+
+	// updates keep ownerManagedAccess
+	_, err = newManager("read", "write").RegisterResourceAt(r, rs, kp, baseURL, "/users/1")
+	require.NoError(t, err)
+	require.Len(t, updated, 1)
+	assert.Equal(t, true, updated[0]["ownerManagedAccess"])
+	assert.Equal(t, "owner-1", updated[0]["owner"])
+	assert.Nil(t, updated[0]["description"])
+	_, err = newManager("read", "write").RegisterResourceAt(r, rs, kp, baseURL, "/users/1")
+	require.NoError(t, err)
+	assert.Len(t, updated, 1)
+}
@@ -0,0 +1,107 @@
+package uma
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// KcVersion is the release of a Keycloak server
+type KcVersion struct {
+	Major int
+	Minor int
+	Patch int
+
+	// Legacy is true for the WildFly distribution of Keycloak 17 to 19, whose versions end with "-legacy"
+	Legacy bool
+}
+
+// ParseKcVersion parses versions such as "24", "21.1.2" or "17.0.1-legacy"
+func ParseKcVersion(s string) (KcVersion, error) {
+	v := KcVersion{}
+	rest := strings.TrimSpace(s)
+	if i := strings.IndexByte(rest, '-'); i >= 0 {
+		v.Legacy = rest[i+1:] == "legacy"
+		rest = rest[:i]
+	}
+	parts := strings.Split(rest, ".")
+	if len(parts) > 3 {
+		return KcVersion{}, fmt.Errorf("invalid Keycloak version %q", s)
+	}
+	nums := []*int{&v.Major, &v.Minor, &v.Patch}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return KcVersion{}, fmt.Errorf("invalid Keycloak version %q", s)
+		}
+		*nums[i] = n
+	}
+	if v.Major == 0 {
+		return KcVersion{}, fmt.Errorf("invalid Keycloak version %q", s)
+	}
+	return v, nil
+}
+
+func (v KcVersion) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.Legacy {
+		s += "-legacy"
+	}
+	return s
+}
+
+// AtLeast reports whether v is major.minor or later
+func (v KcVersion) AtLeast(major, minor int) bool {
+	return v.Major > major || (v.Major == major && v.Minor >= minor)
+}
+
+// ContextPath returns the path that the server is served under by default, which is "/auth" for the
+// WildFly distribution
+func (v KcVersion) ContextPath() string {
+	if v.Legacy || !v.AtLeast(17, 0) {
+		return "/auth"
+	}
+	return ""
+}
+
+// adminRoot returns the root of the admin API e.g. "https://kc.example.com/admin"
+func (p *KeycloakProvider) adminRoot() (string, error) {
+	if p.adminCreds != nil {
+		return p.adminCreds.AdminRoot(), nil
+	}
+	i := strings.LastIndex(p.issuer, "/realms/")
+	if i < 0 {
+		return "", fmt.Errorf("cannot derive admin endpoint from issuer %q", p.issuer)
+	}
+	return p.issuer[:i] + "/admin", nil
+}
+
+// Version returns the version given with WithKeycloakVersion. Otherwise the version is read from the server
+// info endpoint of the admin API and remembered. Unless WithKeycloakAdminCredentials is given, the service
+// account of the client needs the "view-system" role of the realm-management client, which is only found
+// in the master realm.
+func (p *KeycloakProvider) Version() (KcVersion, error) {
+	p.versionMu.Lock()
+	defer p.versionMu.Unlock()
+	if p.version != nil {
+		return *p.version, nil
+	}
+	root, err := p.adminRoot()
+	if err != nil {
+		return KcVersion{}, err
+	}
+	info := &struct {
+		SystemInfo struct {
+			Version string `json:"version"`
+		} `json:"systemInfo"`
+	}{}
+	if err := p.admin().GetObject(root+"/serverinfo", info); err != nil {
+		return KcVersion{}, err
+	}
+	v, err := ParseKcVersion(info.SystemInfo.Version)
+	if err != nil {
+		return KcVersion{}, err
+	}
+	p.version = &v
+	return v, nil
+}
@@ -0,0 +1,97 @@
+package uma_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/pckhoi/uma"
+	"github.com/pckhoi/uma/pkg/keycloak"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseKcVersion(t *testing.T) {
+	for _, c := range []struct {
+		s       string
+		v       uma.KcVersion
+		context string
+	}{
+		{"24", uma.KcVersion{Major: 24}, ""},
+		{"21.1.2", uma.KcVersion{Major: 21, Minor: 1, Patch: 2}, ""},
+		{"17.0.1-legacy", uma.KcVersion{Major: 17, Patch: 1, Legacy: true}, "/auth"},
+		{"16.1.1", uma.KcVersion{Major: 16, Minor: 1, Patch: 1}, "/auth"},
+		{"22.0.0-SNAPSHOT", uma.KcVersion{Major: 22}, ""},
+	} {
+		v, err := uma.ParseKcVersion(c.s)
+		require.NoError(t, err, c.s)
+		assert.Equal(t, c.v, v, c.s)
+		assert.Equal(t, c.context, v.ContextPath(), c.s)
+	}
+	for _, s := range []string{"", "latest", "1.2.3.4", "0.1"} {
+		_, err := uma.ParseKcVersion(s)
+		assert.EqualError(t, err, `invalid Keycloak version "`+s+`"`)
+	}
+	assert.True(t, uma.KcVersion{Major: 22, Minor: 1}.AtLeast(22, 0))
+	assert.False(t, uma.KcVersion{Major: 21, Minor: 9}.AtLeast(22, 0))
+	assert.Equal(t, "17.0.1-legacy", uma.KcVersion{Major: 17, Patch: 1, Legacy: true}.String())
+}
+
+func TestKeycloakVersion(t *testing.T) {
+	var issuer string
+	var paths []string
+	mux := http.NewServeMux()
+	writeJSON := func(w http.ResponseWriter, obj any) {
+		w.Header().Set("Content-Type", "application/json")
+		require.NoError(t, json.NewEncoder(w).Encode(obj))
+	}
+	mux.HandleFunc("/auth/realms/test/.well-known/uma2-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]string{"issuer": issuer, "token_endpoint": issuer + "/protocol/openid-connect/token"})
+	})
+	mux.HandleFunc("/auth/realms/test/protocol/openid-connect/token", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]any{"access_token": "pat", "expires_in": 300})
+	})
+	mux.HandleFunc("/auth/realms/master/protocol/openid-connect/token", func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		writeJSON(w, map[string]any{"access_token": "admin-token", "expires_in": 300})
+	})
+	mux.HandleFunc("/auth/admin/serverinfo", func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		writeJSON(w, map[string]any{"systemInfo": map[string]string{"version": "16.1.1"}})
+	})
+	s := httptest.NewServer(mux)
+	defer s.Close()
+	issuer = s.URL + "/auth/realms/test"
+
+	// the version is detected once
+	kp, err := uma.NewKeycloakProvider(issuer, "api", "secret", nil, testr.New(t), uma.WithKeycloakClient(s.Client()))
+	require.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		v, err := kp.Version()
+		require.NoError(t, err)
+		assert.Equal(t, uma.KcVersion{Major: 16, Minor: 1, Patch: 1}, v)
+	}
+	assert.Equal(t, []string{"/auth/admin/serverinfo"}, paths)
+
+	// admin credentials get the context path of the given version
+	paths = nil
+	kp, err = uma.NewKeycloakProvider(issuer, "api", "secret", nil, testr.New(t),
+		uma.WithKeycloakClient(s.Client()),
+		uma.WithKeycloakVersion("16.1.1"),
+		uma.WithKeycloakAdminCredentials(keycloak.AdminCredentials{ServerURL: s.URL, Username: "admin", Password: "admin"}),
+	)
+	require.NoError(t, err)
+	v, err := kp.Version()
+	require.NoError(t, err)
+	assert.Equal(t, 16, v.Major)
+	assert.Empty(t, paths)
+	_, err = kp.AdminEvents(uma.KcAdminEventQuery{})
+	assert.Error(t, err)
+	assert.Equal(t, []string{"/auth/realms/master/protocol/openid-connect/token"}, paths)
+
+	_, err = uma.NewKeycloakProvider(issuer, "api", "secret", nil, testr.New(t),
+		uma.WithKeycloakClient(s.Client()), uma.WithKeycloakVersion("latest"))
+	assert.EqualError(t, err, `invalid Keycloak version "latest"`)
+}
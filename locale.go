@@ -0,0 +1,76 @@
+package uma
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// parseAcceptLanguage returns language tags of an Accept-Language header, most preferred first
+func parseAcceptLanguage(header string) []string {
+	type weighted struct {
+		tag string
+		q   float64
+	}
+	langs := []weighted{}
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		tag = strings.TrimSpace(tag)
+		if tag == "" || tag == "*" {
+			continue
+		}
+		q := 1.0
+		if params = strings.TrimSpace(params); strings.HasPrefix(params, "q=") {
+			if f, err := strconv.ParseFloat(params[2:], 64); err == nil {
+				q = f
+			}
+		}
+		if q <= 0 {
+			continue
+		}
+		langs = append(langs, weighted{tag, q})
+	}
+	sort.SliceStable(langs, func(i, j int) bool {
+		return langs[i].q > langs[j].q
+	})
+	tags := make([]string, len(langs))
+	for i, l := range langs {
+		tags[i] = l.tag
+	}
+	return tags
+}
+
+func baseLanguage(tag string) string {
+	base, _, _ := strings.Cut(tag, "-")
+	return base
+}
+
+// matchLocale returns the value of localized whose locale best matches the preferred languages. A
+// language matches a locale if they are equal, or if either of them is the base language of the
+// other e.g. "fr-CA" matches "fr" and "fr" matches "fr-FR".
+func matchLocale(languages []string, localized map[string]string) (string, bool) {
+	for _, lang := range languages {
+		for locale, v := range localized {
+			if strings.EqualFold(locale, lang) {
+				return v, true
+			}
+		}
+		for locale, v := range localized {
+			if strings.EqualFold(locale, baseLanguage(lang)) {
+				return v, true
+			}
+		}
+		var candidates []string
+		for locale := range localized {
+			if strings.EqualFold(baseLanguage(locale), lang) {
+				candidates = append(candidates, locale)
+			}
+		}
+		if len(candidates) > 0 {
+			// pick deterministically among regional variants
+			sort.Strings(candidates)
+			return localized[candidates[0]], true
+		}
+	}
+	return "", false
+}
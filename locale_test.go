@@ -0,0 +1,72 @@
+package uma_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/pckhoi/uma"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocalizedResource(t *testing.T) {
+	matcher := uma.NewMatcher(
+		map[string]uma.ResourceType{
+			"user": {Type: "user", IconUri: "https://www.example.com/user.png", ResourceScopes: []string{"read"}},
+		},
+		[]string{"oidc"},
+		nil,
+		[]map[string][]string{{"oidc": {"read"}}},
+		[]uma.Path{
+			uma.NewPath("/{id}", uma.NewResourceTemplate("user", "User {id}",
+				uma.WithTemplateDisplayName("User {id}"),
+				uma.WithTemplateLocalizedDisplayNames(map[string]string{
+					"fr":    "Utilisateur {id}",
+					"pt-BR": "Usuário {id}",
+					"pt-PT": "Utilizador {id}",
+				}),
+				uma.WithTemplateLocalizedIconURIs(map[string]string{
+					"fr": "https://www.example.com/fr/user-{id}.png",
+				}),
+			), map[string]uma.Operation{http.MethodGet: {}}),
+		},
+	)
+	var rsc uma.Resource
+	man := uma.NewFromMatcher(uma.ManagerOptions{
+		GetBaseURL: func(r *http.Request) url.URL {
+			return url.URL{Scheme: "https", Host: "api.example.com"}
+		},
+		CustomEnforce: func(r *http.Request, resource uma.Resource, scopes []string) bool {
+			rsc = resource
+			return true
+		},
+	}, matcher, testr.New(t))
+	h := man.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for _, c := range []struct {
+		acceptLanguage string
+		displayName    string
+		iconURI        string
+	}{
+		{"", "User 1", "https://www.example.com/user.png"},
+		{"de", "User 1", "https://www.example.com/user.png"},
+		{"fr", "Utilisateur 1", "https://www.example.com/fr/user-1.png"},
+		{"fr-CA, en;q=0.8", "Utilisateur 1", "https://www.example.com/fr/user-1.png"},
+		{"en;q=0.5, fr;q=0.9", "Utilisateur 1", "https://www.example.com/fr/user-1.png"},
+		{"fr;q=0, pt-PT", "Utilizador 1", "https://www.example.com/user.png"},
+		{"PT-br", "Usuário 1", "https://www.example.com/user.png"},
+		{"pt", "Usuário 1", "https://www.example.com/user.png"},
+		{"*", "User 1", "https://www.example.com/user.png"},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "https://api.example.com/1", nil)
+		if c.acceptLanguage != "" {
+			r.Header.Set("Accept-Language", c.acceptLanguage)
+		}
+		h.ServeHTTP(httptest.NewRecorder(), r)
+		assert.Equal(t, "User 1", rsc.Name, c.acceptLanguage)
+		assert.Equal(t, c.displayName, rsc.DisplayName, c.acceptLanguage)
+		assert.Equal(t, c.iconURI, rsc.IconUri, c.acceptLanguage)
+	}
+}
@@ -0,0 +1,172 @@
+package uma
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+const (
+	backChannelLogoutEvent = "http://schemas.openid.net/event/backchannel-logout"
+
+	defaultLogoutRetention = time.Hour
+	defaultLogoutCacheSize = 10000
+
+	// maxLogoutTokenAge is how old logout tokens can be. Their jti is remembered for that long, plus
+	// logoutTokenLeeway, to reject replays.
+	maxLogoutTokenAge = 5 * time.Minute
+
+	// logoutTokenLeeway is the clock skew tolerated between the provider and the Manager
+	logoutTokenLeeway = time.Minute
+)
+
+// ErrLoggedOut is returned when a token was issued to a subject or session that has logged out since
+var ErrLoggedOut = errors.New("token was issued before logout")
+
+type logoutClaims struct {
+	Iss    string                     `json:"iss"`
+	Aud    audienceClaim              `json:"aud,omitempty"`
+	Sub    string                     `json:"sub,omitempty"`
+	Sid    string                     `json:"sid,omitempty"`
+	Iat    int                        `json:"iat,omitempty"`
+	Exp    int                        `json:"exp,omitempty"`
+	Jti    string                     `json:"jti,omitempty"`
+	Nonce  *string                    `json:"nonce,omitempty"`
+	Events map[string]json.RawMessage `json:"events"`
+}
+
+func logoutKey(issuer, kind, id string) string {
+	return issuer + " " + kind + " " + id
+}
+
+// Logout invalidates tokens of subject sub or session sid, issued by p before now. Either can be empty.
+// Invalidated tokens are rejected even if their verification is cached, for ManagerOptions.LogoutRetention.
+func (m *Manager) Logout(p Provider, sub, sid string) {
+	issuer := p.WWWAuthenticateDirectives().AsUri
+	now := m.clock.Now()
+	if sub != "" {
+		m.logouts.set(logoutKey(issuer, "sub", sub), now, m.logoutRetention)
+	}
+	if sid != "" {
+		m.logouts.set(logoutKey(issuer, "sid", sid), now, m.logoutRetention)
+	}
+	m.logger.Info("logged out", "sub", sub, "sid", sid)
+}
+
+// checkLogout returns ErrLoggedOut if payload belongs to a subject or session that logged out after
+// the token was issued
+func (m *Manager) checkLogout(p Provider, payload []byte) error {
+	if m.logouts.len() == 0 {
+		return nil
+	}
+	claims := logoutClaims{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return err
+	}
+	issuer := p.WWWAuthenticateDirectives().AsUri
+	iat := time.Unix(int64(claims.Iat), 0)
+	for _, key := range []string{logoutKey(issuer, "sub", claims.Sub), logoutKey(issuer, "sid", claims.Sid)} {
+		// tokens without iat are treated as issued before logout
+		if at, ok := m.logouts.get(key); ok && (claims.Iat == 0 || !iat.After(at)) {
+			return ErrLoggedOut
+		}
+	}
+	return nil
+}
+
+// logoutAudiences returns the audiences logout tokens of p must be issued to: ManagerOptions.ExpectedAudiences
+// if set, otherwise the client id of p if it has one
+func (m *Manager) logoutAudiences(p Provider) []string {
+	if len(m.expectedAudiences) > 0 {
+		return m.expectedAudiences
+	}
+	if cp, ok := p.(interface {
+		Credentials() (issuer, clientID, clientSecret string)
+	}); ok {
+		if _, clientID, _ := cp.Credentials(); clientID != "" {
+			return []string{clientID}
+		}
+	}
+	return nil
+}
+
+// validateLogoutToken checks the claims of a logout token as required by OpenID Connect Back-Channel
+// Logout, section 2.6, and rejects tokens that are stale or already used
+func (m *Manager) validateLogoutToken(p Provider, claims logoutClaims) error {
+	if _, ok := claims.Events[backChannelLogoutEvent]; !ok {
+		return errors.New("missing backchannel logout event")
+	}
+	if claims.Nonce != nil {
+		return errors.New("nonce is not allowed")
+	}
+	if claims.Sub == "" && claims.Sid == "" {
+		return errors.New("missing sub and sid")
+	}
+	issuer := p.WWWAuthenticateDirectives().AsUri
+	if claims.Iss != issuer {
+		return errors.New("issuer mismatch")
+	}
+	if !claims.Aud.contains(m.logoutAudiences(p)) {
+		return errors.New("audience mismatch")
+	}
+	now := m.clock.Now()
+	iat := time.Unix(int64(claims.Iat), 0)
+	if claims.Iat == 0 || iat.Before(now.Add(-maxLogoutTokenAge)) || iat.After(now.Add(logoutTokenLeeway)) {
+		return errors.New("stale or missing iat")
+	}
+	if claims.Exp != 0 && !now.Before(time.Unix(int64(claims.Exp), 0).Add(logoutTokenLeeway)) {
+		return errors.New("token expired")
+	}
+	if claims.Jti == "" {
+		return errors.New("missing jti")
+	}
+	key := logoutKey(issuer, "jti", claims.Jti)
+	m.logoutJTIsMu.Lock()
+	defer m.logoutJTIsMu.Unlock()
+	if _, ok := m.logoutJTIs.get(key); ok {
+		return errors.New("token replayed")
+	}
+	m.logoutJTIs.set(key, iat, maxLogoutTokenAge+logoutTokenLeeway)
+	return nil
+}
+
+// BackChannelLogout returns a handler of OpenID Connect back-channel logout requests, which is to be
+// registered as the backchannel logout URL of the client, e.g. in Keycloak client settings. The logout
+// token is verified with the provider returned by ManagerOptions.GetProvider, then Logout is called with
+// its subject and session. Its aud must contain one of ManagerOptions.ExpectedAudiences if set, or else
+// the client id of providers with a Credentials method such as KeycloakProvider, so tokens are rejected
+// if neither is known. Tokens issued more than 5 minutes ago and replayed tokens, by jti, are rejected.
+func (m *Manager) BackChannelLogout() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		if r.Method != http.MethodPost {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		token := r.PostFormValue("logout_token")
+		if token == "" {
+			http.Error(w, "logout_token is missing", http.StatusBadRequest)
+			return
+		}
+		p := m.getProvider(r)
+		payload, err := p.VerifySignature(r.Context(), token)
+		if err != nil {
+			m.logger.Info("invalid logout token signature", "error", err.Error())
+			http.Error(w, "invalid logout token", http.StatusBadRequest)
+			return
+		}
+		claims := logoutClaims{}
+		if err := json.Unmarshal(payload, &claims); err != nil {
+			http.Error(w, "invalid logout token", http.StatusBadRequest)
+			return
+		}
+		if err := m.validateLogoutToken(p, claims); err != nil {
+			m.logger.Info("invalid logout token", "error", err.Error())
+			http.Error(w, "invalid logout token", http.StatusBadRequest)
+			return
+		}
+		m.Logout(p, claims.Sub, claims.Sid)
+		w.WriteHeader(http.StatusOK)
+	})
+}
@@ -0,0 +1,143 @@
+package uma_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pckhoi/uma"
+	"github.com/pckhoi/uma/pkg/clock"
+	"github.com/stretchr/testify/assert"
+)
+
+// sessionPayload returns a token payload of session sid that grants read on User 1
+func sessionPayload(sub, sid string, iat time.Time) string {
+	return fmt.Sprintf(
+		`{"sub":%q,"sid":%q,"iat":%d,"exp":%d,"authorization":{"permissions":[{"rsid":"rsc-User 1","rsname":"User 1","scopes":["read"]}]}}`,
+		sub, sid, iat.Unix(), iat.Add(2*time.Hour).Unix(),
+	)
+}
+
+// logoutToken returns the payload of a logout token issued to client "api" at iat
+func logoutToken(sub, sid string, iat time.Time, jti string) string {
+	return fmt.Sprintf(
+		`{"iss":"https://as.example.com","aud":"api","sub":%q,"sid":%q,"iat":%d,"jti":%q,"events":{"http://schemas.openid.net/event/backchannel-logout":{}}}`,
+		sub, sid, iat.Unix(), jti,
+	)
+}
+
+// clientProvider is a mockProvider that tells its client id, like KeycloakProvider
+type clientProvider struct {
+	*mockProvider
+}
+
+func (p clientProvider) Credentials() (issuer, clientID, clientSecret string) {
+	return "https://as.example.com", "api", "secret"
+}
+
+func postLogout(h http.Handler, token string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/logout", strings.NewReader(url.Values{"logout_token": {token}}.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	return rec
+}
+
+func TestBackChannelLogout(t *testing.T) {
+	c := clock.NewFake(time.Now())
+	p := clientProvider{newMockProvider(map[string]string{
+		"token-1":  sessionPayload("user-1", "session-1", c.Now()),
+		"token-2":  sessionPayload("user-2", "session-2", c.Now()),
+		"logout-1": logoutToken("", "session-1", c.Now(), "jti-1"),
+		"id-token": `{"iss":"https://as.example.com","aud":"api","sub":"user-2","nonce":"abc"}`,
+	})}
+	man := newMockManager(t, p, uma.ManagerOptions{TokenCacheSize: 10, Clock: c})
+	h := man.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	logout := man.BackChannelLogout()
+
+	for _, token := range []string{"token-1", "token-2"} {
+		assert.Equal(t, http.StatusOK, serve(h, http.MethodGet, "https://api.example.com/users/1", token).Code)
+	}
+
+	c.Advance(time.Second)
+	rec := postLogout(logout, "logout-1")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "no-store", rec.Header().Get("Cache-Control"))
+
+	// the cached verification of token-1 is no longer used
+	assert.Equal(t, http.StatusUnauthorized, serve(h, http.MethodGet, "https://api.example.com/users/1", "token-1").Code)
+	assert.Equal(t, http.StatusOK, serve(h, http.MethodGet, "https://api.example.com/users/1", "token-2").Code)
+
+	// tokens issued after logout are accepted
+	c.Advance(2 * time.Second)
+	p.mu.Lock()
+	p.tokens["token-3"] = sessionPayload("user-1", "session-1", c.Now())
+	p.mu.Unlock()
+	assert.Equal(t, http.StatusOK, serve(h, http.MethodGet, "https://api.example.com/users/1", "token-3").Code)
+
+	// logout is forgotten after LogoutRetention
+	c.Advance(time.Hour)
+	assert.Equal(t, http.StatusOK, serve(h, http.MethodGet, "https://api.example.com/users/1", "token-1").Code)
+
+	assert.Equal(t, http.StatusBadRequest, postLogout(logout, "").Code)
+	assert.Equal(t, http.StatusBadRequest, postLogout(logout, "forged").Code)
+	assert.Equal(t, http.StatusBadRequest, postLogout(logout, "id-token").Code)
+	assert.Equal(t, http.StatusOK, serve(h, http.MethodGet, "https://api.example.com/users/1", "token-2").Code)
+}
+
+func TestBackChannelLogoutValidation(t *testing.T) {
+	c := clock.NewFake(time.Now())
+	now := c.Now()
+	event := `"events":{"http://schemas.openid.net/event/backchannel-logout":{}}`
+	tokens := map[string]string{
+		"valid":        logoutToken("user-1", "", now, "jti-1"),
+		"aud-array":    fmt.Sprintf(`{"iss":"https://as.example.com","aud":["other","api"],"sub":"user-1","iat":%d,"jti":"jti-2",%s}`, now.Unix(), event),
+		"wrong-aud":    fmt.Sprintf(`{"iss":"https://as.example.com","aud":"other","sub":"user-1","iat":%d,"jti":"jti-3",%s}`, now.Unix(), event),
+		"missing-aud":  fmt.Sprintf(`{"iss":"https://as.example.com","sub":"user-1","iat":%d,"jti":"jti-4",%s}`, now.Unix(), event),
+		"stale":        logoutToken("user-1", "", now.Add(-10*time.Minute), "jti-5"),
+		"future":       logoutToken("user-1", "", now.Add(10*time.Minute), "jti-6"),
+		"missing-iat":  fmt.Sprintf(`{"iss":"https://as.example.com","aud":"api","sub":"user-1","jti":"jti-7",%s}`, event),
+		"missing-jti":  logoutToken("user-1", "", now, ""),
+		"expired":      fmt.Sprintf(`{"iss":"https://as.example.com","aud":"api","sub":"user-1","iat":%d,"exp":%d,"jti":"jti-8",%s}`, now.Unix(), now.Add(-2*time.Minute).Unix(), event),
+		"other-issuer": strings.Replace(logoutToken("user-1", "", now, "jti-9"), "as.example.com", "evil.example.com", 1),
+	}
+	p := clientProvider{newMockProvider(tokens)}
+	logout := newMockManager(t, p, uma.ManagerOptions{Clock: c}).BackChannelLogout()
+
+	assert.Equal(t, http.StatusOK, postLogout(logout, "valid").Code)
+	assert.Equal(t, http.StatusOK, postLogout(logout, "aud-array").Code)
+	for _, token := range []string{"wrong-aud", "missing-aud", "stale", "future", "missing-iat", "missing-jti", "expired", "other-issuer"} {
+		assert.Equal(t, http.StatusBadRequest, postLogout(logout, token).Code, token)
+	}
+
+	// replays are rejected until the token is too old to be accepted anyway
+	assert.Equal(t, http.StatusBadRequest, postLogout(logout, "valid").Code)
+	c.Advance(2 * time.Minute)
+	assert.Equal(t, http.StatusBadRequest, postLogout(logout, "valid").Code)
+
+	// ExpectedAudiences replaces the client id
+	logout = newMockManager(t, p, uma.ManagerOptions{Clock: c, ExpectedAudiences: []string{"other"}}).BackChannelLogout()
+	assert.Equal(t, http.StatusOK, postLogout(logout, "wrong-aud").Code)
+	assert.Equal(t, http.StatusBadRequest, postLogout(logout, "valid").Code)
+
+	// tokens can't be validated without knowing the client id
+	logout = newMockManager(t, p.mockProvider, uma.ManagerOptions{Clock: c}).BackChannelLogout()
+	assert.Equal(t, http.StatusBadRequest, postLogout(logout, "aud-array").Code)
+}
+
+func TestManagerLogoutSubject(t *testing.T) {
+	c := clock.NewFake(time.Now())
+	p := newMockProvider(map[string]string{
+		"token-1": sessionPayload("user-1", "session-1", c.Now()),
+	})
+	man := newMockManager(t, p, uma.ManagerOptions{Clock: c})
+	h := man.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	assert.Equal(t, http.StatusOK, serve(h, http.MethodGet, "https://api.example.com/users/1", "token-1").Code)
+
+	man.Logout(p, "user-1", "")
+	assert.Equal(t, http.StatusUnauthorized, serve(h, http.MethodGet, "https://api.example.com/users/1", "token-1").Code)
+}
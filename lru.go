@@ -0,0 +1,128 @@
+package uma
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"time"
+)
+
+type lruEntry[V any] struct {
+	key     string
+	val     V
+	expires time.Time
+}
+
+// lruCache is a size bounded cache that evicts the least recently used entries first. Entries
+// also expire after their ttl.
+type lruCache[V any] struct {
+	mu        sync.Mutex
+	size      int
+	ll        *list.List
+	items     map[string]*list.Element
+	now       func() time.Time
+	hits      uint64
+	misses    uint64
+	evictions uint64
+	purged    uint64
+}
+
+func newLRUCache[V any](size int) *lruCache[V] {
+	return &lruCache[V]{
+		size:  size,
+		ll:    list.New(),
+		items: map[string]*list.Element{},
+		now:   time.Now,
+	}
+}
+
+func (c *lruCache[V]) get(key string) (val V, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[key]
+	if !ok {
+		c.misses++
+		return val, false
+	}
+	ent := el.Value.(*lruEntry[V])
+	if !c.now().Before(ent.expires) {
+		c.removeElement(el)
+		c.misses++
+		return val, false
+	}
+	c.ll.MoveToFront(el)
+	c.hits++
+	return ent.val, true
+}
+
+func (c *lruCache[V]) set(key string, val V, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	expires := c.now().Add(ttl)
+	if el, ok := c.items[key]; ok {
+		ent := el.Value.(*lruEntry[V])
+		ent.val = val
+		ent.expires = expires
+		c.ll.MoveToFront(el)
+		return
+	}
+	c.items[key] = c.ll.PushFront(&lruEntry[V]{key: key, val: val, expires: expires})
+	for c.ll.Len() > c.size {
+		c.removeElement(c.ll.Back())
+		c.evictions++
+	}
+}
+
+func (c *lruCache[V]) remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		c.removeElement(el)
+	}
+}
+
+// len returns the number of entries, including expired ones
+func (c *lruCache[V]) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
+
+// Stats returns the counters of the cache
+func (c *lruCache[V]) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return CacheStats{
+		Entries:   c.ll.Len(),
+		Hits:      c.hits,
+		Misses:    c.misses,
+		Evictions: c.evictions,
+		Purged:    c.purged,
+	}
+}
+
+// Purge removes entries whose key starts with prefix, or all entries if prefix is empty
+func (c *lruCache[V]) Purge(prefix string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	if prefix == "" {
+		n = c.ll.Len()
+		c.ll.Init()
+		c.items = map[string]*list.Element{}
+	} else {
+		for key, el := range c.items {
+			if strings.HasPrefix(key, prefix) {
+				c.removeElement(el)
+				n++
+			}
+		}
+	}
+	c.purged += uint64(n)
+	return n
+}
+
+func (c *lruCache[V]) removeElement(el *list.Element) {
+	c.ll.Remove(el)
+	delete(c.items, el.Value.(*lruEntry[V]).key)
+}
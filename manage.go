@@ -1,16 +1,23 @@
 package uma
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/go-logr/logr"
+	"github.com/pckhoi/uma/pkg/clock"
+	"github.com/pckhoi/uma/pkg/httputil"
 )
 
-// ResourceStore persists resource name and id as registered with the provider
+// ResourceStore persists resource name and id as registered with the provider. Names are prefixed with
+// the issuer if ManagerOptions.ResourceStoreKeyByIssuer is set.
 type ResourceStore interface {
 	// Set resource id associated with given name
 	Set(name, id string) error
@@ -22,21 +29,68 @@ type ResourceStore interface {
 }
 
 type Manager struct {
-	getBaseURL               func(r *http.Request) url.URL
-	getProvider              func(r *http.Request) Provider
-	getResourceStore         func(r *http.Request) ResourceStore
-	includeScopes            bool
-	disableExpireCheck       bool
-	paths                    []Path
-	types                    map[string]ResourceType
-	securitySchemes          map[string]struct{}
-	defaultRscTmpl           *ResourceTemplate
-	defaultSecurity          Security
-	getResourceName          func(r *http.Request, rsc Resource) string
-	customEnforce            func(r *http.Request, resource Resource, scopes []string) bool
-	editUnauthorizedResponse func(rw http.ResponseWriter)
-	anonymousScopes          func(r *http.Request, resource Resource) (scopes []string)
-	logger                   logr.Logger
+	getBaseURL                  func(r *http.Request) url.URL
+	getBaseURLs                 func(r *http.Request) []url.URL
+	pathRewrite                 func(path string) string
+	stripForwardedPrefix        bool
+	getProvider                 func(r *http.Request) Provider
+	getResourceStore            func(r *http.Request) ResourceStore
+	resourceCache               ResourceCache
+	resourceCacheTTL            time.Duration
+	resourceCacheNegativeTTL    time.Duration
+	storeKeyByIssuer            bool
+	storeMigrateIssuer          string
+	registrations               flightGroup
+	includeScopes               bool
+	disableExpireCheck          bool
+	matcher                     atomic.Pointer[Matcher]
+	getResourceName             func(r *http.Request, rsc Resource) string
+	nameStrategy                NameStrategy
+	namespace                   string
+	ownerFromRequest            func(r *http.Request) string
+	customEnforce               func(r *http.Request, resource Resource, scopes []string) bool
+	editUnauthorizedResponse    func(rw http.ResponseWriter)
+	anonymousScopes             func(r *http.Request, resource Resource) (scopes []string)
+	resourceFromBody            func(r *http.Request) (*Resource, error)
+	templates                   *Templates
+	maxBufferedBodySize         int64
+	maxDecisionLatency          time.Duration
+	decisionLatencyReportOnly   bool
+	editLatencyExceededResponse func(rw http.ResponseWriter)
+	observeDecisionLatency      func(r *http.Request, timing DecisionTiming)
+	tokenCache                  *tokenCache
+	logouts                     *lruCache[time.Time]
+	logoutJTIs                  *lruCache[time.Time]
+	logoutJTIsMu                sync.Mutex
+	logoutRetention             time.Duration
+	deregisterOnShutdown        bool
+	corsAllowedOrigins          map[string]struct{}
+	bindTicketsToClient         bool
+	getTicketClaims             func(r *http.Request) map[string]any
+	tokenBinding                *TokenBinding
+	expectedAudiences           []string
+	permissionClaimPath         []string
+	verifyPermissionNames       bool
+	requirePermissionNames      bool
+	challengeErrors             bool
+	denialMapper                DenialMapper
+	rptRefresh                  *RPTRefresh
+	auditSink                   AuditSink
+	decisionRecorder            DecisionRecorder
+	redactParams                map[string]bool
+	shadowProvider              func(r *http.Request) Provider
+	shadowResourceStore         ResourceStore
+	onShadowDivergence          func(div ShadowDivergence)
+	shadowSlots                 chan struct{}
+	shadowTimeout               time.Duration
+	shadowDropped               atomic.Uint64
+	providerLimiter             *providerLimiter
+	clock                       clock.Clock
+	bgMu                        sync.Mutex
+	bgWG                        sync.WaitGroup
+	shuttingDown                bool
+	created                     []createdResource
+	logger                      logr.Logger
 }
 
 type ManagerOptions struct {
@@ -44,17 +98,61 @@ type ManagerOptions struct {
 	// server entry in openapi spec. It should have this format: "{SCHEME}://{PUBLIC_HOSTNAME}{ANY_BASE_PATH}"
 	GetBaseURL func(r *http.Request) url.URL
 
-	// GetProvider returns the provider info given the request. It allows you to use different UMA
-	// providers for different requests if you so wish
+	// GetBaseURLs if defined, is used in place of GetBaseURL when the api is mounted at several base
+	// urls, e.g. the spec lists several server entries for v1 and v2 prefixes or regional hosts. Base
+	// urls are tried in order, the first one whose path is a prefix of the request path and whose
+	// remaining path matches a path template wins.
+	GetBaseURLs func(r *http.Request) []url.URL
+
+	// PathRewrite if defined, rewrites request paths before they are matched against path templates, e.g.
+	// when an ingress forwards "/svc/users/1" but the api is documented and registered as "/users/1".
+	// Resource uris are composed from the base url and the rewritten path.
+	PathRewrite func(path string) string
+
+	// StripForwardedPrefix if true, removes the prefix given in the X-Forwarded-Prefix header from request
+	// paths before PathRewrite and matching. Paths that don't start with the prefix are left as is. Only
+	// enable it behind a proxy that sets or clears this header, otherwise clients can choose which path
+	// template their requests are matched against.
+	StripForwardedPrefix bool
+
+	// GetProvider returns the provider given the request. It allows you to use different UMA
+	// providers for different requests if you so wish. Providers are never constructed by the
+	// Manager, so this can return any existing Provider instance, e.g. a KeycloakProvider with a
+	// custom http client, a mock in tests or a provider wrapped with additional behavior.
 	GetProvider func(r *http.Request) Provider
 
 	// ResourceStore persistently stores resource name and id. This tells the middleware which resource
-	// is already registered so it doesn't have to be registered again.
+	// is already registered so it doesn't have to be registered again. Stores that implement
+	// ResourceHashStore also let the middleware update registrations whose definition changed.
 	GetResourceStore func(r *http.Request) ResourceStore
 
+	// ResourceCache if defined, is consulted before the ResourceStore and the provider when
+	// registering a resource. It is meant to be shared by all replicas of the resource server.
+	ResourceCache ResourceCache
+
+	// ResourceStoreKeyByIssuer if true, keys ResourceStore entries by the issuer of the provider followed
+	// by a space and the resource name, like ResourceCache keys, instead of the resource name alone. Set it
+	// when resources of several issuers share one store, so that resources with the same name don't
+	// collide.
+	ResourceStoreKeyByIssuer bool
+
+	// ResourceStoreMigrateIssuer is the issuer that entries saved before ResourceStoreKeyByIssuer was set
+	// belong to. Missing entries of this issuer are looked up under the resource name alone, and copied
+	// under their new key.
+	ResourceStoreMigrateIssuer string
+
+	// ResourceCacheTTL is how long resource ids are kept in ResourceCache. Defaults to 24 hours.
+	ResourceCacheTTL time.Duration
+
+	// ResourceCacheNegativeTTL is how long failed registrations are remembered in ResourceCache.
+	// During this time, requests to the same resource fail without contacting the provider.
+	// Defaults to 10 seconds.
+	ResourceCacheNegativeTTL time.Duration
+
 	// Includes scopes in permission ticket in order to be granted specific scopes (the currently needed scopes)
 	// on a resource. If scopes are not included, the authorization server might decides to grant all scopes
-	// on the request resource.
+	// on the request resource. It can be overridden per template with WithTemplateIncludeScopes, per
+	// operation with Operation.IncludeScopes, and at runtime with TemplateOptions.IncludeScopes.
 	IncludeScopesInPermissionTicket bool
 
 	// Skip token expiration check during token validation. This is only useful during testing, don't set
@@ -66,6 +164,22 @@ type ManagerOptions struct {
 	// should only be used when that is not possible.
 	GetResourceName func(r *http.Request, rsc Resource) string
 
+	// NameStrategy if defined, is applied to resource names after they are rendered (and after
+	// GetResourceName), before resources are looked up in the ResourceStore and registered with
+	// the provider. Use it to keep names unique when several services share one client.
+	NameStrategy NameStrategy
+
+	// Namespace if set, prefixes resource names with the namespace and NamespaceSeparator after
+	// NameStrategy is applied, so that resource servers sharing one client, and one ResourceStore, don't
+	// clobber each other's resources. List the resources of a namespace with ListNamespaceResources.
+	Namespace string
+
+	// OwnerFromRequest if defined, returns the owner of resources that are about to be registered. If
+	// the request carries a valid token, i.e. one that is signed, unexpired, issued to one of
+	// ExpectedAudiences and bound per TokenBinding, its claims can be retrieved with GetClaims.
+	// OwnerFromClaims is a ready-made implementation that returns the token subject.
+	OwnerFromRequest func(r *http.Request) string
+
 	// CustomEnforce handler if defined, cut the UMA provider out of the flow entirely, and allows deciding access
 	// with custom logic. If the handler return true, allow the request to come through. Otherwise, responds with 401.
 	CustomEnforce func(r *http.Request, resource Resource, scopes []string) bool
@@ -79,6 +193,166 @@ type ManagerOptions struct {
 	// accessed and should return the scopes available to anonymous users. If the scopes are sufficient, the user
 	// is allowed to access. Otherwise an UMA ticket is created and returned in 401 response as usual.
 	AnonymousScopes func(r *http.Request, resource Resource) (scopes []string)
+
+	// ResourceFromBody if defined, is invoked for protected operations to identify the resource from the
+	// request body, which is useful for RPC-style APIs that put entity ids in the body. If it returns a
+	// resource, that resource is enforced instead of the one rendered from the path template. If it
+	// returns nil, the path template is used as usual. If it returns an error, the middleware responds
+	// with 400. The body is buffered in memory and rewound, so the hook and the next handler can both
+	// read it in full.
+	ResourceFromBody func(r *http.Request) (*Resource, error)
+
+	// Templates if set, holds runtime overrides of path templates, which can disable a path, change its
+	// required scopes, or make it public without regenerating code.
+	Templates *Templates
+
+	// MaxBufferedBodySize is the largest request body buffered for ResourceFromBody. Requests with
+	// larger bodies are rejected with 413. Defaults to 1 MiB.
+	MaxBufferedBodySize int64
+
+	// MaxDecisionLatency if greater than zero, is the time budget for deciding whether a request is
+	// allowed, including resource matching, token verification and round trips to the authorization
+	// server. When the budget runs out, the middleware stops waiting for the decision and responds
+	// with 503 and a Retry-After header, unless DecisionLatencyReportOnly is true.
+	MaxDecisionLatency time.Duration
+
+	// DecisionLatencyReportOnly if true, always waits for decisions to finish. Decisions that exceed
+	// MaxDecisionLatency are only logged and reported to ObserveDecisionLatency.
+	DecisionLatencyReportOnly bool
+
+	// EditLatencyExceededResponse if defined, writes the response for requests whose decision exceeds
+	// MaxDecisionLatency, in place of the default 503 response.
+	EditLatencyExceededResponse func(rw http.ResponseWriter)
+
+	// ObserveDecisionLatency if defined, is invoked with the timing of every decision. Use it to
+	// record latency metrics, e.g. in a histogram labeled by scopes.
+	ObserveDecisionLatency func(r *http.Request, timing DecisionTiming)
+
+	// TokenCacheSize if greater than zero, enables memoization of token signature verification for
+	// at most this many tokens. It is useful when most requests carry one of a few tokens e.g.
+	// service tokens. Expiration and permissions are still checked on every request.
+	TokenCacheSize int
+
+	// TokenCacheTTL is how long a verification result is memoized. Defaults to 5 minutes.
+	TokenCacheTTL time.Duration
+
+	// LogoutRetention is how long Logout and BackChannelLogout keep rejecting tokens issued before
+	// logout. It should be at least the lifespan of access tokens. Defaults to 1 hour.
+	LogoutRetention time.Duration
+
+	// DeregisterOnShutdown if true, treats resources registered by the Manager as ephemeral: they are
+	// deleted from the provider during Shutdown. Only use it with a ResourceStore and ResourceCache that
+	// don't outlive the Manager, e.g. in tests and preview environments, otherwise they would keep ids
+	// of deleted resources.
+	DeregisterOnShutdown bool
+
+	// CORSAllowedOrigins if not empty, makes UMA challenges readable by browser apps served from these
+	// origins. Responses to requests from allowed origins mirror the origin in
+	// Access-Control-Allow-Origin and expose the WWW-Authenticate header. "*" allows any origin. CORS
+	// preflight requests are also let through without enforcement, so the next handler can answer
+	// them.
+	CORSAllowedOrigins []string
+
+	// BindTicketsToClient if true, pushes the client IP and a fingerprint of the client's User-Agent and
+	// Accept-Language headers as claims (see ClientIPClaim and ClientFingerprintClaim) with every permission
+	// request, so they are attached to the ticket for auditing and can be evaluated by authorization
+	// policies. It requires a provider that implements ClaimPushingProvider.
+	BindTicketsToClient bool
+
+	// TicketClaims if defined, returns claims to push with every permission request, so that
+	// authorization policies can evaluate the request context when the RPT is issued, e.g. the tenant
+	// or the time of the request. Values are pushed as strings: slices are pushed element by element,
+	// other values are formatted with fmt.Sprint. Claims override those of BindTicketsToClient with the
+	// same name. It requires a provider that implements ClaimPushingProvider.
+	TicketClaims func(r *http.Request) map[string]any
+
+	// ChallengeErrors if true, adds error and error_description parameters as defined by RFC 6750 to UMA
+	// challenges, e.g. error="invalid_token" for expired tokens and error="insufficient_scope" for tokens
+	// without the required permission. Client SDKs use them to choose between logging in again and
+	// exchanging the ticket. Requests without token get no error, as the RFC recommends.
+	ChallengeErrors bool
+
+	// DenialMapper if defined, maps denied requests to their status code and body, e.g. to respond with 403
+	// when the token lacks scopes. It takes precedence over EditUnauthorizedResponse. See
+	// DefaultDenialMapper, and NewDenialContentMapper to write bodies in the format the client accepts.
+	DenialMapper DenialMapper
+
+	// ExpectedAudiences if set, denies tokens that were not minted for one of these audiences, usually the
+	// client id of the resource server, so that tokens of other clients can't be replayed against the API.
+	// A token matches if its aud claim, or its azp claim as Keycloak only adds clients to aud with an
+	// audience mapper, is one of ExpectedAudiences.
+	ExpectedAudiences []string
+
+	// PermissionClaimPath is the path of the claim that holds the permissions of RPTs, for authorization
+	// servers whose tokens differ from Keycloak's, e.g. []string{"permissions"}. Defaults to
+	// []string{"authorization", "permissions"}. See RPT.ReadPermissions.
+	PermissionClaimPath []string
+
+	// VerifyPermissionNames if true, denies tokens whose permission for the id of the matched resource
+	// names another resource in rsname, e.g. because the id in the ResourceStore is stale, instead of
+	// trusting the id alone. Permissions without rsname are accepted.
+	VerifyPermissionNames bool
+
+	// RequirePermissionNames if true, is VerifyPermissionNames that also denies permissions without
+	// rsname. Only use it if the RPTs always include resource names, which Keycloak only does when asked
+	// to with response_include_resource_name.
+	RequirePermissionNames bool
+
+	// TokenBinding if defined, denies requests whose client doesn't match the claims of their token, e.g.
+	// the client IP or session cookie.
+	TokenBinding *TokenBinding
+
+	// RPTRefresh if defined, mints new RPTs for granted tokens that are about to expire, or for tokens that
+	// lack permission, and returns them in the RefreshedRPTHeader response header.
+	RPTRefresh *RPTRefresh
+
+	// AuditSink if defined, receives an AuditEvent whenever a resource is registered, a request is denied or
+	// a permission ticket is issued. See WebhookSink.
+	AuditSink AuditSink
+
+	// DecisionRecorder if defined, receives a DecisionRecord of every request decided by Middleware, which
+	// can be replayed with Manager.Replay to preview the impact of policy changes. See DecisionRing and
+	// DecisionLog.
+	DecisionRecorder DecisionRecorder
+
+	// DecisionRecordRedactParams are query parameters, in addition to DefaultRedactedParams, whose values
+	// are redacted from DecisionRecord.URL
+	DecisionRecordRedactParams []string
+
+	// ShadowProvider if defined, returns a second provider, e.g. the authorization server being migrated
+	// to, against which every decision made with a valid token is evaluated again in the background.
+	// Divergences are logged and reported to OnShadowDivergence, and never affect responses. See
+	// ShadowDivergence.
+	ShadowProvider func(r *http.Request) Provider
+
+	// ShadowResourceStore keeps the ids of resources registered with ShadowProvider. Defaults to a
+	// MemoryResourceStore.
+	ShadowResourceStore ResourceStore
+
+	// OnShadowDivergence if defined, is invoked whenever ShadowProvider decides otherwise than the
+	// provider that serves the request
+	OnShadowDivergence func(div ShadowDivergence)
+
+	// ShadowConcurrency is the number of shadow evaluations that may run at once. Decisions made while
+	// all of them are busy are not evaluated, see Manager.ShadowDropped. Defaults to 16.
+	ShadowConcurrency int
+
+	// ShadowTimeout bounds each shadow evaluation, so that a shadow provider that hangs doesn't hold
+	// the slots of ShadowConcurrency. Defaults to 10 seconds.
+	ShadowTimeout time.Duration
+
+	// ProviderLimit limits resource registrations and permission ticket requests per issuer, so that a
+	// tenant that registers resources excessively, e.g. because it is misconfigured, can't starve the other
+	// tenants of a shared authorization server. See ErrProviderLimitExceeded.
+	ProviderLimit ProviderLimit
+
+	// ProviderLimitByIssuer overrides ProviderLimit for the given issuers
+	ProviderLimitByIssuer map[string]ProviderLimit
+
+	// Clock if defined, is used in place of the system clock to check token expiration and expire token
+	// cache entries. Use clock.Fake to advance time deterministically in tests, instead of setting
+	// DisableTokenExpirationCheck.
+	Clock clock.Clock
 }
 
 func New(
@@ -90,103 +364,382 @@ func New(
 	paths []Path,
 	logger logr.Logger,
 ) *Manager {
-	return &Manager{
-		getBaseURL:               opts.GetBaseURL,
-		getProvider:              opts.GetProvider,
-		getResourceStore:         opts.GetResourceStore,
-		includeScopes:            opts.IncludeScopesInPermissionTicket,
-		disableExpireCheck:       opts.DisableTokenExpirationCheck,
-		types:                    types,
-		paths:                    paths,
-		securitySchemes:          stringSet(securitySchemes),
-		defaultRscTmpl:           defaultResource,
-		defaultSecurity:          defaultSecurity,
-		getResourceName:          opts.GetResourceName,
-		customEnforce:            opts.CustomEnforce,
-		editUnauthorizedResponse: opts.EditUnauthorizedResponse,
-		anonymousScopes:          opts.AnonymousScopes,
-		logger:                   logger,
+	return NewFromMatcher(opts, NewMatcher(types, securitySchemes, defaultResource, defaultSecurity, paths), logger)
+}
+
+// NewFromMatcher creates a Manager that uses a prebuilt matcher. Unlike New, it doesn't compile path
+// templates, so it is cheap enough to call on every cold start in functions-as-a-service environments.
+func NewFromMatcher(opts ManagerOptions, matcher *Matcher, logger logr.Logger) *Manager {
+	m := &Manager{
+		getBaseURL:                  opts.GetBaseURL,
+		getBaseURLs:                 opts.GetBaseURLs,
+		pathRewrite:                 opts.PathRewrite,
+		stripForwardedPrefix:        opts.StripForwardedPrefix,
+		getProvider:                 opts.GetProvider,
+		getResourceStore:            opts.GetResourceStore,
+		resourceCache:               opts.ResourceCache,
+		resourceCacheTTL:            opts.ResourceCacheTTL,
+		resourceCacheNegativeTTL:    opts.ResourceCacheNegativeTTL,
+		storeKeyByIssuer:            opts.ResourceStoreKeyByIssuer,
+		storeMigrateIssuer:          opts.ResourceStoreMigrateIssuer,
+		includeScopes:               opts.IncludeScopesInPermissionTicket,
+		disableExpireCheck:          opts.DisableTokenExpirationCheck,
+		getResourceName:             opts.GetResourceName,
+		nameStrategy:                opts.NameStrategy,
+		namespace:                   opts.Namespace,
+		ownerFromRequest:            opts.OwnerFromRequest,
+		customEnforce:               opts.CustomEnforce,
+		editUnauthorizedResponse:    opts.EditUnauthorizedResponse,
+		anonymousScopes:             opts.AnonymousScopes,
+		resourceFromBody:            opts.ResourceFromBody,
+		templates:                   opts.Templates,
+		maxBufferedBodySize:         opts.MaxBufferedBodySize,
+		maxDecisionLatency:          opts.MaxDecisionLatency,
+		decisionLatencyReportOnly:   opts.DecisionLatencyReportOnly,
+		editLatencyExceededResponse: opts.EditLatencyExceededResponse,
+		observeDecisionLatency:      opts.ObserveDecisionLatency,
+		deregisterOnShutdown:        opts.DeregisterOnShutdown,
+		corsAllowedOrigins:          stringSet(opts.CORSAllowedOrigins),
+		bindTicketsToClient:         opts.BindTicketsToClient,
+		getTicketClaims:             opts.TicketClaims,
+		tokenBinding:                opts.TokenBinding,
+		expectedAudiences:           opts.ExpectedAudiences,
+		permissionClaimPath:         opts.PermissionClaimPath,
+		verifyPermissionNames:       opts.VerifyPermissionNames || opts.RequirePermissionNames,
+		requirePermissionNames:      opts.RequirePermissionNames,
+		challengeErrors:             opts.ChallengeErrors,
+		denialMapper:                opts.DenialMapper,
+		rptRefresh:                  opts.RPTRefresh,
+		auditSink:                   opts.AuditSink,
+		decisionRecorder:            opts.DecisionRecorder,
+		shadowProvider:              opts.ShadowProvider,
+		shadowResourceStore:         opts.ShadowResourceStore,
+		onShadowDivergence:          opts.OnShadowDivergence,
+		logouts:                     newLRUCache[time.Time](defaultLogoutCacheSize),
+		logoutJTIs:                  newLRUCache[time.Time](defaultLogoutCacheSize),
+		logoutRetention:             opts.LogoutRetention,
+		clock:                       clock.OrReal(opts.Clock),
+		logger:                      logger,
+	}
+	m.matcher.Store(matcher)
+	m.logouts.now = m.clock.Now
+	m.logoutJTIs.now = m.clock.Now
+	if m.logoutRetention == 0 {
+		m.logoutRetention = defaultLogoutRetention
+	}
+	if opts.TokenCacheSize > 0 {
+		m.tokenCache = newTokenCache(opts.TokenCacheSize, opts.TokenCacheTTL, m.clock)
+	}
+	if m.maxBufferedBodySize == 0 {
+		m.maxBufferedBodySize = defaultMaxBufferedBodySize
 	}
+	if m.resourceCacheTTL == 0 {
+		m.resourceCacheTTL = defaultResourceCacheTTL
+	}
+	if m.resourceCacheNegativeTTL == 0 {
+		m.resourceCacheNegativeTTL = defaultResourceCacheNegativeTTL
+	}
+	m.providerLimiter = newProviderLimiter(opts.ProviderLimit, opts.ProviderLimitByIssuer, m.clock)
+	if m.decisionRecorder != nil {
+		m.redactParams = map[string]bool{}
+		for _, params := range [][]string{DefaultRedactedParams, opts.DecisionRecordRedactParams} {
+			for _, k := range params {
+				m.redactParams[strings.ToLower(k)] = true
+			}
+		}
+	}
+	if m.shadowProvider != nil && m.shadowResourceStore == nil {
+		m.shadowResourceStore = NewMemoryResourceStore(m.clock)
+	}
+	if m.shadowProvider != nil {
+		n := opts.ShadowConcurrency
+		if n <= 0 {
+			n = defaultShadowConcurrency
+		}
+		m.shadowSlots = make(chan struct{}, n)
+		m.shadowTimeout = opts.ShadowTimeout
+		if m.shadowTimeout <= 0 {
+			m.shadowTimeout = defaultShadowTimeout
+		}
+	}
+	return m
+}
+
+// rewritePath applies StripForwardedPrefix and PathRewrite to path
+func (m *Manager) rewritePath(r *http.Request, path string) string {
+	if m.stripForwardedPrefix {
+		prefix := strings.TrimSuffix(r.Header.Get("X-Forwarded-Prefix"), "/")
+		if prefix != "" && (path == prefix || strings.HasPrefix(path, prefix+"/")) {
+			path = strings.TrimPrefix(path, prefix)
+			if path == "" {
+				path = "/"
+			}
+		}
+	}
+	if m.pathRewrite != nil {
+		path = m.pathRewrite(path)
+	}
+	return path
 }
 
-func (m *Manager) matchPath(r *http.Request, baseURL url.URL, path string) (*Resource, *Path) {
+func (m *Manager) matchPath(r *http.Request, matcher *Matcher, baseURL url.URL, path string) (*Resource, *Path, map[string]string) {
 	if !strings.HasPrefix(path, baseURL.Path) {
-		return nil, nil
+		return nil, nil, nil
 	}
 	path = strings.TrimPrefix(path, baseURL.Path)
 	if len(path) == 0 {
 		path = "/"
 	}
-	for _, p := range m.paths {
-		var rsc *Resource
-		if path == "/" && m.defaultRscTmpl != nil {
-			rsc = m.defaultRscTmpl.CreateResource(m.types, baseURL.String(), nil)
-		} else {
-			var ok bool
-			rsc, ok = p.MatchPath(m.types, baseURL.String(), path)
-			if !ok {
-				continue
-			}
-			if rsc == nil && m.defaultRscTmpl != nil {
-				rsc = m.defaultRscTmpl.CreateResource(m.types, baseURL.String()+path, nil)
-			}
-		}
+	rsc, p, params := matcher.match(baseURL.String(), path, r.Header.Get("Accept-Language"))
+	if rsc != nil {
 		if m.getResourceName != nil {
 			rsc.Name = m.getResourceName(r, *rsc)
 		}
-		return rsc, &p
+		if m.nameStrategy != nil {
+			rsc.Name = m.nameStrategy.ResourceName(*rsc, params)
+		}
+		rsc.Name = NamespacedName(m.namespace, rsc.Name)
+	}
+	return rsc, p, params
+}
+
+// baseURLs returns base urls of the request, in order of preference
+func (m *Manager) baseURLs(r *http.Request) []url.URL {
+	if m.getBaseURLs != nil {
+		return m.getBaseURLs(r)
 	}
-	return nil, nil
+	return []url.URL{m.getBaseURL(r)}
 }
 
-func (m *Manager) matchOperation(r *http.Request) (rsc *Resource, scopes []string) {
-	baseURL := m.getBaseURL(r)
-	baseURL.Path = strings.TrimSuffix(baseURL.Path, "/")
-	rsc, p := m.matchPath(r, baseURL, r.URL.Path)
+func (m *Manager) matchOperation(r *http.Request) (rsc *Resource, scopes []string, disabled bool, err error) {
+	var p *Path
+	var params map[string]string
+	// the matcher may be swapped by Reload, so the same one is used throughout
+	matcher := m.matcher.Load()
+	path := m.rewritePath(r, r.URL.Path)
+	for _, baseURL := range m.baseURLs(r) {
+		baseURL.Path = strings.TrimSuffix(baseURL.Path, "/")
+		if rsc, p, params = m.matchPath(r, matcher, baseURL, path); p != nil {
+			break
+		}
+	}
+	if p == nil {
+		return nil, nil, false, nil
+	}
+	recordDecision(r, func(d *Decision) {
+		d.Template = p.tmpl
+		d.PathParams = params
+	})
+	scopes = matcher.findScopes(p, r.Method)
+	includeScopes := p.includeScopes(r.Method)
+	if m.templates != nil {
+		if o, ok := m.templates.Options(p.tmpl); ok {
+			if o.Disabled {
+				return rsc, nil, true, nil
+			}
+			scopes = o.scopes(r.Method, scopes)
+			if v := o.includeScopes(r.Method); v != nil {
+				includeScopes = v
+			}
+		}
+	}
+	if m.resourceFromBody != nil && len(scopes) > 0 {
+		bodyRsc, err := m.resourceFromRequestBody(r)
+		if err != nil {
+			return nil, nil, false, err
+		}
+		if bodyRsc != nil {
+			rsc = bodyRsc
+		}
+	}
 	if rsc == nil {
-		return
+		return nil, nil, false, nil
 	}
-	scopes = p.FindScopes(m.securitySchemes, r.Method)
-	if scopes == nil && m.defaultSecurity != nil {
-		scopes = m.defaultSecurity.findScopes(m.securitySchemes)
+	rsc.includeScopes = includeScopes
+	return rsc, scopes, false, nil
+}
+
+func (m *Manager) registerResource(r *http.Request, rs ResourceStore, p Provider, rsc *Resource) error {
+	key := resourceCacheKey(p, rsc.Name)
+	if m.resourceCache != nil {
+		id, ok, err := m.resourceCache.Get(key)
+		if err != nil {
+			m.logger.Error(err, "error getting resource from cache", "name", rsc.Name)
+		} else if ok {
+			if id == "" {
+				return ErrRegistrationRecentlyFailed{Name: rsc.Name, RetryAfter: m.resourceCacheNegativeTTL}
+			}
+			rsc.ID = id
+			m.logger.Info("fetched resource from cache",
+				"id", rsc.ID,
+				"name", rsc.Name,
+				"uri", rsc.URI,
+			)
+			return nil
+		}
+	}
+	register := func() (string, error) {
+		return m.lookupOrCreateResource(r, rs, p, rsc)
+	}
+	id, err := m.registrations.do(key, register)
+	// the registration may have been run by another request that was cancelled meanwhile
+	for isContextError(err) && r.Context().Err() == nil {
+		id, err = m.registrations.do(key, register)
 	}
-	return
+	// tombstones expire on their own schedule, so they are not cached as failed registrations, neither are
+	// rejections by ProviderLimit and cancelled requests, which say nothing about the resource
+	if m.resourceCache != nil && !errors.As(err, &ErrResourceTombstoned{}) &&
+		!errors.As(err, &ErrProviderLimitExceeded{}) && !isContextError(err) {
+		ttl := m.resourceCacheTTL
+		if err != nil {
+			ttl = m.resourceCacheNegativeTTL
+		}
+		if err := m.resourceCache.Set(key, id, ttl); err != nil {
+			m.logger.Error(err, "error setting resource in cache", "name", rsc.Name)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	rsc.ID = id
+	return nil
 }
 
-func (m *Manager) registerResource(rs ResourceStore, p Provider, rsc *Resource) error {
-	if s, err := rs.Get(rsc.Name); err == nil && s != "" {
-		rsc.ID = s
+func (m *Manager) lookupOrCreateResource(r *http.Request, rs ResourceStore, p Provider, rsc *Resource) (string, error) {
+	key := m.storeKey(p, rsc.Name)
+	if s, err := m.storeGet(rs, p, rsc.Name); err == nil && s != "" {
 		m.logger.Info("fetched resource from store",
-			"id", rsc.ID,
+			"id", s,
 			"name", rsc.Name,
 			"uri", rsc.URI,
 		)
-		return nil
+		if err := m.updateIfChanged(rs, p, key, s, rsc); err != nil {
+			return "", err
+		}
+		return s, nil
+	}
+	if err := checkTombstone(rs, key, rsc.Name); err != nil {
+		return "", err
+	}
+	release, err := m.acquireProvider(r.Context(), p)
+	if err != nil {
+		return "", err
 	}
+	defer release()
+	if m.ownerFromRequest != nil {
+		rsc.Owner = m.ownerFromRequest(m.withVerifiedClaims(r, p))
+	}
+	// providers may adjust the request, the hash must be of the definition as rendered
+	def := *rsc
 	resp, err := p.CreateResource(rsc)
 	if err != nil {
-		return err
+		if !isConflict(err) {
+			return "", err
+		}
+		id, lookupErr := m.lookupResourceByName(p, rsc.Name)
+		if lookupErr != nil {
+			return "", lookupErr
+		}
+		if id == "" {
+			return "", err
+		}
+		if id, err = storeSet(rs, key, id); err != nil {
+			return "", err
+		}
+		// the existing resource may have been registered with another definition
+		if err := m.updateIfChanged(rs, p, key, id, rsc); err != nil {
+			return "", err
+		}
+		m.logger.Info("resource already exists, stored existing id",
+			"id", id,
+			"name", rsc.Name,
+			"uri", rsc.URI,
+		)
+		return id, nil
 	}
-	if err := rs.Set(rsc.Name, resp.ID); err != nil {
-		return err
+	id, err := storeSet(rs, key, resp.ID)
+	if err != nil {
+		return "", err
+	}
+	if id != resp.ID {
+		// another replica registered the resource concurrently and stored its id first
+		if err := p.DeleteResource(resp.ID); err != nil {
+			m.logger.Error(err, "error deleting duplicate resource", "id", resp.ID, "name", rsc.Name)
+		}
+		m.logger.Info("resource registered concurrently, using stored id",
+			"id", id,
+			"name", rsc.Name,
+			"uri", rsc.URI,
+		)
+		return id, nil
+	}
+	m.trackCreated(p, resp.ID, rsc.Name)
+	if err := setHash(rs, key, &def); err != nil {
+		return "", err
 	}
-	rsc.ID = resp.ID
 	m.logger.Info("created resource",
-		"id", rsc.ID,
+		"id", resp.ID,
 		"name", rsc.Name,
 		"uri", rsc.URI,
 	)
-	return nil
+	m.audit(r, p, AuditResourceRegistered, rsc, nil, func(e *AuditEvent) {
+		e.ResourceID = resp.ID
+	})
+	return resp.ID, nil
+}
+
+// storeSet stores id under key and returns it, or returns the id already stored if rs rejects the write
+// with ErrStoredResourceConflict
+func storeSet(rs ResourceStore, key, id string) (string, error) {
+	err := rs.Set(key, id)
+	var stored ErrStoredResourceConflict
+	if errors.As(err, &stored) {
+		return stored.ID, nil
+	}
+	return id, err
+}
+
+func isConflict(err error) bool {
+	var conflictErr ErrResourceConflict
+	if errors.As(err, &conflictErr) {
+		return true
+	}
+	var respErr *httputil.ErrUnanticipatedResponse
+	return errors.As(err, &respErr) && respErr.Status == http.StatusConflict
+}
+
+// lookupResourceByName finds id of a registered resource using the name filter of the resource
+// registration endpoint. Because not every authorization server supports the filter, candidates
+// are fetched to confirm their names.
+func (m *Manager) lookupResourceByName(p Provider, name string) (string, error) {
+	ids, err := p.ListResources(url.Values{
+		"name":      {name},
+		"exactName": {"true"},
+	})
+	if err != nil {
+		return "", err
+	}
+	for _, id := range ids {
+		rsc, err := p.GetResource(id)
+		if err != nil {
+			return "", err
+		}
+		if rsc.Name == name {
+			return id, nil
+		}
+	}
+	return "", nil
 }
 
 // RegisterResourceAt finds resource at path. If one is found, it registers the resource with the provider.
-// If a resource is not found, both rsc and err are nil.
+// If a resource is not found, both rsc and err are nil. Like request paths, path is rewritten according to
+// StripForwardedPrefix and PathRewrite.
 func (m *Manager) RegisterResourceAt(r *http.Request, rs ResourceStore, p Provider, baseURL url.URL, path string) (rsc *Resource, err error) {
-	rsc, _ = m.matchPath(r, baseURL, path)
+	rsc, _, _ = m.matchPath(r, m.matcher.Load(), baseURL, m.rewritePath(r, path))
 	if rsc == nil {
 		return
 	}
-	if err := m.registerResource(rs, p, rsc); err != nil {
+	if err := m.registerResource(r, rs, p, rsc); err != nil {
 		return nil, err
 	}
 	return rsc, nil
@@ -202,6 +755,53 @@ func getBearerToken(r *http.Request) string {
 	return ""
 }
 
+// verifySignature verifies token signature, using the token cache if it is enabled
+func (m *Manager) verifySignature(ctx context.Context, p Provider, token string) (payload []byte, cached bool, err error) {
+	if m.tokenCache != nil {
+		payload, cached, err = m.tokenCache.verify(ctx, p, token)
+	} else {
+		payload, err = p.VerifySignature(ctx, token)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if err := m.checkLogout(p, payload); err != nil {
+		if m.tokenCache != nil {
+			m.tokenCache.remove(p, token)
+		}
+		return nil, false, err
+	}
+	return payload, cached, nil
+}
+
+// withVerifiedClaims returns a request with claims set if the request carries a token that passes the
+// same checks as tokens presented to protected paths, except for permissions: signature, expiry,
+// ExpectedAudiences and TokenBinding. Otherwise the request is returned as is.
+func (m *Manager) withVerifiedClaims(r *http.Request, p Provider) *http.Request {
+	token := getBearerToken(r)
+	if token == "" {
+		return r
+	}
+	b, _, err := m.verifySignature(r.Context(), p, token)
+	if err != nil {
+		return r
+	}
+	rpt, err := m.parseRPT(b)
+	if err != nil {
+		return r
+	}
+	if !m.disableExpireCheck && rpt.validateExpiry(m.clock.Now(), "") != nil {
+		return r
+	}
+	if len(m.expectedAudiences) > 0 && !audienceMatches(rpt, m.expectedAudiences) {
+		return r
+	}
+	if m.tokenBinding != nil && m.tokenBinding.mismatch(r, rpt) != "" {
+		return r
+	}
+	return setClaims(r, &rpt.Claims)
+}
+
 func (m *Manager) writeUnauthorizedResponse(w http.ResponseWriter) {
 	if m.editUnauthorizedResponse != nil {
 		m.editUnauthorizedResponse(w)
@@ -214,25 +814,42 @@ func (m *Manager) AskForTicket(w http.ResponseWriter, r *http.Request) {
 	p := m.getProvider(r)
 	rsc := GetResource(r)
 	scopes := GetScopes(r)
-	m.askForTicket(w, p, rsc, scopes...)
+	d := newDenial(rsc, scopes, nil)
+	if getBearerToken(r) != "" {
+		d.Reason = DenialScopeMismatch
+	}
+	m.writeDenial(w, r, p, d)
 }
 
-func (m *Manager) askForTicket(w http.ResponseWriter, p Provider, resource *Resource, scopes ...string) {
+// askForTicket requests a permission ticket for the denied request and sets the WWW-Authenticate header
+func (m *Manager) askForTicket(w http.ResponseWriter, r *http.Request, p Provider, d Denial) {
+	resource, scopes := d.Resource, d.Scopes
 	var ticket string
 	var err error
-	if m.includeScopes {
-		ticket, err = p.CreatePermissionTicket(resource.ID, scopes...)
+	includeScopes := m.includeScopes
+	if resource.includeScopes != nil {
+		includeScopes = *resource.includeScopes
+	}
+	if includeScopes {
+		ticket, err = m.createPermissionTicket(r, p, resource.ID, scopes...)
 	} else {
-		ticket, err = p.CreatePermissionTicket(resource.ID)
+		ticket, err = m.createPermissionTicket(r, p, resource.ID)
 	}
+	directives := p.WWWAuthenticateDirectives()
+	challenge := fmt.Sprintf(`UMA realm=%q, as_uri=%q, ticket=%q`, directives.Realm, directives.AsUri, ticket)
 	if err != nil {
-		panic(err)
+		if !errors.As(err, &ErrOffline{}) && !errors.As(err, &ErrProviderLimitExceeded{}) && !isContextError(err) {
+			panic(err)
+		}
+		// without the authorization server, the client has to obtain a ticket on its own
+		challenge = fmt.Sprintf(`UMA realm=%q, as_uri=%q`, directives.Realm, directives.AsUri)
+	} else {
+		m.audit(r, p, AuditTicketIssued, resource, scopes, nil)
 	}
-	directives := p.WWWAuthenticateDirectives()
-	w.Header().Set("WWW-Authenticate",
-		fmt.Sprintf(`UMA realm=%q, as_uri=%q, ticket=%q`, directives.Realm, directives.AsUri, ticket),
-	)
-	m.writeUnauthorizedResponse(w)
+	if m.challengeErrors {
+		challenge += newChallengeError(d).params()
+	}
+	w.Header().Set("WWW-Authenticate", challenge)
 }
 
 func (m *Manager) hasPermission(w http.ResponseWriter, r *http.Request, p Provider, rsc *Resource, scopes []string) (*Claims, bool) {
@@ -247,46 +864,147 @@ func (m *Manager) hasPermission(w http.ResponseWriter, r *http.Request, p Provid
 				"anonymous", true,
 			),
 		) {
+			recordDecision(r, func(d *Decision) {
+				d.Source = DecisionAnonymous
+			})
 			return nil, true
 		}
-		m.askForTicket(w, p, rsc, scopes...)
+		m.writeDenial(w, r, p, newDenial(rsc, scopes, nil))
 		return nil, false
 	}
-	b, err := p.VerifySignature(r.Context(), token)
+	b, cached, err := m.verifySignature(r.Context(), p, token)
 	if err != nil {
 		m.logger.Info("invalid token signature",
 			"method", r.Method,
 			"path", r.URL.Path,
 		)
-		m.askForTicket(w, p, rsc, scopes...)
+		m.writeDenial(w, r, p, newDenial(rsc, scopes, err))
 		return nil, false
 	}
-	rpt := &Claims{}
-	if err = json.Unmarshal(b, rpt); err != nil {
-		panic(err)
+	rpt, err := m.parseRPT(b)
+	if err != nil {
+		m.logger.Info("invalid token claims",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"err", err.Error(),
+		)
+		m.writeDenial(w, r, p, newDenial(rsc, scopes, err))
+		return nil, false
 	}
-	if rpt.IsValid(
-		rsc.ID,
-		m.disableExpireCheck,
-		scopes,
-		m.logger.WithValues(
+	recordDecision(r, func(d *Decision) {
+		d.Source = DecisionLocal
+		if cached {
+			d.Source = DecisionCached
+		}
+		if rpt.Authorization != nil {
+			d.Permissions = rpt.Authorization.Permissions
+		}
+		d.rpt = rpt
+	})
+	if len(m.expectedAudiences) > 0 && !audienceMatches(rpt, m.expectedAudiences) {
+		m.logger.Info("token audience mismatch",
 			"method", r.Method,
 			"path", r.URL.Path,
-		),
-	) {
-		return rpt, true
+			"aud", rpt.Audiences(),
+			"azp", rpt.Azp,
+		)
+		m.writeDenial(w, r, p, newDenial(rsc, scopes, errAudienceMismatch))
+		return nil, false
+	}
+	if m.verifyPermissionNames {
+		if err := checkPermissionName(rpt, rsc, m.requirePermissionNames); err != nil {
+			m.logger.Info("permission name mismatch",
+				"method", r.Method,
+				"path", r.URL.Path,
+				"err", err.Error(),
+			)
+			m.writeDenial(w, r, p, newDenial(rsc, scopes, err))
+			return nil, false
+		}
+	}
+	if m.tokenBinding != nil {
+		if check := m.tokenBinding.mismatch(r, rpt); check != "" {
+			m.logger.Info("token is not bound to client",
+				"method", r.Method,
+				"path", r.URL.Path,
+				"check", check,
+			)
+			m.writeDenial(w, r, p, newDenial(rsc, scopes, errTokenNotBound))
+			return nil, false
+		}
+	}
+	if err := m.checkPermission(r, p, rpt, rsc, scopes, m.logger.WithValues(
+		"method", r.Method,
+		"path", r.URL.Path,
+	)); err != nil {
+		if isCheckFailure(err) {
+			m.logger.Error(err, "error checking permission",
+				"method", r.Method,
+				"path", r.URL.Path,
+			)
+			http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+			return nil, false
+		}
+		if !m.canUpgrade(err) {
+			m.writeDenial(w, r, p, newDenial(rsc, scopes, err))
+			return nil, false
+		}
+		upgraded, upgradedRPT, ok := m.upgradeRPT(r, p, token, rsc, scopes)
+		if !ok {
+			m.writeDenial(w, r, p, newDenial(rsc, scopes, err))
+			return nil, false
+		}
+		w.Header().Set(RefreshedRPTHeader, upgraded)
+		rpt = upgradedRPT
+	} else if m.rptRefresh != nil {
+		m.refreshRPT(w, r, token, rpt, rsc, scopes)
 	}
-	m.askForTicket(w, p, rsc, scopes...)
-	return nil, false
+	recordDecision(r, func(d *Decision) {
+		d.Subject = rpt.Sub
+	})
+	return &rpt.Claims, true
 }
 
 func (m *Manager) enforce(w http.ResponseWriter, r *http.Request) (rsc *Resource, scopes []string, claims *Claims, ok bool) {
-	rsc, scopes = m.matchOperation(r)
+	start := time.Now()
+	rsc, scopes, disabled, err := m.matchOperation(r)
+	recordDecision(r, func(d *Decision) {
+		d.Timings.Match = time.Since(start)
+		d.Resource = rsc
+		d.Scopes = scopes
+	})
+	if disabled {
+		m.logger.Info("operation disabled by template override",
+			"method", r.Method,
+			"path", r.URL.Path,
+		)
+		recordDecision(r, func(d *Decision) {
+			d.Source = DecisionDisabled
+		})
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return nil, nil, nil, false
+	}
+	if err != nil {
+		m.logger.Error(err, "error finding resource in request body",
+			"method", r.Method,
+			"path", r.URL.Path,
+		)
+		var tooLarge ErrRequestBodyTooLarge
+		if errors.As(err, &tooLarge) {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+		} else {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+		return nil, nil, nil, false
+	}
 	if rsc == nil || len(scopes) == 0 {
 		m.logger.Info("operation skipped because either resource or scopes are empty",
 			"method", r.Method,
 			"path", r.URL.Path,
 		)
+		recordDecision(r, func(d *Decision) {
+			d.Source = DecisionSkipped
+		})
 		return nil, nil, nil, true
 	}
 	if m.customEnforce != nil {
@@ -294,6 +1012,9 @@ func (m *Manager) enforce(w http.ResponseWriter, r *http.Request) (rsc *Resource
 			"method", r.Method,
 			"path", r.URL.Path,
 		)
+		recordDecision(r, func(d *Decision) {
+			d.Source = DecisionCustom
+		})
 		ok = m.customEnforce(r, *rsc, scopes)
 		if !ok {
 			m.writeUnauthorizedResponse(w)
@@ -302,10 +1023,52 @@ func (m *Manager) enforce(w http.ResponseWriter, r *http.Request) (rsc *Resource
 	}
 	p := m.getProvider(r)
 	rs := m.getResourceStore(r)
-	if err := m.registerResource(rs, p, rsc); err != nil {
+	start = time.Now()
+	if err := m.registerResource(r, rs, p, rsc); err != nil {
+		if errors.As(err, &ErrResourceTombstoned{}) {
+			m.logger.Info("resource was deleted", "name", rsc.Name, "path", r.URL.Path)
+			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+			return nil, nil, nil, false
+		}
+		var limitErr ErrProviderLimitExceeded
+		if errors.As(err, &limitErr) {
+			m.logger.Info("resource registration rejected by provider limit",
+				"name", rsc.Name,
+				"path", r.URL.Path,
+				"issuer", limitErr.Issuer,
+				"limit", limitErr.Limit,
+			)
+			writeRetryAfterResponse(w, limitErr.RetryAfter)
+			return nil, nil, nil, false
+		}
+		var failedErr ErrRegistrationRecentlyFailed
+		if errors.As(err, &failedErr) {
+			m.logger.Info("resource registration failed recently", "name", rsc.Name, "path", r.URL.Path)
+			writeRetryAfterResponse(w, failedErr.RetryAfter)
+			return nil, nil, nil, false
+		}
+		if isContextError(err) {
+			m.logger.Info("resource registration abandoned", "name", rsc.Name, "path", r.URL.Path, "err", err.Error())
+			http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+			return nil, nil, nil, false
+		}
+		if errors.As(err, &ErrOffline{}) {
+			// the resource is not in the verification bundle and the authorization server is unreachable
+			m.logger.Info("resource can't be registered offline", "name", rsc.Name, "path", r.URL.Path)
+			http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+			return nil, nil, nil, false
+		}
 		panic(err)
 	}
-	if claims, ok := m.hasPermission(w, r, p, rsc, scopes); ok {
+	recordDecision(r, func(d *Decision) {
+		d.Timings.Registration = time.Since(start)
+	})
+	start = time.Now()
+	claims, ok = m.hasPermission(w, r, p, rsc, scopes)
+	recordDecision(r, func(d *Decision) {
+		d.Timings.Verification = time.Since(start)
+	})
+	if ok {
 		return rsc, scopes, claims, true
 	}
 	return nil, nil, nil, false
@@ -319,10 +1082,38 @@ func (m *Manager) enforce(w http.ResponseWriter, r *http.Request) (rsc *Resource
 //     WWW-Authenticate header.
 //   - If a token is included and valid, set resource, scopes, and claims in
 //     the request context. They can be retrieved with GetResource, GetScopes,
-//     and GetClaims respectively.
+//     and GetClaims respectively. Variables of the matched path template are
+//     retrieved with PathParams.
+//
+// If CORSAllowedOrigins is set, preflight requests are passed to the next handler as is.
 func (m *Manager) Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if rsc, scopes, claims, ok := m.enforce(w, r); ok {
+		if len(m.corsAllowedOrigins) > 0 {
+			if isPreflight(r) {
+				m.logger.Info("preflight request skipped",
+					"method", r.Method,
+					"path", r.URL.Path,
+				)
+				next.ServeHTTP(w, r)
+				return
+			}
+			m.setCORSHeaders(w, r)
+		}
+		d := GetDecision(r)
+		if d == nil {
+			r, d = WithDecision(r)
+		}
+		start := time.Now()
+		rsc, scopes, claims, ok := m.decide(w, r)
+		d.Granted = ok
+		d.Timings.Total = time.Since(start)
+		if m.decisionRecorder != nil {
+			m.decisionRecorder.RecordDecision(m.newDecisionRecord(r, d))
+		}
+		if m.shadowProvider != nil {
+			m.shadowDecision(r, d)
+		}
+		if ok {
 			args := []any{
 				"method", r.Method,
 				"path", r.URL.Path,
@@ -0,0 +1,121 @@
+package uma
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"sort"
+)
+
+// Matcher finds the resource and required scopes of requests, given the resource types, path
+// templates and security requirements of an OpenAPI spec. A Matcher is immutable once created, so
+// it can be built once, e.g. in a package-level variable, and shared by any number of Managers and
+// goroutines. It can also be serialized to JSON and restored with json.Unmarshal.
+type Matcher struct {
+	types           map[string]ResourceType
+	securitySchemes map[string]struct{}
+	defaultRscTmpl  *ResourceTemplate
+	defaultSecurity Security
+	paths           []Path
+	trie            *pathTrie
+}
+
+// NewMatcher compiles path templates into a Matcher. Arguments have the same meaning as those of New.
+func NewMatcher(
+	types map[string]ResourceType,
+	securitySchemes []string,
+	defaultResource *ResourceTemplate,
+	defaultSecurity Security,
+	paths []Path,
+) *Matcher {
+	tmpls := make([]string, len(paths))
+	for i, p := range paths {
+		tmpls[i] = p.tmpl
+	}
+	return &Matcher{
+		types:           types,
+		securitySchemes: stringSet(securitySchemes),
+		defaultRscTmpl:  defaultResource,
+		defaultSecurity: defaultSecurity,
+		paths:           paths,
+		trie:            newPathTrie(tmpls),
+	}
+}
+
+// match finds the resource at path, which is relative to baseURL. The resource is localized according
+// to acceptLanguage.
+func (m *Matcher) match(baseURL, path, acceptLanguage string) (rsc *Resource, p *Path, params map[string]string) {
+	if path == "/" && m.defaultRscTmpl != nil {
+		if len(m.paths) == 0 {
+			return nil, nil, nil
+		}
+		return m.defaultRscTmpl.createResource(m.types, baseURL, nil, acceptLanguage), &m.paths[0], nil
+	}
+	i, params, ok := m.trie.match(path)
+	if !ok {
+		return nil, nil, nil
+	}
+	p = &m.paths[i]
+	if p.rscTmpl != nil {
+		rsc = p.rscTmpl.createResource(m.types, baseURL+path, params, acceptLanguage)
+	} else if m.defaultRscTmpl != nil {
+		rsc = m.defaultRscTmpl.createResource(m.types, baseURL+path, nil, acceptLanguage)
+	}
+	return rsc, p, params
+}
+
+// findScopes returns scopes required to perform method on path p
+func (m *Matcher) findScopes(p *Path, method string) (scopes []string) {
+	scopes = p.FindScopes(m.securitySchemes, method)
+	if scopes == nil && m.defaultSecurity != nil {
+		scopes = m.defaultSecurity.findScopes(m.securitySchemes)
+	}
+	return
+}
+
+type matcherJSON struct {
+	Types           map[string]ResourceType `json:"types,omitempty"`
+	SecuritySchemes []string                `json:"securitySchemes,omitempty"`
+	DefaultResource *ResourceTemplate       `json:"defaultResource,omitempty"`
+	DefaultSecurity Security                `json:"defaultSecurity"`
+	Paths           []Path                  `json:"paths"`
+}
+
+func (m *Matcher) MarshalJSON() ([]byte, error) {
+	schemes := make([]string, 0, len(m.securitySchemes))
+	for s := range m.securitySchemes {
+		schemes = append(schemes, s)
+	}
+	sort.Strings(schemes)
+	return json.Marshal(matcherJSON{
+		Types:           m.types,
+		SecuritySchemes: schemes,
+		DefaultResource: m.defaultRscTmpl,
+		DefaultSecurity: m.defaultSecurity,
+		Paths:           m.paths,
+	})
+}
+
+func (m *Matcher) UnmarshalJSON(b []byte) error {
+	obj := &matcherJSON{}
+	if err := json.Unmarshal(b, obj); err != nil {
+		return err
+	}
+	*m = *NewMatcher(obj.Types, obj.SecuritySchemes, obj.DefaultResource, obj.DefaultSecurity, obj.Paths)
+	return nil
+}
+
+// LoadTemplatesJSON reads a matcher from the JSON file at path in fsys, e.g. one written by
+// `uma-codegen --json` and embedded with go:embed. Components that are not generated from the OpenAPI
+// spec, such as plugins, can use it to share the resource model of the generated code.
+func LoadTemplatesJSON(fsys fs.FS, path string) (*Matcher, error) {
+	b, err := fs.ReadFile(fsys, path)
+	if err != nil {
+		return nil, err
+	}
+	m := &Matcher{}
+	if err := json.Unmarshal(b, m); err != nil {
+		return nil, fmt.Errorf("error decoding templates %q: %w", path, err)
+	}
+	return m, nil
+}
@@ -0,0 +1,121 @@
+package uma_test
+
+import (
+	"encoding/json"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"testing/fstest"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/pckhoi/uma"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatcherJSON(t *testing.T) {
+	matcher := uma.NewMatcher(
+		map[string]uma.ResourceType{
+			"user": {Type: "user", DisplayName: "User", ResourceScopes: []string{"read", "write"}},
+		},
+		[]string{"oidc", "bearer"},
+		uma.NewResourceTemplate("user", "Users"),
+		[]map[string][]string{{"oidc": {"read"}}},
+		[]uma.Path{
+			uma.NewPath("/", nil, map[string]uma.Operation{http.MethodGet: {}}),
+			uma.NewPath("/{id}", uma.NewResourceTemplate("user", "User {id}",
+				uma.WithTemplateDisplayName("User #{id}"),
+				uma.WithTemplateOwnerManagedAccess(),
+			), map[string]uma.Operation{
+				http.MethodGet:  {},
+				http.MethodPut:  {Security: []map[string][]string{{"oidc": {"write"}}}},
+				http.MethodHead: {Security: []map[string][]string{}},
+			}),
+		},
+	)
+	b, err := json.Marshal(matcher)
+	require.NoError(t, err)
+
+	restored := &uma.Matcher{}
+	require.NoError(t, json.Unmarshal(b, restored))
+	b2, err := json.Marshal(restored)
+	require.NoError(t, err)
+	assert.JSONEq(t, string(b), string(b2))
+
+	type result struct {
+		rsc    uma.Resource
+		scopes []string
+	}
+	serve := func(matcher *uma.Matcher, method, path string) (res result) {
+		man := uma.NewFromMatcher(uma.ManagerOptions{
+			GetBaseURL: func(r *http.Request) url.URL {
+				return url.URL{Scheme: "https", Host: "api.example.com", Path: "/users"}
+			},
+			CustomEnforce: func(r *http.Request, resource uma.Resource, scopes []string) bool {
+				res = result{resource, scopes}
+				return true
+			},
+		}, matcher, testr.New(t))
+		rec := httptest.NewRecorder()
+		man.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).
+			ServeHTTP(rec, httptest.NewRequest(method, "https://api.example.com/users"+path, nil))
+		return
+	}
+	for _, c := range []struct {
+		method, path string
+	}{
+		{http.MethodGet, "/"},
+		{http.MethodGet, "/1"},
+		{http.MethodPut, "/1"},
+		{http.MethodHead, "/1"},
+	} {
+		expected := serve(matcher, c.method, c.path)
+		assert.Equal(t, expected, serve(restored, c.method, c.path))
+	}
+	assert.Equal(t, result{
+		rsc: uma.Resource{
+			ResourceType: uma.ResourceType{
+				Type: "user", DisplayName: "User #1", ResourceScopes: []string{"read", "write"},
+			},
+			Name:               "User 1",
+			URI:                "https://api.example.com/users/1",
+			OwnerManagedAccess: true,
+		},
+		scopes: []string{"write"},
+	}, serve(restored, http.MethodPut, "/1"))
+}
+
+func TestLoadTemplatesJSON(t *testing.T) {
+	matcher := uma.NewMatcher(
+		map[string]uma.ResourceType{
+			"user": {Type: "user", ResourceScopes: []string{"read", "write"}},
+		},
+		[]string{"oidc"},
+		nil,
+		[]map[string][]string{{"oidc": {"read"}}},
+		[]uma.Path{
+			uma.NewPath("/{id}", uma.NewResourceTemplate("user", "User {id}"), map[string]uma.Operation{
+				http.MethodGet: {},
+			}),
+		},
+	)
+	b, err := json.Marshal(matcher)
+	require.NoError(t, err)
+	fsys := fstest.MapFS{
+		"uma/templates.json": {Data: b},
+		"uma/invalid.json":   {Data: []byte(`{"paths": 1}`)},
+	}
+
+	loaded, err := uma.LoadTemplatesJSON(fsys, "uma/templates.json")
+	require.NoError(t, err)
+	b2, err := json.Marshal(loaded)
+	require.NoError(t, err)
+	assert.JSONEq(t, string(b), string(b2))
+
+	_, err = uma.LoadTemplatesJSON(fsys, "uma/missing.json")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	_, err = uma.LoadTemplatesJSON(fsys, "uma/invalid.json")
+	assert.ErrorContains(t, err, `error decoding templates "uma/invalid.json"`)
+}
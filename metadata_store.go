@@ -0,0 +1,208 @@
+package uma
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pckhoi/uma/pkg/clock"
+	"gopkg.in/square/go-jose.v2"
+)
+
+// MetadataStore persists the last good discovery document and JWKS of providers, so that a service that
+// restarts while the authorization server is down can still verify tokens and find endpoints. See
+// WithMetadataStore.
+type MetadataStore interface {
+	// Get returns the value saved under key, or nil if there is none
+	Get(key string) ([]byte, error)
+
+	// Set saves value under key, replacing the previous value
+	Set(key string, value []byte) error
+}
+
+// FileMetadataStore saves each value in a file of Dir, which should outlive the process, e.g. a volume
+// shared by the pods of a deployment
+type FileMetadataStore struct {
+	Dir string
+}
+
+func (s FileMetadataStore) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(s.Dir, hex.EncodeToString(sum[:])+".json")
+}
+
+func (s FileMetadataStore) Get(key string) ([]byte, error) {
+	b, err := os.ReadFile(s.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	return b, err
+}
+
+// Set writes value to a temporary file first, so that readers never see a partial value
+func (s FileMetadataStore) Set(key string, value []byte) error {
+	if err := os.MkdirAll(s.Dir, 0o700); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(s.Dir, "tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(value); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), s.path(key))
+}
+
+// WithMetadataStore saves the discovery document and the JWKS of the provider to store whenever they are
+// fetched, and loads them from store when the authorization server can't be reached at startup. With a
+// store, keys are fetched by the provider itself rather than by oidc.RemoteKeySet, and are fetched again
+// when a token is signed with an unknown key.
+func WithMetadataStore(store MetadataStore) BaseProviderOption {
+	return func(p *BaseProvider) {
+		p.metadataStore = store
+	}
+}
+
+// minKeyRefreshInterval limits how often tokens signed with unknown keys trigger a JWKS request
+const minKeyRefreshInterval = 10 * time.Second
+
+func discoverySnapshotKey(issuer string) string {
+	return "discovery " + issuer
+}
+
+func jwksSnapshotKey(issuer string) string {
+	return "jwks " + issuer
+}
+
+// saveSnapshot saves obj as JSON to the metadata store, logging errors since the snapshot is only a
+// fallback
+func (p *BaseProvider) saveSnapshot(key string, obj interface{}) {
+	b, err := json.Marshal(obj)
+	if err == nil {
+		err = p.metadataStore.Set(key, b)
+	}
+	if err != nil {
+		p.logger.Error(err, "error saving snapshot", "key", key)
+	}
+}
+
+// loadSnapshot decodes the snapshot saved under key into obj. It returns false if there is none.
+func (p *BaseProvider) loadSnapshot(key string, obj interface{}) bool {
+	b, err := p.metadataStore.Get(key)
+	if err == nil && b != nil {
+		err = json.Unmarshal(b, obj)
+	}
+	if err != nil {
+		p.logger.Error(err, "error loading snapshot", "key", key)
+		return false
+	}
+	return b != nil
+}
+
+// snapshotKeySet is the KeySet of providers with a metadata store. It saves keys to the store whenever it
+// fetches them, and falls back to the saved keys when they can't be fetched.
+type snapshotKeySet struct {
+	p           *BaseProvider
+	mu          sync.RWMutex
+	jwks        jose.JSONWebKeySet
+	refreshMu   sync.Mutex
+	lastRefresh time.Time
+}
+
+func (p *BaseProvider) newSnapshotKeySet() *snapshotKeySet {
+	ks := &snapshotKeySet{p: p}
+	if err := ks.refresh(); err != nil {
+		if !p.loadSnapshot(jwksSnapshotKey(p.issuer), &ks.jwks) {
+			p.logger.Error(err, "error fetching jwks")
+			return ks
+		}
+		p.logger.Error(err, "error fetching jwks, using snapshot")
+	}
+	return ks
+}
+
+// refresh fetches the keys from the jwks_uri of the discovery document
+func (ks *snapshotKeySet) refresh() error {
+	ks.refreshMu.Lock()
+	ks.lastRefresh = clock.OrReal(ks.p.client.Clock).Now()
+	ks.refreshMu.Unlock()
+	return ks.fetch()
+}
+
+func (ks *snapshotKeySet) fetch() error {
+	uri := ks.p.Discovery().JwksURI
+	if uri == "" {
+		return errors.New("jwks_uri not found in discovery document")
+	}
+	resp, err := ks.p.client.Get(uri)
+	if err != nil {
+		return fmt.Errorf("error fetching jwks: %w", err)
+	}
+	set := jose.JSONWebKeySet{}
+	if err := ks.p.client.DecodeJSONResponse(resp, &set); err != nil {
+		return fmt.Errorf("error decoding jwks: %w", err)
+	}
+	if len(set.Keys) == 0 {
+		return errors.New("error decoding jwks: no keys")
+	}
+	ks.mu.Lock()
+	ks.jwks = set
+	ks.mu.Unlock()
+	ks.p.saveSnapshot(jwksSnapshotKey(ks.p.issuer), set)
+	return nil
+}
+
+// refreshIfStale refreshes the keys unless they were refreshed less than minKeyRefreshInterval ago. It
+// returns false if the keys were not refreshed.
+func (ks *snapshotKeySet) refreshIfStale() bool {
+	ks.refreshMu.Lock()
+	now := clock.OrReal(ks.p.client.Clock).Now()
+	if now.Sub(ks.lastRefresh) < minKeyRefreshInterval {
+		ks.refreshMu.Unlock()
+		return false
+	}
+	ks.lastRefresh = now
+	ks.refreshMu.Unlock()
+	if err := ks.fetch(); err != nil {
+		ks.p.logger.Error(err, "error refreshing jwks")
+		return false
+	}
+	return true
+}
+
+func (ks *snapshotKeySet) verify(jws *jose.JSONWebSignature) ([]byte, bool) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	return verifyWithKeySet(jws, &ks.jwks)
+}
+
+func (ks *snapshotKeySet) VerifySignature(ctx context.Context, jwt string) ([]byte, error) {
+	jws, err := jose.ParseSigned(jwt)
+	if err != nil {
+		return nil, fmt.Errorf("malformed jwt: %w", err)
+	}
+	if payload, ok := ks.verify(jws); ok {
+		return payload, nil
+	}
+	// keys may have been rotated
+	if ks.refreshIfStale() {
+		if payload, ok := ks.verify(jws); ok {
+			return payload, nil
+		}
+	}
+	return nil, errors.New("failed to verify signature: no matching key")
+}
@@ -0,0 +1,107 @@
+package uma_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/pckhoi/uma"
+	"github.com/pckhoi/uma/pkg/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/square/go-jose.v2"
+)
+
+func TestMetadataStore(t *testing.T) {
+	key1, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	key2, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	var (
+		mu          sync.Mutex
+		down        bool
+		keys        = []jose.JSONWebKey{{Key: &key1.PublicKey, KeyID: "key-1", Algorithm: "RS256", Use: "sig"}}
+		jwksFetches int
+	)
+	mux := http.NewServeMux()
+	s := httptest.NewServer(mux)
+	defer s.Close()
+	issuer := s.URL + "/realms/test"
+	writeJSON := func(w http.ResponseWriter, obj any) {
+		mu.Lock()
+		defer mu.Unlock()
+		if down {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		require.NoError(t, json.NewEncoder(w).Encode(obj))
+	}
+	mux.HandleFunc("/realms/test/.well-known/uma2-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, uma.UMADiscovery{
+			Issuer:        issuer,
+			TokenEndpoint: issuer + "/token",
+			JwksURI:       issuer + "/certs",
+		})
+	})
+	mux.HandleFunc("/realms/test/certs", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		jwksFetches++
+		set := jose.JSONWebKeySet{Keys: keys}
+		mu.Unlock()
+		writeJSON(w, set)
+	})
+	setDown := func(v bool) {
+		mu.Lock()
+		down = v
+		mu.Unlock()
+	}
+	store := uma.FileMetadataStore{Dir: t.TempDir()}
+	c := clock.NewFake(time.Unix(1000, 0))
+	newProvider := func() (*uma.BaseProvider, error) {
+		return uma.NewBaseProvider(issuer, "api", "secret", nil, nil, logr.Discard(),
+			uma.WithMetadataStore(store), uma.WithClock(c))
+	}
+
+	// without a snapshot, the provider can't start while the authorization server is down
+	setDown(true)
+	_, err = newProvider()
+	assert.ErrorAs(t, err, &uma.ErrDiscoveryFailed{})
+
+	setDown(false)
+	p, err := newProvider()
+	require.NoError(t, err)
+	token1 := signJWT(t, key1, "key-1", map[string]interface{}{"sub": "user-1"})
+	_, err = p.VerifySignature(context.Background(), token1)
+	require.NoError(t, err)
+
+	// keys are fetched again when a token is signed with an unknown key, at most every 10 seconds
+	token2 := signJWT(t, key2, "key-2", map[string]interface{}{"sub": "user-2"})
+	_, err = p.VerifySignature(context.Background(), token2)
+	assert.Error(t, err)
+	assert.Equal(t, 1, jwksFetches)
+	mu.Lock()
+	keys = append(keys, jose.JSONWebKey{Key: &key2.PublicKey, KeyID: "key-2", Algorithm: "RS256", Use: "sig"})
+	mu.Unlock()
+	c.Advance(10 * time.Second)
+	_, err = p.VerifySignature(context.Background(), token2)
+	require.NoError(t, err)
+	assert.Equal(t, 2, jwksFetches)
+
+	// a restarted provider starts from the snapshot while the authorization server is down
+	setDown(true)
+	p, err = newProvider()
+	require.NoError(t, err)
+	assert.Equal(t, issuer+"/token", p.Discovery().TokenEndpoint)
+	for _, token := range []string{token1, token2} {
+		_, err = p.VerifySignature(context.Background(), token)
+		assert.NoError(t, err)
+	}
+}
@@ -0,0 +1,128 @@
+package uma_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/pckhoi/uma"
+)
+
+// mockProvider is an in-memory provider for tests that don't need a real authorization server
+type mockProvider struct {
+	uma.Provider
+	mu       sync.Mutex
+	names    map[string]string
+	tokens   map[string]string
+	verified int
+	tickets  int
+	deleted  []string
+
+	// delay is added to every signature verification
+	delay time.Duration
+}
+
+func newMockProvider(tokens map[string]string) *mockProvider {
+	return &mockProvider{
+		names:  map[string]string{},
+		tokens: tokens,
+	}
+}
+
+func (p *mockProvider) CreateResource(request *uma.Resource) (*uma.ExpandedResource, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	id := "rsc-" + request.Name
+	p.names[id] = request.Name
+	return &uma.ExpandedResource{ID: id, Name: request.Name}, nil
+}
+
+func (p *mockProvider) DeleteResource(id string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.names[id]; !ok {
+		return fmt.Errorf("resource %q not found", id)
+	}
+	delete(p.names, id)
+	p.deleted = append(p.deleted, id)
+	return nil
+}
+
+func (p *mockProvider) VerifySignature(ctx context.Context, jwt string) ([]byte, error) {
+	p.mu.Lock()
+	delay := p.delay
+	p.mu.Unlock()
+	time.Sleep(delay)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.verified++
+	if payload, ok := p.tokens[jwt]; ok {
+		return []byte(payload), nil
+	}
+	return nil, errors.New("invalid signature")
+}
+
+func (p *mockProvider) CreatePermissionTicket(resourceID string, scopes ...string) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.tickets++
+	return fmt.Sprintf("ticket-%d", p.tickets), nil
+}
+
+func (p *mockProvider) WWWAuthenticateDirectives() uma.WWWAuthenticateDirectives {
+	return uma.WWWAuthenticateDirectives{Realm: "test", AsUri: "https://as.example.com"}
+}
+
+// rptPayload returns a token payload that grants scopes on resource with the given name
+func rptPayload(sub, name string, scopes ...string) string {
+	return fmt.Sprintf(
+		`{"sub":%q,"authorization":{"permissions":[{"rsid":%q,"rsname":%q,"scopes":%q}]}}`,
+		sub, "rsc-"+name, name, scopes,
+	)
+}
+
+// newMockManager returns a manager that protects /users/{id} with scope read (GET) and
+// write (PUT) using mockProvider
+func newMockManager(t *testing.T, p uma.Provider, opts uma.ManagerOptions) *uma.Manager {
+	t.Helper()
+	if opts.GetBaseURL == nil {
+		opts.GetBaseURL = func(r *http.Request) url.URL {
+			return url.URL{Scheme: "https", Host: "api.example.com", Path: "/users"}
+		}
+	}
+	opts.GetProvider = func(r *http.Request) uma.Provider {
+		return p
+	}
+	if opts.GetResourceStore == nil {
+		rs := &syncResourceStore{m: map[string]string{}}
+		opts.GetResourceStore = func(r *http.Request) uma.ResourceStore {
+			return rs
+		}
+	}
+	// tests that care about expiration use a fake clock
+	opts.DisableTokenExpirationCheck = opts.Clock == nil
+	return uma.New(
+		opts,
+		map[string]uma.ResourceType{
+			"user": {Type: "user", ResourceScopes: []string{"read", "write"}},
+		},
+		[]string{"oidc"},
+		nil,
+		[]map[string][]string{{"oidc": {"read"}}},
+		[]uma.Path{
+			uma.NewPath("/{id}", uma.NewResourceTemplate("user", "User {id}"), map[string]uma.Operation{
+				http.MethodGet: {},
+				http.MethodPut: {
+					Security: []map[string][]string{{"oidc": {"write"}}},
+				},
+			}),
+		},
+		testr.New(t),
+	)
+}
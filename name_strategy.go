@@ -0,0 +1,74 @@
+package uma
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// NameStrategy decides the name a resource is registered and stored under. Resource names must be
+// unique per client, so services sharing one client should use a strategy that prevents names
+// like "User 1" from colliding.
+//
+// A NameStrategy is applied by the Manager when it matches requests, which covers code generated by
+// uma-codegen. Verification bundles hold the names resources were registered under, so they are
+// consistent too. `uma-codegen manifest` can't run Go code, it names resources with the template given
+// by --name-template, so only strategies equivalent to a TemplateNameStrategy can be used with it.
+type NameStrategy interface {
+	// ResourceName returns the name for rsc. params are the path parameters of the matched path.
+	ResourceName(rsc Resource, params map[string]string) string
+}
+
+// NameStrategyFunc is a function that satisfies NameStrategy
+type NameStrategyFunc func(rsc Resource, params map[string]string) string
+
+func (f NameStrategyFunc) ResourceName(rsc Resource, params map[string]string) string {
+	return f(rsc, params)
+}
+
+// PrefixNameStrategy prefixes resource names with prefix, typically the service name
+func PrefixNameStrategy(prefix string) NameStrategy {
+	return NameStrategyFunc(func(rsc Resource, params map[string]string) string {
+		return prefix + rsc.Name
+	})
+}
+
+func uriHash(uri string) string {
+	h := sha256.Sum256([]byte(uri))
+	return hex.EncodeToString(h[:8])
+}
+
+// URIHashNameStrategy appends a short hash of the resource URI to resource names. Because the URI
+// contains the public host and base path of the service, names won't collide across services.
+func URIHashNameStrategy() NameStrategy {
+	return NameStrategyFunc(func(rsc Resource, params map[string]string) string {
+		return rsc.Name + " " + uriHash(rsc.URI)
+	})
+}
+
+// TemplateNameStrategy renders resource names from tmpl. Besides path parameters, tmpl can refer
+// to the following variables:
+//   - {name}: the name rendered from the resource template
+//   - {type}: the resource type
+//   - {uri}: the resource URI
+//   - {uri_hash}: a short hash of the resource URI
+//
+// e.g. "users-service: {name}"
+func TemplateNameStrategy(tmpl string) NameStrategy {
+	return NameStrategyFunc(func(rsc Resource, params map[string]string) string {
+		vars := map[string]string{}
+		for k, v := range params {
+			vars[k] = v
+		}
+		vars["name"] = rsc.Name
+		vars["type"] = rsc.Type
+		vars["uri"] = rsc.URI
+		vars["uri_hash"] = uriHash(rsc.URI)
+		return paramRegex.ReplaceAllStringFunc(tmpl, func(s string) string {
+			if v, ok := vars[strings.Trim(s, "{}")]; ok {
+				return v
+			}
+			return s
+		})
+	})
+}
@@ -0,0 +1,23 @@
+package uma_test
+
+import (
+	"testing"
+
+	"github.com/pckhoi/uma"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNameStrategy(t *testing.T) {
+	rsc := uma.Resource{
+		ResourceType: uma.ResourceType{Type: "user"},
+		Name:         "User 1",
+		URI:          "https://example.com/users/1",
+	}
+	params := map[string]string{"id": "1"}
+	assert.Equal(t, "users: User 1", uma.PrefixNameStrategy("users: ").ResourceName(rsc, params))
+	assert.Equal(t, "User 1 c6b270bb905f0b2a", uma.URIHashNameStrategy().ResourceName(rsc, params))
+	assert.Equal(t,
+		"users/user/1 (User 1) https://example.com/users/1 {unknown}",
+		uma.TemplateNameStrategy("users/{type}/{id} ({name}) {uri} {unknown}").ResourceName(rsc, params),
+	)
+}
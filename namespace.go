@@ -0,0 +1,51 @@
+package uma
+
+import (
+	"net/url"
+	"strings"
+)
+
+// NamespaceSeparator separates the namespace from the rest of a namespaced resource name
+const NamespaceSeparator = "/"
+
+// NamespacedName returns name in namespace, e.g. "billing/Invoice 1" for namespace "billing". name is
+// returned as is if namespace is empty.
+func NamespacedName(namespace, name string) string {
+	if namespace == "" {
+		return name
+	}
+	return namespace + NamespaceSeparator + name
+}
+
+// InNamespace reports whether the resource name belongs to namespace
+func InNamespace(namespace, name string) bool {
+	return strings.HasPrefix(name, namespace+NamespaceSeparator)
+}
+
+// ListNamespaceResources returns the resources of p whose names belong to namespace, e.g. those
+// registered by a Manager with ManagerOptions.Namespace. The name filter of the resource registration
+// endpoint narrows down the candidates, which are then fetched to confirm their names since not every
+// authorization server supports the filter.
+func ListNamespaceResources(p Provider, namespace string) ([]ExpandedResource, error) {
+	ids, err := p.ListResources(url.Values{
+		"name": {namespace + NamespaceSeparator},
+	})
+	if err != nil {
+		return nil, err
+	}
+	rscs := []ExpandedResource{}
+	for _, id := range ids {
+		rsc, err := p.GetResource(id)
+		if err != nil {
+			return nil, err
+		}
+		if !InNamespace(namespace, rsc.Name) {
+			continue
+		}
+		if rsc.ID == "" {
+			rsc.ID = id
+		}
+		rscs = append(rscs, *rsc)
+	}
+	return rscs, nil
+}
@@ -0,0 +1,61 @@
+package uma_test
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/pckhoi/uma"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// listingProvider adds resource listing to mockProvider, matching names partially like Keycloak
+type listingProvider struct {
+	*mockProvider
+}
+
+func (p listingProvider) ListResources(q url.Values) ([]string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	ids := []string{}
+	for id, name := range p.names {
+		if strings.Contains(name, q.Get("name")) {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func (p listingProvider) GetResource(id string) (*uma.ExpandedResource, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return &uma.ExpandedResource{ID: id, Name: p.names[id]}, nil
+}
+
+func TestManagerNamespace(t *testing.T) {
+	p := listingProvider{newMockProvider(map[string]string{
+		"token-1": rptPayload("user-1", "billing/User 1", "read"),
+		"token-2": rptPayload("user-1", "User 1", "read"),
+	})}
+	billing := newMockManager(t, p, uma.ManagerOptions{Namespace: "billing"}).
+		Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	shipping := newMockManager(t, p, uma.ManagerOptions{Namespace: "shipping"}).
+		Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	assert.Equal(t, http.StatusOK, serve(billing, http.MethodGet, "https://api.example.com/users/1", "token-1").Code)
+	assert.Equal(t, http.StatusUnauthorized, serve(billing, http.MethodGet, "https://api.example.com/users/1", "token-2").Code)
+	assert.Equal(t, http.StatusUnauthorized, serve(shipping, http.MethodGet, "https://api.example.com/users/1", "token-1").Code)
+	assert.Equal(t, http.StatusUnauthorized, serve(shipping, http.MethodGet, "https://api.example.com/users/2", "").Code)
+
+	rscs, err := uma.ListNamespaceResources(p, "billing")
+	require.NoError(t, err)
+	assert.Equal(t, []uma.ExpandedResource{{ID: "rsc-billing/User 1", Name: "billing/User 1"}}, rscs)
+	rscs, err = uma.ListNamespaceResources(p, "shipping")
+	require.NoError(t, err)
+	assert.Len(t, rscs, 2)
+	for _, rsc := range rscs {
+		assert.True(t, uma.InNamespace("shipping", rsc.Name))
+	}
+}
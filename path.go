@@ -1,6 +1,7 @@
 package uma
 
 import (
+	"encoding/json"
 	"fmt"
 	"regexp"
 	"strings"
@@ -13,30 +14,179 @@ func init() {
 }
 
 type ResourceTemplate struct {
-	nameTmpl string
-	_type    string
+	nameTmpl           string
+	_type              string
+	displayNameTmpl    string
+	descriptionTmpl    string
+	iconURITmpl        string
+	displayNameTmpls   map[string]string
+	iconURITmpls       map[string]string
+	ownerManagedAccess bool
+	includeScopes      *bool
+	funcs              map[string]TemplateFunc
+	nameFunc           func(params map[string]string) string
 }
 
-func NewResourceTemplate(rscType, rscNameTmpl string) *ResourceTemplate {
-	return &ResourceTemplate{
+// ResourceTemplateOption configures optional properties of a ResourceTemplate
+type ResourceTemplateOption func(t *ResourceTemplate)
+
+// WithTemplateDisplayName sets the display name template. Like the name template, it can refer
+// to path parameters e.g. "User {id}"
+func WithTemplateDisplayName(displayNameTmpl string) ResourceTemplateOption {
+	return func(t *ResourceTemplate) {
+		t.displayNameTmpl = displayNameTmpl
+	}
+}
+
+// WithTemplateDescription sets the description template, which overrides the description of
+// the resource type. It can refer to path parameters. Keycloak resources have no description, so
+// KeycloakProvider registers resources without it.
+func WithTemplateDescription(descriptionTmpl string) ResourceTemplateOption {
+	return func(t *ResourceTemplate) {
+		t.descriptionTmpl = descriptionTmpl
+	}
+}
+
+// WithTemplateIconURI sets the icon uri template, which overrides the icon uri of the resource type.
+// It can refer to path parameters.
+func WithTemplateIconURI(iconURITmpl string) ResourceTemplateOption {
+	return func(t *ResourceTemplate) {
+		t.iconURITmpl = iconURITmpl
+	}
+}
+
+// WithTemplateLocalizedDisplayNames sets display name templates by locale e.g. {"fr": "Utilisateur {id}"}.
+// The locale is negotiated with the Accept-Language header of each request. If no locale matches, the
+// template given to WithTemplateDisplayName is used. Note that resources are registered with the display
+// name negotiated for the request that triggers the registration.
+func WithTemplateLocalizedDisplayNames(displayNameTmpls map[string]string) ResourceTemplateOption {
+	return func(t *ResourceTemplate) {
+		t.displayNameTmpls = displayNameTmpls
+	}
+}
+
+// WithTemplateLocalizedIconURIs sets icon uri templates by locale. They are selected like localized
+// display names.
+func WithTemplateLocalizedIconURIs(iconURITmpls map[string]string) ResourceTemplateOption {
+	return func(t *ResourceTemplate) {
+		t.iconURITmpls = iconURITmpls
+	}
+}
+
+// WithTemplateOwnerManagedAccess marks resources created from this template as owner managed, which
+// allows their owners to share them with others. Use it together with ManagerOptions.OwnerFromRequest
+// so that resources are owned by the requesting user.
+func WithTemplateOwnerManagedAccess() ResourceTemplateOption {
+	return func(t *ResourceTemplate) {
+		t.ownerManagedAccess = true
+	}
+}
+
+// WithTemplateIncludeScopes overrides ManagerOptions.IncludeScopesInPermissionTicket for resources
+// created from this template. Operation.IncludeScopes takes precedence.
+func WithTemplateIncludeScopes(include bool) ResourceTemplateOption {
+	return func(t *ResourceTemplate) {
+		t.includeScopes = &include
+	}
+}
+
+func NewResourceTemplate(rscType, rscNameTmpl string, opts ...ResourceTemplateOption) *ResourceTemplate {
+	t := &ResourceTemplate{
 		_type:    rscType,
 		nameTmpl: rscNameTmpl,
 	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+type resourceTemplateJSON struct {
+	Type               string `json:"type"`
+	Name               string `json:"name"`
+	DisplayName        string `json:"displayName,omitempty"`
+	Description        string `json:"description,omitempty"`
+	IconURI            string `json:"iconUri,omitempty"`
+	OwnerManagedAccess bool   `json:"ownerManagedAccess,omitempty"`
+	IncludeScopes      *bool  `json:"includeScopes,omitempty"`
+
+	LocalizedDisplayNames map[string]string `json:"localizedDisplayNames,omitempty"`
+	LocalizedIconURIs     map[string]string `json:"localizedIconUris,omitempty"`
+}
+
+func (t *ResourceTemplate) MarshalJSON() ([]byte, error) {
+	return json.Marshal(resourceTemplateJSON{
+		Type:               t._type,
+		Name:               t.nameTmpl,
+		DisplayName:        t.displayNameTmpl,
+		Description:        t.descriptionTmpl,
+		IconURI:            t.iconURITmpl,
+		OwnerManagedAccess: t.ownerManagedAccess,
+		IncludeScopes:      t.includeScopes,
+
+		LocalizedDisplayNames: t.displayNameTmpls,
+		LocalizedIconURIs:     t.iconURITmpls,
+	})
+}
+
+func (t *ResourceTemplate) UnmarshalJSON(b []byte) error {
+	obj := &resourceTemplateJSON{}
+	if err := json.Unmarshal(b, obj); err != nil {
+		return err
+	}
+	*t = ResourceTemplate{
+		_type:              obj.Type,
+		nameTmpl:           obj.Name,
+		displayNameTmpl:    obj.DisplayName,
+		descriptionTmpl:    obj.Description,
+		iconURITmpl:        obj.IconURI,
+		displayNameTmpls:   obj.LocalizedDisplayNames,
+		iconURITmpls:       obj.LocalizedIconURIs,
+		ownerManagedAccess: obj.OwnerManagedAccess,
+		includeScopes:      obj.IncludeScopes,
+	}
+	return nil
+}
+
+// render replaces "{param}" placeholders in tmpl with values from params, applying the template functions
+// that follow the parameter name e.g. "{id|pad:6}"
+func (t *ResourceTemplate) render(tmpl string, params map[string]string) string {
+	return renderTemplateFuncs(tmpl, params, t.funcs)
 }
 
 func (t *ResourceTemplate) CreateResource(types map[string]ResourceType, uri string, params map[string]string) (rsc *Resource) {
+	return t.createResource(types, uri, params, "")
+}
+
+// createResource renders a resource, localized according to the Accept-Language header value
+func (t *ResourceTemplate) createResource(types map[string]ResourceType, uri string, params map[string]string, acceptLanguage string) (rsc *Resource) {
 	uri = strings.TrimSuffix(uri, "/")
-	var name string
-	if t.nameTmpl != "" {
-		name = t.nameTmpl
-		for k, v := range params {
-			name = strings.ReplaceAll(name, fmt.Sprintf("{%s}", k), v)
-		}
-	}
 	rsc = &Resource{
-		ResourceType: types[t._type],
-		Name:         name,
-		URI:          uri,
+		ResourceType:       types[t._type],
+		Name:               t.render(t.nameTmpl, params),
+		URI:                uri,
+		OwnerManagedAccess: t.ownerManagedAccess,
+	}
+	if t.nameFunc != nil {
+		rsc.Name = t.nameFunc(params)
+	}
+	if t.displayNameTmpl != "" {
+		rsc.DisplayName = t.render(t.displayNameTmpl, params)
+	}
+	if t.descriptionTmpl != "" {
+		rsc.Description = t.render(t.descriptionTmpl, params)
+	}
+	if t.iconURITmpl != "" {
+		rsc.IconUri = t.render(t.iconURITmpl, params)
+	}
+	if acceptLanguage != "" && (t.displayNameTmpls != nil || t.iconURITmpls != nil) {
+		languages := parseAcceptLanguage(acceptLanguage)
+		if tmpl, ok := matchLocale(languages, t.displayNameTmpls); ok {
+			rsc.DisplayName = t.render(tmpl, params)
+		}
+		if tmpl, ok := matchLocale(languages, t.iconURITmpls); ok {
+			rsc.IconUri = t.render(tmpl, params)
+		}
 	}
 	return
 }
@@ -57,11 +207,21 @@ func (s Security) findScopes(securitySchemes map[string]struct{}) (scopes []stri
 	return []string{}
 }
 
+// Bool returns a pointer to v, e.g. to set Operation.IncludeScopes
+func Bool(v bool) *bool {
+	return &v
+}
+
 type Operation struct {
-	Security Security
+	Security Security `json:"security"`
+
+	// IncludeScopes if not nil, overrides ManagerOptions.IncludeScopesInPermissionTicket and
+	// WithTemplateIncludeScopes for this operation
+	IncludeScopes *bool `json:"includeScopes,omitempty"`
 }
 
 type Path struct {
+	tmpl       string
 	len        int
 	pathRegex  *regexp.Regexp
 	rscTmpl    *ResourceTemplate
@@ -75,6 +235,7 @@ func NewPath(pathTmpl string, rscTmpl *ResourceTemplate, operations map[string]O
 		panic(err)
 	}
 	return Path{
+		tmpl:       pathTmpl,
 		len:        len(pathTmpl),
 		pathRegex:  pathRegex,
 		rscTmpl:    rscTmpl,
@@ -82,21 +243,51 @@ func NewPath(pathTmpl string, rscTmpl *ResourceTemplate, operations map[string]O
 	}
 }
 
-func (p *Path) MatchPath(types map[string]ResourceType, baseURL, path string) (rsc *Resource, match bool) {
+type pathJSON struct {
+	Path       string               `json:"path"`
+	Resource   *ResourceTemplate    `json:"resource,omitempty"`
+	Operations map[string]Operation `json:"operations,omitempty"`
+}
+
+func (p Path) MarshalJSON() ([]byte, error) {
+	return json.Marshal(pathJSON{
+		Path:       p.tmpl,
+		Resource:   p.rscTmpl,
+		Operations: p.operations,
+	})
+}
+
+func (p *Path) UnmarshalJSON(b []byte) error {
+	obj := &pathJSON{}
+	if err := json.Unmarshal(b, obj); err != nil {
+		return err
+	}
+	*p = NewPath(obj.Path, obj.Resource, obj.Operations)
+	return nil
+}
+
+// match returns path parameters if path matches this path template
+func (p *Path) match(path string) (params map[string]string, ok bool) {
 	matches := p.pathRegex.FindStringSubmatch(path)
 	if matches == nil {
+		return nil, false
+	}
+	params = map[string]string{}
+	for i, paramName := range p.pathRegex.SubexpNames() {
+		if paramName == "" {
+			continue
+		}
+		params[paramName] = matches[i]
+	}
+	return params, true
+}
+
+func (p *Path) MatchPath(types map[string]ResourceType, baseURL, path string) (rsc *Resource, match bool) {
+	params, match := p.match(path)
+	if !match {
 		return
 	}
-	match = true
 	if p.rscTmpl != nil {
-		paramNames := p.pathRegex.SubexpNames()
-		params := map[string]string{}
-		for _, paramName := range paramNames {
-			if paramName == "" {
-				continue
-			}
-			params[paramName] = matches[p.pathRegex.SubexpIndex(paramName)]
-		}
 		rsc = p.rscTmpl.CreateResource(types, baseURL+path, params)
 	}
 	return
@@ -108,3 +299,15 @@ func (p *Path) FindScopes(securitySchemes map[string]struct{}, method string) (s
 	}
 	return nil
 }
+
+// includeScopes returns whether scopes are included in permission tickets for method, or nil if
+// neither the operation nor the resource template says so
+func (p *Path) includeScopes(method string) *bool {
+	if op, ok := p.operations[method]; ok && op.IncludeScopes != nil {
+		return op.IncludeScopes
+	}
+	if p.rscTmpl != nil {
+		return p.rscTmpl.includeScopes
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package uma_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/pckhoi/uma"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPathRewrite(t *testing.T) {
+	newHandler := func(opts uma.ManagerOptions, rsc **uma.Resource) http.Handler {
+		opts.GetBaseURL = func(r *http.Request) url.URL {
+			return url.URL{Scheme: "https", Host: "api.example.com"}
+		}
+		opts.CustomEnforce = func(r *http.Request, resource uma.Resource, scopes []string) bool {
+			*rsc = &resource
+			return true
+		}
+		return uma.New(
+			opts,
+			map[string]uma.ResourceType{
+				"user": {Type: "user", ResourceScopes: []string{"read"}},
+			},
+			[]string{"oidc"},
+			nil,
+			[]map[string][]string{{"oidc": {"read"}}},
+			[]uma.Path{
+				uma.NewPath("/users/{id}", uma.NewResourceTemplate("user", "User {id}"), map[string]uma.Operation{
+					http.MethodGet: {},
+				}),
+			},
+			testr.New(t),
+		).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	}
+
+	for _, c := range []struct {
+		name   string
+		opts   uma.ManagerOptions
+		path   string
+		prefix string
+		uri    string
+	}{
+		{"no rewrite", uma.ManagerOptions{}, "/svc/users/1", "", ""},
+		{"rewrite", uma.ManagerOptions{
+			PathRewrite: func(path string) string {
+				return strings.TrimPrefix(path, "/svc")
+			},
+		}, "/svc/users/1", "", "https://api.example.com/users/1"},
+		{"forwarded prefix", uma.ManagerOptions{StripForwardedPrefix: true}, "/svc/users/1", "/svc/", "https://api.example.com/users/1"},
+		{"forwarded prefix already stripped", uma.ManagerOptions{StripForwardedPrefix: true}, "/users/1", "/svc", "https://api.example.com/users/1"},
+		{"forwarded prefix at segment boundary", uma.ManagerOptions{StripForwardedPrefix: true}, "/svcx/users/1", "/svc", ""},
+		{"forwarded prefix not trusted", uma.ManagerOptions{}, "/svc/users/1", "/svc", ""},
+		{"forwarded prefix then rewrite", uma.ManagerOptions{
+			StripForwardedPrefix: true,
+			PathRewrite: func(path string) string {
+				return strings.Replace(path, "/people/", "/users/", 1)
+			},
+		}, "/svc/people/1", "/svc", "https://api.example.com/users/1"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			var rsc *uma.Resource
+			h := newHandler(c.opts, &rsc)
+			r := httptest.NewRequest(http.MethodGet, "https://api.example.com"+c.path, nil)
+			if c.prefix != "" {
+				r.Header.Set("X-Forwarded-Prefix", c.prefix)
+			}
+			h.ServeHTTP(httptest.NewRecorder(), r)
+			if c.uri == "" {
+				assert.Nil(t, rsc)
+			} else if assert.NotNil(t, rsc) {
+				assert.Equal(t, c.uri, rsc.URI)
+			}
+		})
+	}
+}
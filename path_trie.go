@@ -0,0 +1,187 @@
+package uma
+
+import (
+	"regexp"
+	"strings"
+)
+
+// pathSegment is one "/"-separated segment of a path template. A segment is either static text,
+// a single parameter e.g. "{id}", or a pattern that mixes text and parameters e.g. "{name}.json".
+type pathSegment struct {
+	static  string
+	param   string
+	pattern *regexp.Regexp
+	names   []string
+}
+
+func parseSegment(s string) pathSegment {
+	locs := paramRegex.FindAllStringSubmatchIndex(s, -1)
+	if len(locs) == 0 {
+		return pathSegment{static: s}
+	}
+	if len(locs) == 1 && locs[0][0] == 0 && locs[0][1] == len(s) {
+		return pathSegment{param: s[locs[0][2]:locs[0][3]]}
+	}
+	seg := pathSegment{}
+	sb := &strings.Builder{}
+	sb.WriteString("^")
+	last := 0
+	for _, loc := range locs {
+		sb.WriteString(regexp.QuoteMeta(s[last:loc[0]]))
+		sb.WriteString("([^/]+)")
+		seg.names = append(seg.names, s[loc[2]:loc[3]])
+		last = loc[1]
+	}
+	sb.WriteString(regexp.QuoteMeta(s[last:]))
+	sb.WriteString("$")
+	seg.pattern = regexp.MustCompile(sb.String())
+	return seg
+}
+
+// trieNode is a node of pathTrie. Children are tried in order of precedence: static segments
+// first, then patterns, then parameters.
+type trieNode struct {
+	static   map[string]*trieNode
+	patterns []*trieNode
+	param    *trieNode
+	pattern  *regexp.Regexp
+
+	// index of the path template that ends at this node, or -1
+	index    int
+	segments []pathSegment
+}
+
+func newTrieNode() *trieNode {
+	return &trieNode{index: -1}
+}
+
+// pathTrie matches request paths against path templates segment by segment, so the cost of
+// matching depends on the length of the path rather than the number of templates.
+type pathTrie struct {
+	root *trieNode
+}
+
+func newPathTrie(templates []string) *pathTrie {
+	t := &pathTrie{root: newTrieNode()}
+	for i, tmpl := range templates {
+		t.insert(i, tmpl)
+	}
+	return t
+}
+
+func splitPath(path string) []string {
+	return strings.Split(strings.TrimPrefix(path, "/"), "/")
+}
+
+func (t *pathTrie) insert(index int, tmpl string) {
+	n := t.root
+	segments := []pathSegment{}
+	for _, s := range splitPath(tmpl) {
+		seg := parseSegment(s)
+		segments = append(segments, seg)
+		switch {
+		case seg.param != "":
+			if n.param == nil {
+				n.param = newTrieNode()
+			}
+			n = n.param
+		case seg.pattern != nil:
+			var child *trieNode
+			for _, c := range n.patterns {
+				if c.pattern.String() == seg.pattern.String() {
+					child = c
+					break
+				}
+			}
+			if child == nil {
+				child = newTrieNode()
+				child.pattern = seg.pattern
+				n.patterns = append(n.patterns, child)
+			}
+			n = child
+		default:
+			if n.static == nil {
+				n.static = map[string]*trieNode{}
+			}
+			child, ok := n.static[seg.static]
+			if !ok {
+				child = newTrieNode()
+				n.static[seg.static] = child
+			}
+			n = child
+		}
+	}
+	// when several templates are equivalent, the first one wins
+	if n.index == -1 {
+		n.index = index
+		n.segments = segments
+	}
+}
+
+// match returns the index of the template that matches path along with path parameters. Like
+// templates, path must start with "/". A single trailing slash is ignored.
+func (t *pathTrie) match(path string) (index int, params map[string]string, ok bool) {
+	if !strings.HasPrefix(path, "/") {
+		return -1, nil, false
+	}
+	segs := splitPath(path)
+	n := t.root.find(segs)
+	if n == nil && len(path) > 1 && strings.HasSuffix(path, "/") {
+		segs = segs[:len(segs)-1]
+		n = t.root.find(segs)
+	}
+	if n == nil {
+		return -1, nil, false
+	}
+	return n.index, n.params(segs), true
+}
+
+func (n *trieNode) find(segs []string) *trieNode {
+	if len(segs) == 0 {
+		if n.index == -1 {
+			return nil
+		}
+		return n
+	}
+	seg, rest := segs[0], segs[1:]
+	if c, ok := n.static[seg]; ok {
+		if found := c.find(rest); found != nil {
+			return found
+		}
+	}
+	if seg == "" {
+		return nil
+	}
+	for _, c := range n.patterns {
+		if c.pattern.MatchString(seg) {
+			if found := c.find(rest); found != nil {
+				return found
+			}
+		}
+	}
+	if n.param != nil {
+		return n.param.find(rest)
+	}
+	return nil
+}
+
+// params extracts path parameters from segs, which must match the template ending at n
+func (n *trieNode) params(segs []string) map[string]string {
+	var params map[string]string
+	for i, seg := range n.segments {
+		if seg.param == "" && seg.pattern == nil {
+			continue
+		}
+		if params == nil {
+			params = map[string]string{}
+		}
+		if seg.param != "" {
+			params[seg.param] = segs[i]
+			continue
+		}
+		for j, v := range seg.pattern.FindStringSubmatch(segs[i])[1:] {
+			params[seg.names[j]] = v
+		}
+	}
+	return params
+}
@@ -0,0 +1,65 @@
+package uma_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/pckhoi/uma"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPathMatching(t *testing.T) {
+	var matched string
+	read := map[string]uma.Operation{http.MethodGet: {}}
+	man := uma.New(
+		uma.ManagerOptions{
+			GetBaseURL: func(r *http.Request) url.URL {
+				return url.URL{Scheme: "https", Host: "api.example.com", Path: "/api"}
+			},
+			CustomEnforce: func(r *http.Request, resource uma.Resource, scopes []string) bool {
+				matched = resource.Name
+				return true
+			},
+		},
+		map[string]uma.ResourceType{"doc": {Type: "doc"}},
+		[]string{"oidc"},
+		nil,
+		[]map[string][]string{{"oidc": {"read"}}},
+		[]uma.Path{
+			uma.NewPath("/users/{id}", uma.NewResourceTemplate("doc", "User {id}"), read),
+			uma.NewPath("/users/me", uma.NewResourceTemplate("doc", "Me"), read),
+			uma.NewPath("/users/{id}/files/{name}.{ext}", uma.NewResourceTemplate("doc", "File {name} ({ext}) of {id}"), read),
+			uma.NewPath("/users/{id}/files/{file}", uma.NewResourceTemplate("doc", "File {file} of {id}"), read),
+			uma.NewPath("/users/me/settings", uma.NewResourceTemplate("doc", "My settings"), read),
+			uma.NewPath("/users/{userId}/posts", uma.NewResourceTemplate("doc", "Posts of {userId}"), read),
+			uma.NewPath("/users/{other}", uma.NewResourceTemplate("doc", "Other {other}"), read),
+		},
+		testr.New(t),
+	)
+	h := man.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for path, name := range map[string]string{
+		"/users/1":                 "User 1",
+		"/users/1/":                "User 1",
+		"/users/me":                "Me",
+		"/users/me/settings":       "My settings",
+		"/users/me/posts":          "Posts of me",
+		"/users/2/posts/":          "Posts of 2",
+		"/users/3/files/a.txt":     "File a (txt) of 3",
+		"/users/3/files/README":    "File README of 3",
+		"/users/3/files/.hidden":   "File .hidden of 3",
+		"/users":                   "",
+		"/users/1//":               "",
+		"/users//posts":            "",
+		"/users/1/files/a.txt/raw": "",
+		"/other/1":                 "",
+	} {
+		matched = ""
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "https://api.example.com/api"+path, nil))
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, name, matched, "path %q", path)
+	}
+}
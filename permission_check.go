@@ -0,0 +1,30 @@
+package uma
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/go-logr/logr"
+)
+
+// checkPermission returns nil if rpt grants scopes on rsc. The permissions of the token are checked,
+// unless p is a PermissionCheckingProvider, which is asked instead.
+func (m *Manager) checkPermission(r *http.Request, p Provider, rpt *RPT, rsc *Resource, scopes []string, logger logr.Logger) error {
+	now := m.clock.Now()
+	pc, ok := p.(PermissionCheckingProvider)
+	if !ok {
+		return rpt.check(now, rsc.ID, m.disableExpireCheck, scopes, logger)
+	}
+	if !m.disableExpireCheck {
+		if err := rpt.validateExpiry(now, rsc.ID); err != nil {
+			return rpt.logInvalid(now, rsc.ID, err, logger)
+		}
+	}
+	return rpt.logInvalid(now, rsc.ID, pc.CheckPermission(r.Context(), rpt, *rsc, scopes), logger)
+}
+
+// isCheckFailure reports whether err tells that a PermissionCheckingProvider couldn't decide, rather
+// than that the token is invalid
+func isCheckFailure(err error) bool {
+	return err != nil && !errors.As(err, &ErrInvalidRPT{})
+}
@@ -0,0 +1,53 @@
+package uma
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ReadPermissions replaces the permissions of the token with those found at path of its claims, for
+// authorization servers that don't put them in authorization.permissions like Keycloak does. Each element
+// of path is a claim name, so names that contain dots, e.g. namespaced claims, need no escaping:
+//
+//	rpt.ReadPermissions("https://example.com/claims", "permissions")
+//
+// The claim must be an array of objects with rsid, rsname and scopes members. The token has no
+// permissions if the claim doesn't exist.
+func (t *RPT) ReadPermissions(path ...string) error {
+	var v interface{} = t.Raw
+	for _, name := range path {
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			v = nil
+			break
+		}
+		v = obj[name]
+	}
+	t.Authorization = nil
+	if v == nil {
+		return nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	perms := []Permission{}
+	if err := json.Unmarshal(b, &perms); err != nil {
+		return fmt.Errorf("error parsing permissions at %q: %w", strings.Join(path, "."), err)
+	}
+	t.Authorization = &Authorization{Permissions: perms}
+	return nil
+}
+
+// parseRPT is ParseRPT that reads permissions from ManagerOptions.PermissionClaimPath if it is set
+func (m *Manager) parseRPT(b []byte) (*RPT, error) {
+	rpt, err := ParseRPT(b)
+	if err != nil || len(m.permissionClaimPath) == 0 {
+		return rpt, err
+	}
+	if err := rpt.ReadPermissions(m.permissionClaimPath...); err != nil {
+		return nil, err
+	}
+	return rpt, nil
+}
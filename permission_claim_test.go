@@ -0,0 +1,57 @@
+package uma_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/pckhoi/uma"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadPermissions(t *testing.T) {
+	rpt, err := uma.ParseRPT([]byte(`{
+		"permissions": [{"rsid": "rsc-1", "scopes": ["read"]}],
+		"https://example.com/uma": {"permissions": [{"rsid": "rsc-2", "rsname": "User 2"}]},
+		"authorization": {"permissions": [{"rsid": "rsc-3"}]},
+		"invalid": {"permissions": "rsc-4"}
+	}`))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"rsc-3"}, rpt.ResourceIDs())
+
+	require.NoError(t, rpt.ReadPermissions("permissions"))
+	assert.Equal(t, []uma.Permission{{Rsid: "rsc-1", Scopes: []string{"read"}}}, rpt.Permissions())
+	assert.True(t, rpt.HasScopes("rsc-1", "read"))
+
+	require.NoError(t, rpt.ReadPermissions("https://example.com/uma", "permissions"))
+	assert.Equal(t, []uma.Permission{{Rsid: "rsc-2", Rsname: "User 2"}}, rpt.Permissions())
+
+	require.NoError(t, rpt.ReadPermissions("missing", "permissions"))
+	assert.Empty(t, rpt.Permissions())
+
+	require.NoError(t, rpt.ReadPermissions("permissions", "nested"))
+	assert.Empty(t, rpt.Permissions())
+
+	assert.ErrorContains(t, rpt.ReadPermissions("invalid", "permissions"), `error parsing permissions at "invalid.permissions"`)
+}
+
+func TestManagerPermissionClaimPath(t *testing.T) {
+	p := newMockProvider(map[string]string{
+		"flat":     `{"sub":"user-1","permissions":[{"rsid":"rsc-User 1","scopes":["read"]}]}`,
+		"keycloak": rptPayload("user-1", "User 1", "read"),
+		"invalid":  `{"sub":"user-1","permissions":{"rsid":"rsc-User 1"}}`,
+	})
+	h := newMockManager(t, p, uma.ManagerOptions{PermissionClaimPath: []string{"permissions"}}).
+		Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Contains(t, uma.GetClaimsScopes(r), "read")
+		}))
+
+	for token, status := range map[string]int{
+		"flat":     http.StatusOK,
+		"keycloak": http.StatusUnauthorized,
+		"invalid":  http.StatusUnauthorized,
+	} {
+		rec := serve(h, http.MethodGet, "https://api.example.com/users/1", token)
+		assert.Equal(t, status, rec.Code, token)
+	}
+}
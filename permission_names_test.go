@@ -0,0 +1,81 @@
+package uma_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/pckhoi/uma"
+	"github.com/stretchr/testify/assert"
+)
+
+// namedPayload grants read on the resource with id rsid, naming it rsname if not empty
+func namedPayload(rsid, rsname string) string {
+	name := ""
+	if rsname != "" {
+		name = fmt.Sprintf(`"rsname":%q,`, rsname)
+	}
+	return fmt.Sprintf(
+		`{"sub":"user-1","authorization":{"permissions":[{"rsid":%q,%s"scopes":["read"]}]}}`,
+		rsid, name,
+	)
+}
+
+func TestPermissionNames(t *testing.T) {
+	p := newMockProvider(map[string]string{
+		"match":    namedPayload("rsc-User 1", "User 1"),
+		"mismatch": namedPayload("rsc-User 1", "User 2"),
+		"unnamed":  namedPayload("rsc-User 1", ""),
+	})
+	handler := func(opts uma.ManagerOptions) http.Handler {
+		return newMockManager(t, p, opts).
+			Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	}
+
+	for i, c := range []struct {
+		opts     uma.ManagerOptions
+		statuses map[string]int
+	}{
+		{
+			opts: uma.ManagerOptions{},
+			statuses: map[string]int{
+				"match":    http.StatusOK,
+				"mismatch": http.StatusOK,
+				"unnamed":  http.StatusOK,
+			},
+		},
+		{
+			opts: uma.ManagerOptions{VerifyPermissionNames: true},
+			statuses: map[string]int{
+				"match":    http.StatusOK,
+				"mismatch": http.StatusUnauthorized,
+				"unnamed":  http.StatusOK,
+			},
+		},
+		{
+			opts: uma.ManagerOptions{RequirePermissionNames: true},
+			statuses: map[string]int{
+				"match":    http.StatusOK,
+				"mismatch": http.StatusUnauthorized,
+				"unnamed":  http.StatusUnauthorized,
+			},
+		},
+	} {
+		h := handler(c.opts)
+		for token, status := range c.statuses {
+			rec := serve(h, http.MethodGet, "https://api.example.com/users/1", token)
+			assert.Equal(t, status, rec.Code, "%d %s", i, token)
+		}
+	}
+}
+
+func TestErrInvalidRPTNames(t *testing.T) {
+	assert.Equal(t,
+		`invalid rpt: permission for resource "rsc-1" names resource "User 2"`,
+		uma.ErrInvalidRPT{Reason: uma.RPTResourceMismatch, ResourceID: "rsc-1", Name: "User 2"}.Error(),
+	)
+	assert.Equal(t,
+		`invalid rpt: permission for resource "rsc-1" has no name`,
+		uma.ErrInvalidRPT{Reason: uma.RPTUnnamedPermission, ResourceID: "rsc-1"}.Error(),
+	)
+}
@@ -0,0 +1,116 @@
+// Package clock abstracts the current time, so that expiry of tokens, credentials and cache entries
+// can be tested and simulated deterministically.
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells the current time
+type Clock interface {
+	Now() time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// Real is the system clock
+var Real Clock = realClock{}
+
+// OrReal returns c, or Real if c is nil
+func OrReal(c Clock) Clock {
+	if c == nil {
+		return Real
+	}
+	return c
+}
+
+// Timer is implemented by clocks that schedule their own timers, like Fake
+type Timer interface {
+	After(d time.Duration) <-chan time.Time
+}
+
+// After waits for d to elapse on c, then sends the current time of c on the returned channel. Timers
+// of clocks that don't implement Timer follow the system clock.
+func After(c Clock, d time.Duration) <-chan time.Time {
+	if t, ok := c.(Timer); ok {
+		return t.After(d)
+	}
+	return time.After(d)
+}
+
+// Fake is a Clock that only moves when told to. It is safe for concurrent use.
+type Fake struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []fakeWaiter
+}
+
+type fakeWaiter struct {
+	deadline time.Time
+	ch       chan time.Time
+}
+
+// NewFake creates a Fake clock set at now
+func NewFake(now time.Time) *Fake {
+	return &Fake{now: now}
+}
+
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+// After returns a channel that receives the time once the clock is moved d forward
+func (f *Fake) After(d time.Duration) <-chan time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- f.now
+		return ch
+	}
+	f.waiters = append(f.waiters, fakeWaiter{deadline: f.now.Add(d), ch: ch})
+	return ch
+}
+
+// Waiters returns the number of timers that haven't fired yet, so that tests can wait for the code
+// under test to start waiting before moving the clock
+func (f *Fake) Waiters() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.waiters)
+}
+
+// Advance moves the clock forward by d
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.set(f.now.Add(d))
+}
+
+// Set sets the clock at now
+func (f *Fake) Set(now time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.set(now)
+}
+
+// set moves the clock and fires due timers, f.mu must be held
+func (f *Fake) set(now time.Time) {
+	f.now = now
+	waiters := f.waiters[:0]
+	for _, w := range f.waiters {
+		if now.Before(w.deadline) {
+			waiters = append(waiters, w)
+			continue
+		}
+		w.ch <- now
+	}
+	f.waiters = waiters
+}
@@ -0,0 +1,380 @@
+/*
+Package conformance runs an uma.Provider through the resource server side of UMA 2.0 Federated
+Authorization against a live authorization server, and reports which behaviors conform to the
+specification. It is meant to validate new provider implementations:
+
+	p, err := uma.NewKeycloakProvider(issuer, clientID, clientSecret, keySet, logger)
+	if err != nil {
+		panic(err)
+	}
+	report := conformance.Run(conformance.Config{Provider: p})
+	report.WriteText(os.Stdout)
+	if !report.Passed() {
+		os.Exit(1)
+	}
+
+Checks create, modify and delete resources prefixed with Config.NamePrefix, so point the provider to
+a realm or tenant dedicated to testing.
+*/
+package conformance
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pckhoi/uma"
+	"github.com/pckhoi/uma/pkg/httputil"
+)
+
+const (
+	fedAuthzSpec = "https://docs.kantarainitiative.org/uma/wg/rec-oauth-uma-federated-authz-2.0.html"
+	grantSpec    = "https://docs.kantarainitiative.org/uma/wg/rec-oauth-uma-grant-2.0.html"
+
+	umaTicketGrantType = "urn:ietf:params:oauth:grant-type:uma-ticket"
+)
+
+type Config struct {
+	// Provider is the provider under test
+	Provider uma.Provider
+
+	// NamePrefix is prepended to names of resources created during the run. Defaults to "uma-conformance-".
+	NamePrefix string
+
+	// Scopes are registered with the test resource. Defaults to "read" and "write".
+	Scopes []string
+}
+
+// Result is the outcome of a single check
+type Result struct {
+	Name string `json:"name"`
+
+	// Ref links to the section of the specification that describes the checked behavior
+	Ref string `json:"ref"`
+
+	Passed bool `json:"passed"`
+
+	// Skipped is true if the check could not run because an earlier check failed
+	Skipped bool `json:"skipped,omitempty"`
+
+	// Message explains why the check failed or was skipped
+	Message  string        `json:"message,omitempty"`
+	Duration time.Duration `json:"duration"`
+}
+
+type Report struct {
+	Issuer  string    `json:"issuer"`
+	Started time.Time `json:"started"`
+	Results []Result  `json:"results"`
+}
+
+// Passed returns true if every check passed
+func (r *Report) Passed() bool {
+	for _, res := range r.Results {
+		if !res.Passed {
+			return false
+		}
+	}
+	return true
+}
+
+// WriteText writes a human readable report to w
+func (r *Report) WriteText(w io.Writer) error {
+	passed := 0
+	sb := &strings.Builder{}
+	fmt.Fprintf(sb, "UMA 2.0 conformance report for %s (%s)\n\n", r.Issuer, r.Started.Format(time.RFC3339))
+	for _, res := range r.Results {
+		status := "FAIL"
+		switch {
+		case res.Passed:
+			status = "PASS"
+			passed++
+		case res.Skipped:
+			status = "SKIP"
+		}
+		fmt.Fprintf(sb, "%s  %s (%s)\n", status, res.Name, res.Duration.Round(time.Millisecond))
+		if res.Message != "" {
+			fmt.Fprintf(sb, "      %s\n", res.Message)
+		}
+		if !res.Passed {
+			fmt.Fprintf(sb, "      see %s\n", res.Ref)
+		}
+	}
+	fmt.Fprintf(sb, "\n%d/%d checks passed\n", passed, len(r.Results))
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+type check struct {
+	name string
+	ref  string
+
+	// requires is true if the check needs the test resource to be registered
+	requires bool
+	run      func(s *state) error
+}
+
+// state is shared by checks of a run
+type state struct {
+	cfg        Config
+	resourceID string
+	ticket     string
+}
+
+// Run runs all checks in order and returns the report
+func Run(cfg Config) *Report {
+	if cfg.NamePrefix == "" {
+		cfg.NamePrefix = "uma-conformance-"
+	}
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"read", "write"}
+	}
+	report := &Report{
+		Issuer:  cfg.Provider.WWWAuthenticateDirectives().AsUri,
+		Started: time.Now(),
+	}
+	s := &state{cfg: cfg}
+	for _, c := range checks {
+		res := Result{Name: c.name, Ref: c.ref}
+		if c.requires && s.resourceID == "" {
+			res.Skipped = true
+			res.Message = "skipped because resource registration failed"
+			report.Results = append(report.Results, res)
+			continue
+		}
+		start := time.Now()
+		err := c.run(s)
+		res.Duration = time.Since(start)
+		if err != nil {
+			res.Message = err.Error()
+		} else {
+			res.Passed = true
+		}
+		report.Results = append(report.Results, res)
+	}
+	return report
+}
+
+func scopeNames(scopes []uma.Scope) []string {
+	names := make([]string, 0, len(scopes))
+	for _, s := range scopes {
+		names = append(names, s.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// resourceScopes returns scope names of a resource description, which authorization servers
+// return either as strings or as objects
+func resourceScopes(rsc *uma.ExpandedResource) []string {
+	if len(rsc.ResourceScopes) > 0 {
+		return scopeNames(rsc.ResourceScopes)
+	}
+	return scopeNames(rsc.Scopes)
+}
+
+func sameStrings(a, b []string) bool {
+	a = append([]string{}, a...)
+	b = append([]string{}, b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	return strings.Join(a, " ") == strings.Join(b, " ")
+}
+
+// expectStatus checks that err is an error response with one of the given statuses
+func expectStatus(err error, statuses ...int) error {
+	if err == nil {
+		return fmt.Errorf("expected error response %v, got success", statuses)
+	}
+	var respErr *httputil.ErrUnanticipatedResponse
+	if !errors.As(err, &respErr) {
+		return fmt.Errorf("expected error response %v, got %v", statuses, err)
+	}
+	for _, s := range statuses {
+		if respErr.Status == s {
+			return nil
+		}
+	}
+	return fmt.Errorf("expected error response %v, got %d", statuses, respErr.Status)
+}
+
+var checks = []check{
+	{
+		name: "discovery document has required metadata",
+		ref:  grantSpec + "#as-config",
+		run: func(s *state) error {
+			doc := s.cfg.Provider.Discovery()
+			missing := []string{}
+			for k, v := range map[string]string{
+				"issuer":                         doc.Issuer,
+				"token_endpoint":                 doc.TokenEndpoint,
+				"resource_registration_endpoint": doc.ResourceRegistrationEndpoint,
+				"permission_endpoint":            doc.PermissionEndpoint,
+			} {
+				if v == "" {
+					missing = append(missing, k)
+				}
+			}
+			if len(missing) > 0 {
+				sort.Strings(missing)
+				return fmt.Errorf("missing %s", strings.Join(missing, ", "))
+			}
+			for _, g := range doc.GrantTypesSupported {
+				if g == umaTicketGrantType {
+					return nil
+				}
+			}
+			return fmt.Errorf("grant_types_supported does not include %q", umaTicketGrantType)
+		},
+	},
+	{
+		name: "resource registration returns an id",
+		ref:  fedAuthzSpec + "#create-resource-set",
+		run: func(s *state) error {
+			resp, err := s.cfg.Provider.CreateResource(&uma.Resource{
+				ResourceType: uma.ResourceType{
+					Type:           "conformance",
+					ResourceScopes: s.cfg.Scopes,
+				},
+				Name: fmt.Sprintf("%s%d", s.cfg.NamePrefix, time.Now().UnixNano()),
+			})
+			if err != nil {
+				return err
+			}
+			if resp.ID == "" {
+				return errors.New("response has no _id")
+			}
+			s.resourceID = resp.ID
+			return nil
+		},
+	},
+	{
+		name:     "registered resource can be read",
+		ref:      fedAuthzSpec + "#read-resource-set",
+		requires: true,
+		run: func(s *state) error {
+			rsc, err := s.cfg.Provider.GetResource(s.resourceID)
+			if err != nil {
+				return err
+			}
+			if !strings.HasPrefix(rsc.Name, s.cfg.NamePrefix) {
+				return fmt.Errorf("unexpected name %q", rsc.Name)
+			}
+			if scopes := resourceScopes(rsc); !sameStrings(scopes, s.cfg.Scopes) {
+				return fmt.Errorf("expected resource_scopes %v, got %v", s.cfg.Scopes, scopes)
+			}
+			return nil
+		},
+	},
+	{
+		name:     "registered resource can be updated",
+		ref:      fedAuthzSpec + "#update-resource-set",
+		requires: true,
+		run: func(s *state) error {
+			scopes := append(append([]string{}, s.cfg.Scopes...), "conformance-extra")
+			rsc, err := s.cfg.Provider.GetResource(s.resourceID)
+			if err != nil {
+				return err
+			}
+			if err := s.cfg.Provider.UpdateResource(s.resourceID, &uma.Resource{
+				ResourceType: uma.ResourceType{
+					Type:           "conformance",
+					ResourceScopes: scopes,
+				},
+				Name: rsc.Name,
+			}); err != nil {
+				return err
+			}
+			rsc, err = s.cfg.Provider.GetResource(s.resourceID)
+			if err != nil {
+				return err
+			}
+			if got := resourceScopes(rsc); !sameStrings(got, scopes) {
+				return fmt.Errorf("expected resource_scopes %v after update, got %v", scopes, got)
+			}
+			return nil
+		},
+	},
+	{
+		name:     "registered resource is listed",
+		ref:      fedAuthzSpec + "#list-resource-sets",
+		requires: true,
+		run: func(s *state) error {
+			ids, err := s.cfg.Provider.ListResources(nil)
+			if err != nil {
+				return err
+			}
+			for _, id := range ids {
+				if id == s.resourceID {
+					return nil
+				}
+			}
+			return fmt.Errorf("resource %q not found in %d listed resources", s.resourceID, len(ids))
+		},
+	},
+	{
+		name:     "permission endpoint issues a ticket",
+		ref:      fedAuthzSpec + "#permission-endpoint",
+		requires: true,
+		run: func(s *state) error {
+			ticket, err := s.cfg.Provider.CreatePermissionTicket(s.resourceID, s.cfg.Scopes[0])
+			if err != nil {
+				return err
+			}
+			if ticket == "" {
+				return errors.New("response has no ticket")
+			}
+			s.ticket = ticket
+			return nil
+		},
+	},
+	{
+		name:     "ticket fits in WWW-Authenticate header",
+		ref:      grantSpec + "#permission-success-to-client",
+		requires: true,
+		run: func(s *state) error {
+			if s.ticket == "" {
+				return errors.New("no ticket was issued")
+			}
+			if i := strings.IndexFunc(s.ticket, func(r rune) bool {
+				return r <= ' ' || r > '~' || r == '"' || r == '\\'
+			}); i != -1 {
+				return fmt.Errorf("ticket has character %q that must be escaped in a quoted string", s.ticket[i])
+			}
+			return nil
+		},
+	},
+	{
+		name: "permission request for unknown resource is rejected",
+		ref:  fedAuthzSpec + "#permission-failure-to-rs",
+		run: func(s *state) error {
+			_, err := s.cfg.Provider.CreatePermissionTicket(s.cfg.NamePrefix+"unknown-resource", "read")
+			return expectStatus(err, http.StatusBadRequest, http.StatusNotFound)
+		},
+	},
+	{
+		name:     "permission request for unknown scope is rejected",
+		ref:      fedAuthzSpec + "#permission-failure-to-rs",
+		requires: true,
+		run: func(s *state) error {
+			_, err := s.cfg.Provider.CreatePermissionTicket(s.resourceID, s.cfg.NamePrefix+"unknown-scope")
+			return expectStatus(err, http.StatusBadRequest)
+		},
+	},
+	{
+		name:     "registered resource can be deleted",
+		ref:      fedAuthzSpec + "#delete-resource-set",
+		requires: true,
+		run: func(s *state) error {
+			if err := s.cfg.Provider.DeleteResource(s.resourceID); err != nil {
+				return err
+			}
+			_, err := s.cfg.Provider.GetResource(s.resourceID)
+			return expectStatus(err, http.StatusNotFound)
+		},
+	},
+}
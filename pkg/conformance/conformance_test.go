@@ -0,0 +1,164 @@
+package conformance
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/pckhoi/uma"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeResource struct {
+	ID             string   `json:"_id"`
+	Name           string   `json:"name"`
+	Type           string   `json:"type,omitempty"`
+	ResourceScopes []string `json:"resource_scopes,omitempty"`
+}
+
+// fakeAS is an in-memory authorization server. If lenient is true, it issues tickets for unknown scopes.
+func fakeAS(t *testing.T, lenient bool) *httptest.Server {
+	var mu sync.Mutex
+	resources := map[string]*fakeResource{}
+	counter := 0
+	var issuer string
+	writeJSON := func(w http.ResponseWriter, status int, obj any) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		require.NoError(t, json.NewEncoder(w).Encode(obj))
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/uma2-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]any{
+			"issuer":                         issuer,
+			"token_endpoint":                 issuer + "/token",
+			"resource_registration_endpoint": issuer + "/resource_set",
+			"permission_endpoint":            issuer + "/permission",
+			"grant_types_supported":          []string{"client_credentials", umaTicketGrantType},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]any{"access_token": "pat", "expires_in": 300})
+	})
+	mux.HandleFunc("/resource_set", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Method == http.MethodGet {
+			ids := []string{}
+			for id := range resources {
+				ids = append(ids, id)
+			}
+			writeJSON(w, http.StatusOK, ids)
+			return
+		}
+		rsc := &fakeResource{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(rsc))
+		counter++
+		rsc.ID = fmt.Sprintf("rsc-%d", counter)
+		resources[rsc.ID] = rsc
+		writeJSON(w, http.StatusCreated, map[string]string{"_id": rsc.ID})
+	})
+	mux.HandleFunc("/resource_set/", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		id := strings.TrimPrefix(r.URL.Path, "/resource_set/")
+		rsc, ok := resources[id]
+		if !ok {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "not_found"})
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			// like Keycloak, scopes are described with objects
+			scopes := []map[string]string{}
+			for _, s := range rsc.ResourceScopes {
+				scopes = append(scopes, map[string]string{"name": s})
+			}
+			writeJSON(w, http.StatusOK, map[string]any{
+				"_id":             rsc.ID,
+				"name":            rsc.Name,
+				"type":            rsc.Type,
+				"resource_scopes": scopes,
+			})
+		case http.MethodPut:
+			updated := &fakeResource{}
+			require.NoError(t, json.NewDecoder(r.Body).Decode(updated))
+			updated.ID = id
+			resources[id] = updated
+			w.WriteHeader(http.StatusNoContent)
+		case http.MethodDelete:
+			delete(resources, id)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+	mux.HandleFunc("/permission", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		reqs := []struct {
+			ResourceID     string   `json:"resource_id"`
+			ResourceScopes []string `json:"resource_scopes"`
+		}{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&reqs))
+		for _, req := range reqs {
+			rsc, ok := resources[req.ResourceID]
+			if !ok {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_resource_id"})
+				return
+			}
+			if lenient {
+				continue
+			}
+			for _, s := range req.ResourceScopes {
+				found := false
+				for _, rs := range rsc.ResourceScopes {
+					found = found || rs == s
+				}
+				if !found {
+					writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_scope"})
+					return
+				}
+			}
+		}
+		writeJSON(w, http.StatusCreated, map[string]string{"ticket": "ticket-1"})
+	})
+	s := httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	issuer = s.URL
+	return s
+}
+
+func TestRun(t *testing.T) {
+	s := fakeAS(t, false)
+	p, err := uma.NewBaseProvider(s.URL, "client", "secret", nil, s.Client(), testr.New(t))
+	require.NoError(t, err)
+
+	report := Run(Config{Provider: p})
+	buf := &bytes.Buffer{}
+	require.NoError(t, report.WriteText(buf))
+	assert.True(t, report.Passed(), buf.String())
+	assert.Len(t, report.Results, len(checks))
+	assert.Contains(t, buf.String(), fmt.Sprintf("%d/%d checks passed", len(checks), len(checks)))
+}
+
+func TestRunReportsFailures(t *testing.T) {
+	s := fakeAS(t, true)
+	p, err := uma.NewBaseProvider(s.URL, "client", "secret", nil, s.Client(), testr.New(t))
+	require.NoError(t, err)
+
+	report := Run(Config{Provider: p})
+	assert.False(t, report.Passed())
+	failed := []string{}
+	for _, res := range report.Results {
+		if !res.Passed {
+			failed = append(failed, res.Name)
+		}
+	}
+	assert.Equal(t, []string{"permission request for unknown scope is rejected"}, failed)
+}
@@ -2,12 +2,15 @@ package httputil
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"net/http"
 	"net/url"
+	"sync"
 	"time"
 
 	"github.com/go-logr/logr"
+	"github.com/pckhoi/uma/pkg/clock"
 )
 
 type ClientCreds struct {
@@ -20,57 +23,141 @@ type ClientCreds struct {
 	expiresTime time.Time
 }
 
-func (c *ClientCreds) setExpiresTime() {
+func (c *ClientCreds) setExpiresTime(now time.Time) {
 	if c.expiresTime.IsZero() {
-		c.expiresTime = time.Now().Add(time.Second * time.Duration(c.ExpiresIn))
+		c.expiresTime = now.Add(time.Second * time.Duration(c.ExpiresIn))
 	}
 }
 
-func (c *ClientCreds) expired() bool {
-	return c.expiresTime.Before(time.Now())
+func (c *ClientCreds) expired(now time.Time) bool {
+	return c.expiresTime.Before(now)
 }
 
 type Authenticator interface {
 	Authenticate(client *http.Client) (*ClientCreds, error)
 }
 
+// RequestEditor modifies a request before it is sent e.g. to add custom headers
+type RequestEditor func(req *http.Request)
+
+// Client sends requests authenticated with credentials obtained from its Authenticator. It is safe for
+// concurrent use once its fields are set. Credentials are shared by all requests, and are renewed by one
+// goroutine at a time.
 type Client struct {
 	Client        *http.Client
-	creds         *ClientCreds
 	Authenticator Authenticator
 	Logger        logr.Logger
+
+	// UserAgent if not empty, is sent in the User-Agent header of every request. See UserAgent.
+	UserAgent string
+
+	// RequestEditors are applied to every request in the order they are given, after UserAgent is set
+	RequestEditors []RequestEditor
+
+	// DecodeOptions controls how response bodies are decoded
+	DecodeOptions DecodeOptions
+
+	// Clock tells when credentials expire. Defaults to the system clock.
+	Clock clock.Clock
+
+	// Retry controls how requests are retried. Requests are not retried by default.
+	Retry RetryOptions
+
+	// Codec encodes payloads and decodes responses of the object methods e.g. GetObject and CreateObject.
+	// Defaults to encoding/json.
+	Codec Codec
+
+	credsMu sync.Mutex
+	creds   *ClientCreds
+}
+
+// DecodeJSONResponse decodes response body into obj according to c.DecodeOptions
+func (c *Client) DecodeJSONResponse(resp *http.Response, obj interface{}) error {
+	return c.DecodeOptions.DecodeJSONResponse(resp, obj)
+}
+
+func (c *Client) editRequest(req *http.Request) {
+	if c.UserAgent != "" {
+		req.Header.Set("User-Agent", c.UserAgent)
+	}
+	for _, edit := range c.RequestEditors {
+		edit(req)
+	}
+}
+
+func (c *Client) doRequest(req *http.Request, creds *ClientCreds) (resp *http.Response, err error) {
+	if creds != nil {
+		req.Header.Set("Authorization", "Bearer "+creds.AccessToken)
+	}
+	c.editRequest(req)
+	return Do(req.Context(), c.Client, req, c.Retry)
+}
+
+// currentCreds returns the credentials sent with requests, or nil if there are none yet
+func (c *Client) currentCreds() *ClientCreds {
+	c.credsMu.Lock()
+	defer c.credsMu.Unlock()
+	return c.creds
 }
 
-func (c *Client) doRequest(req *http.Request) (resp *http.Response, err error) {
-	if c.creds != nil {
-		req.Header.Set("Authorization", "Bearer "+c.creds.AccessToken)
+// renewCreds replaces stale, the credentials that the caller found missing or expired, with new ones from
+// the Authenticator. If another goroutine replaced them in the meantime, its credentials are returned
+// instead, so that concurrent callers authenticate only once.
+func (c *Client) renewCreds(stale *ClientCreds) (*ClientCreds, error) {
+	c.credsMu.Lock()
+	defer c.credsMu.Unlock()
+	if c.creds != stale {
+		return c.creds, nil
 	}
-	return c.Client.Do(req)
+	creds, err := c.Authenticator.Authenticate(c.Client)
+	if err != nil {
+		return nil, err
+	}
+	creds.setExpiresTime(clock.OrReal(c.Clock).Now())
+	c.creds = creds
+	return creds, nil
+}
+
+// AccessToken returns the access token sent with requests, obtaining a new one if there is none yet or
+// if it has expired
+func (c *Client) AccessToken() (string, error) {
+	creds := c.currentCreds()
+	if creds == nil || creds.expired(clock.OrReal(c.Clock).Now()) {
+		c.Logger.Info("renewing credentials")
+		var err error
+		if creds, err = c.renewCreds(creds); err != nil {
+			return "", err
+		}
+	}
+	return creds.AccessToken, nil
 }
 
 func (c *Client) DoRequest(req *http.Request) (resp *http.Response, err error) {
-	if c.creds == nil {
+	creds := c.currentCreds()
+	if creds == nil {
 		c.Logger.Info("credentials not found")
-		c.creds, err = c.Authenticator.Authenticate(c.Client)
-		if err != nil {
+		if creds, err = c.renewCreds(nil); err != nil {
 			return nil, err
 		}
-		c.creds.setExpiresTime()
-		return c.doRequest(req)
+		return c.doRequest(req, creds)
 	}
-	resp, err = c.doRequest(req)
+	resp, err = c.doRequest(req, creds)
 	if err != nil {
 		return nil, err
 	}
 	if resp.StatusCode == 401 || resp.StatusCode == 403 {
-		if c.creds.expired() {
+		if creds.expired(clock.OrReal(c.Clock).Now()) {
 			c.Logger.Info("credentials expired")
-			c.creds, err = c.Authenticator.Authenticate(c.Client)
-			if err != nil {
+			resp.Body.Close()
+			if creds, err = c.renewCreds(creds); err != nil {
 				return nil, err
 			}
-			c.creds.setExpiresTime()
-			return c.doRequest(req)
+			if req.GetBody != nil {
+				if req.Body, err = req.GetBody(); err != nil {
+					return nil, err
+				}
+			}
+			return c.doRequest(req, creds)
 		} else {
 			return nil, NewErrUnanticipatedResponse(resp)
 		}
@@ -79,6 +166,12 @@ func (c *Client) DoRequest(req *http.Request) (resp *http.Response, err error) {
 }
 
 func PostFormUrlencoded(client *http.Client, url string, modifyRequest func(r *http.Request), values url.Values) (*http.Response, error) {
+	return PostFormUrlencodedContext(context.Background(), client, RetryOptions{}, url, modifyRequest, values)
+}
+
+// PostFormUrlencodedContext posts values to url with Do. Responses with a status of 300 or more are
+// returned as ErrUnanticipatedResponse.
+func PostFormUrlencodedContext(ctx context.Context, client *http.Client, retry RetryOptions, url string, modifyRequest func(r *http.Request), values url.Values) (*http.Response, error) {
 	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader([]byte(values.Encode())))
 	if err != nil {
 		return nil, err
@@ -87,7 +180,7 @@ func PostFormUrlencoded(client *http.Client, url string, modifyRequest func(r *h
 	if modifyRequest != nil {
 		modifyRequest(req)
 	}
-	resp, err := client.Do(req)
+	resp, err := Do(ctx, client, req, retry)
 	if err != nil {
 		return nil, err
 	}
@@ -98,7 +191,12 @@ func PostFormUrlencoded(client *http.Client, url string, modifyRequest func(r *h
 }
 
 func (c *Client) PostFormUrlencoded(url string, modifyRequest func(r *http.Request), values url.Values) (*http.Response, error) {
-	return PostFormUrlencoded(c.Client, url, modifyRequest, values)
+	return PostFormUrlencodedContext(context.Background(), c.Client, c.Retry, url, func(r *http.Request) {
+		if modifyRequest != nil {
+			modifyRequest(r)
+		}
+		c.editRequest(r)
+	}, values)
 }
 
 func (c *Client) Get(url string) (resp *http.Response, err error) {
@@ -106,7 +204,8 @@ func (c *Client) Get(url string) (resp *http.Response, err error) {
 	if err != nil {
 		return nil, err
 	}
-	return c.Client.Do(req)
+	c.editRequest(req)
+	return Do(req.Context(), c.Client, req, c.Retry)
 }
 
 func (c *Client) GetObject(endpoint string, response interface{}) (err error) {
@@ -121,11 +220,11 @@ func (c *Client) GetObject(endpoint string, response interface{}) (err error) {
 	if err = Ensure2XX(resp); err != nil {
 		return err
 	}
-	return DecodeJSONResponse(resp, response)
+	return c.decodeObject(resp, response)
 }
 
 func (c *Client) CreateObject(endpoint string, payload, response interface{}) (err error) {
-	req, err := JSONRequest(http.MethodPost, endpoint, payload)
+	req, err := c.jsonRequest(http.MethodPost, endpoint, payload)
 	if err != nil {
 		return err
 	}
@@ -136,11 +235,11 @@ func (c *Client) CreateObject(endpoint string, payload, response interface{}) (e
 	if err = Ensure2XX(resp); err != nil {
 		return err
 	}
-	return DecodeJSONResponse(resp, response)
+	return c.decodeObject(resp, response)
 }
 
 func (c *Client) UpdateObject(endpoint string, payload interface{}) (err error) {
-	req, err := JSONRequest(http.MethodPut, endpoint, payload)
+	req, err := c.jsonRequest(http.MethodPut, endpoint, payload)
 	if err != nil {
 		return err
 	}
@@ -178,5 +277,5 @@ func (c *Client) ListObjects(endpoint string, urlQuery url.Values, response inte
 	if err = Ensure2XX(resp); err != nil {
 		return err
 	}
-	return DecodeJSONResponse(resp, response)
+	return c.decodeObject(resp, response)
 }
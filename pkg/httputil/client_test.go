@@ -0,0 +1,171 @@
+package httputil
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/pckhoi/uma/pkg/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type countingAuthenticator struct {
+	n int
+}
+
+func (a *countingAuthenticator) Authenticate(client *http.Client) (*ClientCreds, error) {
+	a.n++
+	return &ClientCreds{AccessToken: fmt.Sprintf("pat-%d", a.n), ExpiresIn: 60}, nil
+}
+
+func TestClientCredentialsExpiry(t *testing.T) {
+	valid := "pat-1"
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+valid {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer s.Close()
+
+	c := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	auth := &countingAuthenticator{}
+	client := &Client{Client: s.Client(), Authenticator: auth, Logger: logr.Discard(), Clock: c}
+	get := func() (*http.Response, error) {
+		req, err := http.NewRequest(http.MethodGet, s.URL, nil)
+		require.NoError(t, err)
+		return client.DoRequest(req)
+	}
+
+	resp, err := get()
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, 1, auth.n)
+
+	// rejected credentials are only renewed once they expire
+	valid = "pat-2"
+	_, err = get()
+	var respErr *ErrUnanticipatedResponse
+	require.ErrorAs(t, err, &respErr)
+	assert.Equal(t, http.StatusUnauthorized, respErr.Status)
+	assert.Equal(t, 1, auth.n)
+
+	c.Advance(61 * time.Second)
+	resp, err = get()
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, 2, auth.n)
+}
+
+func TestClientConcurrentRenewal(t *testing.T) {
+	var mu sync.Mutex
+	valid := "pat-1"
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		ok := r.Header.Get("Authorization") == "Bearer "+valid
+		mu.Unlock()
+		b, _ := io.ReadAll(r.Body)
+		if !ok || string(b) != "payload" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer s.Close()
+
+	c := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	auth := &countingAuthenticator{}
+	client := &Client{Client: s.Client(), Authenticator: auth, Logger: logr.Discard(), Clock: c}
+	post := func() {
+		req, err := http.NewRequest(http.MethodPost, s.URL, strings.NewReader("payload"))
+		require.NoError(t, err)
+		resp, err := client.DoRequest(req)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		resp.Body.Close()
+	}
+	run := func(f func()) {
+		wg := sync.WaitGroup{}
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				f()
+			}()
+		}
+		wg.Wait()
+	}
+
+	run(post)
+	assert.Equal(t, 1, auth.n)
+
+	// expired credentials are renewed once, and the body is sent again with the new credentials
+	mu.Lock()
+	valid = "pat-2"
+	mu.Unlock()
+	c.Advance(61 * time.Second)
+	run(post)
+	assert.Equal(t, 2, auth.n)
+	run(func() {
+		_, err := client.AccessToken()
+		assert.NoError(t, err)
+	})
+	assert.Equal(t, 2, auth.n)
+}
+
+func TestClientAccessToken(t *testing.T) {
+	c := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	auth := &countingAuthenticator{}
+	client := &Client{Authenticator: auth, Logger: logr.Discard(), Clock: c}
+
+	tok, err := client.AccessToken()
+	require.NoError(t, err)
+	assert.Equal(t, "pat-1", tok)
+	tok, err = client.AccessToken()
+	require.NoError(t, err)
+	assert.Equal(t, "pat-1", tok)
+	assert.Equal(t, 1, auth.n)
+
+	c.Advance(61 * time.Second)
+	tok, err = client.AccessToken()
+	require.NoError(t, err)
+	assert.Equal(t, "pat-2", tok)
+}
+
+func TestClientUserAgent(t *testing.T) {
+	var agents []string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		agents = append(agents, r.Header.Get("User-Agent"))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("{}"))
+	}))
+	defer s.Close()
+	c := &Client{
+		Client:        s.Client(),
+		Authenticator: &countingAuthenticator{},
+		Logger:        logr.Discard(),
+		UserAgent:     UserAgent("billing-api/1.4.2", "commit=abc123"),
+	}
+	_, err := c.Get(s.URL)
+	require.NoError(t, err)
+	require.NoError(t, c.GetObject(s.URL, &map[string]any{}))
+	c.RequestEditors = []RequestEditor{func(req *http.Request) {
+		req.Header.Set("User-Agent", "custom")
+	}}
+	_, err = c.PostFormUrlencoded(s.URL, nil, nil)
+	require.NoError(t, err)
+
+	require.Len(t, agents, 3)
+	assert.Regexp(t, `^billing-api/1\.4\.2 pckhoi-uma/\S+ \(go[^;]+; commit=abc123\)$`, agents[0])
+	assert.Equal(t, agents[0], agents[1])
+	assert.Equal(t, "custom", agents[2])
+	assert.Regexp(t, `^pckhoi-uma/\S+ \(go[^;]+\)$`, UserAgent(""))
+}
@@ -0,0 +1,131 @@
+package httputil
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Codec converts the payloads of Client's object methods to and from the JSON of the server. It lets
+// clients talk to servers whose payloads differ from what this package expects.
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// RenameFields is a Codec for servers that name fields differently. Keys are the names used by this
+// package, values are the names used by the server, e.g.
+//
+//	httputil.RenameFields{"_id": "id", "resource_scopes": "scopes"}
+//
+// Only fields of the payload object, or of the objects in the payload array, are renamed. A renamed field
+// replaces any field that already has the new name.
+type RenameFields map[string]string
+
+func (m RenameFields) Marshal(v interface{}) ([]byte, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return renameFields(b, m)
+}
+
+func (m RenameFields) Unmarshal(data []byte, v interface{}) error {
+	reverse := make(map[string]string, len(m))
+	for k, v := range m {
+		reverse[v] = k
+	}
+	b, err := renameFields(data, reverse)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// renameFields renames the fields of the object, or of the objects in the array, in data
+func renameFields(data []byte, names map[string]string) ([]byte, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return data, nil
+	}
+	switch data[0] {
+	case '{':
+		obj := map[string]json.RawMessage{}
+		if err := json.Unmarshal(data, &obj); err != nil {
+			return nil, err
+		}
+		renamed := make(map[string]json.RawMessage, len(obj))
+		for k, v := range obj {
+			if _, ok := names[k]; !ok {
+				renamed[k] = v
+			}
+		}
+		// renamed fields replace fields that already have the new name
+		for k, v := range obj {
+			if name, ok := names[k]; ok {
+				renamed[name] = v
+			}
+		}
+		return json.Marshal(renamed)
+	case '[':
+		items := []json.RawMessage{}
+		if err := json.Unmarshal(data, &items); err != nil {
+			return nil, err
+		}
+		for i, item := range items {
+			if len(item) > 0 && item[0] == '{' {
+				b, err := renameFields(item, names)
+				if err != nil {
+					return nil, err
+				}
+				items[i] = b
+			}
+		}
+		return json.Marshal(items)
+	}
+	return data, nil
+}
+
+// jsonRequest is JSONRequest with the payload encoded by c.Codec, if any
+func (c *Client) jsonRequest(method string, uri string, payload interface{}) (*http.Request, error) {
+	if c.Codec == nil {
+		return JSONRequest(method, uri, payload)
+	}
+	b, err := c.Codec.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(method, uri, bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return req, nil
+}
+
+// decodeObject is DecodeJSONResponse with the body decoded by c.Codec, if any. DisallowUnknownFields
+// is left to the codec.
+func (c *Client) decodeObject(resp *http.Response, obj interface{}) error {
+	if c.Codec == nil {
+		return c.DecodeJSONResponse(resp, obj)
+	}
+	if !strings.Contains(resp.Header.Get("Content-Type"), "application/json") || resp.StatusCode >= 300 {
+		return NewErrUnanticipatedResponse(resp)
+	}
+	defer resp.Body.Close()
+	var r io.Reader = resp.Body
+	limit := c.DecodeOptions.MaxBodySize
+	if limit == 0 {
+		limit = DefaultMaxBodySize
+	}
+	if limit > 0 {
+		r = &limitedReader{r: r, n: limit, limit: limit}
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return c.Codec.Unmarshal(b, obj)
+}
@@ -0,0 +1,58 @@
+package httputil
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenameFields(t *testing.T) {
+	type resource struct {
+		ID     string            `json:"_id,omitempty"`
+		Scopes []string          `json:"resource_scopes,omitempty"`
+		Attrs  map[string]string `json:"attributes,omitempty"`
+	}
+	codec := RenameFields{"_id": "id", "resource_scopes": "scopes"}
+
+	b, err := codec.Marshal(resource{ID: "r1", Scopes: []string{"read"}, Attrs: map[string]string{"_id": "x"}})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"id":"r1","scopes":["read"],"attributes":{"_id":"x"}}`, string(b))
+
+	b, err = codec.Marshal([]resource{{ID: "r1"}, {ID: "r2"}})
+	require.NoError(t, err)
+	assert.JSONEq(t, `[{"id":"r1"},{"id":"r2"}]`, string(b))
+
+	obj := &resource{}
+	require.NoError(t, codec.Unmarshal([]byte(`{"id":"r1","_id":"ignored","scopes":["read"]}`), obj))
+	assert.Equal(t, &resource{ID: "r1", Scopes: []string{"read"}}, obj)
+
+	ids := []string{}
+	require.NoError(t, codec.Unmarshal([]byte(`["r1","r2"]`), &ids))
+	assert.Equal(t, []string{"r1", "r2"}, ids)
+
+	assert.Error(t, codec.Unmarshal([]byte(`{"id":`), obj))
+}
+
+func TestClientCodec(t *testing.T) {
+	var got string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		got = string(b)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"r1"}`))
+	}))
+	defer s.Close()
+	c := &Client{Client: s.Client(), Authenticator: &countingAuthenticator{}, Logger: logr.Discard(), Codec: RenameFields{"_id": "id"}}
+	obj := &struct {
+		ID string `json:"_id"`
+	}{}
+	require.NoError(t, c.CreateObject(s.URL, map[string]string{"_id": "new"}, obj))
+	assert.JSONEq(t, `{"id":"new"}`, got)
+	assert.Equal(t, "r1", obj.ID)
+}
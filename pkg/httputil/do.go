@@ -0,0 +1,134 @@
+package httputil
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// RetryOptions controls how Do retries requests
+type RetryOptions struct {
+	// MaxAttempts is how many times a request is sent. Defaults to 1, which disables retries.
+	MaxAttempts int
+
+	// Backoff is the delay before the second attempt, doubled for every further attempt up to
+	// MaxBackoff. Defaults to 100 milliseconds.
+	Backoff time.Duration
+
+	// MaxBackoff defaults to 5 seconds. It also caps the delay asked by Retry-After.
+	MaxBackoff time.Duration
+}
+
+// RetryableStatus reports whether a response with status may succeed if the request is sent again
+func RetryableStatus(status int) bool {
+	switch status {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return true
+	case http.StatusNotImplemented, http.StatusHTTPVersionNotSupported:
+		return false
+	}
+	return status >= 500
+}
+
+// IsRetryable reports whether the request that failed with err may succeed if it is sent again, which is
+// the case for network errors, including timeouts, and ErrUnanticipatedResponse with a RetryableStatus.
+// Canceled requests are not retryable.
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var respErr *ErrUnanticipatedResponse
+	if errors.As(err, &respErr) {
+		return respErr.Retryable()
+	}
+	// url.Error is itself a net.Error, look at the error it wraps instead
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		err = urlErr.Err
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// parseRetryAfter returns the delay asked by the Retry-After header of resp, or zero
+func parseRetryAfter(resp *http.Response) time.Duration {
+	v := resp.Header.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// Do sends req with client, or http.DefaultClient if it is nil. Network errors and responses with a
+// RetryableStatus are retried with exponential backoff according to opts, as long as the body of req can
+// be rewound with GetBody, which http.NewRequest sets for in-memory bodies. The last response is
+// returned whatever its status, so callers still check it with e.g. Ensure2XX. ctx cancels the request
+// and the wait between attempts.
+func Do(ctx context.Context, client *http.Client, req *http.Request, opts RetryOptions) (*http.Response, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 1
+	}
+	if opts.Backoff <= 0 {
+		opts.Backoff = 100 * time.Millisecond
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = 5 * time.Second
+	}
+	req = req.WithContext(ctx)
+	backoff := opts.Backoff
+	for attempt := 1; ; attempt++ {
+		resp, err := client.Do(req)
+		canRetry := attempt < opts.MaxAttempts && (req.Body == nil || req.GetBody != nil)
+		if err != nil {
+			if !canRetry || ctx.Err() != nil || !IsRetryable(err) {
+				return nil, err
+			}
+		} else if !canRetry || !RetryableStatus(resp.StatusCode) {
+			return resp, nil
+		}
+		wait := backoff
+		if resp != nil {
+			if d := parseRetryAfter(resp); d > wait {
+				wait = d
+			}
+			resp.Body.Close()
+		}
+		if wait > opts.MaxBackoff {
+			wait = opts.MaxBackoff
+		}
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return nil, ctx.Err()
+		case <-t.C:
+		}
+		backoff *= 2
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package httputil
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDo(t *testing.T) {
+	var bodies []string
+	statuses := []int{}
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		bodies = append(bodies, string(b))
+		status := statuses[0]
+		statuses = statuses[1:]
+		if status == http.StatusTooManyRequests {
+			w.Header().Set("Retry-After", "1")
+		}
+		w.WriteHeader(status)
+	}))
+	defer s.Close()
+	opts := RetryOptions{MaxAttempts: 3, Backoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond}
+	newReq := func() *http.Request {
+		req, err := http.NewRequest(http.MethodPost, s.URL, strings.NewReader("a=b"))
+		require.NoError(t, err)
+		return req
+	}
+
+	// retryable statuses are retried with the same body, Retry-After is capped by MaxBackoff
+	statuses = []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK}
+	start := time.Now()
+	resp, err := Do(context.Background(), s.Client(), newReq(), opts)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []string{"a=b", "a=b", "a=b"}, bodies)
+	assert.Less(t, time.Since(start), time.Second)
+
+	// the last response is returned once attempts run out
+	bodies = nil
+	statuses = []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway}
+	resp, err = Do(context.Background(), s.Client(), newReq(), opts)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+	assert.Len(t, bodies, 3)
+
+	// other statuses are not retried
+	bodies = nil
+	statuses = []int{http.StatusBadRequest}
+	resp, err = Do(context.Background(), s.Client(), newReq(), opts)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Len(t, bodies, 1)
+
+	// bodies that can't be rewound are sent once
+	bodies = nil
+	statuses = []int{http.StatusServiceUnavailable}
+	req, err := http.NewRequest(http.MethodPost, s.URL, io.NopCloser(bytes.NewBufferString("a=b")))
+	require.NoError(t, err)
+	resp, err = Do(context.Background(), s.Client(), req, opts)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Len(t, bodies, 1)
+
+	// canceling stops the wait between attempts
+	statuses = []int{http.StatusServiceUnavailable}
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	_, err = Do(ctx, s.Client(), newReq(), RetryOptions{MaxAttempts: 2, Backoff: time.Minute, MaxBackoff: time.Minute})
+	assert.ErrorIs(t, err, context.Canceled)
+
+	// network errors are retried
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	require.NoError(t, l.Close())
+	req, err = http.NewRequest(http.MethodGet, "http://"+addr, nil)
+	require.NoError(t, err)
+	attempts := 0
+	client := &http.Client{Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		attempts++
+		return http.DefaultTransport.RoundTrip(r)
+	})}
+	_, err = Do(context.Background(), client, req, opts)
+	assert.Error(t, err)
+	assert.True(t, IsRetryable(err))
+	assert.Equal(t, 3, attempts)
+}
+
+type roundTripperFunc func(r *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestIsRetryable(t *testing.T) {
+	for status, retryable := range map[int]bool{
+		http.StatusBadRequest:              false,
+		http.StatusUnauthorized:            false,
+		http.StatusRequestTimeout:          true,
+		http.StatusTooManyRequests:         true,
+		http.StatusInternalServerError:     true,
+		http.StatusNotImplemented:          false,
+		http.StatusServiceUnavailable:      true,
+		http.StatusHTTPVersionNotSupported: false,
+	} {
+		err := fmt.Errorf("wrapped: %w", &ErrUnanticipatedResponse{Status: status})
+		assert.Equal(t, retryable, IsRetryable(err), status)
+	}
+	assert.False(t, IsRetryable(nil))
+	assert.False(t, IsRetryable(errors.New("boom")))
+	assert.False(t, IsRetryable(&url.Error{Op: "Get", URL: "http://a", Err: context.Canceled}))
+	assert.False(t, IsRetryable(&url.Error{Op: "Get", URL: "http://a", Err: errors.New("x509: certificate signed by unknown authority")}))
+	assert.True(t, IsRetryable(&url.Error{Op: "Get", URL: "http://a", Err: io.EOF}))
+	assert.True(t, IsRetryable(&url.Error{Op: "Get", URL: "http://a", Err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}}))
+}
+
+func TestErrUnanticipatedResponseRetryAfter(t *testing.T) {
+	resp := &http.Response{
+		StatusCode: http.StatusServiceUnavailable,
+		Header:     http.Header{"Retry-After": {"120"}},
+		Body:       io.NopCloser(strings.NewReader("down")),
+	}
+	err := NewErrUnanticipatedResponse(resp)
+	assert.Equal(t, 2*time.Minute, err.RetryAfter)
+	assert.True(t, err.Retryable())
+
+	resp = &http.Response{
+		StatusCode: http.StatusTooManyRequests,
+		Header:     http.Header{"Retry-After": {time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)}},
+		Body:       io.NopCloser(strings.NewReader("")),
+	}
+	err = NewErrUnanticipatedResponse(resp)
+	assert.InDelta(t, time.Hour.Seconds(), err.RetryAfter.Seconds(), 2)
+}
@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
 )
 
 func JSONRequest(method string, uri string, payload interface{}) (*http.Request, error) {
@@ -24,16 +25,81 @@ func JSONRequest(method string, uri string, payload interface{}) (*http.Request,
 	return req, nil
 }
 
+// DefaultMaxBodySize is the largest response body that is decoded when DecodeOptions.MaxBodySize is zero
+const DefaultMaxBodySize int64 = 10 << 20
+
+// maxErrorBodySize is the largest response body that is kept in ErrUnanticipatedResponse
+const maxErrorBodySize int64 = 64 << 10
+
+// DecodeOptions controls how JSON responses are decoded
+type DecodeOptions struct {
+	// MaxBodySize is the largest response body in bytes that will be decoded. Larger bodies cause
+	// ErrResponseTooLarge. Defaults to DefaultMaxBodySize, set to a negative value to disable the limit.
+	MaxBodySize int64
+
+	// DisallowUnknownFields causes an error when the response has fields that are not present in
+	// the destination object
+	DisallowUnknownFields bool
+}
+
+// ErrResponseTooLarge is returned when a response body exceeds DecodeOptions.MaxBodySize
+type ErrResponseTooLarge struct {
+	Limit int64
+}
+
+func (err ErrResponseTooLarge) Error() string {
+	return fmt.Sprintf("response body exceeds %d bytes", err.Limit)
+}
+
+// limitedReader reads at most n bytes from r, then returns ErrResponseTooLarge if r has more to give
+type limitedReader struct {
+	r     io.Reader
+	n     int64
+	limit int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.n <= 0 {
+		var b [1]byte
+		n, err := l.r.Read(b[:])
+		if n > 0 {
+			return 0, ErrResponseTooLarge{Limit: l.limit}
+		}
+		return 0, err
+	}
+	if int64(len(p)) > l.n {
+		p = p[:l.n]
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	return n, err
+}
+
+// DecodeJSONResponse decodes response body into obj using default DecodeOptions
 func DecodeJSONResponse(resp *http.Response, obj interface{}) error {
+	return DecodeOptions{}.DecodeJSONResponse(resp, obj)
+}
+
+// DecodeJSONResponse streams response body into obj. It returns ErrUnanticipatedResponse if the response
+// is not a successful JSON response.
+func (opts DecodeOptions) DecodeJSONResponse(resp *http.Response, obj interface{}) error {
 	if !strings.Contains(resp.Header.Get("Content-Type"), "application/json") || resp.StatusCode >= 300 {
 		return NewErrUnanticipatedResponse(resp)
 	}
 	defer resp.Body.Close()
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return err
+	var r io.Reader = resp.Body
+	limit := opts.MaxBodySize
+	if limit == 0 {
+		limit = DefaultMaxBodySize
+	}
+	if limit > 0 {
+		r = &limitedReader{r: r, n: limit, limit: limit}
 	}
-	return json.Unmarshal(body, obj)
+	dec := json.NewDecoder(r)
+	if opts.DisallowUnknownFields {
+		dec.DisallowUnknownFields()
+	}
+	return dec.Decode(obj)
 }
 
 func GetRedirectLocation(resp *http.Response) (loc *url.URL, err error) {
@@ -43,15 +109,76 @@ func GetRedirectLocation(resp *http.Response) (loc *url.URL, err error) {
 	return nil, NewErrUnanticipatedResponse(resp)
 }
 
+// CorrelationHeaders are response headers kept in ASError, which help finding the failed request in
+// logs of the authorization server or of proxies in front of it
+var CorrelationHeaders = []string{
+	"X-Request-Id",
+	"X-Correlation-Id",
+	"X-Amzn-Trace-Id",
+	"X-B3-Traceid",
+	"Traceparent",
+}
+
+// ASError is an OAuth 2.0 error response from the authorization server. Learn more at
+// https://www.rfc-editor.org/rfc/rfc6749#section-5.2
+type ASError struct {
+	Status      int    `json:"-"`
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+	URI         string `json:"error_uri,omitempty"`
+
+	// Headers holds the CorrelationHeaders found in the response
+	Headers http.Header `json:"-"`
+}
+
+func (err *ASError) Error() string {
+	sb := &strings.Builder{}
+	fmt.Fprintf(sb, "authorization server error %d: %s", err.Status, err.Code)
+	if err.Description != "" {
+		fmt.Fprintf(sb, " (%s)", err.Description)
+	}
+	for _, k := range CorrelationHeaders {
+		if v := err.Headers.Get(k); v != "" {
+			fmt.Fprintf(sb, " %s=%s", k, v)
+		}
+	}
+	return sb.String()
+}
+
+// parseASError returns ASError if body is an OAuth 2.0 error response, otherwise it returns nil
+func parseASError(resp *http.Response, body []byte) *ASError {
+	if !strings.Contains(resp.Header.Get("Content-Type"), "application/json") {
+		return nil
+	}
+	asErr := &ASError{}
+	if err := json.Unmarshal(body, asErr); err != nil || asErr.Code == "" {
+		return nil
+	}
+	asErr.Status = resp.StatusCode
+	asErr.Headers = http.Header{}
+	for _, k := range CorrelationHeaders {
+		if v := resp.Header.Values(k); len(v) > 0 {
+			asErr.Headers[http.CanonicalHeaderKey(k)] = v
+		}
+	}
+	return asErr
+}
+
 type ErrUnanticipatedResponse struct {
 	Status      int
 	ContentType string
 	Body        string
+
+	// AS is set if the body is an OAuth 2.0 error response. It can also be retrieved with errors.As.
+	AS *ASError
+
+	// RetryAfter is the delay asked by the Retry-After header, if any
+	RetryAfter time.Duration
 }
 
 func NewErrUnanticipatedResponse(resp *http.Response) *ErrUnanticipatedResponse {
 	defer resp.Body.Close()
-	body, err := io.ReadAll(resp.Body)
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
 	if err != nil {
 		panic(err)
 	}
@@ -59,16 +186,33 @@ func NewErrUnanticipatedResponse(resp *http.Response) *ErrUnanticipatedResponse
 		Status:      resp.StatusCode,
 		ContentType: resp.Header.Get("Content-Type"),
 		Body:        string(body),
+		AS:          parseASError(resp, body),
+		RetryAfter:  parseRetryAfter(resp),
 	}
 }
 
+// Retryable reports whether the request may succeed if it is sent again. See RetryableStatus.
+func (err ErrUnanticipatedResponse) Retryable() bool {
+	return RetryableStatus(err.Status)
+}
+
 func (err ErrUnanticipatedResponse) Error() string {
+	if err.AS != nil {
+		return fmt.Sprintf("unanticipated response: %v", err.AS)
+	}
 	return fmt.Sprintf(
 		"unanticipated response %d: (%s) %s",
 		err.Status, err.ContentType, err.Body,
 	)
 }
 
+func (err ErrUnanticipatedResponse) Unwrap() error {
+	if err.AS == nil {
+		return nil
+	}
+	return err.AS
+}
+
 func Ensure2XX(resp *http.Response) error {
 	if resp.StatusCode >= 300 {
 		return NewErrUnanticipatedResponse(resp)
@@ -111,5 +255,5 @@ func DoRequest(req *http.Request) (*http.Response, error) {
 	if token != "" {
 		req.Header.Set("Authorization", "Bearer "+token)
 	}
-	return client.Do(req)
+	return Do(req.Context(), client, req, RetryOptions{})
 }
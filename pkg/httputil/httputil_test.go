@@ -0,0 +1,83 @@
+package httputil
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func jsonResponse(body string) *http.Response {
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(body)),
+	}
+}
+
+func TestDecodeJSONResponse(t *testing.T) {
+	type object struct {
+		Name string `json:"name"`
+	}
+	body := `{"name":"abc","extra":1}`
+
+	obj := &object{}
+	require.NoError(t, DecodeJSONResponse(jsonResponse(body), obj))
+	assert.Equal(t, "abc", obj.Name)
+
+	obj = &object{}
+	require.NoError(t, DecodeOptions{MaxBodySize: int64(len(body))}.DecodeJSONResponse(jsonResponse(body), obj))
+	assert.Equal(t, "abc", obj.Name)
+
+	err := DecodeOptions{MaxBodySize: 10}.DecodeJSONResponse(jsonResponse(body), &object{})
+	assert.Equal(t, ErrResponseTooLarge{Limit: 10}, err)
+
+	err = DecodeOptions{MaxBodySize: 10}.DecodeJSONResponse(jsonResponse(`{"name":"`+strings.Repeat("a", 100)+`"}`), &object{})
+	assert.Equal(t, ErrResponseTooLarge{Limit: 10}, err)
+
+	require.NoError(t, DecodeOptions{MaxBodySize: -1}.DecodeJSONResponse(jsonResponse(body), &object{}))
+
+	err = DecodeOptions{DisallowUnknownFields: true}.DecodeJSONResponse(jsonResponse(body), &object{})
+	assert.ErrorContains(t, err, `unknown field "extra"`)
+
+	resp := jsonResponse(strings.Repeat("a", int(maxErrorBodySize)+10))
+	resp.StatusCode = http.StatusBadGateway
+	err = DecodeJSONResponse(resp, &object{})
+	var respErr *ErrUnanticipatedResponse
+	require.ErrorAs(t, err, &respErr)
+	assert.Equal(t, http.StatusBadGateway, respErr.Status)
+	assert.Len(t, respErr.Body, int(maxErrorBodySize))
+}
+
+func TestASError(t *testing.T) {
+	resp := jsonResponse(`{"error":"invalid_grant","error_description":"Invalid user credentials"}`)
+	resp.StatusCode = http.StatusUnauthorized
+	resp.Header.Set("X-Request-Id", "req-1")
+	err := Ensure2XX(resp)
+
+	var asErr *ASError
+	require.ErrorAs(t, err, &asErr)
+	assert.Equal(t, &ASError{
+		Status:      http.StatusUnauthorized,
+		Code:        "invalid_grant",
+		Description: "Invalid user credentials",
+		Headers:     http.Header{"X-Request-Id": {"req-1"}},
+	}, asErr)
+	assert.Equal(t,
+		"unanticipated response: authorization server error 401: invalid_grant (Invalid user credentials) X-Request-Id=req-1",
+		err.Error(),
+	)
+	var respErr *ErrUnanticipatedResponse
+	require.ErrorAs(t, err, &respErr)
+	assert.Equal(t, asErr, respErr.AS)
+
+	resp = jsonResponse(`{"message":"not found"}`)
+	resp.StatusCode = http.StatusNotFound
+	err = Ensure2XX(resp)
+	assert.False(t, errors.As(err, &asErr))
+	assert.Equal(t, `unanticipated response 404: (application/json) {"message":"not found"}`, err.Error())
+}
@@ -0,0 +1,42 @@
+package httputil
+
+import (
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+const modulePath = "github.com/pckhoi/uma"
+
+// LibraryVersion returns the version of this library recorded in the build info of the binary e.g.
+// "v0.5.0", or "devel" if it is unknown e.g. in tests and replaced modules
+func LibraryVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "devel"
+	}
+	mods := append([]*debug.Module{&info.Main}, info.Deps...)
+	for _, mod := range mods {
+		if mod.Path == modulePath && mod.Replace == nil && mod.Version != "" && mod.Version != "(devel)" {
+			return mod.Version
+		}
+	}
+	return "devel"
+}
+
+// UserAgent returns a User-Agent header value that identifies app and this library, so that operators
+// of authorization servers can attribute traffic, e.g. "billing-api/1.4.2 pckhoi-uma/v0.5.0 (go1.19;
+// commit=abc123)". app can be empty. comments, such as build metadata, are added in parentheses.
+func UserAgent(app string, comments ...string) string {
+	sb := &strings.Builder{}
+	if app != "" {
+		sb.WriteString(app)
+		sb.WriteByte(' ')
+	}
+	sb.WriteString("pckhoi-uma/")
+	sb.WriteString(LibraryVersion())
+	sb.WriteString(" (")
+	sb.WriteString(strings.Join(append([]string{runtime.Version()}, comments...), "; "))
+	sb.WriteByte(')')
+	return sb.String()
+}
@@ -0,0 +1,164 @@
+// Package keycloak talks to the Keycloak admin API, e.g. to bootstrap realms for integration environments.
+package keycloak
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"github.com/pckhoi/uma/pkg/httputil"
+)
+
+// AdminCredentials obtain admin API tokens. If Username is set, the password grant is used, which suits
+// the admin user of the master realm. Otherwise the client credentials grant is used, in which case the
+// service account of the client needs roles of the realm-management client.
+type AdminCredentials struct {
+	// ServerURL is the url of the Keycloak server without any realm path e.g. "https://kc.example.com"
+	ServerURL string
+
+	// ContextPath is the path that the server is served under, e.g. "/auth" for the WildFly distribution
+	// which is the only one before Keycloak 17. Leave it empty if it is already part of ServerURL.
+	ContextPath string
+
+	// Realm is the realm to authenticate against. Defaults to "master".
+	Realm string
+
+	// ClientID defaults to "admin-cli"
+	ClientID     string
+	ClientSecret string
+
+	Username string
+	Password string
+
+	// UserAgent is sent in the User-Agent header of admin API requests. Defaults to httputil.UserAgent("").
+	UserAgent string
+}
+
+func (c AdminCredentials) realm() string {
+	if c.Realm == "" {
+		return "master"
+	}
+	return c.Realm
+}
+
+func (c AdminCredentials) clientID() string {
+	if c.ClientID == "" {
+		return "admin-cli"
+	}
+	return c.ClientID
+}
+
+func (c AdminCredentials) userAgent() string {
+	if c.UserAgent == "" {
+		return httputil.UserAgent("")
+	}
+	return c.UserAgent
+}
+
+// baseURL returns ServerURL followed by ContextPath, without trailing slash
+func (c AdminCredentials) baseURL() string {
+	base := strings.TrimSuffix(c.ServerURL, "/")
+	if c.ContextPath != "" {
+		base += "/" + strings.Trim(c.ContextPath, "/")
+	}
+	return base
+}
+
+// TokenEndpoint returns the token endpoint of Realm
+func (c AdminCredentials) TokenEndpoint() string {
+	return fmt.Sprintf("%s/realms/%s/protocol/openid-connect/token", c.baseURL(), c.realm())
+}
+
+// AdminRoot returns the root of the admin API e.g. "https://kc.example.com/admin"
+func (c AdminCredentials) AdminRoot() string {
+	return c.baseURL() + "/admin"
+}
+
+// realmsEndpoint returns the admin API endpoint that lists and creates realms
+func (c AdminCredentials) realmsEndpoint() string {
+	return c.AdminRoot() + "/realms"
+}
+
+// AdminEndpoint returns the admin API endpoint of realm e.g. "https://kc.example.com/admin/realms/demo"
+func (c AdminCredentials) AdminEndpoint(realm string) string {
+	return c.realmsEndpoint() + "/" + url.PathEscape(realm)
+}
+
+// Authenticate obtains an admin token. It implements httputil.Authenticator.
+func (c AdminCredentials) Authenticate(client *http.Client) (*httputil.ClientCreds, error) {
+	values := map[string][]string{
+		"client_id": {c.clientID()},
+	}
+	if c.ClientSecret != "" {
+		values["client_secret"] = []string{c.ClientSecret}
+	}
+	if c.Username != "" {
+		values["grant_type"] = []string{"password"}
+		values["username"] = []string{c.Username}
+		values["password"] = []string{c.Password}
+	} else {
+		values["grant_type"] = []string{"client_credentials"}
+	}
+	resp, err := httputil.PostFormUrlencoded(client, c.TokenEndpoint(), func(r *http.Request) {
+		r.Header.Set("User-Agent", c.userAgent())
+	}, values)
+	if err != nil {
+		return nil, err
+	}
+	creds := &httputil.ClientCreds{}
+	if err = httputil.DecodeJSONResponse(resp, creds); err != nil {
+		return nil, err
+	}
+	return creds, nil
+}
+
+// Admin is a client of the admin API
+type Admin struct {
+	creds  AdminCredentials
+	client *httputil.Client
+}
+
+// NewAdmin returns an Admin that authenticates with creds. If client is nil, http.DefaultClient is used.
+func NewAdmin(creds AdminCredentials, client *http.Client, logger logr.Logger) *Admin {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Admin{
+		creds: creds,
+		client: &httputil.Client{
+			Client:        client,
+			Authenticator: creds,
+			Logger:        logger,
+			UserAgent:     creds.userAgent(),
+		},
+	}
+}
+
+// create posts payload to endpoint. An object that already exists is not an error.
+func (a *Admin) create(endpoint string, payload interface{}) error {
+	req, err := httputil.JSONRequest(http.MethodPost, endpoint, payload)
+	if err != nil {
+		return err
+	}
+	resp, err := a.client.DoRequest(req)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusConflict {
+		resp.Body.Close()
+		return nil
+	}
+	if err := httputil.Ensure2XX(resp); err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// isNotFound reports whether err is a 404 response
+func isNotFound(err error) bool {
+	var respErr *httputil.ErrUnanticipatedResponse
+	return errors.As(err, &respErr) && respErr.Status == http.StatusNotFound
+}
@@ -0,0 +1,175 @@
+package keycloak
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/go-logr/logr"
+)
+
+// RealmSpec declares a realm along with its roles, clients and users
+type RealmSpec struct {
+	Name    string
+	Roles   []string
+	Clients []ClientSpec
+	Users   []UserSpec
+}
+
+// ClientSpec declares a client of a realm
+type ClientSpec struct {
+	ClientID string
+
+	// Secret of a confidential client. Leave empty for public clients.
+	Secret string
+
+	PublicClient bool
+	RedirectURIs []string
+
+	// DirectAccessGrants enables the password grant, which is handy for test users
+	DirectAccessGrants bool
+
+	// Authorization enables authorization services, which makes the client an UMA resource server.
+	// It also enables the service account of the client.
+	Authorization bool
+}
+
+// UserSpec declares a user of a realm
+type UserSpec struct {
+	Username  string
+	Password  string
+	Email     string
+	FirstName string
+	LastName  string
+
+	// Roles are realm roles granted to the user
+	Roles []string
+}
+
+type realmRep struct {
+	Realm   string `json:"realm"`
+	Enabled bool   `json:"enabled"`
+}
+
+type roleRep struct {
+	ID   string `json:"id,omitempty"`
+	Name string `json:"name"`
+}
+
+type clientRep struct {
+	ClientID                     string   `json:"clientId"`
+	Secret                       string   `json:"secret,omitempty"`
+	Enabled                      bool     `json:"enabled"`
+	PublicClient                 bool     `json:"publicClient"`
+	RedirectURIs                 []string `json:"redirectUris,omitempty"`
+	DirectAccessGrantsEnabled    bool     `json:"directAccessGrantsEnabled"`
+	ServiceAccountsEnabled       bool     `json:"serviceAccountsEnabled"`
+	AuthorizationServicesEnabled bool     `json:"authorizationServicesEnabled"`
+}
+
+type credentialRep struct {
+	Type      string `json:"type"`
+	Value     string `json:"value"`
+	Temporary bool   `json:"temporary"`
+}
+
+type userRep struct {
+	ID            string          `json:"id,omitempty"`
+	Username      string          `json:"username"`
+	Enabled       bool            `json:"enabled"`
+	Email         string          `json:"email,omitempty"`
+	EmailVerified bool            `json:"emailVerified"`
+	FirstName     string          `json:"firstName,omitempty"`
+	LastName      string          `json:"lastName,omitempty"`
+	Credentials   []credentialRep `json:"credentials,omitempty"`
+}
+
+// Bootstrap creates the realm, roles, clients and users of spec with the default http client. See
+// Admin.Bootstrap.
+func Bootstrap(adminCreds AdminCredentials, spec RealmSpec) error {
+	return NewAdmin(adminCreds, nil, logr.Discard()).Bootstrap(spec)
+}
+
+// Bootstrap creates the realm, roles, clients and users of spec. Objects that already exist are left
+// as is, except that users are granted missing roles, so Bootstrap can run on every start of an
+// integration environment.
+func (a *Admin) Bootstrap(spec RealmSpec) error {
+	if err := a.create(a.creds.realmsEndpoint(), realmRep{
+		Realm:   spec.Name,
+		Enabled: true,
+	}); err != nil {
+		return fmt.Errorf("error creating realm %q: %w", spec.Name, err)
+	}
+	realm := a.creds.AdminEndpoint(spec.Name)
+	for _, role := range spec.Roles {
+		if err := a.create(realm+"/roles", roleRep{Name: role}); err != nil {
+			return fmt.Errorf("error creating role %q: %w", role, err)
+		}
+	}
+	for _, c := range spec.Clients {
+		if err := a.create(realm+"/clients", clientRep{
+			ClientID:                     c.ClientID,
+			Secret:                       c.Secret,
+			Enabled:                      true,
+			PublicClient:                 c.PublicClient,
+			RedirectURIs:                 c.RedirectURIs,
+			DirectAccessGrantsEnabled:    c.DirectAccessGrants,
+			ServiceAccountsEnabled:       c.Authorization,
+			AuthorizationServicesEnabled: c.Authorization,
+		}); err != nil {
+			return fmt.Errorf("error creating client %q: %w", c.ClientID, err)
+		}
+	}
+	for _, u := range spec.Users {
+		if err := a.bootstrapUser(realm, u); err != nil {
+			return fmt.Errorf("error creating user %q: %w", u.Username, err)
+		}
+	}
+	return nil
+}
+
+func (a *Admin) bootstrapUser(realm string, u UserSpec) error {
+	// roles are checked first so that a user is not left without roles
+	roles := make([]roleRep, len(u.Roles))
+	for i, name := range u.Roles {
+		if err := a.client.GetObject(realm+"/roles/"+url.PathEscape(name), &roles[i]); err != nil {
+			if isNotFound(err) {
+				return fmt.Errorf("role %q not found", name)
+			}
+			return err
+		}
+	}
+	rep := userRep{
+		Username:      u.Username,
+		Enabled:       true,
+		Email:         u.Email,
+		EmailVerified: u.Email != "",
+		FirstName:     u.FirstName,
+		LastName:      u.LastName,
+	}
+	if u.Password != "" {
+		rep.Credentials = []credentialRep{{Type: "password", Value: u.Password}}
+	}
+	if err := a.create(realm+"/users", rep); err != nil {
+		return err
+	}
+	if len(u.Roles) == 0 {
+		return nil
+	}
+	users := []userRep{}
+	if err := a.client.ListObjects(realm+"/users", url.Values{
+		"username": {u.Username},
+		"exact":    {"true"},
+	}, &users); err != nil {
+		return err
+	}
+	var id string
+	for _, user := range users {
+		if user.Username == u.Username {
+			id = user.ID
+		}
+	}
+	if id == "" {
+		return fmt.Errorf("user %q not found after creation", u.Username)
+	}
+	return a.create(fmt.Sprintf("%s/users/%s/role-mappings/realm", realm, id), roles)
+}
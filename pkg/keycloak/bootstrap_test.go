@@ -0,0 +1,145 @@
+package keycloak
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeAdminAPI keeps created objects by endpoint path
+type fakeAdminAPI struct {
+	mu       sync.Mutex
+	objects  map[string][]map[string]interface{}
+	mappings map[string][]string
+	tokens   int
+}
+
+func newFakeAdminAPI(t *testing.T) *httptest.Server {
+	api := &fakeAdminAPI{objects: map[string][]map[string]interface{}{}, mappings: map[string][]string{}}
+	writeJSON := func(w http.ResponseWriter, obj interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		require.NoError(t, json.NewEncoder(w).Encode(obj))
+	}
+	find := func(coll, key, value string) map[string]interface{} {
+		for _, obj := range api.objects[coll] {
+			if obj[key] == value {
+				return obj
+			}
+		}
+		return nil
+	}
+	keys := map[string]string{"realms": "realm", "roles": "name", "clients": "clientId", "users": "username"}
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		api.mu.Lock()
+		defer api.mu.Unlock()
+		if r.URL.Path == "/realms/master/protocol/openid-connect/token" {
+			require.NoError(t, r.ParseForm())
+			assert.Equal(t, "password", r.PostForm.Get("grant_type"))
+			assert.Equal(t, "admin-cli", r.PostForm.Get("client_id"))
+			api.tokens++
+			writeJSON(w, map[string]interface{}{"access_token": "admin-token", "expires_in": 60})
+			return
+		}
+		assert.Equal(t, "Bearer admin-token", r.Header.Get("Authorization"))
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/admin/"), "/")
+		switch {
+		case len(parts) == 6 && parts[4] == "role-mappings" && r.Method == http.MethodPost:
+			// realms/demo/users/{id}/role-mappings/realm
+			roles := []map[string]interface{}{}
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&roles))
+			for _, role := range roles {
+				api.mappings[parts[3]] = append(api.mappings[parts[3]], role["name"].(string))
+			}
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == http.MethodPost:
+			coll := parts[len(parts)-1]
+			obj := map[string]interface{}{}
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&obj))
+			if find(coll, keys[coll], obj[keys[coll]].(string)) != nil {
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+			obj["id"] = obj[keys[coll]].(string) + "-id"
+			api.objects[coll] = append(api.objects[coll], obj)
+			w.WriteHeader(http.StatusCreated)
+		case len(parts) == 4 && parts[2] == "roles":
+			role := find("roles", "name", parts[3])
+			if role == nil {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			writeJSON(w, role)
+		case len(parts) == 3 && parts[2] == "users":
+			assert.Equal(t, "true", r.URL.Query().Get("exact"))
+			res := []map[string]interface{}{}
+			if u := find("users", "username", r.URL.Query().Get("username")); u != nil {
+				res = append(res, u)
+			}
+			writeJSON(w, res)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(s.Close)
+	t.Cleanup(func() {
+		assert.Equal(t, 1, api.tokens)
+		assert.Len(t, api.objects["realms"], 1)
+		assert.Len(t, api.objects["roles"], 2)
+		assert.Len(t, api.objects["clients"], 2)
+		assert.Len(t, api.objects["users"], 2)
+		assert.Equal(t, "api", api.objects["clients"][0]["clientId"])
+		assert.Equal(t, true, api.objects["clients"][0]["authorizationServicesEnabled"])
+		assert.Equal(t, true, api.objects["clients"][0]["serviceAccountsEnabled"])
+		assert.Equal(t, []interface{}{
+			map[string]interface{}{"type": "password", "value": "johnd", "temporary": false},
+		}, api.objects["users"][0]["credentials"])
+		// role mappings are applied on every run, which Keycloak tolerates
+		assert.Equal(t, []string{"reader", "writer", "reader", "writer"}, api.mappings["johnd-id"])
+		assert.Empty(t, api.mappings["guest-id"])
+	})
+	return s
+}
+
+func TestBootstrap(t *testing.T) {
+	s := newFakeAdminAPI(t)
+	admin := NewAdmin(AdminCredentials{
+		ServerURL: s.URL + "/",
+		Username:  "admin",
+		Password:  "admin",
+	}, s.Client(), testr.New(t))
+	spec := RealmSpec{
+		Name:  "demo",
+		Roles: []string{"reader", "writer"},
+		Clients: []ClientSpec{
+			{ClientID: "api", Secret: "secret", Authorization: true},
+			{ClientID: "web", PublicClient: true, RedirectURIs: []string{"http://localhost:3000/*"}, DirectAccessGrants: true},
+		},
+		Users: []UserSpec{
+			{Username: "johnd", Password: "johnd", Email: "johnd@example.com", Roles: []string{"reader", "writer"}},
+			{Username: "guest"},
+		},
+	}
+	require.NoError(t, admin.Bootstrap(spec))
+	require.NoError(t, admin.Bootstrap(spec))
+
+	spec.Users = []UserSpec{{Username: "janed", Roles: []string{"admin"}}}
+	assert.EqualError(t, admin.Bootstrap(spec), `error creating user "janed": role "admin" not found`)
+}
+
+func TestAdminCredentialsContextPath(t *testing.T) {
+	c := AdminCredentials{ServerURL: "https://kc.example.com/"}
+	assert.Equal(t, "https://kc.example.com/realms/master/protocol/openid-connect/token", c.TokenEndpoint())
+	assert.Equal(t, "https://kc.example.com/admin/realms/demo", c.AdminEndpoint("demo"))
+
+	c.ContextPath = "/auth/"
+	assert.Equal(t, "https://kc.example.com/auth/realms/master/protocol/openid-connect/token", c.TokenEndpoint())
+	assert.Equal(t, "https://kc.example.com/auth/admin", c.AdminRoot())
+	assert.Equal(t, "https://kc.example.com/auth/admin/realms/demo", c.AdminEndpoint("demo"))
+}
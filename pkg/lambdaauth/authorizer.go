@@ -0,0 +1,196 @@
+package lambdaauth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pckhoi/uma"
+)
+
+const anonymousPrincipal = "anonymous"
+
+// Authorizer runs the checks of an uma.Manager against API Gateway authorizer events. Point the
+// manager's GetBaseURL to the public URL of the API so that resources are registered with the
+// same URIs as they would be behind a regular http server.
+type Authorizer struct {
+	manager *uma.Manager
+}
+
+func New(manager *uma.Manager) *Authorizer {
+	return &Authorizer{manager: manager}
+}
+
+type result struct {
+	allowed         bool
+	resource        *uma.Resource
+	scopes          []string
+	claims          *uma.Claims
+	wwwAuthenticate string
+}
+
+// recorder is a minimal http.ResponseWriter that keeps the challenge written by the manager
+type recorder struct {
+	header http.Header
+	status int
+}
+
+func (rec *recorder) Header() http.Header {
+	return rec.header
+}
+
+func (rec *recorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	return len(b), nil
+}
+
+func (rec *recorder) WriteHeader(statusCode int) {
+	if rec.status == 0 {
+		rec.status = statusCode
+	}
+}
+
+func (a *Authorizer) authorize(r *http.Request) *result {
+	res := &result{}
+	rec := &recorder{header: http.Header{}}
+	a.manager.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		res.allowed = true
+		res.resource = uma.GetResource(r)
+		res.scopes = uma.GetScopes(r)
+		res.claims = uma.GetClaims(r)
+	})).ServeHTTP(rec, r)
+	res.wwwAuthenticate = rec.header.Get("WWW-Authenticate")
+	return res
+}
+
+func (res *result) principalID() string {
+	if res.claims != nil && res.claims.Sub != "" {
+		return res.claims.Sub
+	}
+	return anonymousPrincipal
+}
+
+// context returns values that API Gateway passes on to the integration. Values can only be
+// strings, numbers or booleans.
+func (res *result) context() map[string]interface{} {
+	m := map[string]interface{}{}
+	if res.resource != nil {
+		m["resource_id"] = res.resource.ID
+		m["resource_name"] = res.resource.Name
+	}
+	if len(res.scopes) > 0 {
+		m["scopes"] = strings.Join(res.scopes, " ")
+	}
+	if res.claims != nil {
+		m["sub"] = res.claims.Sub
+	}
+	if res.wwwAuthenticate != "" {
+		m["www_authenticate"] = res.wwwAuthenticate
+	}
+	return m
+}
+
+func newRequest(ctx context.Context, method, host, path, rawQuery string, headers http.Header) (*http.Request, error) {
+	u := &url.URL{
+		Scheme:   "https",
+		Host:     host,
+		Path:     path,
+		RawQuery: rawQuery,
+	}
+	if proto := headers.Get("X-Forwarded-Proto"); proto != "" {
+		u.Scheme = proto
+	}
+	r, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	r.Header = headers
+	r.Host = host
+	return r, nil
+}
+
+func (req *Request) httpRequest(ctx context.Context) (*http.Request, error) {
+	headers := http.Header{}
+	for k, v := range req.Headers {
+		headers.Set(k, v)
+	}
+	for k, sl := range req.MultiValueHeaders {
+		headers.Del(k)
+		for _, v := range sl {
+			headers.Add(k, v)
+		}
+	}
+	query := url.Values{}
+	for k, v := range req.QueryStringParameters {
+		query.Set(k, v)
+	}
+	for k, sl := range req.MultiValueQueryStringParameters {
+		query[k] = sl
+	}
+	return newRequest(ctx, req.HTTPMethod, headers.Get("Host"), req.Path, query.Encode(), headers)
+}
+
+func (req *SimpleRequest) httpRequest(ctx context.Context) (*http.Request, error) {
+	headers := http.Header{}
+	for k, v := range req.Headers {
+		headers.Set(k, v)
+	}
+	if len(req.Cookies) > 0 {
+		headers.Set("Cookie", strings.Join(req.Cookies, "; "))
+	}
+	host := req.RequestContext.DomainName
+	if host == "" {
+		host = headers.Get("Host")
+	}
+	return newRequest(ctx, req.RequestContext.HTTP.Method, host, req.RawPath, req.RawQueryString, headers)
+}
+
+func policy(effect, methodArn string) PolicyDocument {
+	return PolicyDocument{
+		Version: "2012-10-17",
+		Statement: []Statement{
+			{
+				Action:   []string{"execute-api:Invoke"},
+				Effect:   effect,
+				Resource: []string{methodArn},
+			},
+		},
+	}
+}
+
+// HandleRequest handles events of REQUEST type authorizers and responds with an IAM policy that
+// allows or denies invoking the method. When access is denied, the UMA challenge is available to
+// gateway responses as $context.authorizer.www_authenticate.
+func (a *Authorizer) HandleRequest(ctx context.Context, req Request) (Response, error) {
+	r, err := req.httpRequest(ctx)
+	if err != nil {
+		return Response{}, fmt.Errorf("error creating request from event: %w", err)
+	}
+	res := a.authorize(r)
+	effect := "Deny"
+	if res.allowed {
+		effect = "Allow"
+	}
+	return Response{
+		PrincipalID:    res.principalID(),
+		PolicyDocument: policy(effect, req.MethodArn),
+		Context:        res.context(),
+	}, nil
+}
+
+// HandleSimpleRequest handles events sent by HTTP APIs with simple responses enabled.
+func (a *Authorizer) HandleSimpleRequest(ctx context.Context, req SimpleRequest) (SimpleResponse, error) {
+	r, err := req.httpRequest(ctx)
+	if err != nil {
+		return SimpleResponse{}, fmt.Errorf("error creating request from event: %w", err)
+	}
+	res := a.authorize(r)
+	return SimpleResponse{
+		IsAuthorized: res.allowed,
+		Context:      res.context(),
+	}, nil
+}
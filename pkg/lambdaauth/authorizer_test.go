@@ -0,0 +1,96 @@
+package lambdaauth
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/pckhoi/uma"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newManager(t *testing.T) *uma.Manager {
+	return uma.New(
+		uma.ManagerOptions{
+			GetBaseURL: func(r *http.Request) url.URL {
+				return url.URL{Scheme: "https", Host: "api.example.com", Path: "/users"}
+			},
+			CustomEnforce: func(r *http.Request, resource uma.Resource, scopes []string) bool {
+				return r.Header.Get("Authorization") == "Bearer good"
+			},
+		},
+		map[string]uma.ResourceType{
+			"user": {Type: "user", ResourceScopes: []string{"read"}},
+		},
+		[]string{"oidc"},
+		nil,
+		[]map[string][]string{{"oidc": {"read"}}},
+		[]uma.Path{
+			uma.NewPath("/{id}", uma.NewResourceTemplate("user", "User {id}"), map[string]uma.Operation{
+				http.MethodGet: {},
+			}),
+		},
+		testr.New(t),
+	)
+}
+
+func TestHandleRequest(t *testing.T) {
+	a := New(newManager(t))
+	arn := "arn:aws:execute-api:us-east-1:123456789012:abc/prod/GET/users/1"
+	resp, err := a.HandleRequest(context.Background(), Request{
+		Type:       "REQUEST",
+		MethodArn:  arn,
+		Path:       "/users/1",
+		HTTPMethod: http.MethodGet,
+		Headers: map[string]string{
+			"Host":          "api.example.com",
+			"Authorization": "Bearer good",
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "Allow", resp.PolicyDocument.Statement[0].Effect)
+	assert.Equal(t, []string{arn}, resp.PolicyDocument.Statement[0].Resource)
+	assert.Equal(t, anonymousPrincipal, resp.PrincipalID)
+	assert.Equal(t, "read", resp.Context["scopes"])
+
+	resp, err = a.HandleRequest(context.Background(), Request{
+		Type:       "REQUEST",
+		MethodArn:  arn,
+		Path:       "/users/1",
+		HTTPMethod: http.MethodGet,
+		Headers: map[string]string{
+			"Host": "api.example.com",
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "Deny", resp.PolicyDocument.Statement[0].Effect)
+}
+
+func TestHandleSimpleRequest(t *testing.T) {
+	a := New(newManager(t))
+	resp, err := a.HandleSimpleRequest(context.Background(), SimpleRequest{
+		Version: "2.0",
+		RawPath: "/users/1",
+		Headers: map[string]string{"authorization": "Bearer good"},
+		RequestContext: SimpleRequestContext{
+			DomainName: "api.example.com",
+			HTTP:       SimpleRequestContextHTTP{Method: http.MethodGet},
+		},
+	})
+	require.NoError(t, err)
+	assert.True(t, resp.IsAuthorized)
+
+	resp, err = a.HandleSimpleRequest(context.Background(), SimpleRequest{
+		Version: "2.0",
+		RawPath: "/users/1",
+		RequestContext: SimpleRequestContext{
+			DomainName: "api.example.com",
+			HTTP:       SimpleRequestContextHTTP{Method: http.MethodGet},
+		},
+	})
+	require.NoError(t, err)
+	assert.False(t, resp.IsAuthorized)
+}
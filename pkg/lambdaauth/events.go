@@ -0,0 +1,99 @@
+package lambdaauth
+
+// Request mirrors the payload API Gateway sends to a REQUEST type Lambda authorizer. It is
+// JSON compatible with events.APIGatewayCustomAuthorizerRequestTypeRequest from
+// github.com/aws/aws-lambda-go so either type can be used with lambda.Start.
+type Request struct {
+	Type                            string              `json:"type"`
+	MethodArn                       string              `json:"methodArn"`
+	Resource                        string              `json:"resource"`
+	Path                            string              `json:"path"`
+	HTTPMethod                      string              `json:"httpMethod"`
+	Headers                         map[string]string   `json:"headers"`
+	MultiValueHeaders               map[string][]string `json:"multiValueHeaders"`
+	QueryStringParameters           map[string]string   `json:"queryStringParameters"`
+	MultiValueQueryStringParameters map[string][]string `json:"multiValueQueryStringParameters"`
+	PathParameters                  map[string]string   `json:"pathParameters"`
+	StageVariables                  map[string]string   `json:"stageVariables"`
+	RequestContext                  RequestContext      `json:"requestContext"`
+}
+
+type RequestContext struct {
+	Path         string   `json:"path"`
+	AccountID    string   `json:"accountId"`
+	ResourceID   string   `json:"resourceId"`
+	Stage        string   `json:"stage"`
+	RequestID    string   `json:"requestId"`
+	Identity     Identity `json:"identity"`
+	ResourcePath string   `json:"resourcePath"`
+	HTTPMethod   string   `json:"httpMethod"`
+	APIID        string   `json:"apiId"`
+}
+
+type Identity struct {
+	SourceIP  string `json:"sourceIp"`
+	UserAgent string `json:"userAgent"`
+}
+
+// Response is the IAM policy response of a Lambda authorizer. It is JSON compatible with
+// events.APIGatewayCustomAuthorizerResponse.
+type Response struct {
+	PrincipalID    string                 `json:"principalId"`
+	PolicyDocument PolicyDocument         `json:"policyDocument"`
+	Context        map[string]interface{} `json:"context,omitempty"`
+}
+
+type PolicyDocument struct {
+	Version   string      `json:"Version"`
+	Statement []Statement `json:"Statement"`
+}
+
+type Statement struct {
+	Action   []string `json:"Action"`
+	Effect   string   `json:"Effect"`
+	Resource []string `json:"Resource"`
+}
+
+// SimpleRequest mirrors the version 2.0 payload sent by HTTP APIs to a Lambda authorizer. It is
+// JSON compatible with events.APIGatewayV2CustomAuthorizerV2Request.
+type SimpleRequest struct {
+	Version               string               `json:"version"`
+	Type                  string               `json:"type"`
+	RouteArn              string               `json:"routeArn"`
+	IdentitySource        []string             `json:"identitySource"`
+	RouteKey              string               `json:"routeKey"`
+	RawPath               string               `json:"rawPath"`
+	RawQueryString        string               `json:"rawQueryString"`
+	Cookies               []string             `json:"cookies"`
+	Headers               map[string]string    `json:"headers"`
+	QueryStringParameters map[string]string    `json:"queryStringParameters"`
+	RequestContext        SimpleRequestContext `json:"requestContext"`
+	PathParameters        map[string]string    `json:"pathParameters"`
+	StageVariables        map[string]string    `json:"stageVariables"`
+}
+
+type SimpleRequestContext struct {
+	AccountID    string                   `json:"accountId"`
+	APIID        string                   `json:"apiId"`
+	DomainName   string                   `json:"domainName"`
+	DomainPrefix string                   `json:"domainPrefix"`
+	HTTP         SimpleRequestContextHTTP `json:"http"`
+	RequestID    string                   `json:"requestId"`
+	RouteKey     string                   `json:"routeKey"`
+	Stage        string                   `json:"stage"`
+}
+
+type SimpleRequestContextHTTP struct {
+	Method    string `json:"method"`
+	Path      string `json:"path"`
+	Protocol  string `json:"protocol"`
+	SourceIP  string `json:"sourceIp"`
+	UserAgent string `json:"userAgent"`
+}
+
+// SimpleResponse is the simple response format of HTTP API Lambda authorizers. It is JSON
+// compatible with events.APIGatewayV2CustomAuthorizerSimpleResponse.
+type SimpleResponse struct {
+	IsAuthorized bool                   `json:"isAuthorized"`
+	Context      map[string]interface{} `json:"context,omitempty"`
+}
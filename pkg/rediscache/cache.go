@@ -0,0 +1,43 @@
+package rediscache
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Cache is an uma.ResourceCache backed by Redis
+type Cache struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+// New returns a Cache that stores entries under keys prefixed with prefix
+func New(client redis.UniversalClient, prefix string) *Cache {
+	return &Cache{
+		client: client,
+		prefix: prefix,
+	}
+}
+
+func (c *Cache) Get(key string) (id string, ok bool, err error) {
+	id, err = c.client.Get(context.Background(), c.prefix+key).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return id, true, nil
+}
+
+func (c *Cache) Set(key, id string, ttl time.Duration) error {
+	return c.client.Set(context.Background(), c.prefix+key, id, ttl).Err()
+}
+
+// Delete removes the entry of key, if any
+func (c *Cache) Delete(key string) error {
+	return c.client.Del(context.Background(), c.prefix+key).Err()
+}
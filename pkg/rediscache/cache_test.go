@@ -0,0 +1,53 @@
+package rediscache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCache(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+	c := New(client, "uma:")
+
+	_, ok, err := c.Get("https://as.example.com User 1")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	require.NoError(t, c.Set("https://as.example.com User 1", "id-1", time.Minute))
+	id, ok, err := c.Get("https://as.example.com User 1")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "id-1", id)
+	assert.True(t, mr.Exists("uma:https://as.example.com User 1"))
+
+	// entries expire
+	mr.FastForward(time.Minute)
+	_, ok, err = c.Get("https://as.example.com User 1")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	// entries without ttl don't
+	require.NoError(t, c.Set("https://as.example.com User 2", "id-2", 0))
+	mr.FastForward(time.Hour)
+	_, ok, err = c.Get("https://as.example.com User 2")
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	require.NoError(t, c.Delete("https://as.example.com User 2"))
+	_, ok, err = c.Get("https://as.example.com User 2")
+	require.NoError(t, err)
+	assert.False(t, ok)
+	require.NoError(t, c.Delete("https://as.example.com User 2"))
+
+	// errors of the server are returned
+	mr.Close()
+	_, _, err = c.Get("https://as.example.com User 1")
+	assert.Error(t, err)
+}
@@ -0,0 +1,77 @@
+package rp
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DefaultRPTConcurrency is how many token requests RequestRPTs sends at once by default
+const DefaultRPTConcurrency = 4
+
+// WithRPTConcurrency sets how many token requests RequestRPTs sends at once. Defaults to
+// DefaultRPTConcurrency.
+func WithRPTConcurrency(n int) KeycloakClientOption {
+	return func(kc *KeycloakClient) {
+		kc.rptConcurrency = n
+	}
+}
+
+// ErrRPTRequests is returned by RequestRPTs when some of the requests failed. Errors are keyed by the
+// index of the failed request.
+type ErrRPTRequests struct {
+	Requests []RPTRequest
+	Errors   map[int]error
+}
+
+func (err ErrRPTRequests) Error() string {
+	idx := make([]int, 0, len(err.Errors))
+	for i := range err.Errors {
+		idx = append(idx, i)
+	}
+	sort.Ints(idx)
+	msgs := make([]string, len(idx))
+	for j, i := range idx {
+		msgs[j] = fmt.Sprintf("ticket %q: %v", err.Requests[i].Ticket, err.Errors[i])
+	}
+	return fmt.Sprintf("%d of %d RPT requests failed: %s", len(idx), len(err.Requests), strings.Join(msgs, "; "))
+}
+
+// RequestRPTs sends requests concurrently, e.g. to exchange the permission tickets of a page of resources
+// at once. The RPT of requests[i] is rpts[i]. If some requests failed, their RPTs are empty and
+// ErrRPTRequests is returned along with the RPTs of the other requests.
+func (kc *KeycloakClient) RequestRPTs(accessToken string, requests []RPTRequest) (rpts []string, err error) {
+	n := kc.rptConcurrency
+	if n <= 0 {
+		n = DefaultRPTConcurrency
+	}
+	rpts = make([]string, len(requests))
+	errs := map[int]error{}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, n)
+	for i := range requests {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			rpt, err := kc.RequestRPT(accessToken, requests[i])
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			rpts[i] = rpt
+		}(i)
+	}
+	wg.Wait()
+	if len(errs) > 0 {
+		return rpts, ErrRPTRequests{Requests: requests, Errors: errs}
+	}
+	return rpts, nil
+}
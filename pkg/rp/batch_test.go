@@ -0,0 +1,66 @@
+package rp
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestRPTs(t *testing.T) {
+	var issuer string
+	var mu sync.Mutex
+	var inFlight, maxInFlight int
+	mux := http.NewServeMux()
+	writeJSON := func(w http.ResponseWriter, status int, obj any) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		require.NoError(t, json.NewEncoder(w).Encode(obj))
+	}
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"issuer": issuer, "token_endpoint": issuer + "/token"})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+		ticket := r.FormValue("ticket")
+		if ticket == "t3" {
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "access_denied"})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"access_token": "rpt-" + ticket})
+	})
+	s := httptest.NewServer(mux)
+	defer s.Close()
+	issuer = s.URL
+
+	kc, err := NewKeycloakClient(issuer, "client", "secret", s.Client(), WithRPTConcurrency(2))
+	require.NoError(t, err)
+	reqs := []RPTRequest{{Ticket: "t0"}, {Ticket: "t1"}, {Ticket: "t2"}, {Ticket: "t3"}, {Ticket: "t4"}}
+	rpts, err := kc.RequestRPTs("user-token", reqs)
+	assert.Equal(t, []string{"rpt-t0", "rpt-t1", "rpt-t2", "", "rpt-t4"}, rpts)
+	var batchErr ErrRPTRequests
+	require.ErrorAs(t, err, &batchErr)
+	assert.Len(t, batchErr.Errors, 1)
+	assert.True(t, isAccessDenied(batchErr.Errors[3]))
+	assert.Contains(t, err.Error(), `1 of 5 RPT requests failed: ticket "t3": `)
+	assert.LessOrEqual(t, maxInFlight, 2)
+	assert.Greater(t, maxInFlight, 1)
+
+	rpts, err = kc.RequestRPTs("user-token", reqs[:2])
+	require.NoError(t, err)
+	assert.Equal(t, []string{"rpt-t0", "rpt-t1"}, rpts)
+}
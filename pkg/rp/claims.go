@@ -0,0 +1,321 @@
+package rp
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pckhoi/uma/pkg/clock"
+	"github.com/pckhoi/uma/pkg/httputil"
+)
+
+// PendingClaims is the state of a claims gathering redirect, kept until the browser comes back
+type PendingClaims struct {
+	Ticket       string
+	CodeVerifier string
+	ReturnTo     string
+}
+
+// ClaimsStateStore keeps PendingClaims by the state parameter of the redirect
+type ClaimsStateStore interface {
+	Save(state string, pc PendingClaims) error
+
+	// Take returns and forgets the pending claims of state. ok is false if state is unknown or expired.
+	Take(state string) (pc PendingClaims, ok bool, err error)
+}
+
+// MemoryClaimsStateStore is an in-memory ClaimsStateStore. It only works if the callback reaches the
+// same replica as the redirect.
+type MemoryClaimsStateStore struct {
+	// Clock tells when states expire. Defaults to the system clock. Set it before the store is used.
+	Clock clock.Clock
+
+	mu      sync.Mutex
+	ttl     time.Duration
+	pending map[string]pendingClaimsEntry
+}
+
+type pendingClaimsEntry struct {
+	PendingClaims
+	expires time.Time
+}
+
+// NewMemoryClaimsStateStore creates a MemoryClaimsStateStore that forgets states after ttl
+func NewMemoryClaimsStateStore(ttl time.Duration) *MemoryClaimsStateStore {
+	return &MemoryClaimsStateStore{
+		ttl:     ttl,
+		pending: map[string]pendingClaimsEntry{},
+	}
+}
+
+func (s *MemoryClaimsStateStore) Save(state string, pc PendingClaims) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := clock.OrReal(s.Clock).Now()
+	for k, e := range s.pending {
+		if !now.Before(e.expires) {
+			delete(s.pending, k)
+		}
+	}
+	s.pending[state] = pendingClaimsEntry{PendingClaims: pc, expires: now.Add(s.ttl)}
+	return nil
+}
+
+func (s *MemoryClaimsStateStore) Take(state string) (PendingClaims, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.pending[state]
+	delete(s.pending, state)
+	if !ok || !clock.OrReal(s.Clock).Now().Before(e.expires) {
+		return PendingClaims{}, false, nil
+	}
+	return e.PendingClaims, true, nil
+}
+
+// ClaimsRedirect gathers claims of the requesting party in the browser when the authorization server
+// needs more information to grant a permission ticket, then resumes the RPT request. Users log in at the
+// authorization endpoint with the authorization code flow protected by PKCE and by a state that is bound
+// to the browser with a cookie, and their ID token is pushed as claim_token along with the ticket. Both handlers can be mounted by the backend-for-frontend
+// of a SPA:
+//
+//	cr := &rp.ClaimsRedirect{Client: kc, RedirectURI: "https://app.example.com/uma/callback"}
+//	mux.Handle("/uma/claims", cr.RedirectHandler())
+//	mux.Handle("/uma/callback", cr.CallbackHandler())
+//
+// The SPA then navigates to /uma/claims?ticket=TICKET&return_to=/users/1 after a request is denied.
+type ClaimsRedirect struct {
+	Client *KeycloakClient
+
+	// RedirectURI is the absolute url of CallbackHandler. It must be a valid redirect uri of the client.
+	RedirectURI string
+
+	// Scopes requested at the authorization endpoint. Defaults to "openid".
+	Scopes []string
+
+	// StateStore defaults to a MemoryClaimsStateStore that forgets states after 10 minutes
+	StateStore ClaimsStateStore
+
+	// StateCookieName is the cookie that binds the state to the browser. Defaults to "uma_claims_state".
+	StateCookieName string
+
+	// InsecureCookie leaves out the Secure attribute of the state cookie, for apps served over plain
+	// HTTP during development
+	InsecureCookie bool
+
+	// OnRPT delivers the RPT to the SPA, e.g. by storing it in the session of the BFF. By default, the
+	// browser is redirected to the return_to path, with the RPT in the "rpt" parameter of the fragment,
+	// which is never sent to servers.
+	OnRPT func(w http.ResponseWriter, r *http.Request, rpt, returnTo string)
+
+	once sync.Once
+}
+
+func (c *ClaimsRedirect) stateStore() ClaimsStateStore {
+	c.once.Do(func() {
+		if c.StateStore == nil {
+			c.StateStore = NewMemoryClaimsStateStore(10 * time.Minute)
+		}
+	})
+	return c.StateStore
+}
+
+func (c *ClaimsRedirect) stateCookieName() string {
+	if c.StateCookieName == "" {
+		return "uma_claims_state"
+	}
+	return c.StateCookieName
+}
+
+// stateCookieMaxAge is how long the browser keeps the state cookie
+const stateCookieMaxAge = 10 * time.Minute
+
+// stateHash returns the value of the state cookie of state
+func stateHash(state string) string {
+	sum := sha256.Sum256([]byte(state))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// setStateCookie binds state to the browser, so that the callback of the authorization code flow can't
+// be completed in another browser, e.g. to log a victim in as the attacker
+func setStateCookie(w http.ResponseWriter, name, state string, secure bool) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    stateHash(state),
+		Path:     "/",
+		MaxAge:   int(stateCookieMaxAge / time.Second),
+		HttpOnly: true,
+		Secure:   secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// checkStateCookie reports whether the state cookie of r was set for state, and clears the cookie
+func checkStateCookie(w http.ResponseWriter, r *http.Request, name, state string, secure bool) bool {
+	c, err := r.Cookie(name)
+	if err != nil || state == "" {
+		return false
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return subtle.ConstantTimeCompare([]byte(c.Value), []byte(stateHash(state))) == 1
+}
+
+// authCodeURL returns the url of the authorization endpoint that starts the authorization code flow,
+// with the code challenge of verifier
+func (kc *KeycloakClient) authCodeURL(redirectURI string, scopes []string, state, verifier string) string {
+	if len(scopes) == 0 {
+		scopes = []string{"openid"}
+	}
+	challenge := sha256.Sum256([]byte(verifier))
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {kc.clientID},
+		"redirect_uri":          {redirectURI},
+		"scope":                 {strings.Join(scopes, " ")},
+		"state":                 {state},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	authURL := kc.oidc.Endpoint().AuthURL
+	sep := "?"
+	if strings.Contains(authURL, "?") {
+		sep = "&"
+	}
+	return authURL + sep + q.Encode()
+}
+
+// exchangeCode exchanges an authorization code for the credentials of the user
+func (kc *KeycloakClient) exchangeCode(code, verifier, redirectURI string) (*Credentials, error) {
+	resp, err := kc.postToken(nil, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURI},
+		"client_id":     {kc.clientID},
+		"client_secret": {kc.clientSecret},
+		"code_verifier": {verifier},
+	})
+	if err != nil {
+		return nil, err
+	}
+	creds := &Credentials{}
+	if err := httputil.DecodeJSONResponse(resp, creds); err != nil {
+		return nil, err
+	}
+	if creds.AccessToken == "" || creds.IDToken == "" {
+		return nil, errors.New("token response is missing access_token or id_token")
+	}
+	return creds, nil
+}
+
+// randomString returns n random bytes encoded with base64url
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// localPath returns p if it is a path of this origin, and "/" otherwise, so that return_to can't redirect
+// to other sites
+func localPath(p string) string {
+	if !strings.HasPrefix(p, "/") || strings.HasPrefix(p, "//") || strings.HasPrefix(p, "/\\") {
+		return "/"
+	}
+	return p
+}
+
+// RedirectHandler redirects the browser to the authorization endpoint. It takes the permission ticket
+// in the "ticket" query parameter, and the path to come back to once the RPT is obtained in "return_to".
+func (c *ClaimsRedirect) RedirectHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ticket := r.URL.Query().Get("ticket")
+		if ticket == "" {
+			http.Error(w, "missing ticket", http.StatusBadRequest)
+			return
+		}
+		state, err := randomString(32)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		verifier, err := randomString(32)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := c.stateStore().Save(state, PendingClaims{
+			Ticket:       ticket,
+			CodeVerifier: verifier,
+			ReturnTo:     localPath(r.URL.Query().Get("return_to")),
+		}); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		setStateCookie(w, c.stateCookieName(), state, !c.InsecureCookie)
+		w.Header().Set("Cache-Control", "no-store")
+		http.Redirect(w, r, c.Client.authCodeURL(c.RedirectURI, c.Scopes, state, verifier), http.StatusFound)
+	})
+}
+
+// CallbackHandler exchanges the authorization code for the tokens of the user, then requests an RPT with
+// the pending ticket, pushing the ID token as claim_token. The RPT is given to OnRPT.
+func (c *ClaimsRedirect) CallbackHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if !checkStateCookie(w, r, c.stateCookieName(), q.Get("state"), !c.InsecureCookie) {
+			http.Error(w, "state does not belong to this browser", http.StatusBadRequest)
+			return
+		}
+		pc, ok, err := c.stateStore().Take(q.Get("state"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			http.Error(w, "unknown or expired state", http.StatusBadRequest)
+			return
+		}
+		if e := q.Get("error"); e != "" {
+			http.Error(w, "authorization failed: "+e, http.StatusForbidden)
+			return
+		}
+		creds, err := c.Client.exchangeCode(q.Get("code"), pc.CodeVerifier, c.RedirectURI)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		rpt, err := c.Client.RequestRPT(creds.AccessToken, RPTRequest{
+			Ticket:           pc.Ticket,
+			ClaimToken:       creds.IDToken,
+			ClaimTokenFormat: IDTokenFormat,
+		})
+		if err != nil {
+			if isAccessDenied(err) {
+				http.Error(w, "access denied", http.StatusForbidden)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		if c.OnRPT != nil {
+			c.OnRPT(w, r, rpt, pc.ReturnTo)
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		http.Redirect(w, r, pc.ReturnTo+"#"+url.Values{"rpt": {rpt}}.Encode(), http.StatusFound)
+	})
+}
@@ -0,0 +1,175 @@
+package rp
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/pckhoi/uma/pkg/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClaimsRedirect(t *testing.T) {
+	var issuer, challenge string
+	var rptForm url.Values
+	mux := http.NewServeMux()
+	writeJSON := func(w http.ResponseWriter, status int, obj any) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		require.NoError(t, json.NewEncoder(w).Encode(obj))
+	}
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{
+			"issuer":                 issuer,
+			"authorization_endpoint": issuer + "/auth",
+			"token_endpoint":         issuer + "/token",
+			"jwks_uri":               issuer + "/certs",
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		switch r.PostForm.Get("grant_type") {
+		case "authorization_code":
+			sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+			if r.PostForm.Get("code") != "code-1" || base64.RawURLEncoding.EncodeToString(sum[:]) != challenge {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+				return
+			}
+			assert.Equal(t, "secret", r.PostForm.Get("client_secret"))
+			writeJSON(w, http.StatusOK, map[string]any{"access_token": "user-token", "id_token": "id-token"})
+		default:
+			rptForm = r.PostForm
+			assert.Equal(t, "Bearer user-token", r.Header.Get("Authorization"))
+			if r.PostForm.Get("ticket") == "denied" {
+				writeJSON(w, http.StatusForbidden, map[string]string{"error": "access_denied"})
+				return
+			}
+			writeJSON(w, http.StatusOK, map[string]any{"access_token": "rpt-1"})
+		}
+	})
+	s := httptest.NewServer(mux)
+	defer s.Close()
+	issuer = s.URL
+
+	kc, err := NewKeycloakClient(issuer, "spa-bff", "secret", s.Client())
+	require.NoError(t, err)
+	cr := &ClaimsRedirect{Client: kc, RedirectURI: "https://app.example.com/uma/callback"}
+	// state cookies by state
+	cookies := map[string]*http.Cookie{}
+	redirect := func(query string) *url.URL {
+		t.Helper()
+		w := httptest.NewRecorder()
+		cr.RedirectHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/uma/claims?"+query, nil))
+		require.Equal(t, http.StatusFound, w.Code, w.Body.String())
+		u, err := url.Parse(w.Header().Get("Location"))
+		require.NoError(t, err)
+		resp := http.Response{Header: w.Header()}
+		require.Len(t, resp.Cookies(), 1)
+		cookies[u.Query().Get("state")] = resp.Cookies()[0]
+		return u
+	}
+	callbackWithCookie := func(query url.Values, cookie *http.Cookie) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/uma/callback?"+query.Encode(), nil)
+		if cookie != nil {
+			r.AddCookie(cookie)
+		}
+		cr.CallbackHandler().ServeHTTP(w, r)
+		return w
+	}
+	callback := func(query url.Values) *httptest.ResponseRecorder {
+		return callbackWithCookie(query, cookies[query.Get("state")])
+	}
+
+	u := redirect("ticket=ticket-1&return_to=/users/1")
+	assert.Equal(t, issuer+"/auth", u.Scheme+"://"+u.Host+u.Path)
+	q := u.Query()
+	assert.Equal(t, "code", q.Get("response_type"))
+	assert.Equal(t, "spa-bff", q.Get("client_id"))
+	assert.Equal(t, "https://app.example.com/uma/callback", q.Get("redirect_uri"))
+	assert.Equal(t, "openid", q.Get("scope"))
+	assert.Equal(t, "S256", q.Get("code_challenge_method"))
+	assert.NotEmpty(t, q.Get("state"))
+	challenge = q.Get("code_challenge")
+	cookie := cookies[q.Get("state")]
+	assert.Equal(t, "uma_claims_state", cookie.Name)
+	assert.NotEqual(t, q.Get("state"), cookie.Value)
+	assert.True(t, cookie.HttpOnly)
+	assert.True(t, cookie.Secure)
+	assert.Equal(t, 600, cookie.MaxAge)
+
+	// the state is bound to the browser that started the flow
+	w := callbackWithCookie(url.Values{"state": {q.Get("state")}, "code": {"code-1"}}, nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	other := redirect("ticket=ticket-other")
+	w = callbackWithCookie(url.Values{"state": {q.Get("state")}, "code": {"code-1"}}, cookies[other.Query().Get("state")])
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Empty(t, rptForm)
+
+	w = callback(url.Values{"state": {q.Get("state")}, "code": {"code-1"}})
+	assert.Equal(t, http.StatusFound, w.Code, w.Body.String())
+	assert.Equal(t, "/users/1#rpt=rpt-1", w.Header().Get("Location"))
+	assert.Equal(t, "ticket-1", rptForm.Get("ticket"))
+	assert.Equal(t, "id-token", rptForm.Get("claim_token"))
+	assert.Equal(t, string(IDTokenFormat), rptForm.Get("claim_token_format"))
+
+	// states are used once
+	w = callback(url.Values{"state": {q.Get("state")}, "code": {"code-1"}})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// return_to can't leave the origin
+	u = redirect("ticket=ticket-2&return_to=//evil.example.com")
+	challenge = u.Query().Get("code_challenge")
+	var returnTo string
+	cr.OnRPT = func(w http.ResponseWriter, r *http.Request, rpt, rt string) {
+		returnTo = rt
+		w.WriteHeader(http.StatusNoContent)
+	}
+	w = callback(url.Values{"state": {u.Query().Get("state")}, "code": {"code-1"}})
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "/", returnTo)
+
+	// the code can't be redeemed without the verifier of its state
+	u1 := redirect("ticket=ticket-3")
+	u2 := redirect("ticket=ticket-4")
+	challenge = u1.Query().Get("code_challenge")
+	w = callback(url.Values{"state": {u2.Query().Get("state")}, "code": {"code-1"}})
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+
+	u = redirect("ticket=denied")
+	challenge = u.Query().Get("code_challenge")
+	w = callback(url.Values{"state": {u.Query().Get("state")}, "code": {"code-1"}})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	u = redirect("ticket=ticket-5")
+	w = callback(url.Values{"state": {u.Query().Get("state")}, "error": {"access_denied"}})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = httptest.NewRecorder()
+	cr.RedirectHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/uma/claims", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestMemoryClaimsStateStore(t *testing.T) {
+	c := clock.NewFake(time.Unix(1000, 0))
+	s := NewMemoryClaimsStateStore(time.Minute)
+	s.Clock = c
+	require.NoError(t, s.Save("a", PendingClaims{Ticket: "t1"}))
+	require.NoError(t, s.Save("b", PendingClaims{Ticket: "t2"}))
+	pc, ok, err := s.Take("a")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "t1", pc.Ticket)
+	_, ok, _ = s.Take("a")
+	assert.False(t, ok)
+
+	c.Advance(time.Minute)
+	_, ok, _ = s.Take("b")
+	assert.False(t, ok)
+}
@@ -0,0 +1,102 @@
+package rp
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/pckhoi/uma/pkg/clock"
+	"gopkg.in/square/go-jose.v2"
+)
+
+// requestObjectLifetime is how long signed request objects are valid
+const requestObjectLifetime = time.Minute
+
+// WithSignedRequests sends UMA grant requests as JWT-secured requests (RFC 9101), as required by FAPI 2
+// security profiles. Request parameters are moved into a request object, which is signed with key
+// using the JOSE algorithm alg e.g. "PS256", and sent in the "request" parameter. keyID is the "kid"
+// of the key as registered with the authorization server.
+func WithSignedRequests(alg, keyID string, key interface{}) KeycloakClientOption {
+	return func(kc *KeycloakClient) {
+		kc.requestSigningKey = &jose.SigningKey{
+			Algorithm: jose.SignatureAlgorithm(alg),
+			Key:       jose.JSONWebKey{Key: key, KeyID: keyID},
+		}
+	}
+}
+
+// WithIssuerBoundResponses requires token responses to UMA grant requests to carry an "iss" parameter
+// that matches the issuer (RFC 9207), which protects clients that talk to several authorization
+// servers from mix-up attacks. It applies to RequestRPT and RequestDecision, whose responses are JSON
+// objects. Responses without a matching "iss" are rejected with ErrIssuerMismatch.
+func WithIssuerBoundResponses() KeycloakClientOption {
+	return func(kc *KeycloakClient) {
+		kc.requireResponseIssuer = true
+	}
+}
+
+// ErrIssuerMismatch is returned when the "iss" parameter of a response does not match the issuer
+type ErrIssuerMismatch struct {
+	Expected string
+	Actual   string
+}
+
+func (err ErrIssuerMismatch) Error() string {
+	if err.Actual == "" {
+		return fmt.Sprintf("response is missing iss parameter, expected %q", err.Expected)
+	}
+	return fmt.Sprintf("response iss %q does not match issuer %q", err.Actual, err.Expected)
+}
+
+// checkIssuer validates the iss parameter of a response if WithIssuerBoundResponses is enabled
+func (kc *KeycloakClient) checkIssuer(iss string) error {
+	if kc.requireResponseIssuer && iss != kc.issuer {
+		return ErrIssuerMismatch{Expected: kc.issuer, Actual: iss}
+	}
+	return nil
+}
+
+// signRequest moves values into a signed request object. Only grant_type is left outside, since token
+// endpoints need it to pick the grant handler.
+func (kc *KeycloakClient) signRequest(values url.Values) (url.Values, error) {
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return nil, err
+	}
+	now := clock.OrReal(kc.clock).Now()
+	claims := map[string]interface{}{
+		"iss": kc.clientID,
+		"aud": kc.issuer,
+		"iat": now.Unix(),
+		"nbf": now.Unix(),
+		"exp": now.Add(requestObjectLifetime).Unix(),
+		"jti": hex.EncodeToString(jti),
+	}
+	for k, v := range values {
+		if len(v) == 1 {
+			claims[k] = v[0]
+		} else {
+			claims[k] = v
+		}
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := kc.requestSigner.Sign(payload)
+	if err != nil {
+		return nil, fmt.Errorf("error signing request object: %w", err)
+	}
+	jwt, err := obj.CompactSerialize()
+	if err != nil {
+		return nil, err
+	}
+	return url.Values{
+		"grant_type": {values.Get("grant_type")},
+		"client_id":  {kc.clientID},
+		"request":    {jwt},
+	}, nil
+}
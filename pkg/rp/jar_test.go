@@ -0,0 +1,128 @@
+package rp
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pckhoi/uma/pkg/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/square/go-jose.v2"
+)
+
+// newTokenEndpoint starts an authorization server whose token endpoint is served by token
+func newTokenEndpoint(t *testing.T, token http.HandlerFunc) *httptest.Server {
+	t.Helper()
+	var s *httptest.Server
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		require.NoError(t, json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 s.URL,
+			"authorization_endpoint": s.URL + "/auth",
+			"token_endpoint":         s.URL + "/token",
+			"jwks_uri":               s.URL + "/certs",
+		}))
+	})
+	mux.HandleFunc("/token", token)
+	s = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestSignedRequests(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	c := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	var claims map[string]interface{}
+	s := newTokenEndpoint(t, func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, "urn:ietf:params:oauth:grant-type:uma-ticket", r.PostForm.Get("grant_type"))
+		assert.Equal(t, "client-1", r.PostForm.Get("client_id"))
+		assert.Empty(t, r.PostForm["permission"])
+		assert.Empty(t, r.PostForm["audience"])
+		assert.Equal(t, "Bearer access-token", r.Header.Get("Authorization"))
+
+		obj, err := jose.ParseSigned(r.PostForm.Get("request"))
+		require.NoError(t, err)
+		require.Len(t, obj.Signatures, 1)
+		assert.Equal(t, "oauth-authz-req+jwt", obj.Signatures[0].Protected.ExtraHeaders[jose.HeaderType])
+		assert.Equal(t, "kid-1", obj.Signatures[0].Protected.KeyID)
+		assert.Equal(t, "PS256", obj.Signatures[0].Protected.Algorithm)
+		payload, err := obj.Verify(&key.PublicKey)
+		require.NoError(t, err)
+		claims = map[string]interface{}{}
+		require.NoError(t, json.Unmarshal(payload, &claims))
+		w.Header().Set("Content-Type", "application/json")
+		require.NoError(t, json.NewEncoder(w).Encode(map[string]any{"access_token": "rpt-1"}))
+	})
+	kc, err := NewKeycloakClient(s.URL, "client-1", "secret", s.Client(),
+		WithSignedRequests("PS256", "kid-1", key),
+		WithClock(c),
+	)
+	require.NoError(t, err)
+
+	rpt, err := kc.RequestRPT("access-token", RPTRequest{
+		Permission: []string{"r1#read", "r2#write"},
+		Audience:   "api",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "rpt-1", rpt)
+	jti, _ := claims["jti"].(string)
+	assert.Len(t, jti, 32)
+	assert.Equal(t, map[string]interface{}{
+		"iss":        "client-1",
+		"aud":        s.URL,
+		"iat":        float64(c.Now().Unix()),
+		"nbf":        float64(c.Now().Unix()),
+		"exp":        float64(c.Now().Add(time.Minute).Unix()),
+		"jti":        jti,
+		"grant_type": "urn:ietf:params:oauth:grant-type:uma-ticket",
+		"permission": []interface{}{"r1#read", "r2#write"},
+		"audience":   "api",
+	}, claims)
+
+	// every request object has its own jti
+	_, err = kc.RequestRPT("access-token", RPTRequest{Permission: []string{"r1#read"}, Audience: "api"})
+	require.NoError(t, err)
+	assert.Equal(t, "r1#read", claims["permission"])
+	assert.NotEqual(t, jti, claims["jti"])
+}
+
+func TestIssuerBoundResponses(t *testing.T) {
+	var iss string
+	s := newTokenEndpoint(t, func(w http.ResponseWriter, r *http.Request) {
+		resp := map[string]any{"access_token": "rpt-1"}
+		if iss != "" {
+			resp["iss"] = iss
+		}
+		w.Header().Set("Content-Type", "application/json")
+		require.NoError(t, json.NewEncoder(w).Encode(resp))
+	})
+	request := RPTRequest{Ticket: "ticket-1"}
+
+	kc, err := NewKeycloakClient(s.URL, "client-1", "secret", s.Client())
+	require.NoError(t, err)
+	_, err = kc.RequestRPT("access-token", request)
+	assert.NoError(t, err, "iss is not required by default")
+
+	kc, err = NewKeycloakClient(s.URL, "client-1", "secret", s.Client(), WithIssuerBoundResponses())
+	require.NoError(t, err)
+	_, err = kc.RequestRPT("access-token", request)
+	assert.Equal(t, ErrIssuerMismatch{Expected: s.URL}, err)
+	assert.EqualError(t, err, `response is missing iss parameter, expected "`+s.URL+`"`)
+
+	iss = "https://evil.example.com"
+	_, err = kc.RequestRPT("access-token", request)
+	assert.Equal(t, ErrIssuerMismatch{Expected: s.URL, Actual: iss}, err)
+
+	iss = s.URL
+	rpt, err := kc.RequestRPT("access-token", request)
+	require.NoError(t, err)
+	assert.Equal(t, "rpt-1", rpt)
+}
@@ -2,27 +2,79 @@ package rp
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"net/url"
+	"strings"
 
 	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/pckhoi/uma/pkg/clock"
 	"github.com/pckhoi/uma/pkg/httputil"
 	"github.com/pckhoi/uma/pkg/urlencode"
+	"gopkg.in/square/go-jose.v2"
 )
 
 type KeycloakClient struct {
-	oidc         *oidc.Provider
-	clientID     string
-	clientSecret string
-	client       *http.Client
+	oidc                  *oidc.Provider
+	issuer                string
+	clientID              string
+	clientSecret          string
+	client                *http.Client
+	replayCache           TicketReplayCache
+	requestSigningKey     *jose.SigningKey
+	requestSigner         jose.Signer
+	requireResponseIssuer bool
+	clock                 clock.Clock
+	rptConcurrency        int
+	retry                 httputil.RetryOptions
 }
 
-func NewKeycloakClient(issuer, clientID, clientSecret string, client *http.Client) (*KeycloakClient, error) {
+type KeycloakClientOption func(kc *KeycloakClient)
+
+// WithTicketReplayCache makes the client refuse to send a permission ticket in more than one token
+// request. Replayed tickets are rejected with ErrTicketReplayed before anything is sent.
+func WithTicketReplayCache(cache TicketReplayCache) KeycloakClientOption {
+	return func(kc *KeycloakClient) {
+		kc.replayCache = cache
+	}
+}
+
+// WithClock sets the clock used to time signed request objects. Defaults to the system clock.
+func WithClock(c clock.Clock) KeycloakClientOption {
+	return func(kc *KeycloakClient) {
+		kc.clock = c
+	}
+}
+
+// WithRetryOptions retries token requests that fail with network errors or retryable statuses. They are
+// not retried by default.
+func WithRetryOptions(opts httputil.RetryOptions) KeycloakClientOption {
+	return func(kc *KeycloakClient) {
+		kc.retry = opts
+	}
+}
+
+func NewKeycloakClient(issuer, clientID, clientSecret string, client *http.Client, opts ...KeycloakClientOption) (*KeycloakClient, error) {
 	kc := &KeycloakClient{
+		issuer:       issuer,
 		clientID:     clientID,
 		clientSecret: clientSecret,
 		client:       client,
 	}
+	for _, opt := range opts {
+		opt(kc)
+	}
 	var err error
+	if kc.requestSigningKey != nil {
+		kc.requestSigner, err = jose.NewSigner(
+			*kc.requestSigningKey,
+			(&jose.SignerOptions{}).WithType("oauth-authz-req+jwt"),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error creating request signer: %w", err)
+		}
+	}
 	kc.oidc, err = oidc.NewProvider(oidc.ClientContext(context.Background(), client), issuer)
 	if err != nil {
 		return nil, err
@@ -30,14 +82,20 @@ func NewKeycloakClient(issuer, clientID, clientSecret string, client *http.Clien
 	return kc, nil
 }
 
+// postToken posts values to the token endpoint
+func (kc *KeycloakClient) postToken(modifyRequest func(r *http.Request), values url.Values) (*http.Response, error) {
+	return httputil.PostFormUrlencodedContext(context.Background(), kc.client, kc.retry, kc.oidc.Endpoint().TokenURL, modifyRequest, values)
+}
+
 type Credentials struct {
 	IDToken      string `json:"id_token,omitempty"`
 	AccessToken  string `json:"access_token,omitempty"`
 	RefreshToken string `json:"refresh_token,omitempty"`
+	ExpiresIn    int    `json:"expires_in,omitempty"`
 }
 
 func (kc *KeycloakClient) Authenticate() (*httputil.ClientCreds, error) {
-	resp, err := httputil.PostFormUrlencoded(kc.client, kc.oidc.Endpoint().TokenURL, nil, map[string][]string{
+	resp, err := kc.postToken(nil, map[string][]string{
 		"grant_type":    {"client_credentials"},
 		"client_id":     {kc.clientID},
 		"client_secret": {kc.clientSecret},
@@ -61,7 +119,7 @@ func (kc *KeycloakClient) AuthenticateUserWithPassword(username, password string
 		"username":      {username},
 		"password":      {password},
 	}
-	resp, err := httputil.PostFormUrlencoded(kc.client, kc.oidc.Endpoint().TokenURL, nil, params)
+	resp, err := kc.postToken(nil, params)
 	if err != nil {
 		return
 	}
@@ -79,7 +137,7 @@ func (kc *KeycloakClient) RefreshCredentials(creds Credentials) (*Credentials, e
 		"client_secret": {kc.clientSecret},
 		"refresh_token": {creds.RefreshToken},
 	}
-	resp, err := httputil.PostFormUrlencoded(kc.client, kc.oidc.Endpoint().TokenURL, nil, params)
+	resp, err := kc.postToken(nil, params)
 	if err != nil {
 		return nil, err
 	}
@@ -100,64 +158,186 @@ const (
 	IDTokenFormat ClaimTokenFormat = "https://openid.net/specs/openid-connect-core-1_0.html#IDToken"
 )
 
+// Permission is a resource and scopes requested with RPTRequest
+type Permission struct {
+	// ResourceID is the id or the name of the resource. It can be empty to request scopes on any resource.
+	ResourceID string
+	Scopes     []string
+}
+
+// String formats p as a permission parameter, e.g. "Resource A#Scope A, Scope B"
+func (p Permission) String() string {
+	if len(p.Scopes) == 0 {
+		return p.ResourceID
+	}
+	return p.ResourceID + "#" + strings.Join(p.Scopes, ", ")
+}
+
 type RPTRequest struct {
 	// Ticket is optional. The most recent permission ticket received by the client as part of the UMA authorization process.
-	Ticket string
+	Ticket string `url:",omitempty"`
 
 	// ClaimToken  is optional. A string representing additional claims that should be considered by the server when evaluating
 	// permissions for the resource(s) and scope(s) being requested. This parameter allows clients to push claims to Keycloak.
 	// For more details about all supported token formats see ClaimTokenFormat parameter.
-	ClaimToken string
+	ClaimToken string `url:",omitempty"`
 
 	// ClaimTokenFormat is optional. A string indicating the format of the token specified in the ClaimToken parameter.
 	// Inspect AccessTokenFormat and IDTokenFormat to learn more.
-	ClaimTokenFormat ClaimTokenFormat
+	ClaimTokenFormat ClaimTokenFormat `url:",omitempty"`
 
 	// RPT is optional. A previously issued RPT which permissions should also be evaluated and added in a new one. This parameter
 	// allows clients in possession of an RPT to perform incremental authorization where permissions are added on demand.
-	RPT string `url:"rpt"`
+	RPT string `url:"rpt,omitempty"`
 
 	// Permission is optional. A string representing a set of one or more resources and scopes the client is seeking access.
 	// This parameter can be defined multiple times in order to request permission for multiple resource and scopes.
 	// This parameter is an extension to urn:ietf:params:oauth:grant-type:uma-ticket grant type in order to allow clients to
 	// send authorization requests without a permission ticket. The format of the string must be: RESOURCE_ID#SCOPE_ID. For
 	// instance: Resource A#Scope A, Resource A#Scope A, Scope B, Scope C, Resource A, #Scope A.
-	Permission []string
+	Permission []string `url:",omitempty"`
+
+	// Permissions is optional. It is the structured form of Permission, which is sent along with it.
+	Permissions []Permission `url:"-"`
 
 	// Audience is optional. The client identifier of the resource server to which the client is seeking access. This parameter
 	// is mandatory in case the permission parameter is defined. It serves as a hint to Keycloak to indicate the context in
 	// which permissions should be evaluated.
-	Audience string
+	Audience string `url:",omitempty"`
 
 	// ResponseIncludeResourceName is optional. A boolean value indicating to the server whether resource names should be included
 	// in the RPT’s permissions. If false, only the resource identifier is included.
-	ResponseIncludeResourceName bool
+	ResponseIncludeResourceName bool `url:",omitempty"`
 
 	// ResponsePermissionsLimit is optional. An integer N that defines a limit for the amount of permissions an RPT can have. When
 	// used together with rpt parameter, only the last N requested permissions will be kept in the RPT.
-	ResponsePermissionsLimit int
+	ResponsePermissionsLimit int `url:",omitempty"`
 
 	// SubmitRequest is optional. A boolean value indicating whether the server should create permission requests to the resources
 	// and scopes referenced by a permission ticket. This parameter only has effect if used together with the ticket parameter as
 	// part of a UMA authorization process.
-	SubmitRequest bool
+	SubmitRequest bool `url:",omitempty"`
 }
 
-func (kc *KeycloakClient) RequestRPT(accessToken string, request RPTRequest) (rpt string, err error) {
+// postUMATicketGrant sends request to the token endpoint using the uma-ticket grant type
+func (kc *KeycloakClient) postUMATicketGrant(accessToken string, request RPTRequest, responseMode string) (*http.Response, error) {
+	if kc.replayCache != nil && request.Ticket != "" {
+		seen, err := kc.replayCache.Seen(request.Ticket)
+		if err != nil {
+			return nil, err
+		}
+		if seen {
+			return nil, ErrTicketReplayed{Ticket: request.Ticket}
+		}
+	}
 	values, err := urlencode.ToValues(request)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	for _, p := range request.Permissions {
+		values.Add("permission", p.String())
 	}
 	values.Set("grant_type", "urn:ietf:params:oauth:grant-type:uma-ticket")
-	resp, err := httputil.PostFormUrlencoded(kc.client, kc.oidc.Endpoint().TokenURL, func(r *http.Request) {
+	if responseMode != "" {
+		values.Set("response_mode", responseMode)
+	}
+	if kc.requestSigner != nil {
+		signed, err := kc.signRequest(*values)
+		if err != nil {
+			return nil, err
+		}
+		values = &signed
+	}
+	return kc.postToken(func(r *http.Request) {
 		r.Header.Set("Authorization", "Bearer "+accessToken)
 	}, *values)
+}
+
+func (kc *KeycloakClient) RequestRPT(accessToken string, request RPTRequest) (rpt string, err error) {
+	resp, err := kc.postUMATicketGrant(accessToken, request, "")
 	if err != nil {
 		return "", err
 	}
-	tok := &Credentials{}
+	tok := &struct {
+		Credentials
+		Iss string `json:"iss,omitempty"`
+	}{}
 	if err := httputil.DecodeJSONResponse(resp, tok); err != nil {
 		return "", err
 	}
+	if err := kc.checkIssuer(tok.Iss); err != nil {
+		return "", err
+	}
 	return tok.AccessToken, nil
 }
+
+// UpgradeRPT requests a new RPT that keeps the permissions of rpt and adds the given scopes on the
+// resource. rpt itself authenticates the request. audience is the client id of the resource server. It
+// can be used as uma.RPTRefresh.Refresh:
+//
+//	Refresh: func(r *http.Request, rpt, resourceID string, scopes []string) (string, error) {
+//		return kc.UpgradeRPT(rpt, "my-resource-server", resourceID, scopes...)
+//	}
+func (kc *KeycloakClient) UpgradeRPT(rpt, audience, resourceID string, scopes ...string) (string, error) {
+	return kc.RequestRPT(rpt, RPTRequest{
+		RPT:         rpt,
+		Permissions: []Permission{{ResourceID: resourceID, Scopes: scopes}},
+		Audience:    audience,
+	})
+}
+
+// isAccessDenied returns true if Keycloak refused to grant the requested permissions
+func isAccessDenied(err error) bool {
+	var asErr *httputil.ASError
+	return errors.As(err, &asErr) && asErr.Status == http.StatusForbidden && asErr.Code == "access_denied"
+}
+
+type decisionResponse struct {
+	Result bool   `json:"result"`
+	Iss    string `json:"iss,omitempty"`
+}
+
+// RequestDecision evaluates the requested permissions without issuing an RPT, using response_mode=decision.
+// It returns true if all requested permissions are granted. It is a cheap way to check access when the
+// client doesn't need a token.
+func (kc *KeycloakClient) RequestDecision(accessToken string, request RPTRequest) (granted bool, err error) {
+	resp, err := kc.postUMATicketGrant(accessToken, request, "decision")
+	if err != nil {
+		if isAccessDenied(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	obj := &decisionResponse{}
+	if err := httputil.DecodeJSONResponse(resp, obj); err != nil {
+		return false, err
+	}
+	if err := kc.checkIssuer(obj.Iss); err != nil {
+		return false, err
+	}
+	return obj.Result, nil
+}
+
+// GrantedPermission is a permission granted to the requesting party
+type GrantedPermission struct {
+	ResourceID   string   `json:"rsid,omitempty"`
+	ResourceName string   `json:"rsname,omitempty"`
+	Scopes       []string `json:"scopes,omitempty"`
+}
+
+// RequestPermissions evaluates the requested permissions without issuing an RPT, using response_mode=permissions.
+// It returns the granted permissions, which is empty if none of the requested permissions are granted.
+func (kc *KeycloakClient) RequestPermissions(accessToken string, request RPTRequest) (perms []GrantedPermission, err error) {
+	resp, err := kc.postUMATicketGrant(accessToken, request, "permissions")
+	if err != nil {
+		if isAccessDenied(err) {
+			return []GrantedPermission{}, nil
+		}
+		return nil, err
+	}
+	perms = []GrantedPermission{}
+	if err := httputil.DecodeJSONResponse(resp, &perms); err != nil {
+		return nil, err
+	}
+	return perms, nil
+}
@@ -0,0 +1,117 @@
+package rp
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/pckhoi/uma/pkg/httputil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newEvaluationEndpoint starts an authorization server that answers UMA grant requests according to
+// response_mode, with iss in decisions if it is not empty. Permissions for "denied" are refused and
+// permissions for "broken" fail. The form of the last request is stored in form.
+func newEvaluationEndpoint(t *testing.T, iss *string, form *url.Values) *httptest.Server {
+	t.Helper()
+	return newTokenEndpoint(t, func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		*form = r.PostForm
+		assert.Equal(t, "urn:ietf:params:oauth:grant-type:uma-ticket", r.PostForm.Get("grant_type"))
+		assert.Equal(t, "Bearer access-token", r.Header.Get("Authorization"))
+		w.Header().Set("Content-Type", "application/json")
+		switch r.PostForm.Get("permission") {
+		case "denied":
+			w.WriteHeader(http.StatusForbidden)
+			require.NoError(t, json.NewEncoder(w).Encode(map[string]string{"error": "access_denied"}))
+			return
+		case "broken":
+			w.WriteHeader(http.StatusInternalServerError)
+			require.NoError(t, json.NewEncoder(w).Encode(map[string]string{"error": "server_error"}))
+			return
+		}
+		var resp interface{}
+		switch r.PostForm.Get("response_mode") {
+		case "decision":
+			obj := map[string]interface{}{"result": true}
+			if *iss != "" {
+				obj["iss"] = *iss
+			}
+			resp = obj
+		case "permissions":
+			resp = []map[string]interface{}{
+				{"rsid": "r1", "rsname": "User 1", "scopes": []string{"read"}},
+				{"rsid": "r2", "rsname": "User 2"},
+			}
+		default:
+			t.Errorf("unexpected response_mode %q", r.PostForm.Get("response_mode"))
+		}
+		require.NoError(t, json.NewEncoder(w).Encode(resp))
+	})
+}
+
+func TestRequestDecision(t *testing.T) {
+	var iss string
+	form := url.Values{}
+	s := newEvaluationEndpoint(t, &iss, &form)
+	kc, err := NewKeycloakClient(s.URL, "client-1", "secret", s.Client())
+	require.NoError(t, err)
+
+	granted, err := kc.RequestDecision("access-token", RPTRequest{
+		Permissions: []Permission{{ResourceID: "r1", Scopes: []string{"read", "write"}}, {ResourceID: "r2"}},
+		Audience:    "api",
+	})
+	require.NoError(t, err)
+	assert.True(t, granted)
+	assert.Equal(t, "decision", form.Get("response_mode"))
+	assert.Equal(t, []string{"r1#read, write", "r2"}, form["permission"])
+	assert.Equal(t, "api", form.Get("audience"))
+
+	granted, err = kc.RequestDecision("access-token", RPTRequest{Permission: []string{"denied"}})
+	require.NoError(t, err)
+	assert.False(t, granted)
+
+	_, err = kc.RequestDecision("access-token", RPTRequest{Permission: []string{"broken"}})
+	var asErr *httputil.ASError
+	require.True(t, errors.As(err, &asErr))
+	assert.Equal(t, http.StatusInternalServerError, asErr.Status)
+
+	kc, err = NewKeycloakClient(s.URL, "client-1", "secret", s.Client(), WithIssuerBoundResponses())
+	require.NoError(t, err)
+	_, err = kc.RequestDecision("access-token", RPTRequest{Permission: []string{"r1"}})
+	assert.Equal(t, ErrIssuerMismatch{Expected: s.URL}, err)
+	iss = s.URL
+	granted, err = kc.RequestDecision("access-token", RPTRequest{Permission: []string{"r1"}})
+	require.NoError(t, err)
+	assert.True(t, granted)
+}
+
+func TestRequestPermissions(t *testing.T) {
+	var iss string
+	form := url.Values{}
+	s := newEvaluationEndpoint(t, &iss, &form)
+	kc, err := NewKeycloakClient(s.URL, "client-1", "secret", s.Client())
+	require.NoError(t, err)
+
+	perms, err := kc.RequestPermissions("access-token", RPTRequest{Ticket: "ticket-1"})
+	require.NoError(t, err)
+	assert.Equal(t, "permissions", form.Get("response_mode"))
+	assert.Equal(t, "ticket-1", form.Get("ticket"))
+	assert.Equal(t, []GrantedPermission{
+		{ResourceID: "r1", ResourceName: "User 1", Scopes: []string{"read"}},
+		{ResourceID: "r2", ResourceName: "User 2"},
+	}, perms)
+
+	perms, err = kc.RequestPermissions("access-token", RPTRequest{Permission: []string{"denied"}})
+	require.NoError(t, err)
+	assert.NotNil(t, perms)
+	assert.Empty(t, perms)
+
+	perms, err = kc.RequestPermissions("access-token", RPTRequest{Permission: []string{"broken"}})
+	assert.Error(t, err)
+	assert.Nil(t, perms)
+}
@@ -0,0 +1,148 @@
+package rp
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// RPTPermissions returns the permissions granted by rpt. The signature is not verified, as it is only
+// meant for clients to tell which permissions they already hold.
+func RPTPermissions(rpt string) ([]GrantedPermission, error) {
+	parts := strings.Split(rpt, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed RPT: expected 3 parts, got %d", len(parts))
+	}
+	b, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("malformed RPT payload: %w", err)
+	}
+	claims := &struct {
+		Authorization struct {
+			Permissions []GrantedPermission `json:"permissions"`
+		} `json:"authorization"`
+	}{}
+	if err := json.Unmarshal(b, claims); err != nil {
+		return nil, fmt.Errorf("malformed RPT payload: %w", err)
+	}
+	return claims.Authorization.Permissions, nil
+}
+
+// permissionKey identifies the resource of p by id, or by name if the id is unknown
+func permissionKey(p GrantedPermission) string {
+	if p.ResourceID != "" {
+		return p.ResourceID
+	}
+	return p.ResourceName
+}
+
+// MergePermissions combines permissions on the same resource and removes duplicated scopes. Resources
+// keep the order they first appear in, and scopes are sorted.
+func MergePermissions(perms []GrantedPermission) []GrantedPermission {
+	res := []GrantedPermission{}
+	idx := map[string]int{}
+	for _, p := range perms {
+		k := permissionKey(p)
+		i, ok := idx[k]
+		if !ok {
+			i = len(res)
+			idx[k] = i
+			res = append(res, GrantedPermission{ResourceID: p.ResourceID, ResourceName: p.ResourceName})
+		}
+		res[i].Scopes = append(res[i].Scopes, p.Scopes...)
+	}
+	for i := range res {
+		if len(res[i].Scopes) == 0 {
+			res[i].Scopes = nil
+			continue
+		}
+		sort.Strings(res[i].Scopes)
+		scopes := res[i].Scopes[:1]
+		for _, s := range res[i].Scopes[1:] {
+			if s != scopes[len(scopes)-1] {
+				scopes = append(scopes, s)
+			}
+		}
+		res[i].Scopes = scopes
+	}
+	return res
+}
+
+// MissingPermissions returns the required permissions that are not granted, with only the scopes that
+// are missing. A required permission without scopes is satisfied by any grant on the resource. Resources
+// are matched by id, or by name if the required permission has no id.
+func MissingPermissions(granted, required []GrantedPermission) []GrantedPermission {
+	byID := map[string]map[string]struct{}{}
+	byName := map[string]map[string]struct{}{}
+	add := func(m map[string]map[string]struct{}, k string, scopes []string) {
+		if k == "" {
+			return
+		}
+		if m[k] == nil {
+			m[k] = map[string]struct{}{}
+		}
+		for _, s := range scopes {
+			m[k][s] = struct{}{}
+		}
+	}
+	for _, g := range granted {
+		add(byID, g.ResourceID, g.Scopes)
+		add(byName, g.ResourceName, g.Scopes)
+	}
+	missing := []GrantedPermission{}
+	for _, p := range MergePermissions(required) {
+		var scopes map[string]struct{}
+		var ok bool
+		if p.ResourceID != "" {
+			scopes, ok = byID[p.ResourceID]
+		} else {
+			scopes, ok = byName[p.ResourceName]
+		}
+		if !ok {
+			missing = append(missing, p)
+			continue
+		}
+		var lacking []string
+		for _, s := range p.Scopes {
+			if _, ok := scopes[s]; !ok {
+				lacking = append(lacking, s)
+			}
+		}
+		if len(lacking) > 0 {
+			p.Scopes = lacking
+			missing = append(missing, p)
+		}
+	}
+	return missing
+}
+
+// PermissionParams formats perms as the permission parameters of RPTRequest, e.g. "resource-id#read, write".
+// Permissions on the same resource are merged into one parameter.
+func PermissionParams(perms []GrantedPermission) []string {
+	merged := MergePermissions(perms)
+	params := make([]string, len(merged))
+	for i, p := range merged {
+		params[i] = Permission{ResourceID: permissionKey(p), Scopes: p.Scopes}.String()
+	}
+	return params
+}
+
+// MinimalPermissionRequest returns the permission parameters that rpt lacks to satisfy required, so that
+// an upgraded RPT can be requested with only what is needed. It returns nil if rpt already grants all of
+// required. An empty rpt grants nothing.
+func MinimalPermissionRequest(rpt string, required []GrantedPermission) ([]string, error) {
+	var granted []GrantedPermission
+	if rpt != "" {
+		var err error
+		if granted, err = RPTPermissions(rpt); err != nil {
+			return nil, err
+		}
+	}
+	missing := MissingPermissions(granted, required)
+	if len(missing) == 0 {
+		return nil, nil
+	}
+	return PermissionParams(missing), nil
+}
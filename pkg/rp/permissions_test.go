@@ -0,0 +1,107 @@
+package rp
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMissingPermissions(t *testing.T) {
+	granted := []GrantedPermission{
+		{ResourceID: "r1", ResourceName: "User 1", Scopes: []string{"read"}},
+		{ResourceID: "r2", ResourceName: "User 2", Scopes: []string{"read", "write"}},
+		{ResourceID: "r3", ResourceName: "User 3"},
+	}
+	assert.Equal(t, []GrantedPermission{
+		{ResourceID: "r1", Scopes: []string{"write"}},
+		{ResourceName: "User 4", Scopes: []string{"read"}},
+	}, MissingPermissions(granted, []GrantedPermission{
+		{ResourceID: "r1", Scopes: []string{"write", "read"}},
+		{ResourceID: "r1", Scopes: []string{"write"}},
+		{ResourceName: "User 2", Scopes: []string{"write"}},
+		{ResourceID: "r3"},
+		{ResourceName: "User 4", Scopes: []string{"read"}},
+	}))
+	assert.Empty(t, MissingPermissions(granted, []GrantedPermission{{ResourceID: "r2", Scopes: []string{"write"}}}))
+}
+
+func TestPermissionParams(t *testing.T) {
+	assert.Equal(t, []string{"r1#read, write", "User 2", "r3#read"}, PermissionParams([]GrantedPermission{
+		{ResourceID: "r1", Scopes: []string{"write"}},
+		{ResourceName: "User 2"},
+		{ResourceID: "r1", Scopes: []string{"read", "write"}},
+		{ResourceID: "r3", Scopes: []string{"read"}},
+	}))
+}
+
+func TestMinimalPermissionRequest(t *testing.T) {
+	rpt := "e30." + base64.RawURLEncoding.EncodeToString([]byte(
+		`{"authorization":{"permissions":[{"rsid":"r1","rsname":"User 1","scopes":["read"]}]}}`,
+	)) + ".sig"
+	perms, err := RPTPermissions(rpt)
+	require.NoError(t, err)
+	assert.Equal(t, []GrantedPermission{{ResourceID: "r1", ResourceName: "User 1", Scopes: []string{"read"}}}, perms)
+
+	params, err := MinimalPermissionRequest(rpt, []GrantedPermission{
+		{ResourceID: "r1", Scopes: []string{"read", "write"}},
+		{ResourceID: "r2", Scopes: []string{"read"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"r1#write", "r2#read"}, params)
+
+	params, err = MinimalPermissionRequest(rpt, []GrantedPermission{{ResourceName: "User 1", Scopes: []string{"read"}}})
+	require.NoError(t, err)
+	assert.Nil(t, params)
+
+	params, err = MinimalPermissionRequest("", []GrantedPermission{{ResourceID: "r1"}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"r1"}, params)
+
+	_, err = MinimalPermissionRequest("not-a-jwt", nil)
+	assert.EqualError(t, err, "malformed RPT: expected 3 parts, got 1")
+}
+
+func TestRPTRequestPermissions(t *testing.T) {
+	assert.Equal(t, "r1#read, write", Permission{ResourceID: "r1", Scopes: []string{"read", "write"}}.String())
+	assert.Equal(t, "r1", Permission{ResourceID: "r1"}.String())
+	assert.Equal(t, "#read", Permission{Scopes: []string{"read"}}.String())
+
+	var issuer string
+	var form url.Values
+	mux := http.NewServeMux()
+	writeJSON := func(w http.ResponseWriter, obj any) {
+		w.Header().Set("Content-Type", "application/json")
+		require.NoError(t, json.NewEncoder(w).Encode(obj))
+	}
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]string{"issuer": issuer, "token_endpoint": issuer + "/token"})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		form = r.PostForm
+		writeJSON(w, map[string]string{"access_token": "rpt"})
+	})
+	s := httptest.NewServer(mux)
+	defer s.Close()
+	issuer = s.URL
+
+	kc, err := NewKeycloakClient(issuer, "client", "secret", s.Client())
+	require.NoError(t, err)
+	_, err = kc.RequestRPT("token", RPTRequest{
+		Permission:  []string{"r0#read"},
+		Permissions: []Permission{{ResourceID: "r1", Scopes: []string{"read", "write"}}, {ResourceID: "r2"}},
+		Audience:    "api",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"r0#read", "r1#read, write", "r2"}, form["permission"])
+	assert.Empty(t, form["permissions"])
+	for _, k := range []string{"ticket", "rpt", "submit_request", "response_permissions_limit"} {
+		assert.NotContains(t, form, k)
+	}
+}
@@ -0,0 +1,94 @@
+package rp
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pckhoi/uma/pkg/clock"
+)
+
+// TicketReplayCache remembers permission tickets that were sent in token requests, so a ticket can't
+// be exchanged twice by the same client, e.g. when a leaked WWW-Authenticate header is replayed.
+type TicketReplayCache interface {
+	// Seen records ticket and reports whether it was recorded before
+	Seen(ticket string) (bool, error)
+}
+
+// ErrTicketReplayed is returned when a permission ticket was already used in a previous token request
+type ErrTicketReplayed struct {
+	Ticket string
+}
+
+func (err ErrTicketReplayed) Error() string {
+	return fmt.Sprintf("permission ticket %q was already used", err.Ticket)
+}
+
+// MemoryTicketReplayCache is an in-memory TicketReplayCache. Tickets are forgotten after their TTL,
+// which should be longer than the ticket lifetime of the authorization server.
+type MemoryTicketReplayCache struct {
+	// Clock tells when tickets are forgotten. Defaults to the system clock. Set it before the cache is used.
+	Clock clock.Clock
+
+	mu      sync.Mutex
+	ttl     time.Duration
+	tickets map[string]time.Time
+	replays uint64
+}
+
+// ReplayCacheStats are the counters of a MemoryTicketReplayCache
+type ReplayCacheStats struct {
+	// Tickets is the number of remembered tickets, including expired tickets that were not removed yet
+	Tickets int
+
+	// Replays counts tickets that were refused because they were seen before
+	Replays uint64
+}
+
+// NewMemoryTicketReplayCache creates a MemoryTicketReplayCache that remembers tickets for ttl
+func NewMemoryTicketReplayCache(ttl time.Duration) *MemoryTicketReplayCache {
+	return &MemoryTicketReplayCache{
+		ttl:     ttl,
+		tickets: map[string]time.Time{},
+	}
+}
+
+func (c *MemoryTicketReplayCache) Seen(ticket string) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := clock.OrReal(c.Clock).Now()
+	for t, expires := range c.tickets {
+		if !now.Before(expires) {
+			delete(c.tickets, t)
+		}
+	}
+	if _, ok := c.tickets[ticket]; ok {
+		c.replays++
+		return true, nil
+	}
+	c.tickets[ticket] = now.Add(c.ttl)
+	return false, nil
+}
+
+// Stats returns the counters of the cache
+func (c *MemoryTicketReplayCache) Stats() ReplayCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return ReplayCacheStats{Tickets: len(c.tickets), Replays: c.replays}
+}
+
+// Purge forgets tickets that start with prefix, or all tickets if prefix is empty, so that they can be
+// exchanged again. It returns how many tickets were forgotten.
+func (c *MemoryTicketReplayCache) Purge(prefix string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for t := range c.tickets {
+		if strings.HasPrefix(t, prefix) {
+			delete(c.tickets, t)
+			n++
+		}
+	}
+	return n
+}
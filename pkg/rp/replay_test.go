@@ -0,0 +1,24 @@
+package rp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryTicketReplayCacheStats(t *testing.T) {
+	c := NewMemoryTicketReplayCache(time.Minute)
+	for _, ticket := range []string{"a-1", "a-2", "b-1", "a-1"} {
+		_, err := c.Seen(ticket)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, ReplayCacheStats{Tickets: 3, Replays: 1}, c.Stats())
+	assert.Equal(t, 2, c.Purge("a-"))
+	seen, err := c.Seen("a-1")
+	require.NoError(t, err)
+	assert.False(t, seen)
+	assert.Equal(t, 2, c.Purge(""))
+	assert.Equal(t, ReplayCacheStats{Replays: 1}, c.Stats())
+}
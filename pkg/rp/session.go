@@ -0,0 +1,346 @@
+package rp
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/pckhoi/uma/pkg/clock"
+)
+
+// Session holds the credentials of a logged in user
+type Session struct {
+	ID          string
+	Credentials Credentials
+
+	// Expires is when the access token expires. It is zero if the token response had no expires_in.
+	Expires time.Time
+}
+
+// SessionStore keeps sessions on the server, so that tokens never reach the browser
+type SessionStore interface {
+	// Get returns the session with id. ok is false if there is no such session.
+	Get(id string) (s *Session, ok bool, err error)
+	Save(s *Session) error
+	Delete(id string) error
+}
+
+// MemorySessionStore is an in-memory SessionStore. Sessions are lost on restart and are not shared
+// between replicas.
+type MemorySessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]Session
+}
+
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{sessions: map[string]Session{}}
+}
+
+func (s *MemorySessionStore) Get(id string) (*Session, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess, ok := s.sessions[id]
+	if !ok {
+		return nil, false, nil
+	}
+	return &sess, true, nil
+}
+
+func (s *MemorySessionStore) Save(sess *Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions[sess.ID] = *sess
+	return nil
+}
+
+func (s *MemorySessionStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, id)
+	return nil
+}
+
+// SessionMiddleware logs users in for web apps that call UMA protected APIs on their behalf. Credentials
+// are kept in Store, and the browser only gets the session id in an HttpOnly cookie. Handlers down the
+// chain get the credentials of the current user with GetCredentials. The access token is refreshed when
+// it is about to expire.
+//
+//	sm := &rp.SessionMiddleware{Client: kc, RedirectURI: "https://app.example.com/callback"}
+//	http.ListenAndServe(":8080", sm.Handler(mux))
+//
+// Users log in by POSTing the username and password fields to LoginPath, or, if RedirectURI is set, by
+// visiting LoginPath, which starts the authorization code flow protected by PKCE and by a state that is
+// bound to the browser with the CookieName+"_state" cookie. Both take an optional return_to path.
+// Requests to LogoutPath end the session.
+type SessionMiddleware struct {
+	Client *KeycloakClient
+
+	// Store defaults to a MemorySessionStore
+	Store SessionStore
+
+	// RedirectURI is the absolute url of CallbackPath. The authorization code flow is only enabled
+	// if it is set.
+	RedirectURI string
+
+	// Scopes requested at the authorization endpoint. Defaults to "openid".
+	Scopes []string
+
+	// StateStore keeps the state of the authorization code flow. Defaults to a MemoryClaimsStateStore
+	// that forgets states after 10 minutes.
+	StateStore ClaimsStateStore
+
+	// LoginPath, CallbackPath and LogoutPath default to "/login", "/callback" and "/logout"
+	LoginPath    string
+	CallbackPath string
+	LogoutPath   string
+
+	// CookieName defaults to "uma_session"
+	CookieName string
+
+	// InsecureCookie leaves out the Secure attribute of the session cookie, for apps served over plain
+	// HTTP during development
+	InsecureCookie bool
+
+	// RefreshBefore is how long before expiry the access token is refreshed. Defaults to 30 seconds.
+	RefreshBefore time.Duration
+
+	// LoginRequired redirects requests without a session to LoginPath, or responds 401 to requests
+	// other than GET
+	LoginRequired bool
+
+	// Clock defaults to the system clock
+	Clock clock.Clock
+
+	once sync.Once
+}
+
+func (m *SessionMiddleware) init() {
+	m.once.Do(func() {
+		if m.Store == nil {
+			m.Store = NewMemorySessionStore()
+		}
+		if m.StateStore == nil {
+			m.StateStore = NewMemoryClaimsStateStore(10 * time.Minute)
+		}
+		if m.LoginPath == "" {
+			m.LoginPath = "/login"
+		}
+		if m.CallbackPath == "" {
+			m.CallbackPath = "/callback"
+		}
+		if m.LogoutPath == "" {
+			m.LogoutPath = "/logout"
+		}
+		if m.CookieName == "" {
+			m.CookieName = "uma_session"
+		}
+		if m.RefreshBefore == 0 {
+			m.RefreshBefore = 30 * time.Second
+		}
+	})
+}
+
+type credentialsKey struct{}
+
+// GetCredentials returns the credentials of the user logged in with SessionMiddleware, or nil
+func GetCredentials(r *http.Request) *Credentials {
+	if v := r.Context().Value(credentialsKey{}); v != nil {
+		return v.(*Credentials)
+	}
+	return nil
+}
+
+// Handler serves the login, callback and logout paths, and passes other requests to next with the
+// credentials of the session, if any
+func (m *SessionMiddleware) Handler(next http.Handler) http.Handler {
+	m.init()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case m.LoginPath:
+			m.login(w, r)
+			return
+		case m.CallbackPath:
+			if m.RedirectURI != "" {
+				m.callback(w, r)
+				return
+			}
+		case m.LogoutPath:
+			m.logout(w, r)
+			return
+		}
+		sess, err := m.session(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if sess == nil {
+			if !m.LoginRequired {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if r.Method != http.MethodGet {
+				http.Error(w, "login required", http.StatusUnauthorized)
+				return
+			}
+			http.Redirect(w, r, m.LoginPath+"?"+url.Values{"return_to": {r.URL.RequestURI()}}.Encode(), http.StatusFound)
+			return
+		}
+		creds := sess.Credentials
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), credentialsKey{}, &creds)))
+	})
+}
+
+// session returns the session of r with fresh credentials, or nil if r has no session or the session
+// can no longer be refreshed
+func (m *SessionMiddleware) session(r *http.Request) (*Session, error) {
+	c, err := r.Cookie(m.CookieName)
+	if err != nil {
+		return nil, nil
+	}
+	sess, ok, err := m.Store.Get(c.Value)
+	if err != nil || !ok {
+		return nil, err
+	}
+	now := clock.OrReal(m.Clock).Now()
+	if sess.Expires.IsZero() || now.Add(m.RefreshBefore).Before(sess.Expires) {
+		return sess, nil
+	}
+	if sess.Credentials.RefreshToken == "" {
+		return nil, m.Store.Delete(sess.ID)
+	}
+	creds, err := m.Client.RefreshCredentials(sess.Credentials)
+	if err != nil {
+		return nil, m.Store.Delete(sess.ID)
+	}
+	if creds.RefreshToken == "" {
+		creds.RefreshToken = sess.Credentials.RefreshToken
+	}
+	if creds.IDToken == "" {
+		creds.IDToken = sess.Credentials.IDToken
+	}
+	sess.Credentials = *creds
+	sess.Expires = m.expires(creds)
+	if err := m.Store.Save(sess); err != nil {
+		return nil, err
+	}
+	return sess, nil
+}
+
+func (m *SessionMiddleware) expires(creds *Credentials) time.Time {
+	if creds.ExpiresIn <= 0 {
+		return time.Time{}
+	}
+	return clock.OrReal(m.Clock).Now().Add(time.Duration(creds.ExpiresIn) * time.Second)
+}
+
+// startSession saves creds in a new session and redirects to returnTo with the session cookie
+func (m *SessionMiddleware) startSession(w http.ResponseWriter, r *http.Request, creds *Credentials, returnTo string) {
+	id, err := randomString(32)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := m.Store.Save(&Session{ID: id, Credentials: *creds, Expires: m.expires(creds)}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     m.CookieName,
+		Value:    id,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   !m.InsecureCookie,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, returnTo, http.StatusSeeOther)
+}
+
+func (m *SessionMiddleware) login(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		creds, err := m.Client.AuthenticateUserWithPassword(r.PostForm.Get("username"), r.PostForm.Get("password"))
+		if err != nil {
+			http.Error(w, "invalid username or password", http.StatusUnauthorized)
+			return
+		}
+		m.startSession(w, r, creds, localPath(r.FormValue("return_to")))
+	case http.MethodGet:
+		if m.RedirectURI == "" {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		state, err := randomString(32)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		verifier, err := randomString(32)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := m.StateStore.Save(state, PendingClaims{
+			CodeVerifier: verifier,
+			ReturnTo:     localPath(r.URL.Query().Get("return_to")),
+		}); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		setStateCookie(w, m.CookieName+"_state", state, !m.InsecureCookie)
+		w.Header().Set("Cache-Control", "no-store")
+		http.Redirect(w, r, m.Client.authCodeURL(m.RedirectURI, m.Scopes, state, verifier), http.StatusFound)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (m *SessionMiddleware) callback(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if !checkStateCookie(w, r, m.CookieName+"_state", q.Get("state"), !m.InsecureCookie) {
+		http.Error(w, "state does not belong to this browser", http.StatusBadRequest)
+		return
+	}
+	pc, ok, err := m.StateStore.Take(q.Get("state"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.Error(w, "unknown or expired state", http.StatusBadRequest)
+		return
+	}
+	if e := q.Get("error"); e != "" {
+		http.Error(w, "authorization failed: "+e, http.StatusForbidden)
+		return
+	}
+	creds, err := m.Client.exchangeCode(q.Get("code"), pc.CodeVerifier, m.RedirectURI)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	m.startSession(w, r, creds, pc.ReturnTo)
+}
+
+func (m *SessionMiddleware) logout(w http.ResponseWriter, r *http.Request) {
+	if c, err := r.Cookie(m.CookieName); err == nil {
+		if err := m.Store.Delete(c.Value); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     m.CookieName,
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   !m.InsecureCookie,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, localPath(r.FormValue("return_to")), http.StatusSeeOther)
+}
@@ -0,0 +1,174 @@
+package rp
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pckhoi/uma/pkg/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionMiddleware(t *testing.T) {
+	var issuer string
+	var refreshes int
+	mux := http.NewServeMux()
+	writeJSON := func(w http.ResponseWriter, status int, obj any) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		require.NoError(t, json.NewEncoder(w).Encode(obj))
+	}
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{
+			"issuer":                 issuer,
+			"authorization_endpoint": issuer + "/auth",
+			"token_endpoint":         issuer + "/token",
+			"jwks_uri":               issuer + "/certs",
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		switch r.PostForm.Get("grant_type") {
+		case "password":
+			if r.PostForm.Get("password") != "pass" {
+				writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_grant"})
+				return
+			}
+			writeJSON(w, http.StatusOK, map[string]any{
+				"access_token": "access-0", "id_token": "id-0", "refresh_token": "refresh-0", "expires_in": 300,
+			})
+		case "authorization_code":
+			writeJSON(w, http.StatusOK, map[string]any{"access_token": "access-code", "id_token": "id-code"})
+		case "refresh_token":
+			if r.PostForm.Get("refresh_token") == "revoked" {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+				return
+			}
+			refreshes++
+			writeJSON(w, http.StatusOK, map[string]any{
+				"access_token": fmt.Sprintf("access-%d", refreshes), "expires_in": 300,
+			})
+		}
+	})
+	s := httptest.NewServer(mux)
+	defer s.Close()
+	issuer = s.URL
+
+	kc, err := NewKeycloakClient(issuer, "webapp", "secret", s.Client())
+	require.NoError(t, err)
+	c := clock.NewFake(time.Unix(1000, 0))
+	store := NewMemorySessionStore()
+	sm := &SessionMiddleware{
+		Client:        kc,
+		Store:         store,
+		RedirectURI:   "https://app.example.com/callback",
+		LoginRequired: true,
+		Clock:         c,
+	}
+	h := sm.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		creds := GetCredentials(r)
+		fmt.Fprintf(w, "%s %s", creds.AccessToken, creds.IDToken)
+	}))
+	serve := func(method, uri string, form url.Values, cookie *http.Cookie) *httptest.ResponseRecorder {
+		var req *http.Request
+		if form != nil {
+			req = httptest.NewRequest(method, uri, strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		} else {
+			req = httptest.NewRequest(method, uri, nil)
+		}
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+	namedCookie := func(w *httptest.ResponseRecorder, name string) *http.Cookie {
+		t.Helper()
+		for _, c := range w.Result().Cookies() {
+			if c.Name == name {
+				assert.True(t, c.HttpOnly)
+				assert.True(t, c.Secure)
+				return c
+			}
+		}
+		require.Failf(t, "cookie not set", "%s in %v", name, w.Result().Cookies())
+		return nil
+	}
+	sessionCookie := func(w *httptest.ResponseRecorder) *http.Cookie {
+		t.Helper()
+		return namedCookie(w, "uma_session")
+	}
+
+	w := serve(http.MethodGet, "/users/1?a=b", nil, nil)
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "/login?return_to=%2Fusers%2F1%3Fa%3Db", w.Header().Get("Location"))
+	w = serve(http.MethodPost, "/users/1", nil, nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// password login
+	w = serve(http.MethodPost, "/login", url.Values{"username": {"johnd"}, "password": {"wrong"}}, nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = serve(http.MethodPost, "/login", url.Values{"username": {"johnd"}, "password": {"pass"}, "return_to": {"/users/1"}}, nil)
+	assert.Equal(t, http.StatusSeeOther, w.Code)
+	assert.Equal(t, "/users/1", w.Header().Get("Location"))
+	cookie := sessionCookie(w)
+	w = serve(http.MethodGet, "/users/1", nil, cookie)
+	assert.Equal(t, "access-0 id-0", w.Body.String())
+
+	// the access token is refreshed shortly before it expires, keeping the id and refresh tokens
+	c.Advance(290 * time.Second)
+	w = serve(http.MethodGet, "/users/1", nil, cookie)
+	assert.Equal(t, "access-1 id-0", w.Body.String())
+	w = serve(http.MethodGet, "/users/1", nil, cookie)
+	assert.Equal(t, "access-1 id-0", w.Body.String())
+	assert.Equal(t, 1, refreshes)
+	sess, ok, err := store.Get(cookie.Value)
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, "refresh-0", sess.Credentials.RefreshToken)
+
+	// sessions that can't be refreshed end
+	sess.Credentials.RefreshToken = "revoked"
+	sess.Expires = c.Now()
+	require.NoError(t, store.Save(sess))
+	w = serve(http.MethodGet, "/users/1", nil, cookie)
+	assert.Equal(t, http.StatusFound, w.Code)
+	_, ok, _ = store.Get(cookie.Value)
+	assert.False(t, ok)
+
+	// authorization code login
+	w = serve(http.MethodGet, "/login?return_to=/users/2", nil, nil)
+	assert.Equal(t, http.StatusFound, w.Code)
+	u, err := url.Parse(w.Header().Get("Location"))
+	require.NoError(t, err)
+	assert.Equal(t, "webapp", u.Query().Get("client_id"))
+	assert.Equal(t, "S256", u.Query().Get("code_challenge_method"))
+	stateCookie := namedCookie(w, "uma_session_state")
+	callbackURI := "/callback?" + url.Values{"state": {u.Query().Get("state")}, "code": {"c"}}.Encode()
+	// the callback must come from the browser that started the flow
+	w = serve(http.MethodGet, callbackURI, nil, nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = serve(http.MethodGet, callbackURI, nil, &http.Cookie{Name: "uma_session_state", Value: "forged"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = serve(http.MethodGet, callbackURI, nil, stateCookie)
+	assert.Equal(t, http.StatusSeeOther, w.Code)
+	assert.Equal(t, -1, namedCookie(w, "uma_session_state").MaxAge)
+	assert.Equal(t, "/users/2", w.Header().Get("Location"))
+	cookie = sessionCookie(w)
+	w = serve(http.MethodGet, "/users/2", nil, cookie)
+	assert.Equal(t, "access-code id-code", w.Body.String())
+
+	w = serve(http.MethodGet, "/logout", nil, cookie)
+	assert.Equal(t, http.StatusSeeOther, w.Code)
+	assert.Equal(t, -1, sessionCookie(w).MaxAge)
+	w = serve(http.MethodGet, "/users/2", nil, cookie)
+	assert.Equal(t, http.StatusFound, w.Code)
+}
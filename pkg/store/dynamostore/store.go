@@ -0,0 +1,251 @@
+// Package dynamostore implements uma.ResourceStore with DynamoDB, for resource servers running on AWS
+// Lambda or other serverless platforms. It talks to the DynamoDB JSON API with requests signed by itself,
+// so it doesn't depend on the AWS SDK.
+//
+// The table needs a partition key named "pk" of type string. Enable time to live on the "expires_at"
+// attribute to have DynamoDB clean up expired tombstones.
+package dynamostore
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pckhoi/uma"
+	"github.com/pckhoi/uma/pkg/clock"
+	"github.com/pckhoi/uma/pkg/httputil"
+)
+
+const targetPrefix = "DynamoDB_20120810."
+
+// Options configures a Store
+type Options struct {
+	Table       string
+	Region      string
+	Credentials Credentials
+
+	// Endpoint defaults to https://dynamodb.<Region>.amazonaws.com. Set it to e.g.
+	// http://localhost:8000 to use DynamoDB local.
+	Endpoint string
+
+	// HTTPClient defaults to http.DefaultClient
+	HTTPClient *http.Client
+
+	// Clock defaults to the real clock
+	Clock clock.Clock
+}
+
+// Store is an uma.ResourceStore backed by a DynamoDB table. Ids are written with a condition that the name
+// has no other id yet, so replicas that register the same resource concurrently agree on one id. It also
+// implements uma.ResourceStoreDeleter, uma.ResourceHashStore, uma.ResourceTombstoneStore and
+// uma.ResourceStoreLister.
+type Store struct {
+	opts Options
+}
+
+// New returns a Store with opts
+func New(opts Options) *Store {
+	if opts.Endpoint == "" {
+		opts.Endpoint = "https://dynamodb." + opts.Region + ".amazonaws.com"
+	}
+	opts.Endpoint = strings.TrimSuffix(opts.Endpoint, "/")
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = http.DefaultClient
+	}
+	opts.Clock = clock.OrReal(opts.Clock)
+	return &Store{opts: opts}
+}
+
+// ErrAPI is returned when DynamoDB responds with an error, e.g. "ResourceNotFoundException" if the table
+// doesn't exist
+type ErrAPI struct {
+	Type    string
+	Message string
+}
+
+func (err ErrAPI) Error() string {
+	return fmt.Sprintf("dynamodb: %s: %s", err.Type, err.Message)
+}
+
+// attr is an attribute value of the DynamoDB JSON API
+type attr map[string]string
+
+func str(s string) attr {
+	return attr{"S": s}
+}
+
+type item map[string]attr
+
+// idPrefix starts the partition keys of items holding ids
+const idPrefix = "rsc#"
+
+func idKey(name string) item {
+	return item{"pk": str(idPrefix + name)}
+}
+
+func tombstoneKey(name string) item {
+	return item{"pk": str("tombstone#" + name)}
+}
+
+// call invokes operation with req and decodes the response into resp
+func (s *Store) call(operation string, req map[string]interface{}, resp interface{}) error {
+	req["TableName"] = s.opts.Table
+	b, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	r, err := http.NewRequest(http.MethodPost, s.opts.Endpoint+"/", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	r.Header.Set("Content-Type", "application/x-amz-json-1.0")
+	r.Header.Set("X-Amz-Target", targetPrefix+operation)
+	sign(r, b, s.opts.Credentials, s.opts.Region, "dynamodb", s.opts.Clock.Now())
+	res, err := s.opts.HTTPClient.Do(r)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode == http.StatusBadRequest {
+		defer res.Body.Close()
+		apiErr := struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}{}
+		if err := json.NewDecoder(res.Body).Decode(&apiErr); err != nil {
+			return err
+		}
+		// types are namespaced e.g. "com.amazonaws.dynamodb.v20120810#ConditionalCheckFailedException"
+		typ := apiErr.Type[strings.LastIndex(apiErr.Type, "#")+1:]
+		return ErrAPI{Type: typ, Message: apiErr.Message}
+	}
+	if res.StatusCode != http.StatusOK {
+		return httputil.NewErrUnanticipatedResponse(res)
+	}
+	defer res.Body.Close()
+	if resp == nil {
+		return nil
+	}
+	return json.NewDecoder(res.Body).Decode(resp)
+}
+
+// getItem returns the item of key, or nil if there is none. Reads are strongly consistent, so that ids
+// written by other replicas are seen right away.
+func (s *Store) getItem(key item) (item, error) {
+	resp := struct {
+		Item item `json:"Item"`
+	}{}
+	if err := s.call("GetItem", map[string]interface{}{
+		"Key":            key,
+		"ConsistentRead": true,
+	}, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Item, nil
+}
+
+func (s *Store) Get(name string) (string, error) {
+	it, err := s.getItem(idKey(name))
+	if err != nil {
+		return "", err
+	}
+	return it["id"]["S"], nil
+}
+
+// Set stores id unless name already has another id, in which case it returns
+// uma.ErrStoredResourceConflict with the stored id
+func (s *Store) Set(name, id string) error {
+	err := s.call("UpdateItem", map[string]interface{}{
+		"Key":                       idKey(name),
+		"UpdateExpression":          "SET #id = :id",
+		"ConditionExpression":       "attribute_not_exists(#id) OR #id = :id",
+		"ExpressionAttributeNames":  map[string]string{"#id": "id"},
+		"ExpressionAttributeValues": item{":id": str(id)},
+	}, nil)
+	if apiErr, ok := err.(ErrAPI); !ok || apiErr.Type != "ConditionalCheckFailedException" {
+		return err
+	}
+	stored, err := s.Get(name)
+	if err != nil {
+		return err
+	}
+	return uma.ErrStoredResourceConflict{Name: name, ID: stored}
+}
+
+// List scans the table for ids, following pages until the last one
+func (s *Store) List() (map[string]string, error) {
+	ids := map[string]string{}
+	var startKey item
+	for {
+		req := map[string]interface{}{
+			"FilterExpression":          "begins_with(pk, :prefix) AND attribute_exists(#id)",
+			"ExpressionAttributeNames":  map[string]string{"#id": "id"},
+			"ExpressionAttributeValues": item{":prefix": str(idPrefix)},
+			"ConsistentRead":            true,
+		}
+		if startKey != nil {
+			req["ExclusiveStartKey"] = startKey
+		}
+		resp := struct {
+			Items            []item `json:"Items"`
+			LastEvaluatedKey item   `json:"LastEvaluatedKey"`
+		}{}
+		if err := s.call("Scan", req, &resp); err != nil {
+			return nil, err
+		}
+		for _, it := range resp.Items {
+			ids[strings.TrimPrefix(it["pk"]["S"], idPrefix)] = it["id"]["S"]
+		}
+		if resp.LastEvaluatedKey == nil {
+			return ids, nil
+		}
+		startKey = resp.LastEvaluatedKey
+	}
+}
+
+// Delete removes the id and the hash of name
+func (s *Store) Delete(name string) error {
+	return s.call("DeleteItem", map[string]interface{}{"Key": idKey(name)}, nil)
+}
+
+// SetHash sets the hash on the item of the id, creating it if needed
+func (s *Store) SetHash(name, hash string) error {
+	return s.call("UpdateItem", map[string]interface{}{
+		"Key":                       idKey(name),
+		"UpdateExpression":          "SET #hash = :hash",
+		"ExpressionAttributeNames":  map[string]string{"#hash": "hash"},
+		"ExpressionAttributeValues": item{":hash": str(hash)},
+	}, nil)
+}
+
+func (s *Store) GetHash(name string) (string, error) {
+	it, err := s.getItem(idKey(name))
+	if err != nil {
+		return "", err
+	}
+	return it["hash"]["S"], nil
+}
+
+// Tombstone puts the tombstone of name, which expires after ttl
+func (s *Store) Tombstone(name string, ttl time.Duration) error {
+	it := tombstoneKey(name)
+	it["expires_at"] = attr{"N": strconv.FormatInt(s.opts.Clock.Now().Add(ttl).Unix(), 10)}
+	return s.call("PutItem", map[string]interface{}{"Item": it}, nil)
+}
+
+// Tombstoned reports whether name has a tombstone that hasn't expired. Since DynamoDB deletes expired
+// items up to a few days late, expires_at is checked as well.
+func (s *Store) Tombstoned(name string) (bool, error) {
+	it, err := s.getItem(tombstoneKey(name))
+	if err != nil || it == nil {
+		return false, err
+	}
+	expiresAt, err := strconv.ParseInt(it["expires_at"]["N"], 10, 64)
+	if err != nil {
+		return false, err
+	}
+	return s.opts.Clock.Now().Unix() < expiresAt, nil
+}
@@ -0,0 +1,159 @@
+package dynamostore
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pckhoi/uma"
+	"github.com/pckhoi/uma/pkg/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeDynamo serves the operations and expressions that Store uses
+type fakeDynamo struct {
+	mu    sync.Mutex
+	items map[string]item
+}
+
+func (f *fakeDynamo) handler(t *testing.T) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		require.True(t, strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/"))
+		req := struct {
+			TableName                 string
+			Key                       item
+			Item                      item
+			UpdateExpression          string
+			ConditionExpression       string
+			ExpressionAttributeValues item
+			ExclusiveStartKey         item
+		}{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		require.Equal(t, "resources", req.TableName)
+		w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+		var resp interface{} = map[string]interface{}{}
+		switch strings.TrimPrefix(r.Header.Get("X-Amz-Target"), targetPrefix) {
+		case "GetItem":
+			if it, ok := f.items[req.Key["pk"]["S"]]; ok {
+				resp = map[string]interface{}{"Item": it}
+			}
+		case "PutItem":
+			f.items[req.Item["pk"]["S"]] = req.Item
+		case "Scan":
+			// one item per page
+			items := []item{}
+			for pk, it := range f.items {
+				if strings.HasPrefix(pk, idPrefix) && (req.ExclusiveStartKey == nil || pk > req.ExclusiveStartKey["pk"]["S"]) {
+					if len(items) == 0 || pk < items[0]["pk"]["S"] {
+						items = []item{it}
+					}
+				}
+			}
+			page := map[string]interface{}{"Items": items}
+			if len(items) > 0 {
+				page["LastEvaluatedKey"] = item{"pk": items[0]["pk"]}
+			}
+			resp = page
+		case "DeleteItem":
+			delete(f.items, req.Key["pk"]["S"])
+		case "UpdateItem":
+			pk := req.Key["pk"]["S"]
+			it, ok := f.items[pk]
+			if !ok {
+				it = item{"pk": req.Key["pk"]}
+			}
+			if req.UpdateExpression == "SET #id = :id" {
+				if id, ok := it["id"]; ok && id["S"] != req.ExpressionAttributeValues[":id"]["S"] {
+					w.WriteHeader(http.StatusBadRequest)
+					json.NewEncoder(w).Encode(map[string]string{
+						"__type":  "com.amazonaws.dynamodb.v20120810#ConditionalCheckFailedException",
+						"message": "The conditional request failed",
+					})
+					return
+				}
+				it["id"] = req.ExpressionAttributeValues[":id"]
+			} else {
+				it["hash"] = req.ExpressionAttributeValues[":hash"]
+			}
+			f.items[pk] = it
+		default:
+			t.Fatalf("unexpected target %q", r.Header.Get("X-Amz-Target"))
+		}
+		json.NewEncoder(w).Encode(resp)
+	})
+}
+
+func TestStore(t *testing.T) {
+	f := &fakeDynamo{items: map[string]item{}}
+	srv := httptest.NewServer(f.handler(t))
+	defer srv.Close()
+	c := clock.NewFake(time.Now())
+	s := New(Options{
+		Table:       "resources",
+		Region:      "us-east-1",
+		Credentials: Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret"},
+		Endpoint:    srv.URL,
+		HTTPClient:  srv.Client(),
+		Clock:       c,
+	})
+
+	id, err := s.Get("User 1")
+	require.NoError(t, err)
+	assert.Empty(t, id)
+	require.NoError(t, s.Set("User 1", "id-1"))
+	id, err = s.Get("User 1")
+	require.NoError(t, err)
+	assert.Equal(t, "id-1", id)
+
+	// the first replica to store an id wins
+	require.NoError(t, s.Set("User 1", "id-1"))
+	assert.Equal(t, uma.ErrStoredResourceConflict{Name: "User 1", ID: "id-1"}, s.Set("User 1", "id-2"))
+
+	require.NoError(t, s.Set("User 2", "id-2"))
+	require.NoError(t, s.Tombstone("User 3", time.Minute))
+	ids, err := s.List()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"User 1": "id-1", "User 2": "id-2"}, ids)
+	require.NoError(t, s.Delete("User 2"))
+	delete(f.items, "tombstone#User 3")
+
+	require.NoError(t, s.SetHash("User 1", "abc"))
+	hash, err := s.GetHash("User 1")
+	require.NoError(t, err)
+	assert.Equal(t, "abc", hash)
+	id, _ = s.Get("User 1")
+	assert.Equal(t, "id-1", id)
+	require.NoError(t, s.Delete("User 1"))
+	assert.Empty(t, f.items)
+
+	require.NoError(t, s.Tombstone("User 1", time.Minute))
+	dead, err := s.Tombstoned("User 1")
+	require.NoError(t, err)
+	assert.True(t, dead)
+	// expired tombstones may linger until DynamoDB deletes them
+	c.Advance(time.Minute)
+	dead, err = s.Tombstoned("User 1")
+	require.NoError(t, err)
+	assert.False(t, dead)
+	dead, err = s.Tombstoned("User 2")
+	require.NoError(t, err)
+	assert.False(t, dead)
+}
+
+func TestStoreAPIError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"__type":"com.amazonaws.dynamodb.v20120810#ResourceNotFoundException","message":"Requested resource not found"}`))
+	}))
+	defer srv.Close()
+	s := New(Options{Table: "resources", Region: "us-east-1", Endpoint: srv.URL})
+	_, err := s.Get("User 1")
+	assert.Equal(t, ErrAPI{Type: "ResourceNotFoundException", Message: "Requested resource not found"}, err)
+}
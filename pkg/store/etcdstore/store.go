@@ -0,0 +1,223 @@
+// Package etcdstore implements uma.ResourceStore with etcd, for resource servers on Kubernetes that
+// don't have a database of their own. It talks to the JSON gateway of the etcd v3 API, which etcd serves
+// on its client port since v3.4, so it doesn't depend on the etcd client library.
+package etcdstore
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pckhoi/uma"
+	"github.com/pckhoi/uma/pkg/httputil"
+)
+
+// Store is an uma.ResourceStore backed by etcd. Ids are written in transactions that only succeed if the
+// name has no id yet, so replicas that register the same resource concurrently agree on one id. It also
+// implements uma.ResourceStoreDeleter, uma.ResourceHashStore, uma.ResourceTombstoneStore and
+// uma.ResourceStoreLister, tombstones being attached to leases that etcd revokes when they expire.
+type Store struct {
+	endpoint string
+	prefix   string
+	client   *http.Client
+}
+
+// New returns a Store that talks to the etcd client URL endpoint, e.g. "https://etcd:2379", and stores
+// entries under keys prefixed with prefix. client defaults to http.DefaultClient, use a client with TLS
+// certificates or a transport that sets the Authorization header if etcd requires them.
+func New(endpoint, prefix string, client *http.Client) *Store {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Store{
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		prefix:   prefix,
+		client:   client,
+	}
+}
+
+func (s *Store) idKey(name string) string {
+	return s.prefix + "ids/" + name
+}
+
+func (s *Store) hashKey(name string) string {
+	return s.prefix + "hashes/" + name
+}
+
+func (s *Store) tombstoneKey(name string) string {
+	return s.prefix + "tombstones/" + name
+}
+
+// b64 encodes keys and values, which are bytes in the etcd API
+func b64(s string) string {
+	return base64.StdEncoding.EncodeToString([]byte(s))
+}
+
+type keyValue struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type rangeResponse struct {
+	Kvs []keyValue `json:"kvs"`
+}
+
+// value returns the decoded value of the first key of resp, or an empty string if there is none
+func (resp rangeResponse) value() (string, error) {
+	if len(resp.Kvs) == 0 {
+		return "", nil
+	}
+	b, err := base64.StdEncoding.DecodeString(resp.Kvs[0].Value)
+	return string(b), err
+}
+
+// call posts req to the gateway endpoint at path and decodes the response into resp
+func (s *Store) call(path string, req, resp interface{}) error {
+	b, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	res, err := s.client.Post(s.endpoint+path, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	if res.StatusCode != http.StatusOK {
+		return httputil.NewErrUnanticipatedResponse(res)
+	}
+	defer res.Body.Close()
+	if resp == nil {
+		return nil
+	}
+	return json.NewDecoder(res.Body).Decode(resp)
+}
+
+func (s *Store) get(key string) (string, error) {
+	resp := rangeResponse{}
+	if err := s.call("/v3/kv/range", map[string]string{"key": b64(key)}, &resp); err != nil {
+		return "", err
+	}
+	return resp.value()
+}
+
+func (s *Store) put(key, value string) error {
+	return s.call("/v3/kv/put", map[string]string{"key": b64(key), "value": b64(value)}, nil)
+}
+
+func (s *Store) Get(name string) (string, error) {
+	return s.get(s.idKey(name))
+}
+
+// Set stores id unless name already has another id, in which case it returns
+// uma.ErrStoredResourceConflict with the stored id
+func (s *Store) Set(name, id string) error {
+	key := b64(s.idKey(name))
+	resp := struct {
+		Succeeded bool `json:"succeeded"`
+		Responses []struct {
+			ResponseRange rangeResponse `json:"response_range"`
+		} `json:"responses"`
+	}{}
+	if err := s.call("/v3/kv/txn", map[string]interface{}{
+		"compare": []map[string]interface{}{
+			{"target": "CREATE", "result": "EQUAL", "key": key, "create_revision": "0"},
+		},
+		"success": []map[string]interface{}{
+			{"request_put": map[string]string{"key": key, "value": b64(id)}},
+		},
+		"failure": []map[string]interface{}{
+			{"request_range": map[string]string{"key": key}},
+		},
+	}, &resp); err != nil {
+		return err
+	}
+	if resp.Succeeded {
+		return nil
+	}
+	if len(resp.Responses) == 0 {
+		return fmt.Errorf("etcd transaction on %q failed without response", name)
+	}
+	stored, err := resp.Responses[0].ResponseRange.value()
+	if err != nil {
+		return err
+	}
+	if stored == id {
+		return nil
+	}
+	return uma.ErrStoredResourceConflict{Name: name, ID: stored}
+}
+
+// List returns every id stored under the prefix
+func (s *Store) List() (map[string]string, error) {
+	prefix := s.idKey("")
+	// the range of keys with the prefix ends at the prefix with its last byte incremented
+	end := []byte(prefix)
+	end[len(end)-1]++
+	resp := rangeResponse{}
+	if err := s.call("/v3/kv/range", map[string]string{
+		"key":       b64(prefix),
+		"range_end": base64.StdEncoding.EncodeToString(end),
+	}, &resp); err != nil {
+		return nil, err
+	}
+	ids := make(map[string]string, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		key, err := base64.StdEncoding.DecodeString(kv.Key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := base64.StdEncoding.DecodeString(kv.Value)
+		if err != nil {
+			return nil, err
+		}
+		ids[strings.TrimPrefix(string(key), prefix)] = string(value)
+	}
+	return ids, nil
+}
+
+// Delete removes the id and the hash of name
+func (s *Store) Delete(name string) error {
+	for _, key := range []string{s.idKey(name), s.hashKey(name)} {
+		if err := s.call("/v3/kv/deleterange", map[string]string{"key": b64(key)}, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Store) SetHash(name, hash string) error {
+	return s.put(s.hashKey(name), hash)
+}
+
+func (s *Store) GetHash(name string) (string, error) {
+	return s.get(s.hashKey(name))
+}
+
+// Tombstone puts the tombstone of name with a lease of ttl, rounded up to the second
+func (s *Store) Tombstone(name string, ttl time.Duration) error {
+	lease := struct {
+		ID string `json:"ID"`
+	}{}
+	if err := s.call("/v3/lease/grant", map[string]int64{
+		"TTL": int64(math.Max(1, math.Ceil(ttl.Seconds()))),
+	}, &lease); err != nil {
+		return err
+	}
+	return s.call("/v3/kv/put", map[string]string{
+		"key":   b64(s.tombstoneKey(name)),
+		"value": b64(time.Now().UTC().Format(time.RFC3339)),
+		"lease": lease.ID,
+	}, nil)
+}
+
+func (s *Store) Tombstoned(name string) (bool, error) {
+	resp := rangeResponse{}
+	if err := s.call("/v3/kv/range", map[string]string{"key": b64(s.tombstoneKey(name))}, &resp); err != nil {
+		return false, err
+	}
+	return len(resp.Kvs) > 0, nil
+}
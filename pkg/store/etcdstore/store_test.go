@@ -0,0 +1,150 @@
+package etcdstore
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pckhoi/uma"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeEtcd serves the parts of the JSON gateway that Store uses
+type fakeEtcd struct {
+	mu     sync.Mutex
+	kvs    map[string]string
+	leases map[string]string
+}
+
+func decode(t *testing.T, s string) string {
+	b, err := base64.StdEncoding.DecodeString(s)
+	require.NoError(t, err)
+	return string(b)
+}
+
+func (f *fakeEtcd) rangeResponse(key string) map[string]interface{} {
+	v, ok := f.kvs[key]
+	if !ok {
+		return map[string]interface{}{}
+	}
+	return map[string]interface{}{"kvs": []map[string]string{{"key": b64(key), "value": b64(v)}}}
+}
+
+func (f *fakeEtcd) handler(t *testing.T) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		req := map[string]json.RawMessage{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		str := func(name string) string {
+			var s string
+			json.Unmarshal(req[name], &s)
+			return s
+		}
+		var resp interface{} = map[string]interface{}{}
+		switch r.URL.Path {
+		case "/v3/kv/range":
+			key := decode(t, str("key"))
+			if end := str("range_end"); end != "" {
+				kvs := []map[string]string{}
+				for k, v := range f.kvs {
+					if k >= key && k < decode(t, end) {
+						kvs = append(kvs, map[string]string{"key": b64(k), "value": b64(v)})
+					}
+				}
+				resp = map[string]interface{}{"kvs": kvs}
+			} else {
+				resp = f.rangeResponse(key)
+			}
+		case "/v3/kv/put":
+			key := decode(t, str("key"))
+			f.kvs[key] = decode(t, str("value"))
+			if lease := str("lease"); lease != "" {
+				f.leases[key] = lease
+			}
+		case "/v3/kv/deleterange":
+			delete(f.kvs, decode(t, str("key")))
+		case "/v3/kv/txn":
+			txn := struct {
+				Compare []struct {
+					Target string `json:"target"`
+					Key    string `json:"key"`
+				} `json:"compare"`
+				Success []struct {
+					RequestPut map[string]string `json:"request_put"`
+				} `json:"success"`
+			}{}
+			require.NoError(t, json.Unmarshal(mustMarshal(t, req), &txn))
+			require.Equal(t, "CREATE", txn.Compare[0].Target)
+			key := decode(t, txn.Compare[0].Key)
+			if _, ok := f.kvs[key]; ok {
+				resp = map[string]interface{}{"responses": []interface{}{
+					map[string]interface{}{"response_range": f.rangeResponse(key)},
+				}}
+			} else {
+				f.kvs[key] = decode(t, txn.Success[0].RequestPut["value"])
+				resp = map[string]interface{}{"succeeded": true}
+			}
+		case "/v3/lease/grant":
+			resp = map[string]string{"ID": "7587", "TTL": "60"}
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	})
+}
+
+func mustMarshal(t *testing.T, v interface{}) []byte {
+	b, err := json.Marshal(v)
+	require.NoError(t, err)
+	return b
+}
+
+func TestStore(t *testing.T) {
+	f := &fakeEtcd{kvs: map[string]string{}, leases: map[string]string{}}
+	srv := httptest.NewServer(f.handler(t))
+	defer srv.Close()
+	s := New(srv.URL, "/uma/", srv.Client())
+
+	id, err := s.Get("User 1")
+	require.NoError(t, err)
+	assert.Empty(t, id)
+	require.NoError(t, s.Set("User 1", "id-1"))
+	assert.Equal(t, "id-1", f.kvs["/uma/ids/User 1"])
+	id, err = s.Get("User 1")
+	require.NoError(t, err)
+	assert.Equal(t, "id-1", id)
+
+	// the first replica to store an id wins
+	require.NoError(t, s.Set("User 1", "id-1"))
+	assert.Equal(t, uma.ErrStoredResourceConflict{Name: "User 1", ID: "id-1"}, s.Set("User 1", "id-2"))
+
+	require.NoError(t, s.Set("User 2", "id-2"))
+	ids, err := s.List()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"User 1": "id-1", "User 2": "id-2"}, ids)
+	require.NoError(t, s.Delete("User 2"))
+
+	require.NoError(t, s.SetHash("User 1", "abc"))
+	hash, err := s.GetHash("User 1")
+	require.NoError(t, err)
+	assert.Equal(t, "abc", hash)
+	require.NoError(t, s.Delete("User 1"))
+	assert.Empty(t, f.kvs)
+
+	dead, err := s.Tombstoned("User 1")
+	require.NoError(t, err)
+	assert.False(t, dead)
+	require.NoError(t, s.Tombstone("User 1", time.Minute))
+	assert.Equal(t, "7587", f.leases["/uma/tombstones/User 1"])
+	dead, err = s.Tombstoned("User 1")
+	require.NoError(t, err)
+	assert.True(t, dead)
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package filestore
+
+// lockFile doesn't lock anything on systems without flock, where Store only serializes goroutines of one
+// process
+func lockFile(path string, exclusive bool) (unlock func(), err error) {
+	return func() {}, nil
+}
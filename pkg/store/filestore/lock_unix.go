@@ -0,0 +1,37 @@
+//go:build unix
+
+package filestore
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile takes an advisory lock on the file at path, which is created if needed. The lock is exclusive
+// if exclusive is true, shared otherwise. If the file doesn't exist and the lock is shared, no lock is
+// taken since there is nothing to read yet.
+func lockFile(path string, exclusive bool) (unlock func(), err error) {
+	flag := os.O_RDWR
+	if exclusive {
+		flag |= os.O_CREATE
+	}
+	f, err := os.OpenFile(path, flag, 0o600)
+	if os.IsNotExist(err) {
+		return func() {}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	how := syscall.LOCK_SH
+	if exclusive {
+		how = syscall.LOCK_EX
+	}
+	if err := syscall.Flock(int(f.Fd()), how); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return func() {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
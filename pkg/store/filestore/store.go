@@ -0,0 +1,254 @@
+// Package filestore implements uma.ResourceStore with a JSON file, giving single-node deployments such as
+// development machines and edge devices persistence without a database.
+package filestore
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pckhoi/uma"
+	"github.com/pckhoi/uma/pkg/clock"
+)
+
+// Store is an uma.ResourceStore that keeps entries in a JSON file. Writes go to a temporary file that is
+// synced and renamed over the file, so that a crash never leaves a partial file behind. Processes sharing
+// the file are serialized by a lock on a sibling file with the ".lock" suffix, which is advisory and only
+// taken on unix systems; elsewhere only goroutines of one process are serialized.
+//
+// Like the stores of etcdstore and dynamostore, an id is only written if the name has none yet. Store also
+// implements uma.ResourceStoreDeleter, uma.ResourceHashStore, uma.ResourceTombstoneStore and
+// uma.ResourceStoreLister. Expired tombstones are removed whenever the file is written.
+type Store struct {
+	path  string
+	clock clock.Clock
+
+	mu sync.Mutex
+	// data is the content of the file described by info, kept to spare reads of unchanged files
+	data *fileData
+	info fs.FileInfo
+}
+
+type entry struct {
+	ID   string `json:"id,omitempty"`
+	Hash string `json:"hash,omitempty"`
+}
+
+type fileData struct {
+	Resources  map[string]entry     `json:"resources"`
+	Tombstones map[string]time.Time `json:"tombstones,omitempty"`
+}
+
+// New returns a Store that keeps entries in the file at path. The file and its directory are created on
+// the first write. Tombstones expire according to c, which defaults to the real clock if nil.
+func New(path string, c clock.Clock) *Store {
+	return &Store{path: path, clock: clock.OrReal(c)}
+}
+
+// read returns the content of the file. The caller must hold s.mu and the file lock.
+func (s *Store) read() (*fileData, error) {
+	info, err := os.Stat(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &fileData{Resources: map[string]entry{}}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	// every write replaces the file, so an unchanged file is the same file
+	if s.info != nil && os.SameFile(s.info, info) && s.info.ModTime().Equal(info.ModTime()) {
+		return s.data, nil
+	}
+	b, err := os.ReadFile(s.path)
+	if err != nil {
+		return nil, err
+	}
+	data := &fileData{}
+	if err := json.Unmarshal(b, data); err != nil {
+		return nil, err
+	}
+	if data.Resources == nil {
+		data.Resources = map[string]entry{}
+	}
+	s.data, s.info = data, info
+	return data, nil
+}
+
+// write replaces the file with data. The caller must hold s.mu and the file lock.
+func (s *Store) write(data *fileData) error {
+	now := s.clock.Now()
+	for name, expiry := range data.Tombstones {
+		if !now.Before(expiry) {
+			delete(data.Tombstones, name)
+		}
+	}
+	b, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(s.path)
+	f, err := os.CreateTemp(dir, filepath.Base(s.path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(f.Name(), s.path); err != nil {
+		return err
+	}
+	// the rename is only durable once the directory is synced
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	s.data, s.info = nil, nil
+	return nil
+}
+
+// view calls f with the content of the file under a shared lock
+func (s *Store) view(f func(data *fileData) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	unlock, err := lockFile(s.path+".lock", false)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	data, err := s.read()
+	if err != nil {
+		return err
+	}
+	return f(data)
+}
+
+// update calls f with a copy of the content of the file under an exclusive lock, and writes the copy back
+// if f returns true
+func (s *Store) update(f func(data *fileData) (bool, error)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o700); err != nil {
+		return err
+	}
+	unlock, err := lockFile(s.path+".lock", true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	data, err := s.read()
+	if err != nil {
+		return err
+	}
+	cp := &fileData{Resources: make(map[string]entry, len(data.Resources))}
+	for k, v := range data.Resources {
+		cp.Resources[k] = v
+	}
+	if len(data.Tombstones) > 0 {
+		cp.Tombstones = make(map[string]time.Time, len(data.Tombstones))
+		for k, v := range data.Tombstones {
+			cp.Tombstones[k] = v
+		}
+	}
+	changed, err := f(cp)
+	if err != nil || !changed {
+		return err
+	}
+	return s.write(cp)
+}
+
+func (s *Store) Get(name string) (id string, err error) {
+	err = s.view(func(data *fileData) error {
+		id = data.Resources[name].ID
+		return nil
+	})
+	return
+}
+
+// Set stores id unless name already has another id, in which case it returns
+// uma.ErrStoredResourceConflict with the stored id
+func (s *Store) Set(name, id string) error {
+	return s.update(func(data *fileData) (bool, error) {
+		e := data.Resources[name]
+		if e.ID == id {
+			return false, nil
+		}
+		if e.ID != "" {
+			return false, uma.ErrStoredResourceConflict{Name: name, ID: e.ID}
+		}
+		e.ID = id
+		data.Resources[name] = e
+		return true, nil
+	})
+}
+
+func (s *Store) List() (ids map[string]string, err error) {
+	err = s.view(func(data *fileData) error {
+		ids = make(map[string]string, len(data.Resources))
+		for name, e := range data.Resources {
+			if e.ID != "" {
+				ids[name] = e.ID
+			}
+		}
+		return nil
+	})
+	return
+}
+
+// Delete removes the id and the hash of name
+func (s *Store) Delete(name string) error {
+	return s.update(func(data *fileData) (bool, error) {
+		if _, ok := data.Resources[name]; !ok {
+			return false, nil
+		}
+		delete(data.Resources, name)
+		return true, nil
+	})
+}
+
+func (s *Store) SetHash(name, hash string) error {
+	return s.update(func(data *fileData) (bool, error) {
+		e := data.Resources[name]
+		e.Hash = hash
+		data.Resources[name] = e
+		return true, nil
+	})
+}
+
+func (s *Store) GetHash(name string) (hash string, err error) {
+	err = s.view(func(data *fileData) error {
+		hash = data.Resources[name].Hash
+		return nil
+	})
+	return
+}
+
+func (s *Store) Tombstone(name string, ttl time.Duration) error {
+	return s.update(func(data *fileData) (bool, error) {
+		if data.Tombstones == nil {
+			data.Tombstones = map[string]time.Time{}
+		}
+		data.Tombstones[name] = s.clock.Now().Add(ttl)
+		return true, nil
+	})
+}
+
+func (s *Store) Tombstoned(name string) (dead bool, err error) {
+	err = s.view(func(data *fileData) error {
+		expiry, ok := data.Tombstones[name]
+		dead = ok && s.clock.Now().Before(expiry)
+		return nil
+	})
+	return
+}
@@ -0,0 +1,103 @@
+package filestore
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pckhoi/uma"
+	"github.com/pckhoi/uma/pkg/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "uma", "resources.json")
+	c := clock.NewFake(time.Now())
+	s := New(path, c)
+
+	id, err := s.Get("User 1")
+	require.NoError(t, err)
+	assert.Empty(t, id)
+	require.NoError(t, s.Set("User 1", "id-1"))
+	require.NoError(t, s.SetHash("User 1", "abc"))
+	require.NoError(t, s.Set("User 1", "id-1"))
+	assert.Equal(t, uma.ErrStoredResourceConflict{Name: "User 1", ID: "id-1"}, s.Set("User 1", "id-2"))
+
+	// entries survive restarts
+	s = New(path, c)
+	id, err = s.Get("User 1")
+	require.NoError(t, err)
+	assert.Equal(t, "id-1", id)
+	hash, err := s.GetHash("User 1")
+	require.NoError(t, err)
+	assert.Equal(t, "abc", hash)
+	ids, err := s.List()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"User 1": "id-1"}, ids)
+	require.NoError(t, s.Delete("User 1"))
+	id, _ = s.Get("User 1")
+	assert.Empty(t, id)
+
+	require.NoError(t, s.Tombstone("User 1", time.Minute))
+	dead, err := s.Tombstoned("User 1")
+	require.NoError(t, err)
+	assert.True(t, dead)
+	c.Advance(time.Minute)
+	dead, _ = s.Tombstoned("User 1")
+	assert.False(t, dead)
+	// expired tombstones are removed on the next write
+	require.NoError(t, s.Set("User 2", "id-2"))
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(b), "tombstones")
+
+	// no temporary file is left behind
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	names := []string{}
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	assert.ElementsMatch(t, []string{"resources.json", "resources.json.lock"}, names)
+}
+
+func TestStoreConcurrentSet(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "resources.json")
+	// two stores stand for two processes sharing the file
+	stores := []*Store{New(path, nil), New(path, nil)}
+	var mu sync.Mutex
+	winners := []string{}
+	stored := map[string]bool{}
+	wg := sync.WaitGroup{}
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			id := fmt.Sprintf("id-%d", i)
+			err := stores[i%2].Set("User 1", id)
+			mu.Lock()
+			defer mu.Unlock()
+			var conflict uma.ErrStoredResourceConflict
+			if errors.As(err, &conflict) {
+				stored[conflict.ID] = true
+				return
+			}
+			assert.NoError(t, err)
+			winners = append(winners, id)
+		}(i)
+	}
+	wg.Wait()
+	require.Len(t, winners, 1)
+	delete(stored, winners[0])
+	assert.Empty(t, stored)
+	for _, s := range stores {
+		id, err := s.Get("User 1")
+		require.NoError(t, err)
+		assert.Equal(t, winners[0], id)
+	}
+}
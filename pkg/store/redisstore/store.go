@@ -0,0 +1,140 @@
+// Package redisstore implements uma.ResourceStore with Redis
+package redisstore
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pckhoi/uma"
+	"github.com/pckhoi/uma/pkg/clock"
+	"github.com/redis/go-redis/v9"
+)
+
+// Store is an uma.ResourceStore backed by Redis. Ids are written with SETNX, so replicas that register the
+// same resource concurrently agree on one id. It also implements uma.ResourceStoreDeleter,
+// uma.ResourceHashStore, uma.ResourceTombstoneStore and uma.ResourceStoreLister, tombstones being keys
+// that expire.
+type Store struct {
+	client redis.UniversalClient
+	prefix string
+	clock  clock.Clock
+}
+
+// New returns a Store that stores entries under keys prefixed with prefix. Tombstones record the time
+// of deletion according to c, which defaults to the real clock if nil.
+func New(client redis.UniversalClient, prefix string, c clock.Clock) *Store {
+	return &Store{
+		client: client,
+		prefix: prefix,
+		clock:  clock.OrReal(c),
+	}
+}
+
+func (s *Store) idKey(name string) string {
+	return s.prefix + "ids:" + name
+}
+
+func (s *Store) hashKey(name string) string {
+	return s.prefix + "hashes:" + name
+}
+
+func (s *Store) tombstoneKey(name string) string {
+	return s.prefix + "tombstones:" + name
+}
+
+func (s *Store) get(key string) (string, error) {
+	v, err := s.client.Get(context.Background(), key).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", nil
+	}
+	return v, err
+}
+
+func (s *Store) Get(name string) (string, error) {
+	return s.get(s.idKey(name))
+}
+
+// Set stores id unless name already has another id, in which case it returns
+// uma.ErrStoredResourceConflict with the stored id
+func (s *Store) Set(name, id string) error {
+	ok, err := s.client.SetNX(context.Background(), s.idKey(name), id, 0).Result()
+	if err != nil || ok {
+		return err
+	}
+	stored, err := s.Get(name)
+	if err != nil {
+		return err
+	}
+	if stored == id {
+		return nil
+	}
+	return uma.ErrStoredResourceConflict{Name: name, ID: stored}
+}
+
+// Delete removes the id and the hash of name
+func (s *Store) Delete(name string) error {
+	return s.client.Del(context.Background(), s.idKey(name), s.hashKey(name)).Err()
+}
+
+func (s *Store) SetHash(name, hash string) error {
+	return s.client.Set(context.Background(), s.hashKey(name), hash, 0).Err()
+}
+
+func (s *Store) GetHash(name string) (string, error) {
+	return s.get(s.hashKey(name))
+}
+
+func (s *Store) Tombstone(name string, ttl time.Duration) error {
+	return s.client.Set(context.Background(), s.tombstoneKey(name), s.clock.Now().UTC().Format(time.RFC3339), ttl).Err()
+}
+
+func (s *Store) Tombstoned(name string) (bool, error) {
+	n, err := s.client.Exists(context.Background(), s.tombstoneKey(name)).Result()
+	return n > 0, err
+}
+
+// List scans for ids. With a cluster client, every master is scanned.
+func (s *Store) List() (map[string]string, error) {
+	ctx := context.Background()
+	prefix := s.idKey("")
+	var mu sync.Mutex
+	ids := map[string]string{}
+	scan := func(ctx context.Context, c redis.Cmdable) error {
+		iter := c.Scan(ctx, 0, escapePattern(prefix)+"*", 100).Iterator()
+		for iter.Next(ctx) {
+			v, err := c.Get(ctx, iter.Val()).Result()
+			if errors.Is(err, redis.Nil) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			mu.Lock()
+			ids[strings.TrimPrefix(iter.Val(), prefix)] = v
+			mu.Unlock()
+		}
+		return iter.Err()
+	}
+	if cc, ok := s.client.(*redis.ClusterClient); ok {
+		err := cc.ForEachMaster(ctx, func(ctx context.Context, c *redis.Client) error {
+			return scan(ctx, c)
+		})
+		return ids, err
+	}
+	return ids, scan(ctx, s.client)
+}
+
+// escapePattern escapes the glob characters of SCAN patterns in s
+func escapePattern(s string) string {
+	var sb strings.Builder
+	for _, c := range s {
+		if strings.ContainsRune(`*?[]\`, c) {
+			sb.WriteByte('\\')
+		}
+		sb.WriteRune(c)
+	}
+	return sb.String()
+}
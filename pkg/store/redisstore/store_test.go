@@ -0,0 +1,90 @@
+package redisstore
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/pckhoi/uma"
+	"github.com/pckhoi/uma/pkg/clock"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newStore(t *testing.T, prefix string, c clock.Clock) (*Store, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return New(client, prefix, c), mr
+}
+
+func TestStore(t *testing.T) {
+	s, mr := newStore(t, "uma:", nil)
+
+	id, err := s.Get("User 1")
+	require.NoError(t, err)
+	assert.Empty(t, id)
+	require.NoError(t, s.Set("User 1", "id-1"))
+	require.NoError(t, s.Set("User 1", "id-1"))
+	assert.Equal(t, uma.ErrStoredResourceConflict{Name: "User 1", ID: "id-1"}, s.Set("User 1", "id-2"))
+	id, err = s.Get("User 1")
+	require.NoError(t, err)
+	assert.Equal(t, "id-1", id)
+	got, err := mr.Get("uma:ids:User 1")
+	require.NoError(t, err)
+	assert.Equal(t, "id-1", got)
+
+	hash, err := s.GetHash("User 1")
+	require.NoError(t, err)
+	assert.Empty(t, hash)
+	require.NoError(t, s.SetHash("User 1", "abc"))
+	hash, err = s.GetHash("User 1")
+	require.NoError(t, err)
+	assert.Equal(t, "abc", hash)
+
+	require.NoError(t, s.Delete("User 1"))
+	id, err = s.Get("User 1")
+	require.NoError(t, err)
+	assert.Empty(t, id)
+	hash, err = s.GetHash("User 1")
+	require.NoError(t, err)
+	assert.Empty(t, hash)
+	require.NoError(t, s.Set("User 1", "id-2"))
+}
+
+func TestStoreTombstone(t *testing.T) {
+	c := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	s, mr := newStore(t, "uma:", c)
+
+	dead, err := s.Tombstoned("User 1")
+	require.NoError(t, err)
+	assert.False(t, dead)
+	require.NoError(t, s.Tombstone("User 1", time.Minute))
+	dead, err = s.Tombstoned("User 1")
+	require.NoError(t, err)
+	assert.True(t, dead)
+	deletedAt, err := mr.Get("uma:tombstones:User 1")
+	require.NoError(t, err)
+	assert.Equal(t, "2024-01-01T00:00:00Z", deletedAt)
+
+	mr.FastForward(time.Minute)
+	dead, err = s.Tombstoned("User 1")
+	require.NoError(t, err)
+	assert.False(t, dead)
+}
+
+func TestStoreList(t *testing.T) {
+	// glob characters of the prefix are matched literally
+	s, mr := newStore(t, "uma[1]:", nil)
+	require.NoError(t, s.Set("User 1", "id-1"))
+	require.NoError(t, s.Set("User *", "id-2"))
+	require.NoError(t, s.SetHash("User 1", "abc"))
+	require.NoError(t, mr.Set("uma1:ids:User 3", "id-3"))
+	require.NoError(t, mr.Set("other:ids:User 4", "id-4"))
+
+	ids, err := s.List()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"User 1": "id-1", "User *": "id-2"}, ids)
+}
@@ -0,0 +1,396 @@
+// Package syncd continuously reconciles resource manifests against an UMA authorization server. Manifests
+// are the JSON files written by `uma-codegen manifest --format json`, found in a directory. A Kubernetes
+// ConfigMap mounted as a volume is such a directory, so clusters with many services converge on the
+// resources declared by every service without each service registering them on its own.
+//
+// Only resources are reconciled. Scopes and permissions of the manifests are left to the tools that manage
+// the authorization server, such as the Keycloak Terraform provider. Resources that are no longer in any
+// manifest are not deleted, unless the Syncer has a namespace and Prune is set.
+package syncd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/pckhoi/uma"
+)
+
+// Resource is a resource of a manifest
+type Resource struct {
+	Name               string   `json:"name"`
+	DisplayName        string   `json:"displayName,omitempty"`
+	Type               string   `json:"type"`
+	IconURI            string   `json:"iconUri,omitempty"`
+	URIs               []string `json:"uris,omitempty"`
+	Scopes             []string `json:"scopes,omitempty"`
+	OwnerManagedAccess bool     `json:"ownerManagedAccess,omitempty"`
+}
+
+// Manifest is the part of a manifest that is reconciled
+type Manifest struct {
+	Resources []Resource `json:"resources"`
+}
+
+// Action tells what was done to a resource in the last sync
+type Action string
+
+const (
+	ActionCreated   Action = "created"
+	ActionUpdated   Action = "updated"
+	ActionUnchanged Action = "unchanged"
+	ActionDeleted   Action = "deleted"
+	ActionFailed    Action = "failed"
+)
+
+// ResourceStatus is the outcome of the last sync of a resource
+type ResourceStatus struct {
+	Name   string `json:"name"`
+	File   string `json:"file"`
+	ID     string `json:"id,omitempty"`
+	Action Action `json:"action"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Status is the outcome of the last sync
+type Status struct {
+	// Generation is incremented by every sync
+	Generation int       `json:"generation"`
+	SyncedAt   time.Time `json:"syncedAt,omitempty"`
+
+	// Ready is true if the last sync reconciled every resource
+	Ready     bool             `json:"ready"`
+	Error     string           `json:"error,omitempty"`
+	Resources []ResourceStatus `json:"resources,omitempty"`
+}
+
+// Syncer reconciles the manifests of Dir against Provider
+type Syncer struct {
+	Provider uma.Provider
+	Dir      string
+
+	// Interval is how often Dir is checked for changes. Defaults to 10 seconds.
+	Interval time.Duration
+
+	// ResyncInterval if positive, is how often manifests are reconciled even if they haven't changed, to
+	// undo changes made to resources on the authorization server
+	ResyncInterval time.Duration
+
+	// Namespace if set, prefixes the names of manifest resources like ManagerOptions.Namespace does, so
+	// that syncers and resource servers sharing one client only touch their own resources
+	Namespace string
+
+	// Prune if true, deletes resources of Namespace that are no longer in any manifest. It has no effect
+	// without Namespace, and no resource is deleted if the manifests can't be read.
+	Prune bool
+
+	// Tombstones if set, receives a tombstone for every pruned resource, so that resource servers
+	// sharing it as their ResourceStore don't register the resource again for TombstoneTTL
+	Tombstones   uma.ResourceTombstoneStore
+	TombstoneTTL time.Duration
+
+	// Logger logs synced and failed resources. Defaults to logr.Discard().
+	Logger logr.Logger
+
+	mu     sync.RWMutex
+	status Status
+}
+
+// readManifests returns the resources of every *.json file of dir, sorted by file name. Hidden files are
+// skipped, such as the ..data directory of mounted ConfigMaps.
+func readManifests(dir string) (files []string, rscs map[string][]Resource, err error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	rscs = map[string][]Resource{}
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), ".") || filepath.Ext(e.Name()) != ".json" || e.IsDir() {
+			continue
+		}
+		b, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, nil, err
+		}
+		m := &Manifest{}
+		if err := json.Unmarshal(b, m); err != nil {
+			return nil, nil, fmt.Errorf("error decoding manifest %q: %w", e.Name(), err)
+		}
+		files = append(files, e.Name())
+		rscs[e.Name()] = m.Resources
+	}
+	sort.Strings(files)
+	return files, rscs, nil
+}
+
+// scopeNames returns the sorted names of scopes of rsc
+func scopeNames(rsc *uma.ExpandedResource) []string {
+	scopes := rsc.ResourceScopes
+	if len(scopes) == 0 {
+		scopes = rsc.Scopes
+	}
+	names := make([]string, len(scopes))
+	for i, s := range scopes {
+		names[i] = s.Name
+	}
+	sort.Strings(names)
+	return names
+}
+
+func sortedCopy(sl []string) []string {
+	res := append([]string{}, sl...)
+	sort.Strings(res)
+	return res
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// upToDate reports whether the registered resource matches rsc
+func (rsc Resource) upToDate(registered *uma.ExpandedResource) bool {
+	return registered.Type == rsc.Type &&
+		registered.DisplayName == rsc.DisplayName &&
+		registered.IconUri == rsc.IconURI &&
+		registered.OwnerManagedAccess == rsc.OwnerManagedAccess &&
+		equalStrings(scopeNames(registered), sortedCopy(rsc.Scopes)) &&
+		equalStrings(sortedCopy(registered.URIs), sortedCopy(rsc.URIs))
+}
+
+func (rsc Resource) request() *uma.Resource {
+	req := &uma.Resource{
+		ResourceType: uma.ResourceType{
+			Type:           rsc.Type,
+			IconUri:        rsc.IconURI,
+			ResourceScopes: rsc.Scopes,
+			DisplayName:    rsc.DisplayName,
+		},
+		Name:               rsc.Name,
+		OwnerManagedAccess: rsc.OwnerManagedAccess,
+	}
+	if len(rsc.URIs) > 0 {
+		req.URI = rsc.URIs[0]
+	}
+	return req
+}
+
+// reconcile creates or updates the resource on the authorization server
+func (s *Syncer) reconcile(rsc Resource) (id string, action Action, err error) {
+	ids, err := s.Provider.ListResources(map[string][]string{
+		"name":      {rsc.Name},
+		"exactName": {"true"},
+	})
+	if err != nil {
+		return "", ActionFailed, err
+	}
+	for _, id := range ids {
+		registered, err := s.Provider.GetResource(id)
+		if err != nil {
+			return "", ActionFailed, err
+		}
+		if registered.Name != rsc.Name {
+			continue
+		}
+		if rsc.upToDate(registered) {
+			return id, ActionUnchanged, nil
+		}
+		if err := s.Provider.UpdateResource(id, rsc.request()); err != nil {
+			return id, ActionFailed, err
+		}
+		return id, ActionUpdated, nil
+	}
+	created, err := s.Provider.CreateResource(rsc.request())
+	if err != nil {
+		return "", ActionFailed, err
+	}
+	return created.ID, ActionCreated, nil
+}
+
+func (s *Syncer) logger() logr.Logger {
+	if s.Logger.GetSink() == nil {
+		return logr.Discard()
+	}
+	return s.Logger
+}
+
+// Sync reconciles every manifest once and returns the resulting status, which is also served by ServeHTTP
+func (s *Syncer) Sync() Status {
+	st := Status{SyncedAt: time.Now().UTC(), Ready: true}
+	files, rscs, err := readManifests(s.Dir)
+	if err != nil {
+		st.Ready = false
+		st.Error = err.Error()
+	}
+	defined := map[string]string{}
+	for _, file := range files {
+		for _, rsc := range rscs[file] {
+			rsc.Name = uma.NamespacedName(s.Namespace, rsc.Name)
+			rs := ResourceStatus{Name: rsc.Name, File: file}
+			if other, ok := defined[rsc.Name]; ok {
+				rs.Action = ActionFailed
+				rs.Error = fmt.Sprintf("resource is also defined in %q", other)
+			} else {
+				defined[rsc.Name] = file
+				var err error
+				rs.ID, rs.Action, err = s.reconcile(rsc)
+				if err != nil {
+					rs.Error = err.Error()
+				}
+			}
+			if rs.Action == ActionFailed {
+				st.Ready = false
+				s.logger().Info("failed to sync resource", "name", rs.Name, "file", file, "err", rs.Error)
+			} else if rs.Action != ActionUnchanged {
+				s.logger().Info("synced resource", "name", rs.Name, "id", rs.ID, "action", rs.Action)
+			}
+			st.Resources = append(st.Resources, rs)
+		}
+	}
+	if s.Prune && s.Namespace != "" && err == nil {
+		s.prune(&st, defined)
+	}
+	s.mu.Lock()
+	st.Generation = s.status.Generation + 1
+	s.status = st
+	s.mu.Unlock()
+	return st
+}
+
+// prune deletes resources of the namespace that are not defined by any manifest
+func (s *Syncer) prune(st *Status, defined map[string]string) {
+	registered, err := uma.ListNamespaceResources(s.Provider, s.Namespace)
+	if err != nil {
+		st.Ready = false
+		st.Error = fmt.Sprintf("error listing resources of namespace %q: %v", s.Namespace, err)
+		return
+	}
+	for _, rsc := range registered {
+		if _, ok := defined[rsc.Name]; ok {
+			continue
+		}
+		rs := ResourceStatus{Name: rsc.Name, ID: rsc.ID, Action: ActionDeleted}
+		if err := s.tombstone(rsc.Name); err != nil {
+			rs.Action = ActionFailed
+			rs.Error = err.Error()
+			st.Ready = false
+			s.logger().Info("failed to tombstone resource", "name", rs.Name, "id", rs.ID, "err", rs.Error)
+		} else if err := s.Provider.DeleteResource(rsc.ID); err != nil {
+			rs.Action = ActionFailed
+			rs.Error = err.Error()
+			st.Ready = false
+			s.logger().Info("failed to prune resource", "name", rs.Name, "id", rs.ID, "err", rs.Error)
+		} else {
+			s.logger().Info("pruned resource", "name", rs.Name, "id", rs.ID)
+		}
+		st.Resources = append(st.Resources, rs)
+	}
+}
+
+// tombstone keeps resource servers from registering the resource again before it is deleted
+func (s *Syncer) tombstone(name string) error {
+	if s.Tombstones == nil {
+		return nil
+	}
+	return s.Tombstones.Tombstone(name, s.TombstoneTTL)
+}
+
+// Status returns the status of the last sync
+func (s *Syncer) Status() Status {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.status
+}
+
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// snapshot returns the states of the manifests of dir. os.Stat follows symlinks, so files of ConfigMaps
+// change when their ..data symlink is swapped.
+func snapshot(dir string) map[string]fileState {
+	res := map[string]fileState{}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return res
+	}
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), ".") || filepath.Ext(e.Name()) != ".json" {
+			continue
+		}
+		if fi, err := os.Stat(filepath.Join(dir, e.Name())); err == nil {
+			res[e.Name()] = fileState{modTime: fi.ModTime(), size: fi.Size()}
+		}
+	}
+	return res
+}
+
+func sameSnapshot(a, b map[string]fileState) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if b[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Run syncs right away, then whenever manifests change, after a failed sync, and every ResyncInterval. It
+// blocks until ctx is done.
+func (s *Syncer) Run(ctx context.Context) {
+	interval := s.Interval
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	last := snapshot(s.Dir)
+	st := s.Sync()
+	lastSync := time.Now()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		cur := snapshot(s.Dir)
+		changed := !sameSnapshot(last, cur)
+		resync := s.ResyncInterval > 0 && time.Since(lastSync) >= s.ResyncInterval
+		if !changed && !resync && st.Ready {
+			continue
+		}
+		last = cur
+		st = s.Sync()
+		lastSync = time.Now()
+	}
+}
+
+// ServeHTTP responds with the status of the last sync as JSON, with status code 503 if it is not ready, so
+// that it can back a readiness probe
+func (s *Syncer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	st := s.Status()
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if !st.Ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(st)
+}
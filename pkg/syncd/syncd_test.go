@@ -0,0 +1,211 @@
+package syncd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/pckhoi/uma"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeProvider keeps resources in memory. Methods that Syncer doesn't call panic.
+type fakeProvider struct {
+	uma.Provider
+	resources map[string]*uma.ExpandedResource
+	created   int
+	updates   int
+	failOn    string
+}
+
+func (p *fakeProvider) ListResources(q url.Values) ([]string, error) {
+	ids := []string{}
+	for id, rsc := range p.resources {
+		// like Keycloak, names are matched partially unless exactName is true
+		if rsc.Name == q.Get("name") || (q.Get("exactName") != "true" && strings.Contains(rsc.Name, q.Get("name"))) {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func (p *fakeProvider) GetResource(id string) (*uma.ExpandedResource, error) {
+	rsc := *p.resources[id]
+	return &rsc, nil
+}
+
+func (p *fakeProvider) expand(id string, rsc *uma.Resource) *uma.ExpandedResource {
+	res := &uma.ExpandedResource{
+		ID:                 id,
+		Name:               rsc.Name,
+		DisplayName:        rsc.DisplayName,
+		Type:               rsc.Type,
+		IconUri:            rsc.IconUri,
+		OwnerManagedAccess: rsc.OwnerManagedAccess,
+	}
+	if rsc.URI != "" {
+		res.URIs = []string{rsc.URI}
+	}
+	for _, s := range rsc.ResourceScopes {
+		res.ResourceScopes = append(res.ResourceScopes, uma.Scope{Name: s})
+	}
+	return res
+}
+
+func (p *fakeProvider) CreateResource(rsc *uma.Resource) (*uma.ExpandedResource, error) {
+	if rsc.Name == p.failOn {
+		return nil, errors.New("server error")
+	}
+	p.created++
+	id := fmt.Sprintf("rsc-%d", p.created)
+	p.resources[id] = p.expand(id, rsc)
+	return p.resources[id], nil
+}
+
+func (p *fakeProvider) UpdateResource(id string, rsc *uma.Resource) error {
+	p.updates++
+	p.resources[id] = p.expand(id, rsc)
+	return nil
+}
+
+func (p *fakeProvider) DeleteResource(id string) error {
+	delete(p.resources, id)
+	return nil
+}
+
+func writeManifest(t *testing.T, name string, rscs ...Resource) {
+	t.Helper()
+	b, err := json.Marshal(map[string]interface{}{
+		"scopes":    []map[string]string{{"name": "read"}},
+		"resources": rscs,
+	})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(name, b, 0644))
+}
+
+func TestSyncer(t *testing.T) {
+	dir := t.TempDir()
+	users := Resource{
+		Name:   "Users",
+		Type:   "https://www.example.com/rsrcs/users",
+		URIs:   []string{"https://api.example.com/users"},
+		Scopes: []string{"write", "read"},
+	}
+	writeManifest(t, filepath.Join(dir, "users.json"), users)
+	writeManifest(t, filepath.Join(dir, "orders.json"), Resource{Name: "Orders", Type: "order", Scopes: []string{"read"}})
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "README.md"), []byte("not a manifest"), 0644))
+	p := &fakeProvider{resources: map[string]*uma.ExpandedResource{}}
+	s := &Syncer{Provider: p, Dir: dir, Logger: testr.New(t)}
+
+	st := s.Sync()
+	assert.True(t, st.Ready)
+	assert.Equal(t, 1, st.Generation)
+	assert.Equal(t, []ResourceStatus{
+		{Name: "Orders", File: "orders.json", ID: "rsc-1", Action: ActionCreated},
+		{Name: "Users", File: "users.json", ID: "rsc-2", Action: ActionCreated},
+	}, st.Resources)
+
+	st = s.Sync()
+	assert.Equal(t, ActionUnchanged, st.Resources[0].Action)
+	assert.Equal(t, ActionUnchanged, st.Resources[1].Action)
+	assert.Equal(t, 0, p.updates)
+
+	// drift on the authorization server is undone
+	p.resources["rsc-2"].ResourceScopes = []uma.Scope{{Name: "read"}}
+	st = s.Sync()
+	assert.Equal(t, ActionUpdated, st.Resources[1].Action)
+	assert.Equal(t, 1, p.updates)
+
+	// duplicates and errors are reported
+	writeManifest(t, filepath.Join(dir, "zz.json"), users, Resource{Name: "Broken", Type: "x"})
+	p.failOn = "Broken"
+	st = s.Sync()
+	assert.False(t, st.Ready)
+	assert.Equal(t, []ResourceStatus{
+		{Name: "Orders", File: "orders.json", ID: "rsc-1", Action: ActionUnchanged},
+		{Name: "Users", File: "users.json", ID: "rsc-2", Action: ActionUnchanged},
+		{Name: "Users", File: "zz.json", Action: ActionFailed, Error: `resource is also defined in "users.json"`},
+		{Name: "Broken", File: "zz.json", Action: ActionFailed, Error: "server error"},
+	}, st.Resources)
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	served := Status{}
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&served))
+	assert.Equal(t, 4, served.Generation)
+
+	require.NoError(t, os.Remove(filepath.Join(dir, "zz.json")))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "orders.json"), []byte("{"), 0644))
+	st = s.Sync()
+	assert.False(t, st.Ready)
+	assert.Contains(t, st.Error, `error decoding manifest "orders.json"`)
+}
+
+func TestSyncerNamespace(t *testing.T) {
+	dir := t.TempDir()
+	writeManifest(t, filepath.Join(dir, "billing.json"),
+		Resource{Name: "Invoices", Type: "invoices"},
+		Resource{Name: "Refunds", Type: "refunds"},
+	)
+	p := &fakeProvider{resources: map[string]*uma.ExpandedResource{}}
+	other := &Syncer{Provider: p, Dir: t.TempDir(), Namespace: "shipping", Prune: true, Logger: testr.New(t)}
+	writeManifest(t, filepath.Join(other.Dir, "shipping.json"), Resource{Name: "Invoices", Type: "invoices"})
+	tombstones := uma.NewMemoryResourceStore(nil)
+	s := &Syncer{
+		Provider: p, Dir: dir, Namespace: "billing", Prune: true, Logger: testr.New(t),
+		Tombstones: tombstones, TombstoneTTL: time.Hour,
+	}
+
+	assert.True(t, other.Sync().Ready)
+	st := s.Sync()
+	assert.True(t, st.Ready)
+	assert.Equal(t, []ResourceStatus{
+		{Name: "billing/Invoices", File: "billing.json", ID: "rsc-2", Action: ActionCreated},
+		{Name: "billing/Refunds", File: "billing.json", ID: "rsc-3", Action: ActionCreated},
+	}, st.Resources)
+
+	// only resources of the namespace are pruned
+	writeManifest(t, filepath.Join(dir, "billing.json"), Resource{Name: "Invoices", Type: "invoices"})
+	st = s.Sync()
+	assert.True(t, st.Ready)
+	assert.Equal(t, []ResourceStatus{
+		{Name: "billing/Invoices", File: "billing.json", ID: "rsc-2", Action: ActionUnchanged},
+		{Name: "billing/Refunds", ID: "rsc-3", Action: ActionDeleted},
+	}, st.Resources)
+	assert.Len(t, p.resources, 2)
+	assert.Equal(t, "shipping/Invoices", p.resources["rsc-1"].Name)
+	dead, _ := tombstones.Tombstoned("billing/Refunds")
+	assert.True(t, dead)
+
+	// nothing is pruned if manifests can't be read
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "billing.json"), []byte("{"), 0644))
+	assert.False(t, s.Sync().Ready)
+	assert.Len(t, p.resources, 2)
+}
+
+func TestSyncerWithoutLogger(t *testing.T) {
+	dir := t.TempDir()
+	writeManifest(t, filepath.Join(dir, "billing.json"), Resource{Name: "Invoices", Type: "invoices"}, Resource{Name: "Broken", Type: "x"})
+	p := &fakeProvider{resources: map[string]*uma.ExpandedResource{}, failOn: "billing/Broken"}
+	s := &Syncer{Provider: p, Dir: dir, Namespace: "billing", Prune: true}
+	st := s.Sync()
+	assert.False(t, st.Ready)
+	assert.Equal(t, ActionCreated, st.Resources[0].Action)
+	assert.Equal(t, ActionFailed, st.Resources[1].Action)
+
+	writeManifest(t, filepath.Join(dir, "billing.json"))
+	st = s.Sync()
+	assert.True(t, st.Ready)
+	assert.Equal(t, []ResourceStatus{{Name: "billing/Invoices", ID: "rsc-1", Action: ActionDeleted}}, st.Resources)
+}
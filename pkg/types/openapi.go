@@ -10,14 +10,100 @@ import (
 )
 
 type UMAResouce struct {
-	Type         string `json:"type,omitempty" yaml:"type,omitempty"`
-	NameTemplate string `json:"name,omitempty" yaml:"name,omitempty"`
+	Type                string `json:"type,omitempty" yaml:"type,omitempty"`
+	NameTemplate        string `json:"name,omitempty" yaml:"name,omitempty"`
+	DisplayNameTemplate string `json:"displayName,omitempty" yaml:"displayName,omitempty"`
+	DescriptionTemplate string `json:"description,omitempty" yaml:"description,omitempty"`
+	IconURITemplate     string `json:"iconUri,omitempty" yaml:"iconUri,omitempty"`
+	OwnerManagedAccess  bool   `json:"ownerManagedAccess,omitempty" yaml:"ownerManagedAccess,omitempty"`
+
+	// IncludeScopes overrides whether scopes are included in permission tickets for this resource
+	IncludeScopes *bool `json:"includeScopes,omitempty" yaml:"includeScopes,omitempty"`
+
+	// LocalizedDisplayNames and LocalizedIconURIs map locales e.g. "fr" or "pt-BR" to templates
+	LocalizedDisplayNames map[string]string `json:"localizedDisplayNames,omitempty" yaml:"localizedDisplayNames,omitempty"`
+	LocalizedIconURIs     map[string]string `json:"localizedIconUris,omitempty" yaml:"localizedIconUris,omitempty"`
+}
+
+// UMAScope describes a scope. In resourceScopes, a scope can be a plain name or an UMAScope object.
+type UMAScope struct {
+	Name        string `json:"name,omitempty" yaml:"name,omitempty"`
+	DisplayName string `json:"displayName,omitempty" yaml:"displayName,omitempty"`
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+	IconUri     string `json:"iconUri,omitempty" yaml:"iconUri,omitempty"`
+}
+
+func (s *UMAScope) UnmarshalJSON(b []byte) error {
+	if len(b) > 0 && b[0] == '"' {
+		*s = UMAScope{}
+		return json.Unmarshal(b, &s.Name)
+	}
+	type scope UMAScope
+	return json.Unmarshal(b, (*scope)(s))
+}
+
+func (s *UMAScope) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*s = UMAScope{}
+		return value.Decode(&s.Name)
+	}
+	type scope UMAScope
+	return value.Decode((*scope)(s))
 }
 
 type UMAResourceType struct {
+	DisplayName    string   `json:"displayName,omitempty" yaml:"displayName,omitempty"`
 	Description    string   `json:"description,omitempty" yaml:"description,omitempty"`
 	IconUri        string   `json:"iconUri,omitempty" yaml:"iconUri,omitempty"`
 	ResourceScopes []string `json:"resourceScopes,omitempty" yaml:"resourceScopes,omitempty"`
+
+	// ScopeDescriptions holds the scopes of resourceScopes that are objects rather than plain names
+	ScopeDescriptions map[string]UMAScope `json:"-" yaml:"-"`
+}
+
+// umaResourceTypeDoc is UMAResourceType as written in the spec
+type umaResourceTypeDoc struct {
+	DisplayName    string     `json:"displayName,omitempty" yaml:"displayName,omitempty"`
+	Description    string     `json:"description,omitempty" yaml:"description,omitempty"`
+	IconUri        string     `json:"iconUri,omitempty" yaml:"iconUri,omitempty"`
+	ResourceScopes []UMAScope `json:"resourceScopes,omitempty" yaml:"resourceScopes,omitempty"`
+}
+
+func (t *UMAResourceType) fromDoc(doc *umaResourceTypeDoc) error {
+	*t = UMAResourceType{
+		DisplayName: doc.DisplayName,
+		Description: doc.Description,
+		IconUri:     doc.IconUri,
+	}
+	for _, s := range doc.ResourceScopes {
+		if s.Name == "" {
+			return fmt.Errorf("resource scope without name")
+		}
+		t.ResourceScopes = append(t.ResourceScopes, s.Name)
+		if s != (UMAScope{Name: s.Name}) {
+			if t.ScopeDescriptions == nil {
+				t.ScopeDescriptions = map[string]UMAScope{}
+			}
+			t.ScopeDescriptions[s.Name] = s
+		}
+	}
+	return nil
+}
+
+func (t *UMAResourceType) UnmarshalJSON(b []byte) error {
+	doc := &umaResourceTypeDoc{}
+	if err := json.Unmarshal(b, doc); err != nil {
+		return err
+	}
+	return t.fromDoc(doc)
+}
+
+func (t *UMAResourceType) UnmarshalYAML(value *yaml.Node) error {
+	doc := &umaResourceTypeDoc{}
+	if err := value.Decode(doc); err != nil {
+		return err
+	}
+	return t.fromDoc(doc)
 }
 
 type SecurityScheme struct {
@@ -31,6 +117,9 @@ type Components struct {
 
 type Operation struct {
 	Security []map[string][]string `json:"security,omitempty" yaml:"security,omitempty"`
+
+	// UMAIncludeScopes overrides whether scopes are included in permission tickets for this operation
+	UMAIncludeScopes *bool `json:"x-uma-include-scopes,omitempty" yaml:"x-uma-include-scopes,omitempty"`
 }
 
 type Path struct {
@@ -164,3 +164,59 @@ func TestOpenAPISpect(t *testing.T) {
 		})
 	}
 }
+
+func TestUMAResourceTypeScopeDescriptions(t *testing.T) {
+	for _, c := range []struct {
+		Filename string
+		Content  string
+	}{
+		{"oapi.yaml", `
+x-uma-resource-types:
+  https://example.co/rsrcs/user:
+    resourceScopes:
+      - read
+      - name: write
+        displayName: Write
+        description: Update a user
+        iconUri: https://example.co/scopes/write.png
+`},
+		{"oapi.json", `{
+	"x-uma-resource-types": {
+	  "https://example.co/rsrcs/user": {
+		"resourceScopes": ["read", {
+			"name": "write",
+			"displayName": "Write",
+			"description": "Update a user",
+			"iconUri": "https://example.co/scopes/write.png"
+		}]
+	  }
+	}
+}`},
+	} {
+		assertUnmarshalSpec(t, c.Filename, c.Content, &OpenAPISpec{
+			UMAResourceTypes: map[string]UMAResourceType{
+				"https://example.co/rsrcs/user": {
+					ResourceScopes: []string{"read", "write"},
+					ScopeDescriptions: map[string]UMAScope{
+						"write": {
+							Name:        "write",
+							DisplayName: "Write",
+							Description: "Update a user",
+							IconUri:     "https://example.co/scopes/write.png",
+						},
+					},
+				},
+			},
+		})
+	}
+
+	fpath := filepath.Join(t.TempDir(), "oapi.yaml")
+	require.NoError(t, os.WriteFile(fpath, []byte(`
+x-uma-resource-types:
+  https://example.co/rsrcs/user:
+    resourceScopes:
+      - description: Update a user
+`), 0644))
+	_, err := OpenOpenAPISpec(fpath)
+	assert.EqualError(t, err, "resource scope without name")
+}
@@ -1,20 +1,36 @@
 package urlencode
 
 import (
+	"encoding"
 	"fmt"
 	"net/url"
 	"reflect"
+	"strconv"
+	"strings"
 )
 
-func fieldName(field reflect.StructField) string {
-	if !field.IsExported() {
-		return ""
+var textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+
+// parseTag returns the parameter name of field and whether it has the keepempty option. name is empty if
+// the field is skipped.
+func parseTag(field reflect.StructField) (name string, keepEmpty bool) {
+	tag := field.Tag.Get("url")
+	if tag == "-" {
+		return "", false
+	}
+	name, opts, _ := strings.Cut(tag, ",")
+	for _, opt := range strings.Split(opts, ",") {
+		if opt == "keepempty" {
+			keepEmpty = true
+		}
 	}
-	if s := field.Tag.Get("url"); s == "-" {
-		return ""
-	} else if s != "" {
-		return s
+	if name != "" {
+		return name, keepEmpty
 	}
+	return fieldName(field), keepEmpty
+}
+
+func fieldName(field reflect.StructField) string {
 	newName := []byte{}
 	for i, c := range field.Name {
 		if c >= 65 && c <= 90 {
@@ -30,55 +46,136 @@ func fieldName(field reflect.StructField) string {
 	return string(newName)
 }
 
-func serializeFieldValue(v reflect.Value) ([]string, error) {
-	if v.IsZero() {
-		return nil, nil
+// isTextMarshaler reports whether v is serialized with MarshalText
+func isTextMarshaler(v reflect.Value) bool {
+	return v.Type().Implements(textMarshalerType) ||
+		(v.CanAddr() && reflect.PointerTo(v.Type()).Implements(textMarshalerType))
+}
+
+func serializeScalar(v reflect.Value) (string, error) {
+	if isTextMarshaler(v) {
+		m, ok := v.Interface().(encoding.TextMarshaler)
+		if !ok {
+			m = v.Addr().Interface().(encoding.TextMarshaler)
+		}
+		b, err := m.MarshalText()
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
 	}
 	switch v.Kind() {
 	case reflect.String:
-		return []string{v.String()}, nil
-	case reflect.Int:
-		return []string{fmt.Sprintf("%d", v.Int())}, nil
+		return v.String(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, v.Type().Bits()), nil
 	case reflect.Bool:
-		return []string{fmt.Sprintf("%v", v.Bool())}, nil
-	case reflect.Slice:
+		return strconv.FormatBool(v.Bool()), nil
+	default:
+		return "", fmt.Errorf("unhandled %v", v.Kind())
+	}
+}
+
+// serializeFieldValue returns the values of v. Nil pointers and slices have no values.
+func serializeFieldValue(v reflect.Value) ([]string, error) {
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return nil, nil
+		}
+		if !v.Type().Implements(textMarshalerType) {
+			v = v.Elem()
+		}
+	}
+	if v.Kind() == reflect.Slice && !isTextMarshaler(v) {
 		rslt := []string{}
-		elemKind := v.Type().Elem().Kind()
-		switch elemKind {
-		case reflect.String:
-			for i := 0; i < v.Len(); i++ {
-				rslt = append(rslt, v.Index(i).String())
+		for i := 0; i < v.Len(); i++ {
+			sl, err := serializeFieldValue(v.Index(i))
+			if err != nil {
+				return nil, err
 			}
-		case reflect.Int:
-			for i := 0; i < v.Len(); i++ {
-				rslt = append(rslt, fmt.Sprintf("%d", v.Index(i).Int()))
+			rslt = append(rslt, sl...)
+		}
+		if len(rslt) == 0 {
+			return nil, nil
+		}
+		return rslt, nil
+	}
+	s, err := serializeScalar(v)
+	if err != nil {
+		return nil, err
+	}
+	return []string{s}, nil
+}
+
+// isStruct reports whether v is a struct, or a pointer to one, whose fields are encoded as parameters
+func isStruct(v reflect.Value) bool {
+	if isTextMarshaler(v) {
+		return false
+	}
+	if v.Kind() == reflect.Pointer {
+		return v.Type().Elem().Kind() == reflect.Struct && !reflect.PointerTo(v.Type().Elem()).Implements(textMarshalerType)
+	}
+	return v.Kind() == reflect.Struct
+}
+
+func encodeStruct(values url.Values, v reflect.Value, prefix string) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		structField := t.Field(i)
+		fv := v.Field(i)
+		if structField.Anonymous && structField.Tag.Get("url") == "" && isStruct(fv) {
+			// fields of embedded structs are promoted, even if the struct type is unexported
+			if fv.Kind() == reflect.Pointer {
+				if fv.IsNil() {
+					continue
+				}
+				fv = fv.Elem()
 			}
-		case reflect.Bool:
-			for i := 0; i < v.Len(); i++ {
-				rslt = append(rslt, fmt.Sprintf("%v", v.Index(i).Bool()))
+			if err := encodeStruct(values, fv, prefix); err != nil {
+				return err
 			}
-		default:
-			return nil, fmt.Errorf("unhandled slice of %v", elemKind)
+			continue
 		}
-		return rslt, nil
-	case reflect.Pointer:
-		elem := v.Elem()
-		elemKind := v.Type().Elem().Kind()
-		switch elemKind {
-		case reflect.String:
-			return []string{elem.String()}, nil
-		case reflect.Int:
-			return []string{fmt.Sprintf("%d", elem.Int())}, nil
-		case reflect.Bool:
-			return []string{fmt.Sprintf("%v", elem.Bool())}, nil
-		default:
-			return nil, fmt.Errorf("unhandled slice of %v", elemKind)
+		if !structField.IsExported() {
+			continue
+		}
+		name, keepEmpty := parseTag(structField)
+		if name == "" || (!keepEmpty && fv.IsZero()) {
+			continue
+		}
+		if isStruct(fv) {
+			if fv.Kind() == reflect.Pointer {
+				if fv.IsNil() {
+					continue
+				}
+				fv = fv.Elem()
+			}
+			if err := encodeStruct(values, fv, prefix+name+"."); err != nil {
+				return err
+			}
+			continue
+		}
+		sl, err := serializeFieldValue(fv)
+		if err != nil {
+			return fmt.Errorf("error serializing field %q: %v", structField.Name, err)
+		}
+		if sl != nil {
+			values[prefix+name] = sl
 		}
-	default:
-		return nil, fmt.Errorf("unhandled %v", v.Kind())
 	}
+	return nil
 }
 
+// ToValues encodes the exported fields of obj as form values. The parameter name is taken from the "url"
+// tag, or is the snake case of the field name. Zero values are left out unless the tag has the "keepempty"
+// option, e.g. `url:"limit,keepempty"`, though nil pointers and empty slices are left out regardless. A
+// pointer to a zero value is encoded. The "omitempty" option is accepted for compatibility with
+// encoding/json style tags, it is the default. Fields of embedded structs are promoted, and fields of other struct fields are prefixed with the
+// name of the field and a dot. Values that implement encoding.TextMarshaler are encoded with MarshalText.
 func ToValues(obj interface{}) (*url.Values, error) {
 	v := reflect.ValueOf(obj)
 	if v.Kind() == reflect.Pointer {
@@ -87,21 +184,15 @@ func ToValues(obj interface{}) (*url.Values, error) {
 	if v.Kind() != reflect.Struct {
 		return nil, fmt.Errorf("obj must be a struct or a pointer to struct")
 	}
-	numField := v.NumField()
+	if !v.CanAddr() {
+		// copy the struct so that fields whose pointer implements encoding.TextMarshaler can be marshaled
+		cp := reflect.New(v.Type()).Elem()
+		cp.Set(v)
+		v = cp
+	}
 	values := &url.Values{}
-	for i := 0; i < numField; i++ {
-		structField := v.Type().FieldByIndex([]int{i})
-		fieldName := fieldName(structField)
-		if fieldName == "" {
-			continue
-		}
-		sl, err := serializeFieldValue(v.FieldByIndex([]int{i}))
-		if err != nil {
-			return nil, fmt.Errorf("error serializing field %q: %v", structField.Name, err)
-		}
-		if sl != nil {
-			(*values)[fieldName] = sl
-		}
+	if err := encodeStruct(*values, v, ""); err != nil {
+		return nil, err
 	}
 	return values, nil
 }
@@ -3,6 +3,7 @@ package urlencode
 import (
 	"net/url"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -82,3 +83,76 @@ func TestToValues(t *testing.T) {
 		"string_field": {"abc"},
 	}), *values)
 }
+
+type Base struct {
+	Ticket string `url:",omitempty"`
+}
+
+type inner struct {
+	Audience string
+}
+
+type Claims struct {
+	Sub string
+}
+
+func TestToValuesOptions(t *testing.T) {
+	type Payload struct {
+		Base
+		*inner
+		SubmitRequest bool      `url:",omitempty"`
+		Limit         int       `url:"limit,omitempty"`
+		Name          string    `url:",omitempty"`
+		Scopes        []string  `url:",omitempty"`
+		Claims        Claims    `url:"claims"`
+		ClaimsPtr     *Claims   `url:"claims_ptr"`
+		Time          time.Time `url:",omitempty"`
+		TimePtr       *time.Time
+		Times         []time.Time
+		Uint          uint8
+		Float         float64
+		Offset        int    `url:",keepempty"`
+		Blank         string `url:"blank,keepempty"`
+	}
+	ts := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	values, err := ToValues(Payload{})
+	require.NoError(t, err)
+	assert.Equal(t, url.Values{
+		"offset": {"0"},
+		"blank":  {""},
+	}, *values)
+
+	values, err = ToValues(Payload{
+		Base:          Base{Ticket: "t1"},
+		inner:         &inner{Audience: "api"},
+		SubmitRequest: true,
+		Limit:         5,
+		Claims:        Claims{Sub: "user-1"},
+		ClaimsPtr:     &Claims{Sub: "user-2"},
+		Time:          ts,
+		TimePtr:       &ts,
+		Times:         []time.Time{ts},
+		Uint:          7,
+		Float:         1.5,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, url.Values{
+		"ticket":         {"t1"},
+		"audience":       {"api"},
+		"submit_request": {"true"},
+		"limit":          {"5"},
+		"claims.sub":     {"user-1"},
+		"claims_ptr.sub": {"user-2"},
+		"time":           {"2023-01-02T03:04:05Z"},
+		"time_ptr":       {"2023-01-02T03:04:05Z"},
+		"times":          {"2023-01-02T03:04:05Z"},
+		"uint":           {"7"},
+		"float":          {"1.5"},
+		"offset":         {"0"},
+		"blank":          {""},
+	}, *values)
+
+	_, err = ToValues(struct{ M map[string]string }{M: map[string]string{}})
+	assert.EqualError(t, err, `error serializing field "M": unhandled map`)
+}
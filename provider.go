@@ -2,6 +2,7 @@ package uma
 
 import (
 	"context"
+	"encoding/json"
 	"net/http"
 	"net/url"
 
@@ -37,9 +38,21 @@ type Scope struct {
 	Name string `json:"name,omitempty"`
 }
 
+// UnmarshalJSON accepts a scope name, which is how authorization servers other than Keycloak, e.g.
+// ForgeRock AM, describe the scopes of a resource
+func (s *Scope) UnmarshalJSON(b []byte) error {
+	if len(b) > 0 && b[0] == '"' {
+		*s = Scope{}
+		return json.Unmarshal(b, &s.Name)
+	}
+	type scope Scope
+	return json.Unmarshal(b, (*scope)(s))
+}
+
 type ExpandedResource struct {
 	ID             string  `json:"_id,omitempty"`
 	Name           string  `json:"name,omitempty"`
+	DisplayName    string  `json:"displayName,omitempty"`
 	Type           string  `json:"type,omitempty"`
 	Description    string  `json:"description,omitempty"`
 	IconUri        string  `json:"icon_uri,omitempty"`
@@ -58,6 +71,15 @@ type Provider interface {
 	// Authenticate authenticates client and get an access token for permission api
 	Authenticate(client *http.Client) (*httputil.ClientCreds, error)
 
+	// ProtectionAPIToken returns the current protection API token (PAT), obtaining a new one if it has
+	// expired. It lets applications call protection API endpoints that are not wrapped by this library.
+	ProtectionAPIToken(ctx context.Context) (string, error)
+
+	// ProtectionRequest sends a request to the issuer url followed by endpointSuffix, e.g.
+	// "/authz/protection/uma-policy" for Keycloak, authorized with the PAT. body if not nil is sent as
+	// JSON. The response is returned whatever its status, and its body must be closed by the caller.
+	ProtectionRequest(ctx context.Context, method, endpointSuffix string, body interface{}) (*http.Response, error)
+
 	// CreateResource creates resource
 	CreateResource(request *Resource) (response *ExpandedResource, err error)
 
@@ -78,4 +100,22 @@ type Provider interface {
 	CreatePermissionTicket(resourceID string, scopes ...string) (string, error)
 
 	WWWAuthenticateDirectives() WWWAuthenticateDirectives
+
+	// Discovery returns the UMA discovery document of the authorization server
+	Discovery() UMADiscovery
+}
+
+// ClaimPushingProvider is implemented by providers that can push claims along with permission requests,
+// such as BaseProvider and KeycloakProvider.
+type ClaimPushingProvider interface {
+	CreatePermissionTicketWithClaims(resourceID string, claims map[string][]string, scopes ...string) (string, error)
+}
+
+// PermissionCheckingProvider is implemented by providers that decide permissions themselves rather than
+// grant them in the RPT, such as FGAProvider. The Manager asks CheckPermission instead of looking for the
+// permission in the token, which only has to be valid and unexpired.
+type PermissionCheckingProvider interface {
+	// CheckPermission returns nil if rpt grants scopes on rsc, ErrInvalidRPT with reason RPTNoPermission
+	// or RPTMissingScope if it doesn't, or any other error if the decision can't be made
+	CheckPermission(ctx context.Context, rpt *RPT, rsc Resource, scopes []string) error
 }
@@ -0,0 +1,31 @@
+package uma
+
+// ProviderMiddleware wraps a Provider to add behavior such as logging, caching or tenant routing.
+// The easiest way to write one is to embed the next Provider in a struct and override the methods
+// of interest:
+//
+//	type loggingProvider struct {
+//		uma.Provider
+//		logger logr.Logger
+//	}
+//
+//	func (p *loggingProvider) CreateResource(request *uma.Resource) (*uma.ExpandedResource, error) {
+//		p.logger.Info("creating resource", "name", request.Name)
+//		return p.Provider.CreateResource(request)
+//	}
+//
+//	func withLogging(logger logr.Logger) uma.ProviderMiddleware {
+//		return func(next uma.Provider) uma.Provider {
+//			return &loggingProvider{Provider: next, logger: logger}
+//		}
+//	}
+type ProviderMiddleware func(next Provider) Provider
+
+// ChainProvider wraps p with middlewares. The first middleware is the outermost one, i.e. it is the
+// first to handle every call.
+func ChainProvider(p Provider, middlewares ...ProviderMiddleware) Provider {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		p = middlewares[i](p)
+	}
+	return p
+}
@@ -0,0 +1,89 @@
+package uma_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/pckhoi/uma"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingProvider struct {
+	uma.Provider
+	name  string
+	calls *[]string
+}
+
+func (p *recordingProvider) CreateResource(request *uma.Resource) (*uma.ExpandedResource, error) {
+	*p.calls = append(*p.calls, p.name+" CreateResource "+request.Name)
+	return p.Provider.CreateResource(request)
+}
+
+func (p *recordingProvider) CreatePermissionTicket(resourceID string, scopes ...string) (string, error) {
+	*p.calls = append(*p.calls, p.name+" CreatePermissionTicket "+resourceID)
+	return p.Provider.CreatePermissionTicket(resourceID, scopes...)
+}
+
+func recording(name string, calls *[]string) uma.ProviderMiddleware {
+	return func(next uma.Provider) uma.Provider {
+		return &recordingProvider{Provider: next, name: name, calls: calls}
+	}
+}
+
+func TestChainProvider(t *testing.T) {
+	calls := []string{}
+	p := uma.ChainProvider(newMockProvider(nil), recording("outer", &calls), recording("inner", &calls))
+	h := newMockManager(t, p, uma.ManagerOptions{}).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	rec := serve(h, http.MethodGet, "https://api.example.com/users/1", "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, `UMA realm="test", as_uri="https://as.example.com", ticket="ticket-1"`, rec.Header().Get("WWW-Authenticate"))
+	assert.Equal(t, []string{
+		"outer CreateResource User 1",
+		"inner CreateResource User 1",
+		"outer CreatePermissionTicket rsc-User 1",
+		"inner CreatePermissionTicket rsc-User 1",
+	}, calls)
+}
+
+func TestBaseProvider(t *testing.T) {
+	var issuer string
+	mux := http.NewServeMux()
+	writeJSON := func(w http.ResponseWriter, status int, obj any) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		require.NoError(t, json.NewEncoder(w).Encode(obj))
+	}
+	mux.HandleFunc("/realms/test/.well-known/uma2-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{
+			"issuer":                         issuer,
+			"token_endpoint":                 issuer + "/token",
+			"resource_registration_endpoint": issuer + "/resource_set",
+			"permission_endpoint":            issuer + "/permission",
+		})
+	})
+	mux.HandleFunc("/realms/test/token", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, "client_credentials", r.PostForm.Get("grant_type"))
+		writeJSON(w, http.StatusOK, map[string]any{"access_token": "pat", "expires_in": 300})
+	})
+	mux.HandleFunc("/realms/test/permission", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer pat", r.Header.Get("Authorization"))
+		writeJSON(w, http.StatusCreated, map[string]string{"ticket": "ticket-abc"})
+	})
+	s := httptest.NewServer(mux)
+	defer s.Close()
+	issuer = s.URL + "/realms/test"
+
+	p, err := uma.NewBaseProvider(issuer, "client", "secret", nil, s.Client(), testr.New(t))
+	require.NoError(t, err)
+	assert.Equal(t, issuer+"/resource_set", p.Discovery().ResourceRegistrationEndpoint)
+	assert.Equal(t, uma.WWWAuthenticateDirectives{Realm: "test", AsUri: issuer}, p.WWWAuthenticateDirectives())
+	ticket, err := p.CreatePermissionTicket("rsc-1", "read")
+	require.NoError(t, err)
+	assert.Equal(t, "ticket-abc", ticket)
+}
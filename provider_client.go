@@ -0,0 +1,87 @@
+package uma
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// ProviderClientOptions tunes the http client used to communicate with the authorization server
+type ProviderClientOptions struct {
+	// Timeout of each request, including reading the response body. Defaults to 30 seconds.
+	Timeout time.Duration
+
+	// MaxIdleConns controls the maximum number of idle connections across all hosts. Defaults to 100.
+	MaxIdleConns int
+
+	// MaxIdleConnsPerHost controls the maximum idle connections to keep per host. Since most traffic
+	// goes to a single authorization server, it defaults to 32 instead of net/http's 2.
+	MaxIdleConnsPerHost int
+
+	// MaxConnsPerHost limits the total number of connections per host. Zero means no limit.
+	MaxConnsPerHost int
+
+	// IdleConnTimeout is how long an idle connection is kept. Defaults to 90 seconds.
+	IdleConnTimeout time.Duration
+
+	// TLSClientConfig is used for https connections e.g. to trust a private CA or to present a
+	// client certificate.
+	TLSClientConfig *tls.Config
+
+	// DisableHTTP2 forces HTTP/1.1
+	DisableHTTP2 bool
+
+	// Proxy returns the proxy of a request. Defaults to http.ProxyFromEnvironment.
+	Proxy func(*http.Request) (*url.URL, error)
+}
+
+// NewProviderClient returns an http client configured according to opts
+func NewProviderClient(opts ProviderClientOptions) *http.Client {
+	if opts.Timeout == 0 {
+		opts.Timeout = 30 * time.Second
+	}
+	if opts.MaxIdleConns == 0 {
+		opts.MaxIdleConns = 100
+	}
+	if opts.MaxIdleConnsPerHost == 0 {
+		opts.MaxIdleConnsPerHost = 32
+	}
+	if opts.IdleConnTimeout == 0 {
+		opts.IdleConnTimeout = 90 * time.Second
+	}
+	if opts.Proxy == nil {
+		opts.Proxy = http.ProxyFromEnvironment
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = opts.Proxy
+	t.MaxIdleConns = opts.MaxIdleConns
+	t.MaxIdleConnsPerHost = opts.MaxIdleConnsPerHost
+	t.MaxConnsPerHost = opts.MaxConnsPerHost
+	t.IdleConnTimeout = opts.IdleConnTimeout
+	if opts.TLSClientConfig != nil {
+		t.TLSClientConfig = opts.TLSClientConfig
+	}
+	if opts.DisableHTTP2 {
+		t.ForceAttemptHTTP2 = false
+		t.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	return &http.Client{
+		Transport: t,
+		Timeout:   opts.Timeout,
+	}
+}
+
+var (
+	sharedClientOnce sync.Once
+	sharedClient     *http.Client
+)
+
+// defaultProviderClient returns the client shared by all providers that are not given a client
+func defaultProviderClient() *http.Client {
+	sharedClientOnce.Do(func() {
+		sharedClient = NewProviderClient(ProviderClientOptions{})
+	})
+	return sharedClient
+}
@@ -0,0 +1,153 @@
+package uma_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/go-logr/logr/testr"
+	"github.com/pckhoi/uma"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/square/go-jose.v2"
+)
+
+// newTLSIssuer starts an authorization server whose certificate is only trusted by the client of the
+// returned server, and returns a function that signs tokens with its key
+func newTLSIssuer(t *testing.T) (*httptest.Server, func(payload string) string) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	var issuer string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/uma2-configuration", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"issuer": issuer, "jwks_uri": issuer + "/certs"})
+	})
+	mux.HandleFunc("/certs", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+			{Key: key.Public(), KeyID: "k1", Algorithm: string(jose.RS256), Use: "sig"},
+		}})
+	})
+	s := httptest.NewTLSServer(mux)
+	t.Cleanup(s.Close)
+	issuer = s.URL
+	return s, func(payload string) string {
+		signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: jose.JSONWebKey{Key: key, KeyID: "k1"}}, nil)
+		require.NoError(t, err)
+		obj, err := signer.Sign([]byte(payload))
+		require.NoError(t, err)
+		s, err := obj.CompactSerialize()
+		require.NoError(t, err)
+		return s
+	}
+}
+
+func TestProviderOwnClient(t *testing.T) {
+	s1, sign1 := newTLSIssuer(t)
+	s2, sign2 := newTLSIssuer(t)
+
+	// without a KeySet, keys are fetched with the client of the provider, which is the only one that
+	// trusts the certificate of its issuer
+	p1, err := uma.NewBaseProvider(s1.URL, "client", "secret", nil, s1.Client(), testr.New(t))
+	require.NoError(t, err)
+	p2, err := uma.NewKeycloakProvider(s2.URL, "client", "secret", nil, testr.New(t), uma.WithKeycloakClient(s2.Client()))
+	require.NoError(t, err)
+
+	payload, err := p1.VerifySignature(context.Background(), sign1(`{"sub":"user-1"}`))
+	require.NoError(t, err)
+	assert.Equal(t, `{"sub":"user-1"}`, string(payload))
+	payload, err = p2.VerifySignature(context.Background(), sign2(`{"sub":"user-2"}`))
+	require.NoError(t, err)
+	assert.Equal(t, `{"sub":"user-2"}`, string(payload))
+
+	_, err = p1.VerifySignature(context.Background(), sign2(`{"sub":"user-2"}`))
+	assert.Error(t, err)
+
+	// the default client doesn't trust test certificates
+	_, err = uma.NewBaseProvider(s1.URL, "client", "secret", nil, nil, testr.New(t))
+	assert.Error(t, err)
+}
+
+func TestNewProviderClient(t *testing.T) {
+	c := uma.NewProviderClient(uma.ProviderClientOptions{})
+	assert.Equal(t, 30*time.Second, c.Timeout)
+	tr := c.Transport.(*http.Transport)
+	assert.Equal(t, 100, tr.MaxIdleConns)
+	assert.Equal(t, 32, tr.MaxIdleConnsPerHost)
+	assert.Equal(t, 0, tr.MaxConnsPerHost)
+	assert.Equal(t, 90*time.Second, tr.IdleConnTimeout)
+	assert.NotNil(t, tr.Proxy)
+	assert.True(t, tr.ForceAttemptHTTP2)
+	assert.NotSame(t, http.DefaultTransport, tr)
+
+	c = uma.NewProviderClient(uma.ProviderClientOptions{
+		Timeout:             time.Second,
+		MaxIdleConns:        10,
+		MaxIdleConnsPerHost: 5,
+		MaxConnsPerHost:     8,
+		IdleConnTimeout:     time.Minute,
+	})
+	assert.Equal(t, time.Second, c.Timeout)
+	tr = c.Transport.(*http.Transport)
+	assert.Equal(t, 10, tr.MaxIdleConns)
+	assert.Equal(t, 5, tr.MaxIdleConnsPerHost)
+	assert.Equal(t, 8, tr.MaxConnsPerHost)
+	assert.Equal(t, time.Minute, tr.IdleConnTimeout)
+}
+
+func TestNewProviderClientDisableHTTP2(t *testing.T) {
+	s := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	s.EnableHTTP2 = true
+	s.StartTLS()
+	defer s.Close()
+	tlsConfig := s.Client().Transport.(*http.Transport).TLSClientConfig
+
+	proto := func(opts uma.ProviderClientOptions) int {
+		t.Helper()
+		opts.TLSClientConfig = tlsConfig.Clone()
+		resp, err := uma.NewProviderClient(opts).Get(s.URL)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.ProtoMajor
+	}
+	assert.Equal(t, 2, proto(uma.ProviderClientOptions{}))
+	assert.Equal(t, 1, proto(uma.ProviderClientOptions{DisableHTTP2: true}))
+
+	tr := uma.NewProviderClient(uma.ProviderClientOptions{DisableHTTP2: true}).Transport.(*http.Transport)
+	assert.False(t, tr.ForceAttemptHTTP2)
+	assert.NotNil(t, tr.TLSNextProto)
+	assert.Empty(t, tr.TLSNextProto)
+}
+
+func TestKeycloakProviderClient(t *testing.T) {
+	var issuer string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		require.NoError(t, json.NewEncoder(w).Encode(map[string]string{"issuer": issuer, "token_endpoint": issuer + "/token"}))
+	}))
+	defer s.Close()
+	issuer = s.URL + "/realms/test"
+
+	// providers share one client by default
+	p1, err := uma.NewKeycloakProvider(issuer, "api", "secret", nil, logr.Discard())
+	require.NoError(t, err)
+	p2, err := uma.NewKeycloakProvider(issuer, "api", "secret", nil, logr.Discard())
+	require.NoError(t, err)
+	assert.Same(t, uma.DefaultProviderClient(), p1.HTTPClient())
+	assert.Same(t, p1.HTTPClient(), p2.HTTPClient())
+
+	p3, err := uma.NewKeycloakProvider(issuer, "api", "secret", nil, logr.Discard(),
+		uma.WithKeycloakClientOptions(uma.ProviderClientOptions{Timeout: 5 * time.Second, MaxIdleConnsPerHost: 4}),
+	)
+	require.NoError(t, err)
+	assert.NotSame(t, p1.HTTPClient(), p3.HTTPClient())
+	assert.Equal(t, 5*time.Second, p3.HTTPClient().Timeout)
+	assert.Equal(t, 4, p3.HTTPClient().Transport.(*http.Transport).MaxIdleConnsPerHost)
+}
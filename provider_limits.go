@@ -0,0 +1,193 @@
+package uma
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pckhoi/uma/pkg/clock"
+)
+
+// ProviderLimit limits the calls that the Manager makes to the authorization server of one issuer, i.e.
+// resource registrations and permission ticket requests, so that one tenant can't starve the others of a
+// shared authorization server. The zero value limits nothing.
+type ProviderLimit struct {
+	// MaxConcurrent is the number of calls that may be in flight at once. Zero means unlimited.
+	MaxConcurrent int
+
+	// MaxWait is how long a call waits for another one to finish when MaxConcurrent calls are in flight.
+	// Calls fail right away if it is zero.
+	MaxWait time.Duration
+
+	// Quota is the number of calls allowed per QuotaInterval. Zero means unlimited.
+	Quota int
+
+	// QuotaInterval defaults to 1 minute
+	QuotaInterval time.Duration
+}
+
+func (l ProviderLimit) isZero() bool {
+	return l.MaxConcurrent <= 0 && l.Quota <= 0
+}
+
+// ErrProviderLimitExceeded is returned when a call to the authorization server is rejected by
+// ManagerOptions.ProviderLimit. Requests whose resource can't be registered because of it get 503 with a
+// Retry-After header, and denied requests get a challenge without ticket.
+type ErrProviderLimitExceeded struct {
+	Issuer string
+
+	// Limit is either "concurrency" or "quota"
+	Limit string
+
+	// RetryAfter is when the call may succeed
+	RetryAfter time.Duration
+}
+
+func (err ErrProviderLimitExceeded) Error() string {
+	return fmt.Sprintf("%s limit of issuer %q exceeded, retry after %s", err.Limit, err.Issuer, err.RetryAfter)
+}
+
+// issuerLimiter enforces the ProviderLimit of one issuer. The quota is counted in fixed windows.
+type issuerLimiter struct {
+	limit       ProviderLimit
+	sem         chan struct{}
+	mu          sync.Mutex
+	windowStart time.Time
+	calls       int
+}
+
+// providerLimiter keeps an issuerLimiter per issuer
+type providerLimiter struct {
+	def      ProviderLimit
+	byIssuer map[string]ProviderLimit
+	clock    clock.Clock
+	mu       sync.Mutex
+	limiters map[string]*issuerLimiter
+}
+
+func newProviderLimiter(def ProviderLimit, byIssuer map[string]ProviderLimit, c clock.Clock) *providerLimiter {
+	if def.isZero() && len(byIssuer) == 0 {
+		return nil
+	}
+	return &providerLimiter{
+		def:      def,
+		byIssuer: byIssuer,
+		clock:    c,
+		limiters: map[string]*issuerLimiter{},
+	}
+}
+
+func (l *providerLimiter) get(issuer string) *issuerLimiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	il, ok := l.limiters[issuer]
+	if !ok {
+		limit, ok := l.byIssuer[issuer]
+		if !ok {
+			limit = l.def
+		}
+		if limit.QuotaInterval <= 0 {
+			limit.QuotaInterval = time.Minute
+		}
+		il = &issuerLimiter{limit: limit}
+		if limit.MaxConcurrent > 0 {
+			il.sem = make(chan struct{}, limit.MaxConcurrent)
+		}
+		l.limiters[issuer] = il
+	}
+	return il
+}
+
+// acquire returns a function that must be called once the call to the authorization server of issuer
+// is done, or ErrProviderLimitExceeded if the call is not allowed
+func (l *providerLimiter) acquire(ctx context.Context, issuer string) (func(), error) {
+	il := l.get(issuer)
+	if il.sem != nil {
+		if err := il.wait(ctx, issuer); err != nil {
+			return nil, err
+		}
+	}
+	release := func() {
+		if il.sem != nil {
+			<-il.sem
+		}
+	}
+	if err := il.count(l.clock.Now(), issuer); err != nil {
+		release()
+		return nil, err
+	}
+	return release, nil
+}
+
+// wait takes a slot of the semaphore, waiting up to MaxWait for one to be released
+func (il *issuerLimiter) wait(ctx context.Context, issuer string) error {
+	select {
+	case il.sem <- struct{}{}:
+		return nil
+	default:
+	}
+	exceeded := ErrProviderLimitExceeded{Issuer: issuer, Limit: "concurrency", RetryAfter: time.Second}
+	if il.limit.MaxWait <= 0 {
+		return exceeded
+	}
+	timer := time.NewTimer(il.limit.MaxWait)
+	defer timer.Stop()
+	select {
+	case il.sem <- struct{}{}:
+		return nil
+	case <-timer.C:
+		return exceeded
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// count counts a call against the quota
+func (il *issuerLimiter) count(now time.Time, issuer string) error {
+	if il.limit.Quota <= 0 {
+		return nil
+	}
+	il.mu.Lock()
+	defer il.mu.Unlock()
+	if !now.Before(il.windowStart.Add(il.limit.QuotaInterval)) {
+		il.windowStart, il.calls = now, 0
+	}
+	if il.calls >= il.limit.Quota {
+		return ErrProviderLimitExceeded{
+			Issuer:     issuer,
+			Limit:      "quota",
+			RetryAfter: il.windowStart.Add(il.limit.QuotaInterval).Sub(now),
+		}
+	}
+	il.calls++
+	return nil
+}
+
+// acquireProvider waits for the limits of the issuer of p to allow a call. The returned function must be
+// called once the call is done.
+func (m *Manager) acquireProvider(ctx context.Context, p Provider) (func(), error) {
+	if m.providerLimiter == nil {
+		return func() {}, nil
+	}
+	return m.providerLimiter.acquire(ctx, p.WWWAuthenticateDirectives().AsUri)
+}
+
+// isContextError reports whether err tells that the request was cancelled or timed out, e.g. while
+// waiting for a slot of ProviderLimit.MaxConcurrent
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// writeRetryAfterResponse responds with 503 and a Retry-After header in whole seconds
+func writeRetryAfterResponse(w http.ResponseWriter, retryAfter time.Duration) {
+	secs := int((retryAfter + time.Second - 1) / time.Second)
+	if secs < 1 {
+		secs = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(secs))
+	http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+}
@@ -0,0 +1,188 @@
+package uma_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pckhoi/uma"
+	"github.com/pckhoi/uma/pkg/clock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProviderLimitQuota(t *testing.T) {
+	c := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	p := newMockProvider(nil)
+	man := newMockManager(t, p, uma.ManagerOptions{
+		Clock:         c,
+		ProviderLimit: uma.ProviderLimit{Quota: 3},
+	})
+	h := man.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	// registration and ticket
+	rec := serve(h, http.MethodGet, "/users/1", "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Contains(t, rec.Header().Get("WWW-Authenticate"), `ticket="ticket-1"`)
+
+	// registration only, the challenge has no ticket
+	rec = serve(h, http.MethodGet, "/users/2", "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, `UMA realm="test", as_uri="https://as.example.com"`, rec.Header().Get("WWW-Authenticate"))
+
+	c.Advance(20 * time.Second)
+	rec = serve(h, http.MethodGet, "/users/3", "")
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, "40", rec.Header().Get("Retry-After"))
+
+	c.Advance(40 * time.Second)
+	rec = serve(h, http.MethodGet, "/users/3", "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Contains(t, rec.Header().Get("WWW-Authenticate"), `ticket="ticket-2"`)
+}
+
+func TestProviderLimitByIssuer(t *testing.T) {
+	p := newMockProvider(nil)
+	man := newMockManager(t, p, uma.ManagerOptions{
+		ProviderLimit:         uma.ProviderLimit{Quota: 1},
+		ProviderLimitByIssuer: map[string]uma.ProviderLimit{"https://as.example.com": {}},
+	})
+	h := man.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for _, uri := range []string{"/users/1", "/users/2", "/users/3"} {
+		rec := serve(h, http.MethodGet, uri, "")
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		assert.Contains(t, rec.Header().Get("WWW-Authenticate"), "ticket=")
+	}
+}
+
+// blockingProvider blocks resource registration until unblock is closed
+type blockingProvider struct {
+	*mockProvider
+	started chan struct{}
+	unblock chan struct{}
+}
+
+func (p *blockingProvider) CreateResource(request *uma.Resource) (*uma.ExpandedResource, error) {
+	p.started <- struct{}{}
+	<-p.unblock
+	return p.mockProvider.CreateResource(request)
+}
+
+func TestProviderLimitConcurrency(t *testing.T) {
+	p := &blockingProvider{
+		mockProvider: newMockProvider(nil),
+		started:      make(chan struct{}),
+		unblock:      make(chan struct{}),
+	}
+	man := newMockManager(t, p, uma.ManagerOptions{
+		ProviderLimit: uma.ProviderLimit{MaxConcurrent: 1},
+	})
+	h := man.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	done := make(chan int)
+	go func() {
+		done <- serve(h, http.MethodGet, "/users/1", "").Code
+	}()
+	<-p.started
+	rec := serve(h, http.MethodGet, "/users/2", "")
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, "1", rec.Header().Get("Retry-After"))
+
+	close(p.unblock)
+	assert.Equal(t, http.StatusUnauthorized, <-done)
+	go func() { <-p.started }()
+	assert.Equal(t, http.StatusUnauthorized, serve(h, http.MethodGet, "/users/2", "").Code)
+}
+
+func TestProviderLimitMaxWait(t *testing.T) {
+	p := &blockingProvider{
+		mockProvider: newMockProvider(nil),
+		started:      make(chan struct{}, 2),
+		unblock:      make(chan struct{}),
+	}
+	man := newMockManager(t, p, uma.ManagerOptions{
+		ProviderLimit: uma.ProviderLimit{MaxConcurrent: 1, MaxWait: time.Minute},
+	})
+	h := man.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	done := make(chan int)
+	go func() {
+		done <- serve(h, http.MethodGet, "/users/1", "").Code
+	}()
+	<-p.started
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		close(p.unblock)
+	}()
+	// waits for the first registration to finish
+	assert.Equal(t, http.StatusUnauthorized, serve(h, http.MethodGet, "/users/2", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, <-done)
+}
+
+// blockingTicketProvider blocks permission ticket requests until unblock is closed
+type blockingTicketProvider struct {
+	*mockProvider
+	started chan struct{}
+	unblock chan struct{}
+}
+
+func (p *blockingTicketProvider) CreatePermissionTicket(resourceID string, scopes ...string) (string, error) {
+	p.started <- struct{}{}
+	<-p.unblock
+	return p.mockProvider.CreatePermissionTicket(resourceID, scopes...)
+}
+
+func TestProviderLimitCancelled(t *testing.T) {
+	p := &blockingTicketProvider{
+		mockProvider: newMockProvider(nil),
+		started:      make(chan struct{}, 10),
+		unblock:      make(chan struct{}),
+	}
+	cache := &memResourceCache{m: map[string]string{}}
+	man := newMockManager(t, p, uma.ManagerOptions{
+		ResourceCache: cache,
+		ProviderLimit: uma.ProviderLimit{MaxConcurrent: 1, MaxWait: time.Minute},
+	})
+	h := man.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	serveWithTimeout := func(uri string, timeout time.Duration) *httptest.ResponseRecorder {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, uri, nil).WithContext(ctx))
+		return rec
+	}
+
+	// holds the only slot while its ticket is requested
+	done := make(chan int)
+	go func() {
+		done <- serve(h, http.MethodGet, "/users/1", "").Code
+	}()
+	<-p.started
+
+	// the resource is registered already, the ticket request gives up waiting for a slot
+	rec := serveWithTimeout("/users/1", 20*time.Millisecond)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, `UMA realm="test", as_uri="https://as.example.com"`, rec.Header().Get("WWW-Authenticate"))
+
+	// the registration gives up waiting for a slot, a request waiting for the same registration runs it
+	// again rather than failing too
+	cancelled := make(chan int)
+	go func() {
+		cancelled <- serveWithTimeout("/users/2", 30*time.Millisecond).Code
+	}()
+	time.Sleep(10 * time.Millisecond)
+	waiting := make(chan int)
+	go func() {
+		waiting <- serve(h, http.MethodGet, "/users/2", "").Code
+	}()
+	assert.Equal(t, http.StatusServiceUnavailable, <-cancelled)
+	_, ok, _ := cache.Get("https://as.example.com User 2")
+	assert.False(t, ok)
+
+	close(p.unblock)
+	assert.Equal(t, http.StatusUnauthorized, <-done)
+	assert.Equal(t, http.StatusUnauthorized, <-waiting)
+	id, _, _ := cache.Get("https://as.example.com User 2")
+	assert.Equal(t, "rsc-User 2", id)
+}
@@ -0,0 +1,497 @@
+package uma_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/pckhoi/uma"
+	"github.com/pckhoi/uma/pkg/httputil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type countingProvider struct {
+	uma.Provider
+	created  int32
+	fail     bool
+	existing map[string]string
+	owners   map[string]string
+	// tokens maps tokens other than "good" to their payload
+	tokens map[string]string
+}
+
+func (p *countingProvider) VerifySignature(ctx context.Context, jwt string) ([]byte, error) {
+	if payload, ok := p.tokens[jwt]; ok {
+		return []byte(payload), nil
+	}
+	if jwt != "good" {
+		return nil, errors.New("invalid signature")
+	}
+	now := time.Now().Unix()
+	return []byte(fmt.Sprintf(`{"sub":"user-1","iat":%d,"exp":%d}`, now-60, now+300)), nil
+}
+
+func (p *countingProvider) CreateResource(request *uma.Resource) (*uma.ExpandedResource, error) {
+	atomic.AddInt32(&p.created, 1)
+	time.Sleep(20 * time.Millisecond)
+	if p.fail {
+		return nil, errors.New("registration failed")
+	}
+	if p.owners != nil {
+		p.owners[request.Name] = request.Owner
+	}
+	if _, ok := p.existing[request.Name]; ok {
+		return nil, &httputil.ErrUnanticipatedResponse{Status: http.StatusConflict}
+	}
+	return &uma.ExpandedResource{ID: "id-" + request.Name, Name: request.Name}, nil
+}
+
+func (p *countingProvider) ListResources(urlQuery url.Values) ([]string, error) {
+	ids := []string{}
+	for _, id := range p.existing {
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func (p *countingProvider) GetResource(id string) (*uma.ExpandedResource, error) {
+	for name, v := range p.existing {
+		if v == id {
+			return &uma.ExpandedResource{ID: id, Name: name}, nil
+		}
+	}
+	return nil, &httputil.ErrUnanticipatedResponse{Status: http.StatusNotFound}
+}
+
+func (p *countingProvider) WWWAuthenticateDirectives() uma.WWWAuthenticateDirectives {
+	return uma.WWWAuthenticateDirectives{Realm: "test", AsUri: "https://as.example.com"}
+}
+
+type syncResourceStore struct {
+	mu sync.Mutex
+	m  map[string]string
+}
+
+func (s *syncResourceStore) Set(name, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.m[name] = id
+	return nil
+}
+
+func (s *syncResourceStore) Get(name string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.m[name], nil
+}
+
+func (s *syncResourceStore) Delete(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.m, name)
+	return nil
+}
+
+type memResourceCache struct {
+	mu sync.Mutex
+	m  map[string]string
+}
+
+func (c *memResourceCache) Get(key string) (string, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	id, ok := c.m[key]
+	return id, ok, nil
+}
+
+func (c *memResourceCache) Set(key, id string, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.m[key] = id
+	return nil
+}
+
+func (c *memResourceCache) Delete(key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.m, key)
+	return nil
+}
+
+func newCachingManager(t *testing.T, cache uma.ResourceCache) *uma.Manager {
+	return uma.New(
+		uma.ManagerOptions{ResourceCache: cache},
+		map[string]uma.ResourceType{"user": {Type: "user", ResourceScopes: []string{"read"}}},
+		[]string{"oidc"},
+		nil,
+		nil,
+		[]uma.Path{
+			uma.NewPath("/{id}", uma.NewResourceTemplate("user", "User {id}"), map[string]uma.Operation{}),
+		},
+		testr.New(t),
+	)
+}
+
+func TestResourceCache(t *testing.T) {
+	cache := &memResourceCache{m: map[string]string{}}
+	man := newCachingManager(t, cache)
+	p := &countingProvider{}
+	rs := &syncResourceStore{m: map[string]string{}}
+	baseURL := url.URL{Scheme: "https", Host: "api.example.com", Path: "/users"}
+	r := httptest.NewRequest(http.MethodGet, "https://api.example.com/users/1", nil)
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rsc, err := man.RegisterResourceAt(r, rs, p, baseURL, "/users/1")
+			assert.NoError(t, err)
+			assert.Equal(t, "id-User 1", rsc.ID)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), p.created)
+	id, ok, _ := cache.Get("https://as.example.com User 1")
+	assert.True(t, ok)
+	assert.Equal(t, "id-User 1", id)
+
+	p.fail = true
+	_, err := man.RegisterResourceAt(r, rs, p, baseURL, "/users/2")
+	require.Error(t, err)
+	_, err = man.RegisterResourceAt(r, rs, p, baseURL, "/users/2")
+	assert.ErrorAs(t, err, &uma.ErrRegistrationRecentlyFailed{})
+	assert.Equal(t, int32(2), p.created)
+}
+
+func TestRegisterResourceConflict(t *testing.T) {
+	man := newCachingManager(t, nil)
+	p := &countingProvider{existing: map[string]string{
+		"User 1": "existing-1",
+		"User 2": "existing-2",
+	}}
+	rs := &syncResourceStore{m: map[string]string{}}
+	baseURL := url.URL{Scheme: "https", Host: "api.example.com", Path: "/users"}
+	r := httptest.NewRequest(http.MethodGet, "https://api.example.com/users/2", nil)
+
+	rsc, err := man.RegisterResourceAt(r, rs, p, baseURL, "/users/2")
+	require.NoError(t, err)
+	assert.Equal(t, "existing-2", rsc.ID)
+	assert.Equal(t, "existing-2", rs.m["User 2"])
+}
+
+func TestRegisterResourceOwner(t *testing.T) {
+	man := uma.New(
+		uma.ManagerOptions{OwnerFromRequest: uma.OwnerFromClaims},
+		map[string]uma.ResourceType{"user": {Type: "user", ResourceScopes: []string{"read"}}},
+		[]string{"oidc"},
+		nil,
+		nil,
+		[]uma.Path{
+			uma.NewPath("/{id}", uma.NewResourceTemplate("user", "User {id}", uma.WithTemplateOwnerManagedAccess()), map[string]uma.Operation{}),
+		},
+		testr.New(t),
+	)
+	p := &countingProvider{owners: map[string]string{}}
+	rs := &syncResourceStore{m: map[string]string{}}
+	baseURL := url.URL{Scheme: "https", Host: "api.example.com", Path: "/users"}
+
+	r := httptest.NewRequest(http.MethodGet, "https://api.example.com/users/1", nil)
+	r.Header.Set("Authorization", "Bearer good")
+	rsc, err := man.RegisterResourceAt(r, rs, p, baseURL, "/users/1")
+	require.NoError(t, err)
+	assert.True(t, rsc.OwnerManagedAccess)
+	assert.Equal(t, "user-1", p.owners["User 1"])
+
+	r = httptest.NewRequest(http.MethodGet, "https://api.example.com/users/2", nil)
+	r.Header.Set("Authorization", "Bearer bad")
+	_, err = man.RegisterResourceAt(r, rs, p, baseURL, "/users/2")
+	require.NoError(t, err)
+	assert.Equal(t, "", p.owners["User 2"])
+}
+
+func TestRegisterResourceOwnerValidatesToken(t *testing.T) {
+	man := uma.New(
+		uma.ManagerOptions{
+			OwnerFromRequest:  uma.OwnerFromClaims,
+			ExpectedAudiences: []string{"api"},
+			TokenBinding:      &uma.TokenBinding{SessionCookie: "session"},
+		},
+		map[string]uma.ResourceType{"user": {Type: "user", ResourceScopes: []string{"read"}}},
+		[]string{"oidc"},
+		nil,
+		nil,
+		[]uma.Path{
+			uma.NewPath("/{id}", uma.NewResourceTemplate("user", "User {id}", uma.WithTemplateOwnerManagedAccess()), map[string]uma.Operation{}),
+		},
+		testr.New(t),
+	)
+	now := time.Now().Unix()
+	payload := func(aud, sid string, iat, nbf, exp int64) string {
+		return fmt.Sprintf(`{"sub":"user-1","aud":%q,"sid":%q,"iat":%d,"nbf":%d,"exp":%d}`, aud, sid, iat, nbf, exp)
+	}
+	p := &countingProvider{owners: map[string]string{}, tokens: map[string]string{
+		"valid":          payload("api", "s1", now-60, now-60, now+300),
+		"expired":        payload("api", "s1", now-600, now-600, now-300),
+		"not yet valid":  payload("api", "s1", now-60, now+60, now+300),
+		"other audience": payload("other", "s1", now-60, now-60, now+300),
+		"other session":  payload("api", "s2", now-60, now-60, now+300),
+	}}
+	rs := &syncResourceStore{m: map[string]string{}}
+	baseURL := url.URL{Scheme: "https", Host: "api.example.com", Path: "/users"}
+
+	for i, tc := range []struct {
+		token string
+		owner string
+	}{
+		{"valid", "user-1"},
+		{"expired", ""},
+		{"not yet valid", ""},
+		{"other audience", ""},
+		{"other session", ""},
+	} {
+		r := httptest.NewRequest(http.MethodGet, fmt.Sprintf("https://api.example.com/users/%d", i), nil)
+		r.Header.Set("Authorization", "Bearer "+tc.token)
+		r.AddCookie(&http.Cookie{Name: "session", Value: "s1"})
+		_, err := man.RegisterResourceAt(r, rs, p, baseURL, fmt.Sprintf("/users/%d", i))
+		require.NoError(t, err)
+		assert.Equal(t, tc.owner, p.owners[fmt.Sprintf("User %d", i)], tc.token)
+	}
+}
+
+type hashResourceStore struct {
+	syncResourceStore
+	hashes map[string]string
+}
+
+func (s *hashResourceStore) SetHash(name, hash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hashes[name] = hash
+	return nil
+}
+
+func (s *hashResourceStore) GetHash(name string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.hashes[name], nil
+}
+
+type updatingProvider struct {
+	countingProvider
+	updated []*uma.Resource
+}
+
+func (p *updatingProvider) GetResource(id string) (*uma.ExpandedResource, error) {
+	return &uma.ExpandedResource{ID: id, Owner: &uma.ResourceOwner{ID: "owner-1"}}, nil
+}
+
+func (p *updatingProvider) UpdateResource(id string, resource *uma.Resource) error {
+	p.updated = append(p.updated, resource)
+	return nil
+}
+
+func newScopesManager(t *testing.T, scopes ...string) *uma.Manager {
+	return uma.New(
+		uma.ManagerOptions{},
+		map[string]uma.ResourceType{"user": {Type: "user", ResourceScopes: scopes}},
+		[]string{"oidc"},
+		nil,
+		nil,
+		[]uma.Path{
+			uma.NewPath("/{id}", uma.NewResourceTemplate("user", "User {id}"), map[string]uma.Operation{}),
+		},
+		testr.New(t),
+	)
+}
+
+func TestRegisterResourceHash(t *testing.T) {
+	p := &updatingProvider{}
+	rs := &hashResourceStore{syncResourceStore{m: map[string]string{}}, map[string]string{}}
+	baseURL := url.URL{Scheme: "https", Host: "api.example.com", Path: "/users"}
+	r := httptest.NewRequest(http.MethodGet, "https://api.example.com/users/1", nil)
+
+	man := newScopesManager(t, "read")
+	rsc, err := man.RegisterResourceAt(r, rs, p, baseURL, "/users/1")
+	require.NoError(t, err)
+	assert.Equal(t, uma.ResourceHash(rsc), rs.hashes["User 1"])
+	_, err = man.RegisterResourceAt(r, rs, p, baseURL, "/users/1")
+	require.NoError(t, err)
+	assert.Empty(t, p.updated)
+
+	// scopes changed, e.g. with a new deployment
+	man = newScopesManager(t, "read", "write")
+	rsc, err = man.RegisterResourceAt(r, rs, p, baseURL, "/users/1")
+	require.NoError(t, err)
+	assert.Equal(t, "id-User 1", rsc.ID)
+	require.Len(t, p.updated, 1)
+	assert.Equal(t, []string{"read", "write"}, p.updated[0].ResourceScopes)
+	assert.Equal(t, "owner-1", p.updated[0].Owner)
+	assert.Equal(t, uma.ResourceHash(rsc), rs.hashes["User 1"])
+	_, err = man.RegisterResourceAt(r, rs, p, baseURL, "/users/1")
+	require.NoError(t, err)
+	assert.Len(t, p.updated, 1)
+
+	// registrations stored without hash are assumed to be out of date
+	rs.m["User 2"] = "id-User 2"
+	_, err = man.RegisterResourceAt(r, rs, p, baseURL, "/users/2")
+	require.NoError(t, err)
+	assert.Len(t, p.updated, 2)
+	assert.Equal(t, int32(1), p.created)
+}
+
+func TestResourceHash(t *testing.T) {
+	rsc := &uma.Resource{ResourceType: uma.ResourceType{Type: "user", ResourceScopes: []string{"read"}}, Name: "User 1"}
+	hash := uma.ResourceHash(rsc)
+	assert.Len(t, hash, 64)
+
+	other := *rsc
+	other.ID, other.Owner = "id-1", "owner-1"
+	assert.Equal(t, hash, uma.ResourceHash(&other))
+	other.URI = "/users/1"
+	assert.NotEqual(t, hash, uma.ResourceHash(&other))
+	other = *rsc
+	other.Type = "admin"
+	assert.NotEqual(t, hash, uma.ResourceHash(&other))
+}
+
+// racingResourceStore behaves like a store with conditional writes that another replica wrote to first
+type racingResourceStore struct {
+	syncResourceStore
+	winner string
+}
+
+func (s *racingResourceStore) Set(name, id string) error {
+	return uma.ErrStoredResourceConflict{Name: name, ID: s.winner}
+}
+
+func TestRegisterResourceStoredConflict(t *testing.T) {
+	p := newMockProvider(nil)
+	rs := &racingResourceStore{syncResourceStore{m: map[string]string{}}, "id-winner"}
+	man := newMockManager(t, p, uma.ManagerOptions{})
+	baseURL := url.URL{Scheme: "https", Host: "api.example.com", Path: "/users"}
+	r := httptest.NewRequest(http.MethodGet, "https://api.example.com/users/1", nil)
+
+	rsc, err := man.RegisterResourceAt(r, rs, p, baseURL, "/users/1")
+	require.NoError(t, err)
+	assert.Equal(t, "id-winner", rsc.ID)
+	// the duplicate registration is deleted
+	assert.Equal(t, []string{"rsc-User 1"}, p.deleted)
+}
+
+func TestEnforceRegistrationRecentlyFailed(t *testing.T) {
+	cache := &memResourceCache{m: map[string]string{"https://as.example.com User 1": ""}}
+	man := newMockManager(t, newMockProvider(nil), uma.ManagerOptions{
+		ResourceCache:            cache,
+		ResourceCacheNegativeTTL: 30 * time.Second,
+	})
+	h := man.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	rec := serve(h, http.MethodGet, "/users/1", "")
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, "30", rec.Header().Get("Retry-After"))
+}
+
+// panickingProvider panics on the first resource registration once unblock is closed
+type panickingProvider struct {
+	*mockProvider
+	calls   int32
+	started chan struct{}
+	unblock chan struct{}
+}
+
+func (p *panickingProvider) CreateResource(request *uma.Resource) (*uma.ExpandedResource, error) {
+	if atomic.AddInt32(&p.calls, 1) == 1 {
+		close(p.started)
+		<-p.unblock
+		panic("registration exploded")
+	}
+	return p.mockProvider.CreateResource(request)
+}
+
+func TestRegisterResourcePanic(t *testing.T) {
+	man := newCachingManager(t, nil)
+	p := &panickingProvider{
+		mockProvider: newMockProvider(nil),
+		started:      make(chan struct{}),
+		unblock:      make(chan struct{}),
+	}
+	rs := &syncResourceStore{m: map[string]string{}}
+	baseURL := url.URL{Scheme: "https", Host: "api.example.com", Path: "/users"}
+	r := httptest.NewRequest(http.MethodGet, "https://api.example.com/users/1", nil)
+
+	panicked := make(chan interface{})
+	go func() {
+		defer func() { panicked <- recover() }()
+		_, _ = man.RegisterResourceAt(r, rs, p, baseURL, "/users/1")
+	}()
+	<-p.started
+	waited := make(chan error)
+	go func() {
+		_, err := man.RegisterResourceAt(r, rs, p, baseURL, "/users/1")
+		waited <- err
+	}()
+	// let the second registration join the flight of the first one
+	time.Sleep(20 * time.Millisecond)
+	close(p.unblock)
+	assert.Equal(t, "registration exploded", <-panicked)
+	select {
+	case err := <-waited:
+		assert.Error(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("waiter was not released")
+	}
+
+	// the next registration runs again
+	rsc, err := man.RegisterResourceAt(r, rs, p, baseURL, "/users/1")
+	require.NoError(t, err)
+	assert.Equal(t, "rsc-User 1", rsc.ID)
+}
+
+func TestRegisterResourceTemplateProperties(t *testing.T) {
+	man := uma.New(
+		uma.ManagerOptions{},
+		map[string]uma.ResourceType{"user": {
+			Type:           "user",
+			DisplayName:    "User",
+			Description:    "A user",
+			ResourceScopes: []string{"read"},
+		}},
+		[]string{"oidc"},
+		nil,
+		nil,
+		[]uma.Path{
+			uma.NewPath("/{id}", uma.NewResourceTemplate("user", "User {id}",
+				uma.WithTemplateDisplayName("User #{id}"),
+				uma.WithTemplateDescription("Account of user {id}"),
+			), map[string]uma.Operation{}),
+			uma.NewPath("/{id}/avatar", uma.NewResourceTemplate("user", "Avatar {id}"), map[string]uma.Operation{}),
+		},
+		testr.New(t),
+	)
+	p := &countingProvider{}
+	rs := &syncResourceStore{m: map[string]string{}}
+	baseURL := url.URL{Scheme: "https", Host: "api.example.com", Path: "/users"}
+	r := httptest.NewRequest(http.MethodGet, "https://api.example.com/users/1", nil)
+
+	rsc, err := man.RegisterResourceAt(r, rs, p, baseURL, "/users/1")
+	require.NoError(t, err)
+	assert.Equal(t, "User 1", rsc.Name)
+	assert.Equal(t, "User #1", rsc.DisplayName)
+	assert.Equal(t, "Account of user 1", rsc.Description)
+
+	// without template options, properties of the resource type are used
+	rsc, err = man.RegisterResourceAt(r, rs, p, baseURL, "/users/1/avatar")
+	require.NoError(t, err)
+	assert.Equal(t, "Avatar 1", rsc.Name)
+	assert.Equal(t, "User", rsc.DisplayName)
+	assert.Equal(t, "A user", rsc.Description)
+}
@@ -0,0 +1,124 @@
+package uma
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/pckhoi/uma/pkg/httputil"
+)
+
+// ReloadConfig is the document loaded by Manager.Reload
+type ReloadConfig struct {
+	// Matcher holds resource types, path templates and security requirements, in the format produced by
+	// json.Marshal(matcher). It is required.
+	Matcher *Matcher `json:"matcher"`
+
+	// Overrides if present, replace all overrides of ManagerOptions.Templates. They are ignored if
+	// ManagerOptions.Templates is not set.
+	Overrides map[string]TemplateOptions `json:"overrides,omitempty"`
+}
+
+// ConfigSource returns the JSON encoded ReloadConfig
+type ConfigSource func(ctx context.Context) ([]byte, error)
+
+// FileConfigSource reads the config from a file
+func FileConfigSource(name string) ConfigSource {
+	return func(ctx context.Context) ([]byte, error) {
+		return os.ReadFile(name)
+	}
+}
+
+// HTTPConfigSource gets the config from url. If client is nil, http.DefaultClient is used.
+func HTTPConfigSource(client *http.Client, url string) ConfigSource {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return func(ctx context.Context) ([]byte, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", "application/json")
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if err := httputil.Ensure2XX(resp); err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		return io.ReadAll(resp.Body)
+	}
+}
+
+// Reload loads the config from src and atomically swaps the matcher of this Manager. Requests that are
+// being decided keep using the previous matcher. Resources that are already registered are not updated.
+func (m *Manager) Reload(ctx context.Context, src ConfigSource) error {
+	b, err := src(ctx)
+	if err != nil {
+		return err
+	}
+	return m.reload(b)
+}
+
+func (m *Manager) reload(b []byte) error {
+	conf := &ReloadConfig{}
+	if err := json.Unmarshal(b, conf); err != nil {
+		return err
+	}
+	if conf.Matcher == nil {
+		return errors.New("reload config has no matcher")
+	}
+	m.matcher.Store(conf.Matcher)
+	if m.templates != nil && conf.Overrides != nil {
+		m.templates.Replace(conf.Overrides)
+	}
+	return nil
+}
+
+// WatchConfig reloads the config from src whenever the process receives SIGHUP and, if interval is greater
+// than zero, every interval. The config is only applied if it has changed since the last reload. Errors
+// are logged and the current config is kept. WatchConfig blocks until ctx is done, so it is usually run in
+// its own goroutine.
+func (m *Manager) WatchConfig(ctx context.Context, src ConfigSource, interval time.Duration) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGHUP)
+	defer signal.Stop(sig)
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	var last []byte
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sig:
+		case <-tick:
+		}
+		b, err := src(ctx)
+		if err != nil {
+			m.logger.Error(err, "error loading config")
+			continue
+		}
+		if last != nil && bytes.Equal(b, last) {
+			continue
+		}
+		if err := m.reload(b); err != nil {
+			m.logger.Error(err, "error reloading config")
+			continue
+		}
+		last = b
+		m.logger.Info("config reloaded")
+	}
+}
@@ -0,0 +1,108 @@
+package uma_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pckhoi/uma"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func reloadConfig(t *testing.T, getScope string, overrides map[string]uma.TemplateOptions) []byte {
+	t.Helper()
+	b, err := json.Marshal(uma.ReloadConfig{
+		Matcher: uma.NewMatcher(
+			map[string]uma.ResourceType{
+				"user": {Type: "user", ResourceScopes: []string{"read", "write"}},
+			},
+			[]string{"oidc"},
+			nil,
+			[]map[string][]string{{"oidc": {getScope}}},
+			[]uma.Path{
+				uma.NewPath("/{id}", uma.NewResourceTemplate("user", "User {id}"), map[string]uma.Operation{
+					http.MethodGet: {},
+				}),
+			},
+		),
+		Overrides: overrides,
+	})
+	require.NoError(t, err)
+	return b
+}
+
+func TestManagerReload(t *testing.T) {
+	p := newMockProvider(map[string]string{
+		"token-1": rptPayload("user-1", "User 1", "read"),
+	})
+	tmpls := uma.NewTemplates()
+	man := newMockManager(t, p, uma.ManagerOptions{Templates: tmpls})
+	h := man.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	get := func() int {
+		return serve(h, http.MethodGet, "https://api.example.com/users/1", "token-1").Code
+	}
+	assert.Equal(t, http.StatusOK, get())
+
+	name := filepath.Join(t.TempDir(), "uma.json")
+	require.NoError(t, os.WriteFile(name, reloadConfig(t, "write", nil), 0644))
+	require.NoError(t, man.Reload(context.Background(), uma.FileConfigSource(name)))
+	assert.Equal(t, http.StatusUnauthorized, get())
+
+	require.NoError(t, os.WriteFile(name, reloadConfig(t, "write", map[string]uma.TemplateOptions{
+		"/{id}": {Public: true},
+	}), 0644))
+	require.NoError(t, man.Reload(context.Background(), uma.FileConfigSource(name)))
+	assert.Equal(t, http.StatusOK, serve(h, http.MethodGet, "https://api.example.com/users/1", "").Code)
+	_, ok := tmpls.Options("/{id}")
+	assert.True(t, ok)
+
+	// invalid configs are rejected and the current matcher is kept
+	require.NoError(t, os.WriteFile(name, []byte(`{"overrides":{}}`), 0644))
+	assert.EqualError(t, man.Reload(context.Background(), uma.FileConfigSource(name)), "reload config has no matcher")
+	_, ok = tmpls.Options("/{id}")
+	assert.True(t, ok)
+	assert.Error(t, man.Reload(context.Background(), uma.FileConfigSource(filepath.Join(t.TempDir(), "missing.json"))))
+}
+
+func TestManagerWatchConfig(t *testing.T) {
+	p := newMockProvider(map[string]string{
+		"token-1": rptPayload("user-1", "User 1", "read"),
+	})
+	man := newMockManager(t, p, uma.ManagerOptions{})
+	h := man.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	get := func() int {
+		return serve(h, http.MethodGet, "https://api.example.com/users/1", "token-1").Code
+	}
+
+	var conf atomic.Value
+	conf.Store(reloadConfig(t, "read", nil))
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(conf.Load().([]byte))
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		man.WatchConfig(ctx, uma.HTTPConfigSource(nil, srv.URL), 10*time.Millisecond)
+		close(done)
+	}()
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&hits) > 0 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, http.StatusOK, get())
+
+	conf.Store(reloadConfig(t, "write", nil))
+	assert.Eventually(t, func() bool { return get() == http.StatusUnauthorized }, time.Second, 5*time.Millisecond)
+
+	cancel()
+	<-done
+}
@@ -0,0 +1,60 @@
+package uma
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+const defaultMaxBufferedBodySize int64 = 1 << 20
+
+// ErrRequestBodyTooLarge is returned when a request body exceeds ManagerOptions.MaxBufferedBodySize
+type ErrRequestBodyTooLarge struct {
+	Limit int64
+}
+
+func (err ErrRequestBodyTooLarge) Error() string {
+	return fmt.Sprintf("request body exceeds %d bytes", err.Limit)
+}
+
+// readBody reads at most limit bytes of request body into memory
+func readBody(r *http.Request, limit int64) ([]byte, error) {
+	defer r.Body.Close()
+	b, err := io.ReadAll(io.LimitReader(r.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(b)) > limit {
+		return nil, ErrRequestBodyTooLarge{Limit: limit}
+	}
+	return b, nil
+}
+
+// resourceFromRequestBody invokes the ResourceFromBody hook. The request body is buffered so that
+// the hook and the next handler can both read it from the beginning.
+func (m *Manager) resourceFromRequestBody(r *http.Request) (*Resource, error) {
+	if r.Body != nil && r.Body != http.NoBody {
+		b, err := readBody(r, m.maxBufferedBodySize)
+		if err != nil {
+			return nil, err
+		}
+		rewind := func() {
+			r.Body = io.NopCloser(bytes.NewReader(b))
+		}
+		rewind()
+		defer rewind()
+		r.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(b)), nil
+		}
+	}
+	rsc, err := m.resourceFromBody(r)
+	if err != nil || rsc == nil {
+		return nil, err
+	}
+	if m.nameStrategy != nil {
+		rsc.Name = m.nameStrategy.ResourceName(*rsc, nil)
+	}
+	rsc.Name = NamespacedName(m.namespace, rsc.Name)
+	return rsc, nil
+}
@@ -0,0 +1,87 @@
+package uma_test
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/pckhoi/uma"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResourceFromBody(t *testing.T) {
+	var enforced uma.Resource
+	man := uma.New(
+		uma.ManagerOptions{
+			GetBaseURL: func(r *http.Request) url.URL {
+				return url.URL{Scheme: "https", Host: "api.example.com", Path: "/rpc"}
+			},
+			CustomEnforce: func(r *http.Request, resource uma.Resource, scopes []string) bool {
+				enforced = resource
+				return true
+			},
+			ResourceFromBody: func(r *http.Request) (*uma.Resource, error) {
+				obj := struct {
+					DocID string `json:"docId"`
+				}{}
+				if err := json.NewDecoder(r.Body).Decode(&obj); err != nil {
+					return nil, err
+				}
+				if obj.DocID == "" {
+					return nil, nil
+				}
+				if obj.DocID == "invalid" {
+					return nil, errors.New("invalid doc id")
+				}
+				return &uma.Resource{
+					ResourceType: uma.ResourceType{Type: "doc"},
+					Name:         "Doc " + obj.DocID,
+				}, nil
+			},
+			MaxBufferedBodySize: 100,
+		},
+		map[string]uma.ResourceType{"rpc": {Type: "rpc"}},
+		[]string{"oidc"},
+		nil,
+		[]map[string][]string{{"oidc": {"call"}}},
+		[]uma.Path{
+			uma.NewPath("/{method}", uma.NewResourceTemplate("rpc", "RPC {method}"), map[string]uma.Operation{
+				http.MethodPost: {},
+			}),
+		},
+		testr.New(t),
+	)
+	var body string
+	h := man.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		body = string(b)
+	}))
+	post := func(reqBody string) int {
+		enforced, body = uma.Resource{}, ""
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "https://api.example.com/rpc/getDoc", strings.NewReader(reqBody)))
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusOK, post(`{"docId":"42"}`))
+	assert.Equal(t, "Doc 42", enforced.Name)
+	assert.Equal(t, `{"docId":"42"}`, body)
+
+	assert.Equal(t, http.StatusOK, post(`{}`))
+	assert.Equal(t, "RPC getDoc", enforced.Name)
+	assert.Equal(t, `{}`, body)
+
+	assert.Equal(t, http.StatusBadRequest, post(`{"docId":"invalid"}`))
+	assert.Empty(t, enforced.Name)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, post(`{"docId":"`+strings.Repeat("1", 100)+`"}`))
+	assert.Empty(t, enforced.Name)
+}
@@ -2,9 +2,45 @@ package uma
 
 import (
 	"context"
+	"encoding/json"
 	"net/http"
 )
 
+// ScopeDescription describes a scope. Learn more at
+// https://docs.kantarainitiative.org/uma/wg/rec-oauth-uma-federated-authz-2.0.html#scope-desc
+type ScopeDescription struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	IconUri     string `json:"icon_uri,omitempty"`
+
+	// DisplayName is the human readable name shown to resource owners in Keycloak
+	DisplayName string `json:"displayName,omitempty"`
+}
+
+// described reports whether s has more than a name
+func (s ScopeDescription) described() bool {
+	return s.Description != "" || s.IconUri != "" || s.DisplayName != ""
+}
+
+// MarshalJSON renders a scope that has nothing but a name as a plain string
+func (s ScopeDescription) MarshalJSON() ([]byte, error) {
+	if !s.described() {
+		return json.Marshal(s.Name)
+	}
+	type desc ScopeDescription
+	return json.Marshal(desc(s))
+}
+
+// UnmarshalJSON accepts a scope name as well as a scope description object
+func (s *ScopeDescription) UnmarshalJSON(b []byte) error {
+	if len(b) > 0 && b[0] == '"' {
+		*s = ScopeDescription{}
+		return json.Unmarshal(b, &s.Name)
+	}
+	type desc ScopeDescription
+	return json.Unmarshal(b, (*desc)(s))
+}
+
 // ResourceType describes and provides defaults for an UMA resource. Learn more at
 // https://docs.kantarainitiative.org/uma/wg/oauth-uma-federated-authz-2.0-09.html#resource-set-desc
 type ResourceType struct {
@@ -12,6 +48,63 @@ type ResourceType struct {
 	Description    string   `json:"description,omitempty"`
 	IconUri        string   `json:"icon_uri,omitempty"`
 	ResourceScopes []string `json:"resource_scopes,omitempty"`
+
+	// DisplayName is the human readable name shown to resource owners e.g. in Keycloak's
+	// account console
+	DisplayName string `json:"displayName,omitempty"`
+
+	// ScopeDescriptions describes scopes of ResourceScopes by name. When rendered as JSON, described
+	// scopes are scope description objects while other scopes remain plain names.
+	ScopeDescriptions map[string]ScopeDescription `json:"-"`
+}
+
+// scopeDescriptions returns ResourceScopes in order, described with ScopeDescriptions
+func (t ResourceType) scopeDescriptions() []ScopeDescription {
+	if len(t.ResourceScopes) == 0 {
+		return nil
+	}
+	res := make([]ScopeDescription, len(t.ResourceScopes))
+	for i, name := range t.ResourceScopes {
+		res[i] = t.ScopeDescriptions[name]
+		res[i].Name = name
+	}
+	return res
+}
+
+// setScopeDescriptions is the reverse of scopeDescriptions
+func (t *ResourceType) setScopeDescriptions(scopes []ScopeDescription) {
+	t.ResourceScopes, t.ScopeDescriptions = nil, nil
+	for _, s := range scopes {
+		t.ResourceScopes = append(t.ResourceScopes, s.Name)
+		if s.described() {
+			if t.ScopeDescriptions == nil {
+				t.ScopeDescriptions = map[string]ScopeDescription{}
+			}
+			t.ScopeDescriptions[s.Name] = s
+		}
+	}
+}
+
+// resourceTypeFields has the fields but not the methods of ResourceType
+type resourceTypeFields ResourceType
+
+type resourceTypeJSON struct {
+	resourceTypeFields
+	ResourceScopes []ScopeDescription `json:"resource_scopes,omitempty"`
+}
+
+func (t ResourceType) MarshalJSON() ([]byte, error) {
+	return json.Marshal(resourceTypeJSON{resourceTypeFields(t), t.scopeDescriptions()})
+}
+
+func (t *ResourceType) UnmarshalJSON(b []byte) error {
+	obj := &resourceTypeJSON{}
+	if err := json.Unmarshal(b, obj); err != nil {
+		return err
+	}
+	*t = ResourceType(obj.resourceTypeFields)
+	t.setScopeDescriptions(obj.ResourceScopes)
+	return nil
 }
 
 // Resource describes an UMA resource. This object when rendered as JSON, can be
@@ -29,6 +122,71 @@ type Resource struct {
 	Owner              string `json:"owner,omitempty"`
 	OwnerManagedAccess bool   `json:"ownerManagedAccess,omitempty"`
 	URI                string `json:"uri,omitempty"`
+
+	// includeScopes is set by the Manager if the matched operation overrides
+	// IncludeScopesInPermissionTicket
+	includeScopes *bool
+}
+
+// resourceJSON has the fields of Resource. Resource needs its own JSON methods, otherwise those of the
+// embedded ResourceType would be promoted and render only the ResourceType fields.
+type resourceJSON struct {
+	resourceTypeJSON
+	ID                 string `json:"_id,omitempty"`
+	Name               string `json:"name,omitempty"`
+	Owner              string `json:"owner,omitempty"`
+	OwnerManagedAccess bool   `json:"ownerManagedAccess,omitempty"`
+	URI                string `json:"uri,omitempty"`
+}
+
+func (r Resource) MarshalJSON() ([]byte, error) {
+	return json.Marshal(resourceJSON{
+		resourceTypeJSON:   resourceTypeJSON{resourceTypeFields(r.ResourceType), r.scopeDescriptions()},
+		ID:                 r.ID,
+		Name:               r.Name,
+		Owner:              r.Owner,
+		OwnerManagedAccess: r.OwnerManagedAccess,
+		URI:                r.URI,
+	})
+}
+
+func (r *Resource) UnmarshalJSON(b []byte) error {
+	obj := &resourceJSON{}
+	if err := json.Unmarshal(b, obj); err != nil {
+		return err
+	}
+	r.ResourceType = ResourceType(obj.resourceTypeFields)
+	r.setScopeDescriptions(obj.ResourceScopes)
+	r.ID = obj.ID
+	r.Name = obj.Name
+	r.Owner = obj.Owner
+	r.OwnerManagedAccess = obj.OwnerManagedAccess
+	r.URI = obj.URI
+	return nil
+}
+
+// specResource is the resource description of the UMA 2.0 spec, with scopes as plain names and without
+// Keycloak only fields, for authorization servers that reject anything else
+type specResource struct {
+	Name           string   `json:"name"`
+	Type           string   `json:"type,omitempty"`
+	Description    string   `json:"description,omitempty"`
+	IconUri        string   `json:"icon_uri,omitempty"`
+	ResourceScopes []string `json:"resource_scopes"`
+}
+
+func newSpecResource(rsc *Resource) specResource {
+	scopes := rsc.ResourceScopes
+	if scopes == nil {
+		scopes = []string{}
+	}
+	return specResource{
+		Name:           rsc.Name,
+		Type:           rsc.Type,
+		Description:    rsc.Description,
+		IconUri:        rsc.IconUri,
+		ResourceScopes: scopes,
+	}
 }
 
 type resourceKey struct{}
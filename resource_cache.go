@@ -0,0 +1,115 @@
+package uma
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	defaultResourceCacheTTL         = 24 * time.Hour
+	defaultResourceCacheNegativeTTL = 10 * time.Second
+)
+
+// ResourceCache caches resource ids in a location shared by all replicas of the resource server.
+// It is consulted before the ResourceStore and the provider, so that replicas don't have to look
+// up or register the same resources over and over again.
+// Cache keys are made of the issuer followed by a space and the resource name.
+type ResourceCache interface {
+	// Get returns the cached resource id of the given key. If the key is not cached, ok is
+	// false. An empty id with ok being true is a negative entry, meaning registration of this
+	// resource failed recently and should not be retried yet.
+	Get(key string) (id string, ok bool, err error)
+
+	// Set caches resource id for the given duration. An empty id denotes a negative entry.
+	Set(key, id string, ttl time.Duration) error
+}
+
+// ErrRegistrationRecentlyFailed is returned when a negative entry is found in the ResourceCache
+type ErrRegistrationRecentlyFailed struct {
+	Name string
+	// RetryAfter is an upper bound of how long the negative entry is kept, the remaining TTL is not
+	// known to the Manager
+	RetryAfter time.Duration
+}
+
+func (err ErrRegistrationRecentlyFailed) Error() string {
+	return fmt.Sprintf("registration of resource %q failed recently", err.Name)
+}
+
+var errFlightPanicked = errors.New("registration panicked")
+
+type flightCall struct {
+	wg  sync.WaitGroup
+	val string
+	err error
+}
+
+// flightGroup makes sure concurrent calls with the same key are only executed once
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+func (g *flightGroup) do(key string, fn func() (string, error)) (string, error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = map[string]*flightCall{}
+	}
+	if c, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		c.wg.Wait()
+		return c.val, c.err
+	}
+	c := &flightCall{}
+	c.wg.Add(1)
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	// waiters are released even if fn panics, they get the zero result along with errFlightPanicked
+	c.err = errFlightPanicked
+	defer func() {
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		c.wg.Done()
+	}()
+	c.val, c.err = fn()
+	return c.val, c.err
+}
+
+// MemoryResourceCache is an in-memory ResourceCache that holds at most size entries. Unlike shared
+// caches, it only spares lookups of the replica it runs in. It implements ResourceCacheDeleter and
+// CacheControl.
+type MemoryResourceCache struct {
+	lru *lruCache[string]
+}
+
+// NewMemoryResourceCache creates a MemoryResourceCache that holds at most size entries
+func NewMemoryResourceCache(size int) *MemoryResourceCache {
+	return &MemoryResourceCache{lru: newLRUCache[string](size)}
+}
+
+func (c *MemoryResourceCache) Get(key string) (id string, ok bool, err error) {
+	id, ok = c.lru.get(key)
+	return id, ok, nil
+}
+
+func (c *MemoryResourceCache) Set(key, id string, ttl time.Duration) error {
+	c.lru.set(key, id, ttl)
+	return nil
+}
+
+func (c *MemoryResourceCache) Delete(key string) error {
+	c.lru.remove(key)
+	return nil
+}
+
+func (c *MemoryResourceCache) Stats() CacheStats {
+	return c.lru.Stats()
+}
+
+func (c *MemoryResourceCache) Purge(prefix string) int {
+	return c.lru.Purge(prefix)
+}
@@ -0,0 +1,83 @@
+package uma
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+)
+
+// ResourceHashStore is implemented by ResourceStore implementations that can persist a hash of the
+// resource definition next to the resource id. With it, the Manager detects resources whose scopes, type
+// or URI changed since they were registered, e.g. after an updated spec is deployed, and updates their
+// registration instead of reusing the out-of-date one. Resources whose id is found in the ResourceCache
+// are not checked until the entry expires, purge the cache with Manager.Caches to check them right away.
+type ResourceHashStore interface {
+	// SetHash sets the hash of the definition of the resource with given name
+	SetHash(name, hash string) error
+
+	// GetHash gets the hash set with SetHash, or an empty string if there is none, in which case the
+	// registration is assumed to be out of date
+	GetHash(name string) (hash string, err error)
+}
+
+// ResourceHash returns the hash of the definition of rsc that is compared against ResourceHashStore. It
+// covers the fields sent to the authorization server except for the id and the owner, which are not part
+// of the definition.
+func ResourceHash(rsc *Resource) string {
+	def := *rsc
+	def.ID, def.Owner = "", ""
+	b, err := json.Marshal(def)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// updateIfChanged updates the registration of resource id if the hash saved in rs under key differs from
+// the hash of rsc. It does nothing if rs doesn't implement ResourceHashStore.
+func (m *Manager) updateIfChanged(rs ResourceStore, p Provider, key, id string, rsc *Resource) error {
+	hs, ok := rs.(ResourceHashStore)
+	if !ok {
+		return nil
+	}
+	hash := ResourceHash(rsc)
+	stored, err := hs.GetHash(key)
+	if err != nil {
+		return err
+	}
+	if stored == hash {
+		return nil
+	}
+	update := *rsc
+	if update.Owner == "" {
+		// keep the owner, which Keycloak would otherwise reset to the resource server
+		registered, err := p.GetResource(id)
+		if err != nil {
+			return err
+		}
+		if registered.Owner != nil {
+			update.Owner = registered.Owner.ID
+		}
+	}
+	if err := p.UpdateResource(id, &update); err != nil {
+		return err
+	}
+	if err := hs.SetHash(key, hash); err != nil {
+		return err
+	}
+	m.logger.Info("updated out-of-date resource",
+		"id", id,
+		"name", rsc.Name,
+		"uri", rsc.URI,
+	)
+	return nil
+}
+
+// setHash records the hash of a newly registered rsc under key if rs implements ResourceHashStore
+func setHash(rs ResourceStore, key string, rsc *Resource) error {
+	if hs, ok := rs.(ResourceHashStore); ok {
+		return hs.SetHash(key, ResourceHash(rsc))
+	}
+	return nil
+}
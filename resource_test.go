@@ -0,0 +1,52 @@
+package uma_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/pckhoi/uma"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResourceScopeDescriptionsJSON(t *testing.T) {
+	rsc := uma.Resource{
+		ResourceType: uma.ResourceType{
+			Type:           "user",
+			ResourceScopes: []string{"read", "write"},
+			ScopeDescriptions: map[string]uma.ScopeDescription{
+				"write": {Description: "Update a user", IconUri: "https://example.com/write.png"},
+			},
+		},
+		Name: "User 1",
+		URI:  "https://api.example.com/users/1",
+	}
+	b, err := json.Marshal(rsc)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"type": "user",
+		"name": "User 1",
+		"uri": "https://api.example.com/users/1",
+		"resource_scopes": [
+			"read",
+			{"name": "write", "description": "Update a user", "icon_uri": "https://example.com/write.png"}
+		]
+	}`, string(b))
+
+	decoded := uma.Resource{}
+	require.NoError(t, json.Unmarshal(b, &decoded))
+	rsc.ScopeDescriptions["write"] = uma.ScopeDescription{
+		Name:        "write",
+		Description: "Update a user",
+		IconUri:     "https://example.com/write.png",
+	}
+	assert.Equal(t, rsc, decoded)
+
+	// plain scope names are still accepted and rendered as is
+	rt := uma.ResourceType{}
+	require.NoError(t, json.Unmarshal([]byte(`{"type":"user","resource_scopes":["read","write"]}`), &rt))
+	assert.Equal(t, uma.ResourceType{Type: "user", ResourceScopes: []string{"read", "write"}}, rt)
+	b, err = json.Marshal(rt)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"type":"user","resource_scopes":["read","write"]}`, string(b))
+}
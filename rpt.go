@@ -0,0 +1,124 @@
+package uma
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// RPT is a parsed requesting party token payload
+type RPT struct {
+	Claims
+
+	// Raw holds every claim of the token, including those not defined in Claims
+	Raw map[string]interface{}
+}
+
+// ParseRPT parses the payload of a requesting party token, e.g. as returned by Provider.VerifySignature.
+// It does not verify anything.
+func ParseRPT(payload []byte) (*RPT, error) {
+	rpt := &RPT{}
+	// aud can be an array, which Claims.Aud can't hold
+	claims := struct {
+		*Claims
+		Aud json.RawMessage `json:"aud,omitempty"`
+	}{Claims: &rpt.Claims}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("error parsing rpt: %w", err)
+	}
+	if err := json.Unmarshal(payload, &rpt.Raw); err != nil {
+		return nil, fmt.Errorf("error parsing rpt: %w", err)
+	}
+	if auds := rpt.Audiences(); len(auds) > 0 {
+		rpt.Aud = auds[0]
+	}
+	return rpt, nil
+}
+
+// Permissions returns all permissions granted by the token
+func (t *RPT) Permissions() []Permission {
+	if t.Authorization == nil {
+		return nil
+	}
+	return t.Authorization.Permissions
+}
+
+// Permission returns the permission granted on resource with the given id
+func (t *RPT) Permission(resourceID string) (perm Permission, ok bool) {
+	for _, p := range t.Permissions() {
+		if p.Rsid == resourceID {
+			return p, true
+		}
+	}
+	return
+}
+
+// PermissionByName returns the permission granted on resource with the given name. Resource names
+// are only included if they were requested, e.g. with rp.RPTRequest.ResponseIncludeResourceName.
+func (t *RPT) PermissionByName(name string) (perm Permission, ok bool) {
+	for _, p := range t.Permissions() {
+		if p.Rsname == name {
+			return p, true
+		}
+	}
+	return
+}
+
+// checkPermissionName returns ErrInvalidRPT if the permission of rpt for the id of rsc names another
+// resource, or has no name and required is true. It returns nil if rpt has no permission for rsc.
+func checkPermissionName(rpt *RPT, rsc *Resource, required bool) error {
+	p, ok := rpt.Permission(rsc.ID)
+	switch {
+	case !ok:
+		return nil
+	case p.Rsname == "" && required:
+		return ErrInvalidRPT{Reason: RPTUnnamedPermission, ResourceID: rsc.ID}
+	case p.Rsname != "" && p.Rsname != rsc.Name:
+		return ErrInvalidRPT{Reason: RPTResourceMismatch, ResourceID: rsc.ID, Name: p.Rsname}
+	}
+	return nil
+}
+
+// ResourceIDs returns ids of all resources that the token grants permissions on
+func (t *RPT) ResourceIDs() []string {
+	perms := t.Permissions()
+	ids := make([]string, 0, len(perms))
+	for _, p := range perms {
+		ids = append(ids, p.Rsid)
+	}
+	return ids
+}
+
+// HasScopes returns true if the token grants all given scopes on resource with the given id
+func (t *RPT) HasScopes(resourceID string, scopes ...string) bool {
+	p, ok := t.Permission(resourceID)
+	return ok && missingScope(p.Scopes, scopes) == ""
+}
+
+// IssuedAt returns the time the token was issued, or zero time if the token has no iat claim
+func (t *RPT) IssuedAt() time.Time {
+	if t.Iat == 0 {
+		return time.Time{}
+	}
+	return time.Unix(int64(t.Iat), 0)
+}
+
+// ExpiresAt returns the time the token expires, or zero time if the token has no exp claim
+func (t *RPT) ExpiresAt() time.Time {
+	if t.Exp == 0 {
+		return time.Time{}
+	}
+	return time.Unix(int64(t.Exp), 0)
+}
+
+// Expired returns true if the token is expired at the given time
+func (t *RPT) Expired(now time.Time) bool {
+	exp := t.ExpiresAt()
+	return !exp.IsZero() && !now.Before(exp)
+}
+
+// Claim returns the value of any claim by name
+func (t *RPT) Claim(name string) (v interface{}, ok bool) {
+	v, ok = t.Raw[name]
+	return
+}
@@ -0,0 +1,91 @@
+package uma
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+// RefreshedRPTHeader is the response header that carries a new RPT minted by RPTRefresh. Clients should
+// replace their token with its value.
+const RefreshedRPTHeader = "X-Refreshed-RPT"
+
+// RPTRefresh configures the middleware to mint new RPTs on behalf of the client, so that clients can
+// rotate their tokens without extra round trips to the authorization server.
+type RPTRefresh struct {
+	// Refresh mints a new RPT that keeps the permissions of rpt and adds the given scopes on the resource.
+	// See rp.KeycloakClient.UpgradeRPT for an implementation.
+	Refresh func(r *http.Request, rpt, resourceID string, scopes []string) (string, error)
+
+	// Before if positive, refreshes granted tokens that expire within this duration
+	Before time.Duration
+
+	// Upgrade if true, tries to upgrade tokens that lack permission for the resource or scopes before
+	// denying the request. If the new RPT grants access, the request is served as if it carried the new
+	// token. This is incremental authorization done by the middleware instead of the client.
+	Upgrade bool
+}
+
+// upgradeRPT mints a token that grants scopes on rsc. It returns the token and its claims or false if the
+// new token doesn't grant access either.
+func (m *Manager) upgradeRPT(r *http.Request, p Provider, token string, rsc *Resource, scopes []string) (string, *RPT, bool) {
+	logger := m.logger.WithValues(
+		"method", r.Method,
+		"path", r.URL.Path,
+	)
+	upgraded, err := m.rptRefresh.Refresh(r, token, rsc.ID, scopes)
+	if err != nil {
+		logger.Info("error upgrading rpt", "err", err)
+		return "", nil, false
+	}
+	b, _, err := m.verifySignature(r.Context(), p, upgraded)
+	if err != nil {
+		logger.Info("upgraded rpt has invalid signature", "err", err)
+		return "", nil, false
+	}
+	rpt, err := m.parseRPT(b)
+	if err != nil {
+		logger.Info("error parsing upgraded rpt", "err", err)
+		return "", nil, false
+	}
+	if m.tokenBinding != nil {
+		if check := m.tokenBinding.mismatch(r, rpt); check != "" {
+			logger.Info("upgraded rpt is not bound to client", "check", check)
+			return "", nil, false
+		}
+	}
+	if err := m.checkPermission(r, p, rpt, rsc, scopes, logger); err != nil {
+		return "", nil, false
+	}
+	return upgraded, rpt, true
+}
+
+// refreshRPT sets RefreshedRPTHeader to a new token if rpt expires within RPTRefresh.Before. Errors are
+// logged and otherwise ignored, since the current token still grants access.
+func (m *Manager) refreshRPT(w http.ResponseWriter, r *http.Request, token string, rpt *RPT, rsc *Resource, scopes []string) {
+	if m.rptRefresh.Before <= 0 || rpt.Exp == 0 {
+		return
+	}
+	if time.Unix(int64(rpt.Exp), 0).Sub(m.clock.Now()) > m.rptRefresh.Before {
+		return
+	}
+	refreshed, err := m.rptRefresh.Refresh(r, token, rsc.ID, scopes)
+	if err != nil {
+		m.logger.Info("error refreshing rpt",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"err", err,
+		)
+		return
+	}
+	w.Header().Set(RefreshedRPTHeader, refreshed)
+}
+
+// canUpgrade reports whether err may be fixed by upgrading the token
+func (m *Manager) canUpgrade(err error) bool {
+	if m.rptRefresh == nil || !m.rptRefresh.Upgrade {
+		return false
+	}
+	var rptErr ErrInvalidRPT
+	return errors.As(err, &rptErr) && (rptErr.Reason == RPTNoPermission || rptErr.Reason == RPTMissingScope)
+}
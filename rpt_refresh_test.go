@@ -0,0 +1,113 @@
+package uma_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pckhoi/uma"
+	"github.com/pckhoi/uma/pkg/clock"
+	"github.com/stretchr/testify/assert"
+)
+
+// rptMinter records refresh requests and returns the tokens registered for them
+type rptMinter struct {
+	mu       sync.Mutex
+	requests []string
+	tokens   map[string]string
+}
+
+func (m *rptMinter) refresh(r *http.Request, rpt, resourceID string, scopes []string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := fmt.Sprintf("%s %s %v", rpt, resourceID, scopes)
+	m.requests = append(m.requests, key)
+	if tok, ok := m.tokens[key]; ok {
+		return tok, nil
+	}
+	return "", errors.New("access denied")
+}
+
+func TestRPTRefreshNearExpiry(t *testing.T) {
+	c := clock.NewFake(time.Now())
+	payload := func(exp time.Duration) string {
+		return fmt.Sprintf(
+			`{"sub":"user-1","iat":%d,"exp":%d,"authorization":{"permissions":[{"rsid":"rsc-User 1","scopes":["read"]}]}}`,
+			c.Now().Add(-time.Second).Unix(), c.Now().Add(exp).Unix(),
+		)
+	}
+	p := newMockProvider(map[string]string{
+		"token-1": payload(time.Hour),
+		"token-2": payload(30 * time.Second),
+	})
+	minter := &rptMinter{tokens: map[string]string{
+		"token-2 rsc-User 1 [read]": "token-3",
+	}}
+	h := newMockManager(t, p, uma.ManagerOptions{
+		Clock: c,
+		RPTRefresh: &uma.RPTRefresh{
+			Refresh: minter.refresh,
+			Before:  time.Minute,
+		},
+	}).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	rec := serve(h, http.MethodGet, "https://api.example.com/users/1", "token-1")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, rec.Header().Get(uma.RefreshedRPTHeader))
+	assert.Empty(t, minter.requests)
+
+	rec = serve(h, http.MethodGet, "https://api.example.com/users/1", "token-2")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "token-3", rec.Header().Get(uma.RefreshedRPTHeader))
+
+	// the token still grants access when refreshing fails
+	delete(minter.tokens, "token-2 rsc-User 1 [read]")
+	rec = serve(h, http.MethodGet, "https://api.example.com/users/1", "token-2")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, rec.Header().Get(uma.RefreshedRPTHeader))
+}
+
+func TestRPTRefreshUpgrade(t *testing.T) {
+	p := newMockProvider(map[string]string{
+		"token-1": rptPayload("user-1", "User 1", "read"),
+		"token-2": `{"sub":"user-1","authorization":{"permissions":[{"rsid":"rsc-User 1","scopes":["read","write"]}]}}`,
+		"token-3": rptPayload("user-1", "User 2", "read"),
+	})
+	minter := &rptMinter{tokens: map[string]string{
+		"token-1 rsc-User 1 [write]": "token-2",
+		"token-1 rsc-User 2 [write]": "token-3",
+	}}
+	var sub string
+	h := newMockManager(t, p, uma.ManagerOptions{
+		RPTRefresh: &uma.RPTRefresh{
+			Refresh: minter.refresh,
+			Upgrade: true,
+		},
+	}).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sub = uma.GetClaims(r).Sub
+	}))
+
+	rec := serve(h, http.MethodPut, "https://api.example.com/users/1", "token-1")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "token-2", rec.Header().Get(uma.RefreshedRPTHeader))
+	assert.Equal(t, "user-1", sub)
+
+	// the upgraded token doesn't grant write on User 2
+	rec = serve(h, http.MethodPut, "https://api.example.com/users/2", "token-1")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Empty(t, rec.Header().Get(uma.RefreshedRPTHeader))
+	assert.Contains(t, rec.Header().Get("WWW-Authenticate"), "ticket=")
+
+	// the authorization server denies the upgrade
+	rec = serve(h, http.MethodPut, "https://api.example.com/users/3", "token-1")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Empty(t, rec.Header().Get(uma.RefreshedRPTHeader))
+
+	// invalid tokens are not upgraded
+	rec = serve(h, http.MethodPut, "https://api.example.com/users/1", "token-4")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Len(t, minter.requests, 3)
+}
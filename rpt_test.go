@@ -0,0 +1,59 @@
+package uma_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pckhoi/uma"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRPT(t *testing.T) {
+	rpt, err := uma.ParseRPT([]byte(`{
+		"sub": "user-1",
+		"iat": 1660000000,
+		"exp": 1660000300,
+		"tenant": "acme",
+		"authorization": {
+			"permissions": [
+				{"rsid": "rsc-1", "rsname": "User 1", "scopes": ["read", "write"]},
+				{"rsid": "rsc-2", "rsname": "User 2", "scopes": ["read"]}
+			]
+		}
+	}`))
+	require.NoError(t, err)
+	assert.Equal(t, "user-1", rpt.Sub)
+	assert.Equal(t, []string{"rsc-1", "rsc-2"}, rpt.ResourceIDs())
+
+	perm, ok := rpt.Permission("rsc-2")
+	assert.True(t, ok)
+	assert.Equal(t, uma.Permission{Rsid: "rsc-2", Rsname: "User 2", Scopes: []string{"read"}}, perm)
+	perm, ok = rpt.PermissionByName("User 1")
+	assert.True(t, ok)
+	assert.Equal(t, "rsc-1", perm.Rsid)
+	_, ok = rpt.Permission("rsc-3")
+	assert.False(t, ok)
+
+	assert.True(t, rpt.HasScopes("rsc-1", "read", "write"))
+	assert.False(t, rpt.HasScopes("rsc-2", "read", "write"))
+	assert.False(t, rpt.HasScopes("rsc-3"))
+
+	assert.Equal(t, time.Unix(1660000000, 0), rpt.IssuedAt())
+	assert.Equal(t, time.Unix(1660000300, 0), rpt.ExpiresAt())
+	assert.False(t, rpt.Expired(time.Unix(1660000299, 0)))
+	assert.True(t, rpt.Expired(time.Unix(1660000300, 0)))
+
+	v, ok := rpt.Claim("tenant")
+	assert.True(t, ok)
+	assert.Equal(t, "acme", v)
+
+	_, err = uma.ParseRPT([]byte(`{"sub": 1}`))
+	assert.Error(t, err)
+
+	rpt, err = uma.ParseRPT([]byte(`{}`))
+	require.NoError(t, err)
+	assert.Empty(t, rpt.Permissions())
+	assert.True(t, rpt.ExpiresAt().IsZero())
+	assert.False(t, rpt.Expired(time.Now()))
+}
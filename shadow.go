@@ -0,0 +1,139 @@
+package uma
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+const (
+	defaultShadowConcurrency = 16
+	defaultShadowTimeout     = 10 * time.Second
+)
+
+// ShadowDivergence is a decision of ManagerOptions.ShadowProvider that differs from the actual one
+type ShadowDivergence struct {
+	Method string
+	Path   string
+
+	// Resource is the resource as registered with the shadow provider
+	Resource *Resource
+	Scopes   []string
+	Subject  string
+
+	// Granted is the actual decision
+	Granted bool
+
+	// ShadowGranted is the decision of the shadow provider
+	ShadowGranted bool
+
+	// ShadowErr is the error the shadow provider rejects the token with, if ShadowGranted is false
+	ShadowErr error
+}
+
+// shadowDecision evaluates d again against the shadow provider in the background. Only decisions that
+// depend on the permissions of a valid token are evaluated, since the others don't involve a provider.
+func (m *Manager) shadowDecision(r *http.Request, d *Decision) {
+	if d.rpt == nil || d.Resource == nil || len(d.Scopes) == 0 {
+		return
+	}
+	if !d.Granted && d.Reason != DenialNoPermission && d.Reason != DenialScopeMismatch {
+		return
+	}
+	p := m.shadowProvider(r)
+	if p == nil {
+		return
+	}
+	div := ShadowDivergence{
+		Method:   r.Method,
+		Path:     r.URL.Path,
+		Resource: &Resource{},
+		Scopes:   d.Scopes,
+		Subject:  d.rpt.Sub,
+		Granted:  d.Granted,
+	}
+	*div.Resource = *d.Resource
+	token := getBearerToken(r)
+	rpt := d.rpt
+	select {
+	case m.shadowSlots <- struct{}{}:
+	default:
+		// the shadow provider can't keep up, evaluations must not pile up in memory. Drops are logged
+		// once per 100 to keep logs readable under load.
+		if m.shadowDropped.Add(1)%100 == 1 {
+			m.logger.Info("shadow evaluations are saturated, dropped decision",
+				"method", div.Method, "path", div.Path, "dropped", m.shadowDropped.Load())
+		}
+		return
+	}
+	// the request is done by the time the shadow decides
+	ctx, cancel := context.WithTimeout(context.Background(), m.shadowTimeout)
+	r = r.Clone(ctx)
+	if !m.goBackground(func() {
+		defer func() {
+			cancel()
+			<-m.shadowSlots
+		}()
+		logger := m.logger.WithValues(
+			"method", div.Method,
+			"path", div.Path,
+			"shadow", true,
+		)
+		if err := m.registerResource(r, m.shadowResourceStore, p, div.Resource); err != nil {
+			logger.Error(err, "error registering resource with shadow provider", "name", div.Resource.Name)
+			return
+		}
+		if _, ok := p.(PermissionCheckingProvider); !ok {
+			// the shadow provider has to accept the token itself
+			b, err := p.VerifySignature(r.Context(), token)
+			if err == nil {
+				rpt, err = m.parseRPT(b)
+			}
+			if err != nil {
+				div.ShadowErr = err
+				m.reportShadowDivergence(div, logger)
+				return
+			}
+		}
+		err := m.checkPermission(r, p, rpt, div.Resource, div.Scopes, logger)
+		if isCheckFailure(err) {
+			logger.Error(err, "error checking permission with shadow provider")
+			return
+		}
+		div.ShadowGranted, div.ShadowErr = err == nil, err
+		m.reportShadowDivergence(div, logger)
+	}) {
+		cancel()
+		<-m.shadowSlots
+	}
+}
+
+// ShadowDropped returns the number of decisions that were not evaluated against ManagerOptions.ShadowProvider
+// because ShadowConcurrency evaluations were already running
+func (m *Manager) ShadowDropped() uint64 {
+	return m.shadowDropped.Load()
+}
+
+// reportShadowDivergence logs div and passes it to OnShadowDivergence, unless both decisions agree
+func (m *Manager) reportShadowDivergence(div ShadowDivergence, logger logr.Logger) {
+	if div.Granted == div.ShadowGranted {
+		return
+	}
+	args := []interface{}{
+		"resource_id", div.Resource.ID,
+		"name", div.Resource.Name,
+		"scopes", div.Scopes,
+		"sub", div.Subject,
+		"granted", div.Granted,
+		"shadow_granted", div.ShadowGranted,
+	}
+	if div.ShadowErr != nil {
+		args = append(args, "shadow_err", div.ShadowErr.Error())
+	}
+	logger.Info("shadow decision diverged", args...)
+	if m.onShadowDivergence != nil {
+		m.onShadowDivergence(div)
+	}
+}
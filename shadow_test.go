@@ -0,0 +1,202 @@
+package uma_test
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pckhoi/uma"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// shadowMockProvider is a mockProvider of another authorization server
+type shadowMockProvider struct {
+	*mockProvider
+}
+
+func (p *shadowMockProvider) WWWAuthenticateDirectives() uma.WWWAuthenticateDirectives {
+	return uma.WWWAuthenticateDirectives{Realm: "shadow", AsUri: "https://shadow.example.com"}
+}
+
+// checkingShadowProvider grants scopes listed in allowed, whoever the token is issued by
+type checkingShadowProvider struct {
+	shadowMockProvider
+	allowed []string
+}
+
+func (p *checkingShadowProvider) CheckPermission(ctx context.Context, rpt *uma.RPT, rsc uma.Resource, scopes []string) error {
+	for _, s := range scopes {
+		found := false
+		for _, a := range p.allowed {
+			found = found || a == s
+		}
+		if !found {
+			return uma.ErrInvalidRPT{Reason: uma.RPTMissingScope, ResourceID: rsc.ID, Scope: s}
+		}
+	}
+	return nil
+}
+
+func shadowDivergences(t *testing.T, shadow uma.Provider, requests func(h http.Handler)) []uma.ShadowDivergence {
+	t.Helper()
+	p := newMockProvider(map[string]string{
+		"token-1": rptPayload("user-1", "User 1", "read"),
+	})
+	mu := sync.Mutex{}
+	divs := []uma.ShadowDivergence{}
+	man := newMockManager(t, p, uma.ManagerOptions{
+		ShadowProvider: func(r *http.Request) uma.Provider {
+			return shadow
+		},
+		OnShadowDivergence: func(div uma.ShadowDivergence) {
+			mu.Lock()
+			defer mu.Unlock()
+			divs = append(divs, div)
+		},
+	})
+	requests(man.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+	require.NoError(t, man.Shutdown(context.Background()))
+	return divs
+}
+
+func TestShadowProvider(t *testing.T) {
+	shadow := &shadowMockProvider{newMockProvider(map[string]string{
+		"token-1": `{"sub":"user-1","authorization":{"permissions":[{"rsid":"rsc-User 1","rsname":"User 1","scopes":["read","write"]}]}}`,
+	})}
+	divs := shadowDivergences(t, shadow, func(h http.Handler) {
+		assert.Equal(t, http.StatusOK, serve(h, http.MethodGet, "/users/1", "token-1").Code)
+		assert.Equal(t, http.StatusUnauthorized, serve(h, http.MethodPut, "/users/1", "token-1").Code)
+		// denials that don't depend on permissions are not evaluated
+		assert.Equal(t, http.StatusUnauthorized, serve(h, http.MethodPut, "/users/1", "").Code)
+		assert.Equal(t, http.StatusUnauthorized, serve(h, http.MethodPut, "/users/1", "bad").Code)
+	})
+	require.Len(t, divs, 1)
+	assert.Equal(t, uma.ShadowDivergence{
+		Method:        http.MethodPut,
+		Path:          "/users/1",
+		Resource:      divs[0].Resource,
+		Scopes:        []string{"write"},
+		Subject:       "user-1",
+		Granted:       false,
+		ShadowGranted: true,
+	}, divs[0])
+	assert.Equal(t, "rsc-User 1", divs[0].Resource.ID)
+	assert.Equal(t, map[string]string{"rsc-User 1": "User 1"}, shadow.names)
+}
+
+func TestShadowProviderRejectsToken(t *testing.T) {
+	shadow := &shadowMockProvider{newMockProvider(nil)}
+	divs := shadowDivergences(t, shadow, func(h http.Handler) {
+		assert.Equal(t, http.StatusOK, serve(h, http.MethodGet, "/users/1", "token-1").Code)
+	})
+	require.Len(t, divs, 1)
+	assert.True(t, divs[0].Granted)
+	assert.False(t, divs[0].ShadowGranted)
+	assert.EqualError(t, divs[0].ShadowErr, "invalid signature")
+}
+
+func TestShadowPermissionCheckingProvider(t *testing.T) {
+	shadow := &checkingShadowProvider{shadowMockProvider{newMockProvider(nil)}, []string{"write"}}
+	divs := shadowDivergences(t, shadow, func(h http.Handler) {
+		assert.Equal(t, http.StatusOK, serve(h, http.MethodGet, "/users/1", "token-1").Code)
+		assert.Equal(t, http.StatusUnauthorized, serve(h, http.MethodPut, "/users/1", "token-1").Code)
+	})
+	require.Len(t, divs, 2)
+	if divs[0].Method != http.MethodGet {
+		divs[0], divs[1] = divs[1], divs[0]
+	}
+	assert.True(t, divs[0].Granted)
+	assert.False(t, divs[0].ShadowGranted)
+	assert.Equal(t, uma.ErrInvalidRPT{Reason: uma.RPTMissingScope, ResourceID: "rsc-User 1", Scope: "read"}, divs[0].ShadowErr)
+	assert.False(t, divs[1].Granted)
+	assert.True(t, divs[1].ShadowGranted)
+}
+
+// blockingShadowProvider blocks resource registration until unblock is closed
+type blockingShadowProvider struct {
+	shadowMockProvider
+	started chan struct{}
+	unblock chan struct{}
+}
+
+func (p *blockingShadowProvider) CreateResource(request *uma.Resource) (*uma.ExpandedResource, error) {
+	p.started <- struct{}{}
+	<-p.unblock
+	return p.shadowMockProvider.CreateResource(request)
+}
+
+func TestShadowConcurrency(t *testing.T) {
+	p := newMockProvider(map[string]string{
+		"token-1": rptPayload("user-1", "User 1", "read"),
+	})
+	shadow := &blockingShadowProvider{
+		shadowMockProvider: shadowMockProvider{newMockProvider(nil)},
+		started:            make(chan struct{}, 10),
+		unblock:            make(chan struct{}),
+	}
+	man := newMockManager(t, p, uma.ManagerOptions{
+		ShadowProvider: func(r *http.Request) uma.Provider {
+			return shadow
+		},
+		ShadowConcurrency: 1,
+	})
+	h := man.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	assert.Equal(t, http.StatusOK, serve(h, http.MethodGet, "/users/1", "token-1").Code)
+	<-shadow.started
+	// responses are not held up while the only evaluation slot is busy
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusOK, serve(h, http.MethodGet, "/users/1", "token-1").Code)
+	}
+	assert.Equal(t, uint64(3), man.ShadowDropped())
+
+	close(shadow.unblock)
+	require.NoError(t, man.Shutdown(context.Background()))
+	assert.Len(t, shadow.started, 0)
+	assert.Equal(t, uint64(3), man.ShadowDropped())
+}
+
+// hangingShadowProvider checks permissions until the evaluation is cancelled
+type hangingShadowProvider struct {
+	shadowMockProvider
+	cancelled chan error
+}
+
+func (p *hangingShadowProvider) CheckPermission(ctx context.Context, rpt *uma.RPT, rsc uma.Resource, scopes []string) error {
+	<-ctx.Done()
+	p.cancelled <- ctx.Err()
+	return ctx.Err()
+}
+
+func TestShadowTimeout(t *testing.T) {
+	shadow := &hangingShadowProvider{
+		shadowMockProvider: shadowMockProvider{newMockProvider(nil)},
+		cancelled:          make(chan error, 1),
+	}
+	p := newMockProvider(map[string]string{
+		"token-1": rptPayload("user-1", "User 1", "read"),
+	})
+	man := newMockManager(t, p, uma.ManagerOptions{
+		ShadowProvider: func(r *http.Request) uma.Provider {
+			return shadow
+		},
+		ShadowConcurrency: 1,
+		ShadowTimeout:     20 * time.Millisecond,
+	})
+	h := man.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	assert.Equal(t, http.StatusOK, serve(h, http.MethodGet, "/users/1", "token-1").Code)
+	select {
+	case err := <-shadow.cancelled:
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	case <-time.After(time.Second):
+		t.Fatal("shadow evaluation was not cancelled")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, man.Shutdown(ctx))
+	assert.Equal(t, uint64(0), man.ShadowDropped())
+}
@@ -0,0 +1,83 @@
+package uma
+
+import (
+	"context"
+)
+
+// createdResource is a resource registered by the Manager, kept so it can be deregistered on shutdown
+type createdResource struct {
+	provider Provider
+	id       string
+	name     string
+}
+
+// goBackground runs fn in a goroutine that Shutdown waits for. It returns false without running fn
+// if the Manager is shutting down.
+func (m *Manager) goBackground(fn func()) bool {
+	m.bgMu.Lock()
+	defer m.bgMu.Unlock()
+	if m.shuttingDown {
+		return false
+	}
+	m.bgWG.Add(1)
+	go func() {
+		defer m.bgWG.Done()
+		fn()
+	}()
+	return true
+}
+
+func (m *Manager) trackCreated(p Provider, id, name string) {
+	if !m.deregisterOnShutdown {
+		return
+	}
+	m.bgMu.Lock()
+	defer m.bgMu.Unlock()
+	m.created = append(m.created, createdResource{provider: p, id: id, name: name})
+}
+
+// Shutdown waits for background work such as decisions abandoned due to MaxDecisionLatency to finish.
+// If DeregisterOnShutdown is set, it then deletes resources registered by this Manager from their
+// providers. If ctx is done before background work finishes, Shutdown returns ctx.Err() without
+// deregistering resources. Shutdown does not close providers.
+func (m *Manager) Shutdown(ctx context.Context) error {
+	m.bgMu.Lock()
+	m.shuttingDown = true
+	m.bgMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		m.bgWG.Wait()
+		close(done)
+	}()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-done:
+	}
+
+	m.bgMu.Lock()
+	created := m.created
+	m.created = nil
+	m.bgMu.Unlock()
+	var firstErr error
+	for _, rsc := range created {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := rsc.provider.DeleteResource(rsc.id); err != nil {
+			m.logger.Error(err, "error deregistering resource", "id", rsc.id, "name", rsc.name)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		m.logger.Info("deregistered resource", "id", rsc.id, "name", rsc.name)
+	}
+	return firstErr
+}
+
+// Close is the same as Shutdown with a background context
+func (m *Manager) Close() error {
+	return m.Shutdown(context.Background())
+}
@@ -0,0 +1,49 @@
+package uma_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/pckhoi/uma"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShutdownDeregistersResources(t *testing.T) {
+	p := newMockProvider(nil)
+	man := newMockManager(t, p, uma.ManagerOptions{DeregisterOnShutdown: true})
+	h := man.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	assert.Equal(t, http.StatusUnauthorized, serve(h, http.MethodGet, "https://api.example.com/users/1", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, serve(h, http.MethodGet, "https://api.example.com/users/2", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, serve(h, http.MethodGet, "https://api.example.com/users/1", "").Code)
+
+	require.NoError(t, man.Shutdown(context.Background()))
+	assert.Equal(t, []string{"rsc-User 1", "rsc-User 2"}, p.deleted)
+
+	require.NoError(t, man.Close())
+	assert.Len(t, p.deleted, 2)
+}
+
+func TestShutdownWaitsForAbandonedDecisions(t *testing.T) {
+	p := newMockProvider(map[string]string{
+		"token-1": rptPayload("user-1", "User 1", "read"),
+	})
+	p.delay = 100 * time.Millisecond
+	man := newMockManager(t, p, uma.ManagerOptions{MaxDecisionLatency: 10 * time.Millisecond})
+	h := man.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	assert.Equal(t, http.StatusServiceUnavailable, serve(h, http.MethodGet, "https://api.example.com/users/1", "token-1").Code)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, man.Shutdown(ctx), context.DeadlineExceeded)
+
+	require.NoError(t, man.Shutdown(context.Background()))
+	p.mu.Lock()
+	assert.Equal(t, 1, p.verified)
+	p.mu.Unlock()
+
+	// after shutdown, decisions are no longer abandoned
+	assert.Equal(t, http.StatusOK, serve(h, http.MethodGet, "https://api.example.com/users/1", "token-1").Code)
+}
@@ -0,0 +1,51 @@
+package uma
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// JOSE algorithms that tokens can be signed with
+const (
+	RS256 = "RS256"
+	RS384 = "RS384"
+	RS512 = "RS512"
+	PS256 = "PS256"
+	PS384 = "PS384"
+	PS512 = "PS512"
+	ES256 = "ES256"
+	ES384 = "ES384"
+	ES512 = "ES512"
+	EdDSA = "EdDSA"
+)
+
+// DefaultSigningAlgorithms are the algorithms accepted by providers unless configured otherwise
+var DefaultSigningAlgorithms = []string{RS256}
+
+// checkSigningAlgorithm returns ErrDisallowedAlgorithm if jwt is not signed with one of allowed
+// algorithms. It only reads the jwt header, so it is cheap enough to run before signature
+// verification.
+func checkSigningAlgorithm(jwt string, allowed []string) error {
+	seg, _, ok := strings.Cut(jwt, ".")
+	if !ok {
+		return fmt.Errorf("malformed jwt: missing payload")
+	}
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(seg, "="))
+	if err != nil {
+		return fmt.Errorf("malformed jwt header: %w", err)
+	}
+	header := struct {
+		Alg string `json:"alg"`
+	}{}
+	if err := json.Unmarshal(b, &header); err != nil {
+		return fmt.Errorf("malformed jwt header: %w", err)
+	}
+	for _, alg := range allowed {
+		if header.Alg == alg {
+			return nil
+		}
+	}
+	return ErrDisallowedAlgorithm{Alg: header.Alg, Allowed: allowed}
+}
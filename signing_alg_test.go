@@ -0,0 +1,97 @@
+package uma_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/go-logr/logr/testr"
+	"github.com/pckhoi/uma"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/square/go-jose.v2"
+)
+
+func TestSigningAlgorithms(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	keys := map[jose.SignatureAlgorithm]interface{}{
+		jose.RS256: rsaKey,
+		jose.ES256: ecKey,
+		jose.EdDSA: edKey,
+		jose.HS256: []byte("shared-secret-shared-secret-1234"),
+	}
+	sign := func(alg jose.SignatureAlgorithm) string {
+		signer, err := jose.NewSigner(jose.SigningKey{Algorithm: alg, Key: jose.JSONWebKey{Key: keys[alg], KeyID: string(alg)}}, nil)
+		require.NoError(t, err)
+		obj, err := signer.Sign([]byte(`{"sub":"user-1"}`))
+		require.NoError(t, err)
+		s, err := obj.CompactSerialize()
+		require.NoError(t, err)
+		return s
+	}
+
+	var issuer string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/uma2-configuration", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"issuer": issuer, "jwks_uri": issuer + "/certs"})
+	})
+	mux.HandleFunc("/certs", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+			{Key: rsaKey.Public(), KeyID: string(jose.RS256), Algorithm: string(jose.RS256), Use: "sig"},
+			{Key: ecKey.Public(), KeyID: string(jose.ES256), Algorithm: string(jose.ES256), Use: "sig"},
+			{Key: edKey.Public(), KeyID: string(jose.EdDSA), Algorithm: string(jose.EdDSA), Use: "sig"},
+		}})
+	})
+	s := httptest.NewServer(mux)
+	defer s.Close()
+	issuer = s.URL
+	keySet := oidc.NewRemoteKeySet(context.Background(), issuer+"/certs")
+
+	for _, c := range []struct {
+		name    string
+		opts    []uma.BaseProviderOption
+		allowed []jose.SignatureAlgorithm
+	}{
+		{"default", nil, []jose.SignatureAlgorithm{jose.RS256}},
+		{"elliptic curves", []uma.BaseProviderOption{uma.WithSigningAlgorithms(uma.ES256, uma.EdDSA)}, []jose.SignatureAlgorithm{jose.ES256, jose.EdDSA}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			p, err := uma.NewBaseProvider(issuer, "client", "secret", keySet, s.Client(), testr.New(t), c.opts...)
+			require.NoError(t, err)
+			for alg := range keys {
+				payload, err := p.VerifySignature(context.Background(), sign(alg))
+				allowed := false
+				for _, a := range c.allowed {
+					allowed = allowed || a == alg
+				}
+				if allowed {
+					require.NoError(t, err, alg)
+					assert.JSONEq(t, `{"sub":"user-1"}`, string(payload))
+					continue
+				}
+				var algErr uma.ErrDisallowedAlgorithm
+				require.ErrorAs(t, err, &algErr, alg)
+				assert.Equal(t, string(alg), algErr.Alg)
+			}
+		})
+	}
+
+	p, err := uma.NewBaseProvider(issuer, "client", "secret", keySet, s.Client(), testr.New(t))
+	require.NoError(t, err)
+	_, err = p.VerifySignature(context.Background(), "not-a-jwt")
+	assert.Error(t, err)
+}
@@ -0,0 +1,140 @@
+package uma
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/pckhoi/uma/pkg/httputil"
+)
+
+// ResourceStoreLister is implemented by ResourceStore implementations that can list their entries, which
+// lets CopyResourceStore copy them to another store
+type ResourceStoreLister interface {
+	// List returns the ids of all stored resources by name
+	List() (map[string]string, error)
+}
+
+// StoreCopyAction tells what CopyResourceStore did with an entry
+type StoreCopyAction string
+
+const (
+	// StoreCopyCopied means the entry was written to the destination and read back
+	StoreCopyCopied StoreCopyAction = "copied"
+
+	// StoreCopyUnchanged means the destination already had the same id
+	StoreCopyUnchanged StoreCopyAction = "unchanged"
+
+	// StoreCopyMissing means the resource no longer exists on the authorization server, the entry is
+	// skipped
+	StoreCopyMissing StoreCopyAction = "missing"
+
+	// StoreCopyConflict means the destination has another id for the name, which is left as is
+	StoreCopyConflict StoreCopyAction = "conflict"
+
+	// StoreCopyFailed means the entry could not be verified, written or read back
+	StoreCopyFailed StoreCopyAction = "failed"
+)
+
+// StoreCopyResult is the outcome of copying one entry
+type StoreCopyResult struct {
+	Name   string
+	ID     string
+	Action StoreCopyAction
+	Err    error
+}
+
+// StoreCopyOptions configures CopyResourceStore
+type StoreCopyOptions struct {
+	// Provider if set, is asked for every resource to verify that it still exists with the same name.
+	// Entries of resources that don't are skipped.
+	Provider Provider
+
+	// DryRun if true, verifies and compares entries without writing anything
+	DryRun bool
+}
+
+// CopyResourceStore copies the entries of from, which must implement ResourceStoreLister, to to. Hashes
+// are copied along if both stores implement ResourceHashStore. Existing entries of to are never
+// overwritten, so that both stores can be used while entries are copied, and copying again only writes
+// entries added in between. Results are sorted by name. An error is only returned if from can't be
+// listed, failures of single entries are reported in the results.
+func CopyResourceStore(from, to ResourceStore, opts StoreCopyOptions) ([]StoreCopyResult, error) {
+	lister, ok := from.(ResourceStoreLister)
+	if !ok {
+		return nil, errors.New("source store cannot list its entries")
+	}
+	entries, err := lister.List()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	results := make([]StoreCopyResult, 0, len(names))
+	for _, name := range names {
+		res := StoreCopyResult{Name: name, ID: entries[name]}
+		res.Action, res.Err = copyStoreEntry(from, to, name, res.ID, opts)
+		results = append(results, res)
+	}
+	return results, nil
+}
+
+func copyStoreEntry(from, to ResourceStore, name, id string, opts StoreCopyOptions) (StoreCopyAction, error) {
+	if opts.Provider != nil {
+		rsc, err := opts.Provider.GetResource(id)
+		var respErr *httputil.ErrUnanticipatedResponse
+		if errors.As(err, &respErr) && respErr.Status == http.StatusNotFound {
+			return StoreCopyMissing, nil
+		}
+		if err != nil {
+			return StoreCopyFailed, err
+		}
+		if rsc.Name != name {
+			return StoreCopyMissing, fmt.Errorf("id %q belongs to resource %q", id, rsc.Name)
+		}
+	}
+	existing, err := to.Get(name)
+	if err != nil {
+		return StoreCopyFailed, err
+	}
+	if existing == id {
+		return StoreCopyUnchanged, nil
+	}
+	if existing != "" {
+		return StoreCopyConflict, fmt.Errorf("destination has id %q", existing)
+	}
+	if opts.DryRun {
+		return StoreCopyCopied, nil
+	}
+	if err := to.Set(name, id); err != nil {
+		var stored ErrStoredResourceConflict
+		if errors.As(err, &stored) {
+			return StoreCopyConflict, fmt.Errorf("destination has id %q", stored.ID)
+		}
+		return StoreCopyFailed, err
+	}
+	fromHashes, ok1 := from.(ResourceHashStore)
+	toHashes, ok2 := to.(ResourceHashStore)
+	if ok1 && ok2 {
+		hash, err := fromHashes.GetHash(name)
+		if err != nil {
+			return StoreCopyFailed, err
+		}
+		if hash != "" {
+			if err := toHashes.SetHash(name, hash); err != nil {
+				return StoreCopyFailed, err
+			}
+		}
+	}
+	if written, err := to.Get(name); err != nil || written != id {
+		if err == nil {
+			err = fmt.Errorf("read back id %q", written)
+		}
+		return StoreCopyFailed, err
+	}
+	return StoreCopyCopied, nil
+}
@@ -0,0 +1,36 @@
+package uma_test
+
+import (
+	"testing"
+
+	"github.com/pckhoi/uma"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCopyResourceStore(t *testing.T) {
+	from := uma.NewMemoryResourceStore(nil)
+	require.NoError(t, from.Set("User 1", "id-1"))
+	require.NoError(t, from.SetHash("User 1", "abc"))
+	require.NoError(t, from.Set("User 2", "id-2"))
+	require.NoError(t, from.Set("User 3", "id-3"))
+	to := uma.NewMemoryResourceStore(nil)
+	require.NoError(t, to.Set("User 2", "id-2"))
+	require.NoError(t, to.Set("User 3", "id-9"))
+
+	results, err := uma.CopyResourceStore(from, to, uma.StoreCopyOptions{})
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+	assert.Equal(t, uma.StoreCopyResult{Name: "User 1", ID: "id-1", Action: uma.StoreCopyCopied}, results[0])
+	assert.Equal(t, uma.StoreCopyResult{Name: "User 2", ID: "id-2", Action: uma.StoreCopyUnchanged}, results[1])
+	assert.Equal(t, uma.StoreCopyConflict, results[2].Action)
+	assert.EqualError(t, results[2].Err, `destination has id "id-9"`)
+
+	hash, _ := to.GetHash("User 1")
+	assert.Equal(t, "abc", hash)
+	id, _ := to.Get("User 3")
+	assert.Equal(t, "id-9", id)
+
+	_, err = uma.CopyResourceStore(&syncResourceStore{m: map[string]string{}}, to, uma.StoreCopyOptions{})
+	assert.EqualError(t, err, "source store cannot list its entries")
+}
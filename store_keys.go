@@ -0,0 +1,40 @@
+package uma
+
+// storeKey returns the key of resource name in the ResourceStore, which is the name itself unless
+// ResourceStoreKeyByIssuer is set
+func (m *Manager) storeKey(p Provider, name string) string {
+	if !m.storeKeyByIssuer {
+		return name
+	}
+	return resourceCacheKey(p, name)
+}
+
+// storeGet gets the id of resource name from rs. Entries of ResourceStoreMigrateIssuer that are missing
+// are looked up under the name alone, and copied under their new key along with their hash.
+func (m *Manager) storeGet(rs ResourceStore, p Provider, name string) (string, error) {
+	key := m.storeKey(p, name)
+	id, err := rs.Get(key)
+	if err != nil || id != "" || key == name || m.storeMigrateIssuer == "" ||
+		m.storeMigrateIssuer != p.WWWAuthenticateDirectives().AsUri {
+		return id, err
+	}
+	if id, err = rs.Get(name); err != nil || id == "" {
+		return id, err
+	}
+	if err := rs.Set(key, id); err != nil {
+		return "", err
+	}
+	if hs, ok := rs.(ResourceHashStore); ok {
+		hash, err := hs.GetHash(name)
+		if err != nil {
+			return "", err
+		}
+		if hash != "" {
+			if err := hs.SetHash(key, hash); err != nil {
+				return "", err
+			}
+		}
+	}
+	m.logger.Info("migrated resource store entry", "id", id, "name", name, "key", key)
+	return id, nil
+}
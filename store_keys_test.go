@@ -0,0 +1,55 @@
+package uma_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/pckhoi/uma"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type issuerProvider struct {
+	*mockProvider
+	issuer string
+}
+
+func (p issuerProvider) WWWAuthenticateDirectives() uma.WWWAuthenticateDirectives {
+	return uma.WWWAuthenticateDirectives{Realm: "test", AsUri: p.issuer}
+}
+
+func TestResourceStoreKeyByIssuer(t *testing.T) {
+	// saved before entries were keyed by issuer
+	rs := &syncResourceStore{m: map[string]string{"User 1": "legacy-1"}}
+	p1 := newMockProvider(nil)
+	p2 := issuerProvider{newMockProvider(nil), "https://as2.example.com"}
+	man := newMockManager(t, p1, uma.ManagerOptions{
+		GetResourceStore:           func(r *http.Request) uma.ResourceStore { return rs },
+		ResourceStoreKeyByIssuer:   true,
+		ResourceStoreMigrateIssuer: "https://as.example.com",
+	})
+	baseURL := url.URL{Scheme: "https", Host: "api.example.com", Path: "/users"}
+	r := httptest.NewRequest(http.MethodGet, "https://api.example.com/users/1", nil)
+
+	rsc, err := man.RegisterResourceAt(r, rs, p1, baseURL, "/users/1")
+	require.NoError(t, err)
+	assert.Equal(t, "legacy-1", rsc.ID)
+	assert.Equal(t, "legacy-1", rs.m["https://as.example.com User 1"])
+	assert.Empty(t, p1.names)
+
+	// the same name registered with another issuer doesn't collide
+	rsc, err = man.RegisterResourceAt(r, rs, p2, baseURL, "/users/1")
+	require.NoError(t, err)
+	assert.Equal(t, "rsc-User 1", rsc.ID)
+	assert.Equal(t, map[string]string{
+		"User 1":                         "legacy-1",
+		"https://as.example.com User 1":  "legacy-1",
+		"https://as2.example.com User 1": "rsc-User 1",
+	}, rs.m)
+
+	require.NoError(t, man.InvalidateResource(p2, rs, "User 1"))
+	assert.NotContains(t, rs.m, "https://as2.example.com User 1")
+	assert.Contains(t, rs.m, "https://as.example.com User 1")
+}
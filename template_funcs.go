@@ -0,0 +1,171 @@
+package uma
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// TemplateFunc transforms a path parameter in a resource template. args are the colon-separated arguments
+// that follow the function name e.g. "6" in "{id|pad:6}".
+type TemplateFunc func(value string, args ...string) (string, error)
+
+// builtinTemplateFuncs are available to every resource template:
+//
+//   - upper and lower change the case of the value
+//   - trim removes leading and trailing white space
+//   - slug lowercases the value and replaces every run of characters other than letters and digits with "-"
+//   - pad:N left pads the value with zeros to N characters, pad:N:C pads with C instead
+var builtinTemplateFuncs = map[string]TemplateFunc{
+	"upper": func(value string, args ...string) (string, error) {
+		if len(args) > 0 {
+			return "", fmt.Errorf("upper takes no arguments")
+		}
+		return strings.ToUpper(value), nil
+	},
+	"lower": func(value string, args ...string) (string, error) {
+		if len(args) > 0 {
+			return "", fmt.Errorf("lower takes no arguments")
+		}
+		return strings.ToLower(value), nil
+	},
+	"trim": func(value string, args ...string) (string, error) {
+		if len(args) > 0 {
+			return "", fmt.Errorf("trim takes no arguments")
+		}
+		return strings.TrimSpace(value), nil
+	},
+	"slug": func(value string, args ...string) (string, error) {
+		if len(args) > 0 {
+			return "", fmt.Errorf("slug takes no arguments")
+		}
+		var sb strings.Builder
+		dash := false
+		for _, c := range strings.ToLower(value) {
+			if unicode.IsLetter(c) || unicode.IsDigit(c) {
+				if dash && sb.Len() > 0 {
+					sb.WriteByte('-')
+				}
+				dash = false
+				sb.WriteRune(c)
+			} else {
+				dash = true
+			}
+		}
+		return sb.String(), nil
+	},
+	"pad": func(value string, args ...string) (string, error) {
+		if len(args) == 0 || len(args) > 2 {
+			return "", fmt.Errorf("pad takes a width and an optional padding character")
+		}
+		width, err := strconv.Atoi(args[0])
+		if err != nil || width < 0 {
+			return "", fmt.Errorf("invalid pad width %q", args[0])
+		}
+		pad := "0"
+		if len(args) == 2 {
+			if utf8.RuneCountInString(args[1]) != 1 {
+				return "", fmt.Errorf("invalid pad character %q", args[1])
+			}
+			pad = args[1]
+		}
+		if n := utf8.RuneCountInString(value); n < width {
+			value = strings.Repeat(pad, width-n) + value
+		}
+		return value, nil
+	},
+}
+
+// templateCall is a function applied to a placeholder
+type templateCall struct {
+	name string
+	args []string
+}
+
+// parsePlaceholder parses the content of a "{param|func:arg|...}" placeholder
+func parsePlaceholder(s string) (param string, calls []templateCall) {
+	parts := strings.Split(s, "|")
+	param = strings.TrimSpace(parts[0])
+	for _, part := range parts[1:] {
+		fields := strings.Split(strings.TrimSpace(part), ":")
+		calls = append(calls, templateCall{name: fields[0], args: fields[1:]})
+	}
+	return
+}
+
+// lookupTemplateFunc returns the function with name from funcs, or a built-in function
+func lookupTemplateFunc(funcs map[string]TemplateFunc, name string) (TemplateFunc, bool) {
+	if f, ok := funcs[name]; ok {
+		return f, true
+	}
+	f, ok := builtinTemplateFuncs[name]
+	return f, ok
+}
+
+// renderTemplateFuncs replaces placeholders in tmpl with values from params, transformed by the functions
+// that follow them. Placeholders that refer to missing parameters or unknown functions, or whose functions
+// fail, are left as is.
+func renderTemplateFuncs(tmpl string, params map[string]string, funcs map[string]TemplateFunc) string {
+	return paramRegex.ReplaceAllStringFunc(tmpl, func(placeholder string) string {
+		param, calls := parsePlaceholder(placeholder[1 : len(placeholder)-1])
+		v, ok := params[param]
+		if !ok {
+			return placeholder
+		}
+		for _, call := range calls {
+			f, ok := lookupTemplateFunc(funcs, call.name)
+			if !ok {
+				return placeholder
+			}
+			var err error
+			if v, err = f(v, call.args...); err != nil {
+				return placeholder
+			}
+		}
+		return v
+	})
+}
+
+// ValidateTemplate reports placeholders of tmpl that have no parameter name, or that call functions that
+// are neither built in nor in funcs. The arguments of built-in functions are checked as well.
+func ValidateTemplate(tmpl string, funcs map[string]TemplateFunc) error {
+	for _, m := range paramRegex.FindAllStringSubmatch(tmpl, -1) {
+		param, calls := parsePlaceholder(m[1])
+		if param == "" {
+			return fmt.Errorf("placeholder %q has no parameter name", m[0])
+		}
+		for _, call := range calls {
+			if _, ok := funcs[call.name]; ok {
+				continue
+			}
+			f, ok := builtinTemplateFuncs[call.name]
+			if !ok {
+				return fmt.Errorf("placeholder %q calls unknown function %q", m[0], call.name)
+			}
+			if _, err := f("", call.args...); err != nil {
+				return fmt.Errorf("placeholder %q: %v", m[0], err)
+			}
+		}
+	}
+	return nil
+}
+
+// WithTemplateFuncs adds functions that placeholders of the template can call, e.g. with
+// {"hex": ...} the name template "User {id|hex}". They take precedence over built-in functions of the
+// same name. Functions are not preserved when the template is serialized as JSON.
+func WithTemplateFuncs(funcs map[string]TemplateFunc) ResourceTemplateOption {
+	return func(t *ResourceTemplate) {
+		t.funcs = funcs
+	}
+}
+
+// WithTemplateNameFunc computes resource names with f instead of the name template, for names that
+// placeholders can't express. f receives the path parameters. The name template is still used when the
+// template is serialized as JSON.
+func WithTemplateNameFunc(f func(params map[string]string) string) ResourceTemplateOption {
+	return func(t *ResourceTemplate) {
+		t.nameFunc = f
+	}
+}
@@ -0,0 +1,62 @@
+package uma_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pckhoi/uma"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTemplateFuncs(t *testing.T) {
+	types := map[string]uma.ResourceType{"user": {Type: "user"}}
+	params := map[string]string{"id": "ab1", "name": " Hello, World! "}
+	for _, c := range []struct {
+		tmpl string
+		name string
+	}{
+		{"User {id}", "User ab1"},
+		{"User {id|upper}", "User AB1"},
+		{"User {id|pad:6}", "User 000ab1"},
+		{"User {id|pad:5:_|upper}", "User __AB1"},
+		{"User {id|pad:2}", "User ab1"},
+		{"{name|slug}", "hello-world"},
+		{"{ name | trim | lower }", "hello, world!"},
+		{"User {id|unknown}", "User {id|unknown}"},
+		{"User {id|pad:x}", "User {id|pad:x}"},
+		{"User {missing|upper}", "User {missing|upper}"},
+		{"User {id|rev}", "User 1ba"},
+	} {
+		tmpl := uma.NewResourceTemplate("user", c.tmpl, uma.WithTemplateFuncs(map[string]uma.TemplateFunc{
+			"rev": func(value string, args ...string) (string, error) {
+				b := []byte(value)
+				for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+					b[i], b[j] = b[j], b[i]
+				}
+				return string(b), nil
+			},
+		}))
+		assert.Equal(t, c.name, tmpl.CreateResource(types, "https://api.example.com/users/ab1", params).Name, c.tmpl)
+	}
+
+	tmpl := uma.NewResourceTemplate("user", "User {id}",
+		uma.WithTemplateDisplayName("User {id|upper}"),
+		uma.WithTemplateNameFunc(func(params map[string]string) string {
+			return "User " + strings.ToUpper(params["id"])
+		}),
+	)
+	rsc := tmpl.CreateResource(types, "https://api.example.com/users/ab1", params)
+	assert.Equal(t, "User AB1", rsc.Name)
+	assert.Equal(t, "User AB1", rsc.DisplayName)
+}
+
+func TestValidateTemplate(t *testing.T) {
+	assert.NoError(t, uma.ValidateTemplate("User {id|trim|pad:6|upper}", nil))
+	assert.NoError(t, uma.ValidateTemplate("User {id|hex}", map[string]uma.TemplateFunc{
+		"hex": func(value string, args ...string) (string, error) { return value, nil },
+	}))
+	assert.EqualError(t, uma.ValidateTemplate("User {id|hex}", nil), `placeholder "{id|hex}" calls unknown function "hex"`)
+	assert.EqualError(t, uma.ValidateTemplate("User {id|pad}", nil), `placeholder "{id|pad}": pad takes a width and an optional padding character`)
+	assert.EqualError(t, uma.ValidateTemplate("User {id|upper:1}", nil), `placeholder "{id|upper:1}": upper takes no arguments`)
+	assert.EqualError(t, uma.ValidateTemplate("User {|upper}", nil), `placeholder "{|upper}" has no parameter name`)
+}
@@ -0,0 +1,119 @@
+package uma_test
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/pckhoi/uma"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTemplatesOverride(t *testing.T) {
+	p := newMockProvider(map[string]string{
+		"token-1": rptPayload("user-1", "User 1", "read"),
+	})
+	tmpls := uma.NewTemplates()
+	man := newMockManager(t, p, uma.ManagerOptions{Templates: tmpls})
+	h := man.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	status := func(method, token string) int {
+		return serve(h, method, "https://api.example.com/users/1", token).Code
+	}
+
+	assert.Equal(t, http.StatusOK, status(http.MethodGet, "token-1"))
+	assert.Equal(t, http.StatusUnauthorized, status(http.MethodPut, "token-1"))
+
+	tmpls.Override("/{id}", func(o *uma.TemplateOptions) {
+		o.Scopes = map[string][]string{http.MethodPut: {"read"}}
+	})
+	assert.Equal(t, http.StatusOK, status(http.MethodPut, "token-1"))
+	assert.Equal(t, http.StatusUnauthorized, status(http.MethodGet, ""))
+
+	// options are updated in place
+	tmpls.Override("/{id}", func(o *uma.TemplateOptions) {
+		o.Public = true
+	})
+	o, ok := tmpls.Options("/{id}")
+	assert.True(t, ok)
+	assert.Equal(t, uma.TemplateOptions{
+		Public: true,
+		Scopes: map[string][]string{http.MethodPut: {"read"}},
+	}, o)
+	assert.Equal(t, http.StatusOK, status(http.MethodGet, ""))
+	assert.Equal(t, http.StatusOK, status(http.MethodPut, ""))
+	ticketsBefore := p.tickets
+
+	tmpls.Override("/{id}", func(o *uma.TemplateOptions) {
+		o.Disabled = true
+	})
+	assert.Equal(t, http.StatusServiceUnavailable, status(http.MethodGet, "token-1"))
+	assert.Equal(t, http.StatusServiceUnavailable, status(http.MethodGet, ""))
+	assert.Equal(t, ticketsBefore, p.tickets)
+
+	tmpls.Reset("/{id}")
+	_, ok = tmpls.Options("/{id}")
+	assert.False(t, ok)
+	assert.Equal(t, http.StatusOK, status(http.MethodGet, "token-1"))
+	assert.Equal(t, http.StatusUnauthorized, status(http.MethodPut, "token-1"))
+}
+
+// scopeRecordingProvider records scopes of permission requests
+type scopeRecordingProvider struct {
+	*mockProvider
+	scopes [][]string
+}
+
+func (p *scopeRecordingProvider) CreatePermissionTicket(resourceID string, scopes ...string) (string, error) {
+	p.scopes = append(p.scopes, scopes)
+	return p.mockProvider.CreatePermissionTicket(resourceID, scopes...)
+}
+
+func TestIncludeScopesPerOperation(t *testing.T) {
+	p := &scopeRecordingProvider{mockProvider: newMockProvider(nil)}
+	rs := &syncResourceStore{m: map[string]string{}}
+	tmpls := uma.NewTemplates()
+	man := uma.New(
+		uma.ManagerOptions{
+			GetBaseURL: func(r *http.Request) url.URL {
+				return url.URL{Scheme: "https", Host: "api.example.com", Path: "/users"}
+			},
+			GetProvider:                     func(r *http.Request) uma.Provider { return p },
+			GetResourceStore:                func(r *http.Request) uma.ResourceStore { return rs },
+			IncludeScopesInPermissionTicket: true,
+			Templates:                       tmpls,
+		},
+		map[string]uma.ResourceType{"user": {Type: "user", ResourceScopes: []string{"read", "write"}}},
+		[]string{"oidc"},
+		nil,
+		[]map[string][]string{{"oidc": {"read"}}},
+		[]uma.Path{
+			uma.NewPath("/{id}", uma.NewResourceTemplate("user", "User {id}", uma.WithTemplateIncludeScopes(false)), map[string]uma.Operation{
+				http.MethodGet: {},
+				http.MethodPut: {
+					Security:      []map[string][]string{{"oidc": {"write"}}},
+					IncludeScopes: uma.Bool(true),
+				},
+			}),
+			uma.NewPath("/{id}/avatar", uma.NewResourceTemplate("user", "User {id}"), map[string]uma.Operation{
+				http.MethodGet: {},
+			}),
+		},
+		testr.New(t),
+	)
+	h := man.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	assert.Equal(t, http.StatusUnauthorized, serve(h, http.MethodGet, "https://api.example.com/users/1", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, serve(h, http.MethodPut, "https://api.example.com/users/1", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, serve(h, http.MethodGet, "https://api.example.com/users/1/avatar", "").Code)
+	assert.Equal(t, [][]string{nil, {"write"}, {"read"}}, p.scopes)
+
+	// runtime overrides take precedence
+	tmpls.Override("/{id}", func(o *uma.TemplateOptions) {
+		o.IncludeScopes = map[string]bool{http.MethodGet: true, http.MethodPut: false}
+	})
+	p.scopes = nil
+	serve(h, http.MethodGet, "https://api.example.com/users/1", "")
+	serve(h, http.MethodPut, "https://api.example.com/users/1", "")
+	assert.Equal(t, [][]string{{"read"}, nil}, p.scopes)
+}
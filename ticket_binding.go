@@ -0,0 +1,89 @@
+package uma
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// Claims pushed with permission requests when BindTicketsToClient is enabled
+const (
+	ClientIPClaim          = "client_ip"
+	ClientFingerprintClaim = "client_fingerprint"
+)
+
+// clientBindingClaims identifies the client that triggered a permission request
+func clientBindingClaims(r *http.Request) map[string][]string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	h := sha256.New()
+	for _, k := range []string{"User-Agent", "Accept-Language"} {
+		h.Write([]byte(r.Header.Get(k)))
+		h.Write([]byte{0})
+	}
+	return map[string][]string{
+		ClientIPClaim:          {ip},
+		ClientFingerprintClaim: {hex.EncodeToString(h.Sum(nil)[:16])},
+	}
+}
+
+// pushedClaimValues converts a claim value to strings, which is how claims are pushed
+func pushedClaimValues(v any) []string {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case string:
+		return []string{v}
+	case []string:
+		return v
+	case []any:
+		res := make([]string, 0, len(v))
+		for _, e := range v {
+			res = append(res, pushedClaimValues(e)...)
+		}
+		return res
+	default:
+		return []string{fmt.Sprint(v)}
+	}
+}
+
+// ticketClaims returns claims to push with the permission request of r, or nil if there is none
+func (m *Manager) ticketClaims(r *http.Request) map[string][]string {
+	var claims map[string][]string
+	if m.bindTicketsToClient {
+		claims = clientBindingClaims(r)
+	}
+	if m.getTicketClaims != nil {
+		for k, v := range m.getTicketClaims(r) {
+			if claims == nil {
+				claims = map[string][]string{}
+			}
+			claims[k] = pushedClaimValues(v)
+		}
+	}
+	return claims
+}
+
+// createPermissionTicket creates a ticket, pushing claims that bind it to the client and claims returned
+// by TicketClaims if enabled
+func (m *Manager) createPermissionTicket(r *http.Request, p Provider, resourceID string, scopes ...string) (string, error) {
+	release, err := m.acquireProvider(r.Context(), p)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+	if claims := m.ticketClaims(r); claims != nil {
+		if cp, ok := p.(ClaimPushingProvider); ok {
+			return cp.CreatePermissionTicketWithClaims(resourceID, claims, scopes...)
+		}
+		m.logger.Info("provider can't push claims, permission ticket is issued without claims",
+			"method", r.Method,
+			"path", r.URL.Path,
+		)
+	}
+	return p.CreatePermissionTicket(resourceID, scopes...)
+}
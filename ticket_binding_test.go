@@ -0,0 +1,88 @@
+package uma_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pckhoi/uma"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// claimPushingProvider records claims pushed with permission requests
+type claimPushingProvider struct {
+	*mockProvider
+	claims []map[string][]string
+}
+
+func (p *claimPushingProvider) CreatePermissionTicketWithClaims(resourceID string, claims map[string][]string, scopes ...string) (string, error) {
+	p.claims = append(p.claims, claims)
+	return fmt.Sprintf("bound-ticket-%d", len(p.claims)), nil
+}
+
+func TestBindTicketsToClient(t *testing.T) {
+	request := func(h http.Handler, remoteAddr, userAgent string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "https://api.example.com/users/1", nil)
+		r.RemoteAddr = remoteAddr
+		r.Header.Set("User-Agent", userAgent)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		return rec
+	}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	p := &claimPushingProvider{mockProvider: newMockProvider(nil)}
+	h := newMockManager(t, p, uma.ManagerOptions{BindTicketsToClient: true}).Middleware(next)
+	rec := request(h, "203.0.113.7:4321", "curl/8.0")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Contains(t, rec.Header().Get("WWW-Authenticate"), `ticket="bound-ticket-1"`)
+	request(h, "203.0.113.7:4321", "curl/8.0")
+	request(h, "203.0.113.8:4321", "Mozilla/5.0")
+	require.Len(t, p.claims, 3)
+	assert.Equal(t, []string{"203.0.113.7"}, p.claims[0][uma.ClientIPClaim])
+	assert.Len(t, p.claims[0][uma.ClientFingerprintClaim][0], 32)
+	assert.Equal(t, p.claims[0], p.claims[1])
+	assert.Equal(t, []string{"203.0.113.8"}, p.claims[2][uma.ClientIPClaim])
+	assert.NotEqual(t, p.claims[0][uma.ClientFingerprintClaim], p.claims[2][uma.ClientFingerprintClaim])
+
+	// claims are not pushed unless enabled
+	p = &claimPushingProvider{mockProvider: newMockProvider(nil)}
+	h = newMockManager(t, p, uma.ManagerOptions{}).Middleware(next)
+	rec = request(h, "203.0.113.7:4321", "curl/8.0")
+	assert.Contains(t, rec.Header().Get("WWW-Authenticate"), `ticket="ticket-1"`)
+	assert.Empty(t, p.claims)
+
+	// providers that can't push claims still issue tickets
+	h = newMockManager(t, newMockProvider(nil), uma.ManagerOptions{BindTicketsToClient: true}).Middleware(next)
+	rec = request(h, "203.0.113.7:4321", "curl/8.0")
+	assert.Contains(t, rec.Header().Get("WWW-Authenticate"), `ticket="ticket-1"`)
+}
+
+func TestTicketClaims(t *testing.T) {
+	p := &claimPushingProvider{mockProvider: newMockProvider(nil)}
+	h := newMockManager(t, p, uma.ManagerOptions{
+		BindTicketsToClient: true,
+		TicketClaims: func(r *http.Request) map[string]any {
+			return map[string]any{
+				"tenant":          r.Header.Get("X-Tenant"),
+				"groups":          []any{"admin", 1},
+				"mfa":             true,
+				uma.ClientIPClaim: "198.51.100.1",
+			}
+		},
+	}).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	r := httptest.NewRequest(http.MethodGet, "https://api.example.com/users/1", nil)
+	r.Header.Set("X-Tenant", "acme")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Contains(t, rec.Header().Get("WWW-Authenticate"), `ticket="bound-ticket-1"`)
+	require.Len(t, p.claims, 1)
+	assert.Equal(t, []string{"acme"}, p.claims[0]["tenant"])
+	assert.Equal(t, []string{"admin", "1"}, p.claims[0]["groups"])
+	assert.Equal(t, []string{"true"}, p.claims[0]["mfa"])
+	assert.Equal(t, []string{"198.51.100.1"}, p.claims[0][uma.ClientIPClaim])
+	assert.Len(t, p.claims[0][uma.ClientFingerprintClaim], 1)
+}
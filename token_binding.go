@@ -0,0 +1,90 @@
+package uma
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+)
+
+var errTokenNotBound = errors.New("token is not bound to client")
+
+// TokenBinding binds tokens to the client they were issued to, as a basic mitigation of token theft.
+// Requests whose metadata don't match the claims of their token are denied. Checks whose fields are
+// empty are skipped.
+type TokenBinding struct {
+	// IPClaim is the claim that holds the client IP, e.g. ClientIPClaim if pushed claims of
+	// BindTicketsToClient are mapped to the token
+	IPClaim string
+
+	// FingerprintClaim is the claim that holds the fingerprint of the client's User-Agent and
+	// Accept-Language headers, e.g. ClientFingerprintClaim
+	FingerprintClaim string
+
+	// SessionCookie is the cookie that must match SessionClaim, e.g. a cookie set by the app at login
+	SessionCookie string
+
+	// SessionClaim is the claim that holds the session id. Defaults to "sid".
+	SessionClaim string
+
+	// CertificateBound if true, checks the "x5t#S256" confirmation of the "cnf" claim against the TLS
+	// client certificate, as specified by RFC 8705. It requires TLS to be terminated by the server.
+	CertificateBound bool
+
+	// ClientIP returns the client IP of the request. Defaults to the host of r.RemoteAddr.
+	ClientIP func(r *http.Request) string
+}
+
+// claimContains reports whether claim, which is a string or an array of strings, contains value
+func claimContains(claim interface{}, value string) bool {
+	switch v := claim.(type) {
+	case string:
+		return v == value
+	case []interface{}:
+		for _, s := range v {
+			if s == value {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// mismatch returns the name of the first check that fails, or empty string if the token is bound to
+// the client of r
+func (b *TokenBinding) mismatch(r *http.Request, rpt *RPT) string {
+	client := clientBindingClaims(r)
+	if b.IPClaim != "" {
+		ip := client[ClientIPClaim][0]
+		if b.ClientIP != nil {
+			ip = b.ClientIP(r)
+		}
+		if !claimContains(rpt.Raw[b.IPClaim], ip) {
+			return "ip"
+		}
+	}
+	if b.FingerprintClaim != "" && !claimContains(rpt.Raw[b.FingerprintClaim], client[ClientFingerprintClaim][0]) {
+		return "fingerprint"
+	}
+	if b.SessionCookie != "" {
+		claim := b.SessionClaim
+		if claim == "" {
+			claim = "sid"
+		}
+		c, err := r.Cookie(b.SessionCookie)
+		if err != nil || c.Value == "" || !claimContains(rpt.Raw[claim], c.Value) {
+			return "session"
+		}
+	}
+	if b.CertificateBound {
+		cnf, _ := rpt.Raw["cnf"].(map[string]interface{})
+		if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 || cnf == nil {
+			return "certificate"
+		}
+		sum := sha256.Sum256(r.TLS.PeerCertificates[0].Raw)
+		if !claimContains(cnf["x5t#S256"], base64.RawURLEncoding.EncodeToString(sum[:])) {
+			return "certificate"
+		}
+	}
+	return ""
+}
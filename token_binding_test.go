@@ -0,0 +1,98 @@
+package uma_test
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pckhoi/uma"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenBinding(t *testing.T) {
+	request := func(h http.Handler, token, remoteAddr, userAgent string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "https://api.example.com/users/1", nil)
+		r.RemoteAddr = remoteAddr
+		r.Header.Set("User-Agent", userAgent)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		return rec
+	}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	p := &claimPushingProvider{mockProvider: newMockProvider(map[string]string{})}
+	h := newMockManager(t, p, uma.ManagerOptions{
+		BindTicketsToClient: true,
+		TokenBinding: &uma.TokenBinding{
+			IPClaim:          uma.ClientIPClaim,
+			FingerprintClaim: uma.ClientFingerprintClaim,
+		},
+	}).Middleware(next)
+
+	// claims pushed with the ticket end up in the token
+	assert.Equal(t, http.StatusUnauthorized, request(h, "", "203.0.113.7:4321", "curl/8.0").Code)
+	require.Len(t, p.claims, 1)
+	p.tokens["token-1"] = fmt.Sprintf(
+		`{"sub":"user-1","client_ip":[%q],"client_fingerprint":%q,"authorization":{"permissions":[{"rsid":"rsc-User 1","scopes":["read"]}]}}`,
+		p.claims[0][uma.ClientIPClaim][0], p.claims[0][uma.ClientFingerprintClaim][0],
+	)
+
+	assert.Equal(t, http.StatusOK, request(h, "token-1", "203.0.113.7:5555", "curl/8.0").Code)
+	assert.Equal(t, http.StatusUnauthorized, request(h, "token-1", "203.0.113.8:4321", "curl/8.0").Code)
+	assert.Equal(t, http.StatusUnauthorized, request(h, "token-1", "203.0.113.7:4321", "Mozilla/5.0").Code)
+}
+
+func TestTokenBindingSessionCookie(t *testing.T) {
+	p := newMockProvider(map[string]string{
+		"token-1": `{"sub":"user-1","sid":"session-1","authorization":{"permissions":[{"rsid":"rsc-User 1","scopes":["read"]}]}}`,
+	})
+	h := newMockManager(t, p, uma.ManagerOptions{
+		TokenBinding: &uma.TokenBinding{SessionCookie: "session"},
+	}).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	request := func(cookie string) int {
+		r := httptest.NewRequest(http.MethodGet, "https://api.example.com/users/1", nil)
+		r.Header.Set("Authorization", "Bearer token-1")
+		if cookie != "" {
+			r.AddCookie(&http.Cookie{Name: "session", Value: cookie})
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		return rec.Code
+	}
+	assert.Equal(t, http.StatusOK, request("session-1"))
+	assert.Equal(t, http.StatusUnauthorized, request("session-2"))
+	assert.Equal(t, http.StatusUnauthorized, request(""))
+}
+
+func TestTokenBindingCertificate(t *testing.T) {
+	cert := &x509.Certificate{Raw: []byte("client certificate")}
+	sum := sha256.Sum256(cert.Raw)
+	p := newMockProvider(map[string]string{
+		"token-1": fmt.Sprintf(
+			`{"sub":"user-1","cnf":{"x5t#S256":%q},"authorization":{"permissions":[{"rsid":"rsc-User 1","scopes":["read"]}]}}`,
+			base64.RawURLEncoding.EncodeToString(sum[:]),
+		),
+	})
+	h := newMockManager(t, p, uma.ManagerOptions{
+		TokenBinding: &uma.TokenBinding{CertificateBound: true},
+	}).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	request := func(certs ...*x509.Certificate) int {
+		r := httptest.NewRequest(http.MethodGet, "https://api.example.com/users/1", nil)
+		r.Header.Set("Authorization", "Bearer token-1")
+		r.TLS = &tls.ConnectionState{PeerCertificates: certs}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		return rec.Code
+	}
+	assert.Equal(t, http.StatusOK, request(cert))
+	assert.Equal(t, http.StatusUnauthorized, request(&x509.Certificate{Raw: []byte("other")}))
+	assert.Equal(t, http.StatusUnauthorized, request())
+}
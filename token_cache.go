@@ -0,0 +1,60 @@
+package uma
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"time"
+
+	"github.com/pckhoi/uma/pkg/clock"
+)
+
+const defaultTokenCacheTTL = 5 * time.Minute
+
+type verifiedToken struct {
+	digest  [sha256.Size]byte
+	payload []byte
+}
+
+// tokenCache memoizes signature verification results. Entries are keyed by issuer and a truncated
+// token digest, the full digest is then compared in constant time.
+type tokenCache struct {
+	lru *lruCache[verifiedToken]
+	ttl time.Duration
+}
+
+func newTokenCache(size int, ttl time.Duration, c clock.Clock) *tokenCache {
+	if ttl == 0 {
+		ttl = defaultTokenCacheTTL
+	}
+	lru := newLRUCache[verifiedToken](size)
+	lru.now = c.Now
+	return &tokenCache{
+		lru: lru,
+		ttl: ttl,
+	}
+}
+
+func tokenCacheKey(issuer string, digest [sha256.Size]byte) string {
+	return issuer + " " + hex.EncodeToString(digest[:16])
+}
+
+func (c *tokenCache) verify(ctx context.Context, p Provider, token string) (payload []byte, cached bool, err error) {
+	digest := sha256.Sum256([]byte(token))
+	key := tokenCacheKey(p.WWWAuthenticateDirectives().AsUri, digest)
+	if v, ok := c.lru.get(key); ok && subtle.ConstantTimeCompare(v.digest[:], digest[:]) == 1 {
+		return v.payload, true, nil
+	}
+	payload, err = p.VerifySignature(ctx, token)
+	if err != nil {
+		return nil, false, err
+	}
+	c.lru.set(key, verifiedToken{digest: digest, payload: payload}, c.ttl)
+	return payload, false, nil
+}
+
+// remove forgets the verification result of token
+func (c *tokenCache) remove(p Provider, token string) {
+	c.lru.remove(tokenCacheKey(p.WWWAuthenticateDirectives().AsUri, sha256.Sum256([]byte(token))))
+}
@@ -0,0 +1,41 @@
+package uma_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pckhoi/uma"
+	"github.com/stretchr/testify/assert"
+)
+
+func serve(h http.Handler, method, uri, token string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, uri, nil)
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	return rec
+}
+
+func TestTokenCache(t *testing.T) {
+	p := newMockProvider(map[string]string{
+		"token-1": rptPayload("user-1", "User 1", "read"),
+	})
+	man := newMockManager(t, p, uma.ManagerOptions{TokenCacheSize: 10})
+	h := man.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusOK, serve(h, http.MethodGet, "https://api.example.com/users/1", "token-1").Code)
+	}
+	assert.Equal(t, 1, p.verified)
+
+	assert.Equal(t, http.StatusUnauthorized, serve(h, http.MethodPut, "https://api.example.com/users/1", "token-1").Code)
+	assert.Equal(t, 1, p.verified)
+
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, http.StatusUnauthorized, serve(h, http.MethodGet, "https://api.example.com/users/1", "token-2").Code)
+	}
+	assert.Equal(t, 3, p.verified)
+}
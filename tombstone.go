@@ -0,0 +1,173 @@
+package uma
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pckhoi/uma/pkg/clock"
+)
+
+// ResourceTombstoneStore is implemented by ResourceStore implementations that can keep tombstones of
+// resources that were deleted on purpose. The Manager doesn't register a resource that has a tombstone,
+// so that replicas sharing the store don't register it again right after it is deleted, e.g. by
+// reconciliation. Tombstones expire after their TTL, after which the resource is registered as usual.
+type ResourceTombstoneStore interface {
+	// Tombstone records that the resource with given name was deleted, for the duration of ttl
+	Tombstone(name string, ttl time.Duration) error
+
+	// Tombstoned reports whether the resource with given name has a tombstone that hasn't expired
+	Tombstoned(name string) (bool, error)
+}
+
+// ErrResourceTombstoned is returned when registering a resource that has a tombstone. The middleware
+// responds to requests for such resources with 404.
+type ErrResourceTombstoned struct {
+	Name string
+}
+
+func (err ErrResourceTombstoned) Error() string {
+	return fmt.Sprintf("resource %q was deleted", err.Name)
+}
+
+// checkTombstone returns ErrResourceTombstoned if rs implements ResourceTombstoneStore and has a tombstone
+// under key for resource name
+func checkTombstone(rs ResourceStore, key, name string) error {
+	ts, ok := rs.(ResourceTombstoneStore)
+	if !ok {
+		return nil
+	}
+	dead, err := ts.Tombstoned(key)
+	if err != nil {
+		return err
+	}
+	if dead {
+		return ErrResourceTombstoned{Name: name}
+	}
+	return nil
+}
+
+// DeleteResource deletes the resource registered with p under name and leaves a tombstone in rs for the
+// duration of ttl if rs implements ResourceTombstoneStore. The id is taken from rs, or looked up by name
+// if rs doesn't have it. The resource is then invalidated as with InvalidateResource.
+func (m *Manager) DeleteResource(p Provider, rs ResourceStore, name string, ttl time.Duration) error {
+	id, err := m.storeGet(rs, p, name)
+	if err != nil {
+		return err
+	}
+	if id == "" {
+		if id, err = m.lookupResourceByName(p, name); err != nil {
+			return err
+		}
+	}
+	// the tombstone comes first so that no replica registers the resource in between
+	if ts, ok := rs.(ResourceTombstoneStore); ok {
+		if err := ts.Tombstone(m.storeKey(p, name), ttl); err != nil {
+			return err
+		}
+	}
+	if id != "" {
+		if err := p.DeleteResource(id); err != nil {
+			return err
+		}
+		m.logger.Info("deleted resource", "id", id, "name", name)
+	}
+	return m.InvalidateResource(p, rs, name)
+}
+
+// MemoryResourceStore is an in-memory ResourceStore. It implements ResourceStoreDeleter,
+// ResourceHashStore, ResourceTombstoneStore and ResourceStoreLister. Expired tombstones are removed whenever a tombstone is
+// added. Since it is not shared, it suits a single replica or tests.
+type MemoryResourceStore struct {
+	clock      clock.Clock
+	mu         sync.Mutex
+	ids        map[string]string
+	hashes     map[string]string
+	tombstones map[string]time.Time
+}
+
+// NewMemoryResourceStore creates a MemoryResourceStore. Tombstones expire according to c, which defaults
+// to the real clock if nil.
+func NewMemoryResourceStore(c clock.Clock) *MemoryResourceStore {
+	return &MemoryResourceStore{
+		clock:      clock.OrReal(c),
+		ids:        map[string]string{},
+		hashes:     map[string]string{},
+		tombstones: map[string]time.Time{},
+	}
+}
+
+func (s *MemoryResourceStore) Set(name, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ids[name] = id
+	return nil
+}
+
+func (s *MemoryResourceStore) Get(name string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ids[name], nil
+}
+
+func (s *MemoryResourceStore) List() (map[string]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	res := make(map[string]string, len(s.ids))
+	for k, v := range s.ids {
+		res[k] = v
+	}
+	return res, nil
+}
+
+func (s *MemoryResourceStore) Delete(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.ids, name)
+	delete(s.hashes, name)
+	return nil
+}
+
+func (s *MemoryResourceStore) SetHash(name, hash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hashes[name] = hash
+	return nil
+}
+
+func (s *MemoryResourceStore) GetHash(name string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.hashes[name], nil
+}
+
+func (s *MemoryResourceStore) Tombstone(name string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.clock.Now()
+	for k, expiry := range s.tombstones {
+		if !now.Before(expiry) {
+			delete(s.tombstones, k)
+		}
+	}
+	s.tombstones[name] = now.Add(ttl)
+	return nil
+}
+
+func (s *MemoryResourceStore) Tombstoned(name string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	expiry, ok := s.tombstones[name]
+	if ok && !s.clock.Now().Before(expiry) {
+		delete(s.tombstones, name)
+		return false, nil
+	}
+	return ok, nil
+}
+
+// Tombstones returns the number of tombstones, including expired ones that were not removed yet
+func (s *MemoryResourceStore) Tombstones() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.tombstones)
+}
@@ -0,0 +1,59 @@
+package uma_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/pckhoi/uma"
+	"github.com/pckhoi/uma/pkg/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeleteResourceTombstone(t *testing.T) {
+	c := clock.NewFake(time.Now())
+	p := newMockProvider(map[string]string{
+		"token-1": rptPayload("user-1", "User 1", "read"),
+	})
+	rs := uma.NewMemoryResourceStore(c)
+	man := newMockManager(t, p, uma.ManagerOptions{
+		GetResourceStore: func(r *http.Request) uma.ResourceStore { return rs },
+		ResourceCache:    uma.NewMemoryResourceCache(10),
+	})
+	h := man.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	assert.Equal(t, http.StatusOK, serve(h, http.MethodGet, "https://api.example.com/users/1", "token-1").Code)
+	require.NoError(t, man.DeleteResource(p, rs, "User 1", time.Minute))
+	assert.Equal(t, []string{"rsc-User 1"}, p.deleted)
+	id, _ := rs.Get("User 1")
+	assert.Empty(t, id)
+
+	// not registered again while tombstoned
+	assert.Equal(t, http.StatusNotFound, serve(h, http.MethodGet, "https://api.example.com/users/1", "token-1").Code)
+	assert.NotContains(t, p.names, "rsc-User 1")
+
+	c.Advance(time.Minute)
+	assert.Equal(t, http.StatusOK, serve(h, http.MethodGet, "https://api.example.com/users/1", "token-1").Code)
+	assert.Contains(t, p.names, "rsc-User 1")
+}
+
+func TestMemoryResourceStoreTombstones(t *testing.T) {
+	c := clock.NewFake(time.Now())
+	rs := uma.NewMemoryResourceStore(c)
+	require.NoError(t, rs.Tombstone("User 1", time.Second))
+	require.NoError(t, rs.Tombstone("User 2", time.Hour))
+	dead, err := rs.Tombstoned("User 1")
+	require.NoError(t, err)
+	assert.True(t, dead)
+
+	c.Advance(time.Second)
+	dead, _ = rs.Tombstoned("User 2")
+	assert.True(t, dead)
+	assert.Equal(t, 2, rs.Tombstones())
+	// expired tombstones are cleaned up when another one is added
+	require.NoError(t, rs.Tombstone("User 3", time.Hour))
+	assert.Equal(t, 2, rs.Tombstones())
+	dead, _ = rs.Tombstoned("User 1")
+	assert.False(t, dead)
+}
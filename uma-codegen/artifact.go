@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/pckhoi/uma"
+)
+
+// toUMA returns the template that the generated code creates with uma.NewResourceTemplate
+func (t *resourceTemplate) toUMA() *uma.ResourceTemplate {
+	if t == nil {
+		return nil
+	}
+	var opts []uma.ResourceTemplateOption
+	if t.DisplayName != "" {
+		opts = append(opts, uma.WithTemplateDisplayName(t.DisplayName))
+	}
+	if t.Description != "" {
+		opts = append(opts, uma.WithTemplateDescription(t.Description))
+	}
+	if t.IconURI != "" {
+		opts = append(opts, uma.WithTemplateIconURI(t.IconURI))
+	}
+	if t.LocalizedDisplayNames != nil {
+		opts = append(opts, uma.WithTemplateLocalizedDisplayNames(t.LocalizedDisplayNames))
+	}
+	if t.LocalizedIconURIs != nil {
+		opts = append(opts, uma.WithTemplateLocalizedIconURIs(t.LocalizedIconURIs))
+	}
+	if t.OwnerManagedAccess {
+		opts = append(opts, uma.WithTemplateOwnerManagedAccess())
+	}
+	if t.IncludeScopes != nil {
+		opts = append(opts, uma.WithTemplateIncludeScopes(*t.IncludeScopes))
+	}
+	return uma.NewResourceTemplate(t.Type, t.Name, opts...)
+}
+
+// newMatcher builds the same matcher as the generated UMAMatcher
+func newMatcher(data middlewareTemplateData) *uma.Matcher {
+	rscTypes := map[string]uma.ResourceType{}
+	for k, v := range data.ResourceTypes {
+		t := uma.ResourceType{
+			Type:           k,
+			DisplayName:    v.DisplayName,
+			Description:    v.Description,
+			IconUri:        v.IconUri,
+			ResourceScopes: v.ResourceScopes,
+		}
+		for name, s := range v.ScopeDescriptions {
+			if t.ScopeDescriptions == nil {
+				t.ScopeDescriptions = map[string]uma.ScopeDescription{}
+			}
+			t.ScopeDescriptions[name] = uma.ScopeDescription{
+				Name:        name,
+				DisplayName: s.DisplayName,
+				Description: s.Description,
+				IconUri:     s.IconUri,
+			}
+		}
+		rscTypes[k] = t
+	}
+	paths := make([]uma.Path, len(data.Paths))
+	for i, p := range data.Paths {
+		ops := map[string]uma.Operation{}
+		for method, op := range p.Operations {
+			ops[method] = uma.Operation{
+				Security:      op.Security,
+				IncludeScopes: op.IncludeScopes,
+			}
+		}
+		paths[i] = uma.NewPath(p.Path, p.Resource.toUMA(), ops)
+	}
+	return uma.NewMatcher(
+		rscTypes,
+		data.EnabledSecuritySchemes,
+		data.DefaultResource.toUMA(),
+		data.DefaultSecurity,
+		paths,
+	)
+}
+
+// renderJSONArtifact writes the matcher as JSON, in the format read by uma.LoadTemplatesJSON
+func renderJSONArtifact(w io.Writer, data middlewareTemplateData) error {
+	b, err := json.MarshalIndent(newMatcher(data), "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
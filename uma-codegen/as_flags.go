@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"github.com/pckhoi/uma"
+	"github.com/spf13/cobra"
+)
+
+// addASFlags adds flags that identify the authorization server and the resource server client
+func addASFlags(cmd *cobra.Command) {
+	addOptionalASFlags(cmd)
+	cmd.MarkFlagRequired("issuer")
+	cmd.MarkFlagRequired("client-id")
+	cmd.MarkFlagRequired("client-secret")
+}
+
+// addOptionalASFlags adds the flags of addASFlags without requiring them, for commands that only contact
+// the authorization server on demand
+func addOptionalASFlags(cmd *cobra.Command) {
+	cmd.Flags().String("issuer", "", "issuer url of the authorization server e.g. https://kc.example.com/realms/demo")
+	cmd.Flags().String("client-id", "", "client id of the resource server")
+	cmd.Flags().String("client-secret", "", "client secret of the resource server")
+}
+
+// providerFromFlags discovers the authorization server given by flags added with addASFlags
+func providerFromFlags(cmd *cobra.Command) (*uma.BaseProvider, error) {
+	issuer, err := cmd.Flags().GetString("issuer")
+	if err != nil {
+		return nil, err
+	}
+	clientID, err := cmd.Flags().GetString("client-id")
+	if err != nil {
+		return nil, err
+	}
+	clientSecret, err := cmd.Flags().GetString("client-secret")
+	if err != nil {
+		return nil, err
+	}
+	return uma.NewBaseProvider(strings.TrimSuffix(issuer, "/"), clientID, clientSecret, nil, nil, logr.Discard())
+}
+
+// decodeJWTPayload returns the payload of a JSON web token without verifying its signature
+func decodeJWTPayload(token string) ([]byte, error) {
+	parts := strings.Split(strings.TrimSpace(token), ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed jwt: expected 3 parts, found %d", len(parts))
+	}
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return nil, fmt.Errorf("malformed jwt payload: %w", err)
+	}
+	return b, nil
+}
+
+// lookupResourceID finds the id of the resource with the given name
+func lookupResourceID(p uma.Provider, name string) (string, error) {
+	ids, err := p.ListResources(map[string][]string{
+		"name":      {name},
+		"exactName": {"true"},
+	})
+	if err != nil {
+		return "", err
+	}
+	for _, id := range ids {
+		rsc, err := p.GetResource(id)
+		if err != nil {
+			return "", err
+		}
+		if rsc.Name == name {
+			return id, nil
+		}
+	}
+	return "", fmt.Errorf("resource %q not found", name)
+}
+
+func printJSON(w io.Writer, title string, v interface{}) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s:\n%s\n\n", title, b)
+	return err
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// specExts are extensions of OpenAPI spec files picked up from directories
+var specExts = map[string]struct{}{".yml": {}, ".yaml": {}, ".json": {}}
+
+// findSpecs expands directories in args into the spec files they contain, in lexical order
+func findSpecs(args []string) ([]string, error) {
+	var specs []string
+	for _, arg := range args {
+		fi, err := os.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !fi.IsDir() {
+			specs = append(specs, arg)
+			continue
+		}
+		entries, err := os.ReadDir(arg)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			if _, ok := specExts[filepath.Ext(e.Name())]; ok && !e.IsDir() {
+				specs = append(specs, filepath.Join(arg, e.Name()))
+			}
+		}
+	}
+	if len(specs) == 0 {
+		return nil, fmt.Errorf("no spec found in %v", args)
+	}
+	return specs, nil
+}
+
+// specPackage derives a package name from the spec file name e.g. "user-service.yml" becomes "userservice"
+func specPackage(spec string) string {
+	name := strings.TrimSuffix(filepath.Base(spec), filepath.Ext(spec))
+	return strings.ToLower(goName(name))
+}
+
+func BatchCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "batch SPEC_OR_DIR... --out-dir DIR [--import-path PATH [--registry-package NAME]]",
+		Short: "Generate code for multiple OpenAPI specs at once",
+		Long: `Generate code for each OpenAPI spec file, or each *.yml, *.yaml and *.json file of a directory.
+The code of each spec is written to OUT_DIR/PACKAGE/uma.gen.go, where PACKAGE is derived from the
+file name e.g. "user-service.yml" becomes "userservice". If --import-path, the import path of OUT_DIR,
+is given, a registry of all generated matchers and template overrides is written to
+OUT_DIR/registry.gen.go.`,
+		Args:         cobra.MinimumNArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			outDir, err := cmd.Flags().GetString("out-dir")
+			if err != nil {
+				return err
+			}
+			importPath, err := cmd.Flags().GetString("import-path")
+			if err != nil {
+				return err
+			}
+			registryPkg, err := cmd.Flags().GetString("registry-package")
+			if err != nil {
+				return err
+			}
+			tmplDir, err := cmd.Flags().GetString("templates")
+			if err != nil {
+				return err
+			}
+			values, err := cmd.Flags().GetStringToString("set")
+			if err != nil {
+				return err
+			}
+			watch, err := cmd.Flags().GetBool("watch")
+			if err != nil {
+				return err
+			}
+			interval, err := cmd.Flags().GetDuration("watch-interval")
+			if err != nil {
+				return err
+			}
+
+			generate := func() error {
+				t, err := loadTemplates(tmplDir)
+				if err != nil {
+					return err
+				}
+				specs, err := findSpecs(args)
+				if err != nil {
+					return err
+				}
+
+				// check package names before anything is written
+				pkgs := map[string]string{}
+				for _, spec := range specs {
+					pkg := specPackage(spec)
+					if pkg == "" {
+						return fmt.Errorf("cannot derive package name from %q", spec)
+					}
+					if other, ok := pkgs[pkg]; ok {
+						return fmt.Errorf("%q and %q both map to package %s", other, spec, pkg)
+					}
+					pkgs[pkg] = spec
+				}
+
+				registry := registryTemplateData{Package: registryPkg}
+				for _, spec := range specs {
+					pkg := specPackage(spec)
+					data, err := newMiddlewareTemplateData(spec, pkg)
+					if err != nil {
+						return fmt.Errorf("%s: %w", spec, err)
+					}
+					data.Values = values
+					output := filepath.Join(outDir, pkg, "uma.gen.go")
+					changed, err := writeIfChanged(output, func(w io.Writer) error {
+						return renderMiddlewareCode(w, t, data)
+					})
+					if err != nil {
+						return err
+					}
+					if changed {
+						fmt.Fprintf(cmd.OutOrStdout(), "%s -> %s\n", spec, output)
+					}
+					registry.Specs = append(registry.Specs, registrySpec{
+						Package:    pkg,
+						ImportPath: strings.TrimSuffix(importPath, "/") + "/" + pkg,
+					})
+				}
+				if importPath == "" {
+					return nil
+				}
+				sort.Slice(registry.Specs, func(i, j int) bool {
+					return registry.Specs[i].Package < registry.Specs[j].Package
+				})
+				_, err = writeIfChanged(filepath.Join(outDir, "registry.gen.go"), func(w io.Writer) error {
+					return renderRegistryCode(w, t, registry)
+				})
+				return err
+			}
+			if err := generate(); err != nil {
+				return err
+			}
+			if watch {
+				watchFiles(cmd.Context(), watchedPaths(append([]string{tmplDir}, args...)...), interval, cmd.ErrOrStderr(), generate)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().String("out-dir", "", "directory under which a package is generated for each spec")
+	cmd.Flags().String("import-path", "", "import path of --out-dir, required to generate the registry")
+	cmd.Flags().String("registry-package", "umaregistry", "package name of the registry")
+	cmd.Flags().String("templates", "", "directory of *.tmpl files that override built-in templates")
+	cmd.Flags().StringToString("set", nil, "key=value pairs available to templates as .Values")
+	addWatchFlags(cmd)
+	cmd.MarkFlagRequired("out-dir")
+	return cmd
+}
@@ -0,0 +1,57 @@
+package main_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	main "github.com/pckhoi/uma/uma-codegen"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBatchCmd(t *testing.T) {
+	spec, err := os.ReadFile("testdata/openapi.yml")
+	require.NoError(t, err)
+	specDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(specDir, "user-service.yml"), spec, 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(specDir, "billing.yaml"), spec, 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(specDir, "README.md"), []byte("not a spec"), 0644))
+	outDir := t.TempDir()
+
+	run := func(args ...string) (string, error) {
+		cmd := main.RootCmd()
+		out := &bytes.Buffer{}
+		cmd.SetOut(out)
+		cmd.SetErr(out)
+		cmd.SetArgs(append([]string{"batch"}, args...))
+		err := cmd.Execute()
+		return out.String(), err
+	}
+
+	_, err = run(specDir, "--out-dir", outDir, "--import-path", "example.com/app/gen/")
+	require.NoError(t, err)
+	b, err := os.ReadFile(filepath.Join(outDir, "userservice", "uma.gen.go"))
+	require.NoError(t, err)
+	assert.Contains(t, string(b), "package userservice\n")
+	b, err = os.ReadFile(filepath.Join(outDir, "billing", "uma.gen.go"))
+	require.NoError(t, err)
+	assert.Contains(t, string(b), "package billing\n")
+	b, err = os.ReadFile(filepath.Join(outDir, "registry.gen.go"))
+	require.NoError(t, err)
+	assert.Contains(t, string(b), "package umaregistry\n")
+	assert.Contains(t, string(b), `userservice "example.com/app/gen/userservice"`)
+	assert.Contains(t, string(b), `"billing":     billing.UMAMatcher,`)
+
+	// the registry is only generated with an import path
+	outDir = t.TempDir()
+	_, err = run(filepath.Join(specDir, "billing.yaml"), "--out-dir", outDir)
+	require.NoError(t, err)
+	assert.FileExists(t, filepath.Join(outDir, "billing", "uma.gen.go"))
+	assert.NoFileExists(t, filepath.Join(outDir, "registry.gen.go"))
+
+	require.NoError(t, os.WriteFile(filepath.Join(specDir, "billing.json"), spec, 0644))
+	_, err = run(specDir, "--out-dir", outDir)
+	assert.ErrorContains(t, err, "both map to package billing")
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/pckhoi/uma"
+	"github.com/spf13/cobra"
+)
+
+func BundleCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "bundle --issuer ISSUER --client-id ID --client-secret SECRET [--output FILE] [--signing-alg ALG]...",
+		Short: "Export a bundle to verify RPTs offline",
+		Long: `Export the signing keys, discovery document and registered resources of the authorization
+server as a JSON verification bundle. Services without connectivity to the authorization server
+load it with uma.LoadVerificationBundle and enforce permissions with uma.NewOfflineProvider.
+Export the bundle again whenever keys are rotated or resources are added.`,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			output, err := cmd.Flags().GetString("output")
+			if err != nil {
+				return err
+			}
+			algs, err := cmd.Flags().GetStringSlice("signing-alg")
+			if err != nil {
+				return err
+			}
+			p, err := providerFromFlags(cmd)
+			if err != nil {
+				return err
+			}
+			bundle, err := uma.ExportVerificationBundle(p, nil)
+			if err != nil {
+				return err
+			}
+			if len(algs) > 0 {
+				bundle.SigningAlgorithms = algs
+			}
+			b, err := json.MarshalIndent(bundle, "", "  ")
+			if err != nil {
+				return err
+			}
+			b = append(b, '\n')
+			if output == "" {
+				_, err = cmd.OutOrStdout().Write(b)
+				return err
+			}
+			if err := os.WriteFile(output, b, 0644); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.ErrOrStderr(), "exported %d keys and %d resources to %s\n", len(bundle.JWKS.Keys), len(bundle.Resources), output)
+			return nil
+		},
+	}
+	addASFlags(cmd)
+	cmd.Flags().StringP("output", "o", "", "write the bundle to this file instead of stdout")
+	cmd.Flags().StringSlice("signing-alg", nil, "algorithm that tokens can be signed with, can be given multiple times (default RS256)")
+	return cmd
+}
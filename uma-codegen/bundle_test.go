@@ -0,0 +1,62 @@
+package main_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pckhoi/uma"
+	main "github.com/pckhoi/uma/uma-codegen"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBundleCmd(t *testing.T) {
+	srv := newFakeAS(t, func(w http.ResponseWriter, r *http.Request) bool {
+		switch {
+		case r.URL.Path == "/certs":
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"keys": []map[string]string{{
+					"kty": "EC",
+					"kid": "key-1",
+					"crv": "P-256",
+					"x":   "f83OJ3D2xF1Bg8vub9tLe1gHMzV76e8Tus9uPHvRVEU",
+					"y":   "x_FEzRu9m36HLN_tue659LNpXW6pCyStikYjKIWI5a0",
+				}},
+			})
+			return true
+		case r.URL.Path == "/resource_set" && r.URL.RawQuery == "":
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode([]string{"rsc-1"})
+			return true
+		}
+		return false
+	})
+
+	output := filepath.Join(t.TempDir(), "bundle.json")
+	cmd := main.RootCmd()
+	out := &bytes.Buffer{}
+	cmd.SetOut(out)
+	cmd.SetErr(out)
+	cmd.SetArgs([]string{
+		"bundle", "--issuer", srv.URL, "--client-id", "api", "--client-secret", "secret",
+		"--output", output, "--signing-alg", "ES256",
+	})
+	require.NoError(t, cmd.Execute())
+	assert.Equal(t, "exported 1 keys and 1 resources to "+output+"\n", out.String())
+
+	f, err := os.Open(output)
+	require.NoError(t, err)
+	defer f.Close()
+	bundle, err := uma.LoadVerificationBundle(f)
+	require.NoError(t, err)
+	assert.Equal(t, srv.URL, bundle.Issuer)
+	assert.Equal(t, srv.URL+"/permission", bundle.Discovery.PermissionEndpoint)
+	assert.Equal(t, []string{"ES256"}, bundle.SigningAlgorithms)
+	assert.Equal(t, "key-1", bundle.JWKS.Keys[0].KeyID)
+	assert.Equal(t, []uma.ExpandedResource{{ID: "rsc-1", Name: "User 1"}}, bundle.Resources)
+}
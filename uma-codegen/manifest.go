@@ -0,0 +1,393 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/pckhoi/uma"
+	"github.com/spf13/cobra"
+)
+
+type manifestScope struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName,omitempty"`
+	Description string `json:"description,omitempty"`
+	IconURI     string `json:"iconUri,omitempty"`
+}
+
+type manifestResource struct {
+	Name               string   `json:"name"`
+	DisplayName        string   `json:"displayName,omitempty"`
+	Type               string   `json:"type"`
+	IconURI            string   `json:"iconUri,omitempty"`
+	URIs               []string `json:"uris,omitempty"`
+	Scopes             []string `json:"scopes,omitempty"`
+	OwnerManagedAccess bool     `json:"ownerManagedAccess,omitempty"`
+}
+
+type manifestPermission struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+
+	// Type is "resource" for permissions of a resource type, or "scope" for permissions of a scope
+	Type         string   `json:"type"`
+	ResourceType string   `json:"resourceType,omitempty"`
+	Scopes       []string `json:"scopes,omitempty"`
+}
+
+// manifest describes the authorization settings of a Keycloak client, derived from an OpenAPI spec
+type manifest struct {
+	Scopes      []manifestScope      `json:"scopes"`
+	Resources   []manifestResource   `json:"resources"`
+	Permissions []manifestPermission `json:"permissions"`
+}
+
+// isStatic reports whether tmpl has no path parameter, i.e. it always renders to the same string
+func isStatic(tmpl string) bool {
+	return !strings.Contains(tmpl, "{")
+}
+
+// manifestOptions are the flags of the manifest command that change resources
+type manifestOptions struct {
+	baseURL string
+
+	// nameTemplate and namespace name resources like uma.TemplateNameStrategy and
+	// ManagerOptions.Namespace do at runtime
+	nameTemplate string
+	namespace    string
+}
+
+// usesURI reports whether tmpl refers to the resource URI
+func usesURI(tmpl string) bool {
+	return strings.Contains(tmpl, "{uri}") || strings.Contains(tmpl, "{uri_hash}")
+}
+
+// newManifest collects scopes of all resource types, resources of paths whose name has no path parameter,
+// and a permission for each resource type and each scope. Resources with path parameters are registered by the
+// middleware at runtime and are covered by the permissions of their type.
+func newManifest(data middlewareTemplateData, opts manifestOptions) (manifest, error) {
+	m := manifest{
+		Scopes:      []manifestScope{},
+		Resources:   []manifestResource{},
+		Permissions: []manifestPermission{},
+	}
+	scopes := map[string]manifestScope{}
+	for _, c := range data.ResourceConstants {
+		m.Permissions = append(m.Permissions, manifestPermission{
+			Name:         "resource type " + c.Type,
+			Description:  data.ResourceTypes[c.Type].Description,
+			Type:         "resource",
+			ResourceType: c.Type,
+		})
+		for _, s := range c.Scopes {
+			// a scope shared by several resource types takes the first description found
+			if sc, ok := scopes[s.Value]; ok && sc != (manifestScope{Name: s.Value}) {
+				continue
+			}
+			desc := data.ResourceTypes[c.Type].ScopeDescriptions[s.Value]
+			scopes[s.Value] = manifestScope{
+				Name:        s.Value,
+				DisplayName: desc.DisplayName,
+				Description: desc.Description,
+				IconURI:     desc.IconUri,
+			}
+		}
+	}
+	names := make([]string, 0, len(scopes))
+	for s := range scopes {
+		names = append(names, s)
+	}
+	sort.Strings(names)
+	for _, s := range names {
+		m.Scopes = append(m.Scopes, scopes[s])
+		m.Permissions = append(m.Permissions, manifestPermission{
+			Name:   "scope " + s,
+			Type:   "scope",
+			Scopes: []string{s},
+		})
+	}
+
+	var strategy uma.NameStrategy
+	if opts.nameTemplate != "" {
+		strategy = uma.TemplateNameStrategy(opts.nameTemplate)
+	}
+	addResource := func(t *resourceTemplate, path string) error {
+		if t == nil || !isStatic(t.Name) {
+			return nil
+		}
+		var uri string
+		if opts.baseURL != "" && isStatic(path) {
+			// like the middleware, which trims the trailing slash of resource URIs
+			uri = strings.TrimSuffix(strings.TrimSuffix(opts.baseURL, "/")+path, "/")
+		}
+		name := t.Name
+		if strategy != nil {
+			if uri == "" && usesURI(opts.nameTemplate) {
+				return fmt.Errorf("name template %q needs the URI of resource %q, set --base-url", opts.nameTemplate, t.Name)
+			}
+			name = strategy.ResourceName(uma.Resource{
+				ResourceType: uma.ResourceType{Type: t.Type},
+				Name:         name,
+				URI:          uri,
+			}, nil)
+		}
+		name = uma.NamespacedName(opts.namespace, name)
+		for _, r := range m.Resources {
+			if r.Name == name {
+				return nil
+			}
+		}
+		r := manifestResource{
+			Name:               name,
+			Type:               t.Type,
+			Scopes:             data.ResourceTypes[t.Type].ResourceScopes,
+			OwnerManagedAccess: t.OwnerManagedAccess,
+		}
+		if isStatic(t.DisplayName) {
+			r.DisplayName = t.DisplayName
+		}
+		r.IconURI = data.ResourceTypes[t.Type].IconUri
+		if t.IconURI != "" && isStatic(t.IconURI) {
+			r.IconURI = t.IconURI
+		}
+		if uri != "" {
+			r.URIs = []string{uri}
+		}
+		m.Resources = append(m.Resources, r)
+		return nil
+	}
+	for _, p := range data.Paths {
+		t := p.Resource
+		if t == nil {
+			t = data.DefaultResource
+		}
+		if err := addResource(t, p.Path); err != nil {
+			return manifest{}, err
+		}
+	}
+	return m, nil
+}
+
+// tfName turns s into a Terraform identifier e.g. "https://www.example.com/rsrcs/user" into
+// "https_www_example_com_rsrcs_user"
+func tfName(s string) string {
+	sb := &strings.Builder{}
+	underscore := false
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if underscore && sb.Len() > 0 {
+				sb.WriteByte('_')
+			}
+			underscore = false
+			sb.WriteRune(r)
+			continue
+		}
+		underscore = true
+	}
+	name := sb.String()
+	if name == "" || !unicode.IsLetter([]rune(name)[0]) {
+		name = "_" + name
+	}
+	return name
+}
+
+// renderTerraform writes m in Terraform JSON syntax, using resources of the Keycloak Terraform provider.
+// The realm, the resource server and the policies of each permission are given as variables.
+func renderTerraform(w io.Writer, m manifest) error {
+	common := func(attrs map[string]interface{}) map[string]interface{} {
+		attrs["realm_id"] = "${var.realm_id}"
+		attrs["resource_server_id"] = "${var.resource_server_id}"
+		return attrs
+	}
+	scopeRef := func(name string) string {
+		return fmt.Sprintf("${keycloak_openid_client_authorization_scope.%s.name}", tfName(name))
+	}
+	scopeIDRef := func(name string) string {
+		return fmt.Sprintf("${keycloak_openid_client_authorization_scope.%s.id}", tfName(name))
+	}
+
+	scopes := map[string]interface{}{}
+	for _, s := range m.Scopes {
+		attrs := common(map[string]interface{}{"name": s.Name})
+		if s.DisplayName != "" {
+			attrs["display_name"] = s.DisplayName
+		}
+		if s.IconURI != "" {
+			attrs["icon_uri"] = s.IconURI
+		}
+		scopes[tfName(s.Name)] = attrs
+	}
+	resources := map[string]interface{}{}
+	for _, r := range m.Resources {
+		attrs := common(map[string]interface{}{
+			"name": r.Name,
+			"type": r.Type,
+		})
+		if r.DisplayName != "" {
+			attrs["display_name"] = r.DisplayName
+		}
+		if r.IconURI != "" {
+			attrs["icon_uri"] = r.IconURI
+		}
+		if len(r.URIs) > 0 {
+			attrs["uris"] = r.URIs
+		}
+		if r.OwnerManagedAccess {
+			attrs["owner_managed_access"] = true
+		}
+		if len(r.Scopes) > 0 {
+			refs := make([]string, len(r.Scopes))
+			for i, s := range r.Scopes {
+				refs[i] = scopeRef(s)
+			}
+			attrs["scopes"] = refs
+		}
+		resources[tfName(r.Name)] = attrs
+	}
+	permissions := map[string]interface{}{}
+	for _, p := range m.Permissions {
+		attrs := common(map[string]interface{}{
+			"name": p.Name,
+			"type": p.Type,
+		})
+		if p.Description != "" {
+			attrs["description"] = p.Description
+		}
+		if p.ResourceType != "" {
+			attrs["resource_type"] = p.ResourceType
+			attrs["policies"] = fmt.Sprintf("${lookup(var.resource_type_policies, %q, [])}", p.ResourceType)
+		}
+		if len(p.Scopes) > 0 {
+			refs := make([]string, len(p.Scopes))
+			for i, s := range p.Scopes {
+				refs[i] = scopeIDRef(s)
+			}
+			attrs["scopes"] = refs
+			attrs["policies"] = fmt.Sprintf("${lookup(var.scope_policies, %q, [])}", p.Scopes[0])
+		}
+		permissions[tfName(p.Name)] = attrs
+	}
+
+	resource := map[string]interface{}{
+		"keycloak_openid_client_authorization_scope": scopes,
+	}
+	if len(resources) > 0 {
+		resource["keycloak_openid_client_authorization_resource"] = resources
+	}
+	if len(permissions) > 0 {
+		resource["keycloak_openid_client_authorization_permission"] = permissions
+	}
+	b, err := json.MarshalIndent(map[string]interface{}{
+		"variable": map[string]interface{}{
+			"realm_id": map[string]interface{}{
+				"type":        "string",
+				"description": "id of the realm",
+			},
+			"resource_server_id": map[string]interface{}{
+				"type":        "string",
+				"description": "resource server id of the client that protects the API",
+			},
+			"resource_type_policies": map[string]interface{}{
+				"type":        "map(list(string))",
+				"description": "policy ids of the permission of each resource type",
+				"default":     map[string]interface{}{},
+			},
+			"scope_policies": map[string]interface{}{
+				"type":        "map(list(string))",
+				"description": "policy ids of the permission of each scope",
+				"default":     map[string]interface{}{},
+			},
+		},
+		"resource": resource,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+func ManifestCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "manifest OPENAPI_DOC [--format terraform|json] [-o OUTPUT] [--base-url URL]",
+		Short: "Generate Keycloak authorization settings from an OpenAPI spec",
+		Long: `Generate the authorization scopes, resources and permissions of the resource server, so that
+teams managing Keycloak as code derive them from the OpenAPI spec instead of duplicating them.
+
+Every scope of every resource type gets a scope and a scope-based permission. Every resource type gets
+a resource-based permission that applies to all resources of the type. Resources whose name has no
+path parameter e.g. "Users" are included, others are registered by the middleware at runtime. With
+--base-url, the URL of the API, resources get the same URIs as those registered by the middleware.
+If the middleware names resources with ManagerOptions.NameStrategy or Namespace, give the equivalent
+--name-template e.g. "users-service: {name}" (see uma.TemplateNameStrategy) and --namespace so that
+resource names match. Strategies that can't be written as a template are not supported.
+
+With --format terraform (the default), the output is a *.tf.json file for the Keycloak Terraform
+provider. The realm and resource server ids are variables, as are the policy ids of permissions,
+keyed by resource type and scope. With --format json, the output is a plain JSON manifest, e.g. for
+Pulumi programs.`,
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			format, err := cmd.Flags().GetString("format")
+			if err != nil {
+				return err
+			}
+			output, err := cmd.Flags().GetString("output")
+			if err != nil {
+				return err
+			}
+			opts := manifestOptions{}
+			if opts.baseURL, err = cmd.Flags().GetString("base-url"); err != nil {
+				return err
+			}
+			if opts.nameTemplate, err = cmd.Flags().GetString("name-template"); err != nil {
+				return err
+			}
+			if opts.namespace, err = cmd.Flags().GetString("namespace"); err != nil {
+				return err
+			}
+			var render func(w io.Writer, m manifest) error
+			switch format {
+			case "terraform":
+				render = renderTerraform
+			case "json":
+				render = func(w io.Writer, m manifest) error {
+					b, err := json.MarshalIndent(m, "", "  ")
+					if err != nil {
+						return err
+					}
+					_, err = w.Write(append(b, '\n'))
+					return err
+				}
+			default:
+				return fmt.Errorf("unknown format %q, expected terraform or json", format)
+			}
+			data, err := newMiddlewareTemplateData(args[0], "")
+			if err != nil {
+				return err
+			}
+			m, err := newManifest(data, opts)
+			if err != nil {
+				return err
+			}
+			if output == "" {
+				return render(cmd.OutOrStdout(), m)
+			}
+			_, err = writeIfChanged(output, func(w io.Writer) error {
+				return render(w, m)
+			})
+			return err
+		},
+	}
+	cmd.Flags().String("format", "terraform", "output format, terraform or json")
+	cmd.Flags().StringP("output", "o", "", "write the manifest to this file instead of stdout")
+	cmd.Flags().String("base-url", "", "URL of the API, used to derive resource URIs")
+	cmd.Flags().String("name-template", "", "template of resource names, the same as given to uma.TemplateNameStrategy")
+	cmd.Flags().String("namespace", "", "namespace of resource names, the same as ManagerOptions.Namespace")
+	return cmd
+}
@@ -0,0 +1,109 @@
+package main_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/pckhoi/uma"
+	main "github.com/pckhoi/uma/uma-codegen"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestManifestCmd(t *testing.T) {
+	run := func(args ...string) (map[string]interface{}, error) {
+		cmd := main.RootCmd()
+		out := &bytes.Buffer{}
+		cmd.SetOut(out)
+		cmd.SetErr(&bytes.Buffer{})
+		cmd.SetArgs(append([]string{"manifest", "testdata/openapi.yml"}, args...))
+		if err := cmd.Execute(); err != nil {
+			return nil, err
+		}
+		obj := map[string]interface{}{}
+		require.NoError(t, json.Unmarshal(out.Bytes(), &obj))
+		return obj, nil
+	}
+
+	m, err := run("--format", "json", "--base-url", "https://api.example.com/users/")
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"name": "read"},
+		map[string]interface{}{"name": "write"},
+	}, m["scopes"])
+	// "User {id}" is registered at runtime
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{
+			"name":    "Users",
+			"type":    "https://www.example.com/rsrcs/users",
+			"iconUri": "https://www.example.com/rsrcs/users/icon.png",
+			"uris":    []interface{}{"https://api.example.com/users"},
+			"scopes":  []interface{}{"read", "write"},
+		},
+	}, m["resources"])
+	assert.Len(t, m["permissions"], 4)
+	assert.Contains(t, m["permissions"], map[string]interface{}{
+		"name":         "resource type https://www.example.com/rsrcs/user",
+		"description":  "a user",
+		"type":         "resource",
+		"resourceType": "https://www.example.com/rsrcs/user",
+	})
+
+	tf, err := run()
+	require.NoError(t, err)
+	resources := tf["resource"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{
+		"realm_id":           "${var.realm_id}",
+		"resource_server_id": "${var.resource_server_id}",
+		"name":               "scope write",
+		"type":               "scope",
+		"scopes":             []interface{}{"${keycloak_openid_client_authorization_scope.write.id}"},
+		"policies":           `${lookup(var.scope_policies, "write", [])}`,
+	}, resources["keycloak_openid_client_authorization_permission"].(map[string]interface{})["scope_write"])
+	users := resources["keycloak_openid_client_authorization_resource"].(map[string]interface{})["users"].(map[string]interface{})
+	assert.Equal(t, []interface{}{
+		"${keycloak_openid_client_authorization_scope.read.name}",
+		"${keycloak_openid_client_authorization_scope.write.name}",
+	}, users["scopes"])
+	assert.NotContains(t, users, "uris")
+	assert.Contains(t, tf["variable"], "scope_policies")
+
+	_, err = run("--format", "yaml")
+	assert.EqualError(t, err, `unknown format "yaml", expected terraform or json`)
+}
+
+func TestManifestCmdNameTemplate(t *testing.T) {
+	run := func(args ...string) (map[string]interface{}, error) {
+		cmd := main.RootCmd()
+		out := &bytes.Buffer{}
+		cmd.SetOut(out)
+		cmd.SetErr(&bytes.Buffer{})
+		cmd.SetArgs(append([]string{"manifest", "testdata/openapi.yml", "--format", "json"}, args...))
+		if err := cmd.Execute(); err != nil {
+			return nil, err
+		}
+		obj := map[string]interface{}{}
+		require.NoError(t, json.Unmarshal(out.Bytes(), &obj))
+		return obj, nil
+	}
+	name := func(m map[string]interface{}) string {
+		return m["resources"].([]interface{})[0].(map[string]interface{})["name"].(string)
+	}
+
+	// names match those the middleware registers with the same strategy and namespace
+	m, err := run("--name-template", "users-service: {name}", "--namespace", "billing")
+	require.NoError(t, err)
+	assert.Equal(t, uma.NamespacedName("billing", "users-service: Users"), name(m))
+
+	baseURL := "https://api.example.com/users/"
+	m, err = run("--name-template", "{name} {uri_hash}", "--base-url", baseURL)
+	require.NoError(t, err)
+	assert.Equal(t, uma.URIHashNameStrategy().ResourceName(uma.Resource{
+		Name: "Users",
+		URI:  "https://api.example.com/users",
+	}, nil), name(m))
+
+	_, err = run("--name-template", "{name} {uri_hash}")
+	assert.EqualError(t, err, `name template "{name} {uri_hash}" needs the URI of resource "Users", set --base-url`)
+}
@@ -1,8 +1,9 @@
 package main
 
 import (
+	"errors"
+	"fmt"
 	"io"
-	"os"
 	"reflect"
 	"sort"
 	"strings"
@@ -13,7 +14,7 @@ import (
 
 func RootCmd() *cobra.Command {
 	cmd := &cobra.Command{
-		Use:   "uma-codegen OPENAPI_DOC PACKAGE [-o OUTPUT]",
+		Use:   "uma-codegen OPENAPI_DOC PACKAGE [-o OUTPUT] [--json FILE] [--templates DIR] [--set KEY=VALUE]...",
 		Short: "Generate code based on UMA extension in OpenAPI spec",
 		Args:  cobra.ExactArgs(2),
 		RunE: func(cmd *cobra.Command, args []string) error {
@@ -22,90 +23,154 @@ func RootCmd() *cobra.Command {
 			if err != nil {
 				return err
 			}
-			doc, err := types.OpenOpenAPISpec(oapiPath)
+			jsonOutput, err := cmd.Flags().GetString("json")
 			if err != nil {
 				return err
 			}
-
-			var securitySchemes []string
-			if doc.Components != nil {
-				for name, ss := range doc.Components.SecuritySchemes {
-					if ss.UMAEnabled {
-						securitySchemes = append(securitySchemes, name)
-					}
-				}
+			tmplDir, err := cmd.Flags().GetString("templates")
+			if err != nil {
+				return err
 			}
-
-			var rsc *resourceTemplate
-			if doc.UMAResouce != nil {
-				rsc = &resourceTemplate{
-					Name: doc.UMAResouce.NameTemplate,
-					Type: doc.UMAResouce.Type,
-				}
+			values, err := cmd.Flags().GetStringToString("set")
+			if err != nil {
+				return err
+			}
+			watch, err := cmd.Flags().GetBool("watch")
+			if err != nil {
+				return err
+			}
+			interval, err := cmd.Flags().GetDuration("watch-interval")
+			if err != nil {
+				return err
+			}
+			if watch && output == "" {
+				return errors.New("--watch requires --output")
 			}
 
-			paths := []path{}
-			for name, p := range doc.Paths {
-				obj := path{
-					Path:       name,
-					Operations: map[string]operation{},
+			generate := func() error {
+				t, err := loadTemplates(tmplDir)
+				if err != nil {
+					return err
 				}
-				if p.UMAResouce != nil {
-					obj.ResourceName = p.UMAResouce.NameTemplate
-					obj.ResourceType = p.UMAResouce.Type
+				data, err := newMiddlewareTemplateData(oapiPath, pkg)
+				if err != nil {
+					return err
 				}
-				v := reflect.ValueOf(p)
-				vt := v.Type()
-				n := vt.NumField()
-				for i := 0; i < n; i++ {
-					sf := vt.FieldByIndex([]int{i})
-					if sf.Type.Kind() == reflect.Pointer && strings.HasSuffix(sf.Type.Elem().Name(), "Operation") {
-						f := v.FieldByIndex([]int{i})
-						if f.IsZero() {
-							continue
-						}
-						op := &operation{}
-						sec := f.Elem().FieldByName("Security")
-						if !sec.IsZero() {
-							op.Security = make([]map[string][]string, sec.Len())
-							reflect.Copy(reflect.ValueOf(op.Security), sec)
-						}
-						obj.Operations[strings.ToUpper(sf.Name)] = *op
+				data.Values = values
+				if jsonOutput != "" {
+					if _, err := writeIfChanged(jsonOutput, func(w io.Writer) error {
+						return renderJSONArtifact(w, data)
+					}); err != nil {
+						return err
 					}
 				}
-				paths = append(paths, obj)
-			}
-			sort.Slice(paths, func(i, j int) bool {
-				ni, nj := len(paths[i].Path), len(paths[j].Path)
-				if ni > nj {
-					return false
-				} else if ni < nj {
-					return true
+				if output == "" {
+					return renderMiddlewareCode(cmd.OutOrStdout(), t, data)
 				}
-				return paths[i].Path < paths[j].Path
-			})
-
-			var w io.Writer
-			if output == "" {
-				w = cmd.OutOrStdout()
-			} else {
-				f, err := os.Create(output)
-				if err != nil {
-					return err
+				changed, err := writeIfChanged(output, func(w io.Writer) error {
+					return renderMiddlewareCode(w, t, data)
+				})
+				if err == nil && changed && watch {
+					fmt.Fprintf(cmd.OutOrStdout(), "%s -> %s\n", oapiPath, output)
 				}
-				defer f.Close()
-				w = f
+				return err
+			}
+			if err := generate(); err != nil {
+				return err
+			}
+			if watch {
+				watchFiles(cmd.Context(), watchedPaths(tmplDir, oapiPath), interval, cmd.ErrOrStderr(), generate)
 			}
-			return renderMiddlewareCode(w, middlewareTemplateData{
-				Package:                pkg,
-				EnabledSecuritySchemes: securitySchemes,
-				ResourceTypes:          doc.UMAResourceTypes,
-				DefaultResource:        rsc,
-				DefaultSecurity:        doc.Security,
-				Paths:                  paths,
-			})
+			return nil
 		},
 	}
 	cmd.Flags().StringP("output", "o", "", "output generated code to this file")
+	cmd.Flags().String("json", "", "also write resource types and path templates as JSON to this file, see uma.LoadTemplatesJSON")
+	cmd.Flags().String("templates", "", "directory of *.tmpl files that override built-in templates")
+	cmd.Flags().StringToString("set", nil, "key=value pairs available to templates as .Values")
+	addWatchFlags(cmd)
+	cmd.AddCommand(BatchCmd(), WhoamiCmd(), TicketCmd(), RPTCmd(), BundleCmd(), ManifestCmd(), StoreCmd())
 	return cmd
 }
+
+// newMiddlewareTemplateData reads the OpenAPI spec at oapiPath
+func newMiddlewareTemplateData(oapiPath, pkg string) (middlewareTemplateData, error) {
+	doc, err := types.OpenOpenAPISpec(oapiPath)
+	if err != nil {
+		return middlewareTemplateData{}, err
+	}
+
+	var securitySchemes []string
+	if doc.Components != nil {
+		for name, ss := range doc.Components.SecuritySchemes {
+			if ss.UMAEnabled {
+				securitySchemes = append(securitySchemes, name)
+			}
+		}
+	}
+
+	rsc, err := newResourceTemplate(doc.UMAResouce)
+	if err != nil {
+		return middlewareTemplateData{}, err
+	}
+	consts, err := newResourceConstants(doc.UMAResourceTypes)
+	if err != nil {
+		return middlewareTemplateData{}, err
+	}
+
+	paths := []path{}
+	for name, p := range doc.Paths {
+		pathRsc, err := newResourceTemplate(p.UMAResouce)
+		if err != nil {
+			return middlewareTemplateData{}, fmt.Errorf("path %q: %w", name, err)
+		}
+		obj := path{
+			Path:       name,
+			Resource:   pathRsc,
+			Operations: map[string]operation{},
+		}
+		v := reflect.ValueOf(p)
+		vt := v.Type()
+		n := vt.NumField()
+		for i := 0; i < n; i++ {
+			sf := vt.FieldByIndex([]int{i})
+			if sf.Type.Kind() == reflect.Pointer && strings.HasSuffix(sf.Type.Elem().Name(), "Operation") {
+				f := v.FieldByIndex([]int{i})
+				if f.IsZero() {
+					continue
+				}
+				op := &operation{}
+				sec := f.Elem().FieldByName("Security")
+				if !sec.IsZero() {
+					op.Security = make([]map[string][]string, sec.Len())
+					reflect.Copy(reflect.ValueOf(op.Security), sec)
+				}
+				if inc := f.Elem().FieldByName("UMAIncludeScopes"); !inc.IsNil() {
+					v := inc.Elem().Bool()
+					op.IncludeScopes = &v
+				}
+				obj.Operations[strings.ToUpper(sf.Name)] = *op
+			}
+		}
+		paths = append(paths, obj)
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		ni, nj := len(paths[i].Path), len(paths[j].Path)
+		if ni > nj {
+			return false
+		} else if ni < nj {
+			return true
+		}
+		return paths[i].Path < paths[j].Path
+	})
+
+	return middlewareTemplateData{
+		Package:                pkg,
+		EnabledSecuritySchemes: securitySchemes,
+		ResourceTypes:          doc.UMAResourceTypes,
+		DefaultResource:        rsc,
+		DefaultSecurity:        doc.Security,
+		Paths:                  paths,
+		ResourceConstants:      consts,
+	}, nil
+}
@@ -2,17 +2,26 @@ package main_test
 
 import (
 	"bufio"
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"net"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"sync"
 	"syscall"
 	"testing"
 	"time"
 
+	"github.com/go-logr/logr"
+	"github.com/pckhoi/uma"
 	"github.com/pckhoi/uma/testutil"
 	main "github.com/pckhoi/uma/uma-codegen"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
@@ -105,3 +114,205 @@ func TestRootCmd(t *testing.T) {
 
 	testutil.AssertResponseStatus(t, http.MethodGet, baseURL+"/no-security", "", http.StatusOK)
 }
+
+func TestRootCmdCustomTemplates(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "extra.tmpl"), []byte(`{{define "extra"}}
+// {{.Values.prefix}}Manager wraps UMAManager with company defaults
+func {{.Values.prefix}}Manager(logger logr.Logger) *uma.Manager {
+    return UMAManager(uma.ManagerOptions{}, logger)
+}
+{{end}}`), 0644))
+
+	cmd := main.RootCmd()
+	out := &bytes.Buffer{}
+	cmd.SetOut(out)
+	cmd.SetArgs([]string{"testdata/openapi.yml", "main", "--templates", dir, "--set", "prefix=Acme"})
+	require.NoError(t, cmd.Execute())
+	assert.Contains(t, out.String(), "func AcmeManager(logger logr.Logger) *uma.Manager {")
+	assert.Contains(t, out.String(), "var UMAMatcher = uma.NewMatcher(")
+
+	cmd = main.RootCmd()
+	cmd.SetOut(out)
+	cmd.SetErr(out)
+	cmd.SetArgs([]string{"testdata/openapi.yml", "main", "--templates", t.TempDir()})
+	assert.ErrorContains(t, cmd.Execute(), "no *.tmpl file found")
+}
+
+func TestRootCmdResourceConstants(t *testing.T) {
+	cmd := main.RootCmd()
+	out := &bytes.Buffer{}
+	cmd.SetOut(out)
+	cmd.SetArgs([]string{"testdata/openapi.yml", "main"})
+	require.NoError(t, cmd.Execute())
+	assert.Contains(t, out.String(), `ResourceUser  ResourceType = "https://www.example.com/rsrcs/user"`)
+	assert.Contains(t, out.String(), `ScopeUsersWrite Scope = "write"`)
+	assert.Contains(t, out.String(), "return []Scope{ScopeUserRead, ScopeUserWrite}")
+
+	spec := filepath.Join(t.TempDir(), "openapi.yml")
+	require.NoError(t, os.WriteFile(spec, []byte(`openapi: "3.0.2"
+info:
+  title: Test API
+  version: "1.0"
+x-uma-resource-types:
+  https://a.example.com/user:
+    resourceScopes: [read]
+  https://b.example.com/user:
+    resourceScopes: [read]
+paths: {}
+`), 0644))
+	cmd = main.RootCmd()
+	cmd.SetOut(out)
+	cmd.SetErr(out)
+	cmd.SetArgs([]string{spec, "main"})
+	assert.EqualError(t, cmd.Execute(), `"https://a.example.com/user" and "https://b.example.com/user" both map to constant ResourceUser`)
+}
+
+func TestRootCmdIncludeScopes(t *testing.T) {
+	spec := filepath.Join(t.TempDir(), "openapi.yml")
+	require.NoError(t, os.WriteFile(spec, []byte(`openapi: "3.0.2"
+info:
+  title: Test API
+  version: "1.0"
+x-uma-resource-types:
+  https://www.example.com/rsrcs/user:
+    resourceScopes: [read, write]
+security:
+  - oidc: [read]
+paths:
+  /{id}:
+    x-uma-resource:
+      type: https://www.example.com/rsrcs/user
+      name: User {id}
+      includeScopes: false
+    get:
+      summary: get a user
+    put:
+      summary: update a user
+      x-uma-include-scopes: true
+components:
+  securitySchemes:
+    oidc:
+      type: openIdConnect
+      x-uma-enabled: true
+`), 0644))
+	cmd := main.RootCmd()
+	out := &bytes.Buffer{}
+	cmd.SetOut(out)
+	cmd.SetArgs([]string{spec, "main"})
+	require.NoError(t, cmd.Execute())
+	assert.Contains(t, out.String(), `uma.NewResourceTemplate("https://www.example.com/rsrcs/user", "User {id}", uma.WithTemplateIncludeScopes(false))`)
+	assert.Contains(t, out.String(), "IncludeScopes: uma.Bool(true),")
+	assert.Equal(t, 1, bytes.Count(out.Bytes(), []byte("IncludeScopes: uma.Bool(")))
+}
+
+func TestRootCmdScopeDescriptions(t *testing.T) {
+	spec := filepath.Join(t.TempDir(), "openapi.yml")
+	require.NoError(t, os.WriteFile(spec, []byte(`openapi: "3.0.2"
+info:
+  title: Test API
+  version: "1.0"
+x-uma-resource-types:
+  https://www.example.com/rsrcs/user:
+    resourceScopes:
+      - read
+      - name: write
+        displayName: Write
+        iconUri: https://www.example.com/scopes/write.png
+x-uma-resource:
+  type: https://www.example.com/rsrcs/user
+  name: Users
+paths: {}
+`), 0644))
+	cmd := main.RootCmd()
+	out := &bytes.Buffer{}
+	cmd.SetOut(out)
+	cmd.SetArgs([]string{spec, "main"})
+	require.NoError(t, cmd.Execute())
+	assert.Contains(t, out.String(), `ResourceScopes: []string{"read", "write"},`)
+	assert.Contains(t, out.String(), `"write": {Name: "write", DisplayName: "Write", Description: "", IconUri: "https://www.example.com/scopes/write.png"},`)
+
+	cmd = main.RootCmd()
+	out = &bytes.Buffer{}
+	cmd.SetOut(out)
+	cmd.SetArgs([]string{"manifest", spec, "--format", "json"})
+	require.NoError(t, cmd.Execute())
+	m := map[string]interface{}{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &m))
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"name": "read"},
+		map[string]interface{}{"name": "write", "displayName": "Write", "iconUri": "https://www.example.com/scopes/write.png"},
+	}, m["scopes"])
+}
+
+func TestRootCmdJSON(t *testing.T) {
+	dir := t.TempDir()
+	cmd := main.RootCmd()
+	cmd.SetOut(&bytes.Buffer{})
+	cmd.SetArgs([]string{"testdata/openapi.yml", "main", "--json", filepath.Join(dir, "uma.json")})
+	require.NoError(t, cmd.Execute())
+
+	matcher, err := uma.LoadTemplatesJSON(os.DirFS(dir), "uma.json")
+	require.NoError(t, err)
+	var rsc uma.Resource
+	var scopes []string
+	man := uma.NewFromMatcher(uma.ManagerOptions{
+		GetBaseURL: func(r *http.Request) url.URL {
+			return url.URL{Scheme: "https", Host: "api.example.com", Path: "/users"}
+		},
+		CustomEnforce: func(r *http.Request, resource uma.Resource, s []string) bool {
+			rsc, scopes = resource, s
+			return true
+		},
+	}, matcher, logr.Discard())
+	r := httptest.NewRequest(http.MethodPut, "https://api.example.com/users/1", nil)
+	r.Header.Set("Accept-Language", "fr")
+	man.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(httptest.NewRecorder(), r)
+	assert.Equal(t, "User 1", rsc.Name)
+	assert.Equal(t, "Utilisateur 1", rsc.DisplayName)
+	assert.Equal(t, "https://www.example.com/rsrcs/user", rsc.Type)
+	assert.Equal(t, []string{"write"}, scopes)
+}
+
+func TestRootCmdTemplateFuncs(t *testing.T) {
+	spec := filepath.Join(t.TempDir(), "openapi.yml")
+	writeSpec := func(name string) {
+		require.NoError(t, os.WriteFile(spec, []byte(`openapi: "3.0.2"
+info:
+  title: Test API
+  version: "1.0"
+x-uma-resource-types:
+  https://www.example.com/rsrcs/user:
+    resourceScopes: [read]
+security:
+  - oidc: [read]
+paths:
+  /{id}:
+    x-uma-resource:
+      type: https://www.example.com/rsrcs/user
+      name: `+name+`
+    get:
+      summary: get a user
+components:
+  securitySchemes:
+    oidc:
+      type: openIdConnect
+      x-uma-enabled: true
+`), 0644))
+	}
+	out := &bytes.Buffer{}
+
+	writeSpec(`"User {id|pad:6}"`)
+	cmd := main.RootCmd()
+	cmd.SetOut(out)
+	cmd.SetArgs([]string{spec, "main"})
+	require.NoError(t, cmd.Execute())
+	assert.Contains(t, out.String(), `uma.NewResourceTemplate("https://www.example.com/rsrcs/user", "User {id|pad:6}")`)
+
+	writeSpec(`"User {id|hex}"`)
+	cmd = main.RootCmd()
+	cmd.SetOut(out)
+	cmd.SetErr(out)
+	cmd.SetArgs([]string{spec, "main"})
+	assert.EqualError(t, cmd.Execute(), `path "/{id}": invalid resource template "User {id|hex}": placeholder "{id|hex}" calls unknown function "hex"`)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/pckhoi/uma"
+	"github.com/pckhoi/uma/pkg/rp"
+	"github.com/spf13/cobra"
+)
+
+func RPTCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "rpt --issuer ISSUER --client-id ID --client-secret SECRET --ticket TICKET (--username USER --password PASS | --claim-token TOKEN)",
+		Short: "Exchange a permission ticket for an RPT",
+		Long: `Exchange a permission ticket for a requesting party token (RPT) and print the token followed by
+the permissions it grants. Client credentials are those of the requesting client, which is not
+necessarily the resource server. The requesting party is either authenticated with username and
+password, or identified by a claim token pushed along with client credentials. With --raw, only
+the token is printed, e.g. to use in curl:
+
+	curl -H "Authorization: Bearer $(uma-codegen rpt ... --raw)" https://api.example.com/users/1`,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			flags := cmd.Flags()
+			issuer, _ := flags.GetString("issuer")
+			clientID, _ := flags.GetString("client-id")
+			clientSecret, _ := flags.GetString("client-secret")
+			ticket, _ := flags.GetString("ticket")
+			username, _ := flags.GetString("username")
+			password, _ := flags.GetString("password")
+			claimToken, _ := flags.GetString("claim-token")
+			claimTokenFormat, _ := flags.GetString("claim-token-format")
+			raw, _ := flags.GetBool("raw")
+			if (username == "") == (claimToken == "") {
+				return errors.New("exactly one of --username and --claim-token is required")
+			}
+
+			kc, err := rp.NewKeycloakClient(strings.TrimSuffix(issuer, "/"), clientID, clientSecret, http.DefaultClient)
+			if err != nil {
+				return err
+			}
+			req := rp.RPTRequest{
+				Ticket:                      ticket,
+				ResponseIncludeResourceName: true,
+			}
+			var accessToken string
+			if username != "" {
+				creds, err := kc.AuthenticateUserWithPassword(username, password)
+				if err != nil {
+					return fmt.Errorf("error authenticating user: %w", err)
+				}
+				accessToken = creds.AccessToken
+			} else {
+				creds, err := kc.Authenticate()
+				if err != nil {
+					return fmt.Errorf("error authenticating client: %w", err)
+				}
+				accessToken = creds.AccessToken
+				req.ClaimToken = claimToken
+				req.ClaimTokenFormat = rp.ClaimTokenFormat(claimTokenFormat)
+			}
+			token, err := kc.RequestRPT(accessToken, req)
+			if err != nil {
+				return err
+			}
+
+			w := cmd.OutOrStdout()
+			fmt.Fprintln(w, token)
+			if raw {
+				return nil
+			}
+			b, err := decodeJWTPayload(token)
+			if err != nil {
+				return err
+			}
+			rpt, err := uma.ParseRPT(b)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(w)
+			return printJSON(w, "Permissions", rpt.Permissions())
+		},
+	}
+	addASFlags(cmd)
+	cmd.Flags().String("ticket", "", "permission ticket, as printed by the ticket command or found in WWW-Authenticate header")
+	cmd.Flags().String("username", "", "username of the requesting party")
+	cmd.Flags().String("password", "", "password of the requesting party")
+	cmd.Flags().String("claim-token", "", "token that identifies the requesting party")
+	cmd.Flags().String("claim-token-format", string(rp.AccessTokenFormat), "format of the claim token")
+	cmd.Flags().Bool("raw", false, "only print the token")
+	cmd.MarkFlagRequired("ticket")
+	return cmd
+}
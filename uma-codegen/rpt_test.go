@@ -0,0 +1,84 @@
+package main_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	main "github.com/pckhoi/uma/uma-codegen"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTicketAndRPTCmd(t *testing.T) {
+	var rptForms []map[string]string
+	rpt := fakeJWT(t, map[string]interface{}{
+		"sub": "user-1",
+		"authorization": map[string]interface{}{
+			"permissions": []map[string]interface{}{
+				{"rsid": "rsc-1", "rsname": "User 1", "scopes": []string{"read"}},
+			},
+		},
+	})
+	srv := newFakeAS(t, func(w http.ResponseWriter, r *http.Request) bool {
+		switch {
+		case r.URL.Path == "/permission":
+			var body []map[string]interface{}
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			assert.Equal(t, "rsc-1", body[0]["resource_id"])
+			assert.Equal(t, []interface{}{"read"}, body[0]["resource_scopes"])
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(map[string]string{"ticket": "ticket-1"})
+			return true
+		case r.URL.Path == "/token" && r.FormValue("grant_type") == "password":
+			assert.Equal(t, "johnd", r.FormValue("username"))
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]string{"access_token": "user-token"})
+			return true
+		case r.URL.Path == "/token" && r.FormValue("grant_type") == "urn:ietf:params:oauth:grant-type:uma-ticket":
+			rptForms = append(rptForms, map[string]string{
+				"authorization": r.Header.Get("Authorization"),
+				"ticket":        r.FormValue("ticket"),
+				"claim_token":   r.FormValue("claim_token"),
+			})
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]string{"access_token": rpt})
+			return true
+		}
+		return false
+	})
+
+	run := func(args ...string) (string, error) {
+		cmd := main.RootCmd()
+		out := &bytes.Buffer{}
+		cmd.SetOut(out)
+		cmd.SetErr(out)
+		cmd.SetArgs(append(args, "--issuer", srv.URL, "--client-id", "api", "--client-secret", "secret"))
+		err := cmd.Execute()
+		return out.String(), err
+	}
+
+	out, err := run("ticket", "--resource", "User 1", "--scope", "read")
+	require.NoError(t, err)
+	assert.Equal(t, "ticket-1\n", out)
+
+	out, err = run("rpt", "--ticket", "ticket-1", "--username", "johnd", "--password", "secret")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(out, rpt+"\n"))
+	assert.Contains(t, out, `"rsname": "User 1"`)
+
+	out, err = run("rpt", "--ticket", "ticket-1", "--claim-token", "claims", "--raw")
+	require.NoError(t, err)
+	assert.Equal(t, rpt+"\n", out)
+
+	require.Len(t, rptForms, 2)
+	assert.Equal(t, map[string]string{"authorization": "Bearer user-token", "ticket": "ticket-1", "claim_token": ""}, rptForms[0])
+	assert.Equal(t, "ticket-1", rptForms[1]["ticket"])
+	assert.Equal(t, "claims", rptForms[1]["claim_token"])
+
+	_, err = run("rpt", "--ticket", "ticket-1")
+	assert.EqualError(t, err, "exactly one of --username and --claim-token is required")
+}
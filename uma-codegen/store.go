@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/pckhoi/uma"
+	"github.com/pckhoi/uma/pkg/store/dynamostore"
+	"github.com/pckhoi/uma/pkg/store/etcdstore"
+	"github.com/pckhoi/uma/pkg/store/filestore"
+	"github.com/pckhoi/uma/pkg/store/redisstore"
+	"github.com/redis/go-redis/v9"
+	"github.com/spf13/cobra"
+)
+
+const storeURLHelp = `Stores are given as URLs:
+
+  file:///var/lib/uma/resources.json          pkg/store/filestore
+  redis://:password@host:6379/0?prefix=uma:   pkg/store/redisstore, rediss:// for TLS
+  etcd://host:2379/uma/                       pkg/store/etcdstore with the path as prefix, etcds:// for TLS
+  dynamodb://table?region=eu-west-1           pkg/store/dynamostore with credentials from the environment,
+                                              endpoint=URL for DynamoDB local`
+
+// openStore opens the ResourceStore described by rawURL
+func openStore(rawURL string) (uma.ResourceStore, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "file":
+		// file://relative/path has its first segment parsed as host
+		path := filepath.FromSlash(u.Host + u.Path)
+		if path == "" {
+			return nil, fmt.Errorf("store %q has no path", rawURL)
+		}
+		return filestore.New(path, nil), nil
+	case "redis", "rediss":
+		q := u.Query()
+		prefix := q.Get("prefix")
+		q.Del("prefix")
+		u.RawQuery = q.Encode()
+		opts, err := redis.ParseURL(u.String())
+		if err != nil {
+			return nil, err
+		}
+		return redisstore.New(redis.NewClient(opts), prefix, nil), nil
+	case "etcd", "etcds":
+		scheme := "http"
+		if u.Scheme == "etcds" {
+			scheme = "https"
+		}
+		return etcdstore.New(scheme+"://"+u.Host, u.Path, nil), nil
+	case "dynamodb":
+		q := u.Query()
+		if q.Get("region") == "" {
+			return nil, fmt.Errorf("store %q has no region parameter", rawURL)
+		}
+		return dynamostore.New(dynamostore.Options{
+			Table:       u.Host,
+			Region:      q.Get("region"),
+			Endpoint:    q.Get("endpoint"),
+			Credentials: dynamostore.CredentialsFromEnv(),
+		}), nil
+	}
+	return nil, fmt.Errorf("unsupported store %q", rawURL)
+}
+
+func StoreCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "store",
+		Short: "Manage resource stores",
+	}
+	cmd.AddCommand(storeMigrateCmd())
+	return cmd
+}
+
+func storeMigrateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "migrate --from URL --to URL [--verify --issuer ISSUER --client-id ID --client-secret SECRET] [--dry-run]",
+		Short: "Copy resource ids from one store to another",
+		Long: `Copy resource ids, and their hashes, from one store to another and read every written entry back.
+Entries that the destination already has are never overwritten, so resource servers can keep using
+the old store while entries are copied. To change stores without downtime, migrate, deploy resource
+servers with the new store, then migrate again to copy entries registered in between.
+
+With --verify, every id is looked up on the authorization server and entries of resources that no
+longer exist are skipped.
+
+` + storeURLHelp,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			fromURL, err := cmd.Flags().GetString("from")
+			if err != nil {
+				return err
+			}
+			toURL, err := cmd.Flags().GetString("to")
+			if err != nil {
+				return err
+			}
+			verify, err := cmd.Flags().GetBool("verify")
+			if err != nil {
+				return err
+			}
+			dryRun, err := cmd.Flags().GetBool("dry-run")
+			if err != nil {
+				return err
+			}
+			from, err := openStore(fromURL)
+			if err != nil {
+				return err
+			}
+			to, err := openStore(toURL)
+			if err != nil {
+				return err
+			}
+			opts := uma.StoreCopyOptions{DryRun: dryRun}
+			if verify {
+				if opts.Provider, err = providerFromFlags(cmd); err != nil {
+					return err
+				}
+			}
+			results, err := uma.CopyResourceStore(from, to, opts)
+			if err != nil {
+				return err
+			}
+			counts := map[uma.StoreCopyAction]int{}
+			for _, res := range results {
+				counts[res.Action]++
+				line := fmt.Sprintf("%-9s %s (%s)", res.Action, res.Name, res.ID)
+				if res.Err != nil {
+					line += ": " + res.Err.Error()
+				}
+				fmt.Fprintln(cmd.OutOrStdout(), line)
+			}
+			summary := []string{}
+			for _, action := range []uma.StoreCopyAction{
+				uma.StoreCopyCopied, uma.StoreCopyUnchanged, uma.StoreCopyMissing, uma.StoreCopyConflict, uma.StoreCopyFailed,
+			} {
+				summary = append(summary, fmt.Sprintf("%d %s", counts[action], action))
+			}
+			if dryRun {
+				summary = append(summary, "dry run")
+			}
+			fmt.Fprintln(cmd.ErrOrStderr(), strings.Join(summary, ", "))
+			if n := counts[uma.StoreCopyConflict] + counts[uma.StoreCopyFailed]; n > 0 {
+				return fmt.Errorf("entries not migrated: %d", n)
+			}
+			return nil
+		},
+	}
+	addOptionalASFlags(cmd)
+	cmd.Flags().String("from", "", "url of the store to copy from")
+	cmd.Flags().String("to", "", "url of the store to copy to")
+	cmd.Flags().Bool("verify", false, "skip entries of resources that don't exist on the authorization server")
+	cmd.Flags().Bool("dry-run", false, "report what would be copied without writing anything")
+	cmd.MarkFlagRequired("from")
+	cmd.MarkFlagRequired("to")
+	return cmd
+}
@@ -0,0 +1,58 @@
+package main_test
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/pckhoi/uma/pkg/store/filestore"
+	main "github.com/pckhoi/uma/uma-codegen"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStoreMigrateCmd(t *testing.T) {
+	srv := newFakeAS(t, nil)
+	dir := t.TempDir()
+	fromPath, toPath := filepath.Join(dir, "from.json"), filepath.Join(dir, "to.json")
+	from := filestore.New(fromPath, nil)
+	require.NoError(t, from.Set("User 1", "rsc-1"))
+	require.NoError(t, from.SetHash("User 1", "abc"))
+	require.NoError(t, from.Set("User 2", "rsc-2"))
+
+	run := func(args ...string) (string, error) {
+		cmd := main.RootCmd()
+		out := &bytes.Buffer{}
+		cmd.SetOut(out)
+		cmd.SetErr(out)
+		cmd.SetArgs(append([]string{"store", "migrate", "--from", "file://" + fromPath, "--to", "file://" + toPath}, args...))
+		err := cmd.Execute()
+		return out.String(), err
+	}
+
+	out, err := run("--dry-run")
+	require.NoError(t, err)
+	assert.Contains(t, out, "2 copied, 0 unchanged, 0 missing, 0 conflict, 0 failed, dry run")
+	ids, err := filestore.New(toPath, nil).List()
+	require.NoError(t, err)
+	assert.Empty(t, ids)
+
+	// rsc-2 doesn't exist on the authorization server
+	out, err = run("--verify", "--issuer", srv.URL, "--client-id", "api", "--client-secret", "secret")
+	require.NoError(t, err)
+	assert.Contains(t, out, "copied    User 1 (rsc-1)\nmissing   User 2 (rsc-2)\n")
+	to := filestore.New(toPath, nil)
+	ids, err = to.List()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"User 1": "rsc-1"}, ids)
+	hash, _ := to.GetHash("User 1")
+	assert.Equal(t, "abc", hash)
+
+	require.NoError(t, to.Set("User 2", "rsc-9"))
+	out, err = run()
+	assert.EqualError(t, err, "entries not migrated: 1")
+	assert.Contains(t, out, "unchanged User 1 (rsc-1)\nconflict  User 2 (rsc-2): destination has id \"rsc-9\"\n")
+
+	_, err = run("--to", "memcached://localhost")
+	assert.EqualError(t, err, `unsupported store "memcached://localhost"`)
+}
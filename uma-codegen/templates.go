@@ -3,11 +3,17 @@ package main
 import (
 	"bytes"
 	"embed"
+	"fmt"
 	"go/format"
 	"io"
+	"path/filepath"
 	"regexp"
+	"sort"
+	"strings"
 	"text/template"
+	"unicode"
 
+	"github.com/pckhoi/uma"
 	"github.com/pckhoi/uma/pkg/types"
 )
 
@@ -25,19 +31,138 @@ func init() {
 }
 
 type resourceTemplate struct {
-	Name string
-	Type string
+	Name               string
+	Type               string
+	DisplayName        string
+	Description        string
+	IconURI            string
+	OwnerManagedAccess bool
+	IncludeScopes      *bool
+
+	LocalizedDisplayNames map[string]string
+	LocalizedIconURIs     map[string]string
+}
+
+func newResourceTemplate(rsc *types.UMAResouce) (*resourceTemplate, error) {
+	if rsc == nil {
+		return nil, nil
+	}
+	t := &resourceTemplate{
+		Name:               rsc.NameTemplate,
+		Type:               rsc.Type,
+		DisplayName:        rsc.DisplayNameTemplate,
+		Description:        rsc.DescriptionTemplate,
+		IconURI:            rsc.IconURITemplate,
+		OwnerManagedAccess: rsc.OwnerManagedAccess,
+		IncludeScopes:      rsc.IncludeScopes,
+
+		LocalizedDisplayNames: rsc.LocalizedDisplayNames,
+		LocalizedIconURIs:     rsc.LocalizedIconURIs,
+	}
+	tmpls := []string{t.Name, t.DisplayName, t.Description, t.IconURI}
+	for _, m := range []map[string]string{t.LocalizedDisplayNames, t.LocalizedIconURIs} {
+		for _, s := range m {
+			tmpls = append(tmpls, s)
+		}
+	}
+	for _, s := range tmpls {
+		// generated code can only call built-in template functions
+		if err := uma.ValidateTemplate(s, nil); err != nil {
+			return nil, fmt.Errorf("invalid resource template %q: %w", s, err)
+		}
+	}
+	return t, nil
 }
 
 type operation struct {
-	Security []map[string][]string
+	Security      []map[string][]string
+	IncludeScopes *bool
 }
 
 type path struct {
-	Path         string
-	ResourceType string
-	ResourceName string
-	Operations   map[string]operation
+	Path       string
+	Resource   *resourceTemplate
+	Operations map[string]operation
+}
+
+type scopeConstant struct {
+	Name  string
+	Value string
+}
+
+type resourceConstant struct {
+	Name   string
+	Type   string
+	Scopes []scopeConstant
+}
+
+// goName turns s into an exported Go identifier e.g. "user:read" into "UserRead"
+func goName(s string) string {
+	sb := &strings.Builder{}
+	upper := true
+	for _, r := range s {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		sb.WriteRune(r)
+	}
+	name := sb.String()
+	if name != "" && !unicode.IsLetter([]rune(name)[0]) {
+		name = "X" + name
+	}
+	return name
+}
+
+// resourceTypeName returns the name of the constant of resource type rscType. Types are often URLs
+// e.g. "https://www.example.com/rsrcs/user", in which case only the last path segment is used.
+func resourceTypeName(rscType string) string {
+	s := strings.TrimRight(rscType, "/#")
+	if i := strings.LastIndexAny(s, "/#"); i >= 0 && i < len(s)-1 {
+		s = s[i+1:]
+	}
+	return "Resource" + goName(s)
+}
+
+// newResourceConstants returns constants of resource types and their scopes, sorted by type. It fails
+// if two constants end up with the same name.
+func newResourceConstants(rscTypes map[string]types.UMAResourceType) ([]resourceConstant, error) {
+	keys := make([]string, 0, len(rscTypes))
+	for k := range rscTypes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	names := map[string]string{}
+	checkName := func(name, value string) error {
+		if v, ok := names[name]; ok {
+			return fmt.Errorf("%q and %q both map to constant %s", v, value, name)
+		}
+		names[name] = value
+		return nil
+	}
+	res := make([]resourceConstant, 0, len(keys))
+	for _, k := range keys {
+		c := resourceConstant{Name: resourceTypeName(k), Type: k}
+		if err := checkName(c.Name, k); err != nil {
+			return nil, err
+		}
+		for _, scope := range rscTypes[k].ResourceScopes {
+			sc := scopeConstant{
+				Name:  "Scope" + strings.TrimPrefix(c.Name, "Resource") + goName(scope),
+				Value: scope,
+			}
+			if err := checkName(sc.Name, k+" "+scope); err != nil {
+				return nil, err
+			}
+			c.Scopes = append(c.Scopes, sc)
+		}
+		res = append(res, c)
+	}
+	return res, nil
 }
 
 type middlewareTemplateData struct {
@@ -47,11 +172,55 @@ type middlewareTemplateData struct {
 	DefaultResource        *resourceTemplate
 	DefaultSecurity        []map[string][]string
 	Paths                  []path
+	ResourceConstants      []resourceConstant
+
+	// Values are arbitrary key-value pairs given with --set, for use in custom templates
+	Values map[string]string
+}
+
+// loadTemplates returns the embedded templates, with templates defined in *.tmpl files of dir taking
+// precedence. A file in dir can replace a whole file e.g. "middleware.go.tmpl", or only redefine named
+// templates such as "resourceTemplate" and "extra".
+func loadTemplates(dir string) (*template.Template, error) {
+	if dir == "" {
+		return tmpl, nil
+	}
+	t, err := tmpl.Clone()
+	if err != nil {
+		return nil, err
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.tmpl"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no *.tmpl file found in %q", dir)
+	}
+	return t.ParseFiles(files...)
+}
+
+func renderMiddlewareCode(wr io.Writer, t *template.Template, tmplData middlewareTemplateData) error {
+	return renderCode(wr, t, "middleware.go.tmpl", tmplData)
+}
+
+type registrySpec struct {
+	Package    string
+	ImportPath string
+}
+
+type registryTemplateData struct {
+	Package string
+	Specs   []registrySpec
+}
+
+func renderRegistryCode(wr io.Writer, t *template.Template, tmplData registryTemplateData) error {
+	return renderCode(wr, t, "registry.go.tmpl", tmplData)
 }
 
-func renderMiddlewareCode(wr io.Writer, tmplData middlewareTemplateData) error {
+// renderCode executes the named template then formats the result as Go code
+func renderCode(wr io.Writer, t *template.Template, name string, tmplData interface{}) error {
 	buf := bytes.NewBuffer(nil)
-	if err := tmpl.ExecuteTemplate(buf, "middleware.go.tmpl", tmplData); err != nil {
+	if err := t.ExecuteTemplate(buf, name, tmplData); err != nil {
 		return err
 	}
 	re := regexp.MustCompile(",\n[ \t]*\n")
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+func TicketCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "ticket --issuer ISSUER --client-id ID --client-secret SECRET --resource NAME [--scope SCOPE]...",
+		Short: "Request a permission ticket for a resource",
+		Long: `Request a permission ticket for the given resource and scopes on behalf of the resource server,
+just like the UMA middleware does when it denies a request. The ticket is printed to stdout and
+can be exchanged for an RPT with the rpt command.`,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			rscName, err := cmd.Flags().GetString("resource")
+			if err != nil {
+				return err
+			}
+			scopes, err := cmd.Flags().GetStringSlice("scope")
+			if err != nil {
+				return err
+			}
+			p, err := providerFromFlags(cmd)
+			if err != nil {
+				return err
+			}
+			id, err := lookupResourceID(p, rscName)
+			if err != nil {
+				return err
+			}
+			ticket, err := p.CreatePermissionTicket(id, scopes...)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), ticket)
+			return nil
+		},
+	}
+	addASFlags(cmd)
+	cmd.Flags().String("resource", "", "name of the resource")
+	cmd.Flags().StringSlice("scope", nil, "requested scope, can be given multiple times")
+	cmd.MarkFlagRequired("resource")
+	return cmd
+}
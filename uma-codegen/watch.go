@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// writeIfChanged renders the content of name with render, then writes it unless name already has the
+// same content, so that tools watching generated files are not triggered needlessly
+func writeIfChanged(name string, render func(w io.Writer) error) (changed bool, err error) {
+	buf := &bytes.Buffer{}
+	if err := render(buf); err != nil {
+		return false, err
+	}
+	if b, err := os.ReadFile(name); err == nil && bytes.Equal(b, buf.Bytes()) {
+		return false, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return false, err
+	}
+	return true, os.WriteFile(name, buf.Bytes(), 0644)
+}
+
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// snapshot returns the states of paths and of files directly under paths that are directories
+func snapshot(paths []string) map[string]fileState {
+	res := map[string]fileState{}
+	for _, p := range paths {
+		fi, err := os.Stat(p)
+		if err != nil {
+			continue
+		}
+		res[p] = fileState{fi.ModTime(), fi.Size()}
+		if !fi.IsDir() {
+			continue
+		}
+		entries, err := os.ReadDir(p)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			if info, err := e.Info(); err == nil {
+				res[filepath.Join(p, e.Name())] = fileState{info.ModTime(), info.Size()}
+			}
+		}
+	}
+	return res
+}
+
+func sameSnapshot(a, b map[string]fileState) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if w, ok := b[k]; !ok || !v.modTime.Equal(w.modTime) || v.size != w.size {
+			return false
+		}
+	}
+	return true
+}
+
+// watchFiles polls paths every interval and calls generate whenever a file is added, removed or
+// modified, until ctx is done. Errors from generate are written to errOut.
+func watchFiles(ctx context.Context, paths []string, interval time.Duration, errOut io.Writer, generate func() error) {
+	last := snapshot(paths)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	pending := false
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		cur := snapshot(paths)
+		if !sameSnapshot(last, cur) {
+			// wait for files to settle, so that files being written are not read halfway
+			last = cur
+			pending = true
+			continue
+		}
+		if !pending {
+			continue
+		}
+		pending = false
+		if err := generate(); err != nil {
+			fmt.Fprintln(errOut, err.Error())
+		}
+	}
+}
+
+func addWatchFlags(cmd *cobra.Command) {
+	cmd.Flags().Bool("watch", false, "regenerate code whenever specs or templates change, until interrupted")
+	cmd.Flags().Duration("watch-interval", 500*time.Millisecond, "how often to check specs and templates for changes")
+}
+
+// watchedPaths returns paths to watch, ignoring empty ones e.g. when --templates is not given
+func watchedPaths(paths ...string) []string {
+	res := make([]string, 0, len(paths))
+	for _, p := range paths {
+		if p != "" {
+			res = append(res, p)
+		}
+	}
+	return res
+}
@@ -0,0 +1,102 @@
+package main_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	main "github.com/pckhoi/uma/uma-codegen"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// syncBuffer is a bytes.Buffer that can be written while being read
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// writeFileAtomic writes name with a rename, so that the watcher never sees a partially written file
+func writeFileAtomic(t *testing.T, name string, b []byte, perm os.FileMode) error {
+	t.Helper()
+	tmp := name + ".tmp"
+	if err := os.WriteFile(tmp, b, perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp, name)
+}
+
+func TestRootCmdWatch(t *testing.T) {
+	spec, err := os.ReadFile("testdata/openapi.yml")
+	require.NoError(t, err)
+	dir := t.TempDir()
+	specPath := filepath.Join(dir, "openapi.yml")
+	require.NoError(t, writeFileAtomic(t, specPath, spec, 0644))
+	output := filepath.Join(dir, "uma.gen.go")
+
+	cmd := main.RootCmd()
+	out := &syncBuffer{}
+	cmd.SetOut(out)
+	cmd.SetErr(out)
+	cmd.SetArgs([]string{specPath, "main", "-o", output, "--watch", "--watch-interval", "10ms"})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.ExecuteContext(ctx)
+	}()
+	defer func() {
+		cancel()
+		assert.NoError(t, <-done)
+	}()
+
+	assert.Eventually(t, func() bool {
+		return strings.Count(out.String(), "->") == 1
+	}, time.Second, 10*time.Millisecond)
+	b, err := os.ReadFile(output)
+	require.NoError(t, err)
+	assert.Contains(t, string(b), `"read"`)
+
+	// a change that does not affect the output does not rewrite it
+	require.NoError(t, writeFileAtomic(t, specPath, append(spec, []byte("\n# comment\n")...), 0644))
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, 1, strings.Count(out.String(), "->"))
+
+	require.NoError(t, writeFileAtomic(t, specPath, bytes.ReplaceAll(spec, []byte("read"), []byte("view")), 0644))
+	assert.Eventually(t, func() bool {
+		return strings.Count(out.String(), "->") == 2
+	}, time.Second, 10*time.Millisecond)
+	b, err = os.ReadFile(output)
+	require.NoError(t, err)
+	assert.Contains(t, string(b), `"view"`)
+
+	// errors are reported and watching goes on
+	require.NoError(t, writeFileAtomic(t, specPath, []byte("x-uma-resource-types: ["), 0644))
+	assert.Eventually(t, func() bool {
+		return strings.Contains(out.String(), "yaml")
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestRootCmdWatchRequiresOutput(t *testing.T) {
+	cmd := main.RootCmd()
+	cmd.SetOut(&bytes.Buffer{})
+	cmd.SetErr(&bytes.Buffer{})
+	cmd.SetArgs([]string{"testdata/openapi.yml", "main", "--watch"})
+	assert.EqualError(t, cmd.Execute(), "--watch requires --output")
+}
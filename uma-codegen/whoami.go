@@ -0,0 +1,134 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pckhoi/uma"
+	"github.com/spf13/cobra"
+)
+
+// readStdinToken reads a token from in unless in is an interactive terminal
+func readStdinToken(in io.Reader) (string, error) {
+	if f, ok := in.(*os.File); ok {
+		fi, err := f.Stat()
+		if err != nil {
+			return "", err
+		}
+		if fi.Mode()&os.ModeCharDevice != 0 {
+			return "", nil
+		}
+	}
+	b, err := io.ReadAll(in)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(string(b)), "Bearer ")), nil
+}
+
+func WhoamiCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "whoami --issuer ISSUER --client-id ID --client-secret SECRET [--resource NAME [--scope SCOPE]...] < RPT",
+		Short: "Troubleshoot client credentials and requesting party tokens",
+		Long: `Obtain a protection API token (PAT) with the given client credentials and print the UMA
+discovery document of the authorization server. If a requesting party token (RPT) is piped to
+stdin, decode it without verifying its signature and print its claims. If --resource is given,
+check whether the RPT grants the given scopes on that resource. If the authorization server puts
+permissions elsewhere than in authorization.permissions, give the path of their claim with
+--permission-claim, e.g. --permission-claim permissions.`,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			rscName, err := cmd.Flags().GetString("resource")
+			if err != nil {
+				return err
+			}
+			scopes, err := cmd.Flags().GetStringSlice("scope")
+			if err != nil {
+				return err
+			}
+			claimPath, err := cmd.Flags().GetStringSlice("permission-claim")
+			if err != nil {
+				return err
+			}
+			w := cmd.OutOrStdout()
+
+			p, err := providerFromFlags(cmd)
+			if err != nil {
+				return err
+			}
+			if err := printJSON(w, "Discovery document", p.Discovery()); err != nil {
+				return err
+			}
+
+			creds, err := p.Authenticate(nil)
+			if err != nil {
+				return fmt.Errorf("error obtaining PAT: %w", err)
+			}
+			fmt.Fprintf(w, "Obtained PAT of type %q, expires in %s\n", creds.TokenType, time.Duration(creds.ExpiresIn)*time.Second)
+			if b, err := decodeJWTPayload(creds.AccessToken); err == nil {
+				if rpt, err := uma.ParseRPT(b); err == nil {
+					if err := printJSON(w, "PAT claims", rpt.Raw); err != nil {
+						return err
+					}
+				}
+			}
+			fmt.Fprintln(w)
+
+			token, err := readStdinToken(cmd.InOrStdin())
+			if err != nil {
+				return err
+			}
+			if token == "" {
+				if rscName != "" {
+					return errors.New("--resource requires an RPT on stdin")
+				}
+				return nil
+			}
+			b, err := decodeJWTPayload(token)
+			if err != nil {
+				return err
+			}
+			rpt, err := uma.ParseRPT(b)
+			if err != nil {
+				return err
+			}
+			if err := printJSON(w, "RPT claims", rpt.Raw); err != nil {
+				return err
+			}
+			if rpt.Expired(time.Now()) {
+				fmt.Fprintf(w, "RPT expired at %s\n", rpt.ExpiresAt().Format(time.RFC3339))
+			} else {
+				fmt.Fprintf(w, "RPT expires at %s\n", rpt.ExpiresAt().Format(time.RFC3339))
+			}
+			if rscName == "" {
+				return nil
+			}
+			if len(claimPath) > 0 {
+				if err := rpt.ReadPermissions(claimPath...); err != nil {
+					return err
+				}
+			}
+
+			id, err := lookupResourceID(p, rscName)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "Resource %q has id %q\n", rscName, id)
+			if err := rpt.Validate(id, false, scopes); err != nil {
+				return fmt.Errorf("access denied: %w", err)
+			}
+			fmt.Fprintf(w, "Access granted: scopes %v on resource %q\n", scopes, rscName)
+			return nil
+		},
+	}
+	addASFlags(cmd)
+	cmd.Flags().String("resource", "", "name of the resource to check the RPT against")
+	cmd.Flags().StringSlice("scope", nil, "scope to check, can be given multiple times")
+	cmd.Flags().StringSlice("permission-claim", nil, "path of the claim that holds the permissions, one claim name per element")
+	return cmd
+}
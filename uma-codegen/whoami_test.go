@@ -0,0 +1,135 @@
+package main_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	main "github.com/pckhoi/uma/uma-codegen"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func fakeJWT(t *testing.T, claims map[string]interface{}) string {
+	t.Helper()
+	b, err := json.Marshal(claims)
+	require.NoError(t, err)
+	return "eyJhbGciOiJub25lIn0." + base64.RawURLEncoding.EncodeToString(b) + ".sig"
+}
+
+// newFakeAS serves the subset of UMA endpoints used by CLI commands
+func newFakeAS(t *testing.T, handle func(w http.ResponseWriter, r *http.Request) bool) *httptest.Server {
+	t.Helper()
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if handle != nil && handle(w, r) {
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.URL.Path == "/.well-known/uma2-configuration":
+			json.NewEncoder(w).Encode(map[string]string{
+				"issuer":                         srv.URL,
+				"token_endpoint":                 srv.URL + "/token",
+				"resource_registration_endpoint": srv.URL + "/resource_set",
+				"permission_endpoint":            srv.URL + "/permission",
+			})
+		case r.URL.Path == "/.well-known/openid-configuration":
+			json.NewEncoder(w).Encode(map[string]string{
+				"issuer":                 srv.URL,
+				"authorization_endpoint": srv.URL + "/auth",
+				"token_endpoint":         srv.URL + "/token",
+				"jwks_uri":               srv.URL + "/certs",
+			})
+		case r.URL.Path == "/token" && r.FormValue("grant_type") == "client_credentials":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"access_token": fakeJWT(t, map[string]interface{}{"azp": "api", "sub": "service-account-api"}),
+				"token_type":   "Bearer",
+				"expires_in":   300,
+			})
+		case r.URL.Path == "/resource_set" && r.Method == http.MethodGet:
+			ids := []string{}
+			if r.URL.Query().Get("name") == "User 1" {
+				ids = append(ids, "rsc-1")
+			}
+			json.NewEncoder(w).Encode(ids)
+		case r.URL.Path == "/resource_set/rsc-1":
+			json.NewEncoder(w).Encode(map[string]interface{}{"_id": "rsc-1", "name": "User 1"})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestWhoamiCmd(t *testing.T) {
+	srv := newFakeAS(t, nil)
+	now := time.Now()
+	rpt := fakeJWT(t, map[string]interface{}{
+		"sub": "user-1",
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(time.Hour).Unix(),
+		"authorization": map[string]interface{}{
+			"permissions": []map[string]interface{}{
+				{"rsid": "rsc-1", "rsname": "User 1", "scopes": []string{"read"}},
+			},
+		},
+	})
+
+	run := func(stdin string, args ...string) (string, error) {
+		cmd := main.RootCmd()
+		out := &bytes.Buffer{}
+		cmd.SetOut(out)
+		cmd.SetErr(out)
+		cmd.SetIn(strings.NewReader(stdin))
+		cmd.SetArgs(append([]string{"whoami", "--issuer", srv.URL, "--client-id", "api", "--client-secret", "secret"}, args...))
+		err := cmd.Execute()
+		return out.String(), err
+	}
+
+	out, err := run("")
+	require.NoError(t, err)
+	assert.Contains(t, out, `"resource_registration_endpoint": "`+srv.URL+`/resource_set"`)
+	assert.Contains(t, out, `Obtained PAT of type "Bearer", expires in 5m0s`)
+	assert.Contains(t, out, `"sub": "service-account-api"`)
+	assert.NotContains(t, out, "RPT claims")
+
+	out, err = run("Bearer "+rpt+"\n", "--resource", "User 1", "--scope", "read")
+	require.NoError(t, err)
+	assert.Contains(t, out, `"sub": "user-1"`)
+	assert.Contains(t, out, `Resource "User 1" has id "rsc-1"`)
+	assert.Contains(t, out, `Access granted: scopes [read] on resource "User 1"`)
+
+	_, err = run(rpt, "--resource", "User 1", "--scope", "write")
+	assert.EqualError(t, err, `access denied: invalid rpt: missing scope "write" for resource "rsc-1"`)
+
+	_, err = run(rpt, "--resource", "User 2")
+	assert.EqualError(t, err, `resource "User 2" not found`)
+
+	_, err = run("", "--resource", "User 1")
+	assert.EqualError(t, err, "--resource requires an RPT on stdin")
+
+	namespaced := fakeJWT(t, map[string]interface{}{
+		"sub": "user-1",
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(time.Hour).Unix(),
+		"https://example.com/uma": map[string]interface{}{
+			"permissions": []map[string]interface{}{
+				{"rsid": "rsc-1", "scopes": []string{"read"}},
+			},
+		},
+	})
+	out, err = run(namespaced, "--resource", "User 1", "--scope", "read",
+		"--permission-claim", "https://example.com/uma,permissions")
+	require.NoError(t, err)
+	assert.Contains(t, out, `Access granted: scopes [read] on resource "User 1"`)
+
+	_, err = run(namespaced, "--resource", "User 1", "--scope", "read")
+	assert.EqualError(t, err, `access denied: invalid rpt: no permission for resource "rsc-1"`)
+}
@@ -0,0 +1,104 @@
+// Command uma-syncd reconciles resource manifests written by `uma-codegen manifest --format json` against an
+// UMA authorization server. See package github.com/pckhoi/uma/pkg/syncd.
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/go-logr/logr/funcr"
+	"github.com/pckhoi/uma"
+	"github.com/pckhoi/uma/pkg/syncd"
+	"github.com/spf13/cobra"
+)
+
+func RootCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "uma-syncd --issuer ISSUER --client-id ID --client-secret SECRET --dir DIR [--listen ADDR]",
+		Short: "Continuously reconcile resource manifests against an UMA authorization server",
+		Long: `Watch the *.json manifests of DIR, e.g. a mounted ConfigMap, and create or update the resources
+they declare on the authorization server. Resources are reconciled whenever manifests change, after a
+failed sync and every --resync-interval. With --listen, the status of the last sync is served as JSON
+at /status, with status code 503 until every resource is reconciled.`,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			flags := cmd.Flags()
+			issuer, _ := flags.GetString("issuer")
+			clientID, _ := flags.GetString("client-id")
+			clientSecret, _ := flags.GetString("client-secret")
+			dir, _ := flags.GetString("dir")
+			interval, _ := flags.GetDuration("interval")
+			resync, _ := flags.GetDuration("resync-interval")
+			listen, _ := flags.GetString("listen")
+			namespace, _ := flags.GetString("namespace")
+			prune, _ := flags.GetBool("prune")
+
+			errOut := cmd.ErrOrStderr()
+			logger := funcr.New(func(prefix, args string) {
+				fmt.Fprintln(errOut, prefix, args)
+			}, funcr.Options{})
+			p, err := uma.NewBaseProvider(strings.TrimSuffix(issuer, "/"), clientID, clientSecret, nil, nil, logger,
+				uma.WithUserAgent("uma-syncd"))
+			if err != nil {
+				return err
+			}
+			s := &syncd.Syncer{
+				Provider:       p,
+				Dir:            dir,
+				Interval:       interval,
+				ResyncInterval: resync,
+				Namespace:      namespace,
+				Prune:          prune,
+				Logger:         logger,
+			}
+			ctx := cmd.Context()
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			if listen != "" {
+				mux := http.NewServeMux()
+				mux.Handle("/status", s)
+				srv := &http.Server{Addr: listen, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+				go func() {
+					if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+						logger.Error(err, "error serving status")
+					}
+				}()
+				defer srv.Close()
+			}
+			s.Run(ctx)
+			return nil
+		},
+	}
+	cmd.Flags().String("issuer", "", "issuer url of the authorization server e.g. https://kc.example.com/realms/demo")
+	cmd.Flags().String("client-id", "", "client id of the resource server")
+	cmd.Flags().String("client-secret", "", "client secret of the resource server")
+	cmd.Flags().String("dir", "", "directory of the manifests")
+	cmd.Flags().Duration("interval", 10*time.Second, "how often manifests are checked for changes")
+	cmd.Flags().Duration("resync-interval", 10*time.Minute, "how often manifests are reconciled even if they haven't changed, 0 to disable")
+	cmd.Flags().String("listen", "", "address to serve the sync status at e.g. :8080")
+	cmd.Flags().String("namespace", "", "namespace that prefixes resource names, like ManagerOptions.Namespace")
+	cmd.Flags().Bool("prune", false, "delete resources of --namespace that are no longer in any manifest")
+	cmd.MarkFlagRequired("issuer")
+	cmd.MarkFlagRequired("client-id")
+	cmd.MarkFlagRequired("client-secret")
+	cmd.MarkFlagRequired("dir")
+	return cmd
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := RootCmd().ExecuteContext(ctx); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+}
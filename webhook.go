@@ -0,0 +1,231 @@
+package uma
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/pckhoi/uma/pkg/clock"
+)
+
+const (
+	// WebhookSignatureHeader holds the hex encoded HMAC-SHA256 of the timestamp, a dot and the body of
+	// webhook requests, prefixed with "sha256=", e.g. "sha256=5257a869..."
+	WebhookSignatureHeader = "X-UMA-Signature"
+
+	// WebhookTimestampHeader holds the unix time at which a webhook request is signed. Receivers should
+	// reject old timestamps to prevent replays.
+	WebhookTimestampHeader = "X-UMA-Timestamp"
+)
+
+// WebhookSinkOptions configures a WebhookSink
+type WebhookSinkOptions struct {
+	// URL receives events as JSON in POST requests. It is required.
+	URL string
+
+	// Secret signs requests, see WebhookSignatureHeader. Requests are not signed if it is empty.
+	Secret []byte
+
+	// Client sends requests. Defaults to http.DefaultClient.
+	Client *http.Client
+
+	// QueueSize is the number of events waiting to be delivered, after which new events are dropped.
+	// Defaults to 1000.
+	QueueSize int
+
+	// MaxAttempts is the number of times delivery of an event is attempted. Defaults to 5.
+	MaxAttempts int
+
+	// Backoff is the delay before the second attempt, doubled for every further attempt up to
+	// MaxBackoff. Defaults to 1 second.
+	Backoff time.Duration
+
+	// MaxBackoff defaults to 1 minute
+	MaxBackoff time.Duration
+
+	// Logger logs dropped and undelivered events. Defaults to logr.Discard().
+	Logger logr.Logger
+
+	// Clock timestamps signatures and times backoffs. Defaults to the system clock.
+	Clock clock.Clock
+}
+
+// WebhookSink is an AuditSink that POSTs signed JSON events to a URL, e.g. to ingest them in a SIEM.
+// Events are delivered one by one in the background, in the order they occur. Requests are retried with
+// exponential backoff on network errors, 429 and 5xx responses.
+type WebhookSink struct {
+	opts  WebhookSinkOptions
+	queue chan AuditEvent
+	done  chan struct{}
+	once  sync.Once
+	// closing is closed by Close to cut backoffs short
+	closing chan struct{}
+
+	// mu keeps Close from closing the queue while Audit sends to it
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewWebhookSink starts delivering events. Call Close to deliver queued events and stop.
+func NewWebhookSink(opts WebhookSinkOptions) *WebhookSink {
+	if opts.Client == nil {
+		opts.Client = http.DefaultClient
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = 1000
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 5
+	}
+	if opts.Backoff <= 0 {
+		opts.Backoff = time.Second
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = time.Minute
+	}
+	if opts.Logger.GetSink() == nil {
+		opts.Logger = logr.Discard()
+	}
+	opts.Clock = clock.OrReal(opts.Clock)
+	s := &WebhookSink{
+		opts:    opts,
+		queue:   make(chan AuditEvent, opts.QueueSize),
+		done:    make(chan struct{}),
+		closing: make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// Audit queues e for delivery. It never blocks: if the queue is full, e is dropped and logged.
+func (s *WebhookSink) Audit(e AuditEvent) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return
+	}
+	select {
+	case s.queue <- e:
+	default:
+		s.opts.Logger.Info("webhook queue is full, dropped event", "type", e.Type, "path", e.Path)
+	}
+}
+
+// Close stops accepting events and waits until queued events are delivered or given up. Events are
+// not retried once Close is called, so it doesn't wait for backoffs. It is safe to call Close more than
+// once.
+func (s *WebhookSink) Close() error {
+	s.once.Do(func() {
+		s.mu.Lock()
+		s.closed = true
+		close(s.closing)
+		close(s.queue)
+		s.mu.Unlock()
+	})
+	<-s.done
+	return nil
+}
+
+func (s *WebhookSink) run() {
+	defer close(s.done)
+	for e := range s.queue {
+		s.deliver(e)
+	}
+}
+
+// deliver sends e until it is accepted, rejected with a non retryable status or MaxAttempts is reached
+func (s *WebhookSink) deliver(e AuditEvent) {
+	body, err := json.Marshal(e)
+	if err != nil {
+		s.opts.Logger.Error(err, "error encoding webhook event", "type", e.Type)
+		return
+	}
+	backoff := s.opts.Backoff
+	for attempt := 1; ; attempt++ {
+		retry, err := s.post(body)
+		if err == nil {
+			return
+		}
+		if !retry || attempt >= s.opts.MaxAttempts {
+			s.opts.Logger.Error(err, "error delivering webhook event", "type", e.Type, "attempts", attempt)
+			return
+		}
+		select {
+		case <-clock.After(s.opts.Clock, backoff):
+		case <-s.closing:
+			s.opts.Logger.Error(err, "gave up delivering webhook event on close", "type", e.Type, "attempts", attempt)
+			return
+		}
+		backoff *= 2
+		if backoff > s.opts.MaxBackoff {
+			backoff = s.opts.MaxBackoff
+		}
+	}
+}
+
+// sign returns the signature of body at timestamp ts
+func (s *WebhookSink) sign(ts string, body []byte) string {
+	return webhookSignature(s.opts.Secret, ts, body)
+}
+
+// webhookSignature returns the value of WebhookSignatureHeader for body signed with secret at timestamp ts
+func webhookSignature(secret []byte, ts string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// verifyWebhookSignature checks the signature headers of a webhook request with the given body. Requests
+// signed more than maxAge away from now are rejected to prevent replays.
+func verifyWebhookSignature(secret []byte, h http.Header, body []byte, now time.Time, maxAge time.Duration) error {
+	ts, sig := h.Get(WebhookTimestampHeader), h.Get(WebhookSignatureHeader)
+	if ts == "" || sig == "" {
+		return fmt.Errorf("missing %s or %s header", WebhookSignatureHeader, WebhookTimestampHeader)
+	}
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid %s header: %w", WebhookTimestampHeader, err)
+	}
+	if d := now.Sub(time.Unix(unix, 0)); d > maxAge || d < -maxAge {
+		return fmt.Errorf("%s header is too far from current time", WebhookTimestampHeader)
+	}
+	if !hmac.Equal([]byte(sig), []byte(webhookSignature(secret, ts, body))) {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
+
+// post sends body once. It reports whether the request should be retried if it failed.
+func (s *WebhookSink) post(body []byte) (retry bool, err error) {
+	req, err := http.NewRequest(http.MethodPost, s.opts.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(s.opts.Secret) > 0 {
+		ts := strconv.FormatInt(s.opts.Clock.Now().Unix(), 10)
+		req.Header.Set(WebhookTimestampHeader, ts)
+		req.Header.Set(WebhookSignatureHeader, s.sign(ts, body))
+	}
+	resp, err := s.opts.Client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	err = fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500, err
+}
@@ -0,0 +1,218 @@
+package uma_test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr/testr"
+	"github.com/pckhoi/uma"
+	"github.com/pckhoi/uma/pkg/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookSink(t *testing.T) {
+	secret := []byte("s3cret")
+	var (
+		mu       sync.Mutex
+		attempts int
+		events   []uma.AuditEvent
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		// the first attempt fails and is retried
+		if attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(r.Header.Get(uma.WebhookTimestampHeader) + "."))
+		mac.Write(body)
+		assert.Equal(t, "sha256="+hex.EncodeToString(mac.Sum(nil)), r.Header.Get(uma.WebhookSignatureHeader))
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		e := uma.AuditEvent{}
+		require.NoError(t, json.Unmarshal(body, &e))
+		events = append(events, e)
+	}))
+	defer srv.Close()
+
+	c := clock.NewFake(time.Now())
+	sink := uma.NewWebhookSink(uma.WebhookSinkOptions{
+		URL:     srv.URL,
+		Secret:  secret,
+		Backoff: time.Second,
+		Logger:  testr.New(t),
+		Clock:   c,
+	})
+	p := newMockProvider(map[string]string{
+		"token-1": rptPayload("user-1", "User 1", "read"),
+	})
+	h := newMockManager(t, p, uma.ManagerOptions{AuditSink: sink}).
+		Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	assert.Equal(t, http.StatusOK, serve(h, http.MethodGet, "https://api.example.com/users/1", "token-1").Code)
+	assert.Equal(t, http.StatusUnauthorized, serve(h, http.MethodPut, "https://api.example.com/users/1", "token-1").Code)
+	advanceBackoff(t, c, time.Second)
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(events) == 3
+	}, time.Second, time.Millisecond)
+	require.NoError(t, sink.Close())
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, 4, attempts)
+	require.Len(t, events, 3)
+	for _, e := range events {
+		assert.Equal(t, "https://as.example.com", e.Issuer)
+		assert.Equal(t, "rsc-User 1", e.ResourceID)
+		assert.Equal(t, "User 1", e.ResourceName)
+		assert.Equal(t, "/users/1", e.Path)
+		assert.False(t, e.Time.IsZero())
+	}
+	assert.Equal(t, uma.AuditResourceRegistered, events[0].Type)
+	assert.Equal(t, http.MethodGet, events[0].Method)
+	assert.Equal(t, uma.AuditAccessDenied, events[1].Type)
+	assert.Equal(t, http.MethodPut, events[1].Method)
+	assert.Equal(t, []string{"write"}, events[1].Scopes)
+	assert.Equal(t, uma.DenialScopeMismatch, events[1].Reason)
+	assert.Equal(t, uma.AuditTicketIssued, events[2].Type)
+	assert.Equal(t, []string{"write"}, events[2].Scopes)
+}
+
+// advanceBackoff waits for the sink to back off, then moves c past the backoff
+func advanceBackoff(t *testing.T, c *clock.Fake, d time.Duration) {
+	t.Helper()
+	require.Eventually(t, func() bool { return c.Waiters() == 1 }, time.Second, time.Millisecond)
+	c.Advance(d)
+}
+
+func TestWebhookSinkGivesUp(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		attempts int
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		if r.URL.Path == "/bad-request" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	sink := uma.NewWebhookSink(uma.WebhookSinkOptions{
+		URL:         srv.URL + "/bad-request",
+		MaxAttempts: 3,
+		Backoff:     time.Millisecond,
+		Logger:      testr.New(t),
+	})
+	sink.Audit(uma.AuditEvent{Type: uma.AuditAccessDenied})
+	require.NoError(t, sink.Close())
+	// events after Close are dropped
+	sink.Audit(uma.AuditEvent{Type: uma.AuditAccessDenied})
+	assert.Equal(t, 1, attempts)
+
+	c := clock.NewFake(time.Now())
+	sink = uma.NewWebhookSink(uma.WebhookSinkOptions{
+		URL:         srv.URL,
+		MaxAttempts: 3,
+		Backoff:     time.Second,
+		Logger:      testr.New(t),
+		Clock:       c,
+	})
+	sink.Audit(uma.AuditEvent{Type: uma.AuditAccessDenied})
+	advanceBackoff(t, c, time.Second)
+	advanceBackoff(t, c, 2*time.Second)
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return attempts == 4
+	}, time.Second, time.Millisecond)
+	require.NoError(t, sink.Close())
+	assert.Equal(t, 4, attempts)
+	assert.Equal(t, 0, c.Waiters())
+}
+
+func TestWebhookSinkCloseDuringBackoff(t *testing.T) {
+	var attempts int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	c := clock.NewFake(time.Now())
+	sink := uma.NewWebhookSink(uma.WebhookSinkOptions{
+		URL:     srv.URL,
+		Backoff: time.Hour,
+		Logger:  testr.New(t),
+		Clock:   c,
+	})
+	sink.Audit(uma.AuditEvent{Type: uma.AuditAccessDenied})
+	sink.Audit(uma.AuditEvent{Type: uma.AuditAccessDenied})
+	require.Eventually(t, func() bool { return c.Waiters() == 1 }, time.Second, time.Millisecond)
+
+	// the backoff is cut short and the queued event is attempted once
+	closed := make(chan error)
+	go func() { closed <- sink.Close() }()
+	select {
+	case err := <-closed:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("Close waited for the backoff")
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(&attempts))
+}
+
+func TestWebhookSinkWithoutLogger(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	// undelivered and dropped events are logged with the default logger
+	sink := uma.NewWebhookSink(uma.WebhookSinkOptions{URL: srv.URL, QueueSize: 1})
+	for i := 0; i < 10; i++ {
+		sink.Audit(uma.AuditEvent{Type: uma.AuditAccessDenied})
+	}
+	require.NoError(t, sink.Close())
+}
+
+func TestWebhookSinkAuditDuringClose(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	for i := 0; i < 20; i++ {
+		sink := uma.NewWebhookSink(uma.WebhookSinkOptions{URL: srv.URL, Logger: testr.New(t)})
+		wg := sync.WaitGroup{}
+		for j := 0; j < 4; j++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for k := 0; k < 50; k++ {
+					sink.Audit(uma.AuditEvent{Type: uma.AuditAccessDenied})
+				}
+			}()
+		}
+		require.NoError(t, sink.Close())
+		wg.Wait()
+	}
+}